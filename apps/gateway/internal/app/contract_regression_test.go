@@ -431,6 +431,10 @@ func (c *contractRegressionProbeChannel) Name() string {
 	return c.name
 }
 
+func (c *contractRegressionProbeChannel) Capabilities() plugin.ChannelCapabilities {
+	return plugin.ChannelCapabilities{}
+}
+
 func (c *contractRegressionProbeChannel) SendText(_ context.Context, userID, sessionID, text string, cfg map[string]interface{}) error {
 	c.callCount++
 	c.lastUserID = userID
@@ -788,6 +792,45 @@ func TestContractRegressionCronEndpointErrors(t *testing.T) {
 			wantCode:    "invalid_cron_task_type",
 			wantMessage: `unsupported task_type="unknown"`,
 		},
+		{
+			name:   "create_invalid_cron_expression",
+			method: http.MethodPost,
+			path:   "/cron/jobs",
+			body: `{
+				"id":"job-invalid-cron",
+				"name":"job-invalid-cron",
+				"task_type":"text",
+				"text":"hello",
+				"schedule":{"type":"cron","cron":"61 * * * *"}
+			}`,
+			wantStatus:  http.StatusBadRequest,
+			wantCode:    "invalid_cron_schedule",
+			wantMessage: "invalid cron expression: end of range (61) above maximum (59): 61",
+		},
+		{
+			name:        "preview_invalid_schedule",
+			method:      http.MethodPost,
+			path:        "/cron/preview",
+			body:        `{"schedule":{"type":"interval","cron":"soon"}}`,
+			wantStatus:  http.StatusBadRequest,
+			wantCode:    "invalid_cron_schedule",
+			wantMessage: `invalid schedule interval: "soon"`,
+		},
+		{
+			name:   "update_invalid_interval",
+			method: http.MethodPut,
+			path:   "/cron/jobs/job-a",
+			body: `{
+				"id":"job-a",
+				"name":"job-a",
+				"task_type":"text",
+				"text":"hello",
+				"schedule":{"type":"interval","cron":"every minute"}
+			}`,
+			wantStatus:  http.StatusBadRequest,
+			wantCode:    "invalid_cron_schedule",
+			wantMessage: `invalid schedule interval: "every minute"`,
+		},
 		{
 			name:        "update_job_id_mismatch",
 			method:      http.MethodPut,
@@ -815,6 +858,33 @@ func TestContractRegressionCronEndpointErrors(t *testing.T) {
 			wantCode:    "not_found",
 			wantMessage: "cron job not found",
 		},
+		{
+			name:        "enable_not_found",
+			method:      http.MethodPost,
+			path:        "/cron/jobs/not-exists/enable",
+			body:        "",
+			wantStatus:  http.StatusNotFound,
+			wantCode:    "not_found",
+			wantMessage: "cron job not found",
+		},
+		{
+			name:        "disable_not_found",
+			method:      http.MethodPost,
+			path:        "/cron/jobs/not-exists/disable",
+			body:        "",
+			wantStatus:  http.StatusNotFound,
+			wantCode:    "not_found",
+			wantMessage: "cron job not found",
+		},
+		{
+			name:        "history_not_found",
+			method:      http.MethodGet,
+			path:        "/cron/jobs/not-exists/history",
+			body:        "",
+			wantStatus:  http.StatusNotFound,
+			wantCode:    "not_found",
+			wantMessage: "cron job not found",
+		},
 		{
 			name:        "delete_default_cron_protected",
 			method:      http.MethodDelete,
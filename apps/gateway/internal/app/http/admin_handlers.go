@@ -11,16 +11,22 @@ type AdminHandlers struct {
 	GetModelCatalog    stdhttp.HandlerFunc
 	ConfigureProvider  stdhttp.HandlerFunc
 	DeleteProvider     stdhttp.HandlerFunc
+	TestProvider       stdhttp.HandlerFunc
+	GetRemoteModels    stdhttp.HandlerFunc
 	GetActiveModels    stdhttp.HandlerFunc
 	SetActiveModels    stdhttp.HandlerFunc
 	ListEnvs           stdhttp.HandlerFunc
 	PutEnvs            stdhttp.HandlerFunc
+	PatchEnvs          stdhttp.HandlerFunc
+	ExportEnvs         stdhttp.HandlerFunc
 	DeleteEnv          stdhttp.HandlerFunc
 	ListSkills         stdhttp.HandlerFunc
 	ListAvailableSkill stdhttp.HandlerFunc
 	BatchDisableSkills stdhttp.HandlerFunc
 	BatchEnableSkills  stdhttp.HandlerFunc
 	CreateSkill        stdhttp.HandlerFunc
+	ImportSkill        stdhttp.HandlerFunc
+	ExportSkill        stdhttp.HandlerFunc
 	DisableSkill       stdhttp.HandlerFunc
 	EnableSkill        stdhttp.HandlerFunc
 	DeleteSkill        stdhttp.HandlerFunc
@@ -30,21 +36,35 @@ type AdminHandlers struct {
 	PutWorkspaceFile   stdhttp.HandlerFunc
 	UploadWorkspace    stdhttp.HandlerFunc
 	DeleteWorkspace    stdhttp.HandlerFunc
+	DiffWorkspaceFile  stdhttp.HandlerFunc
 	ExportWorkspace    stdhttp.HandlerFunc
 	ImportWorkspace    stdhttp.HandlerFunc
 	ListChannels       stdhttp.HandlerFunc
 	ListChannelTypes   stdhttp.HandlerFunc
 	PutChannels        stdhttp.HandlerFunc
 	GetChannel         stdhttp.HandlerFunc
+	GetChannelCaps     stdhttp.HandlerFunc
 	PutChannel         stdhttp.HandlerFunc
+	GetDisabledTools   stdhttp.HandlerFunc
+	PutDisabledTools   stdhttp.HandlerFunc
+	GetStats           stdhttp.HandlerFunc
+	ListUserRuns       stdhttp.HandlerFunc
+	CancelUserRuns     stdhttp.HandlerFunc
 }
 
 func registerAdminRoutes(api chi.Router, handlers AdminHandlers) {
+	api.Route("/admin", func(r chi.Router) {
+		r.Get("/stats", mustHandler("get-admin-stats", handlers.GetStats))
+		r.Get("/runs", mustHandler("list-user-runs", handlers.ListUserRuns))
+		r.Post("/runs/cancel", mustHandler("cancel-user-runs", handlers.CancelUserRuns))
+	})
 	api.Route("/models", func(r chi.Router) {
 		r.Get("/", mustHandler("list-providers", handlers.ListProviders))
 		r.Get("/catalog", mustHandler("get-model-catalog", handlers.GetModelCatalog))
 		r.Put("/{provider_id}/config", mustHandler("configure-provider", handlers.ConfigureProvider))
 		r.Delete("/{provider_id}", mustHandler("delete-provider", handlers.DeleteProvider))
+		r.Post("/{provider_id}/test", mustHandler("test-provider", handlers.TestProvider))
+		r.Get("/{provider_id}/remote-models", mustHandler("get-remote-models", handlers.GetRemoteModels))
 		r.Get("/active", mustHandler("get-active-models", handlers.GetActiveModels))
 		r.Put("/active", mustHandler("set-active-models", handlers.SetActiveModels))
 	})
@@ -52,6 +72,8 @@ func registerAdminRoutes(api chi.Router, handlers AdminHandlers) {
 	api.Route("/envs", func(r chi.Router) {
 		r.Get("/", mustHandler("list-envs", handlers.ListEnvs))
 		r.Put("/", mustHandler("put-envs", handlers.PutEnvs))
+		r.Patch("/", mustHandler("patch-envs", handlers.PatchEnvs))
+		r.Get("/export", mustHandler("export-envs", handlers.ExportEnvs))
 		r.Delete("/{key}", mustHandler("delete-env", handlers.DeleteEnv))
 	})
 
@@ -61,6 +83,8 @@ func registerAdminRoutes(api chi.Router, handlers AdminHandlers) {
 		r.Post("/batch-disable", mustHandler("batch-disable-skills", handlers.BatchDisableSkills))
 		r.Post("/batch-enable", mustHandler("batch-enable-skills", handlers.BatchEnableSkills))
 		r.Post("/", mustHandler("create-skill", handlers.CreateSkill))
+		r.Post("/import", mustHandler("import-skill", handlers.ImportSkill))
+		r.Get("/{skill_name}/export", mustHandler("export-skill", handlers.ExportSkill))
 		r.Post("/{skill_name}/disable", mustHandler("disable-skill", handlers.DisableSkill))
 		r.Post("/{skill_name}/enable", mustHandler("enable-skill", handlers.EnableSkill))
 		r.Delete("/{skill_name}", mustHandler("delete-skill", handlers.DeleteSkill))
@@ -71,6 +95,7 @@ func registerAdminRoutes(api chi.Router, handlers AdminHandlers) {
 		r.Get("/files", mustHandler("list-workspace-files", handlers.ListWorkspaceFiles))
 		r.Get("/files/*", mustHandler("get-workspace-file", handlers.GetWorkspaceFile))
 		r.Put("/files/*", mustHandler("put-workspace-file", handlers.PutWorkspaceFile))
+		r.Post("/files/*", mustHandler("diff-workspace-file", handlers.DiffWorkspaceFile))
 		r.Post("/uploads", mustHandler("upload-workspace-file", handlers.UploadWorkspace))
 		r.Delete("/files/*", mustHandler("delete-workspace-file", handlers.DeleteWorkspace))
 		r.Get("/export", mustHandler("export-workspace", handlers.ExportWorkspace))
@@ -83,5 +108,8 @@ func registerAdminRoutes(api chi.Router, handlers AdminHandlers) {
 		r.Put("/channels", mustHandler("put-channels", handlers.PutChannels))
 		r.Get("/channels/{channel_name}", mustHandler("get-channel", handlers.GetChannel))
 		r.Put("/channels/{channel_name}", mustHandler("put-channel", handlers.PutChannel))
+		r.Get("/channels/{channel_name}/capabilities", mustHandler("get-channel-capabilities", handlers.GetChannelCaps))
+		r.Get("/tools/disabled", mustHandler("get-disabled-tools", handlers.GetDisabledTools))
+		r.Put("/tools/disabled", mustHandler("put-disabled-tools", handlers.PutDisabledTools))
 	})
 }
@@ -11,10 +11,21 @@ type AgentHandlers struct {
 	CreateChat            stdhttp.HandlerFunc
 	BatchDeleteChats      stdhttp.HandlerFunc
 	GetChat               stdhttp.HandlerFunc
+	GetChatMeta           stdhttp.HandlerFunc
 	UpdateChat            stdhttp.HandlerFunc
+	RenameChat            stdhttp.HandlerFunc
 	DeleteChat            stdhttp.HandlerFunc
+	ArchiveChat           stdhttp.HandlerFunc
+	UnarchiveChat         stdhttp.HandlerFunc
+	RestoreChat           stdhttp.HandlerFunc
+	SummarizeChat         stdhttp.HandlerFunc
 	ProcessAgent          stdhttp.HandlerFunc
 	GetAgentSystemLayers  stdhttp.HandlerFunc
+	ListToolSchemas       stdhttp.HandlerFunc
+	GetAgentRunEvents     stdhttp.HandlerFunc
+	CancelAgentRun        stdhttp.HandlerFunc
+	ApproveAgentRun       stdhttp.HandlerFunc
+	RejectAgentRun        stdhttp.HandlerFunc
 	BootstrapSession      stdhttp.HandlerFunc
 	SetSessionModel       stdhttp.HandlerFunc
 	PreviewMutation       stdhttp.HandlerFunc
@@ -30,12 +41,23 @@ func registerAgentRoutes(api chi.Router, handlers AgentHandlers) {
 		r.Post("/", mustHandler("create-chat", handlers.CreateChat))
 		r.Post("/batch-delete", mustHandler("batch-delete-chats", handlers.BatchDeleteChats))
 		r.Get("/{chat_id}", mustHandler("get-chat", handlers.GetChat))
+		r.Get("/{chat_id}/meta", mustHandler("get-chat-meta", handlers.GetChatMeta))
 		r.Put("/{chat_id}", mustHandler("update-chat", handlers.UpdateChat))
+		r.Patch("/{chat_id}", mustHandler("rename-chat", handlers.RenameChat))
 		r.Delete("/{chat_id}", mustHandler("delete-chat", handlers.DeleteChat))
+		r.Post("/{chat_id}/archive", mustHandler("archive-chat", handlers.ArchiveChat))
+		r.Post("/{chat_id}/unarchive", mustHandler("unarchive-chat", handlers.UnarchiveChat))
+		r.Post("/{chat_id}/restore", mustHandler("restore-chat", handlers.RestoreChat))
+		r.Post("/{chat_id}/summarize", mustHandler("summarize-chat", handlers.SummarizeChat))
 	})
 
 	api.Post("/agent/process", mustHandler("process-agent", handlers.ProcessAgent))
 	api.Get("/agent/system-layers", mustHandler("get-agent-system-layers", handlers.GetAgentSystemLayers))
+	api.Get("/tools/schemas", mustHandler("list-tool-schemas", handlers.ListToolSchemas))
+	api.Get("/agent/runs/{run_id}/events", mustHandler("get-agent-run-events", handlers.GetAgentRunEvents))
+	api.Post("/agent/runs/{run_id}/cancel", mustHandler("cancel-agent-run", handlers.CancelAgentRun))
+	api.Post("/agent/runs/{run_id}/approve", mustHandler("approve-agent-run", handlers.ApproveAgentRun))
+	api.Post("/agent/runs/{run_id}/reject", mustHandler("reject-agent-run", handlers.RejectAgentRun))
 	api.Post("/agent/self/sessions/bootstrap", mustHandler("selfops-bootstrap-session", handlers.BootstrapSession))
 	api.Put("/agent/self/sessions/{session_id}/model", mustHandler("selfops-set-session-model", handlers.SetSessionModel))
 	api.Post("/agent/self/config-mutations/preview", mustHandler("selfops-preview-mutation", handlers.PreviewMutation))
@@ -7,27 +7,45 @@ import (
 )
 
 type CronHandlers struct {
-	ListCronJobs  stdhttp.HandlerFunc
-	CreateCronJob stdhttp.HandlerFunc
-	GetCronJob    stdhttp.HandlerFunc
-	UpdateCronJob stdhttp.HandlerFunc
-	DeleteCronJob stdhttp.HandlerFunc
-	PauseCronJob  stdhttp.HandlerFunc
-	ResumeCronJob stdhttp.HandlerFunc
-	RunCronJob    stdhttp.HandlerFunc
-	GetCronState  stdhttp.HandlerFunc
+	ListCronJobs   stdhttp.HandlerFunc
+	CreateCronJob  stdhttp.HandlerFunc
+	BatchCreate    stdhttp.HandlerFunc
+	ValidateJob    stdhttp.HandlerFunc
+	PreviewCron    stdhttp.HandlerFunc
+	GetCronJob     stdhttp.HandlerFunc
+	UpdateCronJob  stdhttp.HandlerFunc
+	DeleteCronJob  stdhttp.HandlerFunc
+	PauseCronJob   stdhttp.HandlerFunc
+	ResumeCronJob  stdhttp.HandlerFunc
+	EnableCronJob  stdhttp.HandlerFunc
+	DisableCronJob stdhttp.HandlerFunc
+	RunCronJob     stdhttp.HandlerFunc
+	RunCronSync    stdhttp.HandlerFunc
+	GetCronState   stdhttp.HandlerFunc
+	GetHistory     stdhttp.HandlerFunc
+	GetOverview    stdhttp.HandlerFunc
+	ReapLeases     stdhttp.HandlerFunc
 }
 
 func registerCronRoutes(api chi.Router, handlers CronHandlers) {
 	api.Route("/cron", func(r chi.Router) {
 		r.Get("/jobs", mustHandler("list-cron-jobs", handlers.ListCronJobs))
 		r.Post("/jobs", mustHandler("create-cron-job", handlers.CreateCronJob))
+		r.Post("/jobs/batch", mustHandler("batch-create-cron-jobs", handlers.BatchCreate))
+		r.Post("/jobs/validate", mustHandler("validate-cron-job", handlers.ValidateJob))
+		r.Post("/preview", mustHandler("preview-cron-schedule", handlers.PreviewCron))
+		r.Get("/overview", mustHandler("get-cron-overview", handlers.GetOverview))
+		r.Post("/leases/reap", mustHandler("reap-cron-leases", handlers.ReapLeases))
 		r.Get("/jobs/{job_id}", mustHandler("get-cron-job", handlers.GetCronJob))
 		r.Put("/jobs/{job_id}", mustHandler("update-cron-job", handlers.UpdateCronJob))
 		r.Delete("/jobs/{job_id}", mustHandler("delete-cron-job", handlers.DeleteCronJob))
 		r.Post("/jobs/{job_id}/pause", mustHandler("pause-cron-job", handlers.PauseCronJob))
 		r.Post("/jobs/{job_id}/resume", mustHandler("resume-cron-job", handlers.ResumeCronJob))
+		r.Post("/jobs/{job_id}/enable", mustHandler("enable-cron-job", handlers.EnableCronJob))
+		r.Post("/jobs/{job_id}/disable", mustHandler("disable-cron-job", handlers.DisableCronJob))
 		r.Post("/jobs/{job_id}/run", mustHandler("run-cron-job", handlers.RunCronJob))
+		r.Post("/jobs/{job_id}/run-sync", mustHandler("run-cron-job-sync", handlers.RunCronSync))
 		r.Get("/jobs/{job_id}/state", mustHandler("get-cron-job-state", handlers.GetCronState))
+		r.Get("/jobs/{job_id}/history", mustHandler("get-cron-job-history", handlers.GetHistory))
 	})
 }
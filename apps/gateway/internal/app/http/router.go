@@ -14,6 +14,7 @@ type PublicHandlers struct {
 	Version       stdhttp.HandlerFunc
 	Healthz       stdhttp.HandlerFunc
 	RuntimeConfig stdhttp.HandlerFunc
+	Metrics       stdhttp.HandlerFunc
 }
 
 type Handlers struct {
@@ -23,7 +24,7 @@ type Handlers struct {
 	Admin  AdminHandlers
 }
 
-func NewRouter(apiKey string, handlers Handlers, webHandler stdhttp.HandlerFunc) stdhttp.Handler {
+func NewRouter(apiKey string, scopedAPIKeys map[string][]string, handlers Handlers, webHandler stdhttp.HandlerFunc) stdhttp.Handler {
 	r := chi.NewRouter()
 	r.Use(middleware.RealIP)
 	r.Use(observability.RequestID)
@@ -33,7 +34,7 @@ func NewRouter(apiKey string, handlers Handlers, webHandler stdhttp.HandlerFunc)
 	registerPublicRoutes(r, handlers.Public)
 
 	r.Group(func(api chi.Router) {
-		api.Use(observability.APIKey(apiKey))
+		api.Use(observability.APIKey(apiKey, scopedAPIKeys))
 
 		registerAgentRoutes(api, handlers.Agent)
 		registerCronRoutes(api, handlers.Cron)
@@ -51,12 +52,13 @@ func registerPublicRoutes(r chi.Router, handlers PublicHandlers) {
 	r.Get("/version", mustHandler("version", handlers.Version))
 	r.Get("/healthz", mustHandler("healthz", handlers.Healthz))
 	r.Get("/runtime-config", mustHandler("runtime-config", handlers.RuntimeConfig))
+	r.Get("/metrics", mustHandler("metrics", handlers.Metrics))
 }
 
 func cors(next stdhttp.Handler) stdhttp.Handler {
 	return stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET,POST,PUT,DELETE,OPTIONS")
+		w.Header().Set("Access-Control-Allow-Methods", "GET,POST,PUT,PATCH,DELETE,OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type,Authorization,X-Request-Id,X-NextAI-Source")
 		if r.Method == stdhttp.MethodOptions {
 			w.WriteHeader(stdhttp.StatusNoContent)
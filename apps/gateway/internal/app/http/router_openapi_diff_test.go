@@ -22,6 +22,12 @@ var contractHTTPMethods = map[string]struct{}{
 	http.MethodDelete: {},
 }
 
+// suffixDispatchedRoutes maps wildcard runtime routes to the fixed-suffix
+// path the handler dispatches, since a chi wildcard cannot pin a suffix.
+var suffixDispatchedRoutes = map[string]string{
+	http.MethodPost + " /workspace/files/{}": "/workspace/files/{}/diff",
+}
+
 func TestRuntimeRoutesMatchOpenAPI(t *testing.T) {
 	t.Parallel()
 
@@ -53,7 +59,7 @@ func TestRuntimeRoutesMatchOpenAPI(t *testing.T) {
 func collectRuntimeOperations(t *testing.T) map[string]map[string]struct{} {
 	t.Helper()
 
-	router := NewRouter("test-api-key", newNoOpHandlers(), nil)
+	router := NewRouter("test-api-key", nil, newNoOpHandlers(), nil)
 	routes, ok := router.(chi.Routes)
 	if !ok {
 		t.Fatalf("router does not implement chi.Routes: %T", router)
@@ -65,7 +71,11 @@ func collectRuntimeOperations(t *testing.T) map[string]map[string]struct{} {
 		if !isContractHTTPMethod(method) {
 			return nil
 		}
-		addOperation(ops, normalizePathPattern(route), method)
+		path := normalizePathPattern(route)
+		if dispatched, ok := suffixDispatchedRoutes[method+" "+path]; ok {
+			path = dispatched
+		}
+		addOperation(ops, path, method)
 		return nil
 	}); err != nil {
 		t.Fatalf("walk runtime routes failed: %v", err)
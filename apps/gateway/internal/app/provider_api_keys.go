@@ -0,0 +1,79 @@
+package app
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"nextai/apps/gateway/internal/runner"
+)
+
+// providerAPIKeyCooldown is how long a key that answered 401 or 429 is skipped.
+const providerAPIKeyCooldown = time.Minute
+
+// providerAPIKeyPool hands out a provider's keys round-robin, skipping keys
+// that recently failed. Each Server owns one pool.
+type providerAPIKeyPool struct {
+	mu           sync.Mutex
+	next         map[string]int
+	coolingUntil map[string]time.Time
+}
+
+func newProviderAPIKeyPool() *providerAPIKeyPool {
+	return &providerAPIKeyPool{
+		next:         map[string]int{},
+		coolingUntil: map[string]time.Time{},
+	}
+}
+
+// pick returns the next key for providerID that is not cooling down. When
+// every key is cooling down it still rotates, so requests keep going out.
+func (p *providerAPIKeyPool) pick(providerID string, keys []string, now time.Time) string {
+	if len(keys) == 0 {
+		return ""
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	start := p.next[providerID] % len(keys)
+	chosen := start
+	for offset := 0; offset < len(keys); offset++ {
+		idx := (start + offset) % len(keys)
+		if until, ok := p.coolingUntil[providerAPIKeyID(providerID, keys[idx])]; ok && now.Before(until) {
+			continue
+		}
+		chosen = idx
+		break
+	}
+	p.next[providerID] = chosen + 1
+	return keys[chosen]
+}
+
+func (p *providerAPIKeyPool) markFailed(providerID, key string, now time.Time) {
+	if strings.TrimSpace(key) == "" {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.coolingUntil[providerAPIKeyID(providerID, key)] = now.Add(providerAPIKeyCooldown)
+}
+
+func providerAPIKeyID(providerID, key string) string {
+	return providerID + "\x00" + key
+}
+
+// noteProviderAPIKeyFailure puts the key used for cfg on cooldown when the
+// provider rejected it as unauthorized or rate limited. Every provider call
+// made with a config from buildModelGenerateConfig should report its error
+// here, so a bad key is skipped whichever feature hit it first.
+func (s *Server) noteProviderAPIKeyFailure(cfg runner.GenerateConfig, err error) {
+	var runnerErr *runner.RunnerError
+	if !errors.As(err, &runnerErr) {
+		return
+	}
+	if runnerErr.Status != http.StatusUnauthorized && runnerErr.Status != http.StatusTooManyRequests {
+		return
+	}
+	s.providerAPIKeys.markFailed(cfg.ProviderID, cfg.APIKey, time.Now())
+}
@@ -257,7 +257,7 @@ func (s *Server) loadQQInboundConfig() (qqInboundConfig, bool) {
 			TokenURL:     tokenURL,
 			Intents:      qqDefaultIntents,
 		}
-		if parsed, ok := parseQQIntents(raw["inbound_intents"]); ok && parsed > 0 {
+		if parsed, ok := parseQQPositiveInt(raw["inbound_intents"]); ok && parsed > 0 {
 			cfg.Intents = parsed
 			cfg.IntentsSet = true
 		}
@@ -584,7 +584,7 @@ func parseQQHeartbeatInterval(raw json.RawMessage) time.Duration {
 	return time.Duration(intervalMS) * time.Millisecond
 }
 
-func parseQQIntents(raw interface{}) (int, bool) {
+func parseQQPositiveInt(raw interface{}) (int, bool) {
 	switch v := raw.(type) {
 	case float64:
 		if v > 0 {
@@ -644,7 +644,7 @@ func qqInboundMap(raw interface{}) (map[string]interface{}, bool) {
 func (s *Server) dispatchQQInboundPayload(ctx context.Context, payload []byte) (accepted bool, reason string, err error) {
 	req := httptest.NewRequest(http.MethodPost, "/channels/qq/inbound", bytes.NewReader(payload)).WithContext(ctx)
 	rec := httptest.NewRecorder()
-	s.processQQInbound(rec, req)
+	s.withUserRateLimit(s.processQQInbound, qqInboundRateLimitKey)(rec, req)
 	if rec.Code < http.StatusOK || rec.Code >= http.StatusMultipleChoices {
 		return false, "", fmt.Errorf("qq inbound handler status=%d body=%s", rec.Code, strings.TrimSpace(rec.Body.String()))
 	}
@@ -0,0 +1,206 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"nextai/apps/gateway/internal/domain"
+	"nextai/apps/gateway/internal/repo"
+)
+
+// qqInboundBatch buffers a burst of QQ messages from one session until the
+// debounce window passes without a new message.
+type qqInboundBatch struct {
+	events []qqInboundEvent
+	timer  *time.Timer
+}
+
+// qqInboundDebounceWindow returns the qq channel inbound_debounce_ms setting;
+// zero disables batching.
+func (s *Server) qqInboundDebounceWindow() time.Duration {
+	window := time.Duration(0)
+	s.store.Read(func(st *repo.State) {
+		if st == nil {
+			return
+		}
+		if ms, ok := parseQQPositiveInt(st.Channels["qq"]["inbound_debounce_ms"]); ok {
+			window = time.Duration(ms) * time.Millisecond
+		}
+	})
+	return window
+}
+
+// debounceQQInboundEvent buffers event when debouncing is on and reports
+// whether the caller should stop. A /new command is never buffered: it flushes
+// the pending batch first so the earlier messages land before the reset, and
+// the caller holds release until the reset turn is done.
+func (s *Server) debounceQQInboundEvent(event qqInboundEvent) (bool, func()) {
+	window := s.qqInboundDebounceWindow()
+	if window <= 0 {
+		return false, func() {}
+	}
+	key := event.UserID + "\x00" + event.SessionID
+	s.qqDebounceMu.Lock()
+	if s.qqDebounceClosed {
+		s.qqDebounceMu.Unlock()
+		return false, func() {}
+	}
+	if strings.EqualFold(strings.TrimSpace(event.Text), contextResetCommand) {
+		var events []qqInboundEvent
+		if batch := s.qqDebounce[key]; batch != nil {
+			batch.timer.Stop()
+			delete(s.qqDebounce, key)
+			events = batch.events
+		}
+		prev, done := s.queueQQInboundFlushLocked(key)
+		s.qqDebounceMu.Unlock()
+		if prev != nil {
+			<-prev
+		}
+		s.runQQInboundBatch(events)
+		return false, func() { s.finishQQInboundFlush(key, done) }
+	}
+	defer s.qqDebounceMu.Unlock()
+	if s.qqDebounce == nil {
+		s.qqDebounce = map[string]*qqInboundBatch{}
+	}
+	if batch, ok := s.qqDebounce[key]; ok {
+		batch.events = append(batch.events, event)
+		// A timer that already fired is waiting on the lock and will pick up
+		// this event, so only push the deadline out while it is still pending.
+		if batch.timer.Stop() {
+			batch.timer.Reset(window)
+		}
+		return true, nil
+	}
+	batch := &qqInboundBatch{events: []qqInboundEvent{event}}
+	batch.timer = time.AfterFunc(window, func() {
+		s.flushQQInboundBatch(key, batch)
+	})
+	s.qqDebounce[key] = batch
+	return true, nil
+}
+
+func (s *Server) flushQQInboundBatch(key string, batch *qqInboundBatch) {
+	s.qqDebounceMu.Lock()
+	if s.qqDebounce[key] != batch {
+		s.qqDebounceMu.Unlock()
+		return
+	}
+	delete(s.qqDebounce, key)
+	prev, done := s.queueQQInboundFlushLocked(key)
+	s.qqDebounceMu.Unlock()
+	if prev != nil {
+		<-prev
+	}
+	s.runQQInboundBatch(batch.events)
+	s.finishQQInboundFlush(key, done)
+}
+
+// queueQQInboundFlushLocked reserves the next turn for key. The caller waits
+// on prev, when it is non-nil, before running and passes done to
+// finishQQInboundFlush afterwards. qqDebounceMu must be held.
+func (s *Server) queueQQInboundFlushLocked(key string) (prev <-chan struct{}, done chan struct{}) {
+	if s.qqFlushTail == nil {
+		s.qqFlushTail = map[string]chan struct{}{}
+	}
+	if tail, ok := s.qqFlushTail[key]; ok {
+		prev = tail
+	}
+	done = make(chan struct{})
+	s.qqFlushTail[key] = done
+	s.qqFlushWG.Add(1)
+	return prev, done
+}
+
+func (s *Server) finishQQInboundFlush(key string, done chan struct{}) {
+	s.qqDebounceMu.Lock()
+	if s.qqFlushTail[key] == done {
+		delete(s.qqFlushTail, key)
+	}
+	s.qqDebounceMu.Unlock()
+	close(done)
+	s.qqFlushWG.Done()
+}
+
+// closeQQInboundDebounce stops the debounce timers, runs the batches they
+// were holding and waits for every queued flush, so shutdown drops no
+// buffered message. Later events skip debouncing.
+func (s *Server) closeQQInboundDebounce() {
+	s.qqDebounceMu.Lock()
+	s.qqDebounceClosed = true
+	pending := s.qqDebounce
+	s.qqDebounce = nil
+	s.qqDebounceMu.Unlock()
+	for key, batch := range pending {
+		// A timer that already fired finds its batch gone and returns.
+		batch.timer.Stop()
+		s.qqDebounceMu.Lock()
+		prev, done := s.queueQQInboundFlushLocked(key)
+		s.qqDebounceMu.Unlock()
+		if prev != nil {
+			<-prev
+		}
+		s.runQQInboundBatch(batch.events)
+		s.finishQQInboundFlush(key, done)
+	}
+	s.qqFlushWG.Wait()
+}
+
+// runQQInboundBatch runs one agent turn for the buffered events; the reply is
+// dispatched to QQ by the agent pipeline, so the recorded response is dropped.
+func (s *Server) runQQInboundBatch(events []qqInboundEvent) {
+	if len(events) == 0 {
+		return
+	}
+	agentBody, err := buildQQAgentRequestBody(events)
+	if err != nil {
+		log.Printf("qq inbound batch marshal failed: %v", err)
+		return
+	}
+	req := httptest.NewRequest(http.MethodPost, qqInboundPath, bytes.NewReader(agentBody)).WithContext(context.Background())
+	rec := httptest.NewRecorder()
+	s.processAgentWithBody(rec, req, agentBody)
+	if rec.Code < http.StatusOK || rec.Code >= http.StatusMultipleChoices {
+		log.Printf("qq inbound batch failed: status=%d body=%s", rec.Code, strings.TrimSpace(rec.Body.String()))
+	}
+}
+
+// buildQQAgentRequestBody joins the event texts into one user message and
+// replies to the target of the latest event.
+func buildQQAgentRequestBody(events []qqInboundEvent) ([]byte, error) {
+	texts := make([]string, 0, len(events))
+	for _, event := range events {
+		texts = append(texts, event.Text)
+	}
+	last := events[len(events)-1]
+	request := domain.AgentProcessRequest{
+		Input: []domain.AgentInputMessage{
+			{
+				Role: "user",
+				Type: "message",
+				Content: []domain.RuntimeContent{
+					{Type: "text", Text: strings.Join(texts, "\n")},
+				},
+			},
+		},
+		SessionID: last.SessionID,
+		UserID:    last.UserID,
+		Channel:   "qq",
+		Stream:    false,
+		BizParams: map[string]interface{}{
+			"channel": map[string]interface{}{
+				"target_type": last.TargetType,
+				"target_id":   last.TargetID,
+				"msg_id":      last.MessageID,
+			},
+		},
+	}
+	return json.Marshal(request)
+}
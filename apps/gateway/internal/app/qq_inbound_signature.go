@@ -0,0 +1,149 @@
+package app
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"nextai/apps/gateway/internal/repo"
+)
+
+const (
+	qqWebhookValidationOp      = 13
+	qqSignatureHeader          = "X-Signature-Ed25519"
+	qqSignatureTimestampHeader = "X-Signature-Timestamp"
+	// qqSignatureMaxSkew bounds how far a signed timestamp may be from now, so
+	// a captured callback cannot be replayed later.
+	qqSignatureMaxSkew = 5 * time.Minute
+	// qqInboundMaxBodySize caps what an unauthenticated webhook caller can
+	// make the gateway buffer before the signature is checked.
+	qqInboundMaxBodySize = int64(1 << 20)
+)
+
+// withQQInboundSignature verifies QQ webhook callbacks before next parses them.
+// Verification is on whenever the qq channel has a client_secret and can be
+// turned off with inbound_verify_signature=false for local testing. Bodies
+// over qqInboundMaxBodySize are refused with 413 before anything else.
+func (s *Server) withQQInboundSignature(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body []byte
+		if r.Body != nil {
+			var err error
+			body, err = io.ReadAll(http.MaxBytesReader(w, r.Body, qqInboundMaxBodySize))
+			if err != nil {
+				var maxErr *http.MaxBytesError
+				if errors.As(err, &maxErr) {
+					writeErr(
+						w,
+						http.StatusRequestEntityTooLarge,
+						"payload_too_large",
+						"qq inbound request body exceeds size limit",
+						map[string]int64{"max_bytes": qqInboundMaxBodySize},
+					)
+					return
+				}
+				writeErr(w, http.StatusBadRequest, "invalid_json", "invalid request body", nil)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		secret, enabled := s.qqInboundSignatureSecret()
+		if !enabled {
+			next(w, r)
+			return
+		}
+		signature := strings.TrimSpace(r.Header.Get(qqSignatureHeader))
+		timestamp := strings.TrimSpace(r.Header.Get(qqSignatureTimestampHeader))
+		if !verifyQQSignature(secret, timestamp, signature, body, time.Now()) {
+			writeErr(w, http.StatusUnauthorized, "signature_invalid", "invalid qq webhook signature", nil)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// qqInboundSignatureSecret returns the qq client_secret and whether inbound
+// webhook signatures must be verified with it.
+func (s *Server) qqInboundSignatureSecret() (string, bool) {
+	secret := ""
+	enabled := false
+	s.store.Read(func(st *repo.State) {
+		if st == nil {
+			return
+		}
+		raw := st.Channels["qq"]
+		secret = strings.TrimSpace(qqString(raw["client_secret"]))
+		enabled = secret != ""
+		if flag, exists := raw["inbound_verify_signature"]; exists && !parseBool(flag) {
+			enabled = false
+		}
+	})
+	return secret, enabled
+}
+
+// verifyQQSignature checks a hex Ed25519 signature over timestamp+body and
+// that the unix timestamp is within qqSignatureMaxSkew of now. QQ derives the
+// key seed by repeating the bot secret up to ed25519.SeedSize bytes.
+func verifyQQSignature(secret, timestamp, signature string, body []byte, now time.Time) bool {
+	if secret == "" || timestamp == "" || signature == "" {
+		return false
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	if skew := now.Sub(time.Unix(seconds, 0)); skew > qqSignatureMaxSkew || skew < -qqSignatureMaxSkew {
+		return false
+	}
+	sig, err := hex.DecodeString(signature)
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return false
+	}
+	privateKey := qqSignatureKey(secret)
+	publicKey := privateKey.Public().(ed25519.PublicKey)
+	message := append([]byte(timestamp), body...)
+	return ed25519.Verify(publicKey, message, sig)
+}
+
+func qqSignatureKey(secret string) ed25519.PrivateKey {
+	seed := secret
+	for len(seed) < ed25519.SeedSize {
+		seed += seed
+	}
+	return ed25519.NewKeyFromSeed([]byte(seed[:ed25519.SeedSize]))
+}
+
+type qqWebhookValidation struct {
+	PlainToken string `json:"plain_token"`
+	EventTS    string `json:"event_ts"`
+}
+
+// parseQQWebhookValidation detects the op 13 challenge QQ sends when a webhook
+// URL is registered.
+func parseQQWebhookValidation(body []byte) (qqWebhookValidation, bool) {
+	var payload struct {
+		Op *int                `json:"op"`
+		D  qqWebhookValidation `json:"d"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return qqWebhookValidation{}, false
+	}
+	if payload.Op == nil || *payload.Op != qqWebhookValidationOp {
+		return qqWebhookValidation{}, false
+	}
+	return payload.D, true
+}
+
+// signQQWebhookValidation answers the challenge with a hex Ed25519 signature
+// over event_ts+plain_token.
+func signQQWebhookValidation(secret string, challenge qqWebhookValidation) string {
+	message := []byte(challenge.EventTS + challenge.PlainToken)
+	return hex.EncodeToString(ed25519.Sign(qqSignatureKey(secret), message))
+}
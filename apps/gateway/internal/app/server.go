@@ -15,6 +15,7 @@ import (
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/go-chi/chi/v5"
 
@@ -22,7 +23,9 @@ import (
 	"nextai/apps/gateway/internal/channel"
 	"nextai/apps/gateway/internal/config"
 	"nextai/apps/gateway/internal/domain"
+	"nextai/apps/gateway/internal/observability"
 	"nextai/apps/gateway/internal/plugin"
+	"nextai/apps/gateway/internal/provider"
 	"nextai/apps/gateway/internal/repo"
 	"nextai/apps/gateway/internal/runner"
 	"nextai/apps/gateway/internal/service/adapters"
@@ -43,6 +46,11 @@ const version = "0.1.0"
 const (
 	cronTickInterval = time.Second
 
+	deletedChatSweepInterval = time.Hour
+
+	defaultAgentProcessTimeout = 120 * time.Second
+	defaultToolApprovalTimeout = 10 * time.Minute
+
 	cronStatusPaused    = "paused"
 	cronStatusResumed   = "resumed"
 	cronStatusRunning   = "running"
@@ -103,6 +111,8 @@ const (
 	collaborationModeExecuteName         = "Execute"
 	collaborationModePairProgrammingName = "PairProgramming"
 	chatMetaPromptModeKey                = "prompt_mode"
+	chatMetaSystemPromptKey              = "system_prompt"
+	chatMetaSkillsKey                    = "skills"
 	aiToolsGuidePathEnv                  = "NEXTAI_AI_TOOLS_GUIDE_PATH"
 	disabledToolsEnv                     = "NEXTAI_DISABLED_TOOLS"
 	enableBrowserToolEnv                 = "NEXTAI_ENABLE_BROWSER_TOOL"
@@ -127,6 +137,7 @@ const (
 
 var errCronJobNotFound = cronservice.ErrJobNotFound
 var errCronMaxConcurrencyReached = cronservice.ErrMaxConcurrencyReached
+var errCronGlobalConcurrencyReached = cronservice.ErrGlobalConcurrencyReached
 var errCronDefaultProtected = cronservice.ErrDefaultProtected
 
 var cronWorkflowIfConditionPattern = regexp.MustCompile(`^\s*([A-Za-z_][A-Za-z0-9_]*)\s*(==|!=)\s*(?:"([^"]*)"|'([^']*)'|(\S+))\s*$`)
@@ -170,13 +181,35 @@ type Server struct {
 	memoryMu         sync.Mutex
 	userInputMu      sync.Mutex
 	subAgentMu       sync.Mutex
+	agentRunMu       sync.Mutex
 	qqInbound        qqInboundRuntimeState
 	pendingUserInput map[string]*pendingUserInputRequest
 	subAgents        map[string]*managedSubAgent
+	agentRuns        map[string]*agentRunRecord
+	rateLimiter      *observability.RateLimiter
+	providerAPIKeys  *providerAPIKeyPool
+
+	// qqDebounce buffers bursts of QQ inbound messages per user and session.
+	// qqFlushTail holds, per key, the channel closed when the latest queued
+	// flush finishes, so turns of one session run in order.
+	qqDebounceMu     sync.Mutex
+	qqDebounce       map[string]*qqInboundBatch
+	qqFlushTail      map[string]chan struct{}
+	qqFlushWG        sync.WaitGroup
+	qqDebounceClosed bool
+
+	// remoteModels caches live provider model lists briefly, keyed by provider
+	// and base URL.
+	remoteModelsMu sync.Mutex
+	remoteModels   map[string]remoteModelsCacheEntry
 
 	cronStop chan struct{}
 	cronDone chan struct{}
 	cronWG   sync.WaitGroup
+	// cronSlots bounds cron executions across all jobs; nil means unlimited.
+	cronSlots      chan struct{}
+	cronDeferredMu sync.Mutex
+	cronDeferred   []deferredCronJob
 
 	cronTaskExecutor func(context.Context, domain.CronJobSpec) error
 	closeOnce        sync.Once
@@ -204,9 +237,20 @@ func NewServer(cfg config.Config) (*Server, error) {
 		),
 		pendingUserInput: map[string]*pendingUserInputRequest{},
 		subAgents:        map[string]*managedSubAgent{},
+		agentRuns:        map[string]*agentRunRecord{},
+		providerAPIKeys:  newProviderAPIKeyPool(),
 		cronStop:         make(chan struct{}),
 		cronDone:         make(chan struct{}),
 	}
+	if cfg.CronGlobalConcurrency > 0 {
+		srv.cronSlots = make(chan struct{}, cfg.CronGlobalConcurrency)
+	}
+	if cfg.RateLimitRPM > 0 {
+		srv.rateLimiter = observability.NewRateLimiter(cfg.RateLimitRPM)
+	}
+	// Zero disables the provider health cache; Load falls back to the default
+	// for unset or invalid values.
+	srv.runner.SetProviderFailureCooldown(time.Duration(cfg.ProviderFailureCooldownMS) * time.Millisecond)
 	srv.cfg.CodexPromptSource = normalizeCodexPromptSource(srv.cfg.CodexPromptSource)
 	if codexPromptModeEnabled() && (srv.cfg.CodexPromptSource == codexPromptSourceCatalog || srv.cfg.EnableCodexPromptShadowCompare) {
 		resolver, resolverErr := codexpromptservice.NewResolver(codexRuntimeCatalogRelativePath)
@@ -223,6 +267,7 @@ func NewServer(cfg config.Config) (*Server, error) {
 	srv.registerChannelPlugin(channel.NewConsoleChannel())
 	srv.registerChannelPlugin(channel.NewWebhookChannel())
 	srv.registerChannelPlugin(channel.NewQQChannel())
+	srv.registerChannelPlugin(channel.NewSlackChannel())
 	srv.registerToolPlugin(plugin.NewShellTool(), agentprotocolservice.ToolCapabilityExecute)
 	srv.registerToolPlugin(
 		plugin.NewViewFileLinesTool(""),
@@ -230,11 +275,13 @@ func NewServer(cfg config.Config) (*Server, error) {
 		agentprotocolservice.ToolCapabilityOpenLocal,
 	)
 	srv.registerToolPlugin(plugin.NewEditFileLinesTool(""), agentprotocolservice.ToolCapabilityWrite)
+	srv.registerToolPlugin(plugin.NewWriteFileTool(), agentprotocolservice.ToolCapabilityWrite)
 	srv.registerToolPlugin(
 		plugin.NewFindTool(),
 		agentprotocolservice.ToolCapabilityRead,
 		agentprotocolservice.ToolCapabilityFileSearch,
 	)
+	srv.registerToolPlugin(plugin.NewListDirTool(), agentprotocolservice.ToolCapabilityRead)
 	if parseBool(os.Getenv(enableBrowserToolEnv)) {
 		browserTool, toolErr := plugin.NewBrowserTool(strings.TrimSpace(os.Getenv(browserToolAgentDirEnv)))
 		if toolErr != nil {
@@ -268,6 +315,7 @@ func NewServer(cfg config.Config) (*Server, error) {
 	srv.systemPromptService = srv.newSystemPromptService()
 	srv.workspaceService = srv.newWorkspaceService()
 	srv.startCronScheduler()
+	srv.startDeletedChatSweeper()
 	if !parseBool(os.Getenv(disableQQInboundSupervisorEnv)) {
 		srv.startQQInboundSupervisor()
 	}
@@ -279,6 +327,8 @@ func (s *Server) Close() {
 		close(s.cronStop)
 		<-s.cronDone
 		s.cronWG.Wait()
+		s.closeQQInboundDebounce()
+		s.rateLimiter.Close()
 	})
 }
 
@@ -317,69 +367,111 @@ func parseDisabledTools(raw string) map[string]struct{} {
 	return out
 }
 
+// toolDisabled reports whether name is in the env disabled set or the set
+// persisted through /config/tools/disabled.
 func (s *Server) toolDisabled(name string) bool {
 	if s == nil {
 		return false
 	}
-	if len(s.disabledTools) == 0 {
+	normalized := strings.ToLower(strings.TrimSpace(name))
+	if _, ok := s.disabledTools[normalized]; ok {
+		return true
+	}
+	if s.store == nil {
 		return false
 	}
-	_, ok := s.disabledTools[strings.ToLower(strings.TrimSpace(name))]
-	return ok
+	disabled := false
+	s.store.Read(func(st *repo.State) {
+		for _, item := range st.DisabledTools {
+			if item == normalized {
+				disabled = true
+				return
+			}
+		}
+	})
+	return disabled
 }
 
 func (s *Server) Handler() http.Handler {
 	return apphttp.NewRouter(
 		s.cfg.APIKey,
+		s.cfg.APIKeys,
 		apphttp.Handlers{
 			Public: apphttp.PublicHandlers{
 				Version:       s.handleVersion,
 				Healthz:       s.handleHealthz,
 				RuntimeConfig: s.handleRuntimeConfig,
+				Metrics:       observability.MetricsHandler(),
 			},
 			Agent: apphttp.AgentHandlers{
 				ListChats:             s.listChats,
 				CreateChat:            s.createChat,
 				BatchDeleteChats:      s.batchDeleteChats,
 				GetChat:               s.getChat,
+				GetChatMeta:           s.getChatMeta,
 				UpdateChat:            s.updateChat,
+				RenameChat:            s.renameChat,
 				DeleteChat:            s.deleteChat,
-				ProcessAgent:          s.processAgent,
+				ArchiveChat:           s.archiveChat,
+				UnarchiveChat:         s.unarchiveChat,
+				RestoreChat:           s.restoreChat,
+				SummarizeChat:         s.summarizeChat,
+				ProcessAgent:          s.withUserRateLimit(s.processAgent, agentProcessRateLimitKey),
 				GetAgentSystemLayers:  s.getAgentSystemLayers,
+				ListToolSchemas:       s.listToolSchemas,
+				CancelAgentRun:        s.cancelAgentRun,
+				ApproveAgentRun:       s.approveAgentRun,
+				RejectAgentRun:        s.rejectAgentRun,
+				GetAgentRunEvents:     s.getAgentRunEvents,
 				BootstrapSession:      s.bootstrapSession,
 				SetSessionModel:       s.setSessionModel,
 				PreviewMutation:       s.previewMutation,
 				ApplyMutation:         s.applyMutation,
 				SubmitToolInputAnswer: s.submitToolInputAnswer,
-				ProcessQQInbound:      s.processQQInbound,
+				ProcessQQInbound:      s.withQQInboundSignature(s.withUserRateLimit(s.processQQInbound, qqInboundRateLimitKey)),
 				GetQQInboundState:     s.getQQInboundState,
 			},
 			Cron: apphttp.CronHandlers{
-				ListCronJobs:  s.listCronJobs,
-				CreateCronJob: s.createCronJob,
-				GetCronJob:    s.getCronJob,
-				UpdateCronJob: s.updateCronJob,
-				DeleteCronJob: s.deleteCronJob,
-				PauseCronJob:  s.pauseCronJob,
-				ResumeCronJob: s.resumeCronJob,
-				RunCronJob:    s.runCronJob,
-				GetCronState:  s.getCronJobState,
+				ListCronJobs:   s.listCronJobs,
+				CreateCronJob:  s.createCronJob,
+				BatchCreate:    s.batchCreateCronJobs,
+				ValidateJob:    s.validateCronJob,
+				PreviewCron:    s.previewCronSchedule,
+				GetCronJob:     s.getCronJob,
+				UpdateCronJob:  s.updateCronJob,
+				DeleteCronJob:  s.deleteCronJob,
+				PauseCronJob:   s.pauseCronJob,
+				ResumeCronJob:  s.resumeCronJob,
+				EnableCronJob:  s.enableCronJob,
+				DisableCronJob: s.disableCronJob,
+				RunCronJob:     s.runCronJob,
+				RunCronSync:    s.runCronJobSync,
+				GetCronState:   s.getCronJobState,
+				GetHistory:     s.getCronJobHistory,
+				GetOverview:    s.getCronOverview,
+				ReapLeases:     s.reapCronLeases,
 			},
 			Admin: apphttp.AdminHandlers{
 				ListProviders:      s.listProviders,
 				GetModelCatalog:    s.getModelCatalog,
 				ConfigureProvider:  s.configureProvider,
 				DeleteProvider:     s.deleteProvider,
+				TestProvider:       s.testProvider,
+				GetRemoteModels:    s.getRemoteModels,
 				GetActiveModels:    s.getActiveModels,
 				SetActiveModels:    s.setActiveModels,
 				ListEnvs:           s.listEnvs,
 				PutEnvs:            s.putEnvs,
+				PatchEnvs:          s.patchEnvs,
+				ExportEnvs:         s.exportEnvs,
 				DeleteEnv:          s.deleteEnv,
 				ListSkills:         s.listSkills,
 				ListAvailableSkill: s.listAvailableSkills,
 				BatchDisableSkills: s.batchDisableSkills,
 				BatchEnableSkills:  s.batchEnableSkills,
 				CreateSkill:        s.createSkill,
+				ImportSkill:        s.importSkill,
+				ExportSkill:        s.exportSkill,
 				DisableSkill:       s.disableSkill,
 				EnableSkill:        s.enableSkill,
 				DeleteSkill:        s.deleteSkill,
@@ -389,13 +481,20 @@ func (s *Server) Handler() http.Handler {
 				PutWorkspaceFile:   s.putWorkspaceFile,
 				UploadWorkspace:    s.uploadWorkspaceFile,
 				DeleteWorkspace:    s.deleteWorkspaceFile,
+				DiffWorkspaceFile:  s.diffWorkspaceFile,
 				ExportWorkspace:    s.exportWorkspace,
 				ImportWorkspace:    s.importWorkspace,
 				ListChannels:       s.listChannels,
 				ListChannelTypes:   s.listChannelTypes,
 				PutChannels:        s.putChannels,
 				GetChannel:         s.getChannel,
+				GetChannelCaps:     s.getChannelCapabilities,
 				PutChannel:         s.putChannel,
+				GetDisabledTools:   s.getDisabledTools,
+				PutDisabledTools:   s.putDisabledTools,
+				GetStats:           s.getAdminStats,
+				ListUserRuns:       s.listUserAgentRuns,
+				CancelUserRuns:     s.cancelUserAgentRuns,
 			},
 		},
 		webStaticHandler(s.cfg.WebDir),
@@ -421,6 +520,32 @@ func (s *Server) startCronScheduler() {
 	}()
 }
 
+func (s *Server) startDeletedChatSweeper() {
+	retentionDays := s.cfg.DeletedChatRetentionDays
+	sweep := func() {
+		if _, err := s.purgeExpiredDeletedChats(time.Now().UTC(), retentionDays); err != nil {
+			log.Printf("deleted chat sweep failed: %v", err)
+		}
+	}
+	sweep()
+
+	s.cronWG.Add(1)
+	go func() {
+		defer s.cronWG.Done()
+		ticker := time.NewTicker(deletedChatSweepInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				sweep()
+			case <-s.cronStop:
+				return
+			}
+		}
+	}()
+}
+
 func (s *Server) cronSchedulerTick() {
 	dueJobs, err := s.getCronService().SchedulerTick(time.Now().UTC())
 	if err != nil {
@@ -428,10 +553,16 @@ func (s *Server) cronSchedulerTick() {
 		return
 	}
 
-	for _, jobID := range dueJobs {
+	queue := s.takeDeferredCronJobs(dueJobs)
+	for idx, jobID := range queue {
+		if !s.tryAcquireGlobalCronSlot() {
+			s.deferCronJobs(queue[idx:])
+			return
+		}
 		s.cronWG.Add(1)
 		go func(targetJobID string) {
 			defer s.cronWG.Done()
+			defer s.releaseGlobalCronSlot()
 			if err := s.executeCronJob(targetJobID); err != nil &&
 				!errors.Is(err, errCronJobNotFound) &&
 				!errors.Is(err, errCronMaxConcurrencyReached) {
@@ -441,6 +572,86 @@ func (s *Server) cronSchedulerTick() {
 	}
 }
 
+// deferredCronJob is a due run held back by the global cron cap, with the
+// schedule it was due under.
+type deferredCronJob struct {
+	JobID    string
+	Schedule domain.CronScheduleSpec
+}
+
+// takeDeferredCronJobs returns jobs deferred by earlier ticks followed by the
+// newly due ones, without duplicates, and clears the deferred queue. Deferred
+// jobs that were deleted, disabled or paused, or whose schedule changed while
+// they waited, are dropped.
+func (s *Server) takeDeferredCronJobs(dueJobs []string) []string {
+	s.cronDeferredMu.Lock()
+	deferred := s.cronDeferred
+	s.cronDeferred = nil
+	s.cronDeferredMu.Unlock()
+
+	queue := make([]string, 0, len(deferred)+len(dueJobs))
+	seen := map[string]struct{}{}
+	for _, entry := range deferred {
+		if _, ok := seen[entry.JobID]; ok {
+			continue
+		}
+		schedule, schedulable := s.getCronService().SchedulableJob(entry.JobID)
+		if !schedulable || schedule != entry.Schedule {
+			continue
+		}
+		seen[entry.JobID] = struct{}{}
+		queue = append(queue, entry.JobID)
+	}
+	for _, jobID := range dueJobs {
+		if _, ok := seen[jobID]; ok {
+			continue
+		}
+		seen[jobID] = struct{}{}
+		queue = append(queue, jobID)
+	}
+	return queue
+}
+
+func (s *Server) deferCronJobs(jobIDs []string) {
+	entries := make([]deferredCronJob, 0, len(jobIDs))
+	for _, jobID := range jobIDs {
+		schedule, _ := s.getCronService().SchedulableJob(jobID)
+		entries = append(entries, deferredCronJob{JobID: jobID, Schedule: schedule})
+	}
+	s.cronDeferredMu.Lock()
+	defer s.cronDeferredMu.Unlock()
+	s.cronDeferred = append(s.cronDeferred, entries...)
+}
+
+func (s *Server) tryAcquireGlobalCronSlot() bool {
+	if s.cronSlots == nil {
+		return true
+	}
+	select {
+	case s.cronSlots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// acquireManualCronSlot takes a global slot for a manually triggered run. The
+// scheduler defers due jobs when the cap is hit, but a manual run has no later
+// tick to wait for, so it is recorded as skipped instead.
+func (s *Server) acquireManualCronSlot(jobID string) error {
+	if s.tryAcquireGlobalCronSlot() {
+		return nil
+	}
+	return s.getCronService().MarkGlobalConcurrencySkipped(jobID, cap(s.cronSlots))
+}
+
+func (s *Server) releaseGlobalCronSlot() {
+	if s.cronSlots == nil {
+		return
+	}
+	<-s.cronSlots
+}
+
 func (s *Server) handleVersion(w http.ResponseWriter, _ *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]string{"version": version})
 }
@@ -525,15 +736,25 @@ func resolveWebDir(configuredWebDir string) (string, bool) {
 func (s *Server) listChats(w http.ResponseWriter, r *http.Request) {
 	userID := r.URL.Query().Get("user_id")
 	channel := r.URL.Query().Get("channel")
+	includeSize := parseBool(r.URL.Query().Get("include_size"))
+	includeArchived := parseBool(r.URL.Query().Get("include_archived"))
 	out := make([]domain.ChatSpec, 0)
 	s.store.Read(func(state *repo.State) {
 		for _, v := range state.Chats {
+			if v.Archived && !includeArchived {
+				continue
+			}
 			if userID != "" && v.UserID != userID {
 				continue
 			}
 			if channel != "" && v.Channel != channel {
 				continue
 			}
+			v.ApproxChars = nil
+			if includeSize {
+				size := historyApproxChars(state.Histories[v.ID])
+				v.ApproxChars = &size
+			}
 			out = append(out, v)
 		}
 	})
@@ -541,6 +762,16 @@ func (s *Server) listChats(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, out)
 }
 
+func historyApproxChars(history []domain.RuntimeMessage) int {
+	total := 0
+	for _, msg := range history {
+		for _, part := range msg.Content {
+			total += utf8.RuneCountInString(part.Text)
+		}
+	}
+	return total
+}
+
 func (s *Server) createChat(w http.ResponseWriter, r *http.Request) {
 	var req domain.ChatSpec
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -560,6 +791,19 @@ func (s *Server) createChat(w http.ResponseWriter, r *http.Request) {
 	if req.Meta == nil {
 		req.Meta = map[string]interface{}{}
 	}
+	if err := validateChatSystemPromptMeta(req.Meta); err != nil {
+		writeErr(w, http.StatusBadRequest, "invalid_chat", err.Error(), nil)
+		return
+	}
+	if err := validateChatSkillsMeta(req.Meta); err != nil {
+		writeErr(w, http.StatusBadRequest, "invalid_chat", err.Error(), nil)
+		return
+	}
+	if err := s.normalizeChatActiveLLMMeta(req.Meta); err != nil {
+		writeErr(w, http.StatusBadRequest, "invalid_chat", err.Error(), nil)
+		return
+	}
+	req.ApproxChars = nil
 	now := nowISO()
 	req.CreatedAt = now
 	req.UpdatedAt = now
@@ -618,6 +862,22 @@ func (s *Server) getChat(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, domain.ChatHistory{Messages: history})
 }
 
+// getChatMeta returns the chat spec alone, leaving the history unread.
+func (s *Server) getChatMeta(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "chat_id")
+	var chat domain.ChatSpec
+	found := false
+	s.store.Read(func(state *repo.State) {
+		chat, found = state.Chats[id]
+	})
+	if !found {
+		writeErr(w, http.StatusNotFound, "not_found", "chat not found", map[string]string{"chat_id": id})
+		return
+	}
+	chat.ApproxChars = nil
+	writeJSON(w, http.StatusOK, chat)
+}
+
 func (s *Server) updateChat(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "chat_id")
 	var req domain.ChatSpec
@@ -629,6 +889,19 @@ func (s *Server) updateChat(w http.ResponseWriter, r *http.Request) {
 		writeErr(w, http.StatusBadRequest, "chat_id_mismatch", "chat_id mismatch", nil)
 		return
 	}
+	if err := validateChatSystemPromptMeta(req.Meta); err != nil {
+		writeErr(w, http.StatusBadRequest, "invalid_chat", err.Error(), nil)
+		return
+	}
+	if err := validateChatSkillsMeta(req.Meta); err != nil {
+		writeErr(w, http.StatusBadRequest, "invalid_chat", err.Error(), nil)
+		return
+	}
+	if err := s.normalizeChatActiveLLMMeta(req.Meta); err != nil {
+		writeErr(w, http.StatusBadRequest, "invalid_chat", err.Error(), nil)
+		return
+	}
+	req.ApproxChars = nil
 	if err := s.store.Write(func(state *repo.State) error {
 		old, ok := state.Chats[id]
 		if !ok {
@@ -649,16 +922,150 @@ func (s *Server) updateChat(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, req)
 }
 
+// normalizeChatActiveLLMMeta checks meta.active_llm_override, the model a
+// chat is pinned to, with the rules of PUT /agent/self/sessions/{id}/model:
+// the provider must exist and be enabled and the model or alias must resolve.
+// The alias is stored resolved; null or an empty object clears the pin.
+func (s *Server) normalizeChatActiveLLMMeta(meta map[string]interface{}) error {
+	raw, ok := meta[domain.ChatMetaActiveLLM]
+	if !ok {
+		return nil
+	}
+	if raw == nil {
+		delete(meta, domain.ChatMetaActiveLLM)
+		return nil
+	}
+	value, ok := raw.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("meta.%s must be an object with provider_id and model", domain.ChatMetaActiveLLM)
+	}
+	providerID := normalizeProviderID(stringValue(value["provider_id"]))
+	modelID := strings.TrimSpace(stringValue(value["model"]))
+	if providerID == "" && modelID == "" {
+		delete(meta, domain.ChatMetaActiveLLM)
+		return nil
+	}
+	if providerID == "" || modelID == "" {
+		return fmt.Errorf("meta.%s.provider_id and model must be set together", domain.ChatMetaActiveLLM)
+	}
+	var err error
+	s.store.Read(func(state *repo.State) {
+		setting, ok := findProviderSettingByID(state, providerID)
+		if !ok {
+			err = fmt.Errorf("meta.%s provider %q not found", domain.ChatMetaActiveLLM, providerID)
+			return
+		}
+		normalizeProviderSetting(&setting)
+		if !providerEnabled(setting) {
+			err = fmt.Errorf("meta.%s provider %q is disabled", domain.ChatMetaActiveLLM, providerID)
+			return
+		}
+		resolved, found := provider.ResolveModelID(providerID, modelID, setting.ModelAliases)
+		if !found {
+			err = fmt.Errorf("meta.%s model %q not found for provider %q", domain.ChatMetaActiveLLM, modelID, providerID)
+			return
+		}
+		modelID = resolved
+	})
+	if err != nil {
+		return err
+	}
+	updatedAt := strings.TrimSpace(stringValue(value["updated_at"]))
+	if updatedAt == "" {
+		updatedAt = nowISO()
+	}
+	meta[domain.ChatMetaActiveLLM] = map[string]interface{}{
+		"provider_id": providerID,
+		"model":       modelID,
+		"updated_at":  updatedAt,
+	}
+	return nil
+}
+
+func (s *Server) renameChat(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "chat_id")
+	var req struct {
+		Name         *string `json:"name"`
+		SystemPrompt *string `json:"system_prompt"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErr(w, http.StatusBadRequest, "invalid_json", "invalid request body", nil)
+		return
+	}
+	if req.Name == nil && req.SystemPrompt == nil {
+		writeErr(w, http.StatusBadRequest, "invalid_chat", "name or system_prompt is required", nil)
+		return
+	}
+	name := ""
+	if req.Name != nil {
+		name = strings.TrimSpace(*req.Name)
+		if name == "" {
+			writeErr(w, http.StatusBadRequest, "invalid_chat", "name is required", nil)
+			return
+		}
+	}
+	systemPrompt := ""
+	if req.SystemPrompt != nil {
+		systemPrompt = strings.TrimSpace(*req.SystemPrompt)
+		if err := validateChatSystemPrompt(systemPrompt); err != nil {
+			writeErr(w, http.StatusBadRequest, "invalid_chat", err.Error(), nil)
+			return
+		}
+	}
+	var out domain.ChatSpec
+	found := false
+	if err := s.store.Write(func(state *repo.State) error {
+		chat, ok := state.Chats[id]
+		if !ok {
+			return nil
+		}
+		found = true
+		if req.Name != nil {
+			chat.Name = name
+		}
+		if req.SystemPrompt != nil {
+			chat.Meta = withChatSystemPrompt(chat.Meta, systemPrompt)
+		}
+		chat.UpdatedAt = nowISO()
+		state.Chats[id] = chat
+		out = chat
+		return nil
+	}); err != nil {
+		writeErr(w, http.StatusInternalServerError, "store_error", err.Error(), nil)
+		return
+	}
+	if !found {
+		writeErr(w, http.StatusNotFound, "not_found", "chat not found", map[string]string{"chat_id": id})
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
 func (s *Server) deleteChat(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "chat_id")
 	if id == domain.DefaultChatID {
 		writeErr(w, http.StatusBadRequest, "default_chat_protected", "default chat cannot be deleted", map[string]string{"chat_id": domain.DefaultChatID})
 		return
 	}
+	soft := parseBool(r.URL.Query().Get("soft"))
 	deleted := false
+	binConflict := false
 	if err := s.store.Write(func(state *repo.State) error {
-		if _, ok := state.Chats[id]; ok {
+		if chat, ok := state.Chats[id]; ok {
 			deleted = true
+			if soft {
+				// The recycle bin holds one entry per id; replacing it would
+				// lose the earlier copy and its history.
+				if _, exists := state.DeletedChats[id]; exists {
+					binConflict = true
+					return nil
+				}
+				state.DeletedChats[id] = domain.DeletedChat{
+					Chat:      chat,
+					History:   state.Histories[id],
+					DeletedAt: nowISO(),
+				}
+			}
 			delete(state.Chats, id)
 			delete(state.Histories, id)
 		}
@@ -671,5 +1078,121 @@ func (s *Server) deleteChat(w http.ResponseWriter, r *http.Request) {
 		writeErr(w, http.StatusNotFound, "not_found", "chat not found", nil)
 		return
 	}
+	if binConflict {
+		writeErr(w, http.StatusConflict, "deleted_chat_exists", "the recycle bin already holds a chat with this id", map[string]string{"chat_id": id})
+		return
+	}
 	writeJSON(w, http.StatusOK, map[string]bool{"deleted": true})
 }
+
+func (s *Server) restoreChat(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "chat_id")
+	var out domain.ChatSpec
+	found := false
+	idConflict := false
+	conflict := false
+	if err := s.store.Write(func(state *repo.State) error {
+		entry, ok := state.DeletedChats[id]
+		if !ok {
+			return nil
+		}
+		found = true
+		if _, exists := state.Chats[id]; exists {
+			idConflict = true
+			return nil
+		}
+		for _, c := range state.Chats {
+			if c.SessionID == entry.Chat.SessionID && c.UserID == entry.Chat.UserID && c.Channel == entry.Chat.Channel {
+				conflict = true
+				return nil
+			}
+		}
+		out = entry.Chat
+		out.UpdatedAt = nowISO()
+		state.Chats[id] = out
+		history := entry.History
+		if history == nil {
+			history = []domain.RuntimeMessage{}
+		}
+		state.Histories[id] = history
+		delete(state.DeletedChats, id)
+		return nil
+	}); err != nil {
+		writeErr(w, http.StatusInternalServerError, "store_error", err.Error(), nil)
+		return
+	}
+	if !found {
+		writeErr(w, http.StatusNotFound, "not_found", "deleted chat not found", nil)
+		return
+	}
+	if idConflict {
+		writeErr(w, http.StatusConflict, "chat_id_conflict", "an active chat already uses this id", map[string]string{"chat_id": id})
+		return
+	}
+	if conflict {
+		writeErr(w, http.StatusConflict, "chat_session_conflict", "an active chat already uses this session", nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// purgeExpiredDeletedChats permanently removes soft-deleted chats deleted
+// more than retentionDays ago. A retention of 0 days keeps them until they
+// are restored.
+func (s *Server) purgeExpiredDeletedChats(now time.Time, retentionDays int) (int, error) {
+	retention := time.Duration(retentionDays) * 24 * time.Hour
+	if retention <= 0 {
+		return 0, nil
+	}
+	purged := 0
+	err := s.store.Write(func(state *repo.State) error {
+		for id, entry := range state.DeletedChats {
+			deletedAt, err := time.Parse(time.RFC3339, entry.DeletedAt)
+			if err != nil || now.Sub(deletedAt) >= retention {
+				delete(state.DeletedChats, id)
+				purged++
+			}
+		}
+		return nil
+	})
+	return purged, err
+}
+
+func (s *Server) archiveChat(w http.ResponseWriter, r *http.Request) {
+	s.setChatArchived(w, chi.URLParam(r, "chat_id"), true)
+}
+
+func (s *Server) unarchiveChat(w http.ResponseWriter, r *http.Request) {
+	s.setChatArchived(w, chi.URLParam(r, "chat_id"), false)
+}
+
+func (s *Server) setChatArchived(w http.ResponseWriter, id string, archived bool) {
+	if archived && id == domain.DefaultChatID {
+		writeErr(w, http.StatusBadRequest, "default_chat_protected", "default chat cannot be archived", map[string]string{"chat_id": domain.DefaultChatID})
+		return
+	}
+	var out domain.ChatSpec
+	found := false
+	if err := s.store.Write(func(state *repo.State) error {
+		chat, ok := state.Chats[id]
+		if !ok {
+			return nil
+		}
+		found = true
+		if chat.Archived != archived {
+			chat.Archived = archived
+			chat.UpdatedAt = nowISO()
+			state.Chats[id] = chat
+		}
+		out = chat
+		return nil
+	}); err != nil {
+		writeErr(w, http.StatusInternalServerError, "store_error", err.Error(), nil)
+		return
+	}
+	if !found {
+		writeErr(w, http.StatusNotFound, "not_found", "chat not found", map[string]string{"chat_id": id})
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
@@ -2,14 +2,17 @@ package app
 
 import (
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log"
+	"mime"
 	"net/http"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"sort"
@@ -19,6 +22,7 @@ import (
 	"github.com/go-chi/chi/v5"
 
 	"nextai/apps/gateway/internal/domain"
+	"nextai/apps/gateway/internal/observability"
 	"nextai/apps/gateway/internal/plugin"
 	"nextai/apps/gateway/internal/provider"
 	"nextai/apps/gateway/internal/repo"
@@ -50,31 +54,62 @@ func (s *Server) getModelCatalog(w http.ResponseWriter, _ *http.Request) {
 
 func (s *Server) configureProvider(w http.ResponseWriter, r *http.Request) {
 	var body struct {
-		APIKey          *string            `json:"api_key"`
-		BaseURL         *string            `json:"base_url"`
-		DisplayName     *string            `json:"display_name"`
-		ReasoningEffort *string            `json:"reasoning_effort"`
-		Enabled         *bool              `json:"enabled"`
-		Store           *bool              `json:"store"`
-		Headers         *map[string]string `json:"headers"`
-		TimeoutMS       *int               `json:"timeout_ms"`
-		ModelAliases    *map[string]string `json:"model_aliases"`
+		APIKey                   *string            `json:"api_key"`
+		APIKeys                  *[]string          `json:"api_keys"`
+		BaseURL                  *string            `json:"base_url"`
+		DisplayName              *string            `json:"display_name"`
+		ReasoningEffort          *string            `json:"reasoning_effort"`
+		Enabled                  *bool              `json:"enabled"`
+		Store                    *bool              `json:"store"`
+		ForwardUser              *string            `json:"forward_user"`
+		CompressRequests         *bool              `json:"compress_requests"`
+		StreamUsage              *bool              `json:"stream_usage"`
+		ParallelToolCalls        *bool              `json:"parallel_tool_calls"`
+		Temperature              json.RawMessage    `json:"temperature"`
+		MaxTokens                *int               `json:"max_tokens"`
+		Headers                  *map[string]string `json:"headers"`
+		TimeoutMS                *int               `json:"timeout_ms"`
+		ModelAliases             *map[string]string `json:"model_aliases"`
+		AllowUnknownAliasTargets bool               `json:"allow_unknown_alias_targets"`
+		ContextWindows           *map[string]int    `json:"model_context_windows"`
+	}
+	if !s.decodeRequestBody(w, r.Body, &body) {
+		return
 	}
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		writeErr(w, http.StatusBadRequest, "invalid_json", "invalid request body", nil)
+	// temperature: null clears the saved default, unlike an omitted field.
+	var temperature *float64
+	clearTemperature := string(body.Temperature) == "null"
+	if len(body.Temperature) > 0 && !clearTemperature {
+		if err := json.Unmarshal(body.Temperature, &temperature); err != nil {
+			writeErr(w, http.StatusBadRequest, "invalid_json", "invalid request body", nil)
+			return
+		}
+	}
+	if !observability.ProviderPermitted(r.Context(), normalizeProviderID(chi.URLParam(r, "provider_id"))) {
+		writeErr(w, http.StatusForbidden, "provider_not_permitted", "api key is not permitted to use this provider", nil)
 		return
 	}
 	out, err := s.getModelService().ConfigureProvider(modelservice.ConfigureProviderInput{
-		ProviderID:      chi.URLParam(r, "provider_id"),
-		APIKey:          body.APIKey,
-		BaseURL:         body.BaseURL,
-		DisplayName:     body.DisplayName,
-		ReasoningEffort: body.ReasoningEffort,
-		Enabled:         body.Enabled,
-		Store:           body.Store,
-		Headers:         body.Headers,
-		TimeoutMS:       body.TimeoutMS,
-		ModelAliases:    body.ModelAliases,
+		ProviderID:               chi.URLParam(r, "provider_id"),
+		APIKey:                   body.APIKey,
+		APIKeys:                  body.APIKeys,
+		BaseURL:                  body.BaseURL,
+		DisplayName:              body.DisplayName,
+		ReasoningEffort:          body.ReasoningEffort,
+		Enabled:                  body.Enabled,
+		Store:                    body.Store,
+		ForwardUser:              body.ForwardUser,
+		CompressRequests:         body.CompressRequests,
+		StreamUsage:              body.StreamUsage,
+		ParallelToolCalls:        body.ParallelToolCalls,
+		Temperature:              temperature,
+		ClearTemperature:         clearTemperature,
+		MaxTokens:                body.MaxTokens,
+		Headers:                  body.Headers,
+		TimeoutMS:                body.TimeoutMS,
+		ModelAliases:             body.ModelAliases,
+		AllowUnknownAliasTargets: body.AllowUnknownAliasTargets,
+		ContextWindows:           body.ContextWindows,
 	})
 	if err != nil {
 		if validation := (*modelservice.ValidationError)(nil); errors.As(err, &validation) {
@@ -88,6 +123,10 @@ func (s *Server) configureProvider(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) deleteProvider(w http.ResponseWriter, r *http.Request) {
+	if !observability.ProviderPermitted(r.Context(), normalizeProviderID(chi.URLParam(r, "provider_id"))) {
+		writeErr(w, http.StatusForbidden, "provider_not_permitted", "api key is not permitted to use this provider", nil)
+		return
+	}
 	deleted, err := s.getModelService().DeleteProvider(chi.URLParam(r, "provider_id"))
 	if err != nil {
 		if validation := (*modelservice.ValidationError)(nil); errors.As(err, &validation) {
@@ -111,8 +150,11 @@ func (s *Server) getActiveModels(w http.ResponseWriter, _ *http.Request) {
 
 func (s *Server) setActiveModels(w http.ResponseWriter, r *http.Request) {
 	var body domain.ModelSlotConfig
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		writeErr(w, http.StatusBadRequest, "invalid_json", "invalid request body", nil)
+	if !s.decodeRequestBody(w, r.Body, &body) {
+		return
+	}
+	if !modelSlotPermitted(r.Context(), domain.ModelSlotConfig{ProviderID: normalizeProviderID(body.ProviderID), Fallback: body.Fallback}) {
+		writeErr(w, http.StatusForbidden, "provider_not_permitted", "api key is not permitted to use this provider", nil)
 		return
 	}
 	out, err := s.getModelService().SetActiveModels(body)
@@ -138,22 +180,41 @@ func (s *Server) setActiveModels(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, out)
 }
 
-func (s *Server) listEnvs(w http.ResponseWriter, _ *http.Request) {
+func (s *Server) listEnvs(w http.ResponseWriter, r *http.Request) {
 	out, err := s.getAdminService().ListEnvs()
 	if err != nil {
 		writeErr(w, http.StatusInternalServerError, "store_error", err.Error(), nil)
 		return
 	}
-	writeJSON(w, http.StatusOK, out)
+	writeJSON(w, http.StatusOK, maskEnvVars(out, revealEnvValues(r) && !observability.ProviderScoped(r.Context())))
+}
+
+// rejectScopedKey refuses routes that read or replace secrets for every
+// provider, so a provider-scoped key cannot reach other providers' keys
+// through them.
+func rejectScopedKey(w http.ResponseWriter, r *http.Request) bool {
+	if !observability.ProviderScoped(r.Context()) {
+		return false
+	}
+	writeErr(w, http.StatusForbidden, "scoped_api_key_forbidden", "provider-scoped api keys cannot use this route", nil)
+	return true
 }
 
 func (s *Server) putEnvs(w http.ResponseWriter, r *http.Request) {
+	if rejectScopedKey(w, r) {
+		return
+	}
 	body := map[string]string{}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		writeErr(w, http.StatusBadRequest, "invalid_json", "invalid request body", nil)
 		return
 	}
-	out, err := s.getAdminService().ReplaceEnvs(body)
+	current, err := s.getAdminService().ListEnvs()
+	if err != nil {
+		writeErr(w, http.StatusInternalServerError, "store_error", err.Error(), nil)
+		return
+	}
+	out, err := s.getAdminService().ReplaceEnvs(restoreMaskedEnvValues(body, current))
 	if err != nil {
 		if validation := (*adminservice.ValidationError)(nil); errors.As(err, &validation) {
 			writeErr(w, http.StatusBadRequest, validation.Code, validation.Message, nil)
@@ -162,34 +223,76 @@ func (s *Server) putEnvs(w http.ResponseWriter, r *http.Request) {
 		writeErr(w, http.StatusInternalServerError, "store_error", err.Error(), nil)
 		return
 	}
-	writeJSON(w, http.StatusOK, out)
+	writeJSON(w, http.StatusOK, maskEnvVars(out, revealEnvValues(r)))
 }
 
-func (s *Server) deleteEnv(w http.ResponseWriter, r *http.Request) {
-	out, exists, err := s.getAdminService().DeleteEnv(chi.URLParam(r, "key"))
+func (s *Server) patchEnvs(w http.ResponseWriter, r *http.Request) {
+	if rejectScopedKey(w, r) {
+		return
+	}
+	body := map[string]*string{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeErr(w, http.StatusBadRequest, "invalid_json", "invalid request body", nil)
+		return
+	}
+	current, err := s.getAdminService().ListEnvs()
 	if err != nil {
 		writeErr(w, http.StatusInternalServerError, "store_error", err.Error(), nil)
 		return
 	}
-	if !exists {
-		writeErr(w, http.StatusNotFound, "not_found", "env key not found", nil)
+	values := map[string]string{}
+	for key, value := range body {
+		if value != nil {
+			values[key] = *value
+		}
+	}
+	for key, value := range restoreMaskedEnvValues(values, current) {
+		restored := value
+		body[key] = &restored
+	}
+	out, err := s.getAdminService().PatchEnvs(body)
+	if err != nil {
+		if validation := (*adminservice.ValidationError)(nil); errors.As(err, &validation) {
+			writeErr(w, http.StatusBadRequest, validation.Code, validation.Message, nil)
+			return
+		}
+		writeErr(w, http.StatusInternalServerError, "store_error", err.Error(), nil)
 		return
 	}
-	writeJSON(w, http.StatusOK, out)
+	writeJSON(w, http.StatusOK, maskEnvVars(out, revealEnvValues(r)))
 }
 
-func (s *Server) listSkills(w http.ResponseWriter, _ *http.Request) {
-	out, err := s.getAdminService().ListSkills(false)
+func (s *Server) deleteEnv(w http.ResponseWriter, r *http.Request) {
+	if rejectScopedKey(w, r) {
+		return
+	}
+	out, exists, err := s.getAdminService().DeleteEnv(chi.URLParam(r, "key"))
 	if err != nil {
 		writeErr(w, http.StatusInternalServerError, "store_error", err.Error(), nil)
 		return
 	}
-	writeJSON(w, http.StatusOK, out)
+	if !exists {
+		writeErr(w, http.StatusNotFound, "not_found", "env key not found", nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, maskEnvVars(out, revealEnvValues(r)))
+}
+
+func (s *Server) listSkills(w http.ResponseWriter, r *http.Request) {
+	s.writeSkillList(w, r, false)
+}
+
+func (s *Server) listAvailableSkills(w http.ResponseWriter, r *http.Request) {
+	s.writeSkillList(w, r, true)
 }
 
-func (s *Server) listAvailableSkills(w http.ResponseWriter, _ *http.Request) {
-	out, err := s.getAdminService().ListSkills(true)
+func (s *Server) writeSkillList(w http.ResponseWriter, r *http.Request, onlyEnabled bool) {
+	out, err := s.getAdminService().ListSkills(onlyEnabled, strings.TrimSpace(r.URL.Query().Get("sort")))
 	if err != nil {
+		if validation := (*adminservice.ValidationError)(nil); errors.As(err, &validation) {
+			writeErr(w, http.StatusBadRequest, validation.Code, validation.Message, nil)
+			return
+		}
 		writeErr(w, http.StatusInternalServerError, "store_error", err.Error(), nil)
 		return
 	}
@@ -245,6 +348,72 @@ func (s *Server) createSkill(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]bool{"created": created})
 }
 
+func (s *Server) importSkill(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, adminservice.SkillBundleMaxSize+1<<20)
+	if err := r.ParseMultipartForm(adminservice.SkillBundleMaxSize); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			writeErr(
+				w,
+				http.StatusRequestEntityTooLarge,
+				"payload_too_large",
+				"skill bundle exceeds size limit",
+				map[string]int64{"max_bytes": adminservice.SkillBundleMaxSize},
+			)
+			return
+		}
+		writeErr(w, http.StatusBadRequest, "invalid_multipart", "invalid multipart form data", nil)
+		return
+	}
+	srcFile, header, err := r.FormFile(workspaceUploadField)
+	if err != nil {
+		writeErr(w, http.StatusBadRequest, "invalid_multipart", "multipart field \"file\" is required", nil)
+		return
+	}
+	defer srcFile.Close()
+	data, err := io.ReadAll(io.LimitReader(srcFile, adminservice.SkillBundleMaxSize+1))
+	if err != nil {
+		writeErr(w, http.StatusBadRequest, "invalid_multipart", "failed to read skill bundle", nil)
+		return
+	}
+	name, err := s.getAdminService().ImportSkillBundle(adminservice.ImportSkillBundleInput{
+		Name:      r.FormValue("name"),
+		FileName:  header.Filename,
+		Data:      data,
+		Overwrite: parseBool(r.FormValue("overwrite")),
+	})
+	if err != nil {
+		if errors.Is(err, adminservice.ErrSkillExists) {
+			writeErr(w, http.StatusConflict, "skill_exists", "skill already exists; set overwrite=true to replace it", map[string]string{"skill_name": name})
+			return
+		}
+		if validation := (*adminservice.ValidationError)(nil); errors.As(err, &validation) {
+			writeErr(w, http.StatusBadRequest, validation.Code, validation.Message, nil)
+			return
+		}
+		writeErr(w, http.StatusInternalServerError, "store_error", err.Error(), nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"imported": true, "name": name})
+}
+
+func (s *Server) exportSkill(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "skill_name")
+	data, found, err := s.getAdminService().ExportSkillBundle(name)
+	if err != nil {
+		writeErr(w, http.StatusInternalServerError, "store_error", err.Error(), nil)
+		return
+	}
+	if !found {
+		writeErr(w, http.StatusNotFound, "not_found", "skill not found", map[string]string{"skill_name": name})
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + ".zip"}))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
 func (s *Server) disableSkill(w http.ResponseWriter, r *http.Request) {
 	s.setSkillEnabled(w, chi.URLParam(r, "skill_name"), false)
 }
@@ -280,10 +449,13 @@ func (s *Server) deleteSkill(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) loadSkillFile(w http.ResponseWriter, r *http.Request) {
-	content, found, err := s.getAdminService().LoadSkillFile(
-		chi.URLParam(r, "skill_name"),
-		chi.URLParam(r, "file_path"),
-	)
+	filePath, err := url.PathUnescape(chi.URLParam(r, "file_path"))
+	if err != nil {
+		writeErr(w, http.StatusBadRequest, "invalid_path", "invalid skill file path", nil)
+		return
+	}
+	filePath = chi.URLParam(r, "source") + "/" + filePath
+	content, found, err := s.getAdminService().LoadSkillFile(chi.URLParam(r, "skill_name"), filePath)
 	if err != nil {
 		writeErr(w, http.StatusInternalServerError, "store_error", err.Error(), nil)
 		return
@@ -292,9 +464,94 @@ func (s *Server) loadSkillFile(w http.ResponseWriter, r *http.Request) {
 		writeErr(w, http.StatusNotFound, "not_found", "skill file not found", nil)
 		return
 	}
+	if parseBool(r.URL.Query().Get("raw")) {
+		body, contentType := skillFileRawBody(filePath, content)
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		// Skill files are user supplied; keep served HTML or SVG from running
+		// scripts with the gateway's origin.
+		w.Header().Set("Content-Security-Policy", "sandbox")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(body)
+		return
+	}
 	writeJSON(w, http.StatusOK, map[string]string{"content": content})
 }
 
+// skillFileContentTypes covers text formats that mime.TypeByExtension does not
+// know without system mime tables.
+var skillFileContentTypes = map[string]string{
+	".csv":  "text/csv; charset=utf-8",
+	".md":   "text/markdown; charset=utf-8",
+	".txt":  "text/plain; charset=utf-8",
+	".yaml": "application/yaml",
+	".yml":  "application/yaml",
+	".sh":   "text/x-shellscript; charset=utf-8",
+	".py":   "text/x-python; charset=utf-8",
+}
+
+// skillFileRawBody returns the bytes and content type served for a skill file
+// in raw mode. Binary files such as images are stored as strings, either as a
+// data URL or as plain base64, and are decoded here.
+func skillFileRawBody(filePath string, content string) ([]byte, string) {
+	if mediaType, data, ok := decodeSkillFileDataURL(content); ok {
+		return data, mediaType
+	}
+	ext := strings.ToLower(path.Ext(filePath))
+	contentType := skillFileContentTypes[ext]
+	if contentType == "" {
+		contentType = mime.TypeByExtension(ext)
+	}
+	if contentType == "" {
+		contentType = "text/plain; charset=utf-8"
+	}
+	if !isTextContentType(contentType) {
+		if data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(content)); err == nil {
+			return data, contentType
+		}
+	}
+	return []byte(content), contentType
+}
+
+func isTextContentType(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if strings.HasPrefix(mediaType, "text/") {
+		return true
+	}
+	switch mediaType {
+	case "application/json", "application/javascript", "application/xml", "application/yaml", "image/svg+xml":
+		return true
+	}
+	return false
+}
+
+func decodeSkillFileDataURL(content string) (string, []byte, bool) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(content), "data:")
+	if !ok {
+		return "", nil, false
+	}
+	header, payload, ok := strings.Cut(rest, ",")
+	if !ok {
+		return "", nil, false
+	}
+	mediaType, isBase64 := strings.CutSuffix(header, ";base64")
+	if mediaType == "" {
+		mediaType = "text/plain; charset=utf-8"
+	}
+	if !isBase64 {
+		data, err := url.PathUnescape(payload)
+		if err != nil {
+			return "", nil, false
+		}
+		return mediaType, []byte(data), true
+	}
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return "", nil, false
+	}
+	return mediaType, data, true
+}
+
 func readSkillVirtualFile(skill domain.SkillSpec, filePath string) (string, bool) {
 	parts := strings.Split(strings.Trim(filePath, "/"), "/")
 	if len(parts) < 2 {
@@ -336,7 +593,9 @@ const (
 	workspaceUploadDir     = "uploads"
 	workspaceUploadField   = "file"
 	workspaceUploadMaxSize = int64(20 << 20)
-	workspaceUploadNameMax = 96
+	// workspaceDiffMaxBodySize caps the proposed content a diff preview reads.
+	workspaceDiffMaxBodySize = int64(4 << 20)
+	workspaceUploadNameMax   = 96
 )
 
 type workspaceFileEntry struct {
@@ -364,6 +623,8 @@ type workspaceExportPayload struct {
 	Version string                      `json:"version"`
 	Skills  map[string]domain.SkillSpec `json:"skills"`
 	Config  workspaceExportConfig       `json:"config"`
+	// Docs maps docs/AI paths to their text when the export bundles them.
+	Docs map[string]string `json:"docs,omitempty"`
 }
 
 type workspaceImportRequest struct {
@@ -371,6 +632,28 @@ type workspaceImportRequest struct {
 	Payload workspaceExportPayload `json:"payload"`
 }
 
+type workspaceImportChangeCounts struct {
+	Added   int `json:"added"`
+	Removed int `json:"removed"`
+	Changed int `json:"changed"`
+}
+
+type workspaceImportReport struct {
+	Valid            bool                        `json:"valid"`
+	Skills           workspaceImportChangeCounts `json:"skills"`
+	Envs             workspaceImportChangeCounts `json:"envs"`
+	Channels         workspaceImportChangeCounts `json:"channels"`
+	Providers        workspaceImportChangeCounts `json:"providers"`
+	ActiveLLMChanged bool                        `json:"active_llm_changed"`
+	Docs             int                         `json:"docs"`
+}
+
+type workspaceFileDiffResponse struct {
+	Path    string `json:"path"`
+	Changed bool   `json:"changed"`
+	Diff    string `json:"diff"`
+}
+
 type workspaceUploadResponse struct {
 	Uploaded bool   `json:"uploaded"`
 	Path     string `json:"path"`
@@ -401,6 +684,9 @@ func (s *Server) getWorkspaceFile(w http.ResponseWriter, r *http.Request) {
 		writeErr(w, http.StatusBadRequest, "invalid_path", "invalid workspace file path", nil)
 		return
 	}
+	if isWorkspaceSecretFile(filePath) && rejectScopedKey(w, r) {
+		return
+	}
 	data, err := s.getWorkspaceService().GetFile(filePath)
 	if err != nil {
 		if errors.Is(err, workspaceservice.ErrNotFound) {
@@ -423,6 +709,9 @@ func (s *Server) putWorkspaceFile(w http.ResponseWriter, r *http.Request) {
 		writeErr(w, http.StatusBadRequest, "invalid_path", "invalid workspace file path", nil)
 		return
 	}
+	if isWorkspaceSecretFile(filePath) && rejectScopedKey(w, r) {
+		return
+	}
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		writeErr(w, http.StatusBadRequest, "invalid_json", "invalid request body", nil)
@@ -447,6 +736,65 @@ func (s *Server) putWorkspaceFile(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]bool{"updated": true})
 }
 
+// diffWorkspaceFile serves POST /workspace/files/{path}/diff: the body is what
+// a PUT to /workspace/files/{path} would send, and the response is a unified
+// diff against the stored version. The files wildcard route cannot pin the
+// /diff suffix, so any other POST under it is answered with 404.
+func (s *Server) diffWorkspaceFile(w http.ResponseWriter, r *http.Request) {
+	raw, isDiff := strings.CutSuffix(chi.URLParam(r, "*"), "/diff")
+	if !isDiff {
+		writeErr(w, http.StatusNotFound, "not_found", "unknown workspace file action", nil)
+		return
+	}
+	filePath, ok := normalizeWorkspaceFilePath(raw)
+	if !ok {
+		writeErr(w, http.StatusBadRequest, "invalid_path", "invalid workspace file path", nil)
+		return
+	}
+	if isWorkspaceSecretFile(filePath) && rejectScopedKey(w, r) {
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, workspaceDiffMaxBodySize)
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			writeErr(
+				w,
+				http.StatusRequestEntityTooLarge,
+				"payload_too_large",
+				"diff request body exceeds size limit",
+				map[string]int64{"max_bytes": workspaceDiffMaxBodySize},
+			)
+			return
+		}
+		writeErr(w, http.StatusBadRequest, "invalid_json", "invalid request body", nil)
+		return
+	}
+	result, err := s.getWorkspaceService().DiffFile(filePath, body)
+	if err != nil {
+		if errors.Is(err, workspaceservice.ErrNotFound) {
+			writeErr(w, http.StatusNotFound, "not_found", "workspace file not found", nil)
+			return
+		}
+		if validation := (*workspaceservice.ValidationError)(nil); errors.As(err, &validation) {
+			writeErr(w, http.StatusBadRequest, validation.Code, validation.Message, nil)
+			return
+		}
+		if fileErr := (*workspaceservice.FileError)(nil); errors.As(err, &fileErr) {
+			writeErr(w, http.StatusInternalServerError, "file_error", fileErr.Error(), nil)
+			return
+		}
+		writeErr(w, http.StatusInternalServerError, "store_error", err.Error(), nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, workspaceFileDiffResponse{
+		Path:    result.Path,
+		Changed: result.Changed,
+		Diff:    result.Diff,
+	})
+}
+
 func (s *Server) uploadWorkspaceFile(w http.ResponseWriter, r *http.Request) {
 	r.Body = http.MaxBytesReader(w, r.Body, workspaceUploadMaxSize)
 	if err := r.ParseMultipartForm(workspaceUploadMaxSize); err != nil {
@@ -517,6 +865,9 @@ func (s *Server) deleteWorkspaceFile(w http.ResponseWriter, r *http.Request) {
 		writeErr(w, http.StatusBadRequest, "invalid_path", "invalid workspace file path", nil)
 		return
 	}
+	if isWorkspaceSecretFile(filePath) && rejectScopedKey(w, r) {
+		return
+	}
 	deleted, err := s.getWorkspaceService().DeleteFile(filePath)
 	if err != nil {
 		if errors.Is(err, workspaceservice.ErrMethodNotAllowed) {
@@ -533,7 +884,10 @@ func (s *Server) deleteWorkspaceFile(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]bool{"deleted": deleted})
 }
 
-func (s *Server) exportWorkspace(w http.ResponseWriter, _ *http.Request) {
+func (s *Server) exportWorkspace(w http.ResponseWriter, r *http.Request) {
+	if rejectScopedKey(w, r) {
+		return
+	}
 	result, err := s.getWorkspaceService().Export()
 	if err != nil {
 		writeErr(w, http.StatusInternalServerError, "store_error", err.Error(), nil)
@@ -551,15 +905,38 @@ func (s *Server) exportWorkspace(w http.ResponseWriter, _ *http.Request) {
 			},
 		},
 	}
+	download := parseBool(r.URL.Query().Get("download"))
+	if includeWorkspaceDocs(r, download) {
+		out.Docs = collectWorkspaceDocsAIContents()
+	}
+	if download {
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+			"filename": workspaceExportFileName(time.Now()),
+		}))
+	}
 	writeJSON(w, http.StatusOK, out)
 }
 
 func (s *Server) importWorkspace(w http.ResponseWriter, r *http.Request) {
+	if rejectScopedKey(w, r) {
+		return
+	}
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		writeErr(w, http.StatusBadRequest, "invalid_json", "invalid request body", nil)
 		return
 	}
+	// Malformed bodies are reported by the workspace service below.
+	var req workspaceImportRequest
+	_ = json.Unmarshal(body, &req)
+	if err := validateWorkspaceImportDocs(req.Payload.Docs); err != nil {
+		writeErr(w, http.StatusBadRequest, "invalid_workspace_doc", err.Error(), nil)
+		return
+	}
+	if parseBool(r.URL.Query().Get("validate_only")) {
+		s.validateWorkspaceImport(w, body, len(req.Payload.Docs))
+		return
+	}
 	if err := s.getWorkspaceService().Import(body); err != nil {
 		if validation := (*workspaceservice.ValidationError)(nil); errors.As(err, &validation) {
 			writeErr(w, http.StatusBadRequest, validation.Code, validation.Message, nil)
@@ -568,9 +945,36 @@ func (s *Server) importWorkspace(w http.ResponseWriter, r *http.Request) {
 		writeErr(w, http.StatusInternalServerError, "store_error", err.Error(), nil)
 		return
 	}
+	if err := restoreWorkspaceDocs(req.Payload.Docs); err != nil {
+		writeErr(w, http.StatusInternalServerError, "file_error", err.Error(), nil)
+		return
+	}
 	writeJSON(w, http.StatusOK, map[string]bool{"imported": true})
 }
 
+// validateWorkspaceImport answers `validate_only=true` with what a replace
+// import would change, returning the same 400s the real import does.
+func (s *Server) validateWorkspaceImport(w http.ResponseWriter, body []byte, docs int) {
+	result, err := s.getWorkspaceService().ValidateImport(body)
+	if err != nil {
+		if validation := (*workspaceservice.ValidationError)(nil); errors.As(err, &validation) {
+			writeErr(w, http.StatusBadRequest, validation.Code, validation.Message, nil)
+			return
+		}
+		writeErr(w, http.StatusInternalServerError, "store_error", err.Error(), nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, workspaceImportReport{
+		Valid:            result.Valid,
+		Skills:           workspaceImportChangeCounts(result.Skills),
+		Envs:             workspaceImportChangeCounts(result.Envs),
+		Channels:         workspaceImportChangeCounts(result.Channels),
+		Providers:        workspaceImportChangeCounts(result.Providers),
+		ActiveLLMChanged: result.ActiveLLMChanged,
+		Docs:             docs,
+	})
+}
+
 func collectWorkspaceFiles(st *repo.State) []workspaceFileEntry {
 	files := []workspaceFileEntry{
 		{Path: workspaceFileEnvs, Kind: "config", Size: jsonSize(cloneWorkspaceEnvs(st.Envs))},
@@ -697,6 +1101,14 @@ func readWorkspaceFileData(st *repo.State, filePath string) (interface{}, bool)
 	}
 }
 
+// isWorkspaceSecretFile reports whether filePath is one of the config files
+// that carry provider keys and channel secrets.
+func isWorkspaceSecretFile(filePath string) bool {
+	return filePath == workspaceFileEnvs ||
+		filePath == workspaceFileChannels ||
+		filePath == workspaceFileModels
+}
+
 func workspaceFilePathFromRequest(r *http.Request) (string, bool) {
 	raw := chi.URLParam(r, "*")
 	if raw == "" {
@@ -930,6 +1342,8 @@ func cloneWorkspaceSkill(in domain.SkillSpec) domain.SkillSpec {
 		References: cloneWorkspaceJSONMap(in.References),
 		Scripts:    cloneWorkspaceJSONMap(in.Scripts),
 		Enabled:    in.Enabled,
+		CreatedAt:  in.CreatedAt,
+		UpdatedAt:  in.UpdatedAt,
 	}
 }
 
@@ -968,7 +1382,11 @@ func (s *Server) listChannels(w http.ResponseWriter, _ *http.Request) {
 	writeJSON(w, http.StatusOK, out)
 }
 
-func (s *Server) listChannelTypes(w http.ResponseWriter, _ *http.Request) {
+func (s *Server) listChannelTypes(w http.ResponseWriter, r *http.Request) {
+	if parseBool(r.URL.Query().Get("include_requirements")) {
+		writeJSON(w, http.StatusOK, s.getAdminService().ListChannelTypeInfos())
+		return
+	}
 	writeJSON(w, http.StatusOK, s.getAdminService().ListChannelTypes())
 }
 
@@ -1003,6 +1421,23 @@ func (s *Server) getChannel(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, out)
 }
 
+type channelCapabilitiesResponse struct {
+	Channel      string                     `json:"channel"`
+	Capabilities plugin.ChannelCapabilities `json:"capabilities"`
+}
+
+// getChannelCapabilities reports what a registered channel plugin supports;
+// it does not depend on the channel being configured.
+func (s *Server) getChannelCapabilities(w http.ResponseWriter, r *http.Request) {
+	name := strings.ToLower(strings.TrimSpace(chi.URLParam(r, "channel_name")))
+	ch, ok := s.channels[name]
+	if !ok {
+		writeErr(w, http.StatusNotFound, "not_found", "channel not found", nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, channelCapabilitiesResponse{Channel: name, Capabilities: ch.Capabilities()})
+}
+
 func (s *Server) putChannel(w http.ResponseWriter, r *http.Request) {
 	name := chi.URLParam(r, "channel_name")
 	var body map[string]interface{}
@@ -1021,6 +1456,54 @@ func (s *Server) putChannel(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, body)
 }
 
+func (s *Server) getDisabledTools(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.disabledToolsConfig())
+}
+
+func (s *Server) putDisabledTools(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Tools []string `json:"tools"`
+	}
+	if !s.decodeRequestBody(w, r.Body, &body) {
+		return
+	}
+	set := map[string]struct{}{}
+	for _, raw := range body.Tools {
+		if name := strings.ToLower(strings.TrimSpace(raw)); name != "" {
+			set[name] = struct{}{}
+		}
+	}
+	tools := sortedToolNames(set)
+	if err := s.store.Write(func(st *repo.State) error {
+		st.DisabledTools = tools
+		return nil
+	}); err != nil {
+		writeErr(w, http.StatusInternalServerError, "store_error", err.Error(), nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.disabledToolsConfig())
+}
+
+func (s *Server) disabledToolsConfig() domain.DisabledToolsConfig {
+	out := domain.DisabledToolsConfig{
+		Tools:    []string{},
+		EnvTools: sortedToolNames(s.disabledTools),
+	}
+	s.store.Read(func(st *repo.State) {
+		out.Tools = append(out.Tools, st.DisabledTools...)
+	})
+	return out
+}
+
+func sortedToolNames(set map[string]struct{}) []string {
+	out := make([]string, 0, len(set))
+	for name := range set {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
 func mapRunnerError(err error) (status int, code string, message string) {
 	var runnerErr *runner.RunnerError
 	if errors.As(err, &runnerErr) {
@@ -1108,6 +1591,12 @@ func mapToolError(err error) (status int, code string, message string) {
 				return http.StatusBadGateway, "tool_runtime_unavailable", "shell session limit reached"
 			case errors.Is(te.Err, plugin.ErrShellToolEscalationDenied):
 				return http.StatusBadRequest, "tool_permission_denied", "shell escalation requires approval policy on-request"
+			case errors.Is(te.Err, plugin.ErrShellToolCommandBlocked):
+				return http.StatusForbidden, "tool_permission_denied", "shell command is blocked by NEXTAI_SHELL_ALLOW/NEXTAI_SHELL_DENY"
+			case errors.Is(te.Err, plugin.ErrShellToolPathOutsideRoot):
+				return http.StatusBadRequest, "invalid_tool_input", "tool input cwd or path is outside NEXTAI_SHELL_ROOT"
+			case errors.Is(te.Err, plugin.ErrShellToolSessionModeInvalid):
+				return http.StatusBadRequest, "invalid_tool_input", "tool input session_mode must be fresh or persistent (persistent requires a POSIX shell)"
 			case errors.Is(te.Err, plugin.ErrFileLinesToolPathMissing):
 				return http.StatusBadRequest, "invalid_tool_input", "tool input path is required"
 			case errors.Is(te.Err, plugin.ErrFileLinesToolPathInvalid):
@@ -1128,6 +1617,12 @@ func mapToolError(err error) (status int, code string, message string) {
 				return http.StatusBadRequest, "invalid_tool_input", "tool input line range is out of file bounds"
 			case errors.Is(te.Err, plugin.ErrFileLinesToolFileNotFound):
 				return http.StatusBadRequest, "invalid_tool_input", "target file does not exist"
+			case errors.Is(te.Err, plugin.ErrWriteFileToolFileExists):
+				return http.StatusConflict, "tool_conflict", "target file already exists and create_only is set"
+			case errors.Is(te.Err, plugin.ErrWriteFileToolPathIsDir):
+				return http.StatusBadRequest, "invalid_tool_input", "tool input path is a directory"
+			case errors.Is(te.Err, plugin.ErrWriteFileToolDuplicatePath):
+				return http.StatusBadRequest, "invalid_tool_input", "tool input writes the same path more than once"
 			case errors.Is(te.Err, plugin.ErrBrowserToolItemsInvalid):
 				return http.StatusBadRequest, "invalid_tool_input", "tool input items must be a non-empty array of objects"
 			case errors.Is(te.Err, plugin.ErrBrowserToolTaskMissing):
@@ -1150,6 +1645,16 @@ func mapToolError(err error) (status int, code string, message string) {
 				return http.StatusBadRequest, "invalid_tool_input", "tool input pattern is required"
 			case errors.Is(te.Err, plugin.ErrFindToolFileNotFound):
 				return http.StatusBadRequest, "invalid_tool_input", "target file does not exist"
+			case errors.Is(te.Err, plugin.ErrListDirToolItemsInvalid):
+				return http.StatusBadRequest, "invalid_tool_input", "tool input items must be a non-empty array of objects"
+			case errors.Is(te.Err, plugin.ErrListDirToolNotFound):
+				return http.StatusBadRequest, "invalid_tool_input", "target directory does not exist"
+			case errors.Is(te.Err, plugin.ErrListDirToolNotDir):
+				return http.StatusBadRequest, "invalid_tool_input", "tool input path is not a directory"
+			case errors.Is(te.Err, plugin.ErrListDirToolDepthInvalid):
+				return http.StatusBadRequest, "invalid_tool_input", "tool input depth must be between 1 and 5"
+			case errors.Is(te.Err, plugin.ErrListDirToolGlobInvalid):
+				return http.StatusBadRequest, "invalid_tool_input", "tool input glob is invalid"
 			default:
 				return http.StatusBadGateway, te.Code, te.Message
 			}
@@ -1221,6 +1726,52 @@ func formatToolErrorFeedback(err error) string {
 	return fmt.Sprintf("tool_error code=%s message=%s detail=%s", code, message, detail)
 }
 
+func (s *Server) getAdminStats(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.collectAdminStats())
+}
+
+// collectAdminStats builds dashboard counters from a single store read.
+func (s *Server) collectAdminStats() domain.AdminStats {
+	out := domain.AdminStats{
+		CronJobs: domain.AdminCronJobStats{ByStatus: map[string]int{}},
+	}
+	s.store.Read(func(st *repo.State) {
+		for _, chat := range st.Chats {
+			out.Chats.Total++
+			if chat.Archived {
+				out.Chats.Archived++
+			}
+		}
+		out.Chats.Deleted = len(st.DeletedChats)
+		for _, history := range st.Histories {
+			out.Messages += len(history)
+		}
+		for id, job := range st.CronJobs {
+			out.CronJobs.Total++
+			if job.Enabled {
+				out.CronJobs.Enabled++
+			}
+			state := st.CronStates[id]
+			if state.Paused {
+				out.CronJobs.Paused++
+			}
+			status := "never_run"
+			if state.LastStatus != nil && strings.TrimSpace(*state.LastStatus) != "" {
+				status = strings.TrimSpace(*state.LastStatus)
+			}
+			out.CronJobs.ByStatus[status]++
+		}
+		for _, setting := range st.Providers {
+			out.Providers.Configured++
+			if providerEnabled(setting) {
+				out.Providers.Enabled++
+			}
+		}
+	})
+	out.GeneratedAt = nowISO()
+	return out
+}
+
 func (s *Server) collectProviderCatalog() ([]domain.ProviderInfo, map[string]string, domain.ModelSlotConfig) {
 	out := make([]domain.ProviderInfo, 0)
 	defaults := map[string]string{}
@@ -1256,7 +1807,7 @@ func (s *Server) collectProviderCatalog() ([]domain.ProviderInfo, map[string]str
 func buildProviderInfo(providerID string, setting repo.ProviderSetting) domain.ProviderInfo {
 	normalizeProviderSetting(&setting)
 	spec := provider.ResolveProvider(providerID)
-	apiKey := resolveProviderAPIKey(providerID, setting)
+	apiKey := resolvePrimaryProviderAPIKey(providerID, setting)
 	return domain.ProviderInfo{
 		ID:                 providerID,
 		Name:               spec.Name,
@@ -1265,6 +1816,12 @@ func buildProviderInfo(providerID string, setting repo.ProviderSetting) domain.P
 		APIKeyPrefix:       spec.APIKeyPrefix,
 		Models:             provider.ResolveModels(providerID, setting.ModelAliases),
 		ReasoningEffort:    setting.ReasoningEffort,
+		ForwardUser:        setting.ForwardUser,
+		CompressRequests:   setting.CompressRequests,
+		StreamUsage:        setting.StreamUsage,
+		ParallelToolCalls:  setting.ParallelToolCalls,
+		Temperature:        setting.Temperature,
+		MaxTokens:          setting.MaxTokens,
 		Headers:            sanitizeStringMap(setting.Headers),
 		TimeoutMS:          setting.TimeoutMS,
 		ModelAliases:       sanitizeStringMap(setting.ModelAliases),
@@ -1272,13 +1829,25 @@ func buildProviderInfo(providerID string, setting repo.ProviderSetting) domain.P
 		Enabled:            providerEnabled(setting),
 		HasAPIKey:          strings.TrimSpace(apiKey) != "",
 		CurrentAPIKey:      maskKey(apiKey),
+		CurrentAPIKeys:     modelservice.MaskAPIKeys(setting),
 		CurrentBaseURL:     resolveProviderBaseURL(providerID, setting),
 	}
 }
 
-func resolveProviderAPIKey(providerID string, setting repo.ProviderSetting) string {
-	if key := strings.TrimSpace(setting.APIKey); key != "" {
-		return key
+// resolveProviderAPIKey returns the key for one provider request, rotating
+// through api_key and api_keys when more than one is configured.
+func (s *Server) resolveProviderAPIKey(providerID string, setting repo.ProviderSetting) string {
+	if keys := modelservice.ProviderAPIKeys(setting); len(keys) > 1 {
+		return s.providerAPIKeys.pick(providerID, keys, time.Now())
+	}
+	return resolvePrimaryProviderAPIKey(providerID, setting)
+}
+
+// resolvePrimaryProviderAPIKey returns the configured key without rotating:
+// api_key, else the first api_keys entry, else the provider env var.
+func resolvePrimaryProviderAPIKey(providerID string, setting repo.ProviderSetting) string {
+	if keys := modelservice.ProviderAPIKeys(setting); len(keys) > 0 {
+		return keys[0]
 	}
 	return strings.TrimSpace(os.Getenv(providerEnvPrefix(providerID) + "_API_KEY"))
 }
@@ -1323,6 +1892,7 @@ func normalizeProviderSetting(setting *repo.ProviderSetting) {
 	setting.APIKey = strings.TrimSpace(setting.APIKey)
 	setting.BaseURL = strings.TrimSpace(setting.BaseURL)
 	setting.ReasoningEffort = strings.ToLower(strings.TrimSpace(setting.ReasoningEffort))
+	setting.ForwardUser = strings.ToLower(strings.TrimSpace(setting.ForwardUser))
 	if setting.Enabled == nil {
 		enabled := true
 		setting.Enabled = &enabled
@@ -1,6 +1,7 @@
 package app
 
 import (
+	"nextai/apps/gateway/internal/plugin"
 	adminservice "nextai/apps/gateway/internal/service/admin"
 )
 
@@ -13,12 +14,20 @@ func (s *Server) getAdminService() *adminservice.Service {
 
 func (s *Server) newAdminService() *adminservice.Service {
 	supportedChannels := map[string]struct{}{}
-	for name := range s.channels {
+	channelRequirements := map[string]adminservice.ChannelRequirement{}
+	for name, ch := range s.channels {
 		supportedChannels[name] = struct{}{}
+		if validator, ok := ch.(plugin.ChannelConfigValidator); ok {
+			channelRequirements[name] = adminservice.ChannelRequirement{
+				RequiredConfig: validator.RequiredConfig(),
+				Validate:       validator.ValidateConfig,
+			}
+		}
 	}
 	return adminservice.NewService(adminservice.Dependencies{
-		Store:             s.stateStore,
-		DataDir:           s.cfg.DataDir,
-		SupportedChannels: supportedChannels,
+		Store:               s.stateStore,
+		DataDir:             s.cfg.DataDir,
+		SupportedChannels:   supportedChannels,
+		ChannelRequirements: channelRequirements,
 	})
 }
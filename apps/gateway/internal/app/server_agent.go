@@ -2,6 +2,8 @@ package app
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,12 +13,20 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
+	"nextai/apps/gateway/internal/channel"
+	"nextai/apps/gateway/internal/config"
 	"nextai/apps/gateway/internal/domain"
+	"nextai/apps/gateway/internal/observability"
 	"nextai/apps/gateway/internal/plugin"
 	"nextai/apps/gateway/internal/repo"
 	"nextai/apps/gateway/internal/runner"
+	agentservice "nextai/apps/gateway/internal/service/agent"
 	agentprotocolservice "nextai/apps/gateway/internal/service/agentprotocol"
+	modelservice "nextai/apps/gateway/internal/service/model"
+	"nextai/apps/gateway/internal/service/ports"
 	selfopsservice "nextai/apps/gateway/internal/service/selfops"
 )
 
@@ -46,6 +56,16 @@ type agentSystemLayersResponse struct {
 	EstimatedTokensTotal int                    `json:"estimated_tokens_total"`
 }
 
+type toolSchemaView struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Parameters  map[string]interface{} `json:"parameters"`
+}
+
+type toolSchemasResponse struct {
+	Tools []toolSchemaView `json:"tools"`
+}
+
 const assistantMetadataProviderResponseIDKey = "provider_response_id"
 
 func (s *Server) getAgentSystemLayers(w http.ResponseWriter, r *http.Request) {
@@ -112,6 +132,32 @@ func (s *Server) getAgentSystemLayers(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, resp)
 }
 
+// listToolSchemas returns the tool definitions a turn in prompt_mode (default
+// when omitted) would send to the provider, so clients can validate shortcut
+// tool inputs up front. Disabled tools are left out.
+func (s *Server) listToolSchemas(w http.ResponseWriter, r *http.Request) {
+	promptMode := promptModeDefault
+	if rawMode := strings.TrimSpace(r.URL.Query().Get(chatMetaPromptModeKey)); rawMode != "" {
+		normalizedMode, ok := normalizePromptMode(rawMode)
+		if !ok {
+			writeErr(w, http.StatusBadRequest, "invalid_request", "invalid prompt_mode", nil)
+			return
+		}
+		promptMode = normalizedMode
+	}
+
+	definitions := s.listToolDefinitionsForPromptMode(promptMode)
+	resp := toolSchemasResponse{Tools: make([]toolSchemaView, 0, len(definitions))}
+	for _, definition := range definitions {
+		resp.Tools = append(resp.Tools, toolSchemaView{
+			Name:        definition.Name,
+			Description: definition.Description,
+			Parameters:  definition.Parameters,
+		})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
 func (s *Server) processQQInbound(w http.ResponseWriter, r *http.Request) {
 	bodyBytes, err := io.ReadAll(r.Body)
 	if err != nil {
@@ -119,6 +165,11 @@ func (s *Server) processQQInbound(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if challenge, ok := parseQQWebhookValidation(bodyBytes); ok {
+		s.answerQQWebhookValidation(w, challenge)
+		return
+	}
+
 	event, err := parseQQInboundEvent(bodyBytes)
 	if err != nil {
 		writeErr(w, http.StatusBadRequest, "invalid_qq_event", err.Error(), nil)
@@ -132,30 +183,17 @@ func (s *Server) processQQInbound(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	request := domain.AgentProcessRequest{
-		Input: []domain.AgentInputMessage{
-			{
-				Role: "user",
-				Type: "message",
-				Content: []domain.RuntimeContent{
-					{Type: "text", Text: event.Text},
-				},
-			},
-		},
-		SessionID: event.SessionID,
-		UserID:    event.UserID,
-		Channel:   "qq",
-		Stream:    false,
-		BizParams: map[string]interface{}{
-			"channel": map[string]interface{}{
-				"target_type": event.TargetType,
-				"target_id":   event.TargetID,
-				"msg_id":      event.MessageID,
-			},
-		},
+	debounced, release := s.debounceQQInboundEvent(event)
+	if debounced {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"accepted":  true,
+			"debounced": true,
+		})
+		return
 	}
+	defer release()
 
-	agentBody, err := json.Marshal(request)
+	agentBody, err := buildQQAgentRequestBody([]qqInboundEvent{event})
 	if err != nil {
 		writeErr(w, http.StatusInternalServerError, "qq_inbound_marshal_failed", "failed to build agent request", nil)
 		return
@@ -164,16 +202,17 @@ func (s *Server) processQQInbound(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) processAgentWithBody(w http.ResponseWriter, r *http.Request, bodyBytes []byte) {
-	var req domain.AgentProcessRequest
-	if err := json.Unmarshal(bodyBytes, &req); err != nil {
-		writeErr(w, http.StatusBadRequest, "invalid_json", "invalid request body", nil)
-		return
-	}
+	startedAt := time.Now()
+	defer func() { observability.ObserveAgentRequest(time.Since(startedAt)) }()
 	rawRequest := map[string]interface{}{}
 	if err := json.Unmarshal(bodyBytes, &rawRequest); err != nil {
 		writeErr(w, http.StatusBadRequest, "invalid_json", "invalid request body", nil)
 		return
 	}
+	var req domain.AgentProcessRequest
+	if !s.decodeRequestBytes(w, s.withoutShortcutToolKeys(bodyBytes, rawRequest), &req) {
+		return
+	}
 
 	req.Channel = resolveProcessRequestChannel(r, req.Channel)
 	streaming := req.Stream
@@ -193,22 +232,28 @@ func (s *Server) processAgentWithBody(w http.ResponseWriter, r *http.Request, bo
 		}
 	}
 
+	// The run outlives its connection: a dropped SSE stream or a client timeout
+	// leaves it running so its events can be replayed, and only the cancel
+	// endpoints or the agent timeout stop it.
+	ctx, cancelRun := context.WithCancel(context.WithoutCancel(r.Context()))
+	runID := s.startAgentRun(req, cancelRun)
+	ctx = withAgentRunID(ctx, runID)
+	if !streaming {
+		s.processAgentUntilPaused(ctx, cancelRun, w, runID, req, rawRequest)
+		return
+	}
+	defer cancelRun()
+	defer s.finishAgentRun(runID)
+	runIDSent := false
+
 	streamFail := func(status int, code, message string, details interface{}) {
-		if !streaming || !streamStarted {
+		if !streamStarted {
 			writeErr(w, status, code, message, details)
 			return
 		}
-		meta := map[string]interface{}{
-			"code":    code,
-			"message": message,
-		}
-		if details != nil {
-			meta["details"] = details
-		}
-		payload, _ := json.Marshal(domain.AgentEvent{
-			Type: "error",
-			Meta: meta,
-		})
+		errorEvent := agentErrorEvent(code, message, details)
+		s.appendAgentRunEvent(runID, errorEvent)
+		payload, _ := json.Marshal(errorEvent)
 		_, _ = fmt.Fprintf(w, "data: %s\n\n", payload)
 		flusher.Flush()
 		_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
@@ -216,26 +261,23 @@ func (s *Server) processAgentWithBody(w http.ResponseWriter, r *http.Request, bo
 	}
 
 	emitEvent := func(evt domain.AgentEvent) {
-		if !streaming {
-			return
+		if !runIDSent && evt.Type == "step_started" {
+			evt.Meta = mergeEventMeta(evt.Meta, map[string]interface{}{"run_id": runID})
+			runIDSent = true
 		}
+		s.appendAgentRunEvent(runID, evt)
 		payload, _ := json.Marshal(evt)
 		_, _ = fmt.Fprintf(w, "data: %s\n\n", payload)
 		flusher.Flush()
 		streamStarted = true
 	}
 
-	response, processErr := s.processAgentCore(r.Context(), req, rawRequest, streaming, emitEvent)
+	response, processErr := s.processAgentCore(ctx, req, rawRequest, streaming, emitEvent)
 	if processErr != nil {
 		streamFail(processErr.Status, processErr.Code, processErr.Message, processErr.Details)
 		return
 	}
 
-	if !streaming {
-		writeJSON(w, http.StatusOK, response)
-		return
-	}
-
 	if !streamStarted {
 		for _, evt := range response.Events {
 			emitEvent(evt)
@@ -245,6 +287,112 @@ func (s *Server) processAgentWithBody(w http.ResponseWriter, r *http.Request, bo
 	flusher.Flush()
 }
 
+// processAgentUntilPaused serves a non-streaming run. It answers with the
+// final response, or with 202 and the run_id as soon as a tool call waits for
+// approval; the run then goes on in the background and its remaining events,
+// ending with completed or error, are read from GET /agent/runs/{run_id}/events.
+func (s *Server) processAgentUntilPaused(
+	ctx context.Context,
+	cancelRun context.CancelFunc,
+	w http.ResponseWriter,
+	runID string,
+	req domain.AgentProcessRequest,
+	rawRequest map[string]interface{},
+) {
+	type outcome struct {
+		response domain.AgentProcessResponse
+		err      *ports.AgentProcessError
+	}
+	done := make(chan outcome, 1)
+	paused := make(chan domain.AgentEvent, 1)
+	emitEvent := func(evt domain.AgentEvent) {
+		s.appendAgentRunEvent(runID, evt)
+		if evt.Type == agentservice.EventTypeToolApprovalRequired {
+			select {
+			case paused <- evt:
+			default:
+			}
+		}
+	}
+	go func() {
+		defer cancelRun()
+		defer s.finishAgentRun(runID)
+		response, processErr := s.processAgentCore(ctx, req, rawRequest, false, emitEvent)
+		if processErr != nil {
+			s.appendAgentRunEvent(runID, agentErrorEvent(processErr.Code, processErr.Message, processErr.Details))
+		}
+		done <- outcome{response: response, err: processErr}
+	}()
+
+	select {
+	case out := <-done:
+		if out.err != nil {
+			writeErr(w, out.err.Status, out.err.Code, out.err.Message, out.err.Details)
+			return
+		}
+		out.response.Events, out.response.EventsTruncated = capResponseEvents(out.response.Events, s.maxResponseEvents())
+		writeJSON(w, http.StatusOK, out.response)
+	case evt := <-paused:
+		approvalID, _ := evt.Meta["approval_id"].(string)
+		writeJSON(w, http.StatusAccepted, agentRunPausedResponse{
+			RunID:      runID,
+			Status:     agentRunStatusAwaitingApproval,
+			ApprovalID: approvalID,
+			ToolCall:   evt.ToolCall,
+		})
+	}
+}
+
+func agentErrorEvent(code, message string, details interface{}) domain.AgentEvent {
+	meta := map[string]interface{}{
+		"code":    code,
+		"message": message,
+	}
+	if details != nil {
+		meta["details"] = details
+	}
+	return domain.AgentEvent{Type: "error", Meta: meta}
+}
+
+func (s *Server) maxResponseEvents() int {
+	if s.cfg.MaxResponseEvents > 0 {
+		return s.cfg.MaxResponseEvents
+	}
+	return config.DefaultMaxResponseEvents
+}
+
+// capResponseEvents trims a non-streaming event list to at most limit entries.
+// It keeps everything up to the first step_started, an events_elided summary,
+// and the newest events that still fit. The head shrinks when it would crowd
+// out the newest event, and below three entries only the newest events are
+// kept, without the summary.
+func capResponseEvents(events []domain.AgentEvent, limit int) ([]domain.AgentEvent, bool) {
+	if limit <= 0 || len(events) <= limit {
+		return events, false
+	}
+	if limit < 3 {
+		return append([]domain.AgentEvent(nil), events[len(events)-limit:]...), true
+	}
+	headLen := 0
+	for idx, evt := range events {
+		if evt.Type == "step_started" {
+			headLen = idx + 1
+			break
+		}
+	}
+	headLen = min(headLen, limit-2)
+	tailLen := limit - headLen - 1
+	elided := len(events) - headLen - tailLen
+	out := make([]domain.AgentEvent, 0, limit)
+	out = append(out, events[:headLen]...)
+	out = append(out, domain.AgentEvent{
+		Type: "events_elided",
+		Meta: map[string]interface{}{"elided_count": elided},
+	})
+	out = append(out, events[len(events)-tailLen:]...)
+	return out, true
+}
+
 func isContextResetCommand(input []domain.AgentInputMessage) bool {
 	for _, msg := range input {
 		if !strings.EqualFold(strings.TrimSpace(msg.Role), "user") {
@@ -320,15 +468,32 @@ func normalizeSystemLayerTaskCommand(raw string) (string, bool) {
 	}
 }
 
+// clearChatContext drops the session's chats and history. A stored per-chat
+// system prompt is carried over to a fresh chat so the persona survives /new.
 func (s *Server) clearChatContext(sessionID, userID, channel string) error {
 	return s.store.Write(func(state *repo.State) error {
+		systemPrompt := ""
 		for chatID, spec := range state.Chats {
 			if spec.SessionID != sessionID || spec.UserID != userID || spec.Channel != channel {
 				continue
 			}
+			if prompt := chatSystemPromptFromMeta(spec.Meta); prompt != "" {
+				systemPrompt = prompt
+			}
 			delete(state.Chats, chatID)
 			delete(state.Histories, chatID)
 		}
+		if systemPrompt == "" {
+			return nil
+		}
+		chatID := newID("chat")
+		now := nowISO()
+		state.Chats[chatID] = domain.ChatSpec{
+			ID: chatID, Name: "New Chat", SessionID: sessionID, UserID: userID, Channel: channel,
+			Meta:      withChatSystemPrompt(nil, systemPrompt),
+			CreatedAt: now, UpdatedAt: now,
+		}
+		state.Histories[chatID] = []domain.RuntimeMessage{}
 		return nil
 	})
 }
@@ -409,6 +574,28 @@ type qqInboundEvent struct {
 	MessageID  string
 }
 
+func (s *Server) answerQQWebhookValidation(w http.ResponseWriter, challenge qqWebhookValidation) {
+	if strings.TrimSpace(challenge.PlainToken) == "" || strings.TrimSpace(challenge.EventTS) == "" {
+		writeErr(w, http.StatusBadRequest, "invalid_qq_event", "webhook validation requires d.plain_token and d.event_ts", nil)
+		return
+	}
+	secret, verified := s.qqInboundSignatureSecret()
+	if secret == "" {
+		writeErr(w, http.StatusBadRequest, "qq_secret_missing", "qq channel client_secret is required to answer webhook validation", nil)
+		return
+	}
+	// Without inbound verification anyone could post a challenge and get an
+	// arbitrary event_ts+plain_token signed with the bot secret.
+	if !verified {
+		writeErr(w, http.StatusForbidden, "qq_signature_verification_disabled", "webhook validation requires inbound_verify_signature to be enabled", nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{
+		"plain_token": challenge.PlainToken,
+		"signature":   signQQWebhookValidation(secret, challenge),
+	})
+}
+
 func parseQQInboundEvent(body []byte) (qqInboundEvent, error) {
 	parsed, err := agentprotocolservice.ParseQQInboundEvent(body)
 	if err != nil {
@@ -428,6 +615,34 @@ func mergeChannelDispatchConfig(channelName string, cfg map[string]interface{},
 	return agentprotocolservice.MergeChannelDispatchConfig(channelName, cfg, bizParams)
 }
 
+// channelReplyText converts reply to plain text when the channel config sets
+// strip_markdown and the channel cannot render markdown. Only the dispatched
+// copy changes; history keeps the markdown.
+func channelReplyText(caps plugin.ChannelCapabilities, cfg map[string]interface{}, reply string) string {
+	if caps.Markdown || !parseBool(cfg["strip_markdown"]) {
+		return reply
+	}
+	return channel.StripMarkdown(reply)
+}
+
+// channelReplyChunks prepares reply for dispatch and splits it on paragraph or
+// line boundaries when the channel sets max_message_length. Every chunk later
+// gets bot_prefix and the transform prefix and suffix, so those count against
+// the limit.
+func channelReplyChunks(caps plugin.ChannelCapabilities, cfg map[string]interface{}, reply string) []string {
+	text := channelReplyText(caps, cfg, reply)
+	limit, ok := parsePositiveIntAny(cfg["max_message_length"])
+	if !ok {
+		return []string{text}
+	}
+	overhead := utf8.RuneCountInString(stringValue(cfg["bot_prefix"])) +
+		utf8.RuneCountInString(channelTransformText(cfg, ""))
+	if overhead < limit {
+		limit -= overhead
+	}
+	return channel.SplitMessage(text, limit)
+}
+
 func cronChatMetaFromBizParams(bizParams map[string]interface{}) map[string]interface{} {
 	return agentprotocolservice.CronChatMetaFromBizParams(bizParams)
 }
@@ -450,6 +665,8 @@ func resolvePromptModeFromChatMeta(meta map[string]interface{}) string {
 	)
 }
 
+// resolveChatActiveModelSlot picks the model the chat is pinned to through its
+// active_llm_override meta, then the global active model.
 func resolveChatActiveModelSlot(meta map[string]interface{}, state *repo.State) domain.ModelSlotConfig {
 	if override, ok := parseChatActiveModelOverride(meta); ok {
 		return override
@@ -618,6 +835,24 @@ func providerStoreEnabled(setting repo.ProviderSetting) bool {
 	return *setting.Store
 }
 
+// resolveProviderEndUserID maps the request user to the upstream `user` field
+// according to the provider forward_user mode.
+func resolveProviderEndUserID(setting repo.ProviderSetting, userID string) string {
+	userID = strings.TrimSpace(userID)
+	if userID == "" {
+		return ""
+	}
+	switch strings.ToLower(strings.TrimSpace(setting.ForwardUser)) {
+	case modelservice.ForwardUserRaw:
+		return userID
+	case modelservice.ForwardUserHashed:
+		sum := sha256.Sum256([]byte(userID))
+		return hex.EncodeToString(sum[:])
+	default:
+		return ""
+	}
+}
+
 func splitReplyChunks(text string, chunkSize int) []string {
 	if chunkSize <= 0 {
 		chunkSize = 12
@@ -667,6 +902,38 @@ func (s *Server) listToolDefinitionsForTurnRuntime(snapshot TurnRuntimeSnapshot)
 	return out
 }
 
+// withoutShortcutToolKeys drops top-level tool shortcut keys such as "view" or
+// "shell" from body under strict decoding, since they are read from the raw
+// request rather than decoded into domain.AgentProcessRequest.
+func (s *Server) withoutShortcutToolKeys(body []byte, rawRequest map[string]interface{}) []byte {
+	if !s.cfg.StrictRequestDecode {
+		return body
+	}
+	shortcuts := map[string]struct{}{}
+	for _, promptMode := range []string{promptModeDefault, promptModeCodex} {
+		for _, name := range s.resolveAvailableToolDefinitionNames(promptMode) {
+			shortcuts[agentprotocolservice.NormalizeToolNameForPromptMode(name, promptMode)] = struct{}{}
+		}
+	}
+	stripped := make(map[string]interface{}, len(rawRequest))
+	found := false
+	for key, value := range rawRequest {
+		if _, ok := shortcuts[agentprotocolservice.NormalizeToolNameForPromptMode(key, "")]; ok {
+			found = true
+			continue
+		}
+		stripped[key] = value
+	}
+	if !found {
+		return body
+	}
+	out, err := json.Marshal(stripped)
+	if err != nil {
+		return body
+	}
+	return out
+}
+
 func (s *Server) resolveAvailableToolDefinitionNames(promptMode string) []string {
 	registeredToolNames := make([]string, 0, len(s.tools))
 	for name := range s.tools {
@@ -857,10 +1124,19 @@ func buildAssistantMessageMetadata(events []domain.AgentEvent) map[string]interf
 			if toolOrder == 0 {
 				toolOrder = idx + 1
 			}
+			// Inline screenshot bytes are for the live event only; history
+			// keeps the path so chats do not grow by an image per call.
+			toolResult := *evt.ToolResult
+			if shot := toolResult.Screenshot; shot != nil && shot.Base64 != "" {
+				toolResult.Screenshot = nil
+				if shot.Path != "" {
+					toolResult.Screenshot = &domain.AgentToolScreenshot{Path: shot.Path}
+				}
+			}
 			raw, err := json.Marshal(domain.AgentEvent{
 				Type:       "tool_result",
 				Step:       evt.Step,
-				ToolResult: evt.ToolResult,
+				ToolResult: &toolResult,
 			})
 			if err != nil {
 				continue
@@ -1121,6 +1397,8 @@ func (s *Server) executeToolCallForPromptModeWithContext(ctx context.Context, pr
 		}
 	}
 
+	observability.IncToolInvocation(s.toolMetricLabel(ctx, name))
+
 	if runtimeSpec, ok := runtimeToolSpecFromContext(ctx, name); ok {
 		return s.executeRuntimeToolCall(ctx, runtimeSpec, input)
 	}
@@ -1143,9 +1421,9 @@ func (s *Server) executeToolCallForPromptModeWithContext(ctx context.Context, pr
 	case "apply_patch":
 		return s.executeApplyPatchToolCall(ctx, input)
 	case "open":
-		return s.executeOpenToolCall(input)
+		return s.executeOpenToolCall(ctx, input)
 	case "click", "screenshot":
-		return s.executeApproxBrowserToolCall(name, input)
+		return s.executeApproxBrowserToolCall(ctx, name, input)
 	case "self_ops":
 		return s.executeSelfOpsToolCall(input)
 	default:
@@ -1153,10 +1431,44 @@ func (s *Server) executeToolCallForPromptModeWithContext(ctx context.Context, pr
 		if err != nil {
 			return "", err
 		}
+		recordToolCitations(ctx, result)
+		recordToolScreenshot(ctx, result)
 		return renderToolResult(name, result)
 	}
 }
 
+// builtinToolNames are the tools executeToolCallForPromptModeWithContext
+// handles itself rather than through a registered plugin.
+var builtinToolNames = map[string]struct{}{
+	"spawn_agent":        {},
+	"send_input":         {},
+	"resume_agent":       {},
+	"wait":               {},
+	"close_agent":        {},
+	"request_user_input": {},
+	"update_plan":        {},
+	"apply_patch":        {},
+	"open":               {},
+	"click":              {},
+	"screenshot":         {},
+	"self_ops":           {},
+}
+
+// toolMetricLabel keeps the tool label of nextai_tool_invocations_total
+// bounded: names the model made up are counted as "unknown".
+func (s *Server) toolMetricLabel(ctx context.Context, name string) string {
+	if _, ok := runtimeToolSpecFromContext(ctx, name); ok {
+		return name
+	}
+	if _, ok := builtinToolNames[name]; ok {
+		return name
+	}
+	if _, ok := s.tools[name]; ok {
+		return name
+	}
+	return "unknown"
+}
+
 func validateShellToolSandboxPermissions(ctx context.Context, toolName string, input map[string]interface{}) error {
 	if !strings.EqualFold(strings.TrimSpace(toolName), "shell") {
 		return nil
@@ -1290,7 +1602,7 @@ func defaultIfEmpty(value string, fallback string) string {
 	return value
 }
 
-func (s *Server) executeOpenToolCall(input map[string]interface{}) (string, error) {
+func (s *Server) executeOpenToolCall(ctx context.Context, input map[string]interface{}) (string, error) {
 	targetName, targetInput, routeErr := buildOpenToolRoute(input)
 	if routeErr != nil {
 		return "", &toolError{
@@ -1319,10 +1631,11 @@ func (s *Server) executeOpenToolCall(input map[string]interface{}) (string, erro
 	if err != nil {
 		return "", err
 	}
+	recordToolScreenshot(ctx, result)
 	return renderToolResult("open", result)
 }
 
-func (s *Server) executeApproxBrowserToolCall(action string, input map[string]interface{}) (string, error) {
+func (s *Server) executeApproxBrowserToolCall(ctx context.Context, action string, input map[string]interface{}) (string, error) {
 	requiredCapability := ""
 	switch strings.ToLower(strings.TrimSpace(action)) {
 	case "click":
@@ -1348,6 +1661,7 @@ func (s *Server) executeApproxBrowserToolCall(action string, input map[string]in
 	if err != nil {
 		return "", err
 	}
+	recordToolScreenshot(ctx, result)
 	approx := map[string]interface{}{
 		"mode":        "approx",
 		"action":      action,
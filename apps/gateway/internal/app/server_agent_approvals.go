@@ -0,0 +1,174 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"nextai/apps/gateway/internal/domain"
+	agentservice "nextai/apps/gateway/internal/service/agent"
+)
+
+const (
+	bizParamsRequireApprovalKey    = "require_approval"
+	agentRunStatusAwaitingApproval = "awaiting_approval"
+)
+
+type agentRunIDContextKey struct{}
+
+// pendingToolApproval is a tool call paused until a client approves or
+// rejects it through /agent/runs/{run_id}/approve or /reject.
+type pendingToolApproval struct {
+	decisions chan agentservice.ToolApprovalDecision
+}
+
+// agentRunPausedResponse answers a non-streaming /agent/process request whose
+// run stopped at a tool call that needs approval.
+type agentRunPausedResponse struct {
+	RunID      string                       `json:"run_id"`
+	Status     string                       `json:"status"`
+	ApprovalID string                       `json:"approval_id"`
+	ToolCall   *domain.AgentToolCallPayload `json:"tool_call,omitempty"`
+}
+
+type agentRunApprovalRequest struct {
+	ApprovalID string `json:"approval_id"`
+	Reason     string `json:"reason"`
+}
+
+type agentRunApprovalResponse struct {
+	RunID      string `json:"run_id"`
+	ApprovalID string `json:"approval_id"`
+	Approved   bool   `json:"approved"`
+}
+
+func withAgentRunID(ctx context.Context, runID string) context.Context {
+	return context.WithValue(ctx, agentRunIDContextKey{}, runID)
+}
+
+func agentRunIDFromContext(ctx context.Context) string {
+	runID, _ := ctx.Value(agentRunIDContextKey{}).(string)
+	return runID
+}
+
+// parseRequireApprovalTools reads biz_params.require_approval, a list of tool
+// names whose calls pause for approval. Names are matched case-insensitively.
+func parseRequireApprovalTools(bizParams map[string]interface{}) (map[string]struct{}, error) {
+	raw, ok := bizParams[bizParamsRequireApprovalKey]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	items, ok := raw.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("biz_params.%s must be an array of tool names", bizParamsRequireApprovalKey)
+	}
+	tools := map[string]struct{}{}
+	for _, item := range items {
+		name, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("biz_params.%s must be an array of tool names", bizParamsRequireApprovalKey)
+		}
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			tools[name] = struct{}{}
+		}
+	}
+	if len(tools) == 0 {
+		return nil, nil
+	}
+	return tools, nil
+}
+
+// agentToolApproval gates tools for the run started by processAgentWithBody.
+// Paused calls are kept on the run record so the approve and reject routes
+// can find them.
+func (s *Server) agentToolApproval(runID string, tools map[string]struct{}) *agentservice.ToolApproval {
+	return &agentservice.ToolApproval{
+		Tools:   tools,
+		Meta:    map[string]interface{}{"run_id": runID},
+		Timeout: s.toolApprovalTimeout(),
+		Register: func(approvalID string) (<-chan agentservice.ToolApprovalDecision, func()) {
+			pending := &pendingToolApproval{decisions: make(chan agentservice.ToolApprovalDecision, 1)}
+			s.agentRunMu.Lock()
+			if run, ok := s.agentRuns[runID]; ok {
+				if run.approvals == nil {
+					run.approvals = map[string]*pendingToolApproval{}
+				}
+				run.approvals[approvalID] = pending
+			}
+			s.agentRunMu.Unlock()
+			release := func() {
+				s.agentRunMu.Lock()
+				defer s.agentRunMu.Unlock()
+				if run, ok := s.agentRuns[runID]; ok && run.approvals[approvalID] == pending {
+					delete(run.approvals, approvalID)
+				}
+			}
+			return pending.decisions, release
+		},
+	}
+}
+
+func (s *Server) approveAgentRun(w http.ResponseWriter, r *http.Request) {
+	s.resolveAgentRunApproval(w, r, true)
+}
+
+func (s *Server) rejectAgentRun(w http.ResponseWriter, r *http.Request) {
+	s.resolveAgentRunApproval(w, r, false)
+}
+
+// resolveAgentRunApproval answers one paused tool call. approval_id may be
+// omitted while the run has exactly one call waiting.
+func (s *Server) resolveAgentRunApproval(w http.ResponseWriter, r *http.Request, approved bool) {
+	runID := strings.TrimSpace(chi.URLParam(r, "run_id"))
+	// The body is optional: an empty POST answers the only waiting call.
+	var body agentRunApprovalRequest
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeErr(w, http.StatusBadRequest, "invalid_json", "invalid request body", nil)
+		return
+	}
+	if strings.TrimSpace(string(data)) != "" && !s.decodeRequestBytes(w, data, &body) {
+		return
+	}
+	approvalID := strings.TrimSpace(body.ApprovalID)
+
+	s.agentRunMu.Lock()
+	s.evictExpiredAgentRunsLocked(time.Now())
+	run, ok := s.agentRuns[runID]
+	if !ok {
+		s.agentRunMu.Unlock()
+		writeErr(w, http.StatusNotFound, "not_found", "agent run not found", map[string]string{"run_id": runID})
+		return
+	}
+	if run.done {
+		s.agentRunMu.Unlock()
+		writeErr(w, http.StatusConflict, "agent_run_finished", "agent run already finished", map[string]string{"run_id": runID})
+		return
+	}
+	if approvalID == "" {
+		if len(run.approvals) > 1 {
+			s.agentRunMu.Unlock()
+			writeErr(w, http.StatusBadRequest, "invalid_request", "approval_id is required when several tool calls are waiting", map[string]string{"run_id": runID})
+			return
+		}
+		for id := range run.approvals {
+			approvalID = id
+		}
+	}
+	pending, ok := run.approvals[approvalID]
+	if ok {
+		delete(run.approvals, approvalID)
+	}
+	s.agentRunMu.Unlock()
+	if !ok {
+		writeErr(w, http.StatusConflict, "no_pending_approval", "no tool call is waiting for approval", map[string]string{"run_id": runID, "approval_id": approvalID})
+		return
+	}
+	pending.decisions <- agentservice.ToolApprovalDecision{Approved: approved, Reason: strings.TrimSpace(body.Reason)}
+	writeJSON(w, http.StatusOK, agentRunApprovalResponse{RunID: runID, ApprovalID: approvalID, Approved: approved})
+}
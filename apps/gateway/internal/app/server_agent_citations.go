@@ -0,0 +1,108 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"nextai/apps/gateway/internal/domain"
+)
+
+const (
+	maxReplyCitations      = 10
+	citationsSectionHeader = "Sources:"
+)
+
+type citationCollectorContextKey struct{}
+
+// citationCollector gathers source links from tool results during one agent run.
+type citationCollector struct {
+	mu    sync.Mutex
+	items []domain.Citation
+	seen  map[string]struct{}
+}
+
+func withCitationCollector(ctx context.Context) (context.Context, *citationCollector) {
+	collector := &citationCollector{seen: map[string]struct{}{}}
+	return context.WithValue(ctx, citationCollectorContextKey{}, collector), collector
+}
+
+// recordToolCitations adds every http(s) "url" found in a tool result, with its
+// sibling "title" when present, to the collector carried by ctx.
+func recordToolCitations(ctx context.Context, result map[string]interface{}) {
+	if ctx == nil {
+		return
+	}
+	collector, ok := ctx.Value(citationCollectorContextKey{}).(*citationCollector)
+	if !ok || collector == nil {
+		return
+	}
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	collector.collect(result)
+}
+
+func (c *citationCollector) collect(value interface{}) {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		if rawURL, ok := typed["url"].(string); ok && isHTTPURL(rawURL) {
+			title, _ := typed["title"].(string)
+			c.add(domain.Citation{
+				Title: strings.TrimSpace(title),
+				URL:   strings.TrimSpace(rawURL),
+			})
+		}
+		for _, nested := range typed {
+			c.collect(nested)
+		}
+	case []interface{}:
+		for _, nested := range typed {
+			c.collect(nested)
+		}
+	}
+}
+
+func (c *citationCollector) add(citation domain.Citation) {
+	if len(c.items) >= maxReplyCitations {
+		return
+	}
+	if _, exists := c.seen[citation.URL]; exists {
+		return
+	}
+	c.seen[citation.URL] = struct{}{}
+	c.items = append(c.items, citation)
+}
+
+func (c *citationCollector) Citations() []domain.Citation {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]domain.Citation(nil), c.items...)
+}
+
+// formatCitationsSection renders citations as a numbered plain-text list.
+func formatCitationsSection(citations []domain.Citation) string {
+	if len(citations) == 0 {
+		return ""
+	}
+	lines := make([]string, 0, len(citations)+1)
+	lines = append(lines, citationsSectionHeader)
+	for idx, citation := range citations {
+		if citation.Title == "" {
+			lines = append(lines, fmt.Sprintf("%d. %s", idx+1, citation.URL))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%d. %s - %s", idx+1, citation.Title, citation.URL))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func lastAgentEventStep(events []domain.AgentEvent) int {
+	if len(events) == 0 {
+		return 1
+	}
+	return events[len(events)-1].Step
+}
@@ -0,0 +1,69 @@
+package app
+
+import (
+	"strings"
+
+	"nextai/apps/gateway/internal/domain"
+)
+
+const (
+	// inputBudgetWindowPercent is the share of the model's context window the
+	// prompt may use when the request sets no max_input_tokens; the rest is left
+	// for tool definitions and the reply.
+	inputBudgetWindowPercent = 75
+	// inputMessageTokenOverhead approximates per-message role/format tokens.
+	inputMessageTokenOverhead = 4
+)
+
+func resolveInputTokenBudget(requested int, contextWindow int) int {
+	if requested > 0 {
+		return requested
+	}
+	return contextWindow * inputBudgetWindowPercent / 100
+}
+
+// trimInputToTokenBudget drops the oldest non-system messages until the input
+// fits budget. System messages and the latest message are always kept, so the
+// result may still exceed a very small budget.
+func trimInputToTokenBudget(input []domain.AgentInputMessage, budget int) ([]domain.AgentInputMessage, int) {
+	if budget <= 0 || len(input) == 0 {
+		return input, 0
+	}
+	costs := make([]int, len(input))
+	total := 0
+	for i, msg := range input {
+		costs[i] = estimateAgentInputMessageTokens(msg)
+		total += costs[i]
+	}
+	if total <= budget {
+		return input, 0
+	}
+	drop := make([]bool, len(input))
+	dropped := 0
+	for i := 0; i < len(input)-1 && total > budget; i++ {
+		if strings.TrimSpace(input[i].Role) == "system" {
+			continue
+		}
+		drop[i] = true
+		dropped++
+		total -= costs[i]
+	}
+	if dropped == 0 {
+		return input, 0
+	}
+	out := make([]domain.AgentInputMessage, 0, len(input)-dropped)
+	for i, msg := range input {
+		if !drop[i] {
+			out = append(out, msg)
+		}
+	}
+	return out, dropped
+}
+
+func estimateAgentInputMessageTokens(msg domain.AgentInputMessage) int {
+	tokens := inputMessageTokenOverhead
+	for _, content := range msg.Content {
+		tokens += estimatePromptTokenCount(content.Text)
+	}
+	return tokens
+}
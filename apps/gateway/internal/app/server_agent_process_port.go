@@ -2,11 +2,16 @@ package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"strings"
+	"time"
 
 	"nextai/apps/gateway/internal/domain"
+	"nextai/apps/gateway/internal/observability"
+	"nextai/apps/gateway/internal/plugin"
 	"nextai/apps/gateway/internal/provider"
 	"nextai/apps/gateway/internal/repo"
 	"nextai/apps/gateway/internal/runner"
@@ -55,7 +60,37 @@ func (s *Server) processAgentCore(
 	}
 	req.Channel = channelName
 
-	if isContextResetCommand(req.Input) {
+	requestModel, hasRequestModel, err := parseRequestModelOverride(req.Model)
+	if err != nil {
+		return domain.AgentProcessResponse{}, &ports.AgentProcessError{
+			Status:  http.StatusBadRequest,
+			Code:    "invalid_model",
+			Message: err.Error(),
+		}
+	}
+	if hasRequestModel && !modelSlotPermitted(ctx, requestModel) {
+		return domain.AgentProcessResponse{}, &ports.AgentProcessError{
+			Status:  http.StatusForbidden,
+			Code:    "provider_not_permitted",
+			Message: "api key is not permitted to use this provider",
+		}
+	}
+	if req.MaxInputTokens < 0 {
+		return domain.AgentProcessResponse{}, &ports.AgentProcessError{
+			Status:  http.StatusBadRequest,
+			Code:    "invalid_request",
+			Message: "max_input_tokens must be >= 0",
+		}
+	}
+	if req.DryRun && streaming {
+		return domain.AgentProcessResponse{}, &ports.AgentProcessError{
+			Status:  http.StatusBadRequest,
+			Code:    "invalid_request",
+			Message: "dry_run is only supported for non-streaming requests",
+		}
+	}
+
+	if !req.DryRun && !req.Ephemeral && isContextResetCommand(req.Input) {
 		if err := s.clearChatContext(req.SessionID, req.UserID, req.Channel); err != nil {
 			return domain.AgentProcessResponse{}, &ports.AgentProcessError{
 				Status:  http.StatusInternalServerError,
@@ -64,7 +99,8 @@ func (s *Server) processAgentCore(
 			}
 		}
 		dispatchCfg := mergeChannelDispatchConfig(channelName, channelCfg, req.BizParams)
-		if err := channelPlugin.SendText(ctx, req.UserID, req.SessionID, contextResetReply, dispatchCfg); err != nil {
+		dispatch, err := dispatchChannelReply(ctx, channelPlugin, channelName, req.UserID, req.SessionID, []string{contextResetReply}, dispatchCfg)
+		if err != nil {
 			status, code, message := mapChannelError(&channelError{
 				Code:    "channel_dispatch_failed",
 				Message: fmt.Sprintf("failed to dispatch message to channel %q", channelName),
@@ -77,6 +113,7 @@ func (s *Server) processAgentCore(
 			}
 		}
 		resp := immediateAgentProcessResponse(contextResetReply)
+		resp.Dispatch = dispatch
 		if streaming && emit != nil {
 			for _, evt := range resp.Events {
 				emit(evt)
@@ -85,6 +122,27 @@ func (s *Server) processAgentCore(
 		return resp, nil
 	}
 
+	approvalTools, err := parseRequireApprovalTools(req.BizParams)
+	if err != nil {
+		return domain.AgentProcessResponse{}, &ports.AgentProcessError{
+			Status:  http.StatusBadRequest,
+			Code:    "invalid_request",
+			Message: err.Error(),
+		}
+	}
+	var toolApproval *agentservice.ToolApproval
+	if len(approvalTools) > 0 {
+		runID := agentRunIDFromContext(ctx)
+		if runID == "" {
+			return domain.AgentProcessResponse{}, &ports.AgentProcessError{
+				Status:  http.StatusBadRequest,
+				Code:    "invalid_request",
+				Message: "biz_params.require_approval is only supported on /agent/process",
+			}
+		}
+		toolApproval = s.agentToolApproval(runID, approvalTools)
+	}
+
 	requestPromptMode, hasRequestPromptMode, err := parsePromptModeFromBizParams(req.BizParams)
 	if err != nil {
 		return domain.AgentProcessResponse{}, &ports.AgentProcessError{
@@ -162,8 +220,37 @@ func (s *Server) processAgentCore(
 	chatID := ""
 	activeLLM := domain.ModelSlotConfig{}
 	providerSetting := repo.ProviderSetting{}
+	fallbackSlots := []fallbackModelSlot{}
 	historyInput := []domain.AgentInputMessage{}
-	if err := s.store.Write(func(state *repo.State) error {
+	chatSystemPrompt := ""
+	resolveActiveModel := func(state *repo.State, chatMeta map[string]interface{}) {
+		activeLLM = resolveChatActiveModelSlot(chatMeta, state)
+		if hasRequestModel {
+			activeLLM = requestModel
+		}
+		providerSetting = getProviderSettingByID(state, activeLLM.ProviderID)
+		fallbackSlots = resolveFallbackModelSlots(state, requestModel.Fallback)
+	}
+	contextSkills := []domain.SkillSpec{}
+	resolveContextSkills := func(state *repo.State, chat domain.ChatSpec) {
+		chatSkills, hasChatSkills := chatSkillSelectionFromMeta(chat.Meta)
+		contextSkills = selectContextSkills(state.Skills, req.Skills, chatSkills, hasChatSkills)
+	}
+	if req.Ephemeral {
+		historyInput = runtimeHistoryToAgentInputMessages(runtimeMessagesFromInput(req.Input))
+		s.store.Read(func(state *repo.State) {
+			resolveActiveModel(state, nil)
+			resolveContextSkills(state, domain.ChatSpec{})
+		})
+	} else if req.DryRun {
+		s.store.Read(func(state *repo.State) {
+			chatID, historyInput = previewDryRunHistory(state, req)
+			chat := state.Chats[chatID]
+			chatSystemPrompt = chatSystemPromptFromMeta(chat.Meta)
+			resolveActiveModel(state, chat.Meta)
+			resolveContextSkills(state, chat)
+		})
+	} else if err := s.store.Write(func(state *repo.State) error {
 		for id, c := range state.Chats {
 			if c.SessionID == req.SessionID && c.UserID == req.UserID && c.Channel == req.Channel {
 				chatID = id
@@ -219,8 +306,9 @@ func (s *Server) processAgentCore(
 		}
 		historyInput = runtimeHistoryToAgentInputMessages(state.Histories[chatID])
 		chatSpec := state.Chats[chatID]
-		activeLLM = resolveChatActiveModelSlot(chatSpec.Meta, state)
-		providerSetting = getProviderSettingByID(state, activeLLM.ProviderID)
+		chatSystemPrompt = chatSystemPromptFromMeta(chatSpec.Meta)
+		resolveActiveModel(state, chatSpec.Meta)
+		resolveContextSkills(state, chatSpec)
 		return nil
 	}); err != nil {
 		return domain.AgentProcessResponse{}, &ports.AgentProcessError{
@@ -230,6 +318,9 @@ func (s *Server) processAgentCore(
 		}
 	}
 
+	systemLayers = appendSkillLayers(systemLayers, contextSkills)
+	systemLayers = appendChatSystemPromptLayer(systemLayers, chatID, chatSystemPrompt)
+
 	toolRawRequest := rawRequest
 	if toolRawRequest == nil {
 		toolRawRequest = map[string]interface{}{}
@@ -255,44 +346,32 @@ func (s *Server) processAgentCore(
 	generateConfig := runner.GenerateConfig{
 		PromptCacheKey: req.SessionID,
 	}
+	var fallbackConfigs []runner.GenerateConfig
 	if !hasToolCall {
-		if activeLLM.ProviderID == "" || strings.TrimSpace(activeLLM.Model) == "" {
-			generateConfig = runner.GenerateConfig{
-				ProviderID:         runner.ProviderDemo,
-				Model:              "demo-chat",
-				AdapterID:          provider.AdapterDemo,
-				PromptCacheKey:     req.SessionID,
-				PreviousResponseID: latestProviderResponseIDFromInput(historyInput),
-			}
-		} else {
-			if !providerEnabled(providerSetting) {
-				return domain.AgentProcessResponse{}, &ports.AgentProcessError{
-					Status:  http.StatusBadRequest,
-					Code:    "provider_disabled",
-					Message: "active provider is disabled",
-				}
-			}
-			resolvedModel, ok := provider.ResolveModelID(activeLLM.ProviderID, activeLLM.Model, providerSetting.ModelAliases)
-			if !ok {
-				return domain.AgentProcessResponse{}, &ports.AgentProcessError{
-					Status:  http.StatusBadRequest,
-					Code:    "model_not_found",
-					Message: "active model is not available for provider",
-				}
+		var configErr *ports.AgentProcessError
+		generateConfig, configErr = s.buildModelGenerateConfig(activeLLM, providerSetting, hasRequestModel, req.SessionID, req.UserID)
+		if configErr != nil {
+			return domain.AgentProcessResponse{}, configErr
+		}
+		// The global or chat-pinned model is checked too, not only a request
+		// override; the local demo fallback needs no permission.
+		if generateConfig.ProviderID != runner.ProviderDemo && !observability.ProviderPermitted(ctx, generateConfig.ProviderID) {
+			return domain.AgentProcessResponse{}, &ports.AgentProcessError{
+				Status:  http.StatusForbidden,
+				Code:    "provider_not_permitted",
+				Message: "api key is not permitted to use this provider",
 			}
-			activeLLM.Model = resolvedModel
-			generateConfig = runner.GenerateConfig{
-				ProviderID:         activeLLM.ProviderID,
-				Model:              activeLLM.Model,
-				APIKey:             resolveProviderAPIKey(activeLLM.ProviderID, providerSetting),
-				BaseURL:            resolveProviderBaseURL(activeLLM.ProviderID, providerSetting),
-				AdapterID:          provider.ResolveAdapter(activeLLM.ProviderID),
-				Headers:            sanitizeStringMap(providerSetting.Headers),
-				TimeoutMS:          providerSetting.TimeoutMS,
-				ReasoningEffort:    providerSetting.ReasoningEffort,
-				Store:              providerStoreEnabled(providerSetting),
-				PromptCacheKey:     req.SessionID,
-				PreviousResponseID: latestProviderResponseIDFromInput(historyInput),
+		}
+		generateConfig.PreviousResponseID = latestProviderResponseIDFromInput(historyInput)
+		fallbackConfigs = s.buildFallbackGenerateConfigs(ctx, fallbackSlots, generateConfig, req.SessionID, req.UserID)
+		applyRequestParallelToolCalls(&generateConfig, req.ParallelToolCalls)
+		for i := range fallbackConfigs {
+			applyRequestParallelToolCalls(&fallbackConfigs[i], req.ParallelToolCalls)
+		}
+		if req.DryRun {
+			generateConfig.Store = false
+			for i := range fallbackConfigs {
+				fallbackConfigs[i].Store = false
 			}
 		}
 		if len(historyInput) > 0 {
@@ -300,6 +379,8 @@ func (s *Server) processAgentCore(
 		} else {
 			effectiveInput = prependSystemLayers(req.Input, systemLayers)
 		}
+		contextWindow := provider.ResolveContextWindow(generateConfig.ProviderID, generateConfig.Model, providerSetting.ModelContextWindows)
+		effectiveInput, _ = trimInputToTokenBudget(effectiveInput, resolveInputTokenBudget(req.MaxInputTokens, contextWindow))
 	}
 
 	completedEventMeta := buildCompletedModelRequestMeta(runtimeSnapshot.Mode.PromptMode, systemLayers, effectiveInput, generateConfig)
@@ -310,27 +391,55 @@ func (s *Server) processAgentCore(
 		}
 	}
 	toolDefinitions := s.listToolDefinitionsForTurnRuntime(runtimeSnapshot)
+	if !req.DryRun {
+		sendChannelTyping(ctx, channelPlugin, channelName, req.UserID, req.SessionID, mergeChannelDispatchConfig(channelName, channelCfg, req.BizParams))
+	}
 
+	// Approval waits pause the turn deadline and are bounded by their own
+	// timeout instead, so a slow human does not time out the turn.
+	deadline, cancelTurn := withTurnDeadline(ctx, s.agentProcessTimeout())
+	defer cancelTurn()
+	var turnCtx context.Context = deadline
+	if toolApproval != nil {
+		toolApproval.PauseDeadline = deadline.Pause
+	}
+	var citations *citationCollector
+	if s.cfg.AppendCitations {
+		turnCtx, citations = withCitationCollector(turnCtx)
+	}
 	processResult, processErr := s.getAgentService().Process(
-		withTurnRuntimeToolContext(ctx, runtimeSnapshot),
+		withTurnRuntimeToolContext(turnCtx, runtimeSnapshot),
 		agentservice.ProcessParams{
 			Request: req,
 			RequestedToolCall: agentservice.ToolCall{
 				Name:  requestedToolCall.Name,
 				Input: requestedToolCall.Input,
 			},
-			HasToolCall:       hasToolCall,
-			Streaming:         streaming,
-			ReplyChunkSize:    replyChunkSizeDefault,
-			GenerateConfig:    generateConfig,
-			EffectiveInput:    effectiveInput,
-			PromptMode:        runtimeSnapshot.Mode.PromptMode,
-			CollaborationMode: runtimeSnapshot.Mode.CollaborationMode,
-			ToolDefinitions:   toolDefinitions,
+			HasToolCall:          hasToolCall,
+			Streaming:            streaming,
+			ReplyChunkSize:       replyChunkSizeDefault,
+			GenerateConfig:       generateConfig,
+			FallbackConfigs:      fallbackConfigs,
+			EffectiveInput:       effectiveInput,
+			PromptMode:           runtimeSnapshot.Mode.PromptMode,
+			CollaborationMode:    runtimeSnapshot.Mode.CollaborationMode,
+			ToolDefinitions:      toolDefinitions,
+			MaxSteps:             s.cfg.MaxAgentSteps,
+			MaxRecoverySteps:     s.cfg.MaxRecoverySteps,
+			DryRun:               req.DryRun,
+			ExposeProviderErrors: s.cfg.DebugProviderErrors,
+			ToolApproval:         toolApproval,
 		},
 		emitEvent,
 	)
 	if processErr != nil {
+		// Dry runs leave no trace: no partial history and no channel notice.
+		if !req.DryRun && !req.Ephemeral && isPartialReplyErrorCode(processErr.Code) {
+			s.persistPartialAssistantReply(chatID, processResult, completedEventMeta, processErr)
+		}
+		if !req.DryRun && isProviderFailureCode(processErr.Code) {
+			s.dispatchProviderFailureReply(ctx, channelPlugin, channelName, channelCfg, req)
+		}
 		return domain.AgentProcessResponse{}, &ports.AgentProcessError{
 			Status:  processErr.Status,
 			Code:    processErr.Code,
@@ -340,6 +449,23 @@ func (s *Server) processAgentCore(
 	}
 	reply = processResult.Reply
 	events = withCompletedEventMetaForEvents(processResult.Events, completedEventMeta)
+	replyCitations := citations.Citations()
+	if section := formatCitationsSection(replyCitations); section != "" {
+		suffix := "\n\n" + section
+		reply += suffix
+		if streaming {
+			emitEvent(domain.AgentEvent{Type: "assistant_delta", Step: lastAgentEventStep(events), Delta: suffix})
+		}
+	}
+	if req.DryRun {
+		return domain.AgentProcessResponse{
+			Reply:      reply,
+			Events:     events,
+			Usage:      processResult.Usage,
+			StopReason: processResult.StopReason,
+			Citations:  replyCitations,
+		}, nil
+	}
 
 	assistant := domain.RuntimeMessage{
 		ID:      newID("msg"),
@@ -358,29 +484,39 @@ func (s *Server) processAgentCore(
 		assistant.Metadata = metadata
 	}
 
-	_ = s.store.Write(func(state *repo.State) error {
-		state.Histories[chatID] = append(state.Histories[chatID], assistant)
-		if runtimeSnapshot.Mode.MemoryTask && !hasToolCall {
-			memoryRolloutContents = serializeCodexMemoryRollout(state.Histories[chatID])
-		}
-		chat := state.Chats[chatID]
-		chat.UpdatedAt = nowISO()
-		if chat.Name == "New Chat" && len(req.Input) > 0 && len(req.Input[0].Content) > 0 {
-			first := strings.TrimSpace(req.Input[0].Content[0].Text)
-			if first != "" {
-				if len([]rune(first)) > 20 {
-					chat.Name = string([]rune(first)[:20])
-				} else {
-					chat.Name = first
+	if !req.Ephemeral {
+		firstUserText := ""
+		fallbackTitle := ""
+		_ = s.store.Write(func(state *repo.State) error {
+			state.Histories[chatID] = append(state.Histories[chatID], assistant)
+			if runtimeSnapshot.Mode.MemoryTask && !hasToolCall {
+				memoryRolloutContents = serializeCodexMemoryRollout(state.Histories[chatID])
+			}
+			chat := state.Chats[chatID]
+			chat.UpdatedAt = nowISO()
+			if chat.Name == "New Chat" && len(req.Input) > 0 && len(req.Input[0].Content) > 0 {
+				first := strings.TrimSpace(req.Input[0].Content[0].Text)
+				if first != "" {
+					if len([]rune(first)) > 20 {
+						chat.Name = string([]rune(first)[:20])
+					} else {
+						chat.Name = first
+					}
+					firstUserText = first
+					fallbackTitle = chat.Name
 				}
 			}
+			state.Chats[chatID] = chat
+			return nil
+		})
+		if s.cfg.AutoTitle && fallbackTitle != "" {
+			s.startChatAutoTitle(chatID, fallbackTitle, firstUserText, reply, generateConfig)
 		}
-		state.Chats[chatID] = chat
-		return nil
-	})
+	}
 
 	dispatchCfg := mergeChannelDispatchConfig(channelName, channelCfg, req.BizParams)
-	if err := channelPlugin.SendText(ctx, req.UserID, req.SessionID, reply, dispatchCfg); err != nil {
+	dispatch, err := dispatchChannelReply(ctx, channelPlugin, channelName, req.UserID, req.SessionID, channelReplyChunks(channelPlugin.Capabilities(), dispatchCfg, reply), dispatchCfg)
+	if err != nil {
 		status, code, message := mapChannelError(&channelError{
 			Code:    "channel_dispatch_failed",
 			Message: fmt.Sprintf("failed to dispatch message to channel %q", channelName),
@@ -393,23 +529,315 @@ func (s *Server) processAgentCore(
 		}
 	}
 
-	if runtimeSnapshot.Mode.MemoryTask && !hasToolCall {
+	if runtimeSnapshot.Mode.MemoryTask && !hasToolCall && !req.Ephemeral {
 		s.startCodexMemoryPipeline(req.SessionID, generateConfig, memoryRolloutContents)
 	}
 
 	return domain.AgentProcessResponse{
-		Reply:  reply,
-		Events: events,
+		Reply:        reply,
+		Events:       events,
+		Usage:        processResult.Usage,
+		StopReason:   processResult.StopReason,
+		Citations:    replyCitations,
+		Dispatch:     dispatch,
+		ProviderMeta: processResult.ProviderMeta,
 	}, nil
 }
 
+// isPartialReplyErrorCode reports errors after which the partial reply is kept.
+func isPartialReplyErrorCode(code string) bool {
+	switch code {
+	case agentservice.ErrorCodeMaxStepsExceeded, agentservice.ErrorCodeAgentTimeout, agentservice.ErrorCodeCancelled:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *Server) agentProcessTimeout() time.Duration {
+	if s.cfg.AgentTimeoutMS > 0 {
+		return time.Duration(s.cfg.AgentTimeoutMS) * time.Millisecond
+	}
+	return defaultAgentProcessTimeout
+}
+
+func (s *Server) toolApprovalTimeout() time.Duration {
+	if s.cfg.ToolApprovalTimeoutMS > 0 {
+		return time.Duration(s.cfg.ToolApprovalTimeoutMS) * time.Millisecond
+	}
+	return defaultToolApprovalTimeout
+}
+
+// persistPartialAssistantReply keeps the text and tool events of an aborted
+// turn in history so the user can see how far the agent got.
+func (s *Server) persistPartialAssistantReply(
+	chatID string,
+	result agentservice.ProcessResult,
+	completedEventMeta map[string]interface{},
+	processErr *agentservice.ProcessError,
+) {
+	events := withCompletedEventMetaForEvents(result.Events, completedEventMeta)
+	events = append(events, domain.AgentEvent{
+		Type: "error",
+		Meta: map[string]interface{}{
+			"code":    processErr.Code,
+			"message": processErr.Message,
+		},
+	})
+	text := strings.TrimSpace(result.Reply)
+	if text == "" {
+		text = processErr.Message
+	}
+	assistant := domain.RuntimeMessage{
+		ID:      newID("msg"),
+		Role:    "assistant",
+		Type:    "message",
+		Content: []domain.RuntimeContent{{Type: "text", Text: text}},
+	}
+	if metadata := buildAssistantMessageMetadata(events); len(metadata) > 0 {
+		assistant.Metadata = metadata
+	}
+	if err := s.store.Write(func(state *repo.State) error {
+		if _, ok := state.Chats[chatID]; !ok {
+			return nil
+		}
+		state.Histories[chatID] = append(state.Histories[chatID], assistant)
+		chat := state.Chats[chatID]
+		chat.UpdatedAt = nowISO()
+		state.Chats[chatID] = chat
+		return nil
+	}); err != nil {
+		log.Printf("persist partial assistant reply failed: chat=%s err=%v", chatID, err)
+	}
+}
+
+// dispatchProviderFailureReply notifies the channel end user when the provider
+// call fails. The API caller still receives the original error.
+func (s *Server) dispatchProviderFailureReply(
+	ctx context.Context,
+	channelPlugin plugin.ChannelPlugin,
+	channelName string,
+	channelCfg map[string]interface{},
+	req domain.AgentProcessRequest,
+) {
+	text := strings.TrimSpace(s.cfg.ProviderFailureReply)
+	if text == "" || channelPlugin == nil {
+		return
+	}
+	dispatchCfg := mergeChannelDispatchConfig(channelName, channelCfg, req.BizParams)
+	if err := sendChannelText(ctx, channelPlugin, channelName, req.UserID, req.SessionID, text, dispatchCfg); err != nil {
+		observability.IncChannelDispatchFailure(channelName)
+		log.Printf("provider failure reply dispatch failed: channel=%s err=%v", channelName, err)
+	}
+}
+
+// parseRequestModelOverride validates the optional per-request model. When
+// present it takes precedence over the chat override and the global active slot.
+func parseRequestModelOverride(raw *domain.ModelSlotConfig) (domain.ModelSlotConfig, bool, error) {
+	if raw == nil {
+		return domain.ModelSlotConfig{}, false, nil
+	}
+	providerID := normalizeProviderID(raw.ProviderID)
+	modelID := strings.TrimSpace(raw.Model)
+	if providerID == "" || modelID == "" {
+		return domain.ModelSlotConfig{}, false, errors.New("model.provider_id and model.model are required")
+	}
+	out := domain.ModelSlotConfig{ProviderID: providerID, Model: modelID}
+	for i, slot := range raw.Fallback {
+		fallbackProviderID := normalizeProviderID(slot.ProviderID)
+		fallbackModelID := strings.TrimSpace(slot.Model)
+		if fallbackProviderID == "" || fallbackModelID == "" {
+			return domain.ModelSlotConfig{}, false, fmt.Errorf("model.fallback[%d] requires provider_id and model", i)
+		}
+		out.Fallback = append(out.Fallback, domain.ModelSlotConfig{ProviderID: fallbackProviderID, Model: fallbackModelID})
+	}
+	return out, true, nil
+}
+
+// fallbackModelSlot pairs a fallback slot with its provider settings, read in
+// the same store pass as the primary slot.
+type fallbackModelSlot struct {
+	slot    domain.ModelSlotConfig
+	setting repo.ProviderSetting
+}
+
+// resolveFallbackModelSlots returns the fallback chain for a request: the
+// per-request model.fallback when given, else the one saved on active_llm.
+func resolveFallbackModelSlots(state *repo.State, requested []domain.ModelSlotConfig) []fallbackModelSlot {
+	slots := requested
+	if len(slots) == 0 && state != nil {
+		slots = state.ActiveLLM.Fallback
+	}
+	out := make([]fallbackModelSlot, 0, len(slots))
+	for _, slot := range slots {
+		providerID := normalizeProviderID(slot.ProviderID)
+		setting, ok := findProviderSettingByID(state, providerID)
+		if !ok {
+			continue
+		}
+		out = append(out, fallbackModelSlot{
+			slot:    domain.ModelSlotConfig{ProviderID: providerID, Model: strings.TrimSpace(slot.Model)},
+			setting: setting,
+		})
+	}
+	return out
+}
+
+// modelSlotPermitted reports whether the caller's API key may use the slot's
+// provider and every provider in its fallback chain.
+// Empty provider IDs, as sent when clearing a slot, are not checked.
+func modelSlotPermitted(ctx context.Context, slot domain.ModelSlotConfig) bool {
+	providerIDs := []string{slot.ProviderID}
+	for _, fallback := range slot.Fallback {
+		providerIDs = append(providerIDs, fallback.ProviderID)
+	}
+	for _, providerID := range providerIDs {
+		if strings.TrimSpace(providerID) != "" && !observability.ProviderPermitted(ctx, providerID) {
+			return false
+		}
+	}
+	return true
+}
+
+// applyRequestParallelToolCalls applies a request's parallel_tool_calls
+// override; only OpenAI-compatible adapters send the field.
+func applyRequestParallelToolCalls(cfg *runner.GenerateConfig, override *bool) {
+	if override == nil || cfg.AdapterID != provider.AdapterOpenAICompatible {
+		return
+	}
+	parallel := *override
+	cfg.ParallelToolCalls = &parallel
+}
+
+// buildFallbackGenerateConfigs turns the fallback chain into provider configs,
+// skipping disabled providers, unknown models, providers the caller's API key
+// may not use and the primary slot itself.
+func (s *Server) buildFallbackGenerateConfigs(ctx context.Context, slots []fallbackModelSlot, primary runner.GenerateConfig, sessionID string, userID string) []runner.GenerateConfig {
+	if primary.ProviderID == runner.ProviderDemo {
+		return nil
+	}
+	out := make([]runner.GenerateConfig, 0, len(slots))
+	for _, item := range slots {
+		cfg, err := s.buildModelGenerateConfig(item.slot, item.setting, false, sessionID, userID)
+		if err != nil || cfg.ProviderID == runner.ProviderDemo || !observability.ProviderPermitted(ctx, cfg.ProviderID) {
+			continue
+		}
+		if cfg.ProviderID == primary.ProviderID && cfg.Model == primary.Model {
+			continue
+		}
+		out = append(out, cfg)
+	}
+	return out
+}
+
+// previewDryRunHistory returns the chat a request would land in and its history
+// with the request input appended, without modifying state.
+func previewDryRunHistory(state *repo.State, req domain.AgentProcessRequest) (string, []domain.AgentInputMessage) {
+	chatID := ""
+	for id, c := range state.Chats {
+		if c.SessionID == req.SessionID && c.UserID == req.UserID && c.Channel == req.Channel {
+			chatID = id
+			break
+		}
+	}
+	history := append([]domain.RuntimeMessage{}, state.Histories[chatID]...)
+	history = append(history, runtimeMessagesFromInput(req.Input)...)
+	return chatID, runtimeHistoryToAgentInputMessages(history)
+}
+
+// runtimeMessagesFromInput converts request input into unsaved history messages.
+func runtimeMessagesFromInput(input []domain.AgentInputMessage) []domain.RuntimeMessage {
+	out := make([]domain.RuntimeMessage, 0, len(input))
+	for _, msg := range input {
+		out = append(out, domain.RuntimeMessage{
+			Role:    msg.Role,
+			Type:    msg.Type,
+			Content: toRuntimeContents(msg.Content),
+		})
+	}
+	return out
+}
+
+// buildModelGenerateConfig resolves the provider call settings for a model
+// slot, falling back to the demo provider when no model is configured.
+func (s *Server) buildModelGenerateConfig(
+	activeLLM domain.ModelSlotConfig,
+	providerSetting repo.ProviderSetting,
+	requested bool,
+	sessionID string,
+	userID string,
+) (runner.GenerateConfig, *ports.AgentProcessError) {
+	if activeLLM.ProviderID == "" || strings.TrimSpace(activeLLM.Model) == "" {
+		return runner.GenerateConfig{
+			ProviderID:     runner.ProviderDemo,
+			Model:          "demo-chat",
+			AdapterID:      provider.AdapterDemo,
+			PromptCacheKey: sessionID,
+		}, nil
+	}
+	if !providerEnabled(providerSetting) {
+		return runner.GenerateConfig{}, &ports.AgentProcessError{
+			Status:  http.StatusBadRequest,
+			Code:    "provider_disabled",
+			Message: modelSlotLabel(requested) + " provider is disabled",
+		}
+	}
+	resolvedModel, ok := provider.ResolveModelID(activeLLM.ProviderID, activeLLM.Model, providerSetting.ModelAliases)
+	if !ok {
+		return runner.GenerateConfig{}, &ports.AgentProcessError{
+			Status:  http.StatusBadRequest,
+			Code:    "model_not_found",
+			Message: modelSlotLabel(requested) + " model is not available for provider",
+		}
+	}
+	return runner.GenerateConfig{
+		ProviderID:        activeLLM.ProviderID,
+		Model:             resolvedModel,
+		APIKey:            s.resolveProviderAPIKey(activeLLM.ProviderID, providerSetting),
+		BaseURL:           resolveProviderBaseURL(activeLLM.ProviderID, providerSetting),
+		AdapterID:         provider.ResolveAdapter(activeLLM.ProviderID),
+		Headers:           sanitizeStringMap(providerSetting.Headers),
+		TimeoutMS:         providerSetting.TimeoutMS,
+		ReasoningEffort:   providerSetting.ReasoningEffort,
+		Store:             providerStoreEnabled(providerSetting),
+		PromptCacheKey:    sessionID,
+		EndUserID:         resolveProviderEndUserID(providerSetting, userID),
+		CompressRequests:  providerSetting.CompressRequests,
+		StreamUsage:       providerSetting.StreamUsage,
+		ParallelToolCalls: providerSetting.ParallelToolCalls,
+		Temperature:       providerSetting.Temperature,
+		MaxTokens:         providerSetting.MaxTokens,
+	}, nil
+}
+
+func modelSlotLabel(requested bool) string {
+	if requested {
+		return "requested"
+	}
+	return "active"
+}
+
+func isProviderFailureCode(code string) bool {
+	switch code {
+	case runner.ErrorCodeProviderNotConfigured,
+		runner.ErrorCodeProviderNotSupported,
+		runner.ErrorCodeProviderRequestFailed,
+		runner.ErrorCodeProviderInvalidReply,
+		"runner_error":
+		return true
+	default:
+		return false
+	}
+}
+
 func immediateAgentProcessResponse(reply string) domain.AgentProcessResponse {
 	return domain.AgentProcessResponse{
 		Reply: reply,
 		Events: []domain.AgentEvent{
 			{Type: "step_started", Step: 1},
 			{Type: "assistant_delta", Step: 1, Delta: reply},
-			{Type: "completed", Step: 1, Reply: reply},
+			{Type: "completed", Step: 1, Reply: reply, StopReason: domain.StopReasonNormal},
 		},
+		StopReason: domain.StopReasonNormal,
 	}
 }
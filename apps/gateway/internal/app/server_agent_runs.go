@@ -0,0 +1,218 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"nextai/apps/gateway/internal/domain"
+)
+
+const agentRunRetention = 5 * time.Minute
+
+// agentRunRecord keeps the events already streamed for one /agent/process run
+// so a client whose SSE connection dropped can fetch what it missed.
+// Non-streaming runs keep their events too, so a run that paused for a tool
+// approval and answered 202 can be followed to its end.
+type agentRunRecord struct {
+	userID     string
+	sessionID  string
+	channel    string
+	streaming  bool
+	startedAt  time.Time
+	events     []domain.AgentEvent
+	done       bool
+	finishedAt time.Time
+	// cancel stops the context driving the run; it is dropped once the run finishes.
+	cancel context.CancelFunc
+	// approvals holds the tool calls paused by biz_params.require_approval, by approval ID.
+	approvals map[string]*pendingToolApproval
+}
+
+type agentRunEventsResponse struct {
+	RunID  string              `json:"run_id"`
+	Done   bool                `json:"done"`
+	Events []domain.AgentEvent `json:"events"`
+}
+
+type agentRunCancelResponse struct {
+	RunID     string `json:"run_id"`
+	Cancelled bool   `json:"cancelled"`
+}
+
+type agentRunInfo struct {
+	RunID     string `json:"run_id"`
+	UserID    string `json:"user_id"`
+	SessionID string `json:"session_id"`
+	Channel   string `json:"channel"`
+	Stream    bool   `json:"stream"`
+	StartedAt string `json:"started_at"`
+}
+
+type agentRunListResponse struct {
+	UserID string         `json:"user_id"`
+	Runs   []agentRunInfo `json:"runs"`
+}
+
+type agentRunBulkCancelResponse struct {
+	UserID    string   `json:"user_id"`
+	Cancelled int      `json:"cancelled"`
+	RunIDs    []string `json:"run_ids"`
+}
+
+func (s *Server) startAgentRun(req domain.AgentProcessRequest, cancel context.CancelFunc) string {
+	runID := newID("run")
+	now := time.Now()
+	s.agentRunMu.Lock()
+	defer s.agentRunMu.Unlock()
+	s.evictExpiredAgentRunsLocked(now)
+	if s.agentRuns == nil {
+		s.agentRuns = map[string]*agentRunRecord{}
+	}
+	s.agentRuns[runID] = &agentRunRecord{
+		userID:    strings.TrimSpace(req.UserID),
+		sessionID: strings.TrimSpace(req.SessionID),
+		channel:   req.Channel,
+		streaming: req.Stream,
+		startedAt: now,
+		events:    []domain.AgentEvent{},
+		cancel:    cancel,
+	}
+	return runID
+}
+
+func (s *Server) appendAgentRunEvent(runID string, evt domain.AgentEvent) {
+	s.agentRunMu.Lock()
+	defer s.agentRunMu.Unlock()
+	if run, ok := s.agentRuns[runID]; ok && !run.done {
+		run.events = append(run.events, evt)
+	}
+}
+
+func (s *Server) finishAgentRun(runID string) {
+	s.agentRunMu.Lock()
+	defer s.agentRunMu.Unlock()
+	if run, ok := s.agentRuns[runID]; ok && !run.done {
+		run.done = true
+		run.finishedAt = time.Now()
+		run.cancel = nil
+	}
+}
+
+func (s *Server) evictExpiredAgentRunsLocked(now time.Time) {
+	for runID, run := range s.agentRuns {
+		if run.done && now.Sub(run.finishedAt) > agentRunRetention {
+			delete(s.agentRuns, runID)
+		}
+	}
+}
+
+func (s *Server) getAgentRunEvents(w http.ResponseWriter, r *http.Request) {
+	runID := strings.TrimSpace(chi.URLParam(r, "run_id"))
+	s.agentRunMu.Lock()
+	s.evictExpiredAgentRunsLocked(time.Now())
+	run, ok := s.agentRuns[runID]
+	var out agentRunEventsResponse
+	if ok {
+		out = agentRunEventsResponse{
+			RunID:  runID,
+			Done:   run.done,
+			Events: append([]domain.AgentEvent(nil), run.events...),
+		}
+	}
+	s.agentRunMu.Unlock()
+	if !ok {
+		writeErr(w, http.StatusNotFound, "not_found", "agent run not found", map[string]string{"run_id": runID})
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) cancelAgentRun(w http.ResponseWriter, r *http.Request) {
+	runID := strings.TrimSpace(chi.URLParam(r, "run_id"))
+	s.agentRunMu.Lock()
+	s.evictExpiredAgentRunsLocked(time.Now())
+	run, ok := s.agentRuns[runID]
+	var cancel context.CancelFunc
+	done := false
+	if ok {
+		cancel, done = run.cancel, run.done
+	}
+	s.agentRunMu.Unlock()
+	if !ok {
+		writeErr(w, http.StatusNotFound, "not_found", "agent run not found", map[string]string{"run_id": runID})
+		return
+	}
+	if done || cancel == nil {
+		writeErr(w, http.StatusConflict, "agent_run_finished", "agent run already finished", map[string]string{"run_id": runID})
+		return
+	}
+	cancel()
+	writeJSON(w, http.StatusOK, agentRunCancelResponse{RunID: runID, Cancelled: true})
+}
+
+// inFlightAgentRunsLocked returns the unfinished runs of userID, oldest first.
+func (s *Server) inFlightAgentRunsLocked(userID string) []string {
+	runIDs := []string{}
+	for runID, run := range s.agentRuns {
+		if !run.done && run.userID == userID {
+			runIDs = append(runIDs, runID)
+		}
+	}
+	sort.Slice(runIDs, func(i, j int) bool {
+		a, b := s.agentRuns[runIDs[i]], s.agentRuns[runIDs[j]]
+		if !a.startedAt.Equal(b.startedAt) {
+			return a.startedAt.Before(b.startedAt)
+		}
+		return runIDs[i] < runIDs[j]
+	})
+	return runIDs
+}
+
+func (s *Server) listUserAgentRuns(w http.ResponseWriter, r *http.Request) {
+	userID := strings.TrimSpace(r.URL.Query().Get("user_id"))
+	if userID == "" {
+		writeErr(w, http.StatusBadRequest, "invalid_request", "user_id is required", nil)
+		return
+	}
+	s.agentRunMu.Lock()
+	out := agentRunListResponse{UserID: userID, Runs: []agentRunInfo{}}
+	for _, runID := range s.inFlightAgentRunsLocked(userID) {
+		run := s.agentRuns[runID]
+		out.Runs = append(out.Runs, agentRunInfo{
+			RunID:     runID,
+			UserID:    run.userID,
+			SessionID: run.sessionID,
+			Channel:   run.channel,
+			Stream:    run.streaming,
+			StartedAt: run.startedAt.UTC().Format(time.RFC3339),
+		})
+	}
+	s.agentRunMu.Unlock()
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) cancelUserAgentRuns(w http.ResponseWriter, r *http.Request) {
+	userID := strings.TrimSpace(r.URL.Query().Get("user_id"))
+	if userID == "" {
+		writeErr(w, http.StatusBadRequest, "invalid_request", "user_id is required", nil)
+		return
+	}
+	s.agentRunMu.Lock()
+	runIDs := s.inFlightAgentRunsLocked(userID)
+	cancels := make([]context.CancelFunc, 0, len(runIDs))
+	for _, runID := range runIDs {
+		if cancel := s.agentRuns[runID].cancel; cancel != nil {
+			cancels = append(cancels, cancel)
+		}
+	}
+	s.agentRunMu.Unlock()
+	for _, cancel := range cancels {
+		cancel()
+	}
+	writeJSON(w, http.StatusOK, agentRunBulkCancelResponse{UserID: userID, Cancelled: len(runIDs), RunIDs: runIDs})
+}
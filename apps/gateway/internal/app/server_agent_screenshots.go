@@ -0,0 +1,43 @@
+package app
+
+import (
+	"context"
+	"strings"
+
+	"nextai/apps/gateway/internal/domain"
+	agentservice "nextai/apps/gateway/internal/service/agent"
+)
+
+// recordToolScreenshot forwards the last screenshot found in a tool result to
+// the tool_result event. Batch results nest one entry per item under
+// "results", and approx routing wraps the browser result under "result".
+func recordToolScreenshot(ctx context.Context, result map[string]interface{}) {
+	if shot, ok := findToolScreenshot(result); ok {
+		agentservice.RecordToolScreenshot(ctx, shot)
+	}
+}
+
+func findToolScreenshot(result map[string]interface{}) (domain.AgentToolScreenshot, bool) {
+	var found domain.AgentToolScreenshot
+	ok := false
+	if nested, isMap := result["result"].(map[string]interface{}); isMap {
+		found, ok = findToolScreenshot(nested)
+	}
+	if items, isList := result["results"].([]interface{}); isList {
+		for _, item := range items {
+			if entry, isMap := item.(map[string]interface{}); isMap {
+				if shot, hasShot := findToolScreenshot(entry); hasShot {
+					found, ok = shot, true
+				}
+			}
+		}
+	}
+	shot := domain.AgentToolScreenshot{
+		Path:   strings.TrimSpace(stringValue(result["screenshot_path"])),
+		Base64: strings.TrimSpace(stringValue(result["screenshot_base64"])),
+	}
+	if shot.Path != "" || shot.Base64 != "" {
+		return shot, true
+	}
+	return found, ok
+}
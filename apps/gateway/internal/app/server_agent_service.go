@@ -3,6 +3,7 @@ package app
 import (
 	"context"
 
+	"nextai/apps/gateway/internal/domain"
 	"nextai/apps/gateway/internal/runner"
 	"nextai/apps/gateway/internal/service/adapters"
 	agentservice "nextai/apps/gateway/internal/service/agent"
@@ -18,7 +19,19 @@ func (s *Server) getAgentService() *agentservice.Service {
 
 func (s *Server) newAgentService() *agentservice.Service {
 	return agentservice.NewService(agentservice.Dependencies{
-		Runner: adapters.AgentRunner{Runner: s.runner},
+		Runner: adapters.AgentRunner{
+			Runner: s.runner,
+			GenerateTurnFunc: func(ctx context.Context, req domain.AgentProcessRequest, cfg runner.GenerateConfig, tools []runner.ToolDefinition) (runner.TurnResult, error) {
+				turn, err := s.runner.GenerateTurn(ctx, req, cfg, tools)
+				s.noteProviderAPIKeyFailure(cfg, err)
+				return turn, err
+			},
+			GenerateTurnStreamFunc: func(ctx context.Context, req domain.AgentProcessRequest, cfg runner.GenerateConfig, tools []runner.ToolDefinition, onDelta func(string)) (runner.TurnResult, error) {
+				turn, err := s.runner.GenerateTurnStream(ctx, req, cfg, tools, onDelta)
+				s.noteProviderAPIKeyFailure(cfg, err)
+				return turn, err
+			},
+		},
 		ToolRuntime: adapters.AgentToolRuntime{
 			ListToolDefinitionsFunc: func(promptMode string) []runner.ToolDefinition {
 				return s.listToolDefinitionsForPromptMode(promptMode)
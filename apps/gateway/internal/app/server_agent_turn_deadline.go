@@ -0,0 +1,106 @@
+package app
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// turnDeadline is the agent turn timeout. Unlike context.WithTimeout it can
+// be paused, so time spent waiting on a human approval does not count
+// against the turn. Once it fires, Err reports context.DeadlineExceeded like
+// a regular deadline.
+type turnDeadline struct {
+	parent context.Context
+	inner  context.Context
+	cancel context.CancelFunc
+
+	mu        sync.Mutex
+	timer     *time.Timer
+	deadline  time.Time
+	remaining time.Duration
+	pauses    int
+	expired   bool
+}
+
+func withTurnDeadline(parent context.Context, timeout time.Duration) (*turnDeadline, context.CancelFunc) {
+	inner, cancel := context.WithCancel(parent)
+	d := &turnDeadline{
+		parent:   parent,
+		inner:    inner,
+		cancel:   cancel,
+		deadline: time.Now().Add(timeout),
+	}
+	d.timer = time.AfterFunc(timeout, d.expire)
+	return d, func() {
+		d.mu.Lock()
+		d.timer.Stop()
+		d.mu.Unlock()
+		cancel()
+	}
+}
+
+func (d *turnDeadline) expire() {
+	d.mu.Lock()
+	if d.pauses > 0 {
+		d.mu.Unlock()
+		return
+	}
+	d.expired = true
+	d.mu.Unlock()
+	d.cancel()
+}
+
+// Pause stops the clock until the returned func is called. Pauses nest.
+func (d *turnDeadline) Pause() func() {
+	d.mu.Lock()
+	if d.pauses == 0 && !d.expired && d.timer.Stop() {
+		d.remaining = time.Until(d.deadline)
+	}
+	d.pauses++
+	d.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			d.pauses--
+			if d.pauses > 0 || d.expired || d.inner.Err() != nil {
+				return
+			}
+			d.deadline = time.Now().Add(d.remaining)
+			d.timer.Reset(d.remaining)
+		})
+	}
+}
+
+func (d *turnDeadline) Deadline() (time.Time, bool) {
+	return d.parent.Deadline()
+}
+
+func (d *turnDeadline) Done() <-chan struct{} {
+	return d.inner.Done()
+}
+
+func (d *turnDeadline) Err() error {
+	err := d.inner.Err()
+	if err == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.expired {
+		return context.DeadlineExceeded
+	}
+	if parentErr := d.parent.Err(); parentErr != nil {
+		return parentErr
+	}
+	return err
+}
+
+// Value deliberately skips inner so derived contexts watch Done and read Err
+// from the turn deadline instead of attaching to the inner cancel context.
+func (d *turnDeadline) Value(key any) any {
+	return d.parent.Value(key)
+}
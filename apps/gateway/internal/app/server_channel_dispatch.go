@@ -0,0 +1,171 @@
+package app
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"strings"
+	"time"
+
+	"nextai/apps/gateway/internal/channel"
+	"nextai/apps/gateway/internal/domain"
+	"nextai/apps/gateway/internal/observability"
+	"nextai/apps/gateway/internal/plugin"
+)
+
+const (
+	channelDispatchDefaultBackoff = 500 * time.Millisecond
+	channelDispatchMaxBackoff     = 30 * time.Second
+	channelDispatchRetryLimit     = 10
+)
+
+// sendChannelText applies the channel's transform text rules and calls
+// SendText. When the channel sets
+// dispatch_max_retries, retries network, 429 and 5xx failures with
+// exponential backoff plus jitter, starting at dispatch_backoff_ms.
+func sendChannelText(
+	ctx context.Context,
+	channelPlugin plugin.ChannelPlugin,
+	channelName string,
+	userID string,
+	sessionID string,
+	text string,
+	cfg map[string]interface{},
+) error {
+	maxRetries, _ := parsePositiveIntAny(cfg["dispatch_max_retries"])
+	if maxRetries > channelDispatchRetryLimit {
+		maxRetries = channelDispatchRetryLimit
+	}
+	text = channelTransformText(cfg, text)
+	backoff := channelDispatchDefaultBackoff
+	if ms, ok := parsePositiveIntAny(cfg["dispatch_backoff_ms"]); ok {
+		backoff = time.Duration(ms) * time.Millisecond
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := channelPlugin.SendText(ctx, userID, sessionID, text, cfg)
+		if err == nil {
+			if attempt > 1 {
+				log.Printf("channel dispatch succeeded: channel=%s attempt=%d", channelName, attempt)
+			}
+			return nil
+		}
+		if attempt > maxRetries || !channel.IsRetryable(err) || ctx.Err() != nil {
+			return err
+		}
+		delay := backoff + time.Duration(rand.Int63n(int64(backoff)/2+1))
+		log.Printf("channel dispatch failed: channel=%s attempt=%d/%d retry_in=%s err=%v", channelName, attempt, maxRetries+1, delay, err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+		if backoff < channelDispatchMaxBackoff {
+			backoff *= 2
+			if backoff > channelDispatchMaxBackoff {
+				backoff = channelDispatchMaxBackoff
+			}
+		}
+	}
+}
+
+// channelTransformRules returns the channel's transform object, e.g.
+// {"prefix": "[bot] ", "suffix": "", "fields": {"url": "reply_url"}}. Field
+// mappings are resolved by mergeChannelDispatchConfig.
+func channelTransformRules(cfg map[string]interface{}) map[string]interface{} {
+	rules, _ := cfg["transform"].(map[string]interface{})
+	return rules
+}
+
+// channelTransformText wraps text in the configured transform prefix and
+// suffix.
+func channelTransformText(cfg map[string]interface{}, text string) string {
+	rules := channelTransformRules(cfg)
+	if len(rules) == 0 {
+		return text
+	}
+	return stringValue(rules["prefix"]) + text + stringValue(rules["suffix"])
+}
+
+// dispatchChannelReply sends chunks in order and reports the delivery. A
+// failure is returned as an error unless the channel sets dispatch_best_effort,
+// in which case it is recorded on the receipt and the request still succeeds.
+func dispatchChannelReply(
+	ctx context.Context,
+	channelPlugin plugin.ChannelPlugin,
+	channelName string,
+	userID string,
+	sessionID string,
+	chunks []string,
+	cfg map[string]interface{},
+) (*domain.Dispatch, error) {
+	receipt := &domain.Dispatch{
+		Channel:  channelName,
+		TargetID: channelDispatchTargetID(channelName, userID, cfg),
+	}
+	for _, chunk := range chunks {
+		if err := sendChannelText(ctx, channelPlugin, channelName, userID, sessionID, chunk, cfg); err != nil {
+			observability.IncChannelDispatchFailure(channelName)
+			if !parseBool(cfg["dispatch_best_effort"]) {
+				return nil, err
+			}
+			log.Printf("channel dispatch failed, continuing (best effort): channel=%s err=%v", channelName, err)
+			receipt.Error = err.Error()
+			return receipt, nil
+		}
+		receipt.Chunks++
+	}
+	receipt.Delivered = true
+	return receipt, nil
+}
+
+// dispatchCronText delivers a cron text job to a non-console channel the way
+// an agent reply is delivered: dispatch config, chunking, transform rules,
+// retries and dispatch_best_effort all apply.
+func (s *Server) dispatchCronText(ctx context.Context, channelName string, userID string, sessionID string, text string) error {
+	channelPlugin, channelCfg, resolvedChannelName, err := s.resolveChannel(channelName)
+	if err != nil {
+		return err
+	}
+	dispatchCfg := mergeChannelDispatchConfig(resolvedChannelName, channelCfg, nil)
+	chunks := channelReplyChunks(channelPlugin.Capabilities(), dispatchCfg, text)
+	_, err = dispatchChannelReply(ctx, channelPlugin, resolvedChannelName, userID, sessionID, chunks, dispatchCfg)
+	return err
+}
+
+// channelDispatchTargetID names the recipient a channel delivers to: the
+// configured target (QQ target_id, Slack channel_id) or the requesting user.
+func channelDispatchTargetID(channelName string, userID string, cfg map[string]interface{}) string {
+	if channelName == "slack" {
+		return strings.TrimSpace(stringValue(cfg["channel_id"]))
+	}
+	if targetID := strings.TrimSpace(stringValue(cfg["target_id"])); targetID != "" {
+		return targetID
+	}
+	return strings.TrimSpace(userID)
+}
+
+// sendChannelTyping shows a typing indicator when the channel sets
+// typing_indicator and its plugin reports the Typing capability. The indicator
+// is cosmetic, so failures are only logged.
+func sendChannelTyping(
+	ctx context.Context,
+	channelPlugin plugin.ChannelPlugin,
+	channelName string,
+	userID string,
+	sessionID string,
+	cfg map[string]interface{},
+) {
+	if !channelPlugin.Capabilities().Typing || !parseBool(cfg["typing_indicator"]) {
+		return
+	}
+	indicator, ok := channelPlugin.(plugin.ChannelTypingIndicator)
+	if !ok {
+		return
+	}
+	if err := indicator.SendTyping(ctx, userID, sessionID, cfg); err != nil {
+		log.Printf("channel typing indicator failed: channel=%s err=%v", channelName, err)
+	}
+}
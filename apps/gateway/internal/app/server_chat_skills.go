@@ -0,0 +1,125 @@
+package app
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"nextai/apps/gateway/internal/domain"
+	systempromptservice "nextai/apps/gateway/internal/service/systemprompt"
+)
+
+// chatSkillSelectionFromMeta returns the skill names stored on a chat. The
+// second result is false when the chat has no selection, in which case every
+// enabled skill applies; an empty selection turns skills off for the chat.
+func chatSkillSelectionFromMeta(meta map[string]interface{}) ([]string, bool) {
+	if meta == nil {
+		return nil, false
+	}
+	raw, ok := meta[chatMetaSkillsKey]
+	if !ok || raw == nil {
+		return nil, false
+	}
+	names, err := parseSkillNames(raw)
+	if err != nil {
+		return nil, false
+	}
+	return names, true
+}
+
+func validateChatSkillsMeta(meta map[string]interface{}) error {
+	raw, ok := meta[chatMetaSkillsKey]
+	if !ok || raw == nil {
+		return nil
+	}
+	if _, err := parseSkillNames(raw); err != nil {
+		return fmt.Errorf("meta.%s must be an array of skill names", chatMetaSkillsKey)
+	}
+	return nil
+}
+
+func parseSkillNames(raw interface{}) ([]string, error) {
+	switch value := raw.(type) {
+	case []string:
+		return normalizeSkillNames(value), nil
+	case []interface{}:
+		names := make([]string, 0, len(value))
+		for _, item := range value {
+			name, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("skill name must be a string")
+			}
+			names = append(names, name)
+		}
+		return normalizeSkillNames(names), nil
+	default:
+		return nil, fmt.Errorf("skills must be an array")
+	}
+}
+
+func normalizeSkillNames(in []string) []string {
+	out := make([]string, 0, len(in))
+	seen := map[string]struct{}{}
+	for _, raw := range in {
+		name := strings.TrimSpace(raw)
+		if name == "" {
+			continue
+		}
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+		out = append(out, name)
+	}
+	return out
+}
+
+// selectContextSkills picks the enabled skills to inject for one turn. The
+// request's skills list wins over the chat selection; without either, every
+// enabled skill is used. Disabled skills are never injected.
+func selectContextSkills(skills map[string]domain.SkillSpec, requested []string, chatSelection []string, hasChatSelection bool) []domain.SkillSpec {
+	var allowed map[string]struct{}
+	switch {
+	case requested != nil:
+		allowed = skillNameSet(normalizeSkillNames(requested))
+	case hasChatSelection:
+		allowed = skillNameSet(chatSelection)
+	}
+	out := make([]domain.SkillSpec, 0, len(skills))
+	for name, spec := range skills {
+		if !spec.Enabled || strings.TrimSpace(spec.Content) == "" {
+			continue
+		}
+		if allowed != nil {
+			if _, ok := allowed[name]; !ok {
+				continue
+			}
+		}
+		out = append(out, spec)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+func skillNameSet(names []string) map[string]struct{} {
+	out := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		out[name] = struct{}{}
+	}
+	return out
+}
+
+// appendSkillLayers adds one system layer per selected skill after the global
+// layers and before the chat persona.
+func appendSkillLayers(layers []systemPromptLayer, skills []domain.SkillSpec) []systemPromptLayer {
+	for _, skill := range skills {
+		source := "skill://" + skill.Name
+		layers = append(layers, systemPromptLayer{
+			Name:    "skill_system",
+			Role:    "system",
+			Source:  source,
+			Content: systempromptservice.FormatLayerSourceContent(source, strings.TrimSpace(skill.Content)),
+		})
+	}
+	return layers
+}
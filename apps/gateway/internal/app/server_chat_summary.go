@@ -0,0 +1,191 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"nextai/apps/gateway/internal/domain"
+	"nextai/apps/gateway/internal/repo"
+	"nextai/apps/gateway/internal/runner"
+)
+
+const (
+	chatSummaryKeepRecentMessages = 4
+	chatSummaryMinOlderMessages   = 2
+	chatSummaryInputMaxRunes      = 24000
+	chatSummaryTimeout            = 60 * time.Second
+	chatSummaryInstruction        = "Summarize the conversation below so it can replace the original messages as context for future turns. Keep decisions, facts, open questions and user preferences; drop small talk. Reply with the summary only."
+	chatSummaryTextPrefix         = "Summary of the earlier conversation:\n"
+	chatMessageMetadataSummaryKey = "summary"
+)
+
+type chatSummaryResponse struct {
+	ChatID             string                `json:"chat_id"`
+	Summary            string                `json:"summary"`
+	SummarizedMessages int                   `json:"summarized_messages"`
+	Message            domain.RuntimeMessage `json:"message"`
+}
+
+// summarizeChat compacts a chat on demand: everything but the most recent
+// messages is replaced by one system message holding a model-written summary.
+func (s *Server) summarizeChat(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "chat_id")
+	found := false
+	older := []domain.RuntimeMessage{}
+	chat := domain.ChatSpec{}
+	activeLLM := domain.ModelSlotConfig{}
+	providerSetting := repo.ProviderSetting{}
+	s.store.Read(func(state *repo.State) {
+		chat, found = state.Chats[id]
+		if !found {
+			return
+		}
+		history := state.Histories[id]
+		if len(history) > chatSummaryKeepRecentMessages {
+			older = append(older, history[:len(history)-chatSummaryKeepRecentMessages]...)
+		}
+		activeLLM = resolveChatActiveModelSlot(chat.Meta, state)
+		providerSetting = getProviderSettingByID(state, activeLLM.ProviderID)
+	})
+	if !found {
+		writeErr(w, http.StatusNotFound, "not_found", "chat not found", map[string]string{"chat_id": id})
+		return
+	}
+	if len(older) < chatSummaryMinOlderMessages {
+		writeErr(w, http.StatusBadRequest, "insufficient_history", "not enough history to summarize", map[string]int{
+			"min_messages": chatSummaryKeepRecentMessages + chatSummaryMinOlderMessages,
+		})
+		return
+	}
+
+	generateConfig, configErr := s.buildModelGenerateConfig(activeLLM, providerSetting, false, chat.SessionID, chat.UserID)
+	if configErr != nil {
+		writeErr(w, configErr.Status, configErr.Code, configErr.Message, nil)
+		return
+	}
+	// The demo provider only echoes its input; its "summary" would replace
+	// real history for good.
+	if providerID := strings.TrimSpace(generateConfig.ProviderID); providerID == "" || providerID == runner.ProviderDemo {
+		writeErr(w, http.StatusBadRequest, "model_not_configured", "summarizing needs a configured model; set an active model first", nil)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), chatSummaryTimeout)
+	defer cancel()
+	summary, err := s.generateChatSummary(ctx, older, generateConfig)
+	if err != nil {
+		status, code, message := mapRunnerError(err)
+		writeErr(w, status, code, message, nil)
+		return
+	}
+	if summary == "" {
+		writeErr(w, http.StatusBadGateway, runner.ErrorCodeProviderInvalidReply, "model returned an empty summary", nil)
+		return
+	}
+
+	message := domain.RuntimeMessage{
+		ID:       newID("msg"),
+		Role:     "system",
+		Type:     "message",
+		Metadata: map[string]interface{}{chatMessageMetadataSummaryKey: true},
+		Content:  []domain.RuntimeContent{{Type: "text", Text: chatSummaryTextPrefix + summary}},
+	}
+	changed := false
+	if err := s.store.Write(func(state *repo.State) error {
+		history := state.Histories[id]
+		if _, ok := state.Chats[id]; !ok || !historyHasPrefix(history, older) {
+			changed = true
+			return nil
+		}
+		compacted := make([]domain.RuntimeMessage, 0, len(history)-len(older)+1)
+		compacted = append(compacted, message)
+		compacted = append(compacted, history[len(older):]...)
+		state.Histories[id] = compacted
+		updated := state.Chats[id]
+		updated.UpdatedAt = nowISO()
+		state.Chats[id] = updated
+		return nil
+	}); err != nil {
+		writeErr(w, http.StatusInternalServerError, "store_error", err.Error(), nil)
+		return
+	}
+	if changed {
+		writeErr(w, http.StatusConflict, "chat_changed", "chat history changed while summarizing; retry", nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, chatSummaryResponse{
+		ChatID:             id,
+		Summary:            summary,
+		SummarizedMessages: len(older),
+		Message:            message,
+	})
+}
+
+func (s *Server) generateChatSummary(
+	ctx context.Context,
+	messages []domain.RuntimeMessage,
+	generateConfig runner.GenerateConfig,
+) (string, error) {
+	cfg := generateConfig
+	cfg.PreviousResponseID = ""
+	cfg.Store = false
+	req := domain.AgentProcessRequest{
+		Input: []domain.AgentInputMessage{
+			{
+				Role:    "system",
+				Type:    "message",
+				Content: []domain.RuntimeContent{{Type: "text", Text: chatSummaryInstruction}},
+			},
+			{
+				Role:    "user",
+				Type:    "message",
+				Content: []domain.RuntimeContent{{Type: "text", Text: chatSummaryTranscript(messages)}},
+			},
+		},
+		Stream: false,
+	}
+	turn, err := s.runner.GenerateTurn(ctx, req, cfg, nil)
+	s.noteProviderAPIKeyFailure(cfg, err)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(turn.Text), nil
+}
+
+// chatSummaryTranscript renders messages as "role: text" lines, keeping the
+// newest part when the transcript exceeds chatSummaryInputMaxRunes.
+func chatSummaryTranscript(messages []domain.RuntimeMessage) string {
+	lines := make([]string, 0, len(messages))
+	for _, msg := range messages {
+		parts := []string{}
+		for _, content := range msg.Content {
+			if text := strings.TrimSpace(content.Text); text != "" {
+				parts = append(parts, text)
+			}
+		}
+		if len(parts) == 0 {
+			continue
+		}
+		lines = append(lines, strings.TrimSpace(msg.Role)+": "+strings.Join(parts, "\n"))
+	}
+	runes := []rune(strings.Join(lines, "\n\n"))
+	if len(runes) > chatSummaryInputMaxRunes {
+		runes = runes[len(runes)-chatSummaryInputMaxRunes:]
+	}
+	return string(runes)
+}
+
+func historyHasPrefix(history []domain.RuntimeMessage, prefix []domain.RuntimeMessage) bool {
+	if len(history) < len(prefix) {
+		return false
+	}
+	for i := range prefix {
+		if history[i].ID != prefix[i].ID {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,65 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+
+	systempromptservice "nextai/apps/gateway/internal/service/systemprompt"
+)
+
+const chatSystemPromptMaxRunes = 8000
+
+func chatSystemPromptFromMeta(meta map[string]interface{}) string {
+	if meta == nil {
+		return ""
+	}
+	prompt, _ := meta[chatMetaSystemPromptKey].(string)
+	return strings.TrimSpace(prompt)
+}
+
+// withChatSystemPrompt stores prompt in meta, removing the key when prompt is empty.
+func withChatSystemPrompt(meta map[string]interface{}, prompt string) map[string]interface{} {
+	if meta == nil {
+		meta = map[string]interface{}{}
+	}
+	if prompt == "" {
+		delete(meta, chatMetaSystemPromptKey)
+		return meta
+	}
+	meta[chatMetaSystemPromptKey] = prompt
+	return meta
+}
+
+func validateChatSystemPromptMeta(meta map[string]interface{}) error {
+	raw, ok := meta[chatMetaSystemPromptKey]
+	if !ok || raw == nil {
+		return nil
+	}
+	prompt, ok := raw.(string)
+	if !ok {
+		return fmt.Errorf("meta.%s must be a string", chatMetaSystemPromptKey)
+	}
+	return validateChatSystemPrompt(strings.TrimSpace(prompt))
+}
+
+func validateChatSystemPrompt(prompt string) error {
+	if len([]rune(prompt)) > chatSystemPromptMaxRunes {
+		return fmt.Errorf("system_prompt must be at most %d characters", chatSystemPromptMaxRunes)
+	}
+	return nil
+}
+
+// appendChatSystemPromptLayer adds the chat persona after the global layers so
+// it is the last system message the model sees before the conversation.
+func appendChatSystemPromptLayer(layers []systemPromptLayer, chatID string, prompt string) []systemPromptLayer {
+	if prompt == "" {
+		return layers
+	}
+	source := "chat://" + chatID + "/system_prompt"
+	return append(layers, systemPromptLayer{
+		Name:    "chat_system_prompt_system",
+		Role:    "system",
+		Source:  source,
+		Content: systempromptservice.FormatLayerSourceContent(source, prompt),
+	})
+}
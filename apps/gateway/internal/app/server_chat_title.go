@@ -0,0 +1,147 @@
+package app
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"nextai/apps/gateway/internal/domain"
+	"nextai/apps/gateway/internal/repo"
+	"nextai/apps/gateway/internal/runner"
+)
+
+const (
+	chatAutoTitleMaxWords     = 6
+	chatAutoTitleMaxRunes     = 60
+	chatAutoTitleInputMaxRune = 1000
+	chatAutoTitleTimeout      = 20 * time.Second
+	chatAutoTitleInstruction  = "Write a concise title of at most 6 words for this conversation. Reply with the title only, without quotes or punctuation at the end."
+)
+
+// startChatAutoTitle asks the active model for a short chat title in the
+// background. The truncated first message stays as the name when the provider
+// is demo, the call fails, the chat was renamed in the meantime, or the
+// server is closing. Close waits for the goroutine through cronWG.
+func (s *Server) startChatAutoTitle(
+	chatID string,
+	fallbackTitle string,
+	userText string,
+	assistantText string,
+	generateConfig runner.GenerateConfig,
+) {
+	if s == nil || s.runner == nil {
+		return
+	}
+	providerID := strings.ToLower(strings.TrimSpace(generateConfig.ProviderID))
+	if providerID == "" || providerID == runner.ProviderDemo {
+		return
+	}
+	select {
+	case <-s.cronStop:
+		return
+	default:
+	}
+	s.cronWG.Add(1)
+	go func() {
+		defer s.cronWG.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), chatAutoTitleTimeout)
+		defer cancel()
+		go func() {
+			select {
+			case <-s.cronStop:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		title, err := s.generateChatTitle(ctx, userText, assistantText, generateConfig)
+		if err != nil {
+			select {
+			case <-s.cronStop:
+			default:
+				log.Printf("warning: chat auto-title failed for chat %q: %v", chatID, err)
+			}
+			return
+		}
+		if title == "" {
+			return
+		}
+		select {
+		case <-s.cronStop:
+			return
+		default:
+		}
+		if err := s.store.Write(func(state *repo.State) error {
+			chat, ok := state.Chats[chatID]
+			if !ok || chat.Name != fallbackTitle {
+				return nil
+			}
+			chat.Name = title
+			state.Chats[chatID] = chat
+			return nil
+		}); err != nil {
+			log.Printf("warning: chat auto-title persist failed for chat %q: %v", chatID, err)
+		}
+	}()
+}
+
+func (s *Server) generateChatTitle(
+	ctx context.Context,
+	userText string,
+	assistantText string,
+	generateConfig runner.GenerateConfig,
+) (string, error) {
+	cfg := generateConfig
+	cfg.PreviousResponseID = ""
+	cfg.Store = false
+	req := domain.AgentProcessRequest{
+		Input: []domain.AgentInputMessage{
+			{
+				Role:    "system",
+				Type:    "message",
+				Content: []domain.RuntimeContent{{Type: "text", Text: chatAutoTitleInstruction}},
+			},
+			{
+				Role: "user",
+				Type: "message",
+				Content: []domain.RuntimeContent{{
+					Type: "text",
+					Text: "User: " + truncateChatTitleInput(userText) + "\n\nAssistant: " + truncateChatTitleInput(assistantText),
+				}},
+			},
+		},
+		Stream: false,
+	}
+	turn, err := s.runner.GenerateTurn(ctx, req, cfg, nil)
+	s.noteProviderAPIKeyFailure(cfg, err)
+	if err != nil {
+		return "", err
+	}
+	return normalizeChatTitle(turn.Text), nil
+}
+
+func truncateChatTitleInput(text string) string {
+	runes := []rune(strings.TrimSpace(text))
+	if len(runes) <= chatAutoTitleInputMaxRune {
+		return string(runes)
+	}
+	return string(runes[:chatAutoTitleInputMaxRune])
+}
+
+func normalizeChatTitle(raw string) string {
+	line := strings.TrimSpace(raw)
+	if idx := strings.IndexAny(line, "\r\n"); idx >= 0 {
+		line = line[:idx]
+	}
+	line = strings.TrimSpace(strings.TrimPrefix(line, "Title:"))
+	line = strings.Trim(line, "\"'`*#“”‘’「」 ")
+	words := strings.Fields(line)
+	if len(words) > chatAutoTitleMaxWords {
+		words = words[:chatAutoTitleMaxWords]
+	}
+	title := strings.TrimRight(strings.Join(words, " "), ".。!！?？,，:：;；")
+	if runes := []rune(title); len(runes) > chatAutoTitleMaxRunes {
+		title = string(runes[:chatAutoTitleMaxRunes])
+	}
+	return strings.TrimSpace(title)
+}
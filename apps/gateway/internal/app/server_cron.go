@@ -10,6 +10,7 @@ import (
 	"github.com/go-chi/chi/v5"
 
 	"nextai/apps/gateway/internal/domain"
+	"nextai/apps/gateway/internal/observability"
 	cronservice "nextai/apps/gateway/internal/service/cron"
 )
 
@@ -40,6 +41,55 @@ func (s *Server) createCronJob(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, job)
 }
 
+func (s *Server) batchCreateCronJobs(w http.ResponseWriter, r *http.Request) {
+	var req []domain.CronJobSpec
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErr(w, http.StatusBadRequest, "invalid_json", "invalid request body", nil)
+		return
+	}
+	if len(req) == 0 {
+		writeErr(w, http.StatusBadRequest, "invalid_request", "at least one cron job is required", nil)
+		return
+	}
+	out, err := s.getCronService().CreateJobs(req)
+	if err != nil {
+		if duplicate := (*cronservice.DuplicateJobIDError)(nil); errors.As(err, &duplicate) {
+			writeErr(w, http.StatusConflict, "duplicate_cron_job_id", duplicate.Error(), map[string]string{"id": duplicate.ID})
+			return
+		}
+		writeErr(w, http.StatusInternalServerError, "store_error", err.Error(), nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) validateCronJob(w http.ResponseWriter, r *http.Request) {
+	var req domain.CronJobSpec
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErr(w, http.StatusBadRequest, "invalid_json", "invalid request body", nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.getCronService().ValidateJob(req))
+}
+
+func (s *Server) previewCronSchedule(w http.ResponseWriter, r *http.Request) {
+	var req domain.CronJobSpec
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErr(w, http.StatusBadRequest, "invalid_json", "invalid request body", nil)
+		return
+	}
+	out, err := s.getCronService().PreviewSchedule(req, time.Now())
+	if err != nil {
+		if validation := (*cronservice.ValidationError)(nil); errors.As(err, &validation) {
+			writeErr(w, http.StatusBadRequest, validation.Code, validation.Message, nil)
+			return
+		}
+		writeErr(w, http.StatusInternalServerError, "store_error", err.Error(), nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
 func (s *Server) getCronJob(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "job_id")
 	view, err := s.getCronService().GetJob(id)
@@ -54,6 +104,24 @@ func (s *Server) getCronJob(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, view)
 }
 
+func (s *Server) getCronOverview(w http.ResponseWriter, _ *http.Request) {
+	overview, err := s.getCronService().Overview(time.Now().UTC())
+	if err != nil {
+		writeErr(w, http.StatusInternalServerError, "store_error", err.Error(), nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, overview)
+}
+
+func (s *Server) reapCronLeases(w http.ResponseWriter, _ *http.Request) {
+	reaped, err := s.getCronService().ReapExpiredLeases(time.Now().UTC())
+	if err != nil {
+		writeErr(w, http.StatusInternalServerError, "store_error", err.Error(), nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"reaped": reaped})
+}
+
 func (s *Server) updateCronJob(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "job_id")
 	var req domain.CronJobSpec
@@ -103,9 +171,30 @@ func (s *Server) resumeCronJob(w http.ResponseWriter, r *http.Request) {
 	s.updateCronStatus(w, chi.URLParam(r, "job_id"), cronStatusResumed)
 }
 
+func (s *Server) enableCronJob(w http.ResponseWriter, r *http.Request) {
+	s.setCronJobEnabled(w, chi.URLParam(r, "job_id"), true)
+}
+
+func (s *Server) disableCronJob(w http.ResponseWriter, r *http.Request) {
+	s.setCronJobEnabled(w, chi.URLParam(r, "job_id"), false)
+}
+
+func (s *Server) setCronJobEnabled(w http.ResponseWriter, id string, enabled bool) {
+	out, err := s.getCronService().SetEnabled(id, enabled)
+	if err != nil {
+		if errors.Is(err, errCronJobNotFound) {
+			writeErr(w, http.StatusNotFound, "not_found", "cron job not found", nil)
+			return
+		}
+		writeErr(w, http.StatusInternalServerError, "store_error", err.Error(), nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
 func (s *Server) runCronJob(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "job_id")
-	if err := s.executeCronJob(id); err != nil {
+	if err := s.executeManualCronJob(id); err != nil {
 		if errors.Is(err, errCronJobNotFound) {
 			writeErr(w, http.StatusNotFound, "not_found", "cron job not found", nil)
 			return
@@ -114,12 +203,51 @@ func (s *Server) runCronJob(w http.ResponseWriter, r *http.Request) {
 			writeErr(w, http.StatusConflict, "cron_busy", "cron job reached max_concurrency", nil)
 			return
 		}
+		if errors.Is(err, errCronGlobalConcurrencyReached) {
+			writeErr(w, http.StatusConflict, "cron_global_busy", "cron global concurrency limit reached", nil)
+			return
+		}
 		writeErr(w, http.StatusInternalServerError, "store_error", err.Error(), nil)
 		return
 	}
 	writeJSON(w, http.StatusOK, map[string]bool{"started": true})
 }
 
+// runCronJobSync runs a console job inline and returns the agent reply, so a
+// scheduled prompt can be tried out. Execution failures still answer 200 with
+// status=failed and whatever output was produced.
+func (s *Server) runCronJobSync(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "job_id")
+	output := ""
+	err := s.acquireManualCronSlot(id)
+	if err == nil {
+		defer s.releaseGlobalCronSlot()
+		output, err = s.getCronService().ExecuteJobWithOutput(id)
+	}
+	recordCronExecution(err)
+	if err != nil {
+		if errors.Is(err, errCronJobNotFound) {
+			writeErr(w, http.StatusNotFound, "not_found", "cron job not found", nil)
+			return
+		}
+		if errors.Is(err, errCronMaxConcurrencyReached) {
+			writeErr(w, http.StatusConflict, "cron_busy", "cron job reached max_concurrency", nil)
+			return
+		}
+		if errors.Is(err, errCronGlobalConcurrencyReached) {
+			writeErr(w, http.StatusConflict, "cron_global_busy", "cron global concurrency limit reached", nil)
+			return
+		}
+		if validation := (*cronservice.ValidationError)(nil); errors.As(err, &validation) {
+			writeErr(w, http.StatusBadRequest, validation.Code, validation.Message, nil)
+			return
+		}
+		writeJSON(w, http.StatusOK, domain.CronRunOutput{JobID: id, Status: cronStatusFailed, Output: output, Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, domain.CronRunOutput{JobID: id, Status: cronStatusSucceeded, Output: output})
+}
+
 func (s *Server) getCronJobState(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "job_id")
 	state, err := s.getCronService().GetState(id)
@@ -134,6 +262,20 @@ func (s *Server) getCronJobState(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, state)
 }
 
+func (s *Server) getCronJobHistory(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "job_id")
+	history, err := s.getCronService().GetHistory(id)
+	if err != nil {
+		if errors.Is(err, errCronJobNotFound) {
+			writeErr(w, http.StatusNotFound, "not_found", "cron job not found", nil)
+			return
+		}
+		writeErr(w, http.StatusInternalServerError, "store_error", err.Error(), nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, history)
+}
+
 func (s *Server) updateCronStatus(w http.ResponseWriter, id, status string) {
 	if err := s.getCronService().UpdateStatus(id, status); err != nil {
 		if errors.Is(err, errCronJobNotFound) {
@@ -150,8 +292,35 @@ func (s *Server) updateCronStatus(w http.ResponseWriter, id, status string) {
 	writeJSON(w, http.StatusOK, map[string]bool{key: true})
 }
 
+// executeManualCronJob runs a job triggered through the API under the global
+// cron cap.
+func (s *Server) executeManualCronJob(id string) error {
+	if err := s.acquireManualCronSlot(id); err != nil {
+		recordCronExecution(err)
+		return err
+	}
+	defer s.releaseGlobalCronSlot()
+	return s.executeCronJob(id)
+}
+
 func (s *Server) executeCronJob(id string) error {
-	return s.getCronService().ExecuteJob(id)
+	err := s.getCronService().ExecuteJob(id)
+	recordCronExecution(err)
+	return err
+}
+
+// recordCronExecution counts one execution attempt by outcome; lookups and
+// requests rejected before running are not counted.
+func recordCronExecution(err error) {
+	var validation *cronservice.ValidationError
+	switch {
+	case err == nil:
+		observability.IncCronExecution(cronStatusSucceeded)
+	case errors.Is(err, errCronMaxConcurrencyReached), errors.Is(err, errCronGlobalConcurrencyReached):
+		observability.IncCronExecution("skipped")
+	case !errors.Is(err, errCronJobNotFound) && !errors.As(err, &validation):
+		observability.IncCronExecution(cronStatusFailed)
+	}
 }
 
 func resolveCronNextRunAt(job domain.CronJobSpec, current *string, now time.Time) (time.Time, *time.Time, error) {
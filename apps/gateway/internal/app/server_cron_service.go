@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"nextai/apps/gateway/internal/domain"
 	"nextai/apps/gateway/internal/service/adapters"
@@ -31,9 +32,13 @@ func (s *Server) newCronService() *cronservice.Service {
 				return s.resolveChannel(name)
 			},
 		},
-		ExecuteConsoleAgentTask: func(ctx context.Context, job domain.CronJobSpec, text string) error {
+		ExecuteConsoleAgentTask: func(ctx context.Context, job domain.CronJobSpec, text string) (string, error) {
 			return s.executeCronConsoleAgentTask(ctx, agentProcessor, job, text)
 		},
+		DispatchText:    s.dispatchCronText,
+		ExecuteToolTask: s.executeCronToolTask,
+		ToolDisabled:    s.toolDisabled,
+		LeaseTTL:        time.Duration(s.cfg.CronLeaseTTLMS) * time.Millisecond,
 		ExecuteTask: func(ctx context.Context, job domain.CronJobSpec) (bool, error) {
 			if s.cronTaskExecutor == nil {
 				return false, nil
@@ -43,21 +48,23 @@ func (s *Server) newCronService() *cronservice.Service {
 	})
 }
 
+// executeCronConsoleAgentTask runs text as a console agent turn on the job's
+// dispatch target and returns the reply.
 func (s *Server) executeCronConsoleAgentTask(
 	ctx context.Context,
 	agentProcessor ports.AgentProcessor,
 	job domain.CronJobSpec,
 	text string,
-) error {
+) (string, error) {
 	sessionID := strings.TrimSpace(job.Dispatch.Target.SessionID)
 	userID := strings.TrimSpace(job.Dispatch.Target.UserID)
 	if sessionID == "" || userID == "" {
-		return errors.New("cron dispatch target requires non-empty session_id and user_id")
+		return "", errors.New("cron dispatch target requires non-empty session_id and user_id")
 	}
 
 	text = strings.TrimSpace(text)
 	if text == "" {
-		return nil
+		return "", nil
 	}
 
 	agentReq := domain.AgentProcessRequest{
@@ -78,10 +85,11 @@ func (s *Server) executeCronConsoleAgentTask(
 	}
 
 	if agentProcessor == nil {
-		return errors.New("cron console agent processor is unavailable")
+		return "", errors.New("cron console agent processor is unavailable")
 	}
-	if _, processErr := agentProcessor.Process(ctx, agentReq); processErr != nil {
-		return fmt.Errorf(
+	resp, processErr := agentProcessor.Process(ctx, agentReq)
+	if processErr != nil {
+		return "", fmt.Errorf(
 			"cron console agent execution failed: status=%d code=%s message=%s",
 			processErr.Status,
 			strings.TrimSpace(processErr.Code),
@@ -89,5 +97,5 @@ func (s *Server) executeCronConsoleAgentTask(
 		)
 	}
 
-	return nil
+	return resp.Reply, nil
 }
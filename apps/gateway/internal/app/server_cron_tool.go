@@ -0,0 +1,77 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"nextai/apps/gateway/internal/domain"
+	"nextai/apps/gateway/internal/repo"
+	cronservice "nextai/apps/gateway/internal/service/cron"
+)
+
+// executeCronToolTask runs the job's tool call directly, without a model turn,
+// and appends the output (or the failure) as an assistant message to the
+// dispatch target's console chat.
+func (s *Server) executeCronToolTask(ctx context.Context, job domain.CronJobSpec) (string, error) {
+	sessionID := strings.TrimSpace(job.Dispatch.Target.SessionID)
+	userID := strings.TrimSpace(job.Dispatch.Target.UserID)
+	if sessionID == "" || userID == "" {
+		return "", errors.New("cron dispatch target requires non-empty session_id and user_id")
+	}
+	if job.Tool == nil {
+		return "", errors.New("cron tool task requires tool.name")
+	}
+
+	output, err := s.executeToolCallForPromptModeWithContext(ctx, promptModeDefault, toolCall{
+		Name:  job.Tool.Name,
+		Input: job.Tool.Input,
+	})
+	text := output
+	if err != nil {
+		text = fmt.Sprintf("tool %q failed: %v", job.Tool.Name, err)
+	}
+	if persistErr := s.appendCronToolResult(job, sessionID, userID, text); persistErr != nil {
+		return output, persistErr
+	}
+	return output, err
+}
+
+func (s *Server) appendCronToolResult(job domain.CronJobSpec, sessionID, userID, text string) error {
+	cronChatMeta := cronChatMetaFromBizParams(cronservice.BuildBizParams(job))
+	return s.store.Write(func(state *repo.State) error {
+		chatID := ""
+		for id, c := range state.Chats {
+			if c.SessionID == sessionID && c.UserID == userID && c.Channel == "console" {
+				chatID = id
+				break
+			}
+		}
+		now := nowISO()
+		if chatID == "" {
+			chatID = newID("chat")
+			state.Chats[chatID] = domain.ChatSpec{
+				ID: chatID, Name: "New Chat", SessionID: sessionID, UserID: userID, Channel: "console",
+				Meta: map[string]interface{}{}, CreatedAt: now, UpdatedAt: now,
+			}
+		}
+		chat := state.Chats[chatID]
+		if chat.Meta == nil {
+			chat.Meta = map[string]interface{}{}
+		}
+		for key, value := range cronChatMeta {
+			chat.Meta[key] = value
+		}
+		chat.UpdatedAt = now
+		state.Chats[chatID] = chat
+		state.Histories[chatID] = append(state.Histories[chatID], domain.RuntimeMessage{
+			ID:       newID("msg"),
+			Role:     "assistant",
+			Type:     "message",
+			Content:  []domain.RuntimeContent{{Type: "text", Text: text}},
+			Metadata: map[string]interface{}{"cron_tool": job.Tool.Name},
+		})
+		return nil
+	})
+}
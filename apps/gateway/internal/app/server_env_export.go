@@ -0,0 +1,67 @@
+package app
+
+import (
+	"net/http"
+	"strings"
+
+	"nextai/apps/gateway/internal/domain"
+)
+
+const envExportFileName = "nextai.env"
+
+// exportEnvs serves every env var unmasked in the format loadEnvFile reads.
+// Because it dumps secrets, it is refused while the gateway runs without an
+// API key, and provider-scoped keys may not use it.
+func (s *Server) exportEnvs(w http.ResponseWriter, r *http.Request) {
+	if rejectScopedKey(w, r) {
+		return
+	}
+	if strings.TrimSpace(s.cfg.APIKey) == "" && len(s.cfg.APIKeys) == 0 {
+		writeErr(w, http.StatusForbidden, "api_key_required", "env export requires NEXTAI_API_KEY or NEXTAI_API_KEYS to be configured", nil)
+		return
+	}
+	out, err := s.getAdminService().ListEnvs()
+	if err != nil {
+		writeErr(w, http.StatusInternalServerError, "store_error", err.Error(), nil)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+envExportFileName+`"`)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(renderEnvFile(out)))
+}
+
+// renderEnvFile writes one KEY=value line per var. Keys that cannot be read
+// back (containing '=', whitespace or a leading '#') are listed as comments.
+func renderEnvFile(envs []domain.EnvVar) string {
+	var b strings.Builder
+	for _, item := range envs {
+		key := item.Key
+		if strings.ContainsAny(key, "= \t\r\n") || strings.HasPrefix(key, "#") {
+			b.WriteString("# skipped key that cannot be written to a .env file: ")
+			b.WriteString(strings.Join(strings.Fields(key), " "))
+			b.WriteString("\n")
+			continue
+		}
+		b.WriteString(key)
+		b.WriteString("=")
+		b.WriteString(quoteEnvValue(item.Value))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// quoteEnvValue quotes values that loadEnvFile would otherwise alter: values
+// with newlines become double-quoted with \n escapes, and values with
+// surrounding or inner whitespace, '#' or quote characters are single-quoted
+// so they are read back verbatim.
+func quoteEnvValue(value string) string {
+	if strings.ContainsAny(value, "\r\n") {
+		escaped := strings.ReplaceAll(strings.ReplaceAll(value, "\r\n", "\n"), "\n", `\n`)
+		return `"` + escaped + `"`
+	}
+	if value == "" || !strings.ContainsAny(value, " \t#'\"") {
+		return value
+	}
+	return "'" + value + "'"
+}
@@ -0,0 +1,64 @@
+package app
+
+import (
+	"net/http"
+	"strings"
+
+	"nextai/apps/gateway/internal/domain"
+)
+
+// secretEnvKeySuffixes mark env vars whose values are masked in responses
+// unless the caller asks to reveal them.
+var secretEnvKeySuffixes = []string{"_KEY", "_SECRET", "_TOKEN"}
+
+func isSecretEnvKey(key string) bool {
+	upper := strings.ToUpper(strings.TrimSpace(key))
+	for _, suffix := range secretEnvKeySuffixes {
+		if strings.HasSuffix(upper, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// revealEnvValues reports whether an env response may carry raw secret
+// values: `reveal=true` or an explicit `mask=false`.
+func revealEnvValues(r *http.Request) bool {
+	query := r.URL.Query()
+	if parseBool(query.Get("reveal")) {
+		return true
+	}
+	return strings.EqualFold(strings.TrimSpace(query.Get("mask")), "false")
+}
+
+func maskEnvVars(in []domain.EnvVar, reveal bool) []domain.EnvVar {
+	if reveal {
+		return in
+	}
+	out := make([]domain.EnvVar, 0, len(in))
+	for _, item := range in {
+		if isSecretEnvKey(item.Key) {
+			item.Value = maskKey(item.Value)
+		}
+		out = append(out, item)
+	}
+	return out
+}
+
+// restoreMaskedEnvValues keeps the stored secret when a PUT echoes back the
+// masked value it was listed with, so a list-edit-put round trip does not
+// overwrite secrets with their masks.
+func restoreMaskedEnvValues(in map[string]string, current []domain.EnvVar) map[string]string {
+	stored := map[string]string{}
+	for _, item := range current {
+		stored[item.Key] = item.Value
+	}
+	out := make(map[string]string, len(in))
+	for key, value := range in {
+		if existing, ok := stored[strings.TrimSpace(key)]; ok && isSecretEnvKey(key) && existing != value && value == maskKey(existing) {
+			value = existing
+		}
+		out[key] = value
+	}
+	return out
+}
@@ -334,6 +334,7 @@ func (s *Server) runCodexMemoryPhaseOne(
 	}
 
 	reply, err := s.runner.GenerateReply(ctx, req, generateConfig)
+	s.noteProviderAPIKeyFailure(generateConfig, err)
 	if err != nil {
 		return codexMemoryPhaseOneOutput{}, err
 	}
@@ -452,6 +453,7 @@ func (s *Server) runCodexMemoryPhaseTwo(
 	}
 
 	reply, err := s.runner.GenerateReply(ctx, req, generateConfig)
+	s.noteProviderAPIKeyFailure(generateConfig, err)
 	if err != nil {
 		return codexMemoryPhaseTwoOutput{}, err
 	}
@@ -0,0 +1,229 @@
+package app
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"nextai/apps/gateway/internal/domain"
+	"nextai/apps/gateway/internal/observability"
+	"nextai/apps/gateway/internal/provider"
+	"nextai/apps/gateway/internal/repo"
+	"nextai/apps/gateway/internal/runner"
+)
+
+const (
+	providerTestTimeout        = 20 * time.Second
+	providerTestPrompt         = "Reply with the single word OK."
+	providerTestSampleMaxRunes = 200
+
+	providerRemoteModelsTimeout  = 15 * time.Second
+	providerRemoteModelsCacheTTL = 60 * time.Second
+	providerModelsSourceRemote   = "remote"
+	providerModelsSourceCatalog  = "catalog"
+)
+
+type providerTestResponse struct {
+	OK          bool   `json:"ok"`
+	ProviderID  string `json:"provider_id"`
+	Model       string `json:"model"`
+	LatencyMS   int64  `json:"latency_ms"`
+	ModelSample string `json:"model_sample"`
+}
+
+type providerRemoteModelsResponse struct {
+	ProviderID string             `json:"provider_id"`
+	Source     string             `json:"source"`
+	Models     []domain.ModelInfo `json:"models"`
+	Error      string             `json:"error,omitempty"`
+	FetchedAt  string             `json:"fetched_at"`
+}
+
+type remoteModelsCacheEntry struct {
+	models    []domain.ModelInfo
+	fetchedAt time.Time
+}
+
+// testProvider sends one tiny turn to a provider with its stored settings so a
+// new base URL or API key can be checked without starting a chat. The model is
+// the request's, else the active one when it belongs to this provider, else
+// the provider's default. Disabled providers are tested too.
+func (s *Server) testProvider(w http.ResponseWriter, r *http.Request) {
+	providerID := normalizeProviderID(chi.URLParam(r, "provider_id"))
+	var body struct {
+		Model string `json:"model"`
+	}
+	raw, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeErr(w, http.StatusBadRequest, "invalid_json", "invalid request body", nil)
+		return
+	}
+	if strings.TrimSpace(string(raw)) != "" && !s.decodeRequestBytes(w, raw, &body) {
+		return
+	}
+	if !observability.ProviderPermitted(r.Context(), providerID) {
+		writeErr(w, http.StatusForbidden, "provider_not_permitted", "api key is not permitted to use this provider", nil)
+		return
+	}
+
+	found := false
+	setting := repo.ProviderSetting{}
+	active := domain.ModelSlotConfig{}
+	s.store.Read(func(state *repo.State) {
+		setting, found = findProviderSettingByID(state, providerID)
+		active = state.ActiveLLM
+	})
+	if !found {
+		writeErr(w, http.StatusNotFound, "provider_not_found", "provider not found", nil)
+		return
+	}
+	model := strings.TrimSpace(body.Model)
+	if model == "" && normalizeProviderID(active.ProviderID) == providerID {
+		model = strings.TrimSpace(active.Model)
+	}
+	if model == "" {
+		model = provider.DefaultModelID(providerID)
+	}
+	if model == "" {
+		writeErr(w, http.StatusBadRequest, "model_required", "provider has no default model; pass model", nil)
+		return
+	}
+
+	enabled := true
+	setting.Enabled = &enabled
+	cfg, configErr := s.buildModelGenerateConfig(domain.ModelSlotConfig{ProviderID: providerID, Model: model}, setting, true, "", "")
+	if configErr != nil {
+		writeErr(w, configErr.Status, configErr.Code, configErr.Message, nil)
+		return
+	}
+	cfg.Store = false
+	cfg.PromptCacheKey = ""
+
+	ctx, cancel := context.WithTimeout(r.Context(), providerTestTimeout)
+	defer cancel()
+	req := domain.AgentProcessRequest{
+		Input: []domain.AgentInputMessage{
+			{
+				Role:    "user",
+				Type:    "message",
+				Content: []domain.RuntimeContent{{Type: "text", Text: providerTestPrompt}},
+			},
+		},
+	}
+	started := time.Now()
+	turn, err := s.runner.GenerateTurn(ctx, req, cfg, nil)
+	latency := time.Since(started).Milliseconds()
+	s.noteProviderAPIKeyFailure(cfg, err)
+	if err != nil {
+		status, code, message := mapRunnerError(err)
+		writeErr(w, status, code, message, map[string]int64{"latency_ms": latency})
+		return
+	}
+	sample := []rune(strings.TrimSpace(turn.Text))
+	if len(sample) > providerTestSampleMaxRunes {
+		sample = sample[:providerTestSampleMaxRunes]
+	}
+	writeJSON(w, http.StatusOK, providerTestResponse{
+		OK:          true,
+		ProviderID:  providerID,
+		Model:       cfg.Model,
+		LatencyMS:   latency,
+		ModelSample: string(sample),
+	})
+}
+
+// getRemoteModels lists the models the provider reports live from its
+// `/models` endpoint, so newly released models can be picked without a code
+// update. Successful lists are cached per provider and base URL for a minute;
+// any failure falls back to the static catalog with source=catalog.
+func (s *Server) getRemoteModels(w http.ResponseWriter, r *http.Request) {
+	providerID := normalizeProviderID(chi.URLParam(r, "provider_id"))
+	if !observability.ProviderPermitted(r.Context(), providerID) {
+		writeErr(w, http.StatusForbidden, "provider_not_permitted", "api key is not permitted to use this provider", nil)
+		return
+	}
+	found := false
+	setting := repo.ProviderSetting{}
+	s.store.Read(func(state *repo.State) {
+		setting, found = findProviderSettingByID(state, providerID)
+	})
+	if !found {
+		writeErr(w, http.StatusNotFound, "provider_not_found", "provider not found", nil)
+		return
+	}
+
+	cfg := runner.GenerateConfig{
+		ProviderID: providerID,
+		APIKey:     s.resolveProviderAPIKey(providerID, setting),
+		BaseURL:    resolveProviderBaseURL(providerID, setting),
+		AdapterID:  provider.ResolveAdapter(providerID),
+		Headers:    sanitizeStringMap(setting.Headers),
+		TimeoutMS:  setting.TimeoutMS,
+	}
+	cacheKey := providerID + "\x00" + cfg.BaseURL
+	now := time.Now().UTC()
+	s.remoteModelsMu.Lock()
+	cached, ok := s.remoteModels[cacheKey]
+	s.remoteModelsMu.Unlock()
+	if ok && now.Sub(cached.fetchedAt) < providerRemoteModelsCacheTTL {
+		writeJSON(w, http.StatusOK, providerRemoteModelsResponse{
+			ProviderID: providerID,
+			Source:     providerModelsSourceRemote,
+			Models:     cached.models,
+			FetchedAt:  cached.fetchedAt.Format(time.RFC3339),
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), providerRemoteModelsTimeout)
+	defer cancel()
+	ids, err := s.runner.ListModels(ctx, cfg)
+	s.noteProviderAPIKeyFailure(cfg, err)
+	if err != nil {
+		_, _, message := mapRunnerError(err)
+		writeJSON(w, http.StatusOK, providerRemoteModelsResponse{
+			ProviderID: providerID,
+			Source:     providerModelsSourceCatalog,
+			Models:     provider.ResolveModels(providerID, setting.ModelAliases),
+			Error:      message,
+			FetchedAt:  now.Format(time.RFC3339),
+		})
+		return
+	}
+
+	models := remoteModelInfos(providerID, ids)
+	s.remoteModelsMu.Lock()
+	if s.remoteModels == nil {
+		s.remoteModels = map[string]remoteModelsCacheEntry{}
+	}
+	s.remoteModels[cacheKey] = remoteModelsCacheEntry{models: models, fetchedAt: now}
+	s.remoteModelsMu.Unlock()
+	writeJSON(w, http.StatusOK, providerRemoteModelsResponse{
+		ProviderID: providerID,
+		Source:     providerModelsSourceRemote,
+		Models:     models,
+		FetchedAt:  now.Format(time.RFC3339),
+	})
+}
+
+// remoteModelInfos turns live model IDs into model infos, reusing the catalog
+// entry (name, capabilities, limits) for models the catalog already knows.
+func remoteModelInfos(providerID string, ids []string) []domain.ModelInfo {
+	known := map[string]domain.ModelInfo{}
+	for _, model := range provider.ResolveModels(providerID, nil) {
+		known[model.ID] = model
+	}
+	out := make([]domain.ModelInfo, 0, len(ids))
+	for _, id := range ids {
+		if model, ok := known[id]; ok {
+			out = append(out, model)
+			continue
+		}
+		out = append(out, domain.ModelInfo{ID: id, Name: id})
+	}
+	return out
+}
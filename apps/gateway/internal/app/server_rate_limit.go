@@ -0,0 +1,46 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"nextai/apps/gateway/internal/observability"
+)
+
+// withUserRateLimit throttles next per user_id when NEXTAI_RATE_LIMIT_RPM is set.
+func (s *Server) withUserRateLimit(next http.HandlerFunc, key func(*http.Request) string) http.HandlerFunc {
+	return observability.RateLimit(s.rateLimiter, key, func(w http.ResponseWriter, _ *http.Request) {
+		writeErr(w, http.StatusTooManyRequests, "rate_limited", "too many requests for this user, retry later", nil)
+	})(next).ServeHTTP
+}
+
+func agentProcessRateLimitKey(r *http.Request) string {
+	var body struct {
+		UserID string `json:"user_id"`
+	}
+	_ = json.Unmarshal(peekRequestBody(r), &body)
+	return body.UserID
+}
+
+func qqInboundRateLimitKey(r *http.Request) string {
+	event, err := parseQQInboundEvent(peekRequestBody(r))
+	if err != nil {
+		return ""
+	}
+	return event.UserID
+}
+
+// peekRequestBody reads the body and puts it back so the handler can read it again.
+func peekRequestBody(r *http.Request) []byte {
+	if r.Body == nil {
+		return nil
+	}
+	body, err := io.ReadAll(r.Body)
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return nil
+	}
+	return body
+}
@@ -0,0 +1,50 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// decodeRequestBody decodes a JSON request body into out and writes a 400
+// invalid_json error when it fails. With NEXTAI_STRICT_REQUEST_DECODE unknown
+// fields are rejected too, and the error names the offending field so a typo
+// like "sesion_id" does not pass silently.
+func (s *Server) decodeRequestBody(w http.ResponseWriter, body io.Reader, out interface{}) bool {
+	decoder := json.NewDecoder(body)
+	if s.cfg.StrictRequestDecode {
+		decoder.DisallowUnknownFields()
+	}
+	if err := decoder.Decode(out); err != nil {
+		if field, ok := unknownJSONField(err); ok {
+			writeErr(w, http.StatusBadRequest, "invalid_json", fmt.Sprintf("unknown field %q", field), map[string]string{"field": field})
+			return false
+		}
+		writeErr(w, http.StatusBadRequest, "invalid_json", "invalid request body", nil)
+		return false
+	}
+	return true
+}
+
+func (s *Server) decodeRequestBytes(w http.ResponseWriter, data []byte, out interface{}) bool {
+	return s.decodeRequestBody(w, bytes.NewReader(data), out)
+}
+
+// unknownJSONField extracts the field name from the error DisallowUnknownFields
+// produces; encoding/json has no typed error for it.
+func unknownJSONField(err error) (string, bool) {
+	const prefix = "json: unknown field "
+	message := err.Error()
+	if !strings.HasPrefix(message, prefix) {
+		return "", false
+	}
+	field, unquoteErr := strconv.Unquote(strings.TrimPrefix(message, prefix))
+	if unquoteErr != nil {
+		return "", false
+	}
+	return field, true
+}
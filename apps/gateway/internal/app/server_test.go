@@ -1,13 +1,20 @@
 package app
 
 import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -16,7 +23,9 @@ import (
 
 	"nextai/apps/gateway/internal/config"
 	"nextai/apps/gateway/internal/domain"
+	"nextai/apps/gateway/internal/observability"
 	"nextai/apps/gateway/internal/plugin"
+	"nextai/apps/gateway/internal/repo"
 )
 
 func newTestServer(t *testing.T) *Server {
@@ -516,6 +525,103 @@ func TestAPIKeyAuthMiddleware(t *testing.T) {
 	}
 }
 
+func TestScopedAPIKeysEnforceProviderAllowlist(t *testing.T) {
+	dir, err := os.MkdirTemp("", "nextai-gateway-scoped-keys-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	srv, err := NewServer(config.Config{
+		Host:    "127.0.0.1",
+		Port:    "0",
+		DataDir: dir,
+		APIKey:  "admin-token",
+		APIKeys: map[string][]string{
+			"openai-token": {"openai"},
+			"other-token":  {"anthropic"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Close() })
+
+	call := func(key, method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", key)
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		return w
+	}
+
+	if w := call("admin-token", http.MethodPut, "/models/openai/config", `{"enabled":true,"api_key":"sk-test"}`); w.Code != http.StatusOK {
+		t.Fatalf("configure provider status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	setActive := `{"provider_id":"openai","model":"gpt-4o-mini"}`
+	w := call("other-token", http.MethodPut, "/models/active", setActive)
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), `"code":"provider_not_permitted"`) {
+		t.Fatalf("expected provider_not_permitted, status=%d body=%s", w.Code, w.Body.String())
+	}
+	if w := call("openai-token", http.MethodPut, "/models/active", setActive); w.Code != http.StatusOK {
+		t.Fatalf("expected allowed key to set active model, status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"hi"}]}],"session_id":"s-scoped","user_id":"u-scoped","channel":"console","stream":false,"model":{"provider_id":"openai","model":"gpt-4o-mini"}}`
+	w = call("other-token", http.MethodPost, "/agent/process", procReq)
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), `"code":"provider_not_permitted"`) {
+		t.Fatalf("expected provider_not_permitted on request override, status=%d body=%s", w.Code, w.Body.String())
+	}
+	fallbackReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"hi"}]}],"session_id":"s-scoped","user_id":"u-scoped","channel":"console","stream":false,"model":{"provider_id":"anthropic","model":"claude-3-5-haiku-latest","fallback":[{"provider_id":"openai","model":"gpt-4o-mini"}]}}`
+	w = call("other-token", http.MethodPost, "/agent/process", fallbackReq)
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), `"code":"provider_not_permitted"`) {
+		t.Fatalf("expected provider_not_permitted on a fallback provider, status=%d body=%s", w.Code, w.Body.String())
+	}
+	noOverrideReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"hi"}]}],"session_id":"s-scoped","user_id":"u-scoped","channel":"console","stream":false}`
+	w = call("other-token", http.MethodPost, "/agent/process", noOverrideReq)
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), `"code":"provider_not_permitted"`) {
+		t.Fatalf("expected provider_not_permitted on the active model, status=%d body=%s", w.Code, w.Body.String())
+	}
+	for _, mutation := range []struct{ method, path, body string }{
+		{http.MethodPut, "/models/openai/config", `{"api_key":"sk-stolen"}`},
+		{http.MethodDelete, "/models/openai", ""},
+	} {
+		if w := call("other-token", mutation.method, mutation.path, mutation.body); w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), `"code":"provider_not_permitted"`) {
+			t.Fatalf("expected provider_not_permitted for %s %s, status=%d body=%s", mutation.method, mutation.path, w.Code, w.Body.String())
+		}
+	}
+
+	for _, secretRoute := range []struct{ method, path, body string }{
+		{http.MethodGet, "/envs?reveal=true", ""},
+		{http.MethodGet, "/envs/export", ""},
+		{http.MethodPut, "/envs", `{"OPENAI_API_KEY":"sk-stolen"}`},
+		{http.MethodPatch, "/envs", `{"OPENAI_API_KEY":"sk-stolen"}`},
+		{http.MethodGet, "/workspace/export", ""},
+		{http.MethodPost, "/workspace/import", `{}`},
+		{http.MethodGet, "/workspace/files/config/models.json", ""},
+	} {
+		w := call("openai-token", secretRoute.method, secretRoute.path, secretRoute.body)
+		if secretRoute.path == "/envs?reveal=true" {
+			if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "sk-test") {
+				t.Fatalf("expected masked envs for scoped key, status=%d body=%s", w.Code, w.Body.String())
+			}
+			continue
+		}
+		if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), `"code":"scoped_api_key_forbidden"`) {
+			t.Fatalf("expected scoped_api_key_forbidden for %s %s, status=%d body=%s", secretRoute.method, secretRoute.path, w.Code, w.Body.String())
+		}
+	}
+	if w := call("admin-token", http.MethodGet, "/envs/export", ""); w.Code != http.StatusOK {
+		t.Fatalf("expected primary key to export envs, status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	if w := call("unknown-token", http.MethodGet, "/chats", ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected unknown key to be rejected, got=%d", w.Code)
+	}
+}
+
 func TestChatCreateAndGetHistory(t *testing.T) {
 	srv := newTestServer(t)
 
@@ -552,6 +658,42 @@ func TestChatCreateAndGetHistory(t *testing.T) {
 	}
 }
 
+func TestGetChatMetaOmitsHistory(t *testing.T) {
+	srv := newTestServer(t)
+
+	w := callJSONEndpoint(srv, http.MethodPost, "/chats", `{"name":"Meta","session_id":"s-meta","user_id":"u1","channel":"console","meta":{"topic":"billing"}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("create status=%d body=%s", w.Code, w.Body.String())
+	}
+	var created domain.ChatSpec
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"hello meta"}]}],"session_id":"s-meta","user_id":"u1","channel":"console","stream":false}`
+	if w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq); w.Code != http.StatusOK {
+		t.Fatalf("process status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	w = callJSONEndpoint(srv, http.MethodGet, "/chats/"+created.ID+"/meta", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("meta status=%d body=%s", w.Code, w.Body.String())
+	}
+	var meta domain.ChatSpec
+	if err := json.Unmarshal(w.Body.Bytes(), &meta); err != nil {
+		t.Fatalf("decode meta failed: %v body=%s", err, w.Body.String())
+	}
+	if meta.ID != created.ID || meta.Name != "Meta" || meta.Meta["topic"] != "billing" || meta.CreatedAt == "" {
+		t.Fatalf("unexpected chat meta: %s", w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "hello meta") || strings.Contains(w.Body.String(), `"messages"`) {
+		t.Fatalf("meta response should not include history: %s", w.Body.String())
+	}
+
+	if w := callJSONEndpoint(srv, http.MethodGet, "/chats/missing-chat/meta", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for missing chat, status=%d body=%s", w.Code, w.Body.String())
+	}
+}
+
 func TestListChatsContainsDefaultChat(t *testing.T) {
 	srv := newTestServer(t)
 
@@ -591,981 +733,4977 @@ func TestListChatsContainsDefaultChat(t *testing.T) {
 	}
 }
 
-func TestDeleteDefaultChatRejected(t *testing.T) {
+func TestListChatsIncludeSizeReportsApproxChars(t *testing.T) {
 	srv := newTestServer(t)
 
-	deleteW := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(deleteW, httptest.NewRequest(http.MethodDelete, "/chats/"+domain.DefaultChatID, nil))
-	if deleteW.Code != http.StatusBadRequest {
-		t.Fatalf("delete default chat status=%d body=%s", deleteW.Code, deleteW.Body.String())
+	createReq := `{"id":"chat-size","name":"A","session_id":"s-size","user_id":"u-size","channel":"console","meta":{}}`
+	if w := callJSONEndpoint(srv, http.MethodPost, "/chats", createReq); w.Code != http.StatusOK {
+		t.Fatalf("create status=%d body=%s", w.Code, w.Body.String())
 	}
-	if !strings.Contains(deleteW.Body.String(), `"code":"default_chat_protected"`) {
-		t.Fatalf("unexpected delete error body: %s", deleteW.Body.String())
+	if err := srv.store.Write(func(state *repo.State) error {
+		state.Histories["chat-size"] = []domain.RuntimeMessage{
+			{ID: "msg-size-1", Role: "user", Type: "message", Content: []domain.RuntimeContent{{Type: "text", Text: "你好 size"}}},
+			{ID: "msg-size-2", Role: "assistant", Type: "message", Content: []domain.RuntimeContent{{Type: "text", Text: "ok"}, {Type: "text", Text: "好的"}}},
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("seed history failed: %v", err)
 	}
 
-	batchDeleteW := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(batchDeleteW, httptest.NewRequest(http.MethodPost, "/chats/batch-delete", strings.NewReader(`["`+domain.DefaultChatID+`"]`)))
-	if batchDeleteW.Code != http.StatusBadRequest {
-		t.Fatalf("batch delete default chat status=%d body=%s", batchDeleteW.Code, batchDeleteW.Body.String())
+	leanW := callJSONEndpoint(srv, http.MethodGet, "/chats?user_id=u-size&channel=console", "")
+	if leanW.Code != http.StatusOK {
+		t.Fatalf("list chats status=%d body=%s", leanW.Code, leanW.Body.String())
 	}
-	if !strings.Contains(batchDeleteW.Body.String(), `"code":"default_chat_protected"`) {
-		t.Fatalf("unexpected batch delete error body: %s", batchDeleteW.Body.String())
+	if strings.Contains(leanW.Body.String(), `"approx_chars"`) {
+		t.Fatalf("approx_chars should be omitted by default: %s", leanW.Body.String())
 	}
 
-	listW := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(listW, httptest.NewRequest(http.MethodGet, "/chats?user_id=demo-user&channel=console", nil))
-	if listW.Code != http.StatusOK {
-		t.Fatalf("list chats status=%d body=%s", listW.Code, listW.Body.String())
+	sizedW := callJSONEndpoint(srv, http.MethodGet, "/chats?user_id=u-size&channel=console&include_size=true", "")
+	if sizedW.Code != http.StatusOK {
+		t.Fatalf("list chats status=%d body=%s", sizedW.Code, sizedW.Body.String())
 	}
-	if !strings.Contains(listW.Body.String(), `"id":"`+domain.DefaultChatID+`"`) {
-		t.Fatalf("default chat should still exist after delete attempts: %s", listW.Body.String())
+	var chats []domain.ChatSpec
+	if err := json.Unmarshal(sizedW.Body.Bytes(), &chats); err != nil {
+		t.Fatalf("decode chats failed: %v body=%s", err, sizedW.Body.String())
+	}
+	if len(chats) != 1 || chats[0].ApproxChars == nil {
+		t.Fatalf("expected one chat with approx_chars, body=%s", sizedW.Body.String())
+	}
+	// "你好 size" is 7 runes, "ok" 2 and "好的" 2.
+	if *chats[0].ApproxChars != 11 {
+		t.Fatalf("unexpected approx_chars=%d, want=11", *chats[0].ApproxChars)
 	}
 }
 
-func TestListCronJobsContainsDefaultCronJob(t *testing.T) {
+func TestUpdateChatIgnoresClientApproxChars(t *testing.T) {
 	srv := newTestServer(t)
 
-	listW := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(listW, httptest.NewRequest(http.MethodGet, "/cron/jobs", nil))
-	if listW.Code != http.StatusOK {
-		t.Fatalf("list cron jobs status=%d body=%s", listW.Code, listW.Body.String())
+	createReq := `{"id":"chat-size-put","name":"A","session_id":"s-size-put","user_id":"u-size-put","channel":"console","meta":{}}`
+	if w := callJSONEndpoint(srv, http.MethodPost, "/chats", createReq); w.Code != http.StatusOK {
+		t.Fatalf("create status=%d body=%s", w.Code, w.Body.String())
+	}
+	updateReq := `{"id":"chat-size-put","name":"B","session_id":"s-size-put","user_id":"u-size-put","channel":"console","meta":{},"approx_chars":999}`
+	w := callJSONEndpoint(srv, http.MethodPut, "/chats/chat-size-put", updateReq)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update status=%d body=%s", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), `"approx_chars"`) {
+		t.Fatalf("update should not echo approx_chars: %s", w.Body.String())
 	}
+	srv.store.Read(func(state *repo.State) {
+		if chat := state.Chats["chat-size-put"]; chat.Name != "B" || chat.ApproxChars != nil {
+			t.Fatalf("approx_chars should not be stored, got=%#v", chat)
+		}
+	})
+}
 
-	var jobs []domain.CronJobSpec
-	if err := json.Unmarshal(listW.Body.Bytes(), &jobs); err != nil {
-		t.Fatalf("decode cron jobs failed: %v body=%s", err, listW.Body.String())
+func TestSoftDeleteChatCanBeRestored(t *testing.T) {
+	srv := newTestServer(t)
+
+	createReq := `{"id":"chat-soft","name":"A","session_id":"s-soft","user_id":"u-soft","channel":"console","meta":{}}`
+	if w := callJSONEndpoint(srv, http.MethodPost, "/chats", createReq); w.Code != http.StatusOK {
+		t.Fatalf("create status=%d body=%s", w.Code, w.Body.String())
+	}
+	if err := srv.store.Write(func(state *repo.State) error {
+		state.Histories["chat-soft"] = []domain.RuntimeMessage{{
+			ID:      "msg-soft",
+			Role:    "user",
+			Type:    "message",
+			Content: []domain.RuntimeContent{{Type: "text", Text: "keep me"}},
+		}}
+		return nil
+	}); err != nil {
+		t.Fatalf("seed history failed: %v", err)
 	}
 
-	var defaultJob *domain.CronJobSpec
-	for i := range jobs {
-		if jobs[i].ID == domain.DefaultCronJobID {
-			defaultJob = &jobs[i]
-			break
-		}
+	if w := callJSONEndpoint(srv, http.MethodDelete, "/chats/chat-soft?soft=true", ""); w.Code != http.StatusOK {
+		t.Fatalf("soft delete status=%d body=%s", w.Code, w.Body.String())
 	}
-	if defaultJob == nil {
-		t.Fatalf("default cron job should exist in list: %s", listW.Body.String())
+	if w := callJSONEndpoint(srv, http.MethodGet, "/chats/chat-soft", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("soft deleted chat should be gone, status=%d body=%s", w.Code, w.Body.String())
 	}
-	if defaultJob.TaskType != "text" {
-		t.Fatalf("unexpected default cron task_type: %q", defaultJob.TaskType)
+	srv.store.Read(func(state *repo.State) {
+		entry, ok := state.DeletedChats["chat-soft"]
+		if !ok || entry.DeletedAt == "" || len(entry.History) != 1 {
+			t.Fatalf("expected chat in recycle bin, got=%#v", entry)
+		}
+	})
+
+	restoreW := callJSONEndpoint(srv, http.MethodPost, "/chats/chat-soft/restore", "")
+	if restoreW.Code != http.StatusOK {
+		t.Fatalf("restore status=%d body=%s", restoreW.Code, restoreW.Body.String())
 	}
-	if defaultJob.Text != domain.DefaultCronJobText {
-		t.Fatalf("unexpected default cron text: %q", defaultJob.Text)
+	historyW := callJSONEndpoint(srv, http.MethodGet, "/chats/chat-soft", "")
+	if historyW.Code != http.StatusOK || !strings.Contains(historyW.Body.String(), "keep me") {
+		t.Fatalf("restored chat should keep history, status=%d body=%s", historyW.Code, historyW.Body.String())
 	}
-	if defaultJob.Enabled {
-		t.Fatalf("default cron job should be disabled by default")
+	if w := callJSONEndpoint(srv, http.MethodPost, "/chats/chat-soft/restore", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("second restore should be not found, status=%d body=%s", w.Code, w.Body.String())
 	}
-	flag, ok := defaultJob.Meta[domain.CronMetaSystemDefault].(bool)
-	if !ok || !flag {
-		t.Fatalf("default cron should have meta.system_default=true, meta=%#v", defaultJob.Meta)
+
+	if w := callJSONEndpoint(srv, http.MethodDelete, "/chats/chat-soft", ""); w.Code != http.StatusOK {
+		t.Fatalf("hard delete status=%d body=%s", w.Code, w.Body.String())
+	}
+	if w := callJSONEndpoint(srv, http.MethodPost, "/chats/chat-soft/restore", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("hard deleted chat should not be restorable, status=%d body=%s", w.Code, w.Body.String())
 	}
 }
 
-func TestDeleteDefaultCronJobRejected(t *testing.T) {
+func TestRestoreChatRejectsLiveChatWithSameID(t *testing.T) {
 	srv := newTestServer(t)
 
-	deleteW := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(deleteW, httptest.NewRequest(http.MethodDelete, "/cron/jobs/"+domain.DefaultCronJobID, nil))
-	if deleteW.Code != http.StatusBadRequest {
-		t.Fatalf("delete default cron status=%d body=%s", deleteW.Code, deleteW.Body.String())
+	createReq := `{"id":"chat-reused","name":"old","session_id":"s-old","user_id":"u-reused","channel":"console","meta":{}}`
+	if w := callJSONEndpoint(srv, http.MethodPost, "/chats", createReq); w.Code != http.StatusOK {
+		t.Fatalf("create status=%d body=%s", w.Code, w.Body.String())
 	}
-	if !strings.Contains(deleteW.Body.String(), `"code":"default_cron_protected"`) {
-		t.Fatalf("unexpected delete default cron body: %s", deleteW.Body.String())
+	if w := callJSONEndpoint(srv, http.MethodDelete, "/chats/chat-reused?soft=true", ""); w.Code != http.StatusOK {
+		t.Fatalf("soft delete status=%d body=%s", w.Code, w.Body.String())
 	}
-
-	listW := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(listW, httptest.NewRequest(http.MethodGet, "/cron/jobs", nil))
-	if listW.Code != http.StatusOK {
-		t.Fatalf("list cron jobs status=%d body=%s", listW.Code, listW.Body.String())
+	liveReq := `{"id":"chat-reused","name":"live","session_id":"s-live","user_id":"u-reused","channel":"console","meta":{}}`
+	if w := callJSONEndpoint(srv, http.MethodPost, "/chats", liveReq); w.Code != http.StatusOK {
+		t.Fatalf("create live status=%d body=%s", w.Code, w.Body.String())
 	}
-	if !strings.Contains(listW.Body.String(), `"id":"`+domain.DefaultCronJobID+`"`) {
-		t.Fatalf("default cron job should still exist after delete attempt: %s", listW.Body.String())
+
+	w := callJSONEndpoint(srv, http.MethodPost, "/chats/chat-reused/restore", "")
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), `"code":"chat_id_conflict"`) {
+		t.Fatalf("expected 409 chat_id_conflict, status=%d body=%s", w.Code, w.Body.String())
 	}
+	srv.store.Read(func(state *repo.State) {
+		if state.Chats["chat-reused"].Name != "live" {
+			t.Fatalf("live chat should be untouched, got=%#v", state.Chats["chat-reused"])
+		}
+		if _, ok := state.DeletedChats["chat-reused"]; !ok {
+			t.Fatalf("deleted chat should stay in the recycle bin")
+		}
+	})
 }
-func TestProcessAgentReusesChatHistoryContext(t *testing.T) {
-	srv := newTestServer(t)
 
-	firstReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"1+1等于几"}]}],"session_id":"s-context","user_id":"u-context","channel":"console","stream":false}`
-	firstW := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(firstW, httptest.NewRequest(http.MethodPost, "/agent/process", strings.NewReader(firstReq)))
-	if firstW.Code != http.StatusOK {
-		t.Fatalf("first process status=%d body=%s", firstW.Code, firstW.Body.String())
-	}
+func TestSoftDeleteRefusesToReplaceRecycleBinEntry(t *testing.T) {
+	srv := newTestServer(t)
 
-	secondReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"把你之前回答的数学问题再回答一次"}]}],"session_id":"s-context","user_id":"u-context","channel":"console","stream":false}`
-	secondW := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(secondW, httptest.NewRequest(http.MethodPost, "/agent/process", strings.NewReader(secondReq)))
-	if secondW.Code != http.StatusOK {
-		t.Fatalf("second process status=%d body=%s", secondW.Code, secondW.Body.String())
+	firstReq := `{"id":"chat-twice","name":"first","session_id":"s-first","user_id":"u-twice","channel":"console","meta":{}}`
+	if w := callJSONEndpoint(srv, http.MethodPost, "/chats", firstReq); w.Code != http.StatusOK {
+		t.Fatalf("create status=%d body=%s", w.Code, w.Body.String())
 	}
-
-	var secondResp domain.AgentProcessResponse
-	if err := json.Unmarshal(secondW.Body.Bytes(), &secondResp); err != nil {
-		t.Fatalf("decode second response failed: %v body=%s", err, secondW.Body.String())
+	if w := callJSONEndpoint(srv, http.MethodDelete, "/chats/chat-twice?soft=true", ""); w.Code != http.StatusOK {
+		t.Fatalf("soft delete status=%d body=%s", w.Code, w.Body.String())
 	}
-	if !strings.Contains(secondResp.Reply, "1+1等于几") {
-		t.Fatalf("expected second reply to include previous user context, got=%q", secondResp.Reply)
+	secondReq := `{"id":"chat-twice","name":"second","session_id":"s-second","user_id":"u-twice","channel":"console","meta":{}}`
+	if w := callJSONEndpoint(srv, http.MethodPost, "/chats", secondReq); w.Code != http.StatusOK {
+		t.Fatalf("recreate status=%d body=%s", w.Code, w.Body.String())
 	}
-	if !strings.Contains(secondResp.Reply, "把你之前回答的数学问题再回答一次") {
-		t.Fatalf("expected second reply to include latest user input, got=%q", secondResp.Reply)
+
+	w := callJSONEndpoint(srv, http.MethodDelete, "/chats/chat-twice?soft=true", "")
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), `"code":"deleted_chat_exists"`) {
+		t.Fatalf("expected 409 deleted_chat_exists, status=%d body=%s", w.Code, w.Body.String())
 	}
+	srv.store.Read(func(state *repo.State) {
+		if state.DeletedChats["chat-twice"].Chat.Name != "first" {
+			t.Fatalf("recycle bin copy should be kept, got=%#v", state.DeletedChats["chat-twice"])
+		}
+		if state.Chats["chat-twice"].Name != "second" {
+			t.Fatalf("live chat should stay after the refused soft delete, got=%#v", state.Chats["chat-twice"])
+		}
+	})
 }
 
-func TestProcessAgentPersistsToolCallNoticesInHistory(t *testing.T) {
+func TestPurgeExpiredDeletedChatsHonorsRetention(t *testing.T) {
 	srv := newTestServer(t)
-	_, absPath := newToolTestPath(t, "history-tool-call")
-	if err := os.WriteFile(absPath, []byte("line-1\nline-2\n"), 0o644); err != nil {
-		t.Fatalf("seed tool test file failed: %v", err)
+	now := time.Now().UTC()
+	if err := srv.store.Write(func(state *repo.State) error {
+		state.DeletedChats["chat-old"] = domain.DeletedChat{
+			Chat:      domain.ChatSpec{ID: "chat-old"},
+			DeletedAt: now.Add(-8 * 24 * time.Hour).Format(time.RFC3339),
+		}
+		state.DeletedChats["chat-recent"] = domain.DeletedChat{
+			Chat:      domain.ChatSpec{ID: "chat-recent"},
+			DeletedAt: now.Add(-time.Hour).Format(time.RFC3339),
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("seed recycle bin failed: %v", err)
 	}
 
-	createReq := `{"name":"A","session_id":"s-history-tool","user_id":"u-history-tool","channel":"console","meta":{}}`
-	w1 := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(w1, httptest.NewRequest(http.MethodPost, "/chats", strings.NewReader(createReq)))
-	if w1.Code != http.StatusOK {
-		t.Fatalf("create status=%d body=%s", w1.Code, w1.Body.String())
+	if purged, err := srv.purgeExpiredDeletedChats(now, 0); err != nil || purged != 0 {
+		t.Fatalf("retention 0 should keep deleted chats, purged=%d err=%v", purged, err)
 	}
-	var created map[string]interface{}
-	if err := json.Unmarshal(w1.Body.Bytes(), &created); err != nil {
-		t.Fatalf("decode create response failed: %v", err)
+
+	purged, err := srv.purgeExpiredDeletedChats(now, 7)
+	if err != nil {
+		t.Fatalf("purge failed: %v", err)
 	}
-	chatID, _ := created["id"].(string)
-	if strings.TrimSpace(chatID) == "" {
-		t.Fatalf("empty chat id: %v", created)
+	if purged != 1 {
+		t.Fatalf("expected one purged chat, got=%d", purged)
 	}
+	srv.store.Read(func(state *repo.State) {
+		if _, ok := state.DeletedChats["chat-old"]; ok {
+			t.Fatalf("expired chat should be purged")
+		}
+		if _, ok := state.DeletedChats["chat-recent"]; !ok {
+			t.Fatalf("recent chat should be kept")
+		}
+	})
+}
 
-	procReq := fmt.Sprintf(`{
-		"input":[{"role":"user","type":"message","content":[{"type":"text","text":"view history tool call"}]}],
-		"session_id":"s-history-tool",
-		"user_id":"u-history-tool",
-		"channel":"console",
-		"stream":false,
-		"view":[{"path":%q,"start":1,"end":1}]
-	}`, absPath)
-	w2 := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(w2, httptest.NewRequest(http.MethodPost, "/agent/process", strings.NewReader(procReq)))
-	if w2.Code != http.StatusOK {
-		t.Fatalf("process status=%d body=%s", w2.Code, w2.Body.String())
-	}
+func TestArchiveChatHidesFromListUntilUnarchived(t *testing.T) {
+	srv := newTestServer(t)
 
-	w3 := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(w3, httptest.NewRequest(http.MethodGet, "/chats/"+chatID, nil))
-	if w3.Code != http.StatusOK {
-		t.Fatalf("history status=%d body=%s", w3.Code, w3.Body.String())
+	createReq := `{"id":"chat-archive","name":"A","session_id":"s-archive","user_id":"u-archive","channel":"console","meta":{}}`
+	createW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(createW, httptest.NewRequest(http.MethodPost, "/chats", strings.NewReader(createReq)))
+	if createW.Code != http.StatusOK {
+		t.Fatalf("create status=%d body=%s", createW.Code, createW.Body.String())
 	}
 
-	var history domain.ChatHistory
-	if err := json.Unmarshal(w3.Body.Bytes(), &history); err != nil {
-		t.Fatalf("decode history failed: %v body=%s", err, w3.Body.String())
+	archiveW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(archiveW, httptest.NewRequest(http.MethodPost, "/chats/chat-archive/archive", nil))
+	if archiveW.Code != http.StatusOK {
+		t.Fatalf("archive status=%d body=%s", archiveW.Code, archiveW.Body.String())
 	}
-	if len(history.Messages) == 0 {
-		t.Fatalf("expected non-empty history, body=%s", w3.Body.String())
+	if !strings.Contains(archiveW.Body.String(), `"archived":true`) {
+		t.Fatalf("archive response should report archived=true: %s", archiveW.Body.String())
 	}
-	assistant := history.Messages[len(history.Messages)-1]
-	if assistant.Role != "assistant" {
-		t.Fatalf("expected assistant message at tail, got=%q", assistant.Role)
+
+	listW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(listW, httptest.NewRequest(http.MethodGet, "/chats?user_id=u-archive", nil))
+	if strings.Contains(listW.Body.String(), "chat-archive") {
+		t.Fatalf("archived chat should be hidden by default: %s", listW.Body.String())
 	}
-	if len(assistant.Metadata) == 0 {
-		t.Fatalf("expected assistant metadata, body=%s", w3.Body.String())
+	listAllW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(listAllW, httptest.NewRequest(http.MethodGet, "/chats?user_id=u-archive&include_archived=true", nil))
+	if !strings.Contains(listAllW.Body.String(), "chat-archive") {
+		t.Fatalf("archived chat should be listed with include_archived=true: %s", listAllW.Body.String())
 	}
-	rawNotices, ok := assistant.Metadata["tool_call_notices"].([]interface{})
-	if !ok || len(rawNotices) == 0 {
-		t.Fatalf("expected tool_call_notices metadata, got=%#v", assistant.Metadata["tool_call_notices"])
+	historyW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(historyW, httptest.NewRequest(http.MethodGet, "/chats/chat-archive", nil))
+	if historyW.Code != http.StatusOK {
+		t.Fatalf("archived chat history should stay readable, status=%d body=%s", historyW.Code, historyW.Body.String())
 	}
-	first, _ := rawNotices[0].(map[string]interface{})
-	raw, _ := first["raw"].(string)
-	if !strings.Contains(raw, `"type":"tool_result"`) || !strings.Contains(raw, `"name":"view"`) || !strings.Contains(raw, `line-1`) {
-		t.Fatalf("unexpected persisted tool notice raw: %q", raw)
+
+	unarchiveW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(unarchiveW, httptest.NewRequest(http.MethodPost, "/chats/chat-archive/unarchive", nil))
+	if unarchiveW.Code != http.StatusOK {
+		t.Fatalf("unarchive status=%d body=%s", unarchiveW.Code, unarchiveW.Body.String())
 	}
-	toolOrder, ok := assistant.Metadata["tool_order"].(float64)
-	if !ok || toolOrder <= 0 {
-		t.Fatalf("expected positive tool_order, got=%#v", assistant.Metadata["tool_order"])
+	listAfterW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(listAfterW, httptest.NewRequest(http.MethodGet, "/chats?user_id=u-archive", nil))
+	if !strings.Contains(listAfterW.Body.String(), "chat-archive") {
+		t.Fatalf("unarchived chat should be listed again: %s", listAfterW.Body.String())
 	}
-	textOrder, ok := assistant.Metadata["text_order"].(float64)
-	if !ok || textOrder <= 0 {
-		t.Fatalf("expected positive text_order, got=%#v", assistant.Metadata["text_order"])
+
+	missingW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(missingW, httptest.NewRequest(http.MethodPost, "/chats/chat-missing/archive", nil))
+	if missingW.Code != http.StatusNotFound {
+		t.Fatalf("archive missing chat status=%d body=%s", missingW.Code, missingW.Body.String())
+	}
+	defaultW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(defaultW, httptest.NewRequest(http.MethodPost, "/chats/"+domain.DefaultChatID+"/archive", nil))
+	if defaultW.Code != http.StatusBadRequest || !strings.Contains(defaultW.Body.String(), `"code":"default_chat_protected"`) {
+		t.Fatalf("archive default chat status=%d body=%s", defaultW.Code, defaultW.Body.String())
 	}
 }
 
-func TestProcessAgentRejectsUnsupportedChannel(t *testing.T) {
+func TestPatchChatRenamesWithoutTouchingMeta(t *testing.T) {
 	srv := newTestServer(t)
 
-	procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"hello"}]}],"session_id":"s1","user_id":"u1","channel":"sms","stream":false}`
-	w := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/agent/process", strings.NewReader(procReq)))
-	if w.Code != http.StatusBadRequest {
-		t.Fatalf("expected 400, got=%d body=%s", w.Code, w.Body.String())
+	createReq := `{"id":"chat-rename","name":"old","session_id":"s-rename","user_id":"u-rename","channel":"console","meta":{"keep":"yes"}}`
+	if w := callJSONEndpoint(srv, http.MethodPost, "/chats", createReq); w.Code != http.StatusOK {
+		t.Fatalf("create status=%d body=%s", w.Code, w.Body.String())
 	}
-	if !strings.Contains(w.Body.String(), `"code":"channel_not_supported"`) {
-		t.Fatalf("unexpected error body: %s", w.Body.String())
+
+	w := callJSONEndpoint(srv, http.MethodPatch, "/chats/chat-rename", `{"name":"  renamed  "}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("rename status=%d body=%s", w.Code, w.Body.String())
+	}
+	var chat domain.ChatSpec
+	if err := json.Unmarshal(w.Body.Bytes(), &chat); err != nil {
+		t.Fatalf("decode chat failed: %v body=%s", err, w.Body.String())
+	}
+	if chat.Name != "renamed" || chat.SessionID != "s-rename" || chat.Meta["keep"] != "yes" {
+		t.Fatalf("unexpected renamed chat: %#v", chat)
 	}
-}
 
-func TestProcessAgentRespectsRequestedChannelForWebSource(t *testing.T) {
-	var tokenCalls atomic.Int32
-	var messageCalls atomic.Int32
+	if w := callJSONEndpoint(srv, http.MethodPatch, "/chats/chat-rename", `{"name":" "}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("empty name status=%d body=%s", w.Code, w.Body.String())
+	}
+	if w := callJSONEndpoint(srv, http.MethodPatch, "/chats/chat-missing", `{"name":"x"}`); w.Code != http.StatusNotFound {
+		t.Fatalf("missing chat status=%d body=%s", w.Code, w.Body.String())
+	}
+}
 
-	qqAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		switch r.URL.Path {
-		case "/token":
-			tokenCalls.Add(1)
-			w.Header().Set("Content-Type", "application/json")
-			_, _ = w.Write([]byte(`{"access_token":"qq-token","expires_in":7200}`))
-		case "/v2/users/u-web-auto/messages":
-			messageCalls.Add(1)
-			w.WriteHeader(http.StatusOK)
-		default:
-			t.Fatalf("unexpected qq path: %s", r.URL.Path)
+func TestChatSystemPromptInjectedAndSurvivesContextReset(t *testing.T) {
+	var lastMessages []map[string]interface{}
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/chat/completions" {
+			w.WriteHeader(http.StatusNotFound)
+			return
 		}
+		var body struct {
+			Messages []map[string]interface{} `json:"messages"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		lastMessages = body.Messages
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"ahoy"}}]}`))
 	}))
-	defer qqAPI.Close()
+	defer mock.Close()
 
 	srv := newTestServer(t)
-	configW := httptest.NewRecorder()
-	channelConfig := `{"enabled":true,"app_id":"app-1","client_secret":"secret-1","token_url":"` + qqAPI.URL + `/token","api_base":"` + qqAPI.URL + `","target_type":"c2c"}`
-	srv.Handler().ServeHTTP(configW, httptest.NewRequest(http.MethodPut, "/config/channels/qq", strings.NewReader(channelConfig)))
-	if configW.Code != http.StatusOK {
-		t.Fatalf("config qq status=%d body=%s", configW.Code, configW.Body.String())
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/openai/config", `{"enabled":true,"api_key":"sk-test","base_url":"`+mock.URL+`"}`); w.Code != http.StatusOK {
+		t.Fatalf("configure provider status=%d body=%s", w.Code, w.Body.String())
 	}
-
-	procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"hello from web source"}]}],"session_id":"s-web-auto","user_id":"u-web-auto","channel":"qq","stream":false}`
-	req := httptest.NewRequest(http.MethodPost, "/agent/process", strings.NewReader(procReq))
-	req.Header.Set(channelSourceHeader, "web")
-	w := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(w, req)
-	if w.Code != http.StatusOK {
-		t.Fatalf("process status=%d body=%s", w.Code, w.Body.String())
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/active", `{"provider_id":"openai","model":"gpt-4o-mini"}`); w.Code != http.StatusOK {
+		t.Fatalf("set active status=%d body=%s", w.Code, w.Body.String())
 	}
-
-	chatsW := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(chatsW, httptest.NewRequest(http.MethodGet, "/chats?user_id=u-web-auto&channel=qq", nil))
-	if chatsW.Code != http.StatusOK {
-		t.Fatalf("list qq chats status=%d body=%s", chatsW.Code, chatsW.Body.String())
+	createReq := `{"id":"chat-persona","name":"persona","session_id":"s-persona","user_id":"u-persona","channel":"console"}`
+	if w := callJSONEndpoint(srv, http.MethodPost, "/chats", createReq); w.Code != http.StatusOK {
+		t.Fatalf("create status=%d body=%s", w.Code, w.Body.String())
 	}
-	var qqChats []domain.ChatSpec
-	if err := json.Unmarshal(chatsW.Body.Bytes(), &qqChats); err != nil {
-		t.Fatalf("decode qq chats failed: %v body=%s", err, chatsW.Body.String())
+	w := callJSONEndpoint(srv, http.MethodPatch, "/chats/chat-persona", `{"system_prompt":"  You are a pirate.  "}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("patch status=%d body=%s", w.Code, w.Body.String())
 	}
-	if len(qqChats) != 1 {
-		t.Fatalf("expected one qq chat, got=%d body=%s", len(qqChats), chatsW.Body.String())
+	var chat domain.ChatSpec
+	if err := json.Unmarshal(w.Body.Bytes(), &chat); err != nil {
+		t.Fatalf("decode chat failed: %v", err)
 	}
-	if qqChats[0].Channel != "qq" {
-		t.Fatalf("expected chat channel qq, got=%q", qqChats[0].Channel)
+	if chat.Name != "persona" || chat.Meta["system_prompt"] != "You are a pirate." {
+		t.Fatalf("unexpected patched chat: %#v", chat)
 	}
 
-	consoleChatsW := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(consoleChatsW, httptest.NewRequest(http.MethodGet, "/chats?user_id=u-web-auto&channel=console", nil))
-	if consoleChatsW.Code != http.StatusOK {
-		t.Fatalf("list console chats status=%d body=%s", consoleChatsW.Code, consoleChatsW.Body.String())
-	}
-	var consoleChats []domain.ChatSpec
-	if err := json.Unmarshal(consoleChatsW.Body.Bytes(), &consoleChats); err != nil {
-		t.Fatalf("decode console chats failed: %v body=%s", err, consoleChatsW.Body.String())
-	}
-	if len(consoleChats) != 0 {
-		t.Fatalf("expected no console chats, got=%d body=%s", len(consoleChats), consoleChatsW.Body.String())
-	}
-	if got := tokenCalls.Load(); got != 1 {
-		t.Fatalf("expected one token call, got=%d", got)
-	}
-	if got := messageCalls.Load(); got != 1 {
-		t.Fatalf("expected one qq message call, got=%d", got)
+	assertPersonaIsLastSystemMessage := func() {
+		t.Helper()
+		lastSystem := -1
+		for idx, msg := range lastMessages {
+			if msg["role"] == "system" {
+				lastSystem = idx
+			}
+		}
+		if lastSystem < 1 {
+			t.Fatalf("expected global system layers before persona, messages=%#v", lastMessages)
+		}
+		content, _ := lastMessages[lastSystem]["content"].(string)
+		if !strings.Contains(content, "You are a pirate.") {
+			t.Fatalf("expected persona as last system message, got=%q", content)
+		}
 	}
-}
-
-func TestProcessAgentDefaultsToConsoleForCLISourceWithoutChannel(t *testing.T) {
-	srv := newTestServer(t)
 
-	procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"hello from cli source"}]}],"session_id":"s-cli-auto","user_id":"u-cli-auto","stream":false}`
-	req := httptest.NewRequest(http.MethodPost, "/agent/process", strings.NewReader(procReq))
-	req.Header.Set(channelSourceHeader, "cli")
-	w := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(w, req)
-	if w.Code != http.StatusOK {
+	procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"hi"}]}],"session_id":"s-persona","user_id":"u-persona","channel":"console","stream":false}`
+	if w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq); w.Code != http.StatusOK {
 		t.Fatalf("process status=%d body=%s", w.Code, w.Body.String())
 	}
+	assertPersonaIsLastSystemMessage()
 
-	chatsW := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(chatsW, httptest.NewRequest(http.MethodGet, "/chats?user_id=u-cli-auto&channel=console", nil))
-	if chatsW.Code != http.StatusOK {
-		t.Fatalf("list console chats status=%d body=%s", chatsW.Code, chatsW.Body.String())
+	resetReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"/new"}]}],"session_id":"s-persona","user_id":"u-persona","channel":"console","stream":false}`
+	if w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", resetReq); w.Code != http.StatusOK {
+		t.Fatalf("reset status=%d body=%s", w.Code, w.Body.String())
 	}
-	var chats []domain.ChatSpec
-	if err := json.Unmarshal(chatsW.Body.Bytes(), &chats); err != nil {
-		t.Fatalf("decode chats failed: %v body=%s", err, chatsW.Body.String())
+	lastMessages = nil
+	if w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq); w.Code != http.StatusOK {
+		t.Fatalf("process after reset status=%d body=%s", w.Code, w.Body.String())
 	}
-	if len(chats) != 1 {
-		t.Fatalf("expected one console chat, got=%d body=%s", len(chats), chatsW.Body.String())
+	assertPersonaIsLastSystemMessage()
+	userMessages := 0
+	for _, msg := range lastMessages {
+		if msg["role"] == "user" {
+			userMessages++
+		}
 	}
-	if chats[0].Channel != "console" {
-		t.Fatalf("expected chat channel console, got=%q", chats[0].Channel)
+	if userMessages != 1 {
+		t.Fatalf("expected history to be cleared by /new, got %d user messages", userMessages)
 	}
 }
 
-func TestProcessAgentDispatchesToWebhookChannel(t *testing.T) {
-	var received atomic.Int32
-	var gotBody map[string]interface{}
-	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		received.Add(1)
-		if r.Header.Get("X-Test-Token") != "abc123" {
-			t.Fatalf("unexpected webhook header: %s", r.Header.Get("X-Test-Token"))
+func TestSummarizeChatReplacesOlderHistory(t *testing.T) {
+	summaryCalls := 0
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/chat/completions" {
+			w.WriteHeader(http.StatusNotFound)
+			return
 		}
-		defer r.Body.Close()
-		if err := json.NewDecoder(r.Body).Decode(&gotBody); err != nil {
-			t.Fatalf("decode webhook body failed: %v", err)
+		raw, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(raw), "Summarize the conversation below") {
+			summaryCalls++
+			if !strings.Contains(string(raw), "turn one") || strings.Contains(string(raw), "turn four") {
+				t.Errorf("expected only older messages in summary input, body=%s", raw)
+			}
+			_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"User walked through turns one and two."}}]}`))
+			return
 		}
-		w.WriteHeader(http.StatusNoContent)
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"noted"}}]}`))
 	}))
-	defer webhook.Close()
+	defer mock.Close()
 
 	srv := newTestServer(t)
-	channelConfig := `{"enabled":true,"url":"` + webhook.URL + `","headers":{"X-Test-Token":"abc123"}}`
-	configW := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(configW, httptest.NewRequest(http.MethodPut, "/config/channels/webhook", strings.NewReader(channelConfig)))
-	if configW.Code != http.StatusOK {
-		t.Fatalf("set channel config status=%d body=%s", configW.Code, configW.Body.String())
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/openai/config", `{"enabled":true,"api_key":"sk-test","base_url":"`+mock.URL+`"}`); w.Code != http.StatusOK {
+		t.Fatalf("configure provider status=%d body=%s", w.Code, w.Body.String())
+	}
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/active", `{"provider_id":"openai","model":"gpt-4o-mini"}`); w.Code != http.StatusOK {
+		t.Fatalf("set active status=%d body=%s", w.Code, w.Body.String())
+	}
+	createReq := `{"id":"chat-compact","name":"compact","session_id":"s-compact","user_id":"u-compact","channel":"console"}`
+	if w := callJSONEndpoint(srv, http.MethodPost, "/chats", createReq); w.Code != http.StatusOK {
+		t.Fatalf("create status=%d body=%s", w.Code, w.Body.String())
+	}
+	sendTurn := func(text string) {
+		t.Helper()
+		procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"` + text + `"}]}],"session_id":"s-compact","user_id":"u-compact","channel":"console","stream":false}`
+		if w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq); w.Code != http.StatusOK {
+			t.Fatalf("process status=%d body=%s", w.Code, w.Body.String())
+		}
 	}
 
-	procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"hello webhook"}]}],"session_id":"s1","user_id":"u1","channel":"webhook","stream":false}`
-	w := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/agent/process", strings.NewReader(procReq)))
+	sendTurn("turn one")
+	w := callJSONEndpoint(srv, http.MethodPost, "/chats/chat-compact/summarize", "")
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "insufficient_history") {
+		t.Fatalf("expected insufficient_history, status=%d body=%s", w.Code, w.Body.String())
+	}
+	sendTurn("turn two")
+	sendTurn("turn three")
+	sendTurn("turn four")
+
+	w = callJSONEndpoint(srv, http.MethodPost, "/chats/chat-compact/summarize", "")
 	if w.Code != http.StatusOK {
-		t.Fatalf("process status=%d body=%s", w.Code, w.Body.String())
+		t.Fatalf("summarize status=%d body=%s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Summary            string `json:"summary"`
+		SummarizedMessages int    `json:"summarized_messages"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode summarize response: %v", err)
+	}
+	if summaryCalls != 1 || resp.Summary != "User walked through turns one and two." || resp.SummarizedMessages != 4 {
+		t.Fatalf("unexpected summarize result calls=%d resp=%#v", summaryCalls, resp)
 	}
 
-	if got := received.Load(); got != 1 {
-		t.Fatalf("expected one webhook call, got=%d", got)
+	w = callJSONEndpoint(srv, http.MethodGet, "/chats/chat-compact", "")
+	var history domain.ChatHistory
+	if err := json.Unmarshal(w.Body.Bytes(), &history); err != nil {
+		t.Fatalf("decode history: %v", err)
 	}
-	if gotBody["user_id"] != "u1" {
-		t.Fatalf("unexpected webhook user_id: %#v", gotBody["user_id"])
+	if len(history.Messages) != 5 {
+		t.Fatalf("expected summary plus 4 recent messages, got=%d", len(history.Messages))
 	}
-	if gotBody["session_id"] != "s1" {
-		t.Fatalf("unexpected webhook session_id: %#v", gotBody["session_id"])
+	first := history.Messages[0]
+	if first.Role != "system" || first.Metadata["summary"] != true || !strings.Contains(first.Content[0].Text, "turns one and two") {
+		t.Fatalf("unexpected summary message: %#v", first)
 	}
-	if text, _ := gotBody["text"].(string); !strings.Contains(text, "Echo: hello webhook") {
-		t.Fatalf("unexpected webhook text: %#v", gotBody["text"])
+	if history.Messages[1].Content[0].Text != "turn three" {
+		t.Fatalf("expected recent messages to be kept, got=%#v", history.Messages[1])
 	}
 }
 
-func TestProcessAgentQQChannelDispatchesOutboundMessage(t *testing.T) {
-	var tokenCalls atomic.Int32
-	var messageCalls atomic.Int32
-
-	qqAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		switch r.URL.Path {
-		case "/token":
-			tokenCalls.Add(1)
-			w.Header().Set("Content-Type", "application/json")
-			_, _ = w.Write([]byte(`{"access_token":"qq-token","expires_in":7200}`))
-		case "/v2/users/u1/messages":
-			messageCalls.Add(1)
-			w.WriteHeader(http.StatusOK)
-		default:
-			t.Fatalf("unexpected qq path: %s", r.URL.Path)
-		}
-	}))
-	defer qqAPI.Close()
-
+func TestSummarizeChatRequiresConfiguredModel(t *testing.T) {
 	srv := newTestServer(t)
-	channelConfig := `{"enabled":true,"app_id":"app-1","client_secret":"secret-1","bot_prefix":"[BOT] ","token_url":"` + qqAPI.URL + `/token","api_base":"` + qqAPI.URL + `","target_type":"c2c"}`
-	configW := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(configW, httptest.NewRequest(http.MethodPut, "/config/channels/qq", strings.NewReader(channelConfig)))
-	if configW.Code != http.StatusOK {
-		t.Fatalf("set qq channel config status=%d body=%s", configW.Code, configW.Body.String())
+	createReq := `{"id":"chat-compact-demo","name":"compact","session_id":"s-compact-demo","user_id":"u-compact","channel":"console"}`
+	if w := callJSONEndpoint(srv, http.MethodPost, "/chats", createReq); w.Code != http.StatusOK {
+		t.Fatalf("create status=%d body=%s", w.Code, w.Body.String())
+	}
+	for _, text := range []string{"turn one", "turn two", "turn three"} {
+		procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"` + text + `"}]}],"session_id":"s-compact-demo","user_id":"u-compact","channel":"console","stream":false}`
+		if w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq); w.Code != http.StatusOK {
+			t.Fatalf("process status=%d body=%s", w.Code, w.Body.String())
+		}
 	}
 
-	procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"hello qq"}]}],"session_id":"s1","user_id":"u1","channel":"qq","stream":false}`
-	w := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/agent/process", strings.NewReader(procReq)))
-	if w.Code != http.StatusOK {
-		t.Fatalf("process status=%d body=%s", w.Code, w.Body.String())
+	w := callJSONEndpoint(srv, http.MethodPost, "/chats/chat-compact-demo/summarize", "")
+	assertAPIError(t, w, http.StatusBadRequest, "model_not_configured", "summarizing needs a configured model; set an active model first")
+	var history domain.ChatHistory
+	if err := json.Unmarshal(callJSONEndpoint(srv, http.MethodGet, "/chats/chat-compact-demo", "").Body.Bytes(), &history); err != nil {
+		t.Fatalf("decode history: %v", err)
 	}
-	if !strings.Contains(w.Body.String(), "Echo: hello qq") {
-		t.Fatalf("unexpected process body: %s", w.Body.String())
+	if len(history.Messages) != 6 {
+		t.Fatalf("history must be left untouched, got=%d messages", len(history.Messages))
 	}
-	if got := tokenCalls.Load(); got != 1 {
-		t.Fatalf("expected one token call, got=%d", got)
+}
+
+func TestChatSystemPromptValidation(t *testing.T) {
+	srv := newTestServer(t)
+	createReq := `{"id":"chat-persona-bad","name":"persona","session_id":"s-persona-bad","user_id":"u","channel":"console","meta":{"system_prompt":42}}`
+	if w := callJSONEndpoint(srv, http.MethodPost, "/chats", createReq); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected non-string system_prompt to be rejected, status=%d body=%s", w.Code, w.Body.String())
 	}
-	if got := messageCalls.Load(); got != 1 {
-		t.Fatalf("expected one qq message call, got=%d", got)
+	if w := callJSONEndpoint(srv, http.MethodPatch, "/chats/"+domain.DefaultChatID, `{}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected empty patch to be rejected, status=%d body=%s", w.Code, w.Body.String())
+	}
+	tooLong := strings.Repeat("x", chatSystemPromptMaxRunes+1)
+	if w := callJSONEndpoint(srv, http.MethodPatch, "/chats/"+domain.DefaultChatID, `{"system_prompt":"`+tooLong+`"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected oversized system_prompt to be rejected, status=%d", w.Code)
 	}
 }
 
-func TestProcessAgentNewCommandClearsSessionContext(t *testing.T) {
-	srv := newTestServer(t)
+func TestAgentProcessInjectsSelectedSkills(t *testing.T) {
+	var lastMessages []map[string]interface{}
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Messages []map[string]interface{} `json:"messages"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		lastMessages = body.Messages
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"ok"}}]}`))
+	}))
+	defer mock.Close()
 
-	firstReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"hello before reset"}]}],"session_id":"s-reset","user_id":"u-reset","channel":"console","stream":false}`
-	firstW := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(firstW, httptest.NewRequest(http.MethodPost, "/agent/process", strings.NewReader(firstReq)))
-	if firstW.Code != http.StatusOK {
-		t.Fatalf("first process status=%d body=%s", firstW.Code, firstW.Body.String())
+	srv := newTestServer(t)
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/openai/config", `{"enabled":true,"api_key":"sk-test","base_url":"`+mock.URL+`"}`); w.Code != http.StatusOK {
+		t.Fatalf("configure provider status=%d body=%s", w.Code, w.Body.String())
+	}
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/active", `{"provider_id":"openai","model":"gpt-4o-mini"}`); w.Code != http.StatusOK {
+		t.Fatalf("set active status=%d body=%s", w.Code, w.Body.String())
+	}
+	for _, body := range []string{
+		`{"name":"haiku","content":"Answer in haiku."}`,
+		`{"name":"terse","content":"Keep answers short."}`,
+		`{"name":"legacy","content":"Use legacy formatting."}`,
+	} {
+		if w := callJSONEndpoint(srv, http.MethodPost, "/skills", body); w.Code != http.StatusOK {
+			t.Fatalf("create skill status=%d body=%s", w.Code, w.Body.String())
+		}
+	}
+	if w := callJSONEndpoint(srv, http.MethodPost, "/skills/legacy/disable", ``); w.Code != http.StatusOK {
+		t.Fatalf("disable skill status=%d body=%s", w.Code, w.Body.String())
 	}
 
-	chatsBeforeResetW := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(chatsBeforeResetW, httptest.NewRequest(http.MethodGet, "/chats?user_id=u-reset&channel=console", nil))
-	if chatsBeforeResetW.Code != http.StatusOK {
-		t.Fatalf("list chats before reset status=%d body=%s", chatsBeforeResetW.Code, chatsBeforeResetW.Body.String())
+	systemText := func() string {
+		parts := []string{}
+		for _, msg := range lastMessages {
+			if msg["role"] == "system" {
+				content, _ := msg["content"].(string)
+				parts = append(parts, content)
+			}
+		}
+		return strings.Join(parts, "\n")
+	}
+	process := func(extra string) {
+		t.Helper()
+		procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"hi"}]}],"session_id":"s-skills","user_id":"u-skills","channel":"console","stream":false` + extra + `}`
+		if w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq); w.Code != http.StatusOK {
+			t.Fatalf("process status=%d body=%s", w.Code, w.Body.String())
+		}
 	}
 
-	var chatsBeforeReset []domain.ChatSpec
-	if err := json.Unmarshal(chatsBeforeResetW.Body.Bytes(), &chatsBeforeReset); err != nil {
-		t.Fatalf("decode chats before reset failed: %v body=%s", err, chatsBeforeResetW.Body.String())
+	process("")
+	if got := systemText(); !strings.Contains(got, "Answer in haiku.") || !strings.Contains(got, "Keep answers short.") || strings.Contains(got, "Use legacy formatting.") {
+		t.Fatalf("expected every enabled skill injected, system=%q", got)
 	}
-	if len(chatsBeforeReset) != 1 {
-		t.Fatalf("expected one chat before reset, got=%d body=%s", len(chatsBeforeReset), chatsBeforeResetW.Body.String())
+
+	process(`,"skills":["terse"]`)
+	if got := systemText(); strings.Contains(got, "Answer in haiku.") || !strings.Contains(got, "Keep answers short.") {
+		t.Fatalf("expected only requested skill injected, system=%q", got)
 	}
-	originalChat := chatsBeforeReset[0]
 
-	originalHistoryW := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(originalHistoryW, httptest.NewRequest(http.MethodGet, "/chats/"+originalChat.ID, nil))
-	if originalHistoryW.Code != http.StatusOK {
-		t.Fatalf("get original history status=%d body=%s", originalHistoryW.Code, originalHistoryW.Body.String())
+	var chats []domain.ChatSpec
+	w := callJSONEndpoint(srv, http.MethodGet, "/chats?user_id=u-skills&channel=console", ``)
+	if err := json.Unmarshal(w.Body.Bytes(), &chats); err != nil || len(chats) != 1 {
+		t.Fatalf("list chats failed: err=%v body=%s", err, w.Body.String())
 	}
-	var originalHistory domain.ChatHistory
-	if err := json.Unmarshal(originalHistoryW.Body.Bytes(), &originalHistory); err != nil {
-		t.Fatalf("decode original history failed: %v body=%s", err, originalHistoryW.Body.String())
+	chat := chats[0]
+	if w := callJSONEndpoint(srv, http.MethodPut, "/chats/"+chat.ID, `{"id":"`+chat.ID+`","name":"skills","session_id":"s-skills","user_id":"u-skills","channel":"console","meta":{"skills":"haiku"}}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected non-array meta.skills to be rejected, status=%d body=%s", w.Code, w.Body.String())
 	}
-	if !chatHistoryContainsText(originalHistory, "hello before reset") {
-		t.Fatalf("expected original history to contain first user text, body=%s", originalHistoryW.Body.String())
+	if w := callJSONEndpoint(srv, http.MethodPut, "/chats/"+chat.ID, `{"id":"`+chat.ID+`","name":"skills","session_id":"s-skills","user_id":"u-skills","channel":"console","meta":{"skills":["haiku","legacy"]}}`); w.Code != http.StatusOK {
+		t.Fatalf("update chat status=%d body=%s", w.Code, w.Body.String())
+	}
+	process("")
+	if got := systemText(); !strings.Contains(got, "Answer in haiku.") || strings.Contains(got, "Keep answers short.") || strings.Contains(got, "Use legacy formatting.") {
+		t.Fatalf("expected chat selection limited to enabled skills, system=%q", got)
 	}
+}
 
-	resetReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":" /new "}]}],"session_id":"s-reset","user_id":"u-reset","channel":"console","stream":false}`
-	resetW := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(resetW, httptest.NewRequest(http.MethodPost, "/agent/process", strings.NewReader(resetReq)))
-	if resetW.Code != http.StatusOK {
-		t.Fatalf("reset process status=%d body=%s", resetW.Code, resetW.Body.String())
+func TestEnvsMaskSecretValuesAndPatch(t *testing.T) {
+	srv := newTestServer(t)
+	w := callJSONEndpoint(srv, http.MethodPut, "/envs", `{"OPENAI_API_KEY":"sk-live-123456","GITHUB_TOKEN":"ghp_abcdef","REGION":"us-east-1"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("put envs status=%d body=%s", w.Code, w.Body.String())
 	}
-	var resetResp domain.AgentProcessResponse
-	if err := json.Unmarshal(resetW.Body.Bytes(), &resetResp); err != nil {
-		t.Fatalf("decode reset response failed: %v body=%s", err, resetW.Body.String())
+	if strings.Contains(w.Body.String(), "sk-live-123456") {
+		t.Fatalf("expected put response to mask secrets: %s", w.Body.String())
 	}
-	if !strings.Contains(resetResp.Reply, "上下文已清理") {
-		t.Fatalf("unexpected reset reply: %#v", resetResp.Reply)
+
+	envValues := func(w *httptest.ResponseRecorder) map[string]string {
+		t.Helper()
+		var out []domain.EnvVar
+		if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+			t.Fatalf("decode envs failed: %v body=%s", err, w.Body.String())
+		}
+		values := map[string]string{}
+		for _, item := range out {
+			values[item.Key] = item.Value
+		}
+		return values
 	}
 
-	chatsAfterResetW := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(chatsAfterResetW, httptest.NewRequest(http.MethodGet, "/chats?user_id=u-reset&channel=console", nil))
-	if chatsAfterResetW.Code != http.StatusOK {
-		t.Fatalf("list chats after reset status=%d body=%s", chatsAfterResetW.Code, chatsAfterResetW.Body.String())
+	masked := envValues(callJSONEndpoint(srv, http.MethodGet, "/envs", ``))
+	if masked["OPENAI_API_KEY"] != "sk-***456" || masked["GITHUB_TOKEN"] != "ghp***def" || masked["REGION"] != "us-east-1" {
+		t.Fatalf("unexpected masked envs: %#v", masked)
 	}
-	var chatsAfterReset []domain.ChatSpec
-	if err := json.Unmarshal(chatsAfterResetW.Body.Bytes(), &chatsAfterReset); err != nil {
-		t.Fatalf("decode chats after reset failed: %v body=%s", err, chatsAfterResetW.Body.String())
+	revealed := envValues(callJSONEndpoint(srv, http.MethodGet, "/envs?reveal=true", ``))
+	if revealed["OPENAI_API_KEY"] != "sk-live-123456" || revealed["GITHUB_TOKEN"] != "ghp_abcdef" {
+		t.Fatalf("unexpected revealed envs: %#v", revealed)
 	}
-	if len(chatsAfterReset) != 0 {
-		t.Fatalf("expected no chats after reset, got=%d body=%s", len(chatsAfterReset), chatsAfterResetW.Body.String())
+	if raw := envValues(callJSONEndpoint(srv, http.MethodGet, "/envs?mask=false", ``)); raw["OPENAI_API_KEY"] != "sk-live-123456" {
+		t.Fatalf("expected mask=false to return raw values: %#v", raw)
 	}
 
-	secondReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"hello after reset"}]}],"session_id":"s-reset","user_id":"u-reset","channel":"console","stream":false}`
-	secondW := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(secondW, httptest.NewRequest(http.MethodPost, "/agent/process", strings.NewReader(secondReq)))
-	if secondW.Code != http.StatusOK {
-		t.Fatalf("second process status=%d body=%s", secondW.Code, secondW.Body.String())
+	// Echoing the masked listing back keeps the stored secrets.
+	w = callJSONEndpoint(srv, http.MethodPut, "/envs", `{"OPENAI_API_KEY":"sk-***456","GITHUB_TOKEN":"ghp_new_token","REGION":"eu-west-1"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("put envs status=%d body=%s", w.Code, w.Body.String())
 	}
-
-	chatsAfterSecondW := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(chatsAfterSecondW, httptest.NewRequest(http.MethodGet, "/chats?user_id=u-reset&channel=console", nil))
-	if chatsAfterSecondW.Code != http.StatusOK {
-		t.Fatalf("list chats after second message status=%d body=%s", chatsAfterSecondW.Code, chatsAfterSecondW.Body.String())
+	revealed = envValues(callJSONEndpoint(srv, http.MethodGet, "/envs?reveal=true", ``))
+	if revealed["OPENAI_API_KEY"] != "sk-live-123456" || revealed["GITHUB_TOKEN"] != "ghp_new_token" || revealed["REGION"] != "eu-west-1" {
+		t.Fatalf("unexpected envs after round trip: %#v", revealed)
 	}
-	var chatsAfterSecond []domain.ChatSpec
-	if err := json.Unmarshal(chatsAfterSecondW.Body.Bytes(), &chatsAfterSecond); err != nil {
-		t.Fatalf("decode chats after second message failed: %v body=%s", err, chatsAfterSecondW.Body.String())
+
+	w = callJSONEndpoint(srv, http.MethodPatch, "/envs", `{"REGION":null,"NEW_SECRET":"s3cr3t-value"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("patch envs status=%d body=%s", w.Code, w.Body.String())
 	}
-	if len(chatsAfterSecond) != 1 {
-		t.Fatalf("expected one chat after second message, got=%d body=%s", len(chatsAfterSecond), chatsAfterSecondW.Body.String())
+	revealed = envValues(callJSONEndpoint(srv, http.MethodGet, "/envs?reveal=true", ``))
+	if _, ok := revealed["REGION"]; ok || revealed["NEW_SECRET"] != "s3cr3t-value" || revealed["OPENAI_API_KEY"] != "sk-live-123456" {
+		t.Fatalf("unexpected envs after patch: %#v", revealed)
 	}
-	if chatsAfterSecond[0].ID == originalChat.ID {
-		t.Fatalf("expected a new chat id after reset, got unchanged id=%s", chatsAfterSecond[0].ID)
+}
+
+func TestExportEnvsRendersEnvFile(t *testing.T) {
+	srv := newTestServer(t)
+	body := `{"OPENAI_API_KEY":"sk-live-123456","GREETING":"hello world","MULTI":"line1\nline2","QUOTED":"\"x\"","EMPTY":""}`
+	if w := callJSONEndpoint(srv, http.MethodPut, "/envs", body); w.Code != http.StatusOK {
+		t.Fatalf("put envs status=%d body=%s", w.Code, w.Body.String())
 	}
 
-	newHistoryW := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(newHistoryW, httptest.NewRequest(http.MethodGet, "/chats/"+chatsAfterSecond[0].ID, nil))
-	if newHistoryW.Code != http.StatusOK {
-		t.Fatalf("get new history status=%d body=%s", newHistoryW.Code, newHistoryW.Body.String())
+	w := callJSONEndpoint(srv, http.MethodGet, "/envs/export", ``)
+	assertAPIError(t, w, http.StatusForbidden, "api_key_required", "env export requires NEXTAI_API_KEY or NEXTAI_API_KEYS to be configured")
+
+	srv.cfg.APIKey = "secret-token"
+	req := httptest.NewRequest(http.MethodGet, "/envs/export", nil)
+	req.Header.Set("X-API-Key", "secret-token")
+	w = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("export envs status=%d body=%s", w.Code, w.Body.String())
 	}
-	var newHistory domain.ChatHistory
-	if err := json.Unmarshal(newHistoryW.Body.Bytes(), &newHistory); err != nil {
-		t.Fatalf("decode new history failed: %v body=%s", err, newHistoryW.Body.String())
+	if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/plain") {
+		t.Fatalf("unexpected content type: %q", got)
 	}
-	if chatHistoryContainsText(newHistory, "hello before reset") {
-		t.Fatalf("expected previous context to be cleared, body=%s", newHistoryW.Body.String())
+	if got := w.Header().Get("Content-Disposition"); got != `attachment; filename="nextai.env"` {
+		t.Fatalf("unexpected content disposition: %q", got)
 	}
-	if !chatHistoryContainsText(newHistory, "hello after reset") {
-		t.Fatalf("expected new history to contain post-reset text, body=%s", newHistoryW.Body.String())
+	want := "EMPTY=\n" +
+		"GREETING='hello world'\n" +
+		"MULTI=\"line1\\nline2\"\n" +
+		"OPENAI_API_KEY=sk-live-123456\n" +
+		"QUOTED='\"x\"'\n"
+	if got := w.Body.String(); got != want {
+		t.Fatalf("unexpected env file:\n%s\nwant:\n%s", got, want)
 	}
 }
 
-func TestQQInboundC2CEventTriggersOutboundDispatch(t *testing.T) {
-	var tokenCalls atomic.Int32
+func TestWorkspaceExportDownloadBundlesDocs(t *testing.T) {
+	srv := newTestServer(t)
+	relPath, absPath := newDocsAITestPath(t, "workspace-export")
+	if err := os.WriteFile(absPath, []byte("# guide v1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	w := callJSONEndpoint(srv, http.MethodGet, "/workspace/export", ``)
+	if w.Code != http.StatusOK {
+		t.Fatalf("export status=%d body=%s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Disposition"); got != "" {
+		t.Fatalf("inline export should not set content disposition, got %q", got)
+	}
+	var inline workspaceExportPayload
+	if err := json.Unmarshal(w.Body.Bytes(), &inline); err != nil {
+		t.Fatal(err)
+	}
+	if inline.Docs != nil {
+		t.Fatalf("inline export should not bundle docs by default: %#v", inline.Docs)
+	}
+
+	w = callJSONEndpoint(srv, http.MethodGet, "/workspace/export?download=true", ``)
+	if w.Code != http.StatusOK {
+		t.Fatalf("download status=%d body=%s", w.Code, w.Body.String())
+	}
+	disposition := w.Header().Get("Content-Disposition")
+	if !strings.HasPrefix(disposition, "attachment; filename=nextai-workspace-") || !strings.HasSuffix(disposition, "Z.json") {
+		t.Fatalf("unexpected content disposition: %q", disposition)
+	}
+	var snapshot workspaceExportPayload
+	if err := json.Unmarshal(w.Body.Bytes(), &snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if got := snapshot.Docs[relPath]; got != "# guide v1\n" {
+		t.Fatalf("expected bundled doc %s, got %q", relPath, got)
+	}
+
+	if err := os.WriteFile(absPath, []byte("# guide v2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	importBody, _ := json.Marshal(workspaceImportRequest{Mode: "replace", Payload: snapshot})
+	if w := callJSONEndpoint(srv, http.MethodPost, "/workspace/import", string(importBody)); w.Code != http.StatusOK {
+		t.Fatalf("import status=%d body=%s", w.Code, w.Body.String())
+	}
+	restored, err := os.ReadFile(absPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(restored) != "# guide v1\n" {
+		t.Fatalf("expected doc restored from snapshot, got %q", string(restored))
+	}
+
+	w = callJSONEndpoint(srv, http.MethodPost, "/workspace/import", `{"mode":"replace","payload":{"version":"v1","docs":{"docs/AI/../escape.md":"x"}}}`)
+	assertAPIError(t, w, http.StatusBadRequest, "invalid_workspace_doc", `doc path "docs/AI/../escape.md" must be under docs/AI/`)
+}
+
+func TestWorkspaceImportValidateOnlyDoesNotWrite(t *testing.T) {
+	srv := newTestServer(t)
+	if w := callJSONEndpoint(srv, http.MethodPut, "/envs", `{"FOO":"1","BAR":"2"}`); w.Code != http.StatusOK {
+		t.Fatalf("put envs status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	body := `{"mode":"replace","payload":{"version":"v1","config":{"envs":{"FOO":"1","BAZ":"3"}}}}`
+	w := callJSONEndpoint(srv, http.MethodPost, "/workspace/import?validate_only=true", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("validate status=%d body=%s", w.Code, w.Body.String())
+	}
+	var report workspaceImportReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if !report.Valid || report.Envs != (workspaceImportChangeCounts{Added: 1, Removed: 1}) {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	w = callJSONEndpoint(srv, http.MethodGet, "/envs", ``)
+	if !strings.Contains(w.Body.String(), `"BAR"`) || strings.Contains(w.Body.String(), `"BAZ"`) {
+		t.Fatalf("validate_only must not change envs: %s", w.Body.String())
+	}
+
+	w = callJSONEndpoint(srv, http.MethodPost, "/workspace/import?validate_only=true", `{"mode":"merge","payload":{"version":"v1"}}`)
+	assertAPIError(t, w, http.StatusBadRequest, "invalid_import_mode", "mode must be replace")
+}
+
+func TestWorkspaceFileDiffShowsPendingChange(t *testing.T) {
+	srv := newTestServer(t)
+	relPath, absPath := newDocsAITestPath(t, "workspace-diff")
+	if err := os.WriteFile(absPath, []byte("# Guide\nkeep\nold\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	w := callJSONEndpoint(srv, http.MethodPost, "/workspace/files/"+relPath+"/diff", `{"content":"# Guide\nkeep\nnew\n"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("diff status=%d body=%s", w.Code, w.Body.String())
+	}
+	var out workspaceFileDiffResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	want := "--- a/" + relPath + "\n+++ b/" + relPath + "\n@@ -1,3 +1,3 @@\n # Guide\n keep\n-old\n+new"
+	if out.Path != relPath || !out.Changed || out.Diff != want {
+		t.Fatalf("unexpected diff response: %+v", out)
+	}
+	if content, _ := os.ReadFile(absPath); string(content) != "# Guide\nkeep\nold\n" {
+		t.Fatalf("diff must not write the file, got %q", string(content))
+	}
+
+	// POST on the file path without the /diff suffix is not a diff route.
+	w = callJSONEndpoint(srv, http.MethodPost, "/workspace/files/"+relPath, `{"content":"x"}`)
+	assertAPIError(t, w, http.StatusNotFound, "not_found", "unknown workspace file action")
+
+	oversized := `{"content":"` + strings.Repeat("x", int(workspaceDiffMaxBodySize)) + `"}`
+	w = callJSONEndpoint(srv, http.MethodPost, "/workspace/files/"+relPath+"/diff", oversized)
+	assertAPIError(t, w, http.StatusRequestEntityTooLarge, "payload_too_large", "diff request body exceeds size limit")
+}
+
+func TestExportSkillStreamsZipAttachment(t *testing.T) {
+	srv := newTestServer(t)
+	if w := callJSONEndpoint(srv, http.MethodPost, "/skills", `{"name":"notes","content":"Take notes."}`); w.Code != http.StatusOK {
+		t.Fatalf("create skill status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	w := callJSONEndpoint(srv, http.MethodGet, "/skills/notes/export", ``)
+	if w.Code != http.StatusOK {
+		t.Fatalf("export status=%d body=%s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Type"); got != "application/zip" {
+		t.Fatalf("expected application/zip, got=%q", got)
+	}
+	if got := w.Header().Get("Content-Disposition"); got != `attachment; filename=notes.zip` {
+		t.Fatalf("unexpected content disposition: %q", got)
+	}
+	if !strings.HasPrefix(w.Body.String(), "PK") {
+		t.Fatalf("expected zip body")
+	}
+
+	w = callJSONEndpoint(srv, http.MethodGet, "/skills/missing/export", ``)
+	assertAPIError(t, w, http.StatusNotFound, "not_found", "skill not found")
+}
+
+func TestLoadSkillFileServesRawContentWithType(t *testing.T) {
+	srv := newTestServer(t)
+	createReq := `{"name":"guide","content":"Use the bundled docs.","references":{"docs":{"intro.md":"# Intro"},"logo.png":"data:image/png;base64,iVBORw0KGgo=","table.csv":"a,b\n1,2\n"}}`
+	if w := callJSONEndpoint(srv, http.MethodPost, "/skills", createReq); w.Code != http.StatusOK {
+		t.Fatalf("create skill status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	w := callJSONEndpoint(srv, http.MethodGet, "/skills/guide/files/references/docs%2Fintro.md", ``)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"content":"# Intro"`) {
+		t.Fatalf("expected json content, status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	w = callJSONEndpoint(srv, http.MethodGet, "/skills/guide/files/references/logo.png?raw=true", ``)
+	if w.Code != http.StatusOK {
+		t.Fatalf("raw image status=%d body=%s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Type"); got != "image/png" {
+		t.Fatalf("expected image/png, got=%q", got)
+	}
+	if got := w.Body.String(); got != "\x89PNG\r\n\x1a\n" {
+		t.Fatalf("expected decoded png bytes, got=%q", got)
+	}
+
+	w = callJSONEndpoint(srv, http.MethodGet, "/skills/guide/files/references/table.csv?raw=true", ``)
+	if w.Code != http.StatusOK || w.Body.String() != "a,b\n1,2\n" {
+		t.Fatalf("raw csv status=%d body=%q", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/csv") {
+		t.Fatalf("expected text/csv, got=%q", got)
+	}
+
+	w = callJSONEndpoint(srv, http.MethodGet, "/skills/guide/files/references/docs%2F..%2Fdocs%2Fintro.md?raw=true", ``)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected traversal segment to be rejected, status=%d body=%s", w.Code, w.Body.String())
+	}
+}
+
+func TestDeleteDefaultChatRejected(t *testing.T) {
+	srv := newTestServer(t)
+
+	deleteW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(deleteW, httptest.NewRequest(http.MethodDelete, "/chats/"+domain.DefaultChatID, nil))
+	if deleteW.Code != http.StatusBadRequest {
+		t.Fatalf("delete default chat status=%d body=%s", deleteW.Code, deleteW.Body.String())
+	}
+	if !strings.Contains(deleteW.Body.String(), `"code":"default_chat_protected"`) {
+		t.Fatalf("unexpected delete error body: %s", deleteW.Body.String())
+	}
+
+	batchDeleteW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(batchDeleteW, httptest.NewRequest(http.MethodPost, "/chats/batch-delete", strings.NewReader(`["`+domain.DefaultChatID+`"]`)))
+	if batchDeleteW.Code != http.StatusBadRequest {
+		t.Fatalf("batch delete default chat status=%d body=%s", batchDeleteW.Code, batchDeleteW.Body.String())
+	}
+	if !strings.Contains(batchDeleteW.Body.String(), `"code":"default_chat_protected"`) {
+		t.Fatalf("unexpected batch delete error body: %s", batchDeleteW.Body.String())
+	}
+
+	listW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(listW, httptest.NewRequest(http.MethodGet, "/chats?user_id=demo-user&channel=console", nil))
+	if listW.Code != http.StatusOK {
+		t.Fatalf("list chats status=%d body=%s", listW.Code, listW.Body.String())
+	}
+	if !strings.Contains(listW.Body.String(), `"id":"`+domain.DefaultChatID+`"`) {
+		t.Fatalf("default chat should still exist after delete attempts: %s", listW.Body.String())
+	}
+}
+
+func TestListCronJobsContainsDefaultCronJob(t *testing.T) {
+	srv := newTestServer(t)
+
+	listW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(listW, httptest.NewRequest(http.MethodGet, "/cron/jobs", nil))
+	if listW.Code != http.StatusOK {
+		t.Fatalf("list cron jobs status=%d body=%s", listW.Code, listW.Body.String())
+	}
+
+	var jobs []domain.CronJobSpec
+	if err := json.Unmarshal(listW.Body.Bytes(), &jobs); err != nil {
+		t.Fatalf("decode cron jobs failed: %v body=%s", err, listW.Body.String())
+	}
+
+	var defaultJob *domain.CronJobSpec
+	for i := range jobs {
+		if jobs[i].ID == domain.DefaultCronJobID {
+			defaultJob = &jobs[i]
+			break
+		}
+	}
+	if defaultJob == nil {
+		t.Fatalf("default cron job should exist in list: %s", listW.Body.String())
+	}
+	if defaultJob.TaskType != "text" {
+		t.Fatalf("unexpected default cron task_type: %q", defaultJob.TaskType)
+	}
+	if defaultJob.Text != domain.DefaultCronJobText {
+		t.Fatalf("unexpected default cron text: %q", defaultJob.Text)
+	}
+	if defaultJob.Enabled {
+		t.Fatalf("default cron job should be disabled by default")
+	}
+	flag, ok := defaultJob.Meta[domain.CronMetaSystemDefault].(bool)
+	if !ok || !flag {
+		t.Fatalf("default cron should have meta.system_default=true, meta=%#v", defaultJob.Meta)
+	}
+}
+
+func TestDeleteDefaultCronJobRejected(t *testing.T) {
+	srv := newTestServer(t)
+
+	deleteW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(deleteW, httptest.NewRequest(http.MethodDelete, "/cron/jobs/"+domain.DefaultCronJobID, nil))
+	if deleteW.Code != http.StatusBadRequest {
+		t.Fatalf("delete default cron status=%d body=%s", deleteW.Code, deleteW.Body.String())
+	}
+	if !strings.Contains(deleteW.Body.String(), `"code":"default_cron_protected"`) {
+		t.Fatalf("unexpected delete default cron body: %s", deleteW.Body.String())
+	}
+
+	listW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(listW, httptest.NewRequest(http.MethodGet, "/cron/jobs", nil))
+	if listW.Code != http.StatusOK {
+		t.Fatalf("list cron jobs status=%d body=%s", listW.Code, listW.Body.String())
+	}
+	if !strings.Contains(listW.Body.String(), `"id":"`+domain.DefaultCronJobID+`"`) {
+		t.Fatalf("default cron job should still exist after delete attempt: %s", listW.Body.String())
+	}
+}
+
+func TestBatchCreateCronJobsReportsPerJobResults(t *testing.T) {
+	srv := newTestServer(t)
+
+	body := `[
+		{"id":"batch-a","name":"batch-a","task_type":"text","text":"hello","schedule":{"type":"interval","cron":"60s"}},
+		{"id":"batch-bad","name":"batch-bad","task_type":"text","text":"hello","schedule":{"type":"cron","cron":"not a cron"}},
+		{"id":"batch-b","name":"batch-b","task_type":"text","text":"world","schedule":{"type":"cron","cron":"*/5 * * * *"}}
+	]`
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/cron/jobs/batch", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("batch create status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	var out domain.CronBatchCreateResult
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode batch create response failed: %v body=%s", err, w.Body.String())
+	}
+	if out.Created != 2 || out.Failed != 1 || len(out.Results) != 3 {
+		t.Fatalf("unexpected batch summary: %s", w.Body.String())
+	}
+	if !out.Results[0].Created || !out.Results[2].Created {
+		t.Fatalf("expected valid entries to be created: %s", w.Body.String())
+	}
+	bad := out.Results[1]
+	if bad.Created || bad.Error == nil || bad.Error.Code != "invalid_cron_schedule" {
+		t.Fatalf("expected the createCronJob schedule error for entry 1: %s", w.Body.String())
+	}
+
+	listW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(listW, httptest.NewRequest(http.MethodGet, "/cron/jobs", nil))
+	if listW.Code != http.StatusOK {
+		t.Fatalf("list cron jobs status=%d body=%s", listW.Code, listW.Body.String())
+	}
+	listed := listW.Body.String()
+	if !strings.Contains(listed, `"id":"batch-a"`) || !strings.Contains(listed, `"id":"batch-b"`) {
+		t.Fatalf("expected batch jobs to be persisted: %s", listed)
+	}
+	if strings.Contains(listed, `"id":"batch-bad"`) {
+		t.Fatalf("invalid batch job should not be persisted: %s", listed)
+	}
+}
+
+func TestBatchCreateCronJobsSharesCreateValidationAndRejectsDuplicateIDs(t *testing.T) {
+	srv := newTestServer(t)
+
+	body := `[
+		{"id":"batch-dup","name":"first","task_type":"text","text":"hello","schedule":{"type":"interval","cron":"60s"}},
+		{"id":"batch-other","name":"other","task_type":"text","text":"hello","schedule":{"type":"interval","cron":"60s"}},
+		{"id":" batch-dup ","name":"second","task_type":"text","text":"world","schedule":{"type":"interval","cron":"60s"}}
+	]`
+	w := callJSONEndpoint(srv, http.MethodPost, "/cron/jobs/batch", body)
+	assertAPIError(t, w, http.StatusConflict, "duplicate_cron_job_id", `job id "batch-dup" appears more than once in the batch`)
+
+	listW := callJSONEndpoint(srv, http.MethodGet, "/cron/jobs", "")
+	if strings.Contains(listW.Body.String(), `"id":"batch-dup"`) || strings.Contains(listW.Body.String(), `"id":"batch-other"`) {
+		t.Fatalf("a rejected batch should create nothing: %s", listW.Body.String())
+	}
+
+	qqBody := `{"id":"single-qq","name":"qq","task_type":"text","text":"hello","schedule":{"type":"interval","cron":"60s"},"dispatch":{"channel":"qq"}}`
+	single := callJSONEndpoint(srv, http.MethodPost, "/cron/jobs", qqBody)
+	assertAPIError(t, single, http.StatusBadRequest, "invalid_cron_dispatch", `cron dispatch channel "qq" is inbound-only; use channel "console" to persist chat history`)
+}
+
+func TestCronSchedulerTickPacesDueJobsByGlobalConcurrency(t *testing.T) {
+	srv := newTestServer(t)
+	srv.cronSlots = make(chan struct{}, 2)
+
+	release := make(chan struct{})
+	var running, peak, started int32
+	srv.cronTaskExecutor = func(_ context.Context, job domain.CronJobSpec) error {
+		if !strings.HasPrefix(job.ID, "burst-") {
+			return nil
+		}
+		current := atomic.AddInt32(&running, 1)
+		for {
+			seen := atomic.LoadInt32(&peak)
+			if current <= seen || atomic.CompareAndSwapInt32(&peak, seen, current) {
+				break
+			}
+		}
+		atomic.AddInt32(&started, 1)
+		<-release
+		atomic.AddInt32(&running, -1)
+		return nil
+	}
+
+	jobIDs := []string{"burst-1", "burst-2", "burst-3", "burst-4", "burst-5"}
+	jobs := make([]string, 0, len(jobIDs))
+	for _, id := range jobIDs {
+		jobs = append(jobs, `{"id":"`+id+`","name":"`+id+`","enabled":true,"task_type":"text","text":"tick","schedule":{"type":"interval","cron":"60s"}}`)
+	}
+	if w := callJSONEndpoint(srv, http.MethodPost, "/cron/jobs/batch", "["+strings.Join(jobs, ",")+"]"); w.Code != http.StatusOK {
+		t.Fatalf("batch create status=%d body=%s", w.Code, w.Body.String())
+	}
+	due := time.Now().UTC().Add(-time.Second).Format(time.RFC3339)
+	if err := srv.store.Write(func(state *repo.State) error {
+		for _, id := range jobIDs {
+			st := state.CronStates[id]
+			st.NextRunAt = &due
+			state.CronStates[id] = st
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("seed cron states failed: %v", err)
+	}
+
+	srv.cronSchedulerTick()
+	waitFor := func(want int32) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for atomic.LoadInt32(&started) < want {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %d started executions, got=%d", want, atomic.LoadInt32(&started))
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	waitFor(2)
+	time.Sleep(50 * time.Millisecond)
+	if got := atomic.LoadInt32(&started); got != 2 {
+		t.Fatalf("expected only 2 executions before slots free up, got=%d", got)
+	}
+	srv.cronDeferredMu.Lock()
+	deferred := len(srv.cronDeferred)
+	srv.cronDeferredMu.Unlock()
+	if deferred != 3 {
+		t.Fatalf("expected 3 deferred jobs, got=%d", deferred)
+	}
+
+	close(release)
+	deadline := time.Now().Add(2 * time.Second)
+	for atomic.LoadInt32(&started) < int32(len(jobIDs)) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected deferred jobs to run on later ticks, started=%d", atomic.LoadInt32(&started))
+		}
+		srv.cronSchedulerTick()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := atomic.LoadInt32(&peak); got > 2 {
+		t.Fatalf("expected at most 2 concurrent executions, peak=%d", got)
+	}
+}
+
+func TestCronSchedulerDropsDeferredJobsThatNoLongerQualify(t *testing.T) {
+	srv := newTestServer(t)
+	var mu sync.Mutex
+	ran := map[string]bool{}
+	srv.cronTaskExecutor = func(_ context.Context, job domain.CronJobSpec) error {
+		mu.Lock()
+		ran[job.ID] = true
+		mu.Unlock()
+		return nil
+	}
+
+	jobIDs := []string{"held-kept", "held-disabled", "held-paused", "held-rescheduled"}
+	jobs := make([]string, 0, len(jobIDs))
+	for _, id := range jobIDs {
+		jobs = append(jobs, `{"id":"`+id+`","name":"`+id+`","enabled":true,"task_type":"text","text":"tick","schedule":{"type":"interval","cron":"60s"}}`)
+	}
+	if w := callJSONEndpoint(srv, http.MethodPost, "/cron/jobs/batch", "["+strings.Join(jobs, ",")+"]"); w.Code != http.StatusOK {
+		t.Fatalf("batch create status=%d body=%s", w.Code, w.Body.String())
+	}
+	// Capture the schedules the runs were due under, then seed the queue only
+	// after the changes so the background ticker cannot take it early.
+	deferred := make([]deferredCronJob, 0, len(jobIDs))
+	for _, id := range jobIDs {
+		schedule, ok := srv.getCronService().SchedulableJob(id)
+		if !ok {
+			t.Fatalf("expected %s to be schedulable", id)
+		}
+		deferred = append(deferred, deferredCronJob{JobID: id, Schedule: schedule})
+	}
+
+	if w := callJSONEndpoint(srv, http.MethodPost, "/cron/jobs/held-disabled/disable", ""); w.Code != http.StatusOK {
+		t.Fatalf("disable status=%d body=%s", w.Code, w.Body.String())
+	}
+	if w := callJSONEndpoint(srv, http.MethodPost, "/cron/jobs/held-paused/pause", ""); w.Code != http.StatusOK {
+		t.Fatalf("pause status=%d body=%s", w.Code, w.Body.String())
+	}
+	updated := `{"id":"held-rescheduled","name":"held-rescheduled","enabled":true,"task_type":"text","text":"tick","schedule":{"type":"interval","cron":"120s"}}`
+	if w := callJSONEndpoint(srv, http.MethodPut, "/cron/jobs/held-rescheduled", updated); w.Code != http.StatusOK {
+		t.Fatalf("update status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	srv.cronDeferredMu.Lock()
+	srv.cronDeferred = deferred
+	srv.cronDeferredMu.Unlock()
+
+	srv.cronSchedulerTick()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mu.Lock()
+		kept := ran["held-kept"]
+		mu.Unlock()
+		if kept {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the still-schedulable deferred job to run")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Give any wrongly queued job the same chance to start.
+	time.Sleep(50 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, id := range []string{"held-disabled", "held-paused", "held-rescheduled"} {
+		if ran[id] {
+			t.Fatalf("deferred job %s should have been dropped, ran=%v", id, ran)
+		}
+	}
+}
+
+func TestRunCronJobSyncReturnsAgentReply(t *testing.T) {
+	srv := newTestServer(t)
+
+	job := `{"id":"sync-job","name":"sync-job","task_type":"text","text":"ping","schedule":{"type":"interval","cron":"60s"},"dispatch":{"channel":"console","target":{"user_id":"u-sync","session_id":"s-sync"}}}`
+	if w := callJSONEndpoint(srv, http.MethodPost, "/cron/jobs", job); w.Code != http.StatusOK {
+		t.Fatalf("create cron job status=%d body=%s", w.Code, w.Body.String())
+	}
+	w := callJSONEndpoint(srv, http.MethodPost, "/cron/jobs/sync-job/run-sync", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("run-sync status=%d body=%s", w.Code, w.Body.String())
+	}
+	var out domain.CronRunOutput
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode run-sync response failed: %v body=%s", err, w.Body.String())
+	}
+	if out.Status != "succeeded" || out.Output != "Echo: ping" || out.Error != "" {
+		t.Fatalf("unexpected run-sync output: %s", w.Body.String())
+	}
+
+	webhookJob := `{"id":"sync-webhook","name":"sync-webhook","task_type":"text","text":"ping","schedule":{"type":"interval","cron":"60s"},"dispatch":{"channel":"webhook","target":{"user_id":"u-sync","session_id":"s-sync"}}}`
+	if w := callJSONEndpoint(srv, http.MethodPost, "/cron/jobs", webhookJob); w.Code != http.StatusOK {
+		t.Fatalf("create webhook cron job status=%d body=%s", w.Code, w.Body.String())
+	}
+	w = callJSONEndpoint(srv, http.MethodPost, "/cron/jobs/sync-webhook/run-sync", "")
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"code":"cron_run_sync_unsupported"`) {
+		t.Fatalf("expected cron_run_sync_unsupported, status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	release := make(chan struct{})
+	entered := make(chan struct{})
+	srv.cronTaskExecutor = func(_ context.Context, job domain.CronJobSpec) error {
+		close(entered)
+		<-release
+		return nil
+	}
+	done := make(chan int, 1)
+	go func() {
+		done <- callJSONEndpoint(srv, http.MethodPost, "/cron/jobs/sync-job/run-sync", "").Code
+	}()
+	<-entered
+	w = callJSONEndpoint(srv, http.MethodPost, "/cron/jobs/sync-job/run-sync", "")
+	close(release)
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), `"code":"cron_busy"`) {
+		t.Fatalf("expected cron_busy while the slot is held, status=%d body=%s", w.Code, w.Body.String())
+	}
+	if code := <-done; code != http.StatusOK {
+		t.Fatalf("expected the holding run to finish, status=%d", code)
+	}
+}
+
+func TestCronManualRunSkippedWhenGlobalConcurrencyReached(t *testing.T) {
+	srv := newTestServer(t)
+	srv.cronSlots = make(chan struct{}, 1)
+
+	job := `{"id":"manual-job","name":"manual-job","enabled":true,"task_type":"text","text":"tick","schedule":{"type":"interval","cron":"60s"},"dispatch":{"channel":"console","target":{"user_id":"u1","session_id":"s1"}}}`
+	if w := callJSONEndpoint(srv, http.MethodPost, "/cron/jobs", job); w.Code != http.StatusOK {
+		t.Fatalf("create cron job status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	srv.cronSlots <- struct{}{}
+	for _, path := range []string{"/cron/jobs/manual-job/run", "/cron/jobs/manual-job/run-sync"} {
+		w := callJSONEndpoint(srv, http.MethodPost, path, "")
+		if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), `"code":"cron_global_busy"`) {
+			t.Fatalf("%s: expected cron_global_busy, status=%d body=%s", path, w.Code, w.Body.String())
+		}
+	}
+	state := callJSONEndpoint(srv, http.MethodGet, "/cron/jobs/manual-job/state", "")
+	if !strings.Contains(state.Body.String(), "global cron concurrency limit reached (1)") {
+		t.Fatalf("expected global skip reason in state, body=%s", state.Body.String())
+	}
+
+	<-srv.cronSlots
+	if w := callJSONEndpoint(srv, http.MethodPost, "/cron/jobs/manual-job/run", ""); w.Code != http.StatusOK {
+		t.Fatalf("expected run once a slot is free, status=%d body=%s", w.Code, w.Body.String())
+	}
+	if len(srv.cronSlots) != 0 {
+		t.Fatalf("expected manual run to release its global slot, held=%d", len(srv.cronSlots))
+	}
+}
+
+func TestCronToolTaskRunsToolAndPersistsResult(t *testing.T) {
+	srv := newTestServer(t)
+	var gotInput map[string]interface{}
+	srv.registerToolPlugin(&stubToolPlugin{
+		name: "backup",
+		invoke: func(input map[string]interface{}) (map[string]interface{}, error) {
+			gotInput = input
+			return map[string]interface{}{"text": "backup done"}, nil
+		},
+	})
+
+	job := `{"id":"tool-job","name":"tool-job","task_type":"tool","tool":{"name":"Backup","input":{"command":"nightly"}},"schedule":{"type":"interval","cron":"60s"},"dispatch":{"channel":"console","target":{"user_id":"u-tool","session_id":"s-tool"}}}`
+	if w := callJSONEndpoint(srv, http.MethodPost, "/cron/jobs", job); w.Code != http.StatusOK {
+		t.Fatalf("create cron job status=%d body=%s", w.Code, w.Body.String())
+	}
+	w := callJSONEndpoint(srv, http.MethodPost, "/cron/jobs/tool-job/run-sync", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("run-sync status=%d body=%s", w.Code, w.Body.String())
+	}
+	var out domain.CronRunOutput
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode run-sync response failed: %v body=%s", err, w.Body.String())
+	}
+	if out.Status != "succeeded" || !strings.Contains(out.Output, "backup done") {
+		t.Fatalf("unexpected tool run output: %s", w.Body.String())
+	}
+	if gotInput["command"] != "nightly" {
+		t.Fatalf("expected tool input to be forwarded, got=%#v", gotInput)
+	}
+
+	persisted := ""
+	srv.store.Read(func(st *repo.State) {
+		for chatID, chat := range st.Chats {
+			if chat.SessionID != "s-tool" || chat.UserID != "u-tool" || chat.Channel != "console" {
+				continue
+			}
+			for _, msg := range st.Histories[chatID] {
+				for _, content := range msg.Content {
+					persisted += content.Text
+				}
+			}
+		}
+	})
+	if !strings.Contains(persisted, "backup done") {
+		t.Fatalf("expected tool result in console chat history, got=%q", persisted)
+	}
+
+	if w := callJSONEndpoint(srv, http.MethodPut, "/config/tools/disabled", `{"tools":["backup"]}`); w.Code != http.StatusOK {
+		t.Fatalf("disable tool status=%d body=%s", w.Code, w.Body.String())
+	}
+	w = callJSONEndpoint(srv, http.MethodPost, "/cron/jobs/tool-job/run", "")
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected disabled tool run to fail, status=%d body=%s", w.Code, w.Body.String())
+	}
+	state := callJSONEndpoint(srv, http.MethodGet, "/cron/jobs/tool-job/state", "")
+	if !strings.Contains(state.Body.String(), `is disabled by server config`) {
+		t.Fatalf("expected disabled tool error in last_error, body=%s", state.Body.String())
+	}
+	w = callJSONEndpoint(srv, http.MethodPost, "/cron/jobs", strings.Replace(job, `"tool-job"`, `"tool-job-2"`, 2))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"code":"tool_disabled"`) {
+		t.Fatalf("expected tool_disabled on create, status=%d body=%s", w.Code, w.Body.String())
+	}
+}
+
+func TestCronEnableDisableKeepsPauseSeparate(t *testing.T) {
+	srv := newTestServer(t)
+
+	job := `{"id":"toggle-job","name":"toggle-job","enabled":true,"task_type":"text","text":"ping","schedule":{"type":"interval","cron":"60s"},"dispatch":{"channel":"console","target":{"user_id":"u-toggle","session_id":"s-toggle"}}}`
+	if w := callJSONEndpoint(srv, http.MethodPost, "/cron/jobs", job); w.Code != http.StatusOK {
+		t.Fatalf("create cron job status=%d body=%s", w.Code, w.Body.String())
+	}
+	if w := callJSONEndpoint(srv, http.MethodPost, "/cron/jobs/toggle-job/pause", ""); w.Code != http.StatusOK {
+		t.Fatalf("pause status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	toggle := func(action string) domain.CronJobActivation {
+		t.Helper()
+		w := callJSONEndpoint(srv, http.MethodPost, "/cron/jobs/toggle-job/"+action, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s status=%d body=%s", action, w.Code, w.Body.String())
+		}
+		var out domain.CronJobActivation
+		if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+			t.Fatalf("decode %s response failed: %v body=%s", action, err, w.Body.String())
+		}
+		return out
+	}
+
+	out := toggle("disable")
+	if out.Enabled || !out.Paused || out.Scheduled || out.NextRunAt != nil {
+		t.Fatalf("unexpected disable result: %#v", out)
+	}
+	out = toggle("enable")
+	if !out.Enabled || !out.Paused || out.Scheduled || out.NextRunAt != nil {
+		t.Fatalf("enable must not clear the pause: %#v", out)
+	}
+	if w := callJSONEndpoint(srv, http.MethodPost, "/cron/jobs/toggle-job/resume", ""); w.Code != http.StatusOK {
+		t.Fatalf("resume status=%d body=%s", w.Code, w.Body.String())
+	}
+	out = toggle("disable")
+	if out.Enabled || out.Paused || out.Scheduled || out.NextRunAt != nil {
+		t.Fatalf("unexpected disable result after resume: %#v", out)
+	}
+	out = toggle("enable")
+	if !out.Enabled || out.Paused || !out.Scheduled || out.NextRunAt == nil {
+		t.Fatalf("expected enabled job to be scheduled again: %#v", out)
+	}
+
+	w := callJSONEndpoint(srv, http.MethodGet, "/cron/jobs/toggle-job", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"enabled":true`) {
+		t.Fatalf("expected spec.enabled to be persisted, status=%d body=%s", w.Code, w.Body.String())
+	}
+}
+
+func TestValidateCronJobFillsDefaultsWithoutPersisting(t *testing.T) {
+	srv := newTestServer(t)
+
+	w := callJSONEndpoint(srv, http.MethodPost, "/cron/jobs/validate", `{"id":"draft","name":"draft","task_type":"text","text":"hi","schedule":{"cron":"60s"}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("validate status=%d body=%s", w.Code, w.Body.String())
+	}
+	var out domain.CronJobValidation
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode validate response failed: %v body=%s", err, w.Body.String())
+	}
+	if !out.Valid || len(out.Problems) != 0 || out.NextRunAt == nil {
+		t.Fatalf("expected valid job with next_run_at: %s", w.Body.String())
+	}
+	if out.Job.Runtime.MaxConcurrency != 1 || out.Job.Runtime.TimeoutSeconds != 30 {
+		t.Fatalf("expected runtime defaults, got=%+v", out.Job.Runtime)
+	}
+	if out.Job.Schedule.Type != "interval" || out.Job.Dispatch.Channel != "console" {
+		t.Fatalf("expected schedule and dispatch defaults: %s", w.Body.String())
+	}
+
+	bad := callJSONEndpoint(srv, http.MethodPost, "/cron/jobs/validate", `{"id":"draft-bad","name":"draft-bad","task_type":"text","text":"hi","schedule":{"type":"cron","cron":"not a cron"}}`)
+	if bad.Code != http.StatusOK {
+		t.Fatalf("validate status=%d body=%s", bad.Code, bad.Body.String())
+	}
+	out = domain.CronJobValidation{}
+	if err := json.Unmarshal(bad.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode validate response failed: %v body=%s", err, bad.Body.String())
+	}
+	if out.Valid || len(out.Problems) != 1 || out.Problems[0].Code != "invalid_cron_schedule" {
+		t.Fatalf("expected invalid_cron_schedule problem: %s", bad.Body.String())
+	}
+
+	listed := callJSONEndpoint(srv, http.MethodGet, "/cron/jobs", "").Body.String()
+	if strings.Contains(listed, `"id":"draft"`) || strings.Contains(listed, `"id":"draft-bad"`) {
+		t.Fatalf("validate should not persist jobs: %s", listed)
+	}
+}
+
+func TestProcessAgentReusesChatHistoryContext(t *testing.T) {
+	srv := newTestServer(t)
+
+	firstReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"1+1等于几"}]}],"session_id":"s-context","user_id":"u-context","channel":"console","stream":false}`
+	firstW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(firstW, httptest.NewRequest(http.MethodPost, "/agent/process", strings.NewReader(firstReq)))
+	if firstW.Code != http.StatusOK {
+		t.Fatalf("first process status=%d body=%s", firstW.Code, firstW.Body.String())
+	}
+
+	secondReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"把你之前回答的数学问题再回答一次"}]}],"session_id":"s-context","user_id":"u-context","channel":"console","stream":false}`
+	secondW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(secondW, httptest.NewRequest(http.MethodPost, "/agent/process", strings.NewReader(secondReq)))
+	if secondW.Code != http.StatusOK {
+		t.Fatalf("second process status=%d body=%s", secondW.Code, secondW.Body.String())
+	}
+
+	var secondResp domain.AgentProcessResponse
+	if err := json.Unmarshal(secondW.Body.Bytes(), &secondResp); err != nil {
+		t.Fatalf("decode second response failed: %v body=%s", err, secondW.Body.String())
+	}
+	if !strings.Contains(secondResp.Reply, "1+1等于几") {
+		t.Fatalf("expected second reply to include previous user context, got=%q", secondResp.Reply)
+	}
+	if !strings.Contains(secondResp.Reply, "把你之前回答的数学问题再回答一次") {
+		t.Fatalf("expected second reply to include latest user input, got=%q", secondResp.Reply)
+	}
+}
+
+func TestProcessAgentPersistsToolCallNoticesInHistory(t *testing.T) {
+	srv := newTestServer(t)
+	_, absPath := newToolTestPath(t, "history-tool-call")
+	if err := os.WriteFile(absPath, []byte("line-1\nline-2\n"), 0o644); err != nil {
+		t.Fatalf("seed tool test file failed: %v", err)
+	}
+
+	createReq := `{"name":"A","session_id":"s-history-tool","user_id":"u-history-tool","channel":"console","meta":{}}`
+	w1 := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w1, httptest.NewRequest(http.MethodPost, "/chats", strings.NewReader(createReq)))
+	if w1.Code != http.StatusOK {
+		t.Fatalf("create status=%d body=%s", w1.Code, w1.Body.String())
+	}
+	var created map[string]interface{}
+	if err := json.Unmarshal(w1.Body.Bytes(), &created); err != nil {
+		t.Fatalf("decode create response failed: %v", err)
+	}
+	chatID, _ := created["id"].(string)
+	if strings.TrimSpace(chatID) == "" {
+		t.Fatalf("empty chat id: %v", created)
+	}
+
+	procReq := fmt.Sprintf(`{
+		"input":[{"role":"user","type":"message","content":[{"type":"text","text":"view history tool call"}]}],
+		"session_id":"s-history-tool",
+		"user_id":"u-history-tool",
+		"channel":"console",
+		"stream":false,
+		"view":[{"path":%q,"start":1,"end":1}]
+	}`, absPath)
+	w2 := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w2, httptest.NewRequest(http.MethodPost, "/agent/process", strings.NewReader(procReq)))
+	if w2.Code != http.StatusOK {
+		t.Fatalf("process status=%d body=%s", w2.Code, w2.Body.String())
+	}
+
+	w3 := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w3, httptest.NewRequest(http.MethodGet, "/chats/"+chatID, nil))
+	if w3.Code != http.StatusOK {
+		t.Fatalf("history status=%d body=%s", w3.Code, w3.Body.String())
+	}
+
+	var history domain.ChatHistory
+	if err := json.Unmarshal(w3.Body.Bytes(), &history); err != nil {
+		t.Fatalf("decode history failed: %v body=%s", err, w3.Body.String())
+	}
+	if len(history.Messages) == 0 {
+		t.Fatalf("expected non-empty history, body=%s", w3.Body.String())
+	}
+	assistant := history.Messages[len(history.Messages)-1]
+	if assistant.Role != "assistant" {
+		t.Fatalf("expected assistant message at tail, got=%q", assistant.Role)
+	}
+	if len(assistant.Metadata) == 0 {
+		t.Fatalf("expected assistant metadata, body=%s", w3.Body.String())
+	}
+	rawNotices, ok := assistant.Metadata["tool_call_notices"].([]interface{})
+	if !ok || len(rawNotices) == 0 {
+		t.Fatalf("expected tool_call_notices metadata, got=%#v", assistant.Metadata["tool_call_notices"])
+	}
+	first, _ := rawNotices[0].(map[string]interface{})
+	raw, _ := first["raw"].(string)
+	if !strings.Contains(raw, `"type":"tool_result"`) || !strings.Contains(raw, `"name":"view"`) || !strings.Contains(raw, `line-1`) {
+		t.Fatalf("unexpected persisted tool notice raw: %q", raw)
+	}
+	toolOrder, ok := assistant.Metadata["tool_order"].(float64)
+	if !ok || toolOrder <= 0 {
+		t.Fatalf("expected positive tool_order, got=%#v", assistant.Metadata["tool_order"])
+	}
+	textOrder, ok := assistant.Metadata["text_order"].(float64)
+	if !ok || textOrder <= 0 {
+		t.Fatalf("expected positive text_order, got=%#v", assistant.Metadata["text_order"])
+	}
+}
+
+func TestProcessAgentRejectsUnsupportedChannel(t *testing.T) {
+	srv := newTestServer(t)
+
+	procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"hello"}]}],"session_id":"s1","user_id":"u1","channel":"sms","stream":false}`
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/agent/process", strings.NewReader(procReq)))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got=%d body=%s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"code":"channel_not_supported"`) {
+		t.Fatalf("unexpected error body: %s", w.Body.String())
+	}
+}
+
+func TestProcessAgentRespectsRequestedChannelForWebSource(t *testing.T) {
+	var tokenCalls atomic.Int32
+	var messageCalls atomic.Int32
+
+	qqAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			tokenCalls.Add(1)
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"access_token":"qq-token","expires_in":7200}`))
+		case "/v2/users/u-web-auto/messages":
+			messageCalls.Add(1)
+			w.WriteHeader(http.StatusOK)
+		default:
+			t.Fatalf("unexpected qq path: %s", r.URL.Path)
+		}
+	}))
+	defer qqAPI.Close()
+
+	srv := newTestServer(t)
+	configW := httptest.NewRecorder()
+	channelConfig := `{"enabled":true,"app_id":"app-1","client_secret":"secret-1","token_url":"` + qqAPI.URL + `/token","api_base":"` + qqAPI.URL + `","target_type":"c2c"}`
+	srv.Handler().ServeHTTP(configW, httptest.NewRequest(http.MethodPut, "/config/channels/qq", strings.NewReader(channelConfig)))
+	if configW.Code != http.StatusOK {
+		t.Fatalf("config qq status=%d body=%s", configW.Code, configW.Body.String())
+	}
+
+	procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"hello from web source"}]}],"session_id":"s-web-auto","user_id":"u-web-auto","channel":"qq","stream":false}`
+	req := httptest.NewRequest(http.MethodPost, "/agent/process", strings.NewReader(procReq))
+	req.Header.Set(channelSourceHeader, "web")
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("process status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	chatsW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(chatsW, httptest.NewRequest(http.MethodGet, "/chats?user_id=u-web-auto&channel=qq", nil))
+	if chatsW.Code != http.StatusOK {
+		t.Fatalf("list qq chats status=%d body=%s", chatsW.Code, chatsW.Body.String())
+	}
+	var qqChats []domain.ChatSpec
+	if err := json.Unmarshal(chatsW.Body.Bytes(), &qqChats); err != nil {
+		t.Fatalf("decode qq chats failed: %v body=%s", err, chatsW.Body.String())
+	}
+	if len(qqChats) != 1 {
+		t.Fatalf("expected one qq chat, got=%d body=%s", len(qqChats), chatsW.Body.String())
+	}
+	if qqChats[0].Channel != "qq" {
+		t.Fatalf("expected chat channel qq, got=%q", qqChats[0].Channel)
+	}
+
+	consoleChatsW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(consoleChatsW, httptest.NewRequest(http.MethodGet, "/chats?user_id=u-web-auto&channel=console", nil))
+	if consoleChatsW.Code != http.StatusOK {
+		t.Fatalf("list console chats status=%d body=%s", consoleChatsW.Code, consoleChatsW.Body.String())
+	}
+	var consoleChats []domain.ChatSpec
+	if err := json.Unmarshal(consoleChatsW.Body.Bytes(), &consoleChats); err != nil {
+		t.Fatalf("decode console chats failed: %v body=%s", err, consoleChatsW.Body.String())
+	}
+	if len(consoleChats) != 0 {
+		t.Fatalf("expected no console chats, got=%d body=%s", len(consoleChats), consoleChatsW.Body.String())
+	}
+	if got := tokenCalls.Load(); got != 1 {
+		t.Fatalf("expected one token call, got=%d", got)
+	}
+	if got := messageCalls.Load(); got != 1 {
+		t.Fatalf("expected one qq message call, got=%d", got)
+	}
+}
+
+func TestProcessAgentDefaultsToConsoleForCLISourceWithoutChannel(t *testing.T) {
+	srv := newTestServer(t)
+
+	procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"hello from cli source"}]}],"session_id":"s-cli-auto","user_id":"u-cli-auto","stream":false}`
+	req := httptest.NewRequest(http.MethodPost, "/agent/process", strings.NewReader(procReq))
+	req.Header.Set(channelSourceHeader, "cli")
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("process status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	chatsW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(chatsW, httptest.NewRequest(http.MethodGet, "/chats?user_id=u-cli-auto&channel=console", nil))
+	if chatsW.Code != http.StatusOK {
+		t.Fatalf("list console chats status=%d body=%s", chatsW.Code, chatsW.Body.String())
+	}
+	var chats []domain.ChatSpec
+	if err := json.Unmarshal(chatsW.Body.Bytes(), &chats); err != nil {
+		t.Fatalf("decode chats failed: %v body=%s", err, chatsW.Body.String())
+	}
+	if len(chats) != 1 {
+		t.Fatalf("expected one console chat, got=%d body=%s", len(chats), chatsW.Body.String())
+	}
+	if chats[0].Channel != "console" {
+		t.Fatalf("expected chat channel console, got=%q", chats[0].Channel)
+	}
+}
+
+func TestProcessAgentDispatchesToWebhookChannel(t *testing.T) {
+	var received atomic.Int32
+	var gotBody map[string]interface{}
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+		if r.Header.Get("X-Test-Token") != "abc123" {
+			t.Fatalf("unexpected webhook header: %s", r.Header.Get("X-Test-Token"))
+		}
+		defer r.Body.Close()
+		if err := json.NewDecoder(r.Body).Decode(&gotBody); err != nil {
+			t.Fatalf("decode webhook body failed: %v", err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer webhook.Close()
+
+	srv := newTestServer(t)
+	channelConfig := `{"enabled":true,"url":"` + webhook.URL + `","headers":{"X-Test-Token":"abc123"}}`
+	configW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(configW, httptest.NewRequest(http.MethodPut, "/config/channels/webhook", strings.NewReader(channelConfig)))
+	if configW.Code != http.StatusOK {
+		t.Fatalf("set channel config status=%d body=%s", configW.Code, configW.Body.String())
+	}
+
+	procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"hello webhook"}]}],"session_id":"s1","user_id":"u1","channel":"webhook","stream":false}`
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/agent/process", strings.NewReader(procReq)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("process status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	if got := received.Load(); got != 1 {
+		t.Fatalf("expected one webhook call, got=%d", got)
+	}
+	if gotBody["user_id"] != "u1" {
+		t.Fatalf("unexpected webhook user_id: %#v", gotBody["user_id"])
+	}
+	if gotBody["session_id"] != "s1" {
+		t.Fatalf("unexpected webhook session_id: %#v", gotBody["session_id"])
+	}
+	if text, _ := gotBody["text"].(string); !strings.Contains(text, "Echo: hello webhook") {
+		t.Fatalf("unexpected webhook text: %#v", gotBody["text"])
+	}
+}
+
+func TestGetChannelCapabilities(t *testing.T) {
+	srv := newTestServer(t)
+
+	getCaps := func(name string) plugin.ChannelCapabilities {
+		t.Helper()
+		w := callJSONEndpoint(srv, http.MethodGet, "/config/channels/"+name+"/capabilities", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("get %s capabilities status=%d body=%s", name, w.Code, w.Body.String())
+		}
+		var out channelCapabilitiesResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+			t.Fatalf("decode %s capabilities failed: %v body=%s", name, err, w.Body.String())
+		}
+		if out.Channel != name {
+			t.Fatalf("unexpected channel name: %q", out.Channel)
+		}
+		return out.Capabilities
+	}
+
+	if qq := getCaps("qq"); qq != (plugin.ChannelCapabilities{Typing: true, ReplyThreading: true}) {
+		t.Fatalf("expected qq typing and reply threading only, got=%#v", qq)
+	}
+	if slack := getCaps("slack"); slack != (plugin.ChannelCapabilities{Markdown: true}) {
+		t.Fatalf("expected slack markdown only, got=%#v", slack)
+	}
+	if console := getCaps("console"); console != (plugin.ChannelCapabilities{}) {
+		t.Fatalf("expected console to report no capabilities, got=%#v", console)
+	}
+
+	w := callJSONEndpoint(srv, http.MethodGet, "/config/channels/unknown/capabilities", "")
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), `"code":"not_found"`) {
+		t.Fatalf("expected not_found, status=%d body=%s", w.Code, w.Body.String())
+	}
+}
+
+func TestSlackChannelConfigValidatedAndDispatched(t *testing.T) {
+	var gotBody map[string]interface{}
+	slackHook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		if err := json.NewDecoder(r.Body).Decode(&gotBody); err != nil {
+			t.Fatalf("decode slack body failed: %v", err)
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer slackHook.Close()
+
+	srv := newTestServer(t)
+	typesW := callJSONEndpoint(srv, http.MethodGet, "/config/channels/types?include_requirements=true", "")
+	if typesW.Code != http.StatusOK {
+		t.Fatalf("list channel types status=%d body=%s", typesW.Code, typesW.Body.String())
+	}
+	var types []domain.ChannelTypeInfo
+	if err := json.Unmarshal(typesW.Body.Bytes(), &types); err != nil {
+		t.Fatalf("decode channel types failed: %v", err)
+	}
+	var slackInfo *domain.ChannelTypeInfo
+	for idx := range types {
+		if types[idx].Name == "slack" {
+			slackInfo = &types[idx]
+		}
+	}
+	if slackInfo == nil || len(slackInfo.RequiredConfig) != 2 {
+		t.Fatalf("expected slack requirements, got=%#v", types)
+	}
+
+	invalid := callJSONEndpoint(srv, http.MethodPut, "/config/channels/slack", `{"enabled":true,"bot_token":"xoxb-1"}`)
+	if invalid.Code != http.StatusBadRequest || !strings.Contains(invalid.Body.String(), "invalid_channel_config") {
+		t.Fatalf("expected invalid_channel_config, status=%d body=%s", invalid.Code, invalid.Body.String())
+	}
+
+	channelConfig := `{"enabled":true,"webhook_url":"` + slackHook.URL + `","bot_prefix":"[BOT] "}`
+	if w := callJSONEndpoint(srv, http.MethodPut, "/config/channels/slack", channelConfig); w.Code != http.StatusOK {
+		t.Fatalf("set channel config status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"hello slack"}]}],"session_id":"s1","user_id":"u1","channel":"slack","stream":false}`
+	if w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq); w.Code != http.StatusOK {
+		t.Fatalf("process status=%d body=%s", w.Code, w.Body.String())
+	}
+	if text, _ := gotBody["text"].(string); !strings.HasPrefix(text, "[BOT] ") || !strings.Contains(text, "Echo: hello slack") {
+		t.Fatalf("unexpected slack text: %#v", gotBody["text"])
+	}
+}
+
+func TestProcessAgentStripsMarkdownBeforeChannelDispatch(t *testing.T) {
+	var gotBody map[string]interface{}
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		if err := json.NewDecoder(r.Body).Decode(&gotBody); err != nil {
+			t.Fatalf("decode webhook body failed: %v", err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer webhook.Close()
+
+	srv := newTestServer(t)
+	channelConfig := `{"enabled":true,"url":"` + webhook.URL + `","strip_markdown":true}`
+	if w := callJSONEndpoint(srv, http.MethodPut, "/config/channels/webhook", channelConfig); w.Code != http.StatusOK {
+		t.Fatalf("set channel config status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"**bold** and [docs](https://example.com)"}]}],"session_id":"s-md","user_id":"u-md","channel":"webhook","stream":false}`
+	if w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq); w.Code != http.StatusOK {
+		t.Fatalf("process status=%d body=%s", w.Code, w.Body.String())
+	}
+	text, _ := gotBody["text"].(string)
+	if !strings.Contains(text, "bold and docs") || strings.Contains(text, "**") || strings.Contains(text, "https://example.com") {
+		t.Fatalf("expected plain text dispatch, got=%q", text)
+	}
+
+	storedMarkdown := false
+	srv.store.Read(func(st *repo.State) {
+		for _, history := range st.Histories {
+			for _, msg := range history {
+				if msg.Role != "assistant" {
+					continue
+				}
+				for _, part := range msg.Content {
+					if strings.Contains(part.Text, "**bold**") {
+						storedMarkdown = true
+					}
+				}
+			}
+		}
+	})
+	if !storedMarkdown {
+		t.Fatal("expected history to keep the original markdown reply")
+	}
+}
+
+func TestProcessAgentSplitsLongRepliesByChannelLimit(t *testing.T) {
+	var mu sync.Mutex
+	var texts []string
+	failOnChunk := 0
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode webhook body failed: %v", err)
+		}
+		text, _ := body["text"].(string)
+		mu.Lock()
+		texts = append(texts, text)
+		count := len(texts)
+		mu.Unlock()
+		if failOnChunk > 0 && count == failOnChunk {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer webhook.Close()
+
+	srv := newTestServer(t)
+	channelConfig := `{"enabled":true,"url":"` + webhook.URL + `","max_message_length":30}`
+	if w := callJSONEndpoint(srv, http.MethodPut, "/config/channels/webhook", channelConfig); w.Code != http.StatusOK {
+		t.Fatalf("set channel config status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"first paragraph\n\nsecond paragraph\n\nthird paragraph"}]}],"session_id":"s-chunk","user_id":"u-chunk","channel":"webhook","stream":false}`
+	w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq)
+	if w.Code != http.StatusOK {
+		t.Fatalf("process status=%d body=%s", w.Code, w.Body.String())
+	}
+	if len(texts) < 2 {
+		t.Fatalf("expected reply to be split, got=%#v", texts)
+	}
+	for _, text := range texts {
+		if len([]rune(text)) > 30 {
+			t.Fatalf("chunk exceeds limit: %q", text)
+		}
+	}
+	if !strings.Contains(texts[0], "first paragraph") || !strings.Contains(texts[len(texts)-1], "third paragraph") {
+		t.Fatalf("expected chunks in reply order, got=%#v", texts)
+	}
+
+	texts = nil
+	failOnChunk = 2
+	w = callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq)
+	if w.Code != http.StatusBadGateway || !strings.Contains(w.Body.String(), "channel_dispatch_failed") {
+		t.Fatalf("expected channel_dispatch_failed, status=%d body=%s", w.Code, w.Body.String())
+	}
+	if len(texts) != 2 {
+		t.Fatalf("expected dispatch to stop at the failing chunk, got=%#v", texts)
+	}
+}
+
+func TestProcessAgentAppliesChannelTransformRules(t *testing.T) {
+	var gotPath string
+	var gotBody map[string]interface{}
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		gotPath = r.URL.Path
+		if err := json.NewDecoder(r.Body).Decode(&gotBody); err != nil {
+			t.Errorf("decode webhook body failed: %v", err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer webhook.Close()
+
+	srv := newTestServer(t)
+	channelConfig := `{"enabled":true,"url":"http://127.0.0.1:1/unused","transform":{"prefix":"[bot] ","suffix":" --","fields":{"url":"reply_url"}}}`
+	if w := callJSONEndpoint(srv, http.MethodPut, "/config/channels/webhook", channelConfig); w.Code != http.StatusOK {
+		t.Fatalf("set channel config status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"hello"}]}],"session_id":"s-transform","user_id":"u-transform","channel":"webhook","stream":false,"biz_params":{"channel":{"reply_url":"` + webhook.URL + `/replies"}}}`
+	w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq)
+	if w.Code != http.StatusOK {
+		t.Fatalf("process status=%d body=%s", w.Code, w.Body.String())
+	}
+	if gotPath != "/replies" {
+		t.Fatalf("expected url mapped from biz_params, got path=%q", gotPath)
+	}
+	if gotBody["text"] != "[bot] Echo: hello --" {
+		t.Fatalf("unexpected transformed text: %#v", gotBody["text"])
+	}
+	if gotBody["user_id"] != "u-transform" || gotBody["session_id"] != "s-transform" {
+		t.Fatalf("unexpected webhook payload: %#v", gotBody)
+	}
+}
+
+func TestCronTextJobUsesChannelDispatchPipeline(t *testing.T) {
+	var texts []string
+	var mu sync.Mutex
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		texts = append(texts, stringValue(body["text"]))
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer webhook.Close()
+
+	srv := newTestServer(t)
+	channelConfig := `{"enabled":true,"url":"` + webhook.URL + `","max_message_length":14,"transform":{"prefix":"[cron] "}}`
+	if w := callJSONEndpoint(srv, http.MethodPut, "/config/channels/webhook", channelConfig); w.Code != http.StatusOK {
+		t.Fatalf("set channel config status=%d body=%s", w.Code, w.Body.String())
+	}
+	job := `{"id":"cron-webhook","name":"cron-webhook","task_type":"text","text":"first\nsecond","schedule":{"type":"interval","cron":"60s"},"dispatch":{"channel":"webhook","target":{"user_id":"u-cron","session_id":"s-cron"}}}`
+	if w := callJSONEndpoint(srv, http.MethodPost, "/cron/jobs", job); w.Code != http.StatusOK {
+		t.Fatalf("create cron job status=%d body=%s", w.Code, w.Body.String())
+	}
+	if err := srv.getCronService().ExecuteJob("cron-webhook"); err != nil {
+		t.Fatalf("execute cron job failed: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if strings.Join(texts, "|") != "[cron] first|[cron] second" {
+		t.Fatalf("expected transformed chunks, got=%q", texts)
+	}
+}
+
+func TestProcessAgentRetriesTransientChannelDispatchFailures(t *testing.T) {
+	var calls atomic.Int32
+	status := http.StatusServiceUnavailable
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= 2 {
+			w.WriteHeader(status)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer webhook.Close()
+
+	srv := newTestServer(t)
+	channelConfig := `{"enabled":true,"url":"` + webhook.URL + `","dispatch_max_retries":2,"dispatch_backoff_ms":1}`
+	if w := callJSONEndpoint(srv, http.MethodPut, "/config/channels/webhook", channelConfig); w.Code != http.StatusOK {
+		t.Fatalf("set channel config status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"hello"}]}],"session_id":"s-retry","user_id":"u-retry","channel":"webhook","stream":false}`
+	if w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq); w.Code != http.StatusOK {
+		t.Fatalf("process status=%d body=%s", w.Code, w.Body.String())
+	}
+	if got := calls.Load(); got != 3 {
+		t.Fatalf("expected 3 dispatch attempts, got=%d", got)
+	}
+
+	calls.Store(0)
+	status = http.StatusBadRequest
+	w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq)
+	if w.Code != http.StatusBadGateway || !strings.Contains(w.Body.String(), "channel_dispatch_failed") {
+		t.Fatalf("expected channel_dispatch_failed, status=%d body=%s", w.Code, w.Body.String())
+	}
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("expected non-retryable failure to be attempted once, got=%d", got)
+	}
+}
+
+func TestProcessAgentReportsChannelDispatchReceipt(t *testing.T) {
+	var fail atomic.Bool
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail.Load() {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer webhook.Close()
+
+	srv := newTestServer(t)
+	channelConfig := `{"enabled":true,"url":"` + webhook.URL + `","dispatch_best_effort":true}`
+	if w := callJSONEndpoint(srv, http.MethodPut, "/config/channels/webhook", channelConfig); w.Code != http.StatusOK {
+		t.Fatalf("set channel config status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"hello"}]}],"session_id":"s-receipt","user_id":"u-receipt","channel":"webhook","stream":false}`
+	w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq)
+	if w.Code != http.StatusOK {
+		t.Fatalf("process status=%d body=%s", w.Code, w.Body.String())
+	}
+	var resp domain.AgentProcessResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response failed: %v", err)
+	}
+	want := &domain.Dispatch{Channel: "webhook", TargetID: "u-receipt", Delivered: true, Chunks: 1}
+	if !reflect.DeepEqual(resp.Dispatch, want) {
+		t.Fatalf("unexpected dispatch receipt: %#v", resp.Dispatch)
+	}
+
+	fail.Store(true)
+	w = callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq)
+	if w.Code != http.StatusOK {
+		t.Fatalf("best-effort dispatch failure should not fail the request, status=%d body=%s", w.Code, w.Body.String())
+	}
+	resp = domain.AgentProcessResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response failed: %v", err)
+	}
+	if resp.Dispatch == nil || resp.Dispatch.Delivered || !strings.Contains(resp.Dispatch.Error, "status 400") {
+		t.Fatalf("expected failed receipt with error details, got=%#v", resp.Dispatch)
+	}
+}
+
+func TestProcessAgentQQChannelDispatchesOutboundMessage(t *testing.T) {
+	var tokenCalls atomic.Int32
+	var messageCalls atomic.Int32
+
+	qqAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			tokenCalls.Add(1)
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"access_token":"qq-token","expires_in":7200}`))
+		case "/v2/users/u1/messages":
+			messageCalls.Add(1)
+			w.WriteHeader(http.StatusOK)
+		default:
+			t.Fatalf("unexpected qq path: %s", r.URL.Path)
+		}
+	}))
+	defer qqAPI.Close()
+
+	srv := newTestServer(t)
+	channelConfig := `{"enabled":true,"app_id":"app-1","client_secret":"secret-1","bot_prefix":"[BOT] ","token_url":"` + qqAPI.URL + `/token","api_base":"` + qqAPI.URL + `","target_type":"c2c"}`
+	configW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(configW, httptest.NewRequest(http.MethodPut, "/config/channels/qq", strings.NewReader(channelConfig)))
+	if configW.Code != http.StatusOK {
+		t.Fatalf("set qq channel config status=%d body=%s", configW.Code, configW.Body.String())
+	}
+
+	procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"hello qq"}]}],"session_id":"s1","user_id":"u1","channel":"qq","stream":false}`
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/agent/process", strings.NewReader(procReq)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("process status=%d body=%s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "Echo: hello qq") {
+		t.Fatalf("unexpected process body: %s", w.Body.String())
+	}
+	if got := tokenCalls.Load(); got != 1 {
+		t.Fatalf("expected one token call, got=%d", got)
+	}
+	if got := messageCalls.Load(); got != 1 {
+		t.Fatalf("expected one qq message call, got=%d", got)
+	}
+}
+
+func TestProcessAgentQQChannelSendsTypingBeforeReply(t *testing.T) {
+	var mu sync.Mutex
+	var msgTypes []float64
+
+	qqAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"access_token":"qq-token","expires_in":7200}`))
+		case "/v2/users/u1/messages":
+			var body map[string]interface{}
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			msgType, _ := body["msg_type"].(float64)
+			mu.Lock()
+			msgTypes = append(msgTypes, msgType)
+			mu.Unlock()
+			w.WriteHeader(http.StatusOK)
+		default:
+			t.Errorf("unexpected qq path: %s", r.URL.Path)
+		}
+	}))
+	defer qqAPI.Close()
+
+	srv := newTestServer(t)
+	channelConfig := `{"enabled":true,"app_id":"app-1","client_secret":"secret-1","token_url":"` + qqAPI.URL + `/token","api_base":"` + qqAPI.URL + `","target_type":"c2c","typing_indicator":true}`
+	if w := callJSONEndpoint(srv, http.MethodPut, "/config/channels/qq", channelConfig); w.Code != http.StatusOK {
+		t.Fatalf("set qq channel config status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"hello qq"}]}],"session_id":"s1","user_id":"u1","channel":"qq","stream":false,"biz_params":{"channel":{"msg_id":"msg-1"}}}`
+	if w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq); w.Code != http.StatusOK {
+		t.Fatalf("process status=%d body=%s", w.Code, w.Body.String())
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(msgTypes, []float64{6, 0}) {
+		t.Fatalf("expected input notify before the text reply, got msg_types=%v", msgTypes)
+	}
+}
+
+func TestProcessAgentNewCommandClearsSessionContext(t *testing.T) {
+	srv := newTestServer(t)
+
+	firstReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"hello before reset"}]}],"session_id":"s-reset","user_id":"u-reset","channel":"console","stream":false}`
+	firstW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(firstW, httptest.NewRequest(http.MethodPost, "/agent/process", strings.NewReader(firstReq)))
+	if firstW.Code != http.StatusOK {
+		t.Fatalf("first process status=%d body=%s", firstW.Code, firstW.Body.String())
+	}
+
+	chatsBeforeResetW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(chatsBeforeResetW, httptest.NewRequest(http.MethodGet, "/chats?user_id=u-reset&channel=console", nil))
+	if chatsBeforeResetW.Code != http.StatusOK {
+		t.Fatalf("list chats before reset status=%d body=%s", chatsBeforeResetW.Code, chatsBeforeResetW.Body.String())
+	}
+
+	var chatsBeforeReset []domain.ChatSpec
+	if err := json.Unmarshal(chatsBeforeResetW.Body.Bytes(), &chatsBeforeReset); err != nil {
+		t.Fatalf("decode chats before reset failed: %v body=%s", err, chatsBeforeResetW.Body.String())
+	}
+	if len(chatsBeforeReset) != 1 {
+		t.Fatalf("expected one chat before reset, got=%d body=%s", len(chatsBeforeReset), chatsBeforeResetW.Body.String())
+	}
+	originalChat := chatsBeforeReset[0]
+
+	originalHistoryW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(originalHistoryW, httptest.NewRequest(http.MethodGet, "/chats/"+originalChat.ID, nil))
+	if originalHistoryW.Code != http.StatusOK {
+		t.Fatalf("get original history status=%d body=%s", originalHistoryW.Code, originalHistoryW.Body.String())
+	}
+	var originalHistory domain.ChatHistory
+	if err := json.Unmarshal(originalHistoryW.Body.Bytes(), &originalHistory); err != nil {
+		t.Fatalf("decode original history failed: %v body=%s", err, originalHistoryW.Body.String())
+	}
+	if !chatHistoryContainsText(originalHistory, "hello before reset") {
+		t.Fatalf("expected original history to contain first user text, body=%s", originalHistoryW.Body.String())
+	}
+
+	resetReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":" /new "}]}],"session_id":"s-reset","user_id":"u-reset","channel":"console","stream":false}`
+	resetW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(resetW, httptest.NewRequest(http.MethodPost, "/agent/process", strings.NewReader(resetReq)))
+	if resetW.Code != http.StatusOK {
+		t.Fatalf("reset process status=%d body=%s", resetW.Code, resetW.Body.String())
+	}
+	var resetResp domain.AgentProcessResponse
+	if err := json.Unmarshal(resetW.Body.Bytes(), &resetResp); err != nil {
+		t.Fatalf("decode reset response failed: %v body=%s", err, resetW.Body.String())
+	}
+	if !strings.Contains(resetResp.Reply, "上下文已清理") {
+		t.Fatalf("unexpected reset reply: %#v", resetResp.Reply)
+	}
+
+	chatsAfterResetW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(chatsAfterResetW, httptest.NewRequest(http.MethodGet, "/chats?user_id=u-reset&channel=console", nil))
+	if chatsAfterResetW.Code != http.StatusOK {
+		t.Fatalf("list chats after reset status=%d body=%s", chatsAfterResetW.Code, chatsAfterResetW.Body.String())
+	}
+	var chatsAfterReset []domain.ChatSpec
+	if err := json.Unmarshal(chatsAfterResetW.Body.Bytes(), &chatsAfterReset); err != nil {
+		t.Fatalf("decode chats after reset failed: %v body=%s", err, chatsAfterResetW.Body.String())
+	}
+	if len(chatsAfterReset) != 0 {
+		t.Fatalf("expected no chats after reset, got=%d body=%s", len(chatsAfterReset), chatsAfterResetW.Body.String())
+	}
+
+	secondReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"hello after reset"}]}],"session_id":"s-reset","user_id":"u-reset","channel":"console","stream":false}`
+	secondW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(secondW, httptest.NewRequest(http.MethodPost, "/agent/process", strings.NewReader(secondReq)))
+	if secondW.Code != http.StatusOK {
+		t.Fatalf("second process status=%d body=%s", secondW.Code, secondW.Body.String())
+	}
+
+	chatsAfterSecondW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(chatsAfterSecondW, httptest.NewRequest(http.MethodGet, "/chats?user_id=u-reset&channel=console", nil))
+	if chatsAfterSecondW.Code != http.StatusOK {
+		t.Fatalf("list chats after second message status=%d body=%s", chatsAfterSecondW.Code, chatsAfterSecondW.Body.String())
+	}
+	var chatsAfterSecond []domain.ChatSpec
+	if err := json.Unmarshal(chatsAfterSecondW.Body.Bytes(), &chatsAfterSecond); err != nil {
+		t.Fatalf("decode chats after second message failed: %v body=%s", err, chatsAfterSecondW.Body.String())
+	}
+	if len(chatsAfterSecond) != 1 {
+		t.Fatalf("expected one chat after second message, got=%d body=%s", len(chatsAfterSecond), chatsAfterSecondW.Body.String())
+	}
+	if chatsAfterSecond[0].ID == originalChat.ID {
+		t.Fatalf("expected a new chat id after reset, got unchanged id=%s", chatsAfterSecond[0].ID)
+	}
+
+	newHistoryW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(newHistoryW, httptest.NewRequest(http.MethodGet, "/chats/"+chatsAfterSecond[0].ID, nil))
+	if newHistoryW.Code != http.StatusOK {
+		t.Fatalf("get new history status=%d body=%s", newHistoryW.Code, newHistoryW.Body.String())
+	}
+	var newHistory domain.ChatHistory
+	if err := json.Unmarshal(newHistoryW.Body.Bytes(), &newHistory); err != nil {
+		t.Fatalf("decode new history failed: %v body=%s", err, newHistoryW.Body.String())
+	}
+	if chatHistoryContainsText(newHistory, "hello before reset") {
+		t.Fatalf("expected previous context to be cleared, body=%s", newHistoryW.Body.String())
+	}
+	if !chatHistoryContainsText(newHistory, "hello after reset") {
+		t.Fatalf("expected new history to contain post-reset text, body=%s", newHistoryW.Body.String())
+	}
+}
+
+func TestQQInboundC2CEventTriggersOutboundDispatch(t *testing.T) {
+	var tokenCalls atomic.Int32
+	var messageCalls atomic.Int32
+
+	qqAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			tokenCalls.Add(1)
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"access_token":"qq-token","expires_in":7200}`))
+		case "/v2/users/u-c2c/messages":
+			messageCalls.Add(1)
+			w.WriteHeader(http.StatusOK)
+		default:
+			t.Fatalf("unexpected qq path: %s", r.URL.Path)
+		}
+	}))
+	defer qqAPI.Close()
+
+	srv := newTestServer(t)
+	channelConfig := `{"enabled":true,"app_id":"app-1","client_secret":"secret-1","token_url":"` + qqAPI.URL + `/token","api_base":"` + qqAPI.URL + `","target_type":"c2c"}`
+	configW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(configW, httptest.NewRequest(http.MethodPut, "/config/channels/qq", strings.NewReader(channelConfig)))
+	if configW.Code != http.StatusOK {
+		t.Fatalf("set qq channel config status=%d body=%s", configW.Code, configW.Body.String())
+	}
+
+	inboundReq := `{"t":"C2C_MESSAGE_CREATE","d":{"id":"m-c2c-1","content":"hello inbound c2c","author":{"user_openid":"u-c2c"}}}`
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, newSignedQQInboundRequest("secret-1", inboundReq))
+	if w.Code != http.StatusOK {
+		t.Fatalf("inbound status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	if got := tokenCalls.Load(); got != 1 {
+		t.Fatalf("expected one token call, got=%d", got)
+	}
+	if got := messageCalls.Load(); got != 1 {
+		t.Fatalf("expected one qq c2c dispatch, got=%d", got)
+	}
+}
+
+func TestQQInboundDebounceBatchesBurstIntoOneTurn(t *testing.T) {
+	contents := make(chan string, 8)
+	qqAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"access_token":"qq-token","expires_in":7200}`))
+		case "/v2/users/u-burst/messages":
+			var body map[string]interface{}
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			content, _ := body["content"].(string)
+			contents <- content
+			w.WriteHeader(http.StatusOK)
+		default:
+			t.Errorf("unexpected qq path: %s", r.URL.Path)
+		}
+	}))
+	defer qqAPI.Close()
+
+	srv := newTestServer(t)
+	setDebounce := func(ms int) {
+		channelConfig := fmt.Sprintf(`{"enabled":true,"app_id":"app-1","client_secret":"secret-1","token_url":"%s/token","api_base":"%s","target_type":"c2c","inbound_debounce_ms":%d}`, qqAPI.URL, qqAPI.URL, ms)
+		if w := callJSONEndpoint(srv, http.MethodPut, "/config/channels/qq", channelConfig); w.Code != http.StatusOK {
+			t.Fatalf("set qq channel config status=%d body=%s", w.Code, w.Body.String())
+		}
+	}
+	send := func(id, text string) string {
+		inboundReq := `{"t":"C2C_MESSAGE_CREATE","d":{"id":"` + id + `","content":"` + text + `","author":{"user_openid":"u-burst"}}}`
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, newSignedQQInboundRequest("secret-1", inboundReq))
+		if w.Code != http.StatusOK {
+			t.Fatalf("inbound status=%d body=%s", w.Code, w.Body.String())
+		}
+		return w.Body.String()
+	}
+
+	setDebounce(30)
+	if body := send("m-1", "first part"); !strings.Contains(body, `"debounced":true`) {
+		t.Fatalf("expected first message to be debounced, body=%s", body)
+	}
+	send("m-2", "second part")
+	select {
+	case content := <-contents:
+		if !strings.Contains(content, "first part\nsecond part") {
+			t.Fatalf("expected both messages in one reply, got=%q", content)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for debounced dispatch")
+	}
+
+	setDebounce(3600000)
+	send("m-3", "pending before reset")
+	if body := send("m-4", "/new"); strings.Contains(body, `"debounced":true`) {
+		t.Fatalf("expected /new to bypass debouncing, body=%s", body)
+	}
+	if content := <-contents; !strings.Contains(content, "pending before reset") {
+		t.Fatalf("expected pending batch to flush before /new, got=%q", content)
+	}
+	if content := <-contents; strings.Contains(content, "pending before reset") {
+		t.Fatalf("expected /new reply after flushed batch, got=%q", content)
+	}
+	select {
+	case content := <-contents:
+		t.Fatalf("unexpected extra dispatch: %q", content)
+	default:
+	}
+}
+
+func TestQQInboundDebounceRunsTurnsOfOneSessionInOrderAndFlushesOnClose(t *testing.T) {
+	contents := make(chan string, 8)
+	releaseFirst := make(chan struct{})
+	var dispatches atomic.Int32
+	qqAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"access_token":"qq-token","expires_in":7200}`))
+		case "/v2/users/u-order/messages":
+			var body map[string]interface{}
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			content, _ := body["content"].(string)
+			contents <- content
+			if dispatches.Add(1) == 1 {
+				<-releaseFirst
+			}
+			w.WriteHeader(http.StatusOK)
+		default:
+			t.Errorf("unexpected qq path: %s", r.URL.Path)
+		}
+	}))
+	defer qqAPI.Close()
+
+	srv := newTestServer(t)
+	setDebounce := func(ms int) {
+		channelConfig := fmt.Sprintf(`{"enabled":true,"app_id":"app-1","client_secret":"secret-1","token_url":"%s/token","api_base":"%s","target_type":"c2c","inbound_debounce_ms":%d}`, qqAPI.URL, qqAPI.URL, ms)
+		if w := callJSONEndpoint(srv, http.MethodPut, "/config/channels/qq", channelConfig); w.Code != http.StatusOK {
+			t.Fatalf("set qq channel config status=%d body=%s", w.Code, w.Body.String())
+		}
+	}
+	send := func(id, text string) {
+		inboundReq := `{"t":"C2C_MESSAGE_CREATE","d":{"id":"` + id + `","content":"` + text + `","author":{"user_openid":"u-order"}}}`
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, newSignedQQInboundRequest("secret-1", inboundReq))
+		if w.Code != http.StatusOK {
+			t.Fatalf("inbound status=%d body=%s", w.Code, w.Body.String())
+		}
+	}
+	receive := func() string {
+		select {
+		case content := <-contents:
+			return content
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for debounced dispatch")
+			return ""
+		}
+	}
+
+	setDebounce(20)
+	send("m-1", "first batch")
+	if content := receive(); !strings.Contains(content, "first batch") {
+		t.Fatalf("unexpected first dispatch: %q", content)
+	}
+	send("m-2", "second batch")
+	select {
+	case content := <-contents:
+		t.Fatalf("second batch must wait for the first turn, got=%q", content)
+	case <-time.After(200 * time.Millisecond):
+	}
+	close(releaseFirst)
+	if content := receive(); !strings.Contains(content, "second batch") {
+		t.Fatalf("unexpected second dispatch: %q", content)
+	}
+
+	setDebounce(3600000)
+	send("m-3", "pending at shutdown")
+	srv.Close()
+	select {
+	case content := <-contents:
+		if !strings.Contains(content, "pending at shutdown") {
+			t.Fatalf("unexpected dispatch on close: %q", content)
+		}
+	default:
+		t.Fatal("expected Close to flush the pending batch")
+	}
+}
+
+func TestQQInboundGroupEventTriggersOutboundDispatch(t *testing.T) {
+	var tokenCalls atomic.Int32
+	var groupCalls atomic.Int32
+
+	qqAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			tokenCalls.Add(1)
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"access_token":"qq-token","expires_in":7200}`))
+		case "/v2/groups/group-openid-1/messages":
+			groupCalls.Add(1)
+			w.WriteHeader(http.StatusOK)
+		default:
+			t.Fatalf("unexpected qq path: %s", r.URL.Path)
+		}
+	}))
+	defer qqAPI.Close()
+
+	srv := newTestServer(t)
+	channelConfig := `{"enabled":true,"app_id":"app-1","client_secret":"secret-1","token_url":"` + qqAPI.URL + `/token","api_base":"` + qqAPI.URL + `","target_type":"c2c"}`
+	configW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(configW, httptest.NewRequest(http.MethodPut, "/config/channels/qq", strings.NewReader(channelConfig)))
+	if configW.Code != http.StatusOK {
+		t.Fatalf("set qq channel config status=%d body=%s", configW.Code, configW.Body.String())
+	}
+
+	inboundReq := `{"t":"GROUP_AT_MESSAGE_CREATE","d":{"id":"m-group-1","content":"hello inbound group","group_openid":"group-openid-1","author":{"member_openid":"u-group-1"}}}`
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, newSignedQQInboundRequest("secret-1", inboundReq))
+	if w.Code != http.StatusOK {
+		t.Fatalf("inbound status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	if got := tokenCalls.Load(); got != 1 {
+		t.Fatalf("expected one token call, got=%d", got)
+	}
+	if got := groupCalls.Load(); got != 1 {
+		t.Fatalf("expected one qq group dispatch, got=%d", got)
+	}
+}
+
+func TestQQInboundNewCommandClearsSessionContext(t *testing.T) {
+	var tokenCalls atomic.Int32
 	var messageCalls atomic.Int32
 
-	qqAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		switch r.URL.Path {
-		case "/token":
-			tokenCalls.Add(1)
-			w.Header().Set("Content-Type", "application/json")
-			_, _ = w.Write([]byte(`{"access_token":"qq-token","expires_in":7200}`))
-		case "/v2/users/u-c2c/messages":
-			messageCalls.Add(1)
-			w.WriteHeader(http.StatusOK)
-		default:
-			t.Fatalf("unexpected qq path: %s", r.URL.Path)
+	qqAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			tokenCalls.Add(1)
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"access_token":"qq-token","expires_in":7200}`))
+		case "/v2/users/u-c2c-reset/messages":
+			messageCalls.Add(1)
+			w.WriteHeader(http.StatusOK)
+		default:
+			t.Fatalf("unexpected qq path: %s", r.URL.Path)
+		}
+	}))
+	defer qqAPI.Close()
+
+	srv := newTestServer(t)
+	channelConfig := `{"enabled":true,"app_id":"app-1","client_secret":"secret-1","token_url":"` + qqAPI.URL + `/token","api_base":"` + qqAPI.URL + `","target_type":"c2c"}`
+	configW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(configW, httptest.NewRequest(http.MethodPut, "/config/channels/qq", strings.NewReader(channelConfig)))
+	if configW.Code != http.StatusOK {
+		t.Fatalf("set qq channel config status=%d body=%s", configW.Code, configW.Body.String())
+	}
+
+	firstInboundReq := `{"t":"C2C_MESSAGE_CREATE","d":{"id":"m-c2c-1","content":"hello inbound before reset","author":{"user_openid":"u-c2c-reset"}}}`
+	firstInboundW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(firstInboundW, newSignedQQInboundRequest("secret-1", firstInboundReq))
+	if firstInboundW.Code != http.StatusOK {
+		t.Fatalf("first inbound status=%d body=%s", firstInboundW.Code, firstInboundW.Body.String())
+	}
+
+	chatsBeforeResetW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(chatsBeforeResetW, httptest.NewRequest(http.MethodGet, "/chats?user_id=u-c2c-reset&channel=qq", nil))
+	if chatsBeforeResetW.Code != http.StatusOK {
+		t.Fatalf("list qq chats before reset status=%d body=%s", chatsBeforeResetW.Code, chatsBeforeResetW.Body.String())
+	}
+	var chatsBeforeReset []domain.ChatSpec
+	if err := json.Unmarshal(chatsBeforeResetW.Body.Bytes(), &chatsBeforeReset); err != nil {
+		t.Fatalf("decode qq chats before reset failed: %v body=%s", err, chatsBeforeResetW.Body.String())
+	}
+	if len(chatsBeforeReset) != 1 {
+		t.Fatalf("expected one qq chat before reset, got=%d body=%s", len(chatsBeforeReset), chatsBeforeResetW.Body.String())
+	}
+	originalChat := chatsBeforeReset[0]
+
+	resetInboundReq := `{"t":"C2C_MESSAGE_CREATE","d":{"id":"m-c2c-2","content":" /new ","author":{"user_openid":"u-c2c-reset"}}}`
+	resetInboundW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(resetInboundW, newSignedQQInboundRequest("secret-1", resetInboundReq))
+	if resetInboundW.Code != http.StatusOK {
+		t.Fatalf("reset inbound status=%d body=%s", resetInboundW.Code, resetInboundW.Body.String())
+	}
+	var resetResp domain.AgentProcessResponse
+	if err := json.Unmarshal(resetInboundW.Body.Bytes(), &resetResp); err != nil {
+		t.Fatalf("decode reset inbound response failed: %v body=%s", err, resetInboundW.Body.String())
+	}
+	if !strings.Contains(resetResp.Reply, "上下文已清理") {
+		t.Fatalf("unexpected reset inbound reply: %#v", resetResp.Reply)
+	}
+
+	chatsAfterResetW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(chatsAfterResetW, httptest.NewRequest(http.MethodGet, "/chats?user_id=u-c2c-reset&channel=qq", nil))
+	if chatsAfterResetW.Code != http.StatusOK {
+		t.Fatalf("list qq chats after reset status=%d body=%s", chatsAfterResetW.Code, chatsAfterResetW.Body.String())
+	}
+	var chatsAfterReset []domain.ChatSpec
+	if err := json.Unmarshal(chatsAfterResetW.Body.Bytes(), &chatsAfterReset); err != nil {
+		t.Fatalf("decode qq chats after reset failed: %v body=%s", err, chatsAfterResetW.Body.String())
+	}
+	if len(chatsAfterReset) != 0 {
+		t.Fatalf("expected no qq chats after reset, got=%d body=%s", len(chatsAfterReset), chatsAfterResetW.Body.String())
+	}
+
+	secondInboundReq := `{"t":"C2C_MESSAGE_CREATE","d":{"id":"m-c2c-3","content":"hello inbound after reset","author":{"user_openid":"u-c2c-reset"}}}`
+	secondInboundW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(secondInboundW, newSignedQQInboundRequest("secret-1", secondInboundReq))
+	if secondInboundW.Code != http.StatusOK {
+		t.Fatalf("second inbound status=%d body=%s", secondInboundW.Code, secondInboundW.Body.String())
+	}
+
+	chatsAfterSecondW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(chatsAfterSecondW, httptest.NewRequest(http.MethodGet, "/chats?user_id=u-c2c-reset&channel=qq", nil))
+	if chatsAfterSecondW.Code != http.StatusOK {
+		t.Fatalf("list qq chats after second message status=%d body=%s", chatsAfterSecondW.Code, chatsAfterSecondW.Body.String())
+	}
+	var chatsAfterSecond []domain.ChatSpec
+	if err := json.Unmarshal(chatsAfterSecondW.Body.Bytes(), &chatsAfterSecond); err != nil {
+		t.Fatalf("decode qq chats after second message failed: %v body=%s", err, chatsAfterSecondW.Body.String())
+	}
+	if len(chatsAfterSecond) != 1 {
+		t.Fatalf("expected one qq chat after second message, got=%d body=%s", len(chatsAfterSecond), chatsAfterSecondW.Body.String())
+	}
+	if chatsAfterSecond[0].ID == originalChat.ID {
+		t.Fatalf("expected a new qq chat id after reset, got unchanged id=%s", chatsAfterSecond[0].ID)
+	}
+
+	newHistoryW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(newHistoryW, httptest.NewRequest(http.MethodGet, "/chats/"+chatsAfterSecond[0].ID, nil))
+	if newHistoryW.Code != http.StatusOK {
+		t.Fatalf("get new qq history status=%d body=%s", newHistoryW.Code, newHistoryW.Body.String())
+	}
+	var newHistory domain.ChatHistory
+	if err := json.Unmarshal(newHistoryW.Body.Bytes(), &newHistory); err != nil {
+		t.Fatalf("decode new qq history failed: %v body=%s", err, newHistoryW.Body.String())
+	}
+	if chatHistoryContainsText(newHistory, "hello inbound before reset") {
+		t.Fatalf("expected qq previous context to be cleared, body=%s", newHistoryW.Body.String())
+	}
+	if !chatHistoryContainsText(newHistory, "hello inbound after reset") {
+		t.Fatalf("expected qq new history to contain post-reset text, body=%s", newHistoryW.Body.String())
+	}
+	if got := tokenCalls.Load(); got != 1 {
+		t.Fatalf("expected one token call across qq reset flow, got=%d", got)
+	}
+	if got := messageCalls.Load(); got != 3 {
+		t.Fatalf("expected three qq dispatches across reset flow, got=%d", got)
+	}
+}
+
+func TestQQInboundVerifiesWebhookSignature(t *testing.T) {
+	srv := newTestServer(t)
+	channelConfig := `{"enabled":true,"app_id":"app-1","client_secret":"secret-1"}`
+	if w := callJSONEndpoint(srv, http.MethodPut, "/config/channels/qq", channelConfig); w.Code != http.StatusOK {
+		t.Fatalf("set qq channel config status=%d body=%s", w.Code, w.Body.String())
+	}
+	inboundReq := `{"t":"MESSAGE_DELETE","d":{"id":"m-delete"}}`
+
+	unsigned := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(unsigned, httptest.NewRequest(http.MethodPost, "/channels/qq/inbound", strings.NewReader(inboundReq)))
+	if unsigned.Code != http.StatusUnauthorized || !strings.Contains(unsigned.Body.String(), `"code":"signature_invalid"`) {
+		t.Fatalf("expected unsigned request to be rejected, status=%d body=%s", unsigned.Code, unsigned.Body.String())
+	}
+
+	oversized := httptest.NewRecorder()
+	oversizedBody := `{"t":"` + strings.Repeat("x", int(qqInboundMaxBodySize)) + `"}`
+	srv.Handler().ServeHTTP(oversized, httptest.NewRequest(http.MethodPost, "/channels/qq/inbound", strings.NewReader(oversizedBody)))
+	assertAPIError(t, oversized, http.StatusRequestEntityTooLarge, "payload_too_large", "qq inbound request body exceeds size limit")
+
+	wrongSecret := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(wrongSecret, newSignedQQInboundRequest("other-secret", inboundReq))
+	if wrongSecret.Code != http.StatusUnauthorized {
+		t.Fatalf("expected request signed with another secret to be rejected, status=%d body=%s", wrongSecret.Code, wrongSecret.Body.String())
+	}
+
+	tampered := newSignedQQInboundRequest("secret-1", inboundReq)
+	tampered.Header.Set("X-Signature-Timestamp", strconv.FormatInt(time.Now().Unix()+1, 10))
+	tamperedW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(tamperedW, tampered)
+	if tamperedW.Code != http.StatusUnauthorized {
+		t.Fatalf("expected tampered timestamp to be rejected, status=%d body=%s", tamperedW.Code, tamperedW.Body.String())
+	}
+
+	for _, offset := range []time.Duration{-6 * time.Minute, 6 * time.Minute} {
+		stale := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(stale, newSignedQQInboundRequestAt("secret-1", inboundReq, time.Now().Add(offset)))
+		if stale.Code != http.StatusUnauthorized {
+			t.Fatalf("expected timestamp %s from now to be rejected, status=%d body=%s", offset, stale.Code, stale.Body.String())
+		}
+	}
+
+	signed := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(signed, newSignedQQInboundRequest("secret-1", inboundReq))
+	if signed.Code != http.StatusBadRequest || !strings.Contains(signed.Body.String(), `"code":"invalid_qq_event"`) {
+		t.Fatalf("expected signed request to reach event parsing, status=%d body=%s", signed.Code, signed.Body.String())
+	}
+
+	skipConfig := `{"enabled":true,"app_id":"app-1","client_secret":"secret-1","inbound_verify_signature":false}`
+	if w := callJSONEndpoint(srv, http.MethodPut, "/config/channels/qq", skipConfig); w.Code != http.StatusOK {
+		t.Fatalf("set qq channel config status=%d body=%s", w.Code, w.Body.String())
+	}
+	skipped := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(skipped, httptest.NewRequest(http.MethodPost, "/channels/qq/inbound", strings.NewReader(inboundReq)))
+	if skipped.Code != http.StatusBadRequest {
+		t.Fatalf("expected verification to be skipped, status=%d body=%s", skipped.Code, skipped.Body.String())
+	}
+}
+
+func TestQQInboundAnswersWebhookValidation(t *testing.T) {
+	srv := newTestServer(t)
+	channelConfig := `{"enabled":true,"app_id":"app-1","client_secret":"secret-1"}`
+	if w := callJSONEndpoint(srv, http.MethodPut, "/config/channels/qq", channelConfig); w.Code != http.StatusOK {
+		t.Fatalf("set qq channel config status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	challenge := `{"op":13,"d":{"plain_token":"token-abc","event_ts":"1725442341"}}`
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, newSignedQQInboundRequest("secret-1", challenge))
+	if w.Code != http.StatusOK {
+		t.Fatalf("validation status=%d body=%s", w.Code, w.Body.String())
+	}
+	var out struct {
+		PlainToken string `json:"plain_token"`
+		Signature  string `json:"signature"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode validation response failed: %v body=%s", err, w.Body.String())
+	}
+	if out.PlainToken != "token-abc" {
+		t.Fatalf("expected plain_token echoed, got=%q", out.PlainToken)
+	}
+	signature, err := hex.DecodeString(out.Signature)
+	if err != nil {
+		t.Fatalf("expected hex signature, got=%q", out.Signature)
+	}
+	publicKey := qqSignatureKey("secret-1").Public().(ed25519.PublicKey)
+	if !ed25519.Verify(publicKey, []byte("1725442341token-abc"), signature) {
+		t.Fatalf("signature does not verify over event_ts+plain_token: %s", out.Signature)
+	}
+
+	skipConfig := `{"enabled":true,"app_id":"app-1","client_secret":"secret-1","inbound_verify_signature":false}`
+	if w := callJSONEndpoint(srv, http.MethodPut, "/config/channels/qq", skipConfig); w.Code != http.StatusOK {
+		t.Fatalf("set qq channel config status=%d body=%s", w.Code, w.Body.String())
+	}
+	unverified := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(unverified, httptest.NewRequest(http.MethodPost, "/channels/qq/inbound", strings.NewReader(challenge)))
+	assertAPIError(t, unverified, http.StatusForbidden, "qq_signature_verification_disabled", "webhook validation requires inbound_verify_signature to be enabled")
+}
+
+func newSignedQQInboundRequest(secret, body string) *http.Request {
+	return newSignedQQInboundRequestAt(secret, body, time.Now())
+}
+
+func newSignedQQInboundRequestAt(secret, body string, signedAt time.Time) *http.Request {
+	timestamp := strconv.FormatInt(signedAt.Unix(), 10)
+	req := httptest.NewRequest(http.MethodPost, "/channels/qq/inbound", strings.NewReader(body))
+	signature := ed25519.Sign(qqSignatureKey(secret), []byte(timestamp+body))
+	req.Header.Set("X-Signature-Ed25519", hex.EncodeToString(signature))
+	req.Header.Set("X-Signature-Timestamp", timestamp)
+	return req
+}
+
+func TestQQInboundRejectsUnsupportedEvent(t *testing.T) {
+	srv := newTestServer(t)
+	inboundReq := `{"t":"MESSAGE_DELETE","d":{"id":"m-delete"}}`
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/channels/qq/inbound", strings.NewReader(inboundReq)))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got=%d body=%s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"code":"invalid_qq_event"`) {
+		t.Fatalf("unexpected body: %s", w.Body.String())
+	}
+}
+
+func chatHistoryContainsText(history domain.ChatHistory, want string) bool {
+	for _, msg := range history.Messages {
+		for _, content := range msg.Content {
+			if strings.Contains(content.Text, want) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestQQInboundStateEndpointReturnsRuntimeSnapshot(t *testing.T) {
+	srv := newTestServer(t)
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/channels/qq/state", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("state status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode state body failed: %v", err)
+	}
+	if _, ok := body["configured"].(bool); !ok {
+		t.Fatalf("missing configured bool: %#v", body["configured"])
+	}
+	if _, ok := body["running"].(bool); !ok {
+		t.Fatalf("missing running bool: %#v", body["running"])
+	}
+	if _, ok := body["connected"].(bool); !ok {
+		t.Fatalf("missing connected bool: %#v", body["connected"])
+	}
+	if _, ok := body["config"].(map[string]interface{}); !ok {
+		t.Fatalf("missing config map: %#v", body["config"])
+	}
+}
+
+func TestQQInboundStateEndpointReflectsConfiguredIntents(t *testing.T) {
+	srv := newTestServer(t)
+	channelConfig := `{"enabled":true,"app_id":"app-1","client_secret":"secret-1","inbound_enabled":true,"inbound_intents":42}`
+	configW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(configW, httptest.NewRequest(http.MethodPut, "/config/channels/qq", strings.NewReader(channelConfig)))
+	if configW.Code != http.StatusOK {
+		t.Fatalf("set qq channel config status=%d body=%s", configW.Code, configW.Body.String())
+	}
+
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/channels/qq/state", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("state status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode state body failed: %v", err)
+	}
+	if configured, _ := body["configured"].(bool); !configured {
+		t.Fatalf("expected configured=true, got=%#v", body["configured"])
+	}
+	configObj, _ := body["config"].(map[string]interface{})
+	if intents, _ := configObj["intents"].(float64); intents != 42 {
+		t.Fatalf("expected config intents=42, got=%#v", configObj["intents"])
+	}
+}
+
+func TestProcessAgentRunsShellTool(t *testing.T) {
+	srv := newTestServer(t)
+
+	procReq := `{
+		"input":[{"role":"user","type":"message","content":[{"type":"text","text":"/shell printf hello"}]}],
+		"session_id":"s-shell",
+		"user_id":"u-shell",
+		"channel":"console",
+		"stream":false,
+		"biz_params":{"tool":{"name":"shell","items":[{"command":"printf hello"}]}}
+	}`
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/agent/process", strings.NewReader(procReq)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("process status=%d body=%s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "hello") {
+		t.Fatalf("expected shell output in reply body, got=%s", w.Body.String())
+	}
+}
+
+func TestProcessAgentToolResultCarriesBrowserScreenshot(t *testing.T) {
+	srv := newTestServer(t)
+	srv.registerToolPlugin(&stubToolPlugin{
+		name: "browser",
+		invoke: func(map[string]interface{}) (map[string]interface{}, error) {
+			return map[string]interface{}{
+				"ok":                true,
+				"text":              "browser task done",
+				"screenshot_path":   "/tmp/shots/final.png",
+				"screenshot_base64": "cG5n",
+			}, nil
+		},
+	})
+
+	procReq := `{
+		"input":[{"role":"user","type":"message","content":[{"type":"text","text":"take a screenshot"}]}],
+		"session_id":"s-browser-shot",
+		"user_id":"u-browser-shot",
+		"channel":"console",
+		"stream":false,
+		"biz_params":{"tool":{"name":"browser","items":[{"task":"open example.com"}]}}
+	}`
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/agent/process", strings.NewReader(procReq)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("process status=%d body=%s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"screenshot":{"path":"/tmp/shots/final.png","base64":"cG5n"}`) {
+		t.Fatalf("expected screenshot on tool_result event, got=%s", w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), `"reply":"{`) {
+		t.Fatalf("expected text reply rather than raw result, got=%s", w.Body.String())
+	}
+
+	persisted := ""
+	srv.store.Read(func(st *repo.State) {
+		for chatID, chat := range st.Chats {
+			if chat.SessionID != "s-browser-shot" {
+				continue
+			}
+			for _, msg := range st.Histories[chatID] {
+				raw, _ := json.Marshal(msg.Metadata)
+				persisted += string(raw)
+			}
+		}
+	})
+	if !strings.Contains(persisted, "/tmp/shots/final.png") || strings.Contains(persisted, "cG5n") {
+		t.Fatalf("expected history to keep the screenshot path without inline bytes, got=%s", persisted)
+	}
+}
+
+func TestProcessAgentRejectsUnknownTool(t *testing.T) {
+	srv := newTestServer(t)
+
+	procReq := `{
+		"input":[{"role":"user","type":"message","content":[{"type":"text","text":"run desktop"}]}],
+		"session_id":"s-tool-unknown",
+		"user_id":"u-tool-unknown",
+		"channel":"console",
+		"stream":false,
+		"biz_params":{"tool":{"name":"desktop","input":{}}}
+	}`
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/agent/process", strings.NewReader(procReq)))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got=%d body=%s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"code":"tool_not_supported"`) {
+		t.Fatalf("unexpected body: %s", w.Body.String())
+	}
+}
+
+func TestProcessAgentRejectsShellCommandBlockedByPolicy(t *testing.T) {
+	t.Setenv("NEXTAI_SHELL_DENY", `^rm `)
+	srv := newTestServer(t)
+
+	procReq := `{
+		"input":[{"role":"user","type":"message","content":[{"type":"text","text":"/shell rm -rf tmp"}]}],
+		"session_id":"s-shell-policy",
+		"user_id":"u-shell-policy",
+		"channel":"console",
+		"stream":false,
+		"biz_params":{"tool":{"name":"shell","items":[{"command":"rm -rf tmp"}]}}
+	}`
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/agent/process", strings.NewReader(procReq)))
+	assertAPIError(t, w, http.StatusForbidden, "tool_permission_denied", "shell command is blocked by NEXTAI_SHELL_ALLOW/NEXTAI_SHELL_DENY")
+}
+
+func TestProcessAgentRejectsShellCwdOutsideRoot(t *testing.T) {
+	t.Setenv("NEXTAI_SHELL_ROOT", t.TempDir())
+	srv := newTestServer(t)
+
+	procReq := `{
+		"input":[{"role":"user","type":"message","content":[{"type":"text","text":"/shell ls"}]}],
+		"session_id":"s-shell-root",
+		"user_id":"u-shell-root",
+		"channel":"console",
+		"stream":false,
+		"biz_params":{"tool":{"name":"shell","items":[{"command":"ls","cwd":"/"}]}}
+	}`
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/agent/process", strings.NewReader(procReq)))
+	assertAPIError(t, w, http.StatusBadRequest, "invalid_tool_input", "tool input cwd or path is outside NEXTAI_SHELL_ROOT")
+}
+
+func TestProcessAgentWriteToolRespectsCreateOnly(t *testing.T) {
+	srv := newTestServer(t)
+	target := filepath.Join(t.TempDir(), "scaffold", "README.md")
+
+	process := func(createOnly bool) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]interface{}{
+			"input":      []interface{}{map[string]interface{}{"role": "user", "type": "message", "content": []interface{}{map[string]interface{}{"type": "text", "text": "/write"}}}},
+			"session_id": "s-write-tool",
+			"user_id":    "u-write-tool",
+			"channel":    "console",
+			"stream":     false,
+			"biz_params": map[string]interface{}{"tool": map[string]interface{}{
+				"name":  "write",
+				"items": []interface{}{map[string]interface{}{"path": target, "content": "# scaffold\n", "create_only": createOnly}},
+			}},
+		})
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/agent/process", strings.NewReader(string(body))))
+		return w
+	}
+
+	if w := process(true); w.Code != http.StatusOK {
+		t.Fatalf("expected write to succeed, got=%d body=%s", w.Code, w.Body.String())
+	}
+	if raw, err := os.ReadFile(target); err != nil || string(raw) != "# scaffold\n" {
+		t.Fatalf("unexpected written file: %q err=%v", raw, err)
+	}
+	assertAPIError(t, process(true), http.StatusConflict, "tool_conflict", "target file already exists and create_only is set")
+}
+
+func TestProcessAgentRejectsShellToolWhenDisabled(t *testing.T) {
+	t.Setenv("NEXTAI_DISABLED_TOOLS", "shell")
+	srv := newTestServer(t)
+
+	procReq := `{
+		"input":[{"role":"user","type":"message","content":[{"type":"text","text":"/shell pwd"}]}],
+		"session_id":"s-shell-disabled",
+		"user_id":"u-shell-disabled",
+		"channel":"console",
+		"stream":false,
+		"biz_params":{"tool":{"name":"shell","items":[{"command":"pwd"}]}}
+	}`
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/agent/process", strings.NewReader(procReq)))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got=%d body=%s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"code":"tool_disabled"`) {
+		t.Fatalf("unexpected body: %s", w.Body.String())
+	}
+}
+
+func TestProcessAgentRejectsShellToolDisabledAtRuntime(t *testing.T) {
+	t.Setenv("NEXTAI_DISABLED_TOOLS", "browser")
+	srv := newTestServer(t)
+
+	putW := callJSONEndpoint(srv, http.MethodPut, "/config/tools/disabled", `{"tools":[" Shell ",""]}`)
+	if putW.Code != http.StatusOK {
+		t.Fatalf("put disabled tools status=%d body=%s", putW.Code, putW.Body.String())
+	}
+	getW := callJSONEndpoint(srv, http.MethodGet, "/config/tools/disabled", "")
+	var cfg domain.DisabledToolsConfig
+	if err := json.Unmarshal(getW.Body.Bytes(), &cfg); err != nil {
+		t.Fatalf("decode disabled tools failed: %v body=%s", err, getW.Body.String())
+	}
+	if !reflect.DeepEqual(cfg.Tools, []string{"shell"}) || !reflect.DeepEqual(cfg.EnvTools, []string{"browser"}) {
+		t.Fatalf("unexpected disabled tools: %#v", cfg)
+	}
+
+	procReq := `{
+		"input":[{"role":"user","type":"message","content":[{"type":"text","text":"/shell pwd"}]}],
+		"session_id":"s-shell-runtime-disabled",
+		"user_id":"u-shell-runtime-disabled",
+		"channel":"console",
+		"stream":false,
+		"biz_params":{"tool":{"name":"shell","items":[{"command":"pwd"}]}}
+	}`
+	w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq)
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), `"code":"tool_disabled"`) {
+		t.Fatalf("expected tool_disabled, status=%d body=%s", w.Code, w.Body.String())
+	}
+	for _, def := range srv.listToolDefinitions() {
+		if def.Name == "shell" {
+			t.Fatalf("expected shell to be removed from tool definitions")
+		}
+	}
+}
+
+func TestListToolSchemasReturnsProviderDefinitions(t *testing.T) {
+	srv := newTestServer(t)
+
+	w := callJSONEndpoint(srv, http.MethodGet, "/tools/schemas", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("list tool schemas status=%d body=%s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Tools []struct {
+			Name       string          `json:"name"`
+			Parameters json.RawMessage `json:"parameters"`
+		} `json:"tools"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode tool schemas failed: %v body=%s", err, w.Body.String())
+	}
+	want, err := json.Marshal(buildToolDefinition("view").Parameters)
+	if err != nil {
+		t.Fatalf("marshal view schema failed: %v", err)
+	}
+	var viewSchema json.RawMessage
+	for _, tool := range resp.Tools {
+		if tool.Name == "view" {
+			viewSchema = tool.Parameters
+		}
+	}
+	if string(viewSchema) != string(want) {
+		t.Fatalf("view schema mismatch:\n got=%s\nwant=%s", viewSchema, want)
+	}
+	if !strings.Contains(string(viewSchema), `"required":["items"]`) {
+		t.Fatalf("expected view schema to require items, got=%s", viewSchema)
+	}
+
+	if putW := callJSONEndpoint(srv, http.MethodPut, "/config/tools/disabled", `{"tools":["view"]}`); putW.Code != http.StatusOK {
+		t.Fatalf("put disabled tools status=%d body=%s", putW.Code, putW.Body.String())
+	}
+	w = callJSONEndpoint(srv, http.MethodGet, "/tools/schemas", "")
+	if strings.Contains(w.Body.String(), `"name":"view"`) {
+		t.Fatalf("expected disabled view tool to be omitted, body=%s", w.Body.String())
+	}
+
+	w = callJSONEndpoint(srv, http.MethodGet, "/tools/schemas?prompt_mode=bogus", "")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for invalid prompt_mode, got=%d body=%s", w.Code, w.Body.String())
+	}
+}
+
+func TestStrictRequestDecodeRejectsUnknownFields(t *testing.T) {
+	srv := newTestServer(t)
+	typo := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"hi"}]}],"sesion_id":"s-strict","user_id":"u-strict","channel":"console","stream":false}`
+
+	if w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", typo); w.Code == http.StatusOK {
+		t.Fatalf("expected lenient decoding to skip the typo and fail validation later, body=%s", w.Body.String())
+	} else if strings.Contains(w.Body.String(), "unknown field") {
+		t.Fatalf("lenient decoding should not report unknown fields, body=%s", w.Body.String())
+	}
+
+	srv.cfg.StrictRequestDecode = true
+	w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", typo)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got=%d body=%s", w.Code, w.Body.String())
+	}
+	var body domain.APIErrorBody
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode error body failed: %v body=%s", err, w.Body.String())
+	}
+	details, _ := body.Error.Details.(map[string]interface{})
+	if body.Error.Code != "invalid_json" || details["field"] != "sesion_id" {
+		t.Fatalf("expected invalid_json naming sesion_id, body=%s", w.Body.String())
+	}
+
+	w = callJSONEndpoint(srv, http.MethodPut, "/config/tools/disabled", `{"tool":["shell"]}`)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `unknown field \"tool\"`) {
+		t.Fatalf("expected unknown field on config endpoint, status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	ok := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"hi"}]}],"session_id":"s-strict","user_id":"u-strict","channel":"console","stream":false}`
+	if w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", ok); w.Code != http.StatusOK {
+		t.Fatalf("expected well-formed request to pass in strict mode, status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	target := filepath.Join(t.TempDir(), "strict.txt")
+	if err := os.WriteFile(target, []byte("strict shortcut\n"), 0o644); err != nil {
+		t.Fatalf("write target failed: %v", err)
+	}
+	shortcut := fmt.Sprintf(`{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"view it"}]}],"session_id":"s-strict","user_id":"u-strict","channel":"console","stream":false,"view":[{"path":%q,"start":1,"end":1}]}`, target)
+	if w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", shortcut); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "strict shortcut") {
+		t.Fatalf("expected shortcut tool key to pass in strict mode, status=%d body=%s", w.Code, w.Body.String())
+	}
+}
+
+func TestProcessAgentRejectsShellToolWithoutCommand(t *testing.T) {
+	srv := newTestServer(t)
+
+	procReq := `{
+		"input":[{"role":"user","type":"message","content":[{"type":"text","text":"/shell"}]}],
+		"session_id":"s-shell-empty",
+		"user_id":"u-shell-empty",
+		"channel":"console",
+		"stream":false,
+		"biz_params":{"tool":{"name":"shell","items":[{}]}}
+	}`
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/agent/process", strings.NewReader(procReq)))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got=%d body=%s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"code":"invalid_tool_input"`) {
+		t.Fatalf("unexpected body: %s", w.Body.String())
+	}
+}
+
+func TestProcessAgentAcceptsBizParamsShellInputCommandForBackwardCompatibility(t *testing.T) {
+	srv := newTestServer(t)
+
+	procReq := `{
+		"input":[{"role":"user","type":"message","content":[{"type":"text","text":"/shell compat"}]}],
+		"session_id":"s-shell-biz-compat",
+		"user_id":"u-shell-biz-compat",
+		"channel":"console",
+		"stream":false,
+		"biz_params":{"tool":{"name":"shell","input":{"command":"printf compat"}}}
+	}`
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/agent/process", strings.NewReader(procReq)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got=%d body=%s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"reply":"$ printf compat`) {
+		t.Fatalf("unexpected body: %s", w.Body.String())
+	}
+}
+
+func TestPrependSystemLayersPreservesOrder(t *testing.T) {
+	input := []domain.AgentInputMessage{
+		{
+			Role: "user",
+			Type: "message",
+			Content: []domain.RuntimeContent{
+				{Type: "text", Text: "hello"},
+			},
+		},
+	}
+
+	layers := []systemPromptLayer{
+		{Name: "base_system", Role: "system", Content: "base"},
+		{Name: "tool_guide_system", Role: "system", Content: "tool"},
+		{Name: "workspace_policy_system", Role: "system", Content: ""},
+		{Name: "session_policy_system", Role: "system", Content: "session"},
+	}
+
+	out := prependSystemLayers(input, layers)
+	if len(out) != 4 {
+		t.Fatalf("expected 4 messages, got=%d", len(out))
+	}
+	if got := out[0].Content[0].Text; got != "base" {
+		t.Fatalf("first layer mismatch: %q", got)
+	}
+	if got := out[1].Content[0].Text; got != "tool" {
+		t.Fatalf("second layer mismatch: %q", got)
+	}
+	if got := out[2].Content[0].Text; got != "session" {
+		t.Fatalf("third layer mismatch: %q", got)
+	}
+	if got := out[3].Role; got != "user" {
+		t.Fatalf("last message should be user, got=%q", got)
+	}
+}
+
+func TestBuildSystemLayersOrder(t *testing.T) {
+	srv := newTestServer(t)
+
+	layers, err := srv.buildSystemLayers()
+	if err != nil {
+		t.Fatalf("buildSystemLayers failed: %v", err)
+	}
+	if len(layers) < 2 {
+		t.Fatalf("expected at least 2 layers, got=%d", len(layers))
+	}
+	if layers[0].Name != "base_system" {
+		t.Fatalf("first layer should be base_system, got=%q", layers[0].Name)
+	}
+	if layers[1].Name != "tool_guide_system" {
+		t.Fatalf("second layer should be tool_guide_system, got=%q", layers[1].Name)
+	}
+}
+
+func TestBuildSystemLayersForCodexModeFallsBackToDefaultLayers(t *testing.T) {
+	srv := newTestServer(t)
+
+	layers, err := srv.buildSystemLayersForMode(promptModeCodex)
+	if err != nil {
+		t.Fatalf("expected fallback to default layers, got err=%v", err)
+	}
+	if len(layers) < 2 {
+		t.Fatalf("expected default layers, got=%#v", layers)
+	}
+	if layers[0].Name != "base_system" || layers[1].Name != "tool_guide_system" {
+		t.Fatalf("expected fallback default layer order, got=%#v", layers)
+	}
+}
+
+func TestBuildSystemLayersForLegacyOptionsCodexModeFallsBackToDefaultLayers(t *testing.T) {
+	srv := newTestServer(t)
+
+	layers, err := srv.buildSystemLayersForLegacyOptions(promptModeCodex, codexLayerBuildOptions{
+		SessionID: "s-legacy-codex-mode",
+	})
+	if err != nil {
+		t.Fatalf("expected fallback to default layers, got err=%v", err)
+	}
+	if len(layers) < 2 {
+		t.Fatalf("expected default layers, got=%#v", layers)
+	}
+	if layers[0].Name != "base_system" || layers[1].Name != "tool_guide_system" {
+		t.Fatalf("expected fallback default layer order, got=%#v", layers)
+	}
+}
+
+func TestProcessAgentDispatchesProviderFailureReplyToChannel(t *testing.T) {
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "upstream down", http.StatusInternalServerError)
+	}))
+	defer mock.Close()
+
+	srv := newTestServer(t)
+	srv.cfg.ProviderFailureReply = "service is temporarily unavailable"
+	ch := &contractRegressionProbeChannel{name: "failure-probe"}
+	srv.registerChannelPlugin(ch)
+	srv.adminService = srv.newAdminService()
+
+	if w := callJSONEndpoint(srv, http.MethodPut, "/config/channels/failure-probe", `{"enabled":true}`); w.Code != http.StatusOK {
+		t.Fatalf("configure channel status=%d body=%s", w.Code, w.Body.String())
+	}
+	configBody := `{"enabled":true,"api_key":"sk-test","base_url":"` + mock.URL + `"}`
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/openai/config", configBody); w.Code != http.StatusOK {
+		t.Fatalf("configure provider status=%d body=%s", w.Code, w.Body.String())
+	}
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/active", `{"provider_id":"openai","model":"gpt-4o-mini"}`); w.Code != http.StatusOK {
+		t.Fatalf("set active status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"hello"}]}],"session_id":"s-fail","user_id":"u-fail","channel":"failure-probe","stream":false}`
+	w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq)
+	if w.Code != http.StatusBadGateway || !strings.Contains(w.Body.String(), `"code":"provider_request_failed"`) {
+		t.Fatalf("expected provider error to be returned, status=%d body=%s", w.Code, w.Body.String())
+	}
+	if ch.callCount != 1 || ch.lastText != "service is temporarily unavailable" {
+		t.Fatalf("expected failure reply dispatch, calls=%d text=%q", ch.callCount, ch.lastText)
+	}
+	if ch.lastUserID != "u-fail" || ch.lastSessionID != "s-fail" {
+		t.Fatalf("unexpected dispatch target user=%q session=%q", ch.lastUserID, ch.lastSessionID)
+	}
+}
+
+func TestProcessAgentEphemeralSkipsChatsButDispatches(t *testing.T) {
+	srv := newTestServer(t)
+	ch := &contractRegressionProbeChannel{name: "ephemeral-probe"}
+	srv.registerChannelPlugin(ch)
+	srv.adminService = srv.newAdminService()
+	if w := callJSONEndpoint(srv, http.MethodPut, "/config/channels/ephemeral-probe", `{"enabled":true}`); w.Code != http.StatusOK {
+		t.Fatalf("configure channel status=%d body=%s", w.Code, w.Body.String())
+	}
+	var chatsBefore, historiesBefore int
+	srv.store.Read(func(state *repo.State) {
+		chatsBefore, historiesBefore = len(state.Chats), len(state.Histories)
+	})
+
+	procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"ping"}]}],"session_id":"s-ephemeral","user_id":"u-ephemeral","channel":"ephemeral-probe","stream":false,"ephemeral":true}`
+	w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq)
+	if w.Code != http.StatusOK {
+		t.Fatalf("process status=%d body=%s", w.Code, w.Body.String())
+	}
+	var resp domain.AgentProcessResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Reply != "Echo: ping" {
+		t.Fatalf("unexpected reply: %q", resp.Reply)
+	}
+	if ch.callCount != 1 || ch.lastText != "Echo: ping" || ch.lastSessionID != "s-ephemeral" {
+		t.Fatalf("expected reply dispatch, calls=%d text=%q session=%q", ch.callCount, ch.lastText, ch.lastSessionID)
+	}
+	srv.store.Read(func(state *repo.State) {
+		if len(state.Chats) != chatsBefore || len(state.Histories) != historiesBefore {
+			t.Fatalf("ephemeral request must not create chats or history, chats=%d histories=%d", len(state.Chats), len(state.Histories))
+		}
+	})
+}
+
+func TestProcessAgentAutoTitleRenamesChatAfterFirstReply(t *testing.T) {
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/chat/completions" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), "concise title") {
+			_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"\"Weekend Hiking Trip Plan\""}}]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"pack water and snacks"}}]}`))
+	}))
+	defer mock.Close()
+
+	srv := newTestServer(t)
+	srv.cfg.AutoTitle = true
+	configBody := `{"enabled":true,"api_key":"sk-test","base_url":"` + mock.URL + `"}`
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/openai/config", configBody); w.Code != http.StatusOK {
+		t.Fatalf("configure provider status=%d body=%s", w.Code, w.Body.String())
+	}
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/active", `{"provider_id":"openai","model":"gpt-4o-mini"}`); w.Code != http.StatusOK {
+		t.Fatalf("set active status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"help me plan a hiking trip for this weekend please"}]}],"session_id":"s-title","user_id":"u-title","channel":"console","stream":false}`
+	if w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq); w.Code != http.StatusOK {
+		t.Fatalf("process status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		w := callJSONEndpoint(srv, http.MethodGet, "/chats?user_id=u-title&channel=console", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("list chats status=%d body=%s", w.Code, w.Body.String())
+		}
+		if strings.Contains(w.Body.String(), `"name":"Weekend Hiking Trip Plan"`) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected auto title to replace truncated name, body=%s", w.Body.String())
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestCloseWaitsForAutoTitleAndSkipsItsWrite(t *testing.T) {
+	titleStarted := make(chan struct{}, 1)
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), "concise title") {
+			titleStarted <- struct{}{}
+			<-r.Context().Done()
+			return
+		}
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"pack water and snacks"}}]}`))
+	}))
+	defer mock.Close()
+
+	srv, err := NewServer(config.Config{Host: "127.0.0.1", Port: "0", DataDir: t.TempDir(), AutoTitle: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	configBody := `{"enabled":true,"api_key":"sk-test","base_url":"` + mock.URL + `"}`
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/openai/config", configBody); w.Code != http.StatusOK {
+		t.Fatalf("configure provider status=%d body=%s", w.Code, w.Body.String())
+	}
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/active", `{"provider_id":"openai","model":"gpt-4o-mini"}`); w.Code != http.StatusOK {
+		t.Fatalf("set active status=%d body=%s", w.Code, w.Body.String())
+	}
+	procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"help me plan a trip"}]}],"session_id":"s-title-close","user_id":"u-title-close","channel":"console","stream":false}`
+	if w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq); w.Code != http.StatusOK {
+		t.Fatalf("process status=%d body=%s", w.Code, w.Body.String())
+	}
+	select {
+	case <-titleStarted:
+	case <-time.After(3 * time.Second):
+		t.Fatal("auto title request did not start")
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		srv.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(3 * time.Second):
+		t.Fatal("Close did not stop the pending auto title")
+	}
+	srv.store.Read(func(state *repo.State) {
+		for _, chat := range state.Chats {
+			if chat.SessionID == "s-title-close" && chat.Name != "help me plan a trip" {
+				t.Fatalf("auto title should not rename the chat after Close, got=%q", chat.Name)
+			}
+		}
+	})
+}
+
+func TestNormalizeChatTitleLimitsWords(t *testing.T) {
+	got := normalizeChatTitle("Title: \"One two three four five six seven eight.\"\nextra")
+	if got != "One two three four five six" {
+		t.Fatalf("unexpected normalized title: %q", got)
+	}
+}
+
+func TestProcessAgentRequestModelOverridesActiveWithoutMutatingIt(t *testing.T) {
+	var gotModel string
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/chat/completions" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		gotModel, _ = body["model"].(string)
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"from override"}}]}`))
+	}))
+	defer mock.Close()
+
+	srv := newTestServer(t)
+	configBody := `{"enabled":true,"api_key":"sk-test","base_url":"` + mock.URL + `"}`
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/openai/config", configBody); w.Code != http.StatusOK {
+		t.Fatalf("configure provider status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"hi"}]}],"session_id":"s-override","user_id":"u-override","channel":"console","stream":false,"model":{"provider_id":"OpenAI","model":"gpt-4o-mini"}}`
+	w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq)
+	if w.Code != http.StatusOK {
+		t.Fatalf("process status=%d body=%s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "from override") || gotModel != "gpt-4o-mini" {
+		t.Fatalf("expected request to use override model, model=%q body=%s", gotModel, w.Body.String())
+	}
+	srv.store.Read(func(state *repo.State) {
+		if state.ActiveLLM.ProviderID != "" || state.ActiveLLM.Model != "" {
+			t.Fatalf("request model override should not mutate active llm, got=%#v", state.ActiveLLM)
+		}
+	})
+
+	badReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"hi"}]}],"session_id":"s-override","user_id":"u-override","channel":"console","stream":false,"model":{"provider_id":"openai"}}`
+	badW := callJSONEndpoint(srv, http.MethodPost, "/agent/process", badReq)
+	if badW.Code != http.StatusBadRequest || !strings.Contains(badW.Body.String(), `"code":"invalid_model"`) {
+		t.Fatalf("expected invalid_model for incomplete override, status=%d body=%s", badW.Code, badW.Body.String())
+	}
+}
+
+func TestAdminStatsReflectsSeededChatsAndJobs(t *testing.T) {
+	srv := newTestServer(t)
+
+	decode := func() domain.AdminStats {
+		t.Helper()
+		w := callJSONEndpoint(srv, http.MethodGet, "/admin/stats", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("admin stats status=%d body=%s", w.Code, w.Body.String())
+		}
+		var out domain.AdminStats
+		if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+			t.Fatalf("decode admin stats failed: %v body=%s", err, w.Body.String())
+		}
+		return out
+	}
+	before := decode()
+
+	failed := "failed"
+	if err := srv.store.Write(func(state *repo.State) error {
+		state.Chats["chat-stats-a"] = domain.ChatSpec{ID: "chat-stats-a", SessionID: "s-a", UserID: "u-stats", Channel: "console"}
+		state.Chats["chat-stats-b"] = domain.ChatSpec{ID: "chat-stats-b", SessionID: "s-b", UserID: "u-stats", Channel: "console", Archived: true}
+		state.Histories["chat-stats-a"] = []domain.RuntimeMessage{{ID: "m1", Role: "user"}, {ID: "m2", Role: "assistant"}}
+		state.Histories["chat-stats-b"] = []domain.RuntimeMessage{{ID: "m3", Role: "user"}}
+		state.CronJobs["job-stats"] = domain.CronJobSpec{ID: "job-stats", Name: "job-stats", Enabled: true, TaskType: "text", Text: "hi"}
+		state.CronStates["job-stats"] = domain.CronJobState{LastStatus: &failed, Paused: true}
+		return nil
+	}); err != nil {
+		t.Fatalf("seed state failed: %v", err)
+	}
+
+	after := decode()
+	if after.Chats.Total-before.Chats.Total != 2 || after.Chats.Archived-before.Chats.Archived != 1 {
+		t.Fatalf("unexpected chat counts before=%#v after=%#v", before.Chats, after.Chats)
+	}
+	if after.Messages-before.Messages != 3 {
+		t.Fatalf("unexpected message count before=%d after=%d", before.Messages, after.Messages)
+	}
+	if after.CronJobs.Total-before.CronJobs.Total != 1 || after.CronJobs.Enabled-before.CronJobs.Enabled != 1 {
+		t.Fatalf("unexpected cron counts before=%#v after=%#v", before.CronJobs, after.CronJobs)
+	}
+	if after.CronJobs.Paused-before.CronJobs.Paused != 1 || after.CronJobs.ByStatus["failed"]-before.CronJobs.ByStatus["failed"] != 1 {
+		t.Fatalf("unexpected cron status counts before=%#v after=%#v", before.CronJobs, after.CronJobs)
+	}
+	providerCount := 0
+	srv.store.Read(func(state *repo.State) { providerCount = len(state.Providers) })
+	if after.Providers.Configured != providerCount {
+		t.Fatalf("unexpected provider counts: %#v", after.Providers)
+	}
+}
+
+func TestProcessAgentMaxStepsPersistsPartialHistory(t *testing.T) {
+	calls := 0
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/chat/completions" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		calls++
+		_, _ = fmt.Fprintf(w, `{"choices":[{"message":{"content":"checking %d","tool_calls":[{"id":"call_%d","type":"function","function":{"name":"view","arguments":"{\"path\":\"missing.txt\",\"start\":1,\"end\":1}"}}]}}]}`, calls, calls)
+	}))
+	defer mock.Close()
+
+	srv := newTestServer(t)
+	srv.cfg.MaxAgentSteps = 2
+	configBody := `{"enabled":true,"api_key":"sk-test","base_url":"` + mock.URL + `"}`
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/openai/config", configBody); w.Code != http.StatusOK {
+		t.Fatalf("configure provider status=%d body=%s", w.Code, w.Body.String())
+	}
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/active", `{"provider_id":"openai","model":"gpt-4o-mini"}`); w.Code != http.StatusOK {
+		t.Fatalf("set active status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"loop please"}]}],"session_id":"s-steps","user_id":"u-steps","channel":"console","stream":false}`
+	w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq)
+	if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), `"code":"max_steps_exceeded"`) {
+		t.Fatalf("expected max_steps_exceeded, status=%d body=%s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"stop_reason":"max_steps"`) {
+		t.Fatalf("expected max_steps stop reason in error details, body=%s", w.Body.String())
+	}
+	if calls != 2 {
+		t.Fatalf("expected provider to be called twice, got=%d", calls)
+	}
+
+	var history []domain.RuntimeMessage
+	srv.store.Read(func(state *repo.State) {
+		for id, chat := range state.Chats {
+			if chat.SessionID == "s-steps" {
+				history = state.Histories[id]
+			}
+		}
+	})
+	if len(history) != 2 {
+		t.Fatalf("expected user + partial assistant messages, got=%#v", history)
+	}
+	partial := history[1]
+	if partial.Role != "assistant" || len(partial.Content) == 0 || !strings.Contains(partial.Content[0].Text, "checking 2") {
+		t.Fatalf("unexpected partial assistant message: %#v", partial)
+	}
+}
+
+func TestProcessAgentForwardsUserToOpenAICompatibleProvider(t *testing.T) {
+	hashed := sha256.Sum256([]byte("u-forward"))
+	cases := []struct {
+		name     string
+		mode     string
+		wantUser string
+	}{
+		{name: "off", mode: "off", wantUser: ""},
+		{name: "raw", mode: "raw", wantUser: "u-forward"},
+		{name: "hashed", mode: "hashed", wantUser: hex.EncodeToString(hashed[:])},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var body map[string]interface{}
+			mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost || r.URL.Path != "/chat/completions" {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				_ = json.NewDecoder(r.Body).Decode(&body)
+				_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"ok"}}]}`))
+			}))
+			defer mock.Close()
+
+			srv := newTestServer(t)
+			configBody := `{"enabled":true,"api_key":"sk-test","base_url":"` + mock.URL + `","forward_user":"` + tc.mode + `"}`
+			if w := callJSONEndpoint(srv, http.MethodPut, "/models/openai/config", configBody); w.Code != http.StatusOK {
+				t.Fatalf("configure provider status=%d body=%s", w.Code, w.Body.String())
+			}
+			if w := callJSONEndpoint(srv, http.MethodPut, "/models/active", `{"provider_id":"openai","model":"gpt-4o-mini"}`); w.Code != http.StatusOK {
+				t.Fatalf("set active status=%d body=%s", w.Code, w.Body.String())
+			}
+
+			procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"hi"}]}],"session_id":"s-forward","user_id":"u-forward","channel":"console","stream":false}`
+			if w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq); w.Code != http.StatusOK {
+				t.Fatalf("process status=%d body=%s", w.Code, w.Body.String())
+			}
+			got, present := body["user"]
+			if tc.wantUser == "" {
+				if present {
+					t.Fatalf("user field should be omitted, got=%#v", got)
+				}
+				return
+			}
+			if got != tc.wantUser {
+				t.Fatalf("unexpected user field: got=%#v want=%q", got, tc.wantUser)
+			}
+		})
+	}
+}
+
+func TestConfigureProviderRejectsInvalidForwardUser(t *testing.T) {
+	srv := newTestServer(t)
+	w := callJSONEndpoint(srv, http.MethodPut, "/models/openai/config", `{"forward_user":"plain"}`)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "forward_user must be one of") {
+		t.Fatalf("expected forward_user validation error, status=%d body=%s", w.Code, w.Body.String())
+	}
+}
+
+func TestConfigureProviderCompressRequests(t *testing.T) {
+	srv := newTestServer(t)
+	w := callJSONEndpoint(srv, http.MethodPut, "/models/openai/config", `{"compress_requests":true}`)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"compress_requests":true`) {
+		t.Fatalf("expected compress_requests to be saved, status=%d body=%s", w.Code, w.Body.String())
+	}
+	w = callJSONEndpoint(srv, http.MethodPut, "/models/cohere/config", `{"compress_requests":true}`)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "compress_requests is only supported") {
+		t.Fatalf("expected compress_requests validation error, status=%d body=%s", w.Code, w.Body.String())
+	}
+}
+
+func TestConfigureProviderParallelToolCalls(t *testing.T) {
+	srv := newTestServer(t)
+	w := callJSONEndpoint(srv, http.MethodPut, "/models/openai/config", `{"parallel_tool_calls":false}`)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"parallel_tool_calls":false`) {
+		t.Fatalf("expected parallel_tool_calls to be saved, status=%d body=%s", w.Code, w.Body.String())
+	}
+	w = callJSONEndpoint(srv, http.MethodPut, "/models/cohere/config", `{"parallel_tool_calls":false}`)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "parallel_tool_calls is only supported") {
+		t.Fatalf("expected parallel_tool_calls validation error, status=%d body=%s", w.Code, w.Body.String())
+	}
+}
+
+func TestConfigureProviderSamplingDefaults(t *testing.T) {
+	srv := newTestServer(t)
+	w := callJSONEndpoint(srv, http.MethodPut, "/models/openai/config", `{"temperature":0,"max_tokens":1024}`)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"temperature":0`) || !strings.Contains(w.Body.String(), `"max_tokens":1024`) {
+		t.Fatalf("expected sampling defaults to be saved, status=%d body=%s", w.Code, w.Body.String())
+	}
+	w = callJSONEndpoint(srv, http.MethodPut, "/models/openai/config", `{"max_tokens":0}`)
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), `"max_tokens"`) || !strings.Contains(w.Body.String(), `"temperature":0`) {
+		t.Fatalf("expected max_tokens to be cleared and temperature kept, status=%d body=%s", w.Code, w.Body.String())
+	}
+	w = callJSONEndpoint(srv, http.MethodPut, "/models/openai/config", `{"temperature":null}`)
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), `"temperature":0`) {
+		t.Fatalf("expected temperature null to clear the default, status=%d body=%s", w.Code, w.Body.String())
+	}
+	w = callJSONEndpoint(srv, http.MethodPut, "/models/openai/config", `{"temperature":"hot"}`)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected non-numeric temperature to be rejected, status=%d body=%s", w.Code, w.Body.String())
+	}
+	w = callJSONEndpoint(srv, http.MethodPut, "/models/openai/config", `{"temperature":2.5}`)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "temperature must be between 0 and 2") {
+		t.Fatalf("expected temperature range error, status=%d body=%s", w.Code, w.Body.String())
+	}
+	w = callJSONEndpoint(srv, http.MethodPut, "/models/cohere/config", `{"temperature":0}`)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "only supported for openai-compatible") {
+		t.Fatalf("expected adapter validation error, status=%d body=%s", w.Code, w.Body.String())
+	}
+	w = callJSONEndpoint(srv, http.MethodPut, "/models/anthropic/config", `{"max_tokens":2048}`)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"max_tokens":2048`) {
+		t.Fatalf("expected anthropic max_tokens to be saved, status=%d body=%s", w.Code, w.Body.String())
+	}
+	w = callJSONEndpoint(srv, http.MethodPut, "/models/anthropic/config", `{"temperature":0}`)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "temperature is only supported for openai-compatible") {
+		t.Fatalf("expected anthropic temperature to be rejected, status=%d body=%s", w.Code, w.Body.String())
+	}
+}
+
+func TestAgentProcessFallsBackToNextProviderOnFailure(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+	var backupParallel atomic.Value
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		backupParallel.Store(fmt.Sprint(body["parallel_tool_calls"]))
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"backup reply"}}]}`))
+	}))
+	defer backup.Close()
+
+	srv := newTestServer(t)
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/openai/config", `{"enabled":true,"api_key":"sk-test","base_url":"`+primary.URL+`"}`); w.Code != http.StatusOK {
+		t.Fatalf("configure primary status=%d body=%s", w.Code, w.Body.String())
+	}
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/backup-llm/config", `{"enabled":true,"api_key":"sk-backup","base_url":"`+backup.URL+`"}`); w.Code != http.StatusOK {
+		t.Fatalf("configure backup status=%d body=%s", w.Code, w.Body.String())
+	}
+	w := callJSONEndpoint(srv, http.MethodPut, "/models/active", `{"provider_id":"openai","model":"gpt-4o-mini","fallback":[{"provider_id":"missing","model":"x"}]}`)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "fallback[0]") {
+		t.Fatalf("expected fallback validation error, status=%d body=%s", w.Code, w.Body.String())
+	}
+	w = callJSONEndpoint(srv, http.MethodPut, "/models/active", `{"provider_id":"openai","model":"gpt-4o-mini","fallback":[{"provider_id":"backup-llm","model":"backup-model"}]}`)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"fallback":[{"provider_id":"backup-llm","model":"backup-model"}]`) {
+		t.Fatalf("set active with fallback status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"hi"}]}],"session_id":"s-fallback","user_id":"u-fallback","channel":"console","stream":false,"parallel_tool_calls":false}`
+	w = callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq)
+	if w.Code != http.StatusOK {
+		t.Fatalf("process status=%d body=%s", w.Code, w.Body.String())
+	}
+	var out domain.AgentProcessResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode process response failed: %v", err)
+	}
+	if out.Reply != "backup reply" {
+		t.Fatalf("expected reply from fallback provider, got=%q", out.Reply)
+	}
+	switched := false
+	for _, evt := range out.Events {
+		if evt.Type == "provider_fallback" && evt.Meta["to_provider_id"] == "backup-llm" && evt.Meta["from_provider_id"] == "openai" {
+			switched = true
+		}
+	}
+	if !switched {
+		t.Fatalf("expected provider_fallback event, events=%#v", out.Events)
+	}
+	if got, _ := backupParallel.Load().(string); got != "false" {
+		t.Fatalf("expected the request's parallel_tool_calls on the fallback provider, got=%q", got)
+	}
+}
+
+func TestProviderAPIKeysRotateAndSkipRateLimitedKeys(t *testing.T) {
+	var mu sync.Mutex
+	usedKeys := []string{}
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		mu.Lock()
+		usedKeys = append(usedKeys, key)
+		mu.Unlock()
+		if key == "sk-key-one" {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"ok"}}]}`))
+	}))
+	defer mock.Close()
+
+	srv := newTestServer(t)
+	configBody := `{"enabled":true,"api_key":"sk-key-one","api_keys":["sk-key-two"," sk-key-one "],"base_url":"` + mock.URL + `"}`
+	w := callJSONEndpoint(srv, http.MethodPut, "/models/rotate-llm/config", configBody)
+	if w.Code != http.StatusOK {
+		t.Fatalf("configure provider status=%d body=%s", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "sk-key-two") || !strings.Contains(w.Body.String(), `"current_api_keys":["sk-***one","sk-***two"]`) {
+		t.Fatalf("expected every key masked, body=%s", w.Body.String())
+	}
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/active", `{"provider_id":"rotate-llm","model":"any-model"}`); w.Code != http.StatusOK {
+		t.Fatalf("set active status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"hi"}]}],"session_id":"s-rotate","user_id":"u-rotate","channel":"console","stream":false}`
+	if w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq); w.Code == http.StatusOK {
+		t.Fatalf("expected the rate limited first key to fail, body=%s", w.Body.String())
+	}
+	for i := 0; i < 2; i++ {
+		if w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq); w.Code != http.StatusOK {
+			t.Fatalf("process %d status=%d body=%s", i, w.Code, w.Body.String())
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if strings.Join(usedKeys, ",") != "sk-key-one,sk-key-two,sk-key-two" {
+		t.Fatalf("expected rotation to skip the rate limited key, got=%v", usedKeys)
+	}
+}
+
+func TestProviderProbeFailureCoolsDownKeyForAgentRuns(t *testing.T) {
+	var mu sync.Mutex
+	usedKeys := []string{}
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		mu.Lock()
+		usedKeys = append(usedKeys, key)
+		mu.Unlock()
+		if key == "sk-key-one" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"ok"}}]}`))
+	}))
+	defer mock.Close()
+
+	srv := newTestServer(t)
+	configBody := `{"enabled":true,"api_key":"sk-key-one","api_keys":["sk-key-two"],"base_url":"` + mock.URL + `"}`
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/probe-llm/config", configBody); w.Code != http.StatusOK {
+		t.Fatalf("configure provider status=%d body=%s", w.Code, w.Body.String())
+	}
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/active", `{"provider_id":"probe-llm","model":"any-model"}`); w.Code != http.StatusOK {
+		t.Fatalf("set active status=%d body=%s", w.Code, w.Body.String())
+	}
+	if w := callJSONEndpoint(srv, http.MethodPost, "/models/probe-llm/test", ""); w.Code == http.StatusOK {
+		t.Fatalf("expected the unauthorized first key to fail the probe, body=%s", w.Body.String())
+	}
+
+	procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"hi"}]}],"session_id":"s-probe-key","user_id":"u-probe-key","channel":"console","stream":false}`
+	for i := 0; i < 2; i++ {
+		if w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq); w.Code != http.StatusOK {
+			t.Fatalf("process %d status=%d body=%s", i, w.Code, w.Body.String())
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if strings.Join(usedKeys, ",") != "sk-key-one,sk-key-two,sk-key-two" {
+		t.Fatalf("expected agent runs to skip the key the probe found unauthorized, got=%v", usedKeys)
+	}
+}
+
+func TestAgentProcessExposesProviderErrorDetailsWhenDebugEnabled(t *testing.T) {
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":{"message":"unsupported parameter: temperature"}}`))
+	}))
+	defer mock.Close()
+
+	srv := newTestServer(t)
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/openai/config", `{"enabled":true,"api_key":"sk-test","base_url":"`+mock.URL+`"}`); w.Code != http.StatusOK {
+		t.Fatalf("configure provider status=%d body=%s", w.Code, w.Body.String())
+	}
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/active", `{"provider_id":"openai","model":"gpt-4o-mini"}`); w.Code != http.StatusOK {
+		t.Fatalf("set active status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"hi"}]}],"session_id":"s-debug-err","user_id":"u-debug-err","channel":"console","stream":false}`
+	w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq)
+	if w.Code != http.StatusBadGateway {
+		t.Fatalf("expected 502, status=%d body=%s", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "provider_body") || strings.Contains(w.Body.String(), "provider_status") {
+		t.Fatalf("provider error body should stay hidden by default: %s", w.Body.String())
+	}
+
+	srv.cfg.DebugProviderErrors = true
+	w = callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq)
+	if w.Code != http.StatusBadGateway {
+		t.Fatalf("expected 502, status=%d body=%s", w.Code, w.Body.String())
+	}
+	var body struct {
+		Error struct {
+			Details map[string]interface{} `json:"details"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode error response failed: %v", err)
+	}
+	if got, _ := body.Error.Details["provider_status"].(float64); got != http.StatusBadRequest {
+		t.Fatalf("expected provider_status=400, details=%#v", body.Error.Details)
+	}
+	if got, _ := body.Error.Details["provider_body"].(string); !strings.Contains(got, "unsupported parameter: temperature") {
+		t.Fatalf("expected provider_body snippet, details=%#v", body.Error.Details)
+	}
+}
+
+func TestTestProviderReportsConnectivity(t *testing.T) {
+	var failing atomic.Bool
+	var gotModel atomic.Value
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Model string `json:"model"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		gotModel.Store(payload.Model)
+		if failing.Load() {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":{"message":"bad key"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"OK"}}]}`))
+	}))
+	defer mock.Close()
+
+	srv := newTestServer(t)
+	configBody := `{"enabled":false,"api_key":"sk-test","base_url":"` + mock.URL + `"}`
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/openai/config", configBody); w.Code != http.StatusOK {
+		t.Fatalf("configure provider status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	w := callJSONEndpoint(srv, http.MethodPost, "/models/openai/test", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("test provider status=%d body=%s", w.Code, w.Body.String())
+	}
+	var out providerTestResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode test response failed: %v body=%s", err, w.Body.String())
+	}
+	if !out.OK || out.ModelSample != "OK" || out.Model != "gpt-4o-mini" || out.LatencyMS < 0 {
+		t.Fatalf("unexpected test response: %s", w.Body.String())
+	}
+
+	if w := callJSONEndpoint(srv, http.MethodPost, "/models/openai/test", `{"model":"gpt-4.1-mini"}`); w.Code != http.StatusOK {
+		t.Fatalf("test provider with model status=%d body=%s", w.Code, w.Body.String())
+	}
+	if got, _ := gotModel.Load().(string); got != "gpt-4.1-mini" {
+		t.Fatalf("expected requested model to be tested, got=%q", got)
+	}
+
+	failing.Store(true)
+	w = callJSONEndpoint(srv, http.MethodPost, "/models/openai/test", "")
+	if w.Code != http.StatusBadGateway || !strings.Contains(w.Body.String(), "provider_request_failed") || !strings.Contains(w.Body.String(), `"latency_ms"`) {
+		t.Fatalf("expected mapped provider error, status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	if w := callJSONEndpoint(srv, http.MethodPost, "/models/missing-provider/test", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown provider, status=%d body=%s", w.Code, w.Body.String())
+	}
+}
+
+func TestGetRemoteModelsCachesAndFallsBackToCatalog(t *testing.T) {
+	var calls atomic.Int32
+	var failing atomic.Bool
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/models" || r.Header.Get("Authorization") != "Bearer sk-test" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		calls.Add(1)
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":[{"id":"gpt-5-preview"},{"id":"gpt-4o-mini"}]}`))
+	}))
+	defer mock.Close()
+
+	srv := newTestServer(t)
+	configBody := `{"api_key":"sk-test","base_url":"` + mock.URL + `"}`
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/openai/config", configBody); w.Code != http.StatusOK {
+		t.Fatalf("configure provider status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	w := callJSONEndpoint(srv, http.MethodGet, "/models/openai/remote-models", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("remote models status=%d body=%s", w.Code, w.Body.String())
+	}
+	var out providerRemoteModelsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode remote models failed: %v body=%s", err, w.Body.String())
+	}
+	if out.Source != "remote" || len(out.Models) != 2 || out.Models[0].ID != "gpt-4o-mini" || out.Models[1].ID != "gpt-5-preview" {
+		t.Fatalf("unexpected remote models: %s", w.Body.String())
+	}
+	if out.Models[0].Capabilities == nil {
+		t.Fatalf("expected catalog details for known model: %s", w.Body.String())
+	}
+
+	failing.Store(true)
+	if w := callJSONEndpoint(srv, http.MethodGet, "/models/openai/remote-models", ""); !strings.Contains(w.Body.String(), "gpt-5-preview") {
+		t.Fatalf("expected cached remote list, body=%s", w.Body.String())
+	}
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("expected one upstream call while cached, got=%d", got)
+	}
+
+	srv.remoteModelsMu.Lock()
+	srv.remoteModels = nil
+	srv.remoteModelsMu.Unlock()
+	w = callJSONEndpoint(srv, http.MethodGet, "/models/openai/remote-models", "")
+	out = providerRemoteModelsResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode fallback failed: %v body=%s", err, w.Body.String())
+	}
+	if w.Code != http.StatusOK || out.Source != "catalog" || out.Error == "" || len(out.Models) == 0 || strings.Contains(w.Body.String(), "gpt-5-preview") {
+		t.Fatalf("expected catalog fallback, status=%d body=%s", w.Code, w.Body.String())
+	}
+}
+
+func TestProcessAgentRendersModelHeaderTemplate(t *testing.T) {
+	var gotHeader atomic.Value
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader.Store(r.Header.Get("X-Model-Provider"))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"ok"}}]}`))
+	}))
+	defer mock.Close()
+
+	srv := newTestServer(t)
+	configBody := `{"enabled":true,"api_key":"sk-test","base_url":"` + mock.URL + `","headers":{"X-Model-Provider":"{{.Model}}"},"model_aliases":{"fast":"gpt-4.1-mini"}}`
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/openai/config", configBody); w.Code != http.StatusOK {
+		t.Fatalf("configure provider status=%d body=%s", w.Code, w.Body.String())
+	}
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/active", `{"provider_id":"openai","model":"fast"}`); w.Code != http.StatusOK {
+		t.Fatalf("set active model status=%d body=%s", w.Code, w.Body.String())
+	}
+	procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"hi"}]}],"session_id":"s-header","user_id":"u-header","channel":"console","stream":false}`
+	if w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq); w.Code != http.StatusOK {
+		t.Fatalf("process status=%d body=%s", w.Code, w.Body.String())
+	}
+	if got, _ := gotHeader.Load().(string); got != "gpt-4.1-mini" {
+		t.Fatalf("expected header rendered to resolved model, got=%q", got)
+	}
+
+	w := callJSONEndpoint(srv, http.MethodPut, "/models/openai/config", `{"headers":{"X-Bad":"{{.Region}}"}}`)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "invalid_provider_config") {
+		t.Fatalf("expected invalid header template to be rejected, status=%d body=%s", w.Code, w.Body.String())
+	}
+}
+
+func TestProcessAgentReportsProviderUsage(t *testing.T) {
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/chat/completions" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"ok"}}],"usage":{"prompt_tokens":21,"completion_tokens":4}}`))
+	}))
+	defer mock.Close()
+
+	srv := newTestServer(t)
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/openai/config", `{"enabled":true,"api_key":"sk-test","base_url":"`+mock.URL+`"}`); w.Code != http.StatusOK {
+		t.Fatalf("configure provider status=%d body=%s", w.Code, w.Body.String())
+	}
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/active", `{"provider_id":"openai","model":"gpt-4o-mini"}`); w.Code != http.StatusOK {
+		t.Fatalf("set active status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"hi"}]}],"session_id":"s-usage","user_id":"u-usage","channel":"console","stream":false}`
+	w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq)
+	if w.Code != http.StatusOK {
+		t.Fatalf("process status=%d body=%s", w.Code, w.Body.String())
+	}
+	var resp domain.AgentProcessResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	want := domain.AgentUsage{PromptTokens: 21, CompletionTokens: 4, TotalTokens: 25}
+	if resp.Usage == nil || *resp.Usage != want {
+		t.Fatalf("unexpected aggregate usage: %#v", resp.Usage)
+	}
+	last := resp.Events[len(resp.Events)-1]
+	if last.Type != "usage" || last.Usage == nil || *last.Usage != want {
+		t.Fatalf("expected trailing usage event, got=%#v", last)
+	}
+}
+
+func TestProcessAgentDebugReturnsProviderMeta(t *testing.T) {
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"model":"gpt-4o-mini-2024-07-18","system_fingerprint":"fp_abc","choices":[{"message":{"content":"ok"},"finish_reason":"stop"}]}`))
+	}))
+	defer mock.Close()
+
+	srv := newTestServer(t)
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/openai/config", `{"enabled":true,"api_key":"sk-test","base_url":"`+mock.URL+`"}`); w.Code != http.StatusOK {
+		t.Fatalf("configure provider status=%d body=%s", w.Code, w.Body.String())
+	}
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/active", `{"provider_id":"openai","model":"gpt-4o-mini"}`); w.Code != http.StatusOK {
+		t.Fatalf("set active status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	process := func(debug bool) domain.AgentProcessResponse {
+		procReq := fmt.Sprintf(`{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"hi"}]}],"session_id":"s-meta","user_id":"u-meta","channel":"console","stream":false,"debug":%t}`, debug)
+		w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq)
+		if w.Code != http.StatusOK {
+			t.Fatalf("process status=%d body=%s", w.Code, w.Body.String())
+		}
+		var resp domain.AgentProcessResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		return resp
+	}
+
+	if resp := process(false); resp.ProviderMeta != nil {
+		t.Fatalf("expected no provider meta without debug, got=%#v", resp.ProviderMeta)
+	}
+
+	resp := process(true)
+	want := domain.ProviderMeta{Model: "gpt-4o-mini-2024-07-18", FinishReason: "stop", SystemFingerprint: "fp_abc"}
+	if resp.ProviderMeta == nil || *resp.ProviderMeta != want {
+		t.Fatalf("unexpected provider meta: %#v", resp.ProviderMeta)
+	}
+	var completed domain.AgentEvent
+	for _, evt := range resp.Events {
+		if evt.Type == "completed" {
+			completed = evt
+		}
+	}
+	meta, _ := completed.Meta["provider_meta"].(map[string]interface{})
+	if meta["model"] != "gpt-4o-mini-2024-07-18" || meta["finish_reason"] != "stop" {
+		t.Fatalf("expected provider meta on completed event, got=%#v", completed.Meta)
+	}
+}
+
+func TestProcessAgentDemoProviderOmitsUsage(t *testing.T) {
+	srv := newTestServer(t)
+	procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"hi"}]}],"session_id":"s-usage-demo","user_id":"u-usage","channel":"console","stream":false}`
+	w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq)
+	if w.Code != http.StatusOK {
+		t.Fatalf("process status=%d body=%s", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), `"usage"`) {
+		t.Fatalf("demo provider should not report usage, body=%s", w.Body.String())
+	}
+}
+
+func TestProcessAgentCapsNonStreamingResponseEvents(t *testing.T) {
+	calls := 0
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/chat/completions" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		calls++
+		if calls > 6 {
+			_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"all done"}}]}`))
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"choices":[{"message":{"content":"","tool_calls":[{"id":"call_%d","type":"function","function":{"name":"view","arguments":"{\"path\":\"missing.txt\",\"start\":1,\"end\":1}"}}]}}]}`, calls)
+	}))
+	defer mock.Close()
+
+	srv := newTestServer(t)
+	srv.cfg.MaxResponseEvents = 6
+	configBody := `{"enabled":true,"api_key":"sk-test","base_url":"` + mock.URL + `"}`
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/openai/config", configBody); w.Code != http.StatusOK {
+		t.Fatalf("configure provider status=%d body=%s", w.Code, w.Body.String())
+	}
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/active", `{"provider_id":"openai","model":"gpt-4o-mini"}`); w.Code != http.StatusOK {
+		t.Fatalf("set active status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"loop please"}]}],"session_id":"s-cap","user_id":"u-cap","channel":"console","stream":false}`
+	w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq)
+	if w.Code != http.StatusOK {
+		t.Fatalf("process status=%d body=%s", w.Code, w.Body.String())
+	}
+	var resp domain.AgentProcessResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if !resp.EventsTruncated {
+		t.Fatalf("expected events_truncated flag, body=%s", w.Body.String())
+	}
+	if len(resp.Events) != 6 {
+		t.Fatalf("expected 6 events, got=%d", len(resp.Events))
+	}
+	if resp.Events[0].Type != "step_started" || resp.Events[0].Step != 1 {
+		t.Fatalf("expected first step_started to be kept, got=%#v", resp.Events[0])
+	}
+	if resp.Events[1].Type != "events_elided" {
+		t.Fatalf("expected elided summary event, got=%#v", resp.Events[1])
+	}
+	if elided, _ := resp.Events[1].Meta["elided_count"].(float64); elided <= 0 {
+		t.Fatalf("expected positive elided_count, got=%#v", resp.Events[1].Meta)
+	}
+	last := resp.Events[len(resp.Events)-1]
+	if last.Type != "completed" || last.Reply != "all done" {
+		t.Fatalf("expected final completed event to be kept, got=%#v", last)
+	}
+}
+
+func TestCapResponseEventsNeverExceedsSmallLimits(t *testing.T) {
+	events := []domain.AgentEvent{{Type: "started"}, {Type: "context"}, {Type: "step_started", Step: 1}}
+	for i := 0; i < 5; i++ {
+		events = append(events, domain.AgentEvent{Type: "tool_call", Step: 1})
+	}
+	events = append(events, domain.AgentEvent{Type: "completed"})
+
+	for limit := 1; limit <= 5; limit++ {
+		out, truncated := capResponseEvents(events, limit)
+		if !truncated || len(out) != limit {
+			t.Fatalf("limit=%d: expected %d events, got=%d truncated=%v", limit, limit, len(out), truncated)
+		}
+		if last := out[len(out)-1]; last.Type != "completed" {
+			t.Fatalf("limit=%d: expected newest event to be kept, got=%#v", limit, last)
+		}
+		elided := 0
+		for _, evt := range out {
+			if evt.Type == "events_elided" {
+				n, _ := evt.Meta["elided_count"].(int)
+				elided += n
+			}
+		}
+		if limit >= 3 && elided+len(out)-1 != len(events) {
+			t.Fatalf("limit=%d: elided_count %d does not account for the dropped events", limit, elided)
+		}
+	}
+}
+
+func TestProcessAgentDryRunReturnsPlannedToolCalls(t *testing.T) {
+	calls := 0
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/chat/completions" {
+			w.WriteHeader(http.StatusNotFound)
+			return
 		}
+		calls++
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"let me look","tool_calls":[{"id":"call_1","type":"function","function":{"name":"view","arguments":"{\"path\":\"missing.txt\",\"start\":1,\"end\":1}"}}]}}]}`))
 	}))
-	defer qqAPI.Close()
+	defer mock.Close()
 
 	srv := newTestServer(t)
-	channelConfig := `{"enabled":true,"app_id":"app-1","client_secret":"secret-1","token_url":"` + qqAPI.URL + `/token","api_base":"` + qqAPI.URL + `","target_type":"c2c"}`
-	configW := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(configW, httptest.NewRequest(http.MethodPut, "/config/channels/qq", strings.NewReader(channelConfig)))
-	if configW.Code != http.StatusOK {
-		t.Fatalf("set qq channel config status=%d body=%s", configW.Code, configW.Body.String())
+	configBody := `{"enabled":true,"api_key":"sk-test","base_url":"` + mock.URL + `"}`
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/openai/config", configBody); w.Code != http.StatusOK {
+		t.Fatalf("configure provider status=%d body=%s", w.Code, w.Body.String())
+	}
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/active", `{"provider_id":"openai","model":"gpt-4o-mini"}`); w.Code != http.StatusOK {
+		t.Fatalf("set active status=%d body=%s", w.Code, w.Body.String())
 	}
 
-	inboundReq := `{"t":"C2C_MESSAGE_CREATE","d":{"id":"m-c2c-1","content":"hello inbound c2c","author":{"user_openid":"u-c2c"}}}`
-	w := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/channels/qq/inbound", strings.NewReader(inboundReq)))
-	if w.Code != http.StatusOK {
-		t.Fatalf("inbound status=%d body=%s", w.Code, w.Body.String())
+	streamReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"read it"}]}],"session_id":"s-dry","user_id":"u-dry","channel":"console","stream":true,"dry_run":true}`
+	if w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", streamReq); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected streaming dry run to be rejected, status=%d body=%s", w.Code, w.Body.String())
 	}
 
-	if got := tokenCalls.Load(); got != 1 {
-		t.Fatalf("expected one token call, got=%d", got)
+	procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"read it"}]}],"session_id":"s-dry","user_id":"u-dry","channel":"console","stream":false,"dry_run":true}`
+	w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq)
+	if w.Code != http.StatusOK {
+		t.Fatalf("process status=%d body=%s", w.Code, w.Body.String())
 	}
-	if got := messageCalls.Load(); got != 1 {
-		t.Fatalf("expected one qq c2c dispatch, got=%d", got)
+	if calls != 1 {
+		t.Fatalf("expected exactly one provider call, got=%d", calls)
 	}
+	var resp domain.AgentProcessResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	toolCalls := 0
+	for _, evt := range resp.Events {
+		switch evt.Type {
+		case "tool_result":
+			t.Fatalf("dry run must not execute tools: %#v", evt)
+		case "tool_call":
+			toolCalls++
+			if evt.ToolCall == nil || evt.ToolCall.Name != "view" || evt.Meta["dry_run"] != true {
+				t.Fatalf("unexpected tool_call event: %#v", evt)
+			}
+		}
+	}
+	if toolCalls != 1 {
+		t.Fatalf("expected one planned tool call, body=%s", w.Body.String())
+	}
+
+	srv.store.Read(func(state *repo.State) {
+		for _, chat := range state.Chats {
+			if chat.SessionID == "s-dry" {
+				t.Fatalf("dry run must not create a chat: %#v", chat)
+			}
+		}
+	})
 }
 
-func TestQQInboundGroupEventTriggersOutboundDispatch(t *testing.T) {
-	var tokenCalls atomic.Int32
-	var groupCalls atomic.Int32
+func TestProcessAgentStoresImagePartsAndWarnsForTextOnlyProvider(t *testing.T) {
+	srv := newTestServer(t)
+	procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"look"},{"type":"image_url","image_url":"https://example.com/cat.png"}]}],"session_id":"s-image","user_id":"u-image","channel":"console","stream":false}`
+	w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq)
+	if w.Code != http.StatusOK {
+		t.Fatalf("process status=%d body=%s", w.Code, w.Body.String())
+	}
+	var resp domain.AgentProcessResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Reply != "Echo: look" {
+		t.Fatalf("unexpected reply: %q", resp.Reply)
+	}
+	warned := false
+	for _, evt := range resp.Events {
+		if evt.Type == "warning" && evt.Meta["code"] == "content_parts_dropped" {
+			warned = true
+		}
+	}
+	if !warned {
+		t.Fatalf("expected content_parts_dropped warning, events=%#v", resp.Events)
+	}
 
-	qqAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		switch r.URL.Path {
-		case "/token":
-			tokenCalls.Add(1)
-			w.Header().Set("Content-Type", "application/json")
-			_, _ = w.Write([]byte(`{"access_token":"qq-token","expires_in":7200}`))
-		case "/v2/groups/group-openid-1/messages":
-			groupCalls.Add(1)
-			w.WriteHeader(http.StatusOK)
-		default:
-			t.Fatalf("unexpected qq path: %s", r.URL.Path)
+	var stored []domain.RuntimeContent
+	srv.store.Read(func(state *repo.State) {
+		for id, chat := range state.Chats {
+			if chat.SessionID == "s-image" {
+				stored = state.Histories[id][0].Content
+			}
 		}
+	})
+	if len(stored) != 2 || stored[1].Type != "image_url" || stored[1].ImageURL != "https://example.com/cat.png" {
+		t.Fatalf("expected image part to be kept in history, got=%#v", stored)
+	}
+}
+
+func TestAgentRunSurvivesClientDisconnect(t *testing.T) {
+	release := make(chan struct{})
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"finished anyway\"},\"finish_reason\":\"stop\"}]}\n\ndata: [DONE]\n\n"))
 	}))
-	defer qqAPI.Close()
+	defer mock.Close()
 
 	srv := newTestServer(t)
-	channelConfig := `{"enabled":true,"app_id":"app-1","client_secret":"secret-1","token_url":"` + qqAPI.URL + `/token","api_base":"` + qqAPI.URL + `","target_type":"c2c"}`
-	configW := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(configW, httptest.NewRequest(http.MethodPut, "/config/channels/qq", strings.NewReader(channelConfig)))
-	if configW.Code != http.StatusOK {
-		t.Fatalf("set qq channel config status=%d body=%s", configW.Code, configW.Body.String())
+	configBody := `{"enabled":true,"api_key":"sk-test","base_url":"` + mock.URL + `"}`
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/openai/config", configBody); w.Code != http.StatusOK {
+		t.Fatalf("configure provider status=%d body=%s", w.Code, w.Body.String())
+	}
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/active", `{"provider_id":"openai","model":"gpt-4o-mini"}`); w.Code != http.StatusOK {
+		t.Fatalf("set active status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	clientCtx, disconnect := context.WithCancel(context.Background())
+	procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"keep going"}]}],"session_id":"s-detach","user_id":"u-detach","channel":"console","stream":true}`
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		req := httptest.NewRequest(http.MethodPost, "/agent/process", strings.NewReader(procReq)).WithContext(clientCtx)
+		srv.Handler().ServeHTTP(httptest.NewRecorder(), req)
+	}()
+
+	runID := ""
+	deadline := time.Now().Add(2 * time.Second)
+	for runID == "" && time.Now().Before(deadline) {
+		srv.agentRunMu.Lock()
+		for id := range srv.agentRuns {
+			runID = id
+		}
+		srv.agentRunMu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if runID == "" {
+		t.Fatal("streaming run was not registered")
+	}
+	disconnect()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("run did not finish")
 	}
 
-	inboundReq := `{"t":"GROUP_AT_MESSAGE_CREATE","d":{"id":"m-group-1","content":"hello inbound group","group_openid":"group-openid-1","author":{"member_openid":"u-group-1"}}}`
-	w := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/channels/qq/inbound", strings.NewReader(inboundReq)))
+	var replay agentRunEventsResponse
+	if err := json.Unmarshal(callJSONEndpoint(srv, http.MethodGet, "/agent/runs/"+runID+"/events", "").Body.Bytes(), &replay); err != nil {
+		t.Fatalf("decode replay: %v", err)
+	}
+	if !replay.Done || len(replay.Events) == 0 || replay.Events[len(replay.Events)-1].Type != "completed" {
+		t.Fatalf("expected the run to complete after the client left, got=%#v", replay)
+	}
+}
+
+func TestStreamingAgentRunEventsCanBeReplayed(t *testing.T) {
+	srv := newTestServer(t)
+	procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"hello replay"}]}],"session_id":"s-replay","user_id":"u-replay","channel":"console","stream":true}`
+	w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq)
 	if w.Code != http.StatusOK {
-		t.Fatalf("inbound status=%d body=%s", w.Code, w.Body.String())
+		t.Fatalf("process status=%d body=%s", w.Code, w.Body.String())
 	}
 
-	if got := tokenCalls.Load(); got != 1 {
-		t.Fatalf("expected one token call, got=%d", got)
+	streamed := []domain.AgentEvent{}
+	for _, line := range strings.Split(w.Body.String(), "\n") {
+		data := strings.TrimPrefix(line, "data: ")
+		if data == line || data == "[DONE]" {
+			continue
+		}
+		var evt domain.AgentEvent
+		if err := json.Unmarshal([]byte(data), &evt); err != nil {
+			t.Fatalf("decode stream event: %v line=%q", err, line)
+		}
+		streamed = append(streamed, evt)
 	}
-	if got := groupCalls.Load(); got != 1 {
-		t.Fatalf("expected one qq group dispatch, got=%d", got)
+	if len(streamed) == 0 || streamed[0].Type != "step_started" {
+		t.Fatalf("expected stream to start with step_started, got=%#v", streamed)
+	}
+	runID, _ := streamed[0].Meta["run_id"].(string)
+	if runID == "" {
+		t.Fatalf("expected run_id in first step_started meta, got=%#v", streamed[0].Meta)
+	}
+
+	replay := callJSONEndpoint(srv, http.MethodGet, "/agent/runs/"+runID+"/events", "")
+	if replay.Code != http.StatusOK {
+		t.Fatalf("replay status=%d body=%s", replay.Code, replay.Body.String())
+	}
+	var out struct {
+		RunID  string              `json:"run_id"`
+		Done   bool                `json:"done"`
+		Events []domain.AgentEvent `json:"events"`
+	}
+	if err := json.Unmarshal(replay.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode replay: %v", err)
+	}
+	if out.RunID != runID || !out.Done || len(out.Events) != len(streamed) {
+		t.Fatalf("unexpected replay: run_id=%q done=%v events=%d streamed=%d", out.RunID, out.Done, len(out.Events), len(streamed))
+	}
+	if out.Events[len(out.Events)-1].Type != "completed" {
+		t.Fatalf("expected replay to end with completed, got=%#v", out.Events[len(out.Events)-1])
+	}
+
+	srv.agentRunMu.Lock()
+	srv.agentRuns[runID].finishedAt = time.Now().Add(-agentRunRetention - time.Second)
+	srv.agentRunMu.Unlock()
+	if w := callJSONEndpoint(srv, http.MethodGet, "/agent/runs/"+runID+"/events", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("expected expired run to be evicted, status=%d body=%s", w.Code, w.Body.String())
 	}
 }
 
-func TestQQInboundNewCommandClearsSessionContext(t *testing.T) {
-	var tokenCalls atomic.Int32
-	var messageCalls atomic.Int32
+func TestMetricsEndpointExposesAgentAndToolCounters(t *testing.T) {
+	srv := newTestServer(t)
+	srv.cfg.APIKey = "secret-token"
 
-	qqAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		switch r.URL.Path {
-		case "/token":
-			tokenCalls.Add(1)
-			w.Header().Set("Content-Type", "application/json")
-			_, _ = w.Write([]byte(`{"access_token":"qq-token","expires_in":7200}`))
-		case "/v2/users/u-c2c-reset/messages":
-			messageCalls.Add(1)
-			w.WriteHeader(http.StatusOK)
-		default:
-			t.Fatalf("unexpected qq path: %s", r.URL.Path)
+	procReq := httptest.NewRequest(http.MethodPost, "/agent/process", strings.NewReader(`{
+		"input":[{"role":"user","type":"message","content":[{"type":"text","text":"/shell printf metrics"}]}],
+		"session_id":"s-metrics",
+		"user_id":"u-metrics",
+		"channel":"console",
+		"stream":false,
+		"biz_params":{"tool":{"name":"shell","items":[{"command":"printf metrics"}]}}
+	}`))
+	procReq.Header.Set("X-API-Key", "secret-token")
+	procW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(procW, procReq)
+	if procW.Code != http.StatusOK {
+		t.Fatalf("process status=%d body=%s", procW.Code, procW.Body.String())
+	}
+
+	metricsW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(metricsW, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if metricsW.Code != http.StatusOK {
+		t.Fatalf("metrics endpoint should bypass auth, got=%d", metricsW.Code)
+	}
+	body := metricsW.Body.String()
+	for _, want := range []string{
+		"nextai_agent_requests_total",
+		"nextai_agent_request_duration_seconds_bucket",
+		`nextai_tool_invocations_total{tool="shell"}`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("expected metrics to contain %q, body=%s", want, body)
 		}
-	}))
-	defer qqAPI.Close()
+	}
+}
 
+func TestToolInvocationMetricBucketsUnregisteredTools(t *testing.T) {
 	srv := newTestServer(t)
-	channelConfig := `{"enabled":true,"app_id":"app-1","client_secret":"secret-1","token_url":"` + qqAPI.URL + `/token","api_base":"` + qqAPI.URL + `","target_type":"c2c"}`
-	configW := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(configW, httptest.NewRequest(http.MethodPut, "/config/channels/qq", strings.NewReader(channelConfig)))
-	if configW.Code != http.StatusOK {
-		t.Fatalf("set qq channel config status=%d body=%s", configW.Code, configW.Body.String())
+	if _, err := srv.executeToolCallForPromptModeWithContext(context.Background(), promptModeDefault, toolCall{Name: "made_up_tool_x1"}); err == nil {
+		t.Fatal("expected unregistered tool to fail")
 	}
 
-	firstInboundReq := `{"t":"C2C_MESSAGE_CREATE","d":{"id":"m-c2c-1","content":"hello inbound before reset","author":{"user_openid":"u-c2c-reset"}}}`
-	firstInboundW := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(firstInboundW, httptest.NewRequest(http.MethodPost, "/channels/qq/inbound", strings.NewReader(firstInboundReq)))
-	if firstInboundW.Code != http.StatusOK {
-		t.Fatalf("first inbound status=%d body=%s", firstInboundW.Code, firstInboundW.Body.String())
+	metricsW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(metricsW, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := metricsW.Body.String()
+	if strings.Contains(body, "made_up_tool_x1") {
+		t.Fatalf("unregistered tool name must not become a label, body=%s", body)
+	}
+	if !strings.Contains(body, `nextai_tool_invocations_total{tool="unknown"}`) {
+		t.Fatalf("expected unregistered tools counted as unknown, body=%s", body)
 	}
+}
 
-	chatsBeforeResetW := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(chatsBeforeResetW, httptest.NewRequest(http.MethodGet, "/chats?user_id=u-c2c-reset&channel=qq", nil))
-	if chatsBeforeResetW.Code != http.StatusOK {
-		t.Fatalf("list qq chats before reset status=%d body=%s", chatsBeforeResetW.Code, chatsBeforeResetW.Body.String())
+func TestProcessAgentRateLimitedPerUser(t *testing.T) {
+	srv := newTestServer(t)
+	srv.rateLimiter = observability.NewRateLimiter(2)
+	t.Cleanup(srv.rateLimiter.Close)
+
+	procReq := func(userID string) string {
+		return `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"hi"}]}],"session_id":"s-rate","user_id":"` + userID + `","channel":"console","stream":false}`
 	}
-	var chatsBeforeReset []domain.ChatSpec
-	if err := json.Unmarshal(chatsBeforeResetW.Body.Bytes(), &chatsBeforeReset); err != nil {
-		t.Fatalf("decode qq chats before reset failed: %v body=%s", err, chatsBeforeResetW.Body.String())
+	for i := 0; i < 2; i++ {
+		if w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq("u-rate")); w.Code != http.StatusOK {
+			t.Fatalf("request %d status=%d body=%s", i, w.Code, w.Body.String())
+		}
 	}
-	if len(chatsBeforeReset) != 1 {
-		t.Fatalf("expected one qq chat before reset, got=%d body=%s", len(chatsBeforeReset), chatsBeforeResetW.Body.String())
+	w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq("u-rate"))
+	if w.Code != http.StatusTooManyRequests || !strings.Contains(w.Body.String(), `"code":"rate_limited"`) {
+		t.Fatalf("expected 429 rate_limited, status=%d body=%s", w.Code, w.Body.String())
 	}
-	originalChat := chatsBeforeReset[0]
+	if w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq("u-other")); w.Code != http.StatusOK {
+		t.Fatalf("other user should not be throttled, status=%d body=%s", w.Code, w.Body.String())
+	}
+}
 
-	resetInboundReq := `{"t":"C2C_MESSAGE_CREATE","d":{"id":"m-c2c-2","content":" /new ","author":{"user_openid":"u-c2c-reset"}}}`
-	resetInboundW := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(resetInboundW, httptest.NewRequest(http.MethodPost, "/channels/qq/inbound", strings.NewReader(resetInboundReq)))
-	if resetInboundW.Code != http.StatusOK {
-		t.Fatalf("reset inbound status=%d body=%s", resetInboundW.Code, resetInboundW.Body.String())
+func TestCancelAgentRunStopsStreamWithCancelledError(t *testing.T) {
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer mock.Close()
+
+	srv := newTestServer(t)
+	configBody := `{"enabled":true,"api_key":"sk-test","base_url":"` + mock.URL + `"}`
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/openai/config", configBody); w.Code != http.StatusOK {
+		t.Fatalf("configure provider status=%d body=%s", w.Code, w.Body.String())
 	}
-	var resetResp domain.AgentProcessResponse
-	if err := json.Unmarshal(resetInboundW.Body.Bytes(), &resetResp); err != nil {
-		t.Fatalf("decode reset inbound response failed: %v body=%s", err, resetInboundW.Body.String())
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/active", `{"provider_id":"openai","model":"gpt-4o-mini"}`); w.Code != http.StatusOK {
+		t.Fatalf("set active status=%d body=%s", w.Code, w.Body.String())
 	}
-	if !strings.Contains(resetResp.Reply, "上下文已清理") {
-		t.Fatalf("unexpected reset inbound reply: %#v", resetResp.Reply)
+	if w := callJSONEndpoint(srv, http.MethodPost, "/agent/runs/missing/cancel", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("expected unknown run to return 404, status=%d body=%s", w.Code, w.Body.String())
 	}
 
-	chatsAfterResetW := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(chatsAfterResetW, httptest.NewRequest(http.MethodGet, "/chats?user_id=u-c2c-reset&channel=qq", nil))
-	if chatsAfterResetW.Code != http.StatusOK {
-		t.Fatalf("list qq chats after reset status=%d body=%s", chatsAfterResetW.Code, chatsAfterResetW.Body.String())
+	procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"never mind"}]}],"session_id":"s-cancel","user_id":"u-cancel","channel":"console","stream":true}`
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		done <- callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq)
+	}()
+
+	runID := ""
+	deadline := time.Now().Add(2 * time.Second)
+	for runID == "" && time.Now().Before(deadline) {
+		srv.agentRunMu.Lock()
+		for id := range srv.agentRuns {
+			runID = id
+		}
+		srv.agentRunMu.Unlock()
+		if runID == "" {
+			time.Sleep(10 * time.Millisecond)
+		}
 	}
-	var chatsAfterReset []domain.ChatSpec
-	if err := json.Unmarshal(chatsAfterResetW.Body.Bytes(), &chatsAfterReset); err != nil {
-		t.Fatalf("decode qq chats after reset failed: %v body=%s", err, chatsAfterResetW.Body.String())
+	if runID == "" {
+		t.Fatal("streaming run was not registered")
 	}
-	if len(chatsAfterReset) != 0 {
-		t.Fatalf("expected no qq chats after reset, got=%d body=%s", len(chatsAfterReset), chatsAfterResetW.Body.String())
+	if w := callJSONEndpoint(srv, http.MethodPost, "/agent/runs/"+runID+"/cancel", ""); w.Code != http.StatusOK {
+		t.Fatalf("cancel status=%d body=%s", w.Code, w.Body.String())
 	}
 
-	secondInboundReq := `{"t":"C2C_MESSAGE_CREATE","d":{"id":"m-c2c-3","content":"hello inbound after reset","author":{"user_openid":"u-c2c-reset"}}}`
-	secondInboundW := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(secondInboundW, httptest.NewRequest(http.MethodPost, "/channels/qq/inbound", strings.NewReader(secondInboundReq)))
-	if secondInboundW.Code != http.StatusOK {
-		t.Fatalf("second inbound status=%d body=%s", secondInboundW.Code, secondInboundW.Body.String())
+	var w *httptest.ResponseRecorder
+	select {
+	case w = <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("stream did not finish after cancel")
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, `"code":"cancelled"`) {
+		t.Fatalf("expected cancelled error event, body=%s", body)
+	}
+	if !strings.HasSuffix(strings.TrimSpace(body), "data: [DONE]") {
+		t.Fatalf("stream should end with [DONE], body=%s", body)
 	}
+	if w := callJSONEndpoint(srv, http.MethodPost, "/agent/runs/"+runID+"/cancel", ""); w.Code != http.StatusConflict {
+		t.Fatalf("expected finished run to return 409, status=%d body=%s", w.Code, w.Body.String())
+	}
+}
 
-	chatsAfterSecondW := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(chatsAfterSecondW, httptest.NewRequest(http.MethodGet, "/chats?user_id=u-c2c-reset&channel=qq", nil))
-	if chatsAfterSecondW.Code != http.StatusOK {
-		t.Fatalf("list qq chats after second message status=%d body=%s", chatsAfterSecondW.Code, chatsAfterSecondW.Body.String())
+func TestProcessAgentPausesToolCallsForApproval(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "approved.txt")
+	var toolFeedback atomic.Value
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Messages []struct {
+				Role    string      `json:"role"`
+				Content interface{} `json:"content"`
+			} `json:"messages"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		w.Header().Set("Content-Type", "application/json")
+		if n := len(body.Messages); n > 0 && body.Messages[n-1].Role == "tool" {
+			toolFeedback.Store(fmt.Sprint(body.Messages[n-1].Content))
+			_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"done"}}]}`))
+			return
+		}
+		args, _ := json.Marshal(map[string]string{"path": target, "content": "ok\n"})
+		call, _ := json.Marshal(map[string]interface{}{"id": "call_write", "type": "function", "function": map[string]string{"name": "write", "arguments": string(args)}})
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"","tool_calls":[` + string(call) + `]}}]}`))
+	}))
+	defer mock.Close()
+
+	srv := newTestServer(t)
+	configBody := `{"enabled":true,"api_key":"sk-test","base_url":"` + mock.URL + `"}`
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/openai/config", configBody); w.Code != http.StatusOK {
+		t.Fatalf("configure provider status=%d body=%s", w.Code, w.Body.String())
 	}
-	var chatsAfterSecond []domain.ChatSpec
-	if err := json.Unmarshal(chatsAfterSecondW.Body.Bytes(), &chatsAfterSecond); err != nil {
-		t.Fatalf("decode qq chats after second message failed: %v body=%s", err, chatsAfterSecondW.Body.String())
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/active", `{"provider_id":"openai","model":"gpt-4o-mini"}`); w.Code != http.StatusOK {
+		t.Fatalf("set active status=%d body=%s", w.Code, w.Body.String())
 	}
-	if len(chatsAfterSecond) != 1 {
-		t.Fatalf("expected one qq chat after second message, got=%d body=%s", len(chatsAfterSecond), chatsAfterSecondW.Body.String())
+
+	invalidReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"write it"}]}],"session_id":"s-approval","user_id":"u-approval","channel":"console","stream":false,"biz_params":{"require_approval":"write"}}`
+	assertAPIError(t, callJSONEndpoint(srv, http.MethodPost, "/agent/process", invalidReq), http.StatusBadRequest, "invalid_request", "biz_params.require_approval must be an array of tool names")
+
+	// run starts a run, which answers 202 as soon as the write call pauses.
+	run := func() (string, string) {
+		procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"write it"}]}],"session_id":"s-approval","user_id":"u-approval","channel":"console","stream":false,"biz_params":{"require_approval":["Write"]}}`
+		w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq)
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("expected paused run to return 202, status=%d body=%s", w.Code, w.Body.String())
+		}
+		var paused agentRunPausedResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &paused); err != nil {
+			t.Fatalf("decode paused response: %v", err)
+		}
+		if paused.RunID == "" || paused.Status != "awaiting_approval" || paused.ToolCall == nil || paused.ToolCall.Name != "write" {
+			t.Fatalf("unexpected paused response: %s", w.Body.String())
+		}
+		return paused.RunID, paused.ApprovalID
+	}
+	// finish waits for the run to end and returns its final event.
+	finish := func(runID string) domain.AgentEvent {
+		deadline := time.Now().Add(3 * time.Second)
+		for time.Now().Before(deadline) {
+			var events agentRunEventsResponse
+			_ = json.Unmarshal(callJSONEndpoint(srv, http.MethodGet, "/agent/runs/"+runID+"/events", "").Body.Bytes(), &events)
+			if events.Done && len(events.Events) > 0 {
+				return events.Events[len(events.Events)-1]
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatal("run did not finish after the decision")
+		return domain.AgentEvent{}
 	}
-	if chatsAfterSecond[0].ID == originalChat.ID {
-		t.Fatalf("expected a new qq chat id after reset, got unchanged id=%s", chatsAfterSecond[0].ID)
+
+	runID, approvalID := run()
+	if approvalID != "call_write" {
+		t.Fatalf("expected approval id from the call id, got=%q", approvalID)
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Fatalf("paused tool call must not run, stat err=%v", err)
+	}
+	assertAPIError(t, callJSONEndpoint(srv, http.MethodPost, "/agent/runs/"+runID+"/approve", `{"approval_id":"other"}`), http.StatusConflict, "no_pending_approval", "no tool call is waiting for approval")
+	if w := callJSONEndpoint(srv, http.MethodPost, "/agent/runs/"+runID+"/reject", `{"reason":"not now"}`); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"approved":false`) {
+		t.Fatalf("reject status=%d body=%s", w.Code, w.Body.String())
 	}
+	if last := finish(runID); last.Type != "completed" || last.Reply != "done" {
+		t.Fatalf("unexpected final event after rejection: %#v", last)
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Fatalf("rejected tool call must not run, stat err=%v", err)
+	}
+	if feedback, _ := toolFeedback.Load().(string); !strings.Contains(feedback, "tool call was rejected by the user: not now") {
+		t.Fatalf("expected rejection fed back to the model, got=%q", feedback)
+	}
+	assertAPIError(t, callJSONEndpoint(srv, http.MethodPost, "/agent/runs/"+runID+"/approve", ""), http.StatusConflict, "agent_run_finished", "agent run already finished")
 
-	newHistoryW := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(newHistoryW, httptest.NewRequest(http.MethodGet, "/chats/"+chatsAfterSecond[0].ID, nil))
-	if newHistoryW.Code != http.StatusOK {
-		t.Fatalf("get new qq history status=%d body=%s", newHistoryW.Code, newHistoryW.Body.String())
+	runID, _ = run()
+	if w := callJSONEndpoint(srv, http.MethodPost, "/agent/runs/"+runID+"/approve", ""); w.Code != http.StatusOK {
+		t.Fatalf("approve status=%d body=%s", w.Code, w.Body.String())
 	}
-	var newHistory domain.ChatHistory
-	if err := json.Unmarshal(newHistoryW.Body.Bytes(), &newHistory); err != nil {
-		t.Fatalf("decode new qq history failed: %v body=%s", err, newHistoryW.Body.String())
+	if last := finish(runID); last.Type != "completed" {
+		t.Fatalf("unexpected final event after approval: %#v", last)
 	}
-	if chatHistoryContainsText(newHistory, "hello inbound before reset") {
-		t.Fatalf("expected qq previous context to be cleared, body=%s", newHistoryW.Body.String())
+	if raw, err := os.ReadFile(target); err != nil || string(raw) != "ok\n" {
+		t.Fatalf("approved tool call should write the file: %q err=%v", raw, err)
 	}
-	if !chatHistoryContainsText(newHistory, "hello inbound after reset") {
-		t.Fatalf("expected qq new history to contain post-reset text, body=%s", newHistoryW.Body.String())
+	assertAPIError(t, callJSONEndpoint(srv, http.MethodPost, "/agent/runs/missing/approve", ""), http.StatusNotFound, "not_found", "agent run not found")
+}
+
+func TestToolApprovalWaitPausesTurnTimeout(t *testing.T) {
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Messages []struct {
+				Role string `json:"role"`
+			} `json:"messages"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		w.Header().Set("Content-Type", "application/json")
+		if n := len(body.Messages); n > 0 && body.Messages[n-1].Role == "tool" {
+			_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"done"}}]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"","tool_calls":[{"id":"call_ls","type":"function","function":{"name":"shell","arguments":"{\"command\":\"true\"}"}}]}}]}`))
+	}))
+	defer mock.Close()
+
+	srv, err := NewServer(config.Config{
+		Host:                  "127.0.0.1",
+		Port:                  "0",
+		DataDir:               t.TempDir(),
+		AgentTimeoutMS:        300,
+		ToolApprovalTimeoutMS: 400,
+	})
+	if err != nil {
+		t.Fatal(err)
 	}
-	if got := tokenCalls.Load(); got != 1 {
-		t.Fatalf("expected one token call across qq reset flow, got=%d", got)
+	t.Cleanup(func() { srv.Close() })
+	configBody := `{"enabled":true,"api_key":"sk-test","base_url":"` + mock.URL + `"}`
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/openai/config", configBody); w.Code != http.StatusOK {
+		t.Fatalf("configure provider status=%d body=%s", w.Code, w.Body.String())
+	}
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/active", `{"provider_id":"openai","model":"gpt-4o-mini"}`); w.Code != http.StatusOK {
+		t.Fatalf("set active status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	run := func() string {
+		procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"run it"}]}],"session_id":"s-slow-approval","user_id":"u-slow-approval","channel":"console","stream":false,"biz_params":{"require_approval":["shell"]}}`
+		w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq)
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("expected paused run to return 202, status=%d body=%s", w.Code, w.Body.String())
+		}
+		var paused agentRunPausedResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &paused); err != nil {
+			t.Fatalf("decode paused response: %v", err)
+		}
+		return paused.RunID
+	}
+	events := func(runID string) []domain.AgentEvent {
+		deadline := time.Now().Add(3 * time.Second)
+		for time.Now().Before(deadline) {
+			var events agentRunEventsResponse
+			_ = json.Unmarshal(callJSONEndpoint(srv, http.MethodGet, "/agent/runs/"+runID+"/events", "").Body.Bytes(), &events)
+			if events.Done && len(events.Events) > 0 {
+				return events.Events
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatal("run did not finish")
+		return nil
+	}
+	finish := func(runID string) domain.AgentEvent {
+		all := events(runID)
+		return all[len(all)-1]
+	}
+
+	// The decision comes after the 300ms turn timeout but within the 400ms
+	// approval timeout, so the run still completes.
+	runID := run()
+	time.Sleep(350 * time.Millisecond)
+	if w := callJSONEndpoint(srv, http.MethodPost, "/agent/runs/"+runID+"/reject", ""); w.Code != http.StatusOK {
+		t.Fatalf("reject status=%d body=%s", w.Code, w.Body.String())
+	}
+	if last := finish(runID); last.Type != "completed" || last.Reply != "done" {
+		t.Fatalf("slow approval should not time out the turn: %#v", last)
+	}
+
+	// Without a decision the approval timeout rejects the call; the model is
+	// told and the run carries on.
+	runID = run()
+	all := events(runID)
+	if last := all[len(all)-1]; last.Type != "completed" || last.Reply != "done" {
+		t.Fatalf("approval timeout should reject the call, not end the run: %#v", last)
+	}
+	resolved := false
+	for _, evt := range all {
+		if evt.Type == "tool_approval_resolved" {
+			resolved = true
+			if evt.Meta["approved"] != false || evt.Meta["reason"] != "timeout" {
+				t.Fatalf("unexpected resolved event on timeout: %#v", evt.Meta)
+			}
+		}
+		if evt.Type == "tool_result" && (evt.ToolResult == nil || evt.ToolResult.OK || !strings.Contains(evt.ToolResult.Summary, "approval timeout")) {
+			t.Fatalf("expected a rejected tool_result for the timed out call, got=%#v", evt.ToolResult)
+		}
 	}
-	if got := messageCalls.Load(); got != 3 {
-		t.Fatalf("expected three qq dispatches across reset flow, got=%d", got)
+	if !resolved {
+		t.Fatalf("expected tool_approval_resolved on timeout, events=%#v", all)
 	}
 }
 
-func TestQQInboundRejectsUnsupportedEvent(t *testing.T) {
+func TestAdminCancelsAllInFlightRunsForUser(t *testing.T) {
+	release := make(chan struct{})
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer mock.Close()
+	defer close(release)
+
 	srv := newTestServer(t)
-	inboundReq := `{"t":"MESSAGE_DELETE","d":{"id":"m-delete"}}`
-	w := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/channels/qq/inbound", strings.NewReader(inboundReq)))
-	if w.Code != http.StatusBadRequest {
-		t.Fatalf("expected 400, got=%d body=%s", w.Code, w.Body.String())
+	configBody := `{"enabled":true,"api_key":"sk-test","base_url":"` + mock.URL + `"}`
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/openai/config", configBody); w.Code != http.StatusOK {
+		t.Fatalf("configure provider status=%d body=%s", w.Code, w.Body.String())
 	}
-	if !strings.Contains(w.Body.String(), `"code":"invalid_qq_event"`) {
-		t.Fatalf("unexpected body: %s", w.Body.String())
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/active", `{"provider_id":"openai","model":"gpt-4o-mini"}`); w.Code != http.StatusOK {
+		t.Fatalf("set active status=%d body=%s", w.Code, w.Body.String())
+	}
+	if w := callJSONEndpoint(srv, http.MethodGet, "/admin/runs", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected missing user_id to return 400, status=%d body=%s", w.Code, w.Body.String())
 	}
-}
 
-func chatHistoryContainsText(history domain.ChatHistory, want string) bool {
-	for _, msg := range history.Messages {
-		for _, content := range msg.Content {
-			if strings.Contains(content.Text, want) {
-				return true
-			}
-		}
+	done := make(chan *httptest.ResponseRecorder, 2)
+	for _, stream := range []bool{true, false} {
+		procReq := fmt.Sprintf(`{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"slow"}]}],"session_id":"s-abuse-%t","user_id":"u-abuse","channel":"console","stream":%t}`, stream, stream)
+		go func() {
+			done <- callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq)
+		}()
 	}
-	return false
-}
 
-func TestQQInboundStateEndpointReturnsRuntimeSnapshot(t *testing.T) {
-	srv := newTestServer(t)
-	w := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/channels/qq/state", nil))
-	if w.Code != http.StatusOK {
-		t.Fatalf("state status=%d body=%s", w.Code, w.Body.String())
+	var listed agentRunListResponse
+	deadline := time.Now().Add(2 * time.Second)
+	for len(listed.Runs) < 2 && time.Now().Before(deadline) {
+		w := callJSONEndpoint(srv, http.MethodGet, "/admin/runs?user_id=u-abuse", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("list runs status=%d body=%s", w.Code, w.Body.String())
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &listed); err != nil {
+			t.Fatalf("decode run list: %v", err)
+		}
+		if len(listed.Runs) < 2 {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	if len(listed.Runs) != 2 {
+		t.Fatalf("expected two in-flight runs, got=%#v", listed.Runs)
 	}
 
-	var body map[string]interface{}
-	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
-		t.Fatalf("decode state body failed: %v", err)
+	w := callJSONEndpoint(srv, http.MethodPost, "/admin/runs/cancel?user_id=u-abuse", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("cancel runs status=%d body=%s", w.Code, w.Body.String())
 	}
-	if _, ok := body["configured"].(bool); !ok {
-		t.Fatalf("missing configured bool: %#v", body["configured"])
+	var cancelled agentRunBulkCancelResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &cancelled); err != nil {
+		t.Fatalf("decode cancel response: %v", err)
 	}
-	if _, ok := body["running"].(bool); !ok {
-		t.Fatalf("missing running bool: %#v", body["running"])
+	if cancelled.Cancelled != 2 {
+		t.Fatalf("expected both runs cancelled, got=%#v", cancelled)
 	}
-	if _, ok := body["connected"].(bool); !ok {
-		t.Fatalf("missing connected bool: %#v", body["connected"])
+
+	for i := 0; i < 2; i++ {
+		select {
+		case w := <-done:
+			if !strings.Contains(w.Body.String(), `"code":"cancelled"`) {
+				t.Fatalf("expected cancelled run, status=%d body=%s", w.Code, w.Body.String())
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatal("run did not finish after cancel")
+		}
 	}
-	if _, ok := body["config"].(map[string]interface{}); !ok {
-		t.Fatalf("missing config map: %#v", body["config"])
+	w = callJSONEndpoint(srv, http.MethodGet, "/admin/runs?user_id=u-abuse", "")
+	if !strings.Contains(w.Body.String(), `"runs":[]`) {
+		t.Fatalf("expected no in-flight runs after cancel, body=%s", w.Body.String())
 	}
 }
 
-func TestQQInboundStateEndpointReflectsConfiguredIntents(t *testing.T) {
+func TestProcessAgentUsesChatPinnedModel(t *testing.T) {
+	var lastModel atomic.Value
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Model string `json:"model"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		lastModel.Store(body.Model)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"chatcmpl-1","choices":[{"message":{"role":"assistant","content":"ok"}}]}`))
+	}))
+	defer mock.Close()
+
 	srv := newTestServer(t)
-	channelConfig := `{"enabled":true,"app_id":"app-1","client_secret":"secret-1","inbound_enabled":true,"inbound_intents":42}`
-	configW := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(configW, httptest.NewRequest(http.MethodPut, "/config/channels/qq", strings.NewReader(channelConfig)))
-	if configW.Code != http.StatusOK {
-		t.Fatalf("set qq channel config status=%d body=%s", configW.Code, configW.Body.String())
+	configBody := `{"enabled":true,"api_key":"sk-test","base_url":"` + mock.URL + `","model_aliases":{"pinned":"model-pinned"}}`
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/pin-llm/config", configBody); w.Code != http.StatusOK {
+		t.Fatalf("configure provider status=%d body=%s", w.Code, w.Body.String())
+	}
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/active", `{"provider_id":"pin-llm","model":"model-a"}`); w.Code != http.StatusOK {
+		t.Fatalf("set active status=%d body=%s", w.Code, w.Body.String())
 	}
 
-	w := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/channels/qq/state", nil))
-	if w.Code != http.StatusOK {
-		t.Fatalf("state status=%d body=%s", w.Code, w.Body.String())
+	invalidReq := `{"id":"chat-pin-bad","name":"A","session_id":"s-pin-bad","user_id":"u-pin","channel":"console","meta":{"active_llm_override":{"provider_id":"no-such-provider","model":"model-a"}}}`
+	if w := callJSONEndpoint(srv, http.MethodPost, "/chats", invalidReq); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"code":"invalid_chat"`) {
+		t.Fatalf("expected unknown pinned provider to be rejected, status=%d body=%s", w.Code, w.Body.String())
 	}
 
-	var body map[string]interface{}
-	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
-		t.Fatalf("decode state body failed: %v", err)
+	createReq := `{"id":"chat-pin","name":"A","session_id":"s-pin","user_id":"u-pin","channel":"console","meta":{"active_llm_override":{"provider_id":"Pin-LLM","model":"pinned"}}}`
+	w := callJSONEndpoint(srv, http.MethodPost, "/chats", createReq)
+	if w.Code != http.StatusOK {
+		t.Fatalf("create status=%d body=%s", w.Code, w.Body.String())
 	}
-	if configured, _ := body["configured"].(bool); !configured {
-		t.Fatalf("expected configured=true, got=%#v", body["configured"])
+	var created domain.ChatSpec
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("decode chat failed: %v", err)
 	}
-	configObj, _ := body["config"].(map[string]interface{})
-	if intents, _ := configObj["intents"].(float64); intents != 42 {
-		t.Fatalf("expected config intents=42, got=%#v", configObj["intents"])
+	override, _ := created.Meta[domain.ChatMetaActiveLLM].(map[string]interface{})
+	if override["provider_id"] != "pin-llm" || override["model"] != "model-pinned" || override["updated_at"] == "" {
+		t.Fatalf("expected normalized pinned model, got=%#v", created.Meta)
 	}
-}
 
-func TestProcessAgentRunsShellTool(t *testing.T) {
-	srv := newTestServer(t)
-
-	procReq := `{
-		"input":[{"role":"user","type":"message","content":[{"type":"text","text":"/shell printf hello"}]}],
-		"session_id":"s-shell",
-		"user_id":"u-shell",
-		"channel":"console",
-		"stream":false,
-		"biz_params":{"tool":{"name":"shell","items":[{"command":"printf hello"}]}}
-	}`
-	w := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/agent/process", strings.NewReader(procReq)))
-	if w.Code != http.StatusOK {
+	procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"hi"}]}],"session_id":"s-pin","user_id":"u-pin","channel":"console","stream":false}`
+	if w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq); w.Code != http.StatusOK {
 		t.Fatalf("process status=%d body=%s", w.Code, w.Body.String())
 	}
-	if !strings.Contains(w.Body.String(), "hello") {
-		t.Fatalf("expected shell output in reply body, got=%s", w.Body.String())
+	if got, _ := lastModel.Load().(string); got != "model-pinned" {
+		t.Fatalf("expected pinned model, got=%q", got)
 	}
-}
-
-func TestProcessAgentRejectsUnknownTool(t *testing.T) {
-	srv := newTestServer(t)
 
-	procReq := `{
-		"input":[{"role":"user","type":"message","content":[{"type":"text","text":"run desktop"}]}],
-		"session_id":"s-tool-unknown",
-		"user_id":"u-tool-unknown",
-		"channel":"console",
-		"stream":false,
-		"biz_params":{"tool":{"name":"desktop","input":{}}}
-	}`
-	w := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/agent/process", strings.NewReader(procReq)))
-	if w.Code != http.StatusBadRequest {
-		t.Fatalf("expected 400, got=%d body=%s", w.Code, w.Body.String())
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/active", `{"provider_id":"pin-llm","model":"model-b"}`); w.Code != http.StatusOK {
+		t.Fatalf("set active status=%d body=%s", w.Code, w.Body.String())
 	}
-	if !strings.Contains(w.Body.String(), `"code":"tool_not_supported"`) {
-		t.Fatalf("unexpected body: %s", w.Body.String())
+	if w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq); w.Code != http.StatusOK {
+		t.Fatalf("process status=%d body=%s", w.Code, w.Body.String())
+	}
+	if got, _ := lastModel.Load().(string); got != "model-pinned" {
+		t.Fatalf("expected pinned model after global change, got=%q", got)
 	}
-}
-
-func TestProcessAgentRejectsShellToolWhenDisabled(t *testing.T) {
-	t.Setenv("NEXTAI_DISABLED_TOOLS", "shell")
-	srv := newTestServer(t)
 
-	procReq := `{
-		"input":[{"role":"user","type":"message","content":[{"type":"text","text":"/shell pwd"}]}],
-		"session_id":"s-shell-disabled",
-		"user_id":"u-shell-disabled",
-		"channel":"console",
-		"stream":false,
-		"biz_params":{"tool":{"name":"shell","items":[{"command":"pwd"}]}}
-	}`
-	w := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/agent/process", strings.NewReader(procReq)))
-	if w.Code != http.StatusForbidden {
-		t.Fatalf("expected 403, got=%d body=%s", w.Code, w.Body.String())
+	otherReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"hi"}]}],"session_id":"s-unpinned","user_id":"u-pin","channel":"console","stream":false}`
+	if w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", otherReq); w.Code != http.StatusOK {
+		t.Fatalf("process status=%d body=%s", w.Code, w.Body.String())
 	}
-	if !strings.Contains(w.Body.String(), `"code":"tool_disabled"`) {
-		t.Fatalf("unexpected body: %s", w.Body.String())
+	if got, _ := lastModel.Load().(string); got != "model-b" {
+		t.Fatalf("expected the changed global model for an unpinned chat, got=%q", got)
 	}
-}
-
-func TestProcessAgentRejectsShellToolWithoutCommand(t *testing.T) {
-	srv := newTestServer(t)
 
-	procReq := `{
-		"input":[{"role":"user","type":"message","content":[{"type":"text","text":"/shell"}]}],
-		"session_id":"s-shell-empty",
-		"user_id":"u-shell-empty",
-		"channel":"console",
-		"stream":false,
-		"biz_params":{"tool":{"name":"shell","items":[{}]}}
-	}`
-	w := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/agent/process", strings.NewReader(procReq)))
-	if w.Code != http.StatusBadRequest {
-		t.Fatalf("expected 400, got=%d body=%s", w.Code, w.Body.String())
+	clearReq := `{"id":"chat-pin","name":"A","session_id":"s-pin","user_id":"u-pin","channel":"console","meta":{"active_llm_override":null}}`
+	if w := callJSONEndpoint(srv, http.MethodPut, "/chats/chat-pin", clearReq); w.Code != http.StatusOK {
+		t.Fatalf("clear pin status=%d body=%s", w.Code, w.Body.String())
 	}
-	if !strings.Contains(w.Body.String(), `"code":"invalid_tool_input"`) {
-		t.Fatalf("unexpected body: %s", w.Body.String())
+	if w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq); w.Code != http.StatusOK {
+		t.Fatalf("process status=%d body=%s", w.Code, w.Body.String())
+	}
+	if got, _ := lastModel.Load().(string); got != "model-b" {
+		t.Fatalf("expected the global model once the pin is cleared, got=%q", got)
 	}
 }
 
-func TestProcessAgentAcceptsBizParamsShellInputCommandForBackwardCompatibility(t *testing.T) {
-	srv := newTestServer(t)
+func TestProcessAgentTrimsHistoryToModelContextWindow(t *testing.T) {
+	var lastBody atomic.Value
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		lastBody.Store(string(body))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"chatcmpl-1","choices":[{"message":{"role":"assistant","content":"ok"}}]}`))
+	}))
+	defer mock.Close()
 
-	procReq := `{
-		"input":[{"role":"user","type":"message","content":[{"type":"text","text":"/shell compat"}]}],
-		"session_id":"s-shell-biz-compat",
-		"user_id":"u-shell-biz-compat",
-		"channel":"console",
-		"stream":false,
-		"biz_params":{"tool":{"name":"shell","input":{"command":"printf compat"}}}
-	}`
-	w := httptest.NewRecorder()
-	srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/agent/process", strings.NewReader(procReq)))
-	if w.Code != http.StatusOK {
-		t.Fatalf("expected 200, got=%d body=%s", w.Code, w.Body.String())
+	srv := newTestServer(t)
+	configBody := `{"enabled":true,"api_key":"sk-test","base_url":"` + mock.URL + `"}`
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/openai/config", configBody); w.Code != http.StatusOK {
+		t.Fatalf("configure provider status=%d body=%s", w.Code, w.Body.String())
 	}
-	if !strings.Contains(w.Body.String(), `"reply":"$ printf compat`) {
-		t.Fatalf("unexpected body: %s", w.Body.String())
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/active", `{"provider_id":"openai","model":"gpt-4o-mini"}`); w.Code != http.StatusOK {
+		t.Fatalf("set active status=%d body=%s", w.Code, w.Body.String())
 	}
-}
-
-func TestPrependSystemLayersPreservesOrder(t *testing.T) {
-	input := []domain.AgentInputMessage{
-		{
-			Role: "user",
-			Type: "message",
-			Content: []domain.RuntimeContent{
-				{Type: "text", Text: "hello"},
-			},
-		},
+	createReq := `{"id":"chat-budget","name":"A","session_id":"s-budget","user_id":"u-budget","channel":"console","meta":{}}`
+	if w := callJSONEndpoint(srv, http.MethodPost, "/chats", createReq); w.Code != http.StatusOK {
+		t.Fatalf("create status=%d body=%s", w.Code, w.Body.String())
 	}
-
-	layers := []systemPromptLayer{
-		{Name: "base_system", Role: "system", Content: "base"},
-		{Name: "tool_guide_system", Role: "system", Content: "tool"},
-		{Name: "workspace_policy_system", Role: "system", Content: ""},
-		{Name: "session_policy_system", Role: "system", Content: "session"},
+	if err := srv.store.Write(func(state *repo.State) error {
+		state.Histories["chat-budget"] = []domain.RuntimeMessage{
+			{ID: "msg-old", Role: "user", Type: "message", Content: []domain.RuntimeContent{{Type: "text", Text: "OLDMARKER " + strings.Repeat("lorem ipsum ", 400)}}},
+			{ID: "msg-old-reply", Role: "assistant", Type: "message", Content: []domain.RuntimeContent{{Type: "text", Text: "noted"}}},
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("seed history failed: %v", err)
 	}
 
-	out := prependSystemLayers(input, layers)
-	if len(out) != 4 {
-		t.Fatalf("expected 4 messages, got=%d", len(out))
+	procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"latest question"}]}],"session_id":"s-budget","user_id":"u-budget","channel":"console","stream":false}`
+	if w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq); w.Code != http.StatusOK {
+		t.Fatalf("process status=%d body=%s", w.Code, w.Body.String())
 	}
-	if got := out[0].Content[0].Text; got != "base" {
-		t.Fatalf("first layer mismatch: %q", got)
+	if body, _ := lastBody.Load().(string); !strings.Contains(body, "OLDMARKER") {
+		t.Fatalf("expected old history within the builtin 128k window, body=%s", body)
 	}
-	if got := out[1].Content[0].Text; got != "tool" {
-		t.Fatalf("second layer mismatch: %q", got)
+
+	windowBody := `{"model_context_windows":{"gpt-4o-mini":400}}`
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/openai/config", windowBody); w.Code != http.StatusOK {
+		t.Fatalf("configure context window status=%d body=%s", w.Code, w.Body.String())
 	}
-	if got := out[2].Content[0].Text; got != "session" {
-		t.Fatalf("third layer mismatch: %q", got)
+	if w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq); w.Code != http.StatusOK {
+		t.Fatalf("process status=%d body=%s", w.Code, w.Body.String())
 	}
-	if got := out[3].Role; got != "user" {
-		t.Fatalf("last message should be user, got=%q", got)
+	body, _ := lastBody.Load().(string)
+	if strings.Contains(body, "OLDMARKER") {
+		t.Fatalf("expected old history to be trimmed for a 400-token window, body=%s", body)
+	}
+	if !strings.Contains(body, "latest question") {
+		t.Fatalf("expected latest message to be kept, body=%s", body)
 	}
 }
 
-func TestBuildSystemLayersOrder(t *testing.T) {
-	srv := newTestServer(t)
+func TestProcessAgentAppendsSearchCitations(t *testing.T) {
+	var calls int32
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if atomic.AddInt32(&calls, 1) == 1 {
+			_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"","tool_calls":[{"id":"call_1","type":"function","function":{"name":"search","arguments":"{\"query\":\"golang\"}"}}]}}]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"Go is a language."}}]}`))
+	}))
+	defer mock.Close()
 
-	layers, err := srv.buildSystemLayers()
-	if err != nil {
-		t.Fatalf("buildSystemLayers failed: %v", err)
+	srv := newTestServer(t)
+	srv.cfg.AppendCitations = true
+	srv.registerToolPlugin(&stubToolPlugin{
+		name: "search",
+		invoke: func(input map[string]interface{}) (map[string]interface{}, error) {
+			return map[string]interface{}{
+				"text": "found 2 results",
+				"results": []interface{}{
+					map[string]interface{}{"title": "The Go Programming Language", "url": "https://go.dev"},
+					map[string]interface{}{"title": "Duplicate", "url": "https://go.dev"},
+					map[string]interface{}{"url": "https://pkg.go.dev"},
+				},
+			}, nil
+		},
+	})
+	configBody := `{"enabled":true,"api_key":"sk-test","base_url":"` + mock.URL + `"}`
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/openai/config", configBody); w.Code != http.StatusOK {
+		t.Fatalf("configure provider status=%d body=%s", w.Code, w.Body.String())
 	}
-	if len(layers) < 2 {
-		t.Fatalf("expected at least 2 layers, got=%d", len(layers))
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/active", `{"provider_id":"openai","model":"gpt-4o-mini"}`); w.Code != http.StatusOK {
+		t.Fatalf("set active status=%d body=%s", w.Code, w.Body.String())
 	}
-	if layers[0].Name != "base_system" {
-		t.Fatalf("first layer should be base_system, got=%q", layers[0].Name)
+
+	procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"what is go"}]}],"session_id":"s-cite","user_id":"u-cite","channel":"console","stream":false}`
+	w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq)
+	if w.Code != http.StatusOK {
+		t.Fatalf("process status=%d body=%s", w.Code, w.Body.String())
 	}
-	if layers[1].Name != "tool_guide_system" {
-		t.Fatalf("second layer should be tool_guide_system, got=%q", layers[1].Name)
+	var resp domain.AgentProcessResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response failed: %v", err)
 	}
-}
-
-func TestBuildSystemLayersForCodexModeFallsBackToDefaultLayers(t *testing.T) {
-	srv := newTestServer(t)
-
-	layers, err := srv.buildSystemLayersForMode(promptModeCodex)
-	if err != nil {
-		t.Fatalf("expected fallback to default layers, got err=%v", err)
+	want := []domain.Citation{
+		{Title: "The Go Programming Language", URL: "https://go.dev"},
+		{URL: "https://pkg.go.dev"},
 	}
-	if len(layers) < 2 {
-		t.Fatalf("expected default layers, got=%#v", layers)
+	if !reflect.DeepEqual(resp.Citations, want) {
+		t.Fatalf("unexpected citations: %+v", resp.Citations)
 	}
-	if layers[0].Name != "base_system" || layers[1].Name != "tool_guide_system" {
-		t.Fatalf("expected fallback default layer order, got=%#v", layers)
+	wantReply := "Go is a language.\n\nSources:\n1. The Go Programming Language - https://go.dev\n2. https://pkg.go.dev"
+	if resp.Reply != wantReply {
+		t.Fatalf("unexpected reply: %q", resp.Reply)
 	}
 }
 
-func TestBuildSystemLayersForLegacyOptionsCodexModeFallsBackToDefaultLayers(t *testing.T) {
+func TestProcessAgentTimeoutStreamsErrorAndPersistsPartial(t *testing.T) {
+	var calls int32
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/chat/completions" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if atomic.AddInt32(&calls, 1) > 1 {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = fmt.Fprint(w, `data: {"choices":[{"delta":{"content":"checking 1","tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"view","arguments":"{\"path\":\"missing.txt\",\"start\":1,\"end\":1}"}}]}}]}`+"\n\n")
+		_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer mock.Close()
+
 	srv := newTestServer(t)
+	srv.cfg.AgentTimeoutMS = 200
+	configBody := `{"enabled":true,"api_key":"sk-test","base_url":"` + mock.URL + `"}`
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/openai/config", configBody); w.Code != http.StatusOK {
+		t.Fatalf("configure provider status=%d body=%s", w.Code, w.Body.String())
+	}
+	if w := callJSONEndpoint(srv, http.MethodPut, "/models/active", `{"provider_id":"openai","model":"gpt-4o-mini"}`); w.Code != http.StatusOK {
+		t.Fatalf("set active status=%d body=%s", w.Code, w.Body.String())
+	}
 
-	layers, err := srv.buildSystemLayersForLegacyOptions(promptModeCodex, codexLayerBuildOptions{
-		SessionID: "s-legacy-codex-mode",
-	})
-	if err != nil {
-		t.Fatalf("expected fallback to default layers, got err=%v", err)
+	procReq := `{"input":[{"role":"user","type":"message","content":[{"type":"text","text":"slow please"}]}],"session_id":"s-timeout","user_id":"u-timeout","channel":"console","stream":true}`
+	w := callJSONEndpoint(srv, http.MethodPost, "/agent/process", procReq)
+	body := w.Body.String()
+	if !strings.Contains(body, `"code":"agent_timeout"`) {
+		t.Fatalf("expected agent_timeout error event, body=%s", body)
 	}
-	if len(layers) < 2 {
-		t.Fatalf("expected default layers, got=%#v", layers)
+	if !strings.HasSuffix(strings.TrimSpace(body), "data: [DONE]") {
+		t.Fatalf("stream should end with [DONE], body=%s", body)
 	}
-	if layers[0].Name != "base_system" || layers[1].Name != "tool_guide_system" {
-		t.Fatalf("expected fallback default layer order, got=%#v", layers)
+
+	var history []domain.RuntimeMessage
+	srv.store.Read(func(state *repo.State) {
+		for id, chat := range state.Chats {
+			if chat.SessionID == "s-timeout" {
+				history = state.Histories[id]
+			}
+		}
+	})
+	if len(history) != 2 || history[1].Role != "assistant" || !strings.Contains(history[1].Content[0].Text, "checking 1") {
+		t.Fatalf("expected partial assistant message in history, got=%#v", history)
 	}
 }
@@ -84,6 +84,42 @@ func buildToolDefinition(name string) runner.ToolDefinition {
 				"additionalProperties": false,
 			},
 		}
+	case "write":
+		return runner.ToolDefinition{
+			Name:        "write",
+			Description: "Create files or replace their whole content; use edit to change line ranges. input must be an array.",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"items": map[string]interface{}{
+						"type":        "array",
+						"description": "Array of write operations; pass one item for single-file write.",
+						"minItems":    1,
+						"items": map[string]interface{}{
+							"type": "object",
+							"properties": map[string]interface{}{
+								"path": map[string]interface{}{
+									"type":        "string",
+									"description": "Absolute file path on local filesystem; missing parent directories are created.",
+								},
+								"content": map[string]interface{}{
+									"type":        "string",
+									"description": "Full file content to write.",
+								},
+								"create_only": map[string]interface{}{
+									"type":        "boolean",
+									"description": "Fail instead of overwriting when the file already exists.",
+								},
+							},
+							"required":             []string{"path", "content"},
+							"additionalProperties": false,
+						},
+					},
+				},
+				"required":             []string{"items"},
+				"additionalProperties": false,
+			},
+		}
 	case "shell":
 		return runner.ToolDefinition{
 			Name:        "shell",
@@ -108,11 +144,25 @@ func buildToolDefinition(name string) runner.ToolDefinition {
 									"type":    "integer",
 									"minimum": 1,
 								},
+								"max_output_bytes": map[string]interface{}{
+									"type":        "integer",
+									"minimum":     1,
+									"description": "Cap this item's output; longer output is truncated with a marker.",
+								},
+								"tail": map[string]interface{}{
+									"type":        "boolean",
+									"description": "Keep the last max_output_bytes instead of the first when truncating.",
+								},
 							},
 							"required":             []string{"command"},
 							"additionalProperties": false,
 						},
 					},
+					"session_mode": map[string]interface{}{
+						"type":        "string",
+						"enum":        []string{"fresh", "persistent"},
+						"description": "fresh (default) runs each item in a new shell; persistent runs all items in one shell so variables and cwd carry over.",
+					},
 				},
 				"required": []string{"items"},
 			},
@@ -154,6 +204,15 @@ func buildToolDefinition(name string) runner.ToolDefinition {
 						"minimum":     1,
 						"description": "Optional output budget hint.",
 					},
+					"max_output_bytes": map[string]interface{}{
+						"type":        "integer",
+						"minimum":     1,
+						"description": "Cap returned output; longer output is truncated with a marker.",
+					},
+					"tail": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Keep the last max_output_bytes instead of the first when truncating.",
+					},
 					"sandbox_permissions": map[string]interface{}{
 						"type":        "string",
 						"description": "Optional sandbox permission request.",
@@ -200,6 +259,15 @@ func buildToolDefinition(name string) runner.ToolDefinition {
 						"minimum":     1,
 						"description": "Optional output budget hint.",
 					},
+					"max_output_bytes": map[string]interface{}{
+						"type":        "integer",
+						"minimum":     1,
+						"description": "Cap returned output; longer output is truncated with a marker.",
+					},
+					"tail": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Keep the last max_output_bytes instead of the first when truncating.",
+					},
 				},
 				"required":             []string{"session_id"},
 				"additionalProperties": true,
@@ -208,7 +276,7 @@ func buildToolDefinition(name string) runner.ToolDefinition {
 	case "browser":
 		return runner.ToolDefinition{
 			Name:        "browser",
-			Description: "Delegate browser tasks to local Playwright agent script. input must be an array.",
+			Description: "Delegate browser tasks to local Playwright agent script. input must be an array. Results may include screenshot_path (and screenshot_base64 for small images) for the last screenshot taken; the screenshot is shown to the user, so describe what it shows instead of repeating the path.",
 			Parameters: map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
@@ -257,7 +325,7 @@ func buildToolDefinition(name string) runner.ToolDefinition {
 								},
 								"provider": map[string]interface{}{
 									"type":        "string",
-									"description": "Optional provider override: serpapi | tavily | brave.",
+									"description": "Optional provider override: serpapi | tavily | brave | duckduckgo.",
 								},
 								"count": map[string]interface{}{
 									"type":        "integer",
@@ -354,6 +422,44 @@ func buildToolDefinition(name string) runner.ToolDefinition {
 				"additionalProperties": false,
 			},
 		}
+	case "list_dir":
+		return runner.ToolDefinition{
+			Name:        "list_dir",
+			Description: "List directory entries (name, is_dir, size) for one or multiple local directories. input must be an array.",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"items": map[string]interface{}{
+						"type":        "array",
+						"description": "Array of list operations; pass one item for a single directory.",
+						"minItems":    1,
+						"items": map[string]interface{}{
+							"type": "object",
+							"properties": map[string]interface{}{
+								"path": map[string]interface{}{
+									"type":        "string",
+									"description": "Absolute directory path on local filesystem.",
+								},
+								"depth": map[string]interface{}{
+									"type":        "integer",
+									"minimum":     1,
+									"maximum":     5,
+									"description": "Recursion depth; 1 (default) lists only direct children.",
+								},
+								"glob": map[string]interface{}{
+									"type":        "string",
+									"description": "Optional glob filter, e.g. *.go; matched against the relative path when it contains /.",
+								},
+							},
+							"required":             []string{"path"},
+							"additionalProperties": false,
+						},
+					},
+				},
+				"required":             []string{"items"},
+				"additionalProperties": false,
+			},
+		}
 	case "click":
 		return runner.ToolDefinition{
 			Name:        "click",
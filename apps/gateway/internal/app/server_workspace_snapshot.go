@@ -0,0 +1,67 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// includeWorkspaceDocs reports whether an export bundles the docs/AI files.
+// Downloads are full snapshots by default; `include_docs` overrides either way.
+func includeWorkspaceDocs(r *http.Request, download bool) bool {
+	raw := strings.TrimSpace(r.URL.Query().Get("include_docs"))
+	if raw == "" {
+		return download
+	}
+	return parseBool(raw)
+}
+
+func workspaceExportFileName(now time.Time) string {
+	return "nextai-workspace-" + now.UTC().Format("20060102T150405Z") + ".json"
+}
+
+// collectWorkspaceDocsAIContents reads every docs/AI text file, skipping ones
+// that cannot be read rather than failing the whole export.
+func collectWorkspaceDocsAIContents() map[string]string {
+	entries := collectWorkspaceDocsAIFileEntries()
+	if len(entries) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		normalized, content, err := readWorkspaceTextFileRawForPath(entry.Path)
+		if err != nil {
+			continue
+		}
+		out[normalized] = content
+	}
+	return out
+}
+
+func validateWorkspaceImportDocs(docs map[string]string) error {
+	for rawPath := range docs {
+		normalized, ok := normalizeAIToolsGuideRelativePath(rawPath)
+		if !ok || !isWorkspaceDocsAIFilePath(normalized) {
+			return fmt.Errorf("doc path %q must be under %s/", rawPath, workspaceDocsAIDir)
+		}
+	}
+	return nil
+}
+
+// restoreWorkspaceDocs writes bundled docs/AI files back after the settings
+// import succeeded. Files not in the bundle are left untouched.
+func restoreWorkspaceDocs(docs map[string]string) error {
+	paths := make([]string, 0, len(docs))
+	for rawPath := range docs {
+		paths = append(paths, rawPath)
+	}
+	sort.Strings(paths)
+	for _, rawPath := range paths {
+		if err := writeWorkspaceTextFileRawForPath(rawPath, docs[rawPath]); err != nil {
+			return fmt.Errorf("restore %s: %w", rawPath, err)
+		}
+	}
+	return nil
+}
@@ -43,10 +43,12 @@ func legacyToolCapabilityByName(name string, capability string) bool {
 		return capability == "execute"
 	case "view":
 		return capability == "read" || capability == "open_local"
-	case "edit":
+	case "edit", "write":
 		return capability == "write"
 	case "find":
 		return capability == "read" || capability == "file_search"
+	case "list_dir":
+		return capability == "read"
 	case "search":
 		return capability == "network" || capability == "web_search"
 	case "browser":
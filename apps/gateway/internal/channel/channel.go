@@ -4,6 +4,8 @@ import (
 	"context"
 	"log"
 	"unicode/utf8"
+
+	"nextai/apps/gateway/internal/plugin"
 )
 
 type ConsoleChannel struct{}
@@ -16,6 +18,10 @@ func (c *ConsoleChannel) Name() string {
 	return "console"
 }
 
+func (c *ConsoleChannel) Capabilities() plugin.ChannelCapabilities {
+	return plugin.ChannelCapabilities{}
+}
+
 func (c *ConsoleChannel) SendText(_ context.Context, _ string, _ string, text string, _ map[string]interface{}) error {
 	log.Printf("[console] outbound message delivered chars=%d", utf8.RuneCountInString(text))
 	return nil
@@ -0,0 +1,46 @@
+package channel
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// messageBreaks lists split points from most to least preferred.
+var messageBreaks = []string{"\n\n", "\n", " "}
+
+// SplitMessage splits text into chunks of at most limit runes for channels that
+// reject long messages. Each chunk ends at the last paragraph, line or word
+// boundary that fits and falls back to a hard cut when none does. A limit <= 0
+// or a short text returns text as the only chunk.
+func SplitMessage(text string, limit int) []string {
+	if limit <= 0 || utf8.RuneCountInString(text) <= limit {
+		return []string{text}
+	}
+	out := make([]string, 0, 2)
+	rest := []rune(text)
+	for len(rest) > limit {
+		cut, skip := messageSplitPoint(rest, limit)
+		if chunk := strings.TrimRight(string(rest[:cut]), " \n"); chunk != "" {
+			out = append(out, chunk)
+		}
+		rest = []rune(strings.TrimLeft(string(rest[cut+skip:]), " \n"))
+	}
+	if len(rest) > 0 {
+		out = append(out, string(rest))
+	}
+	return out
+}
+
+// messageSplitPoint returns where to cut runes so the chunk fits in limit and
+// how many separator runes to drop after the cut.
+func messageSplitPoint(runes []rune, limit int) (int, int) {
+	window := string(runes[:limit+1])
+	for _, sep := range messageBreaks {
+		idx := strings.LastIndex(window, sep)
+		if idx <= 0 {
+			continue
+		}
+		return utf8.RuneCountInString(window[:idx]), utf8.RuneCountInString(sep)
+	}
+	return limit, 0
+}
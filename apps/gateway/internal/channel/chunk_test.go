@@ -0,0 +1,44 @@
+package channel
+
+import (
+	"reflect"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitMessagePrefersParagraphBoundaries(t *testing.T) {
+	text := "first paragraph\n\nsecond paragraph\nwith two lines"
+	got := SplitMessage(text, 34)
+	want := []string{"first paragraph", "second paragraph\nwith two lines"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected chunks: %#v", got)
+	}
+}
+
+func TestSplitMessageFallsBackToLinesWordsAndHardCuts(t *testing.T) {
+	got := SplitMessage("alpha beta\ngamma delta", 12)
+	want := []string{"alpha beta", "gamma delta"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected line chunks: %#v", got)
+	}
+
+	got = SplitMessage("你好世界你好世界你好", 4)
+	want = []string{"你好世界", "你好世界", "你好"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected hard-cut chunks: %#v", got)
+	}
+	for _, chunk := range got {
+		if utf8.RuneCountInString(chunk) > 4 {
+			t.Fatalf("chunk exceeds limit: %q", chunk)
+		}
+	}
+}
+
+func TestSplitMessageKeepsShortText(t *testing.T) {
+	if got := SplitMessage("short", 0); !reflect.DeepEqual(got, []string{"short"}) {
+		t.Fatalf("unexpected chunks without limit: %#v", got)
+	}
+	if got := SplitMessage("short", 10); !reflect.DeepEqual(got, []string{"short"}) {
+		t.Fatalf("unexpected chunks under limit: %#v", got)
+	}
+}
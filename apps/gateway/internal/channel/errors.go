@@ -0,0 +1,33 @@
+package channel
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// StatusError reports a non-2xx response from a channel endpoint.
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	return e.Message
+}
+
+func statusErrorf(statusCode int, format string, args ...interface{}) error {
+	return &StatusError{StatusCode: statusCode, Message: fmt.Sprintf(format, args...)}
+}
+
+// IsRetryable reports whether a SendText failure is worth another attempt:
+// network errors, 429 and 5xx responses. Config and payload errors are not.
+func IsRetryable(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= http.StatusInternalServerError
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
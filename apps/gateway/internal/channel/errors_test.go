@@ -0,0 +1,37 @@
+package channel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestIsRetryable(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "server error", err: statusErrorf(http.StatusBadGateway, "webhook returned status 502"), want: true},
+		{name: "rate limited", err: statusErrorf(http.StatusTooManyRequests, "qq api returned status 429"), want: true},
+		{name: "client error", err: statusErrorf(http.StatusBadRequest, "webhook returned status 400"), want: false},
+		{name: "config error", err: errors.New("channel webhook requires config.url"), want: false},
+	}
+	for _, tc := range cases {
+		if got := IsRetryable(tc.err); got != tc.want {
+			t.Fatalf("%s: IsRetryable=%v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	err := NewWebhookChannel().SendText(context.Background(), "u1", "s1", "hi", map[string]interface{}{"url": "http://127.0.0.1:1"})
+	if err == nil || !IsRetryable(err) {
+		t.Fatalf("expected network failure to be retryable, got=%v", err)
+	}
+	if IsRetryable(fmt.Errorf("wrapped: %w", statusErrorf(http.StatusNotFound, "not found"))) {
+		t.Fatal("expected wrapped 404 to be non-retryable")
+	}
+}
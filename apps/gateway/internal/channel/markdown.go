@@ -0,0 +1,101 @@
+package channel
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	markdownHeadingPattern      = regexp.MustCompile(`^\s{0,3}#{1,6}\s+(.*?)\s*#*\s*$`)
+	markdownBlockquotePattern   = regexp.MustCompile(`^\s{0,3}>\s?`)
+	markdownRulePattern         = regexp.MustCompile(`^\s{0,3}(?:(?:-\s*){3,}|(?:\*\s*){3,}|(?:_\s*){3,})$`)
+	markdownBulletPattern       = regexp.MustCompile(`^(\s*)[-*+]\s+(\[[ xX]\]\s+)?`)
+	markdownOrderedPattern      = regexp.MustCompile(`^(\s*)(\d+)[.)]\s+`)
+	markdownImagePattern        = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	markdownLinkPattern         = regexp.MustCompile(`\[([^\]]+)\]\([^)]*\)`)
+	markdownRefLinkPattern      = regexp.MustCompile(`\[([^\]]+)\]\[[^\]]*\]`)
+	markdownAutoLinkPattern     = regexp.MustCompile(`<((?:https?|mailto):[^>\s]+)>`)
+	markdownStrongPattern       = regexp.MustCompile(`(\*\*|__)(\S(?:.*?\S)?)(\*\*|__)`)
+	markdownStrikePattern       = regexp.MustCompile(`~~(\S(?:.*?\S)?)~~`)
+	markdownStarEmPattern       = regexp.MustCompile(`\*(\S(?:[^*]*?\S)?)\*`)
+	markdownUnderscoreEmPattern = regexp.MustCompile(`(^|[^\w])_(\S(?:[^_]*?\S)?)_([^\w]|$)`)
+	markdownEscapePattern       = regexp.MustCompile(`\\([\\` + "`" + `*_{}\[\]()#+\-.!>~|])`)
+)
+
+// StripMarkdown converts common markdown to readable plain text for channels
+// that cannot render it. Code fence content and link text are kept; markup,
+// heading markers and link targets are dropped.
+func StripMarkdown(s string) string {
+	if strings.TrimSpace(s) == "" {
+		return s
+	}
+	lines := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	out := make([]string, 0, len(lines))
+	fence := ""
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+				fence = ""
+				continue
+			}
+			out = append(out, line)
+			continue
+		}
+		if marker := markdownFenceMarker(trimmed); marker != "" {
+			fence = marker
+			continue
+		}
+		if markdownRulePattern.MatchString(line) {
+			continue
+		}
+		for markdownBlockquotePattern.MatchString(line) {
+			line = markdownBlockquotePattern.ReplaceAllString(line, "")
+		}
+		if match := markdownHeadingPattern.FindStringSubmatch(line); match != nil {
+			line = match[1]
+		} else if markdownBulletPattern.MatchString(line) {
+			line = markdownBulletPattern.ReplaceAllString(line, "$1- ")
+		} else if markdownOrderedPattern.MatchString(line) {
+			line = markdownOrderedPattern.ReplaceAllString(line, "$1$2. ")
+		}
+		out = append(out, stripInlineMarkdown(line))
+	}
+	return strings.TrimRight(strings.Join(out, "\n"), "\n")
+}
+
+func markdownFenceMarker(trimmed string) string {
+	for _, marker := range []string{"```", "~~~"} {
+		if strings.HasPrefix(trimmed, marker) {
+			return marker
+		}
+	}
+	return ""
+}
+
+// stripInlineMarkdown removes inline markup while leaving code spans verbatim.
+func stripInlineMarkdown(line string) string {
+	parts := strings.Split(line, "`")
+	if len(parts)%2 == 0 {
+		// Unbalanced backtick: treat it as a literal character.
+		parts = []string{line}
+	}
+	var b strings.Builder
+	for i, part := range parts {
+		if i%2 == 1 {
+			b.WriteString(part)
+			continue
+		}
+		part = markdownImagePattern.ReplaceAllString(part, "$1")
+		part = markdownLinkPattern.ReplaceAllString(part, "$1")
+		part = markdownRefLinkPattern.ReplaceAllString(part, "$1")
+		part = markdownAutoLinkPattern.ReplaceAllString(part, "$1")
+		part = markdownStrongPattern.ReplaceAllString(part, "$2")
+		part = markdownStrikePattern.ReplaceAllString(part, "$1")
+		part = markdownStarEmPattern.ReplaceAllString(part, "$1")
+		part = markdownUnderscoreEmPattern.ReplaceAllString(part, "$1$2$3")
+		part = markdownEscapePattern.ReplaceAllString(part, "$1")
+		b.WriteString(part)
+	}
+	return b.String()
+}
@@ -0,0 +1,35 @@
+package channel
+
+import "testing"
+
+func TestStripMarkdownHeadingsAndEmphasis(t *testing.T) {
+	in := "# Title\n\n## Sub heading ##\nSome **bold**, *italic*, __strong__ and ~~gone~~ text with snake_case_name."
+	want := "Title\n\nSub heading\nSome bold, italic, strong and gone text with snake_case_name."
+	if got := StripMarkdown(in); got != want {
+		t.Fatalf("unexpected output:\n got=%q\nwant=%q", got, want)
+	}
+}
+
+func TestStripMarkdownLinksKeepText(t *testing.T) {
+	in := "See [the docs](https://example.com/docs) and ![diagram](img.png) or <https://example.com>."
+	want := "See the docs and diagram or https://example.com."
+	if got := StripMarkdown(in); got != want {
+		t.Fatalf("unexpected output:\n got=%q\nwant=%q", got, want)
+	}
+}
+
+func TestStripMarkdownCodeFencesKeepContent(t *testing.T) {
+	in := "Run this:\n```bash\necho **not bold**\n# not a heading\n```\nthen `go test ./...` done."
+	want := "Run this:\necho **not bold**\n# not a heading\nthen go test ./... done."
+	if got := StripMarkdown(in); got != want {
+		t.Fatalf("unexpected output:\n got=%q\nwant=%q", got, want)
+	}
+}
+
+func TestStripMarkdownListsAndQuotes(t *testing.T) {
+	in := "* first\n+ [x] done\n  - nested\n1) one\n> quoted *text*\n---"
+	want := "- first\n- done\n  - nested\n1. one\nquoted text"
+	if got := StripMarkdown(in); got != want {
+		t.Fatalf("unexpected output:\n got=%q\nwant=%q", got, want)
+	}
+}
@@ -11,6 +11,8 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"nextai/apps/gateway/internal/plugin"
 )
 
 const (
@@ -21,6 +23,9 @@ const (
 	qqTokenRefreshAhead = 5 * time.Minute
 	qqMessageSeqLimit   = 1000
 	qqMessageSeqTrimTo  = 500
+	// qqInputNotifySeconds is how long QQ shows the typing hint unless a
+	// message arrives first.
+	qqInputNotifySeconds = 60
 )
 
 type QQChannel struct {
@@ -41,14 +46,20 @@ func (c *QQChannel) Name() string {
 	return "qq"
 }
 
-func (c *QQChannel) SendText(ctx context.Context, userID, _ string, text string, cfg map[string]interface{}) error {
-	appID := strings.TrimSpace(toString(cfg["app_id"]))
-	if appID == "" {
-		return fmt.Errorf("channel qq requires config.app_id")
+// Capabilities reports the c2c input notify and passive replies threaded to
+// the inbound msg_id. Replies are sent as plain text messages only, so QQ does
+// not claim media.
+func (c *QQChannel) Capabilities() plugin.ChannelCapabilities {
+	return plugin.ChannelCapabilities{
+		Typing:         true,
+		ReplyThreading: true,
 	}
-	clientSecret := strings.TrimSpace(toString(cfg["client_secret"]))
-	if clientSecret == "" {
-		return fmt.Errorf("channel qq requires config.client_secret")
+}
+
+func (c *QQChannel) SendText(ctx context.Context, userID, _ string, text string, cfg map[string]interface{}) error {
+	appID, clientSecret, err := qqCredentials(cfg)
+	if err != nil {
+		return err
 	}
 
 	content := strings.TrimSpace(text)
@@ -72,11 +83,7 @@ func (c *QQChannel) SendText(ctx context.Context, userID, _ string, text string,
 	requestCtx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	tokenURL := strings.TrimSpace(toString(cfg["token_url"]))
-	if tokenURL == "" {
-		tokenURL = defaultQQTokenURL
-	}
-	token, err := c.getAccessToken(requestCtx, appID, clientSecret, tokenURL)
+	token, err := c.getAccessToken(requestCtx, appID, clientSecret, qqTokenURL(cfg))
 	if err != nil {
 		return err
 	}
@@ -103,15 +110,79 @@ func (c *QQChannel) SendText(ctx context.Context, userID, _ string, text string,
 		path = "/v2/users/" + targetID + "/messages"
 	}
 
-	baseURL := strings.TrimRight(strings.TrimSpace(toString(cfg["api_base"])), "/")
-	if baseURL == "" {
-		baseURL = defaultQQAPIBase
+	if err := sendQQAPIRequest(requestCtx, token, qqAPIBase(cfg)+path, body); err != nil {
+		return err
+	}
+	return nil
+}
+
+// SendTyping sends a QQ input notify so a c2c user sees the bot typing. QQ
+// only supports it as a passive reply in c2c chats, so other targets and
+// requests without msg_id are skipped.
+func (c *QQChannel) SendTyping(ctx context.Context, userID, _ string, cfg map[string]interface{}) error {
+	if normalizeQQTargetType(cfg["target_type"]) != "c2c" {
+		return nil
+	}
+	msgID := strings.TrimSpace(toString(cfg["msg_id"]))
+	if msgID == "" {
+		return nil
+	}
+	targetID := strings.TrimSpace(toString(cfg["target_id"]))
+	if targetID == "" {
+		targetID = strings.TrimSpace(userID)
+	}
+	if targetID == "" {
+		return nil
+	}
+	appID, clientSecret, err := qqCredentials(cfg)
+	if err != nil {
+		return err
 	}
 
-	if err := sendQQAPIRequest(requestCtx, token, baseURL+path, body); err != nil {
+	timeout := toDurationSeconds(cfg["timeout_seconds"], defaultQQTimeout)
+	requestCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	token, err := c.getAccessToken(requestCtx, appID, clientSecret, qqTokenURL(cfg))
+	if err != nil {
 		return err
 	}
-	return nil
+	body := map[string]interface{}{
+		"msg_type": 6,
+		"msg_id":   msgID,
+		"msg_seq":  c.nextMessageSeq("c2c", targetID, msgID),
+		"input_notify": map[string]interface{}{
+			"input_type":   1,
+			"input_second": qqInputNotifySeconds,
+		},
+	}
+	return sendQQAPIRequest(requestCtx, token, qqAPIBase(cfg)+"/v2/users/"+targetID+"/messages", body)
+}
+
+func qqCredentials(cfg map[string]interface{}) (string, string, error) {
+	appID := strings.TrimSpace(toString(cfg["app_id"]))
+	if appID == "" {
+		return "", "", fmt.Errorf("channel qq requires config.app_id")
+	}
+	clientSecret := strings.TrimSpace(toString(cfg["client_secret"]))
+	if clientSecret == "" {
+		return "", "", fmt.Errorf("channel qq requires config.client_secret")
+	}
+	return appID, clientSecret, nil
+}
+
+func qqTokenURL(cfg map[string]interface{}) string {
+	if tokenURL := strings.TrimSpace(toString(cfg["token_url"])); tokenURL != "" {
+		return tokenURL
+	}
+	return defaultQQTokenURL
+}
+
+func qqAPIBase(cfg map[string]interface{}) string {
+	if baseURL := strings.TrimRight(strings.TrimSpace(toString(cfg["api_base"])), "/"); baseURL != "" {
+		return baseURL
+	}
+	return defaultQQAPIBase
 }
 
 func normalizeQQTargetType(raw interface{}) string {
@@ -187,7 +258,7 @@ func (c *QQChannel) getAccessToken(ctx context.Context, appID, clientSecret, tok
 		return "", fmt.Errorf("read qq token response failed: %w", err)
 	}
 	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
-		return "", fmt.Errorf("qq token endpoint returned status %d", resp.StatusCode)
+		return "", statusErrorf(resp.StatusCode, "qq token endpoint returned status %d", resp.StatusCode)
 	}
 
 	var payload map[string]interface{}
@@ -259,7 +330,7 @@ func sendQQAPIRequest(ctx context.Context, accessToken, endpoint string, payload
 	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
 	bodyText := strings.TrimSpace(string(respBody))
 	if bodyText == "" {
-		return fmt.Errorf("qq api returned status %d", resp.StatusCode)
+		return statusErrorf(resp.StatusCode, "qq api returned status %d", resp.StatusCode)
 	}
-	return fmt.Errorf("qq api returned status %d: %s", resp.StatusCode, bodyText)
+	return statusErrorf(resp.StatusCode, "qq api returned status %d: %s", resp.StatusCode, bodyText)
 }
@@ -110,3 +110,55 @@ func TestQQChannelCachesTokenAcrossCalls(t *testing.T) {
 		t.Fatalf("expected two message calls, got=%d", got)
 	}
 }
+
+func TestQQChannelSendTypingC2COnly(t *testing.T) {
+	var messageCalls atomic.Int32
+	var messageBody map[string]interface{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"access_token":"qq-token","expires_in":7200}`))
+		case "/v2/users/u-1/messages":
+			messageCalls.Add(1)
+			defer r.Body.Close()
+			if err := json.NewDecoder(r.Body).Decode(&messageBody); err != nil {
+				t.Errorf("decode message body failed: %v", err)
+			}
+			w.WriteHeader(http.StatusOK)
+		default:
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	channel := NewQQChannel()
+	cfg := map[string]interface{}{
+		"app_id":        "app-1",
+		"client_secret": "secret-1",
+		"token_url":     server.URL + "/token",
+		"api_base":      server.URL,
+		"target_type":   "c2c",
+		"msg_id":        "msg-1",
+	}
+	if err := channel.SendTyping(context.Background(), "u-1", "s-1", cfg); err != nil {
+		t.Fatalf("send typing failed: %v", err)
+	}
+	if got := messageCalls.Load(); got != 1 {
+		t.Fatalf("expected one input notify call, got=%d", got)
+	}
+	notify, _ := messageBody["input_notify"].(map[string]interface{})
+	if messageBody["msg_type"] != float64(6) || messageBody["msg_id"] != "msg-1" || notify["input_type"] != float64(1) {
+		t.Fatalf("unexpected input notify body: %#v", messageBody)
+	}
+
+	cfg["target_type"] = "group"
+	cfg["target_id"] = "g-1"
+	if err := channel.SendTyping(context.Background(), "u-1", "s-1", cfg); err != nil {
+		t.Fatalf("send typing to group failed: %v", err)
+	}
+	if got := messageCalls.Load(); got != 1 {
+		t.Fatalf("expected group typing to be skipped, got=%d calls", got)
+	}
+}
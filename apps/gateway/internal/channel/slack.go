@@ -0,0 +1,149 @@
+package channel
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"nextai/apps/gateway/internal/plugin"
+)
+
+const (
+	defaultSlackAPIBase = "https://slack.com/api"
+	defaultSlackTimeout = 8 * time.Second
+)
+
+// SlackChannel posts replies to Slack through an incoming webhook or, when no
+// webhook_url is configured, through chat.postMessage with a bot token.
+type SlackChannel struct{}
+
+func NewSlackChannel() *SlackChannel {
+	return &SlackChannel{}
+}
+
+func (c *SlackChannel) Name() string {
+	return "slack"
+}
+
+// RequiredConfig lists the alternative field sets a Slack config must fill.
+func (c *SlackChannel) RequiredConfig() [][]string {
+	return [][]string{
+		{"webhook_url"},
+		{"bot_token", "channel_id"},
+	}
+}
+
+func (c *SlackChannel) ValidateConfig(cfg map[string]interface{}) error {
+	if strings.TrimSpace(toString(cfg["webhook_url"])) != "" {
+		return nil
+	}
+	botToken := strings.TrimSpace(toString(cfg["bot_token"]))
+	channelID := strings.TrimSpace(toString(cfg["channel_id"]))
+	if botToken == "" && channelID == "" {
+		return fmt.Errorf("channel slack requires config.webhook_url or config.bot_token with config.channel_id")
+	}
+	if botToken == "" {
+		return fmt.Errorf("channel slack requires config.bot_token when config.channel_id is set")
+	}
+	if channelID == "" {
+		return fmt.Errorf("channel slack requires config.channel_id when config.bot_token is set")
+	}
+	return nil
+}
+
+// Capabilities reports markdown: both the webhook and chat.postMessage render
+// the text field as Slack mrkdwn, so strip_markdown leaves replies untouched.
+func (c *SlackChannel) Capabilities() plugin.ChannelCapabilities {
+	return plugin.ChannelCapabilities{Markdown: true}
+}
+
+func (c *SlackChannel) SendText(ctx context.Context, _ string, _ string, text string, cfg map[string]interface{}) error {
+	if err := c.ValidateConfig(cfg); err != nil {
+		return err
+	}
+	content := strings.TrimSpace(text)
+	if content == "" {
+		return nil
+	}
+	if prefix := toString(cfg["bot_prefix"]); prefix != "" {
+		content = prefix + content
+	}
+
+	timeout := toDurationSeconds(cfg["timeout_seconds"], defaultSlackTimeout)
+	requestCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if webhookURL := strings.TrimSpace(toString(cfg["webhook_url"])); webhookURL != "" {
+		return c.postWebhook(requestCtx, webhookURL, content)
+	}
+	return c.postMessage(requestCtx, cfg, content)
+}
+
+func (c *SlackChannel) postWebhook(ctx context.Context, webhookURL, content string) error {
+	body, err := json.Marshal(map[string]interface{}{"text": content})
+	if err != nil {
+		return fmt.Errorf("marshal slack webhook payload failed: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("build slack webhook request failed: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("send slack webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return statusErrorf(resp.StatusCode, "slack webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (c *SlackChannel) postMessage(ctx context.Context, cfg map[string]interface{}, content string) error {
+	apiBase := strings.TrimRight(strings.TrimSpace(toString(cfg["api_base"])), "/")
+	if apiBase == "" {
+		apiBase = defaultSlackAPIBase
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"channel": strings.TrimSpace(toString(cfg["channel_id"])),
+		"text":    content,
+	})
+	if err != nil {
+		return fmt.Errorf("marshal slack message payload failed: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiBase+"/chat.postMessage", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("build slack message request failed: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(toString(cfg["bot_token"])))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("send slack message request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return statusErrorf(resp.StatusCode, "slack chat.postMessage returned status %d", resp.StatusCode)
+	}
+	// chat.postMessage reports failures with HTTP 200 and ok=false.
+	var result struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return fmt.Errorf("decode slack chat.postMessage response failed: %w", err)
+	}
+	if !result.OK {
+		return fmt.Errorf("slack chat.postMessage failed: %s", result.Error)
+	}
+	return nil
+}
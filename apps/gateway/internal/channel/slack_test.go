@@ -0,0 +1,96 @@
+package channel
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSlackChannelSendTextViaIncomingWebhook(t *testing.T) {
+	var payload map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Fatalf("decode webhook body failed: %v", err)
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	cfg := map[string]interface{}{
+		"webhook_url": server.URL,
+		"bot_prefix":  "[BOT] ",
+	}
+	if err := NewSlackChannel().SendText(context.Background(), "u-1", "s-1", "hello", cfg); err != nil {
+		t.Fatalf("send text failed: %v", err)
+	}
+	if payload["text"] != "[BOT] hello" {
+		t.Fatalf("unexpected text: %#v", payload["text"])
+	}
+}
+
+func TestSlackChannelSendTextViaChatPostMessage(t *testing.T) {
+	var payload map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/chat.postMessage" {
+			t.Fatalf("unexpected path: %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer xoxb-1" {
+			t.Fatalf("unexpected authorization header: %s", got)
+		}
+		defer r.Body.Close()
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Fatalf("decode message body failed: %v", err)
+		}
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	cfg := map[string]interface{}{
+		"bot_token":  "xoxb-1",
+		"channel_id": "C123",
+		"api_base":   server.URL,
+	}
+	if err := NewSlackChannel().SendText(context.Background(), "u-1", "s-1", "hello", cfg); err != nil {
+		t.Fatalf("send text failed: %v", err)
+	}
+	if payload["channel"] != "C123" || payload["text"] != "hello" {
+		t.Fatalf("unexpected payload: %#v", payload)
+	}
+}
+
+func TestSlackChannelReportsChatPostMessageError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"ok":false,"error":"channel_not_found"}`))
+	}))
+	defer server.Close()
+
+	cfg := map[string]interface{}{
+		"bot_token":  "xoxb-1",
+		"channel_id": "C404",
+		"api_base":   server.URL,
+	}
+	err := NewSlackChannel().SendText(context.Background(), "u-1", "s-1", "hello", cfg)
+	if err == nil || !strings.Contains(err.Error(), "channel_not_found") {
+		t.Fatalf("expected channel_not_found error, got=%v", err)
+	}
+}
+
+func TestSlackChannelValidateConfig(t *testing.T) {
+	ch := NewSlackChannel()
+	if err := ch.ValidateConfig(map[string]interface{}{"webhook_url": "https://hooks.slack.com/x"}); err != nil {
+		t.Fatalf("expected webhook config to be valid, got=%v", err)
+	}
+	if err := ch.ValidateConfig(map[string]interface{}{"bot_token": "xoxb-1", "channel_id": "C1"}); err != nil {
+		t.Fatalf("expected bot config to be valid, got=%v", err)
+	}
+	if err := ch.ValidateConfig(map[string]interface{}{"bot_token": "xoxb-1"}); err == nil {
+		t.Fatalf("expected missing channel_id to be rejected")
+	}
+	if err := ch.ValidateConfig(map[string]interface{}{}); err == nil {
+		t.Fatalf("expected empty config to be rejected")
+	}
+}
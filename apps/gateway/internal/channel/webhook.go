@@ -9,6 +9,8 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"nextai/apps/gateway/internal/plugin"
 )
 
 const (
@@ -26,6 +28,10 @@ func (c *WebhookChannel) Name() string {
 	return "webhook"
 }
 
+func (c *WebhookChannel) Capabilities() plugin.ChannelCapabilities {
+	return plugin.ChannelCapabilities{}
+}
+
 func (c *WebhookChannel) SendText(ctx context.Context, userID, sessionID, text string, cfg map[string]interface{}) error {
 	url := strings.TrimSpace(toString(cfg["url"]))
 	if url == "" {
@@ -70,7 +76,7 @@ func (c *WebhookChannel) SendText(ctx context.Context, userID, sessionID, text s
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
-		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+		return statusErrorf(resp.StatusCode, "webhook returned status %d", resp.StatusCode)
 	}
 	return nil
 }
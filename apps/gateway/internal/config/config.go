@@ -2,20 +2,51 @@ package config
 
 import (
 	"os"
+	"strconv"
 	"strings"
 )
 
+const (
+	defaultDeletedChatRetentionDays = 30
+	defaultMaxAgentSteps            = 16
+	defaultAgentTimeoutMS           = 120000
+	defaultToolApprovalTimeoutMS    = 600000
+	defaultProviderFailureCooldown  = 30000
+	defaultCronGlobalConcurrency    = 8
+)
+
+// DefaultMaxResponseEvents caps non-streaming agent events when
+// NEXTAI_MAX_RESPONSE_EVENTS is unset; the server also falls back to it for a
+// Config built without Load.
+const DefaultMaxResponseEvents = 500
+
 type Config struct {
 	Host                           string
 	Port                           string
 	DataDir                        string
 	APIKey                         string
+	APIKeys                        map[string][]string
 	WebDir                         string
 	EnablePromptTemplates          bool
 	EnablePromptContextIntrospect  bool
 	EnableCodexModeV2              bool
 	CodexPromptSource              string
 	EnableCodexPromptShadowCompare bool
+	ProviderFailureReply           string
+	AutoTitle                      bool
+	DeletedChatRetentionDays       int
+	MaxAgentSteps                  int
+	MaxRecoverySteps               int
+	AgentTimeoutMS                 int
+	ToolApprovalTimeoutMS          int
+	MaxResponseEvents              int
+	ProviderFailureCooldownMS      int
+	RateLimitRPM                   int
+	AppendCitations                bool
+	CronGlobalConcurrency          int
+	CronLeaseTTLMS                 int
+	StrictRequestDecode            bool
+	DebugProviderErrors            bool
 }
 
 func Load() Config {
@@ -32,23 +63,58 @@ func Load() Config {
 		dataDir = ".data"
 	}
 	apiKey := os.Getenv("NEXTAI_API_KEY")
+	apiKeys := parseAPIKeys(os.Getenv("NEXTAI_API_KEYS"))
 	webDir := os.Getenv("NEXTAI_WEB_DIR")
 	enablePromptTemplates := parseEnvBool("NEXTAI_ENABLE_PROMPT_TEMPLATES")
 	enablePromptContextIntrospect := parseEnvBool("NEXTAI_ENABLE_PROMPT_CONTEXT_INTROSPECT")
 	enableCodexModeV2 := parseEnvBool("NEXTAI_ENABLE_CODEX_MODE_V2")
 	codexPromptSource := parseCodexPromptSource("NEXTAI_CODEX_PROMPT_SOURCE")
 	enableCodexPromptShadowCompare := parseEnvBool("NEXTAI_CODEX_PROMPT_SHADOW_COMPARE")
+	providerFailureReply := strings.TrimSpace(os.Getenv("NEXTAI_PROVIDER_FAILURE_REPLY"))
+	autoTitle := parseEnvBool("NEXTAI_AUTO_TITLE")
+	deletedChatRetentionDays := parseEnvNonNegativeInt("NEXTAI_DELETED_CHAT_RETENTION_DAYS", defaultDeletedChatRetentionDays)
+	maxAgentSteps := parseEnvPositiveInt("NEXTAI_MAX_AGENT_STEPS", defaultMaxAgentSteps)
+	maxRecoverySteps := parseEnvPositiveInt("NEXTAI_MAX_RECOVERY_STEPS", 0)
+	agentTimeoutMS := parseEnvPositiveInt("NEXTAI_AGENT_TIMEOUT_MS", defaultAgentTimeoutMS)
+	toolApprovalTimeoutMS := parseEnvPositiveInt("NEXTAI_TOOL_APPROVAL_TIMEOUT_MS", defaultToolApprovalTimeoutMS)
+	maxResponseEvents := parseEnvPositiveInt("NEXTAI_MAX_RESPONSE_EVENTS", DefaultMaxResponseEvents)
+	providerFailureCooldownMS := parseEnvNonNegativeInt("NEXTAI_PROVIDER_FAILURE_COOLDOWN_MS", defaultProviderFailureCooldown)
+	rateLimitRPM := parseEnvPositiveInt("NEXTAI_RATE_LIMIT_RPM", 0)
+	appendCitations := parseEnvBool("NEXTAI_APPEND_CITATIONS")
+	// NEXTAI_CRON_MAX_GLOBAL_CONCURRENCY is the original name and still
+	// applies when NEXTAI_CRON_GLOBAL_CONCURRENCY is unset.
+	legacyCronGlobalConcurrency := parseEnvNonNegativeInt("NEXTAI_CRON_MAX_GLOBAL_CONCURRENCY", defaultCronGlobalConcurrency)
+	cronGlobalConcurrency := parseEnvNonNegativeInt("NEXTAI_CRON_GLOBAL_CONCURRENCY", legacyCronGlobalConcurrency)
+	cronLeaseTTLMS := parseEnvPositiveInt("NEXTAI_CRON_LEASE_TTL_MS", 0)
+	strictRequestDecode := parseEnvBool("NEXTAI_STRICT_REQUEST_DECODE")
+	debugProviderErrors := parseEnvBool("NEXTAI_DEBUG_PROVIDER_ERRORS")
 	return Config{
 		Host:                           host,
 		Port:                           port,
 		DataDir:                        dataDir,
 		APIKey:                         apiKey,
+		APIKeys:                        apiKeys,
 		WebDir:                         webDir,
 		EnablePromptTemplates:          enablePromptTemplates,
 		EnablePromptContextIntrospect:  enablePromptContextIntrospect,
 		EnableCodexModeV2:              enableCodexModeV2,
 		CodexPromptSource:              codexPromptSource,
 		EnableCodexPromptShadowCompare: enableCodexPromptShadowCompare,
+		ProviderFailureReply:           providerFailureReply,
+		AutoTitle:                      autoTitle,
+		DeletedChatRetentionDays:       deletedChatRetentionDays,
+		MaxAgentSteps:                  maxAgentSteps,
+		MaxRecoverySteps:               maxRecoverySteps,
+		AgentTimeoutMS:                 agentTimeoutMS,
+		ToolApprovalTimeoutMS:          toolApprovalTimeoutMS,
+		MaxResponseEvents:              maxResponseEvents,
+		ProviderFailureCooldownMS:      providerFailureCooldownMS,
+		RateLimitRPM:                   rateLimitRPM,
+		AppendCitations:                appendCitations,
+		CronGlobalConcurrency:          cronGlobalConcurrency,
+		CronLeaseTTLMS:                 cronLeaseTTLMS,
+		StrictRequestDecode:            strictRequestDecode,
+		DebugProviderErrors:            debugProviderErrors,
 	}
 }
 
@@ -56,6 +122,53 @@ func parseEnvBool(key string) bool {
 	return strings.EqualFold(strings.TrimSpace(os.Getenv(key)), "true")
 }
 
+func parseEnvPositiveInt(key string, fallback int) int {
+	n, err := strconv.Atoi(strings.TrimSpace(os.Getenv(key)))
+	if err != nil || n <= 0 {
+		return fallback
+	}
+	return n
+}
+
+// parseEnvNonNegativeInt is parseEnvPositiveInt for settings where 0 turns
+// the feature off.
+func parseEnvNonNegativeInt(key string, fallback int) int {
+	n, err := strconv.Atoi(strings.TrimSpace(os.Getenv(key)))
+	if err != nil || n < 0 {
+		return fallback
+	}
+	return n
+}
+
+// parseAPIKeys reads comma-separated `key:provider|provider` entries. A key
+// without a provider list, or with `*`, may use every provider.
+func parseAPIKeys(raw string) map[string][]string {
+	out := map[string][]string{}
+	for _, entry := range strings.Split(raw, ",") {
+		key, rawProviders, scoped := strings.Cut(strings.TrimSpace(entry), ":")
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		rawProviders = strings.TrimSpace(rawProviders)
+		if !scoped || rawProviders == "*" {
+			out[key] = nil
+			continue
+		}
+		providers := []string{}
+		for _, provider := range strings.Split(rawProviders, "|") {
+			if provider = strings.ToLower(strings.TrimSpace(provider)); provider != "" {
+				providers = append(providers, provider)
+			}
+		}
+		out[key] = providers
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
 func parseCodexPromptSource(key string) string {
 	switch strings.ToLower(strings.TrimSpace(os.Getenv(key))) {
 	case "catalog":
@@ -1,6 +1,9 @@
 package config
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+)
 
 func TestLoadCodexPromptSourceDefaultsToFile(t *testing.T) {
 	t.Setenv("NEXTAI_CODEX_PROMPT_SOURCE", "")
@@ -36,3 +39,234 @@ func TestLoadCodexPromptSourceInvalidFallsBackToFile(t *testing.T) {
 		t.Fatalf("expected invalid source to fallback file, got=%q", cfg.CodexPromptSource)
 	}
 }
+
+func TestLoadProviderFailureReply(t *testing.T) {
+	t.Setenv("NEXTAI_PROVIDER_FAILURE_REPLY", "  try again later  ")
+
+	cfg := Load()
+	if cfg.ProviderFailureReply != "try again later" {
+		t.Fatalf("expected trimmed provider failure reply, got=%q", cfg.ProviderFailureReply)
+	}
+}
+
+func TestLoadAutoTitle(t *testing.T) {
+	t.Setenv("NEXTAI_AUTO_TITLE", "TRUE")
+
+	cfg := Load()
+	if !cfg.AutoTitle {
+		t.Fatalf("expected auto title to be enabled")
+	}
+}
+
+func TestLoadAppendCitations(t *testing.T) {
+	t.Setenv("NEXTAI_APPEND_CITATIONS", "")
+	if cfg := Load(); cfg.AppendCitations {
+		t.Fatalf("expected citations disabled by default")
+	}
+
+	t.Setenv("NEXTAI_APPEND_CITATIONS", "true")
+	if cfg := Load(); !cfg.AppendCitations {
+		t.Fatalf("expected citations to be enabled")
+	}
+}
+
+func TestLoadDebugProviderErrors(t *testing.T) {
+	t.Setenv("NEXTAI_DEBUG_PROVIDER_ERRORS", "")
+	if cfg := Load(); cfg.DebugProviderErrors {
+		t.Fatalf("expected provider error debugging disabled by default")
+	}
+
+	t.Setenv("NEXTAI_DEBUG_PROVIDER_ERRORS", "true")
+	if cfg := Load(); !cfg.DebugProviderErrors {
+		t.Fatalf("expected provider error debugging to be enabled")
+	}
+}
+
+func TestLoadDeletedChatRetentionDays(t *testing.T) {
+	t.Setenv("NEXTAI_DELETED_CHAT_RETENTION_DAYS", "")
+	if cfg := Load(); cfg.DeletedChatRetentionDays != 30 {
+		t.Fatalf("expected default retention 30, got=%d", cfg.DeletedChatRetentionDays)
+	}
+
+	t.Setenv("NEXTAI_DELETED_CHAT_RETENTION_DAYS", "7")
+	if cfg := Load(); cfg.DeletedChatRetentionDays != 7 {
+		t.Fatalf("expected retention 7, got=%d", cfg.DeletedChatRetentionDays)
+	}
+
+	t.Setenv("NEXTAI_DELETED_CHAT_RETENTION_DAYS", "0")
+	if cfg := Load(); cfg.DeletedChatRetentionDays != 0 {
+		t.Fatalf("expected retention 0 to keep deleted chats, got=%d", cfg.DeletedChatRetentionDays)
+	}
+
+	t.Setenv("NEXTAI_DELETED_CHAT_RETENTION_DAYS", "-1")
+	if cfg := Load(); cfg.DeletedChatRetentionDays != 30 {
+		t.Fatalf("expected invalid retention to fallback 30, got=%d", cfg.DeletedChatRetentionDays)
+	}
+}
+
+func TestLoadMaxAgentSteps(t *testing.T) {
+	t.Setenv("NEXTAI_MAX_AGENT_STEPS", "")
+	if cfg := Load(); cfg.MaxAgentSteps != 16 {
+		t.Fatalf("expected default max steps 16, got=%d", cfg.MaxAgentSteps)
+	}
+
+	t.Setenv("NEXTAI_MAX_AGENT_STEPS", "4")
+	if cfg := Load(); cfg.MaxAgentSteps != 4 {
+		t.Fatalf("expected max steps 4, got=%d", cfg.MaxAgentSteps)
+	}
+}
+
+func TestLoadAgentTimeoutMS(t *testing.T) {
+	t.Setenv("NEXTAI_AGENT_TIMEOUT_MS", "")
+	if cfg := Load(); cfg.AgentTimeoutMS != 120000 {
+		t.Fatalf("expected default agent timeout 120000, got=%d", cfg.AgentTimeoutMS)
+	}
+
+	t.Setenv("NEXTAI_AGENT_TIMEOUT_MS", "5000")
+	if cfg := Load(); cfg.AgentTimeoutMS != 5000 {
+		t.Fatalf("expected agent timeout 5000, got=%d", cfg.AgentTimeoutMS)
+	}
+}
+
+func TestLoadToolApprovalTimeoutMS(t *testing.T) {
+	t.Setenv("NEXTAI_TOOL_APPROVAL_TIMEOUT_MS", "")
+	if cfg := Load(); cfg.ToolApprovalTimeoutMS != 600000 {
+		t.Fatalf("expected default tool approval timeout 600000, got=%d", cfg.ToolApprovalTimeoutMS)
+	}
+
+	t.Setenv("NEXTAI_TOOL_APPROVAL_TIMEOUT_MS", "30000")
+	if cfg := Load(); cfg.ToolApprovalTimeoutMS != 30000 {
+		t.Fatalf("expected tool approval timeout 30000, got=%d", cfg.ToolApprovalTimeoutMS)
+	}
+}
+
+func TestLoadProviderFailureCooldownMS(t *testing.T) {
+	t.Setenv("NEXTAI_PROVIDER_FAILURE_COOLDOWN_MS", "")
+	if cfg := Load(); cfg.ProviderFailureCooldownMS != 30000 {
+		t.Fatalf("expected default provider failure cooldown 30000, got=%d", cfg.ProviderFailureCooldownMS)
+	}
+
+	t.Setenv("NEXTAI_PROVIDER_FAILURE_COOLDOWN_MS", "1500")
+	if cfg := Load(); cfg.ProviderFailureCooldownMS != 1500 {
+		t.Fatalf("expected provider failure cooldown 1500, got=%d", cfg.ProviderFailureCooldownMS)
+	}
+
+	t.Setenv("NEXTAI_PROVIDER_FAILURE_COOLDOWN_MS", "0")
+	if cfg := Load(); cfg.ProviderFailureCooldownMS != 0 {
+		t.Fatalf("expected provider failure cooldown 0 to disable the health cache, got=%d", cfg.ProviderFailureCooldownMS)
+	}
+
+	t.Setenv("NEXTAI_PROVIDER_FAILURE_COOLDOWN_MS", "-1")
+	if cfg := Load(); cfg.ProviderFailureCooldownMS != 30000 {
+		t.Fatalf("expected invalid provider failure cooldown to fallback 30000, got=%d", cfg.ProviderFailureCooldownMS)
+	}
+}
+
+func TestLoadRateLimitRPM(t *testing.T) {
+	t.Setenv("NEXTAI_RATE_LIMIT_RPM", "")
+	if cfg := Load(); cfg.RateLimitRPM != 0 {
+		t.Fatalf("expected rate limit disabled by default, got=%d", cfg.RateLimitRPM)
+	}
+
+	t.Setenv("NEXTAI_RATE_LIMIT_RPM", "20")
+	if cfg := Load(); cfg.RateLimitRPM != 20 {
+		t.Fatalf("expected rate limit 20, got=%d", cfg.RateLimitRPM)
+	}
+}
+
+func TestLoadCronGlobalConcurrency(t *testing.T) {
+	t.Setenv("NEXTAI_CRON_MAX_GLOBAL_CONCURRENCY", "")
+	t.Setenv("NEXTAI_CRON_GLOBAL_CONCURRENCY", "")
+	if cfg := Load(); cfg.CronGlobalConcurrency != 8 {
+		t.Fatalf("expected default global cron concurrency 8, got=%d", cfg.CronGlobalConcurrency)
+	}
+
+	t.Setenv("NEXTAI_CRON_GLOBAL_CONCURRENCY", "4")
+	if cfg := Load(); cfg.CronGlobalConcurrency != 4 {
+		t.Fatalf("expected global cron concurrency 4, got=%d", cfg.CronGlobalConcurrency)
+	}
+
+	t.Setenv("NEXTAI_CRON_GLOBAL_CONCURRENCY", "0")
+	if cfg := Load(); cfg.CronGlobalConcurrency != 0 {
+		t.Fatalf("expected 0 to lift the global cron cap, got=%d", cfg.CronGlobalConcurrency)
+	}
+}
+
+func TestLoadCronGlobalConcurrencyLegacyName(t *testing.T) {
+	t.Setenv("NEXTAI_CRON_GLOBAL_CONCURRENCY", "")
+	t.Setenv("NEXTAI_CRON_MAX_GLOBAL_CONCURRENCY", "3")
+	if cfg := Load(); cfg.CronGlobalConcurrency != 3 {
+		t.Fatalf("expected legacy name to set global cron concurrency 3, got=%d", cfg.CronGlobalConcurrency)
+	}
+
+	t.Setenv("NEXTAI_CRON_GLOBAL_CONCURRENCY", "5")
+	if cfg := Load(); cfg.CronGlobalConcurrency != 5 {
+		t.Fatalf("expected current name to win over the legacy one, got=%d", cfg.CronGlobalConcurrency)
+	}
+}
+
+func TestLoadCronLeaseTTL(t *testing.T) {
+	t.Setenv("NEXTAI_CRON_LEASE_TTL_MS", "")
+	if cfg := Load(); cfg.CronLeaseTTLMS != 0 {
+		t.Fatalf("expected timeout-derived cron lease ttl by default, got=%d", cfg.CronLeaseTTLMS)
+	}
+
+	t.Setenv("NEXTAI_CRON_LEASE_TTL_MS", "600000")
+	if cfg := Load(); cfg.CronLeaseTTLMS != 600000 {
+		t.Fatalf("expected cron lease ttl 600000, got=%d", cfg.CronLeaseTTLMS)
+	}
+}
+
+func TestLoadMaxRecoverySteps(t *testing.T) {
+	t.Setenv("NEXTAI_MAX_RECOVERY_STEPS", "")
+	if cfg := Load(); cfg.MaxRecoverySteps != 0 {
+		t.Fatalf("expected no recovery cap by default, got=%d", cfg.MaxRecoverySteps)
+	}
+
+	t.Setenv("NEXTAI_MAX_RECOVERY_STEPS", "3")
+	if cfg := Load(); cfg.MaxRecoverySteps != 3 {
+		t.Fatalf("expected recovery cap 3, got=%d", cfg.MaxRecoverySteps)
+	}
+}
+
+func TestLoadStrictRequestDecode(t *testing.T) {
+	t.Setenv("NEXTAI_STRICT_REQUEST_DECODE", "")
+	if cfg := Load(); cfg.StrictRequestDecode {
+		t.Fatalf("expected lenient request decoding by default")
+	}
+
+	t.Setenv("NEXTAI_STRICT_REQUEST_DECODE", "true")
+	if cfg := Load(); !cfg.StrictRequestDecode {
+		t.Fatalf("expected strict request decoding to be enabled")
+	}
+}
+
+func TestLoadMaxResponseEvents(t *testing.T) {
+	t.Setenv("NEXTAI_MAX_RESPONSE_EVENTS", "")
+	if cfg := Load(); cfg.MaxResponseEvents != 500 {
+		t.Fatalf("expected default max response events 500, got=%d", cfg.MaxResponseEvents)
+	}
+
+	t.Setenv("NEXTAI_MAX_RESPONSE_EVENTS", "40")
+	if cfg := Load(); cfg.MaxResponseEvents != 40 {
+		t.Fatalf("expected max response events 40, got=%d", cfg.MaxResponseEvents)
+	}
+}
+
+func TestLoadAPIKeys(t *testing.T) {
+	t.Setenv("NEXTAI_API_KEYS", "")
+	if cfg := Load(); cfg.APIKeys != nil {
+		t.Fatalf("expected no scoped api keys by default, got=%#v", cfg.APIKeys)
+	}
+
+	t.Setenv("NEXTAI_API_KEYS", "key-a:OpenAI|anthropic, key-b:*,key-c")
+	cfg := Load()
+	want := map[string][]string{
+		"key-a": {"openai", "anthropic"},
+		"key-b": nil,
+		"key-c": nil,
+	}
+	if !reflect.DeepEqual(cfg.APIKeys, want) {
+		t.Fatalf("unexpected api keys: %#v", cfg.APIKeys)
+	}
+}
@@ -35,6 +35,9 @@ type ChatSpec struct {
 	CreatedAt string                 `json:"created_at"`
 	UpdatedAt string                 `json:"updated_at"`
 	Meta      map[string]interface{} `json:"meta"`
+	Archived  bool                   `json:"archived,omitempty"`
+	// ApproxChars is only populated by listChats when include_size=true.
+	ApproxChars *int `json:"approx_chars,omitempty"`
 }
 
 type ChatActiveLLMOverride struct {
@@ -46,6 +49,11 @@ type ChatActiveLLMOverride struct {
 type RuntimeContent struct {
 	Type string `json:"type"`
 	Text string `json:"text,omitempty"`
+	// ImageURL references an image for "image_url" parts; Data carries inline
+	// base64 content (with MimeType) when no URL is available.
+	ImageURL string `json:"image_url,omitempty"`
+	Data     string `json:"data,omitempty"`
+	MimeType string `json:"mime_type,omitempty"`
 }
 
 type RuntimeMessage struct {
@@ -56,6 +64,12 @@ type RuntimeMessage struct {
 	Content  []RuntimeContent       `json:"content,omitempty"`
 }
 
+type DeletedChat struct {
+	Chat      ChatSpec         `json:"chat"`
+	History   []RuntimeMessage `json:"history"`
+	DeletedAt string           `json:"deleted_at"`
+}
+
 type ChatHistory struct {
 	Messages []RuntimeMessage `json:"messages"`
 }
@@ -74,6 +88,23 @@ type AgentProcessRequest struct {
 	Channel   string                 `json:"channel"`
 	Stream    bool                   `json:"stream"`
 	BizParams map[string]interface{} `json:"biz_params,omitempty"`
+	// Model overrides the chat/global active model for this request only.
+	Model *ModelSlotConfig `json:"model,omitempty"`
+	// DryRun returns the model's planned tool calls without executing them or touching history.
+	DryRun bool `json:"dry_run,omitempty"`
+	// Ephemeral runs the request without reading or writing chats and history.
+	Ephemeral bool `json:"ephemeral,omitempty"`
+	// MaxInputTokens caps the estimated prompt size; oldest history is trimmed to fit.
+	// Zero uses a share of the active model's context window.
+	MaxInputTokens int `json:"max_input_tokens,omitempty"`
+	// Debug adds the raw provider finish metadata to the completed event and response.
+	Debug bool `json:"debug,omitempty"`
+	// ParallelToolCalls overrides the provider parallel_tool_calls default;
+	// ignored for adapters other than openai-compatible.
+	ParallelToolCalls *bool `json:"parallel_tool_calls,omitempty"`
+	// Skills limits injected skills to these names for this request; an empty
+	// list injects none. Nil falls back to the chat selection.
+	Skills []string `json:"skills,omitempty"`
 }
 
 type AgentToolCallPayload struct {
@@ -85,27 +116,93 @@ type AgentToolResultPayload struct {
 	Name    string `json:"name"`
 	OK      bool   `json:"ok"`
 	Summary string `json:"summary,omitempty"`
+	// DurationMS is the wall time spent executing the tool.
+	DurationMS int64 `json:"duration_ms"`
+	// Screenshot carries visual output, e.g. from the browser tool, so the
+	// UI can render it; the model only sees the text reply.
+	Screenshot *AgentToolScreenshot `json:"screenshot,omitempty"`
+}
+
+type AgentToolScreenshot struct {
+	Path string `json:"path,omitempty"`
+	// Base64 holds the PNG bytes when the file was small enough to inline.
+	Base64 string `json:"base64,omitempty"`
 }
 
+// Stop reasons explain why an agent turn ended.
+const (
+	StopReasonNormal    = "normal"
+	StopReasonLength    = "length"
+	StopReasonMaxSteps  = "max_steps"
+	StopReasonTimeout   = "timeout"
+	StopReasonCancelled = "cancelled"
+	// StopReasonRecoveryLimit means the model kept producing invalid or
+	// failing tool calls until the recovery cap was hit.
+	StopReasonRecoveryLimit = "recovery_limit_reached"
+)
+
 type AgentEvent struct {
 	Type       string                  `json:"type"`
 	Step       int                     `json:"step,omitempty"`
 	Delta      string                  `json:"delta,omitempty"`
 	Reply      string                  `json:"reply,omitempty"`
+	StopReason string                  `json:"stop_reason,omitempty"`
 	ToolCall   *AgentToolCallPayload   `json:"tool_call,omitempty"`
 	ToolResult *AgentToolResultPayload `json:"tool_result,omitempty"`
+	Usage      *AgentUsage             `json:"usage,omitempty"`
 	Meta       map[string]interface{}  `json:"meta,omitempty"`
 }
 
+type AgentUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
 type AgentProcessResponse struct {
-	Reply  string       `json:"reply"`
-	Events []AgentEvent `json:"events,omitempty"`
+	Reply           string       `json:"reply"`
+	Events          []AgentEvent `json:"events,omitempty"`
+	EventsTruncated bool         `json:"events_truncated,omitempty"`
+	Usage           *AgentUsage  `json:"usage,omitempty"`
+	StopReason      string       `json:"stop_reason,omitempty"`
+	Citations       []Citation   `json:"citations,omitempty"`
+	Dispatch        *Dispatch    `json:"dispatch,omitempty"`
+	// ProviderMeta is only set for debug requests.
+	ProviderMeta *ProviderMeta `json:"provider_meta,omitempty"`
+}
+
+// ProviderMeta is the finish metadata reported by the provider for the final turn.
+type ProviderMeta struct {
+	Model             string `json:"model,omitempty"`
+	FinishReason      string `json:"finish_reason,omitempty"`
+	SystemFingerprint string `json:"system_fingerprint,omitempty"`
+}
+
+// Dispatch reports how the reply was delivered to the request channel.
+type Dispatch struct {
+	Channel   string `json:"channel"`
+	TargetID  string `json:"target_id,omitempty"`
+	Delivered bool   `json:"delivered"`
+	Chunks    int    `json:"chunks,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Citation is a source link collected from tool results during an agent run.
+type Citation struct {
+	Title string `json:"title,omitempty"`
+	URL   string `json:"url"`
 }
 
 type CronScheduleSpec struct {
 	Type     string `json:"type"`
 	Cron     string `json:"cron"`
 	Timezone string `json:"timezone"`
+	// CatchUp decides what happens to a run missed beyond the misfire grace:
+	// skip (default) records it as failed, fire_once runs it once right away.
+	CatchUp string `json:"catch_up,omitempty"`
+	// JitterSeconds shifts interval runs by a per-job offset in [0, jitter] so
+	// jobs created together do not fire in the same second.
+	JitterSeconds int `json:"jitter_seconds,omitempty"`
 }
 
 type CronDispatchTarget struct {
@@ -125,6 +222,9 @@ type CronRuntimeSpec struct {
 	MaxConcurrency      int `json:"max_concurrency"`
 	TimeoutSeconds      int `json:"timeout_seconds"`
 	MisfireGraceSeconds int `json:"misfire_grace_seconds"`
+	// AlignToLastRun makes interval jobs without a pending run resume on the
+	// cadence of last_run_at instead of starting a fresh interval at now.
+	AlignToLastRun bool `json:"align_to_last_run,omitempty"`
 }
 
 type CronWorkflowSpec struct {
@@ -184,12 +284,20 @@ type CronJobSpec struct {
 	TaskType string                 `json:"task_type"`
 	Text     string                 `json:"text,omitempty"`
 	Workflow *CronWorkflowSpec      `json:"workflow,omitempty"`
+	Tool     *CronToolTask          `json:"tool,omitempty"`
 	Request  map[string]interface{} `json:"request,omitempty"`
 	Dispatch CronDispatchSpec       `json:"dispatch"`
 	Runtime  CronRuntimeSpec        `json:"runtime"`
 	Meta     map[string]interface{} `json:"meta"`
 }
 
+// CronToolTask is the tool call a task_type=tool job runs on schedule without a
+// model turn.
+type CronToolTask struct {
+	Name  string                 `json:"name"`
+	Input map[string]interface{} `json:"input,omitempty"`
+}
+
 type CronJobState struct {
 	NextRunAt     *string                `json:"next_run_at,omitempty"`
 	LastRunAt     *string                `json:"last_run_at,omitempty"`
@@ -197,6 +305,42 @@ type CronJobState struct {
 	LastError     *string                `json:"last_error,omitempty"`
 	Paused        bool                   `json:"paused,omitempty"`
 	LastExecution *CronWorkflowExecution `json:"last_execution,omitempty"`
+	// Runs holds the most recent executions, oldest first; the cron service
+	// trims it to a fixed cap.
+	Runs []CronRunRecord `json:"runs,omitempty"`
+}
+
+// CronRunRecord is one finished cron execution.
+type CronRunRecord struct {
+	StartedAt  string `json:"started_at"`
+	FinishedAt string `json:"finished_at"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+}
+
+// CronRunOutput is the result of a synchronous cron run: the agent reply
+// text, plus the error when the run failed.
+type CronRunOutput struct {
+	JobID  string `json:"job_id"`
+	Status string `json:"status"`
+	Output string `json:"output"`
+	Error  string `json:"error,omitempty"`
+}
+
+// CronJobActivation reports both switches of a job: Enabled is the persisted
+// spec flag, Paused the runtime hold set by pause/resume. A job is scheduled
+// only while it is enabled and not paused.
+type CronJobActivation struct {
+	JobID     string  `json:"job_id"`
+	Enabled   bool    `json:"enabled"`
+	Paused    bool    `json:"paused"`
+	Scheduled bool    `json:"scheduled"`
+	NextRunAt *string `json:"next_run_at,omitempty"`
+}
+
+type CronJobHistory struct {
+	JobID string          `json:"job_id"`
+	Runs  []CronRunRecord `json:"runs"`
 }
 
 type CronJobView struct {
@@ -204,6 +348,89 @@ type CronJobView struct {
 	State CronJobState `json:"state"`
 }
 
+// CronOverview lists every cron job with its state, soonest next run first,
+// plus the number of unexpired execution leases.
+type CronOverview struct {
+	Jobs          []CronOverviewItem `json:"jobs"`
+	RunningLeases int                `json:"running_leases"`
+	GeneratedAt   string             `json:"generated_at"`
+}
+
+type CronOverviewItem struct {
+	Spec          CronJobSpec  `json:"spec"`
+	State         CronJobState `json:"state"`
+	RunningLeases int          `json:"running_leases"`
+	// IsDueSoon marks a schedulable job whose next run is within the due-soon
+	// window (or already past).
+	IsDueSoon bool `json:"is_due_soon"`
+}
+
+// DisabledToolsConfig is the runtime-editable disabled tool set. EnvTools comes
+// from NEXTAI_DISABLED_TOOLS and stays disabled regardless of Tools.
+type DisabledToolsConfig struct {
+	Tools    []string `json:"tools"`
+	EnvTools []string `json:"env_tools"`
+}
+
+type AdminStats struct {
+	Chats       AdminChatStats     `json:"chats"`
+	Messages    int                `json:"messages"`
+	CronJobs    AdminCronJobStats  `json:"cron_jobs"`
+	Providers   AdminProviderStats `json:"providers"`
+	GeneratedAt string             `json:"generated_at"`
+}
+
+type AdminChatStats struct {
+	Total    int `json:"total"`
+	Archived int `json:"archived"`
+	Deleted  int `json:"deleted"`
+}
+
+type AdminCronJobStats struct {
+	Total    int            `json:"total"`
+	Enabled  int            `json:"enabled"`
+	Paused   int            `json:"paused"`
+	ByStatus map[string]int `json:"by_status"`
+}
+
+type AdminProviderStats struct {
+	Configured int `json:"configured"`
+	Enabled    int `json:"enabled"`
+}
+
+type CronBatchCreateItem struct {
+	Index   int          `json:"index"`
+	ID      string       `json:"id,omitempty"`
+	Created bool         `json:"created"`
+	Job     *CronJobSpec `json:"job,omitempty"`
+	Error   *APIError    `json:"error,omitempty"`
+}
+
+type CronJobValidation struct {
+	Valid     bool        `json:"valid"`
+	Job       CronJobSpec `json:"job"`
+	NextRunAt *string     `json:"next_run_at,omitempty"`
+	Problems  []APIError  `json:"problems"`
+}
+
+// CronSchedulePreview lists upcoming run times of a schedule, each in UTC and
+// in the schedule timezone (UTC when none is set).
+type CronSchedulePreview struct {
+	Timezone string           `json:"timezone"`
+	Runs     []CronRunPreview `json:"runs"`
+}
+
+type CronRunPreview struct {
+	UTC   string `json:"utc"`
+	Local string `json:"local"`
+}
+
+type CronBatchCreateResult struct {
+	Created int                   `json:"created"`
+	Failed  int                   `json:"failed"`
+	Results []CronBatchCreateItem `json:"results"`
+}
+
 type ModelInfo struct {
 	ID           string             `json:"id"`
 	Name         string             `json:"name"`
@@ -237,22 +464,32 @@ type ModelLimit struct {
 }
 
 type ProviderInfo struct {
-	ID                 string            `json:"id"`
-	Name               string            `json:"name"`
-	DisplayName        string            `json:"display_name"`
-	OpenAICompatible   bool              `json:"openai_compatible"`
-	APIKeyPrefix       string            `json:"api_key_prefix"`
-	Models             []ModelInfo       `json:"models"`
-	ReasoningEffort    string            `json:"reasoning_effort,omitempty"`
-	Store              bool              `json:"store"`
-	Headers            map[string]string `json:"headers,omitempty"`
-	TimeoutMS          int               `json:"timeout_ms,omitempty"`
-	ModelAliases       map[string]string `json:"model_aliases,omitempty"`
-	AllowCustomBaseURL bool              `json:"allow_custom_base_url"`
-	Enabled            bool              `json:"enabled"`
-	HasAPIKey          bool              `json:"has_api_key"`
-	CurrentAPIKey      string            `json:"current_api_key"`
-	CurrentBaseURL     string            `json:"current_base_url"`
+	ID                  string            `json:"id"`
+	Name                string            `json:"name"`
+	DisplayName         string            `json:"display_name"`
+	OpenAICompatible    bool              `json:"openai_compatible"`
+	APIKeyPrefix        string            `json:"api_key_prefix"`
+	Models              []ModelInfo       `json:"models"`
+	ReasoningEffort     string            `json:"reasoning_effort,omitempty"`
+	Store               bool              `json:"store"`
+	ForwardUser         string            `json:"forward_user,omitempty"`
+	CompressRequests    bool              `json:"compress_requests,omitempty"`
+	StreamUsage         bool              `json:"stream_usage,omitempty"`
+	ParallelToolCalls   *bool             `json:"parallel_tool_calls,omitempty"`
+	Temperature         *float64          `json:"temperature,omitempty"`
+	MaxTokens           int               `json:"max_tokens,omitempty"`
+	Headers             map[string]string `json:"headers,omitempty"`
+	TimeoutMS           int               `json:"timeout_ms,omitempty"`
+	ModelAliases        map[string]string `json:"model_aliases,omitempty"`
+	ModelContextWindows map[string]int    `json:"model_context_windows,omitempty"`
+	AllowCustomBaseURL  bool              `json:"allow_custom_base_url"`
+	Enabled             bool              `json:"enabled"`
+	HasAPIKey           bool              `json:"has_api_key"`
+	CurrentAPIKey       string            `json:"current_api_key"`
+	CurrentAPIKeys      []string          `json:"current_api_keys,omitempty"`
+	CurrentBaseURL      string            `json:"current_base_url"`
+	// Warnings lists non-fatal config problems; only set on configure responses.
+	Warnings []string `json:"warnings,omitempty"`
 }
 
 type ProviderTypeInfo struct {
@@ -263,6 +500,9 @@ type ProviderTypeInfo struct {
 type ModelSlotConfig struct {
 	ProviderID string `json:"provider_id"`
 	Model      string `json:"model"`
+	// Fallback lists slots tried in order when the provider request fails;
+	// nested fallback lists are ignored.
+	Fallback []ModelSlotConfig `json:"fallback,omitempty"`
 }
 
 type ActiveModelsInfo struct {
@@ -289,6 +529,17 @@ type SkillSpec struct {
 	References map[string]interface{} `json:"references"`
 	Scripts    map[string]interface{} `json:"scripts"`
 	Enabled    bool                   `json:"enabled"`
+	// CreatedAt and UpdatedAt are RFC3339 times; empty for skills saved
+	// before they were tracked.
+	CreatedAt string `json:"created_at,omitempty"`
+	UpdatedAt string `json:"updated_at,omitempty"`
 }
 
 type ChannelConfigMap map[string]map[string]interface{}
+
+// ChannelTypeInfo describes a registered channel and the config field sets it
+// accepts; any one set in RequiredConfig is enough.
+type ChannelTypeInfo struct {
+	Name           string     `json:"name"`
+	RequiredConfig [][]string `json:"required_config,omitempty"`
+}
@@ -1,6 +1,7 @@
 package observability
 
 import (
+	"context"
 	"crypto/subtle"
 	"encoding/json"
 	"net/http"
@@ -12,9 +13,14 @@ var publicAuthBypass = map[string]bool{
 	"/version": true,
 }
 
-func APIKey(requiredKey string) func(http.Handler) http.Handler {
+type allowedProvidersKey struct{}
+
+// APIKey requires requiredKey or one of scopedKeys on every non-public route.
+// scopedKeys maps an extra key to the providers it may use; a nil list leaves
+// the key unrestricted, like the primary key.
+func APIKey(requiredKey string, scopedKeys map[string][]string) func(http.Handler) http.Handler {
 	required := strings.TrimSpace(requiredKey)
-	if required == "" {
+	if required == "" && len(scopedKeys) == 0 {
 		return func(next http.Handler) http.Handler { return next }
 	}
 	return func(next http.Handler) http.Handler {
@@ -31,18 +37,51 @@ func APIKey(requiredKey string) func(http.Handler) http.Handler {
 					candidate = strings.TrimSpace(authHeader[7:])
 				}
 			}
-			if subtle.ConstantTimeCompare([]byte(candidate), []byte(required)) != 1 {
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusUnauthorized)
-				_ = json.NewEncoder(w).Encode(map[string]any{
-					"error": map[string]any{
-						"code":    "unauthorized",
-						"message": "missing or invalid api key",
-					},
-				})
+			if required != "" && subtle.ConstantTimeCompare([]byte(candidate), []byte(required)) == 1 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			for key, providers := range scopedKeys {
+				if key == "" || subtle.ConstantTimeCompare([]byte(candidate), []byte(key)) != 1 {
+					continue
+				}
+				if providers != nil {
+					r = r.WithContext(context.WithValue(r.Context(), allowedProvidersKey{}, providers))
+				}
+				next.ServeHTTP(w, r)
 				return
 			}
-			next.ServeHTTP(w, r)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"error": map[string]any{
+					"code":    "unauthorized",
+					"message": "missing or invalid api key",
+				},
+			})
 		})
 	}
 }
+
+// ProviderPermitted reports whether the API key that authenticated ctx may
+// use providerID. Requests without a scoped key are always permitted.
+func ProviderPermitted(ctx context.Context, providerID string) bool {
+	providers, ok := ctx.Value(allowedProvidersKey{}).([]string)
+	if !ok {
+		return true
+	}
+	providerID = strings.ToLower(strings.TrimSpace(providerID))
+	for _, allowed := range providers {
+		if allowed == providerID {
+			return true
+		}
+	}
+	return false
+}
+
+// ProviderScoped reports whether ctx was authenticated with a key limited to
+// a provider allow list.
+func ProviderScoped(ctx context.Context) bool {
+	_, ok := ctx.Value(allowedProvidersKey{}).([]string)
+	return ok
+}
@@ -0,0 +1,66 @@
+package observability
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	agentRequestsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "nextai_agent_requests_total",
+		Help: "Total number of /agent/process requests.",
+	})
+	agentRequestDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "nextai_agent_request_duration_seconds",
+		Help:    "Duration of /agent/process requests.",
+		Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+	})
+	toolInvocationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "nextai_tool_invocations_total",
+		Help: "Total number of tool invocations by tool name.",
+	}, []string{"tool"})
+	cronExecutionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "nextai_cron_executions_total",
+		Help: "Total number of cron job executions by status.",
+	}, []string{"status"})
+	channelDispatchFailuresTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "nextai_channel_dispatch_failures_total",
+		Help: "Total number of failed channel dispatches by channel.",
+	}, []string{"channel"})
+)
+
+// MetricsHandler serves the default Prometheus registry.
+func MetricsHandler() http.HandlerFunc {
+	return promhttp.Handler().ServeHTTP
+}
+
+// ObserveAgentRequest counts one agent request and records how long it took.
+func ObserveAgentRequest(duration time.Duration) {
+	agentRequestsTotal.Inc()
+	agentRequestDuration.Observe(duration.Seconds())
+}
+
+func IncToolInvocation(name string) {
+	toolInvocationsTotal.WithLabelValues(metricLabel(name)).Inc()
+}
+
+func IncCronExecution(status string) {
+	cronExecutionsTotal.WithLabelValues(metricLabel(status)).Inc()
+}
+
+func IncChannelDispatchFailure(channel string) {
+	channelDispatchFailuresTotal.WithLabelValues(metricLabel(channel)).Inc()
+}
+
+func metricLabel(value string) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return "unknown"
+	}
+	return value
+}
@@ -0,0 +1,118 @@
+package observability
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	rateLimitCleanupInterval = time.Minute
+	rateLimitIdleTTL         = 10 * time.Minute
+)
+
+// RateLimiter is an in-memory token bucket per key. Each bucket holds up to
+// rpm tokens and refills at rpm per minute; idle buckets are dropped by a
+// background sweep until Close is called.
+type RateLimiter struct {
+	rpm     int
+	now     func() time.Time
+	mu      sync.Mutex
+	buckets map[string]*rateLimitBucket
+	stop    chan struct{}
+	once    sync.Once
+}
+
+type rateLimitBucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+func NewRateLimiter(rpm int) *RateLimiter {
+	l := &RateLimiter{
+		rpm:     rpm,
+		now:     time.Now,
+		buckets: map[string]*rateLimitBucket{},
+		stop:    make(chan struct{}),
+	}
+	go l.cleanupLoop()
+	return l
+}
+
+// Allow consumes one token for key. Empty keys and non-positive limits are never throttled.
+func (l *RateLimiter) Allow(key string) bool {
+	key = strings.TrimSpace(key)
+	if l == nil || l.rpm <= 0 || key == "" {
+		return true
+	}
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &rateLimitBucket{tokens: float64(l.rpm), lastSeen: now}
+		l.buckets[key] = bucket
+	}
+	elapsed := now.Sub(bucket.lastSeen)
+	if elapsed > 0 {
+		bucket.tokens += elapsed.Minutes() * float64(l.rpm)
+		if bucket.tokens > float64(l.rpm) {
+			bucket.tokens = float64(l.rpm)
+		}
+	}
+	bucket.lastSeen = now
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+func (l *RateLimiter) Close() {
+	if l == nil {
+		return
+	}
+	l.once.Do(func() { close(l.stop) })
+}
+
+func (l *RateLimiter) cleanupLoop() {
+	ticker := time.NewTicker(rateLimitCleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			l.evictIdle()
+		}
+	}
+}
+
+func (l *RateLimiter) evictIdle() {
+	cutoff := l.now().Add(-rateLimitIdleTTL)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, bucket := range l.buckets {
+		if bucket.lastSeen.Before(cutoff) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// RateLimit throttles requests per key(r). Requests over the limit are passed
+// to onLimited instead of next, so callers control the error body.
+func RateLimit(limiter *RateLimiter, key func(*http.Request) string, onLimited http.HandlerFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if limiter == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !limiter.Allow(key(r)) {
+				onLimited(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
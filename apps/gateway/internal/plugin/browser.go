@@ -2,11 +2,13 @@ package plugin
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -15,6 +17,21 @@ const (
 	browserToolDefaultTimeout = 120 * time.Second
 	browserToolMaxTimeout     = 600 * time.Second
 	browserToolMaxOutputBytes = 32 * 1024
+	// browserToolMaxScreenshotBytes caps screenshots inlined as base64; larger
+	// files are reported by path only.
+	browserToolMaxScreenshotBytes = 1 << 20
+
+	// browserToolWaitDelay bounds how long Wait blocks on output pipes after the
+	// agent is killed; Playwright children can otherwise keep them open.
+	browserToolWaitDelay = 2 * time.Second
+
+	// browserResultHeader starts the block where agent.js prints the model's
+	// final text; lines after it are not trusted as screenshot reports.
+	browserResultHeader = "=== 任务结果 ==="
+	browserShotsDirName = "shots"
+
+	browserToolTimeoutEnv        = "NEXTAI_BROWSER_TOOL_TIMEOUT"
+	browserToolMaxOutputBytesEnv = "NEXTAI_BROWSER_TOOL_MAX_OUTPUT_BYTES"
 )
 
 var (
@@ -24,7 +41,7 @@ var (
 	ErrBrowserToolTaskMissing      = errors.New("browser_tool_task_missing")
 )
 
-type browserToolRunFunc func(ctx context.Context, agentDir, task string, timeout time.Duration) (string, int, error)
+type browserToolRunFunc func(ctx context.Context, agentDir, task string, timeout time.Duration, maxOutputBytes int) (string, int, error)
 
 type browserTaskItem struct {
 	Task    string
@@ -41,6 +58,9 @@ type browserInvocationResult struct {
 	LogPath    string `json:"log_path,omitempty"`
 	ShotsPath  string `json:"shots_path,omitempty"`
 	Text       string `json:"text"`
+	// ScreenshotPath is the last screenshot the agent reported taking.
+	ScreenshotPath   string `json:"screenshot_path,omitempty"`
+	ScreenshotBase64 string `json:"screenshot_base64,omitempty"`
 }
 
 type browserBatchResult struct {
@@ -51,21 +71,47 @@ type browserBatchResult struct {
 }
 
 type BrowserTool struct {
-	agentDir string
-	runFn    browserToolRunFunc
+	agentDir       string
+	defaultTimeout time.Duration
+	maxOutputBytes int
+	runFn          browserToolRunFunc
 }
 
+// NewBrowserTool reads the item default timeout (NEXTAI_BROWSER_TOOL_TIMEOUT,
+// seconds) and output cap (NEXTAI_BROWSER_TOOL_MAX_OUTPUT_BYTES) from the env.
 func NewBrowserTool(agentDir string) (*BrowserTool, error) {
 	resolved, err := resolveBrowserAgentDir(agentDir)
 	if err != nil {
 		return nil, err
 	}
+	defaultTimeout := browserToolDefaultTimeout
+	if seconds, ok := parseEnvPositiveInt(browserToolTimeoutEnv); ok {
+		defaultTimeout = clampBrowserTimeout(time.Duration(seconds) * time.Second)
+	}
+	maxOutputBytes := browserToolMaxOutputBytes
+	if limit, ok := parseEnvPositiveInt(browserToolMaxOutputBytesEnv); ok {
+		maxOutputBytes = limit
+	}
 	return &BrowserTool{
-		agentDir: resolved,
-		runFn:    runBrowserToolCommand,
+		agentDir:       resolved,
+		defaultTimeout: defaultTimeout,
+		maxOutputBytes: maxOutputBytes,
+		runFn:          runBrowserToolCommand,
 	}, nil
 }
 
+func parseEnvPositiveInt(key string) (int, bool) {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return 0, false
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil || value <= 0 {
+		return 0, false
+	}
+	return value, true
+}
+
 func resolveBrowserAgentDir(agentDir string) (string, error) {
 	trimmed := strings.TrimSpace(agentDir)
 	if trimmed == "" {
@@ -91,7 +137,7 @@ func (t *BrowserTool) Name() string {
 }
 
 func (t *BrowserTool) Invoke(command ToolCommand) (ToolResult, error) {
-	items, err := parseBrowserItems(command)
+	items, err := parseBrowserItems(command, t.defaultTimeout)
 	if err != nil {
 		return ToolResult{}, err
 	}
@@ -129,7 +175,8 @@ func (t *BrowserTool) Invoke(command ToolCommand) (ToolResult, error) {
 
 func (t *BrowserTool) invokeOne(item browserTaskItem) (browserInvocationResult, error) {
 	startedAt := time.Now()
-	output, exitCode, err := t.runFn(context.Background(), t.agentDir, item.Task, item.Timeout)
+	output, exitCode, err := t.runFn(context.Background(), t.agentDir, item.Task, item.Timeout, t.maxOutputBytes)
+	output = truncateOutput(output, t.maxOutputBytes)
 	ok := err == nil
 
 	result := browserInvocationResult{
@@ -151,10 +198,16 @@ func (t *BrowserTool) invokeOne(item browserTaskItem) (browserInvocationResult,
 	if shotsPath := meta["shots"]; shotsPath != "" {
 		result.ShotsPath = shotsPath
 	}
+	if screenshotPath := meta["screenshot"]; screenshotPath != "" {
+		if data, ok := readBrowserScreenshot(t.agentDir, screenshotPath); ok {
+			result.ScreenshotPath = screenshotPath
+			result.ScreenshotBase64 = data
+		}
+	}
 	return result, nil
 }
 
-func parseBrowserItems(command ToolCommand) ([]browserTaskItem, error) {
+func parseBrowserItems(command ToolCommand, defaultTimeout time.Duration) ([]browserTaskItem, error) {
 	if len(command.Items) == 0 {
 		return nil, ErrBrowserToolItemsInvalid
 	}
@@ -170,35 +223,70 @@ func parseBrowserItems(command ToolCommand) ([]browserTaskItem, error) {
 		}
 		out = append(out, browserTaskItem{
 			Task:    task,
-			Timeout: parseBrowserTimeout(item.TimeoutSeconds),
+			Timeout: parseBrowserTimeout(item.TimeoutSeconds, defaultTimeout),
 		})
 	}
 	return out, nil
 }
 
-func parseBrowserTimeout(rawSeconds int) time.Duration {
-	seconds := int64(browserToolDefaultTimeout / time.Second)
-	if rawSeconds > 0 {
-		seconds = int64(rawSeconds)
+func parseBrowserTimeout(rawSeconds int, defaultTimeout time.Duration) time.Duration {
+	if rawSeconds <= 0 {
+		if defaultTimeout <= 0 {
+			return browserToolDefaultTimeout
+		}
+		return clampBrowserTimeout(defaultTimeout)
+	}
+	return clampBrowserTimeout(time.Duration(rawSeconds) * time.Second)
+}
+
+func clampBrowserTimeout(timeout time.Duration) time.Duration {
+	if timeout > browserToolMaxTimeout {
+		return browserToolMaxTimeout
 	}
-	if seconds <= 0 {
-		seconds = int64(browserToolDefaultTimeout / time.Second)
+	return timeout
+}
+
+// browserOutputBuffer keeps the first limit bytes written and drops the rest, so
+// a chatty agent cannot grow gateway memory without bound.
+type browserOutputBuffer struct {
+	buf       []byte
+	limit     int
+	truncated bool
+}
+
+func (b *browserOutputBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - len(b.buf); room > 0 {
+		if len(p) > room {
+			b.buf = append(b.buf, p[:room]...)
+			b.truncated = true
+		} else {
+			b.buf = append(b.buf, p...)
+		}
+	} else if len(p) > 0 {
+		b.truncated = true
 	}
-	maxSeconds := int64(browserToolMaxTimeout / time.Second)
-	if seconds > maxSeconds {
-		seconds = maxSeconds
+	return len(p), nil
+}
+
+func (b *browserOutputBuffer) String() string {
+	if b.truncated {
+		return string(b.buf) + "\n... (output truncated)"
 	}
-	return time.Duration(seconds) * time.Second
+	return string(b.buf)
 }
 
-func runBrowserToolCommand(ctx context.Context, agentDir, task string, timeout time.Duration) (string, int, error) {
+func runBrowserToolCommand(ctx context.Context, agentDir, task string, timeout time.Duration, maxOutputBytes int) (string, int, error) {
 	cmdCtx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
 	cmd := exec.CommandContext(cmdCtx, "node", "agent.js", task)
 	cmd.Dir = agentDir
-	outputBytes, err := cmd.CombinedOutput()
-	output := truncateOutput(string(outputBytes), browserToolMaxOutputBytes)
+	cmd.WaitDelay = browserToolWaitDelay
+	outputBuf := &browserOutputBuffer{limit: maxOutputBytes}
+	cmd.Stdout = outputBuf
+	cmd.Stderr = outputBuf
+	err := cmd.Run()
+	output := outputBuf.String()
 	if err != nil {
 		if errors.Is(cmdCtx.Err(), context.DeadlineExceeded) {
 			return output, 124, cmdCtx.Err()
@@ -212,22 +300,63 @@ func runBrowserToolCommand(ctx context.Context, agentDir, task string, timeout t
 	return output, 0, nil
 }
 
+// extractBrowserRunMeta reads the lines agent.js prints about its run. A
+// screenshot line only counts before the result block, since the model's final
+// text there could name any file.
 func extractBrowserRunMeta(output string) map[string]string {
 	meta := map[string]string{}
+	inResult := false
 	for _, line := range strings.Split(output, "\n") {
 		trimmed := strings.TrimSpace(line)
 		switch {
+		case trimmed == browserResultHeader:
+			inResult = true
 		case strings.HasPrefix(trimmed, "run_id:"):
 			meta["run_id"] = strings.TrimSpace(strings.TrimPrefix(trimmed, "run_id:"))
 		case strings.HasPrefix(trimmed, "log:"):
 			meta["log"] = strings.TrimSpace(strings.TrimPrefix(trimmed, "log:"))
 		case strings.HasPrefix(trimmed, "shots:"):
 			meta["shots"] = strings.TrimSpace(strings.TrimPrefix(trimmed, "shots:"))
+		case strings.HasPrefix(trimmed, "screenshot:") && !inResult:
+			meta["screenshot"] = strings.TrimSpace(strings.TrimPrefix(trimmed, "screenshot:"))
 		}
 	}
 	return meta
 }
 
+// readBrowserScreenshot base64-encodes a screenshot the agent wrote. It
+// reports false when the file is missing or resolves, through symlinks too,
+// outside the agent's shots directory; a file over
+// browserToolMaxScreenshotBytes is kept but not inlined.
+func readBrowserScreenshot(agentDir, screenshotPath string) (string, bool) {
+	if !filepath.IsAbs(screenshotPath) {
+		screenshotPath = filepath.Join(agentDir, screenshotPath)
+	}
+	shotsDir, err := filepath.EvalSymlinks(filepath.Join(agentDir, browserShotsDirName))
+	if err != nil {
+		return "", false
+	}
+	resolved, err := filepath.EvalSymlinks(screenshotPath)
+	if err != nil {
+		return "", false
+	}
+	if rel, err := filepath.Rel(shotsDir, resolved); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	info, err := os.Stat(resolved)
+	if err != nil || info.IsDir() {
+		return "", false
+	}
+	if info.Size() > browserToolMaxScreenshotBytes {
+		return "", true
+	}
+	data, err := os.ReadFile(resolved)
+	if err != nil {
+		return "", false
+	}
+	return base64.StdEncoding.EncodeToString(data), true
+}
+
 func formatBrowserToolText(task string, ok bool, exitCode int, output string) string {
 	trimmed := strings.TrimSpace(output)
 	if ok {
@@ -4,7 +4,9 @@ import (
 	"context"
 	"errors"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -26,7 +28,7 @@ func TestBrowserToolInvokeParsesRunMeta(t *testing.T) {
 	if err != nil {
 		t.Fatalf("new browser tool failed: %v", err)
 	}
-	tool.runFn = func(_ context.Context, _ string, task string, _ time.Duration) (string, int, error) {
+	tool.runFn = func(_ context.Context, _ string, task string, _ time.Duration, _ int) (string, int, error) {
 		if task != "打开 bing 搜索 nextai" {
 			t.Fatalf("unexpected task: %q", task)
 		}
@@ -59,6 +61,92 @@ func TestBrowserToolInvokeParsesRunMeta(t *testing.T) {
 	}
 }
 
+func TestBrowserToolInvokeInlinesLastScreenshot(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "agent.js"), []byte(""), 0o644); err != nil {
+		t.Fatalf("seed agent.js failed: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "shots"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "shots", "final.png"), []byte("png-bytes"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tool, err := NewBrowserTool(dir)
+	if err != nil {
+		t.Fatalf("new browser tool failed: %v", err)
+	}
+	tool.runFn = func(context.Context, string, string, time.Duration, int) (string, int, error) {
+		return "screenshot: shots/missing.png\nscreenshot: shots/final.png\n\n=== 任务结果 ===\n完成\n", 0, nil
+	}
+
+	out, invokeErr := tool.Invoke(ToolCommand{Items: []ToolCommandItem{{Task: "截图"}}})
+	if invokeErr != nil {
+		t.Fatalf("invoke failed: %v", invokeErr)
+	}
+	result, err := out.ToMap()
+	if err != nil {
+		t.Fatalf("convert result failed: %v", err)
+	}
+	if got, _ := result["screenshot_path"].(string); got != "shots/final.png" {
+		t.Fatalf("unexpected screenshot_path: %q", got)
+	}
+	if got, _ := result["screenshot_base64"].(string); got != "cG5nLWJ5dGVz" {
+		t.Fatalf("unexpected screenshot_base64: %q", got)
+	}
+}
+
+func TestBrowserToolInvokeOnlyInlinesScreenshotsFromShotsDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "agent.js"), []byte(""), 0o644); err != nil {
+		t.Fatalf("seed agent.js failed: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "shots"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	secret := filepath.Join(dir, ".env")
+	if err := os.WriteFile(secret, []byte("API_KEY=sk-secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(secret, filepath.Join(dir, "shots", "link.png")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "shots", "final.png"), []byte("png-bytes"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tool, err := NewBrowserTool(dir)
+	if err != nil {
+		t.Fatalf("new browser tool failed: %v", err)
+	}
+	cases := map[string]string{
+		"outside shots":       "screenshot: " + secret + "\n",
+		"parent traversal":    "screenshot: shots/../.env\n",
+		"symlink out":         "screenshot: shots/link.png\n",
+		"inside result block": "=== 任务结果 ===\nscreenshot: shots/final.png\n",
+	}
+	for name, output := range cases {
+		tool.runFn = func(context.Context, string, string, time.Duration, int) (string, int, error) {
+			return output, 0, nil
+		}
+		out, invokeErr := tool.Invoke(ToolCommand{Items: []ToolCommandItem{{Task: "截图"}}})
+		if invokeErr != nil {
+			t.Fatalf("%s: invoke failed: %v", name, invokeErr)
+		}
+		result, err := out.ToMap()
+		if err != nil {
+			t.Fatalf("%s: convert result failed: %v", name, err)
+		}
+		if got, _ := result["screenshot_base64"].(string); got != "" {
+			t.Fatalf("%s: screenshot must not be inlined, got=%q", name, got)
+		}
+		if got, _ := result["screenshot_path"].(string); got != "" {
+			t.Fatalf("%s: screenshot path must not be reported, got=%q", name, got)
+		}
+	}
+}
+
 func TestBrowserToolInvokeRejectsMissingTask(t *testing.T) {
 	dir := t.TempDir()
 	if err := os.WriteFile(filepath.Join(dir, "agent.js"), []byte(""), 0o644); err != nil {
@@ -79,3 +167,47 @@ func TestBrowserToolInvokeRejectsMissingTask(t *testing.T) {
 		t.Fatalf("expected ErrBrowserToolTaskMissing, got=%v", invokeErr)
 	}
 }
+
+func TestBrowserToolAppliesEnvTimeoutAndOutputCap(t *testing.T) {
+	if _, err := exec.LookPath("node"); err != nil {
+		t.Skip("node is not installed")
+	}
+	dir := t.TempDir()
+	script := "process.stdout.write('x'.repeat(4096));\nsetInterval(() => {}, 1000);\n"
+	if err := os.WriteFile(filepath.Join(dir, "agent.js"), []byte(script), 0o644); err != nil {
+		t.Fatalf("seed agent.js failed: %v", err)
+	}
+	t.Setenv(browserToolTimeoutEnv, "1")
+	t.Setenv(browserToolMaxOutputBytesEnv, "64")
+
+	tool, err := NewBrowserTool(dir)
+	if err != nil {
+		t.Fatalf("new browser tool failed: %v", err)
+	}
+	startedAt := time.Now()
+	out, invokeErr := tool.Invoke(ToolCommand{
+		Items: []ToolCommandItem{
+			{Task: "hang forever"},
+		},
+	})
+	if invokeErr != nil {
+		t.Fatalf("invoke failed: %v", invokeErr)
+	}
+	if elapsed := time.Since(startedAt); elapsed > 10*time.Second {
+		t.Fatalf("expected the agent to be killed after the default timeout, took %s", elapsed)
+	}
+	result, err := out.ToMap()
+	if err != nil {
+		t.Fatalf("convert result failed: %v", err)
+	}
+	if ok, _ := result["ok"].(bool); ok {
+		t.Fatalf("expected ok=false after timeout, got=%#v", result)
+	}
+	if got, _ := result["exit_code"].(float64); got != 124 {
+		t.Fatalf("expected exit_code=124, got=%#v", result["exit_code"])
+	}
+	output, _ := result["output"].(string)
+	if !strings.HasPrefix(output, strings.Repeat("x", 64)+"\n... (output truncated)") || strings.Count(output, "x") != 64 {
+		t.Fatalf("expected output capped at 64 bytes, got=%q", output)
+	}
+}
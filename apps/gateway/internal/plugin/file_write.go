@@ -0,0 +1,183 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	ErrWriteFileToolFileExists = errors.New("write_file_tool_file_exists")
+	ErrWriteFileToolPathIsDir  = errors.New("write_file_tool_path_is_dir")
+	// ErrWriteFileToolDuplicatePath rejects a batch that names one file twice,
+	// whose later item would be checked against a file the batch has not
+	// written yet.
+	ErrWriteFileToolDuplicatePath = errors.New("write_file_tool_duplicate_path")
+)
+
+// WriteFileTool creates a file or replaces its whole content, unlike
+// EditFileLinesTool which splices line ranges.
+type WriteFileTool struct {
+}
+
+type writeFileResult struct {
+	OK      bool   `json:"ok"`
+	Path    string `json:"path"`
+	Created bool   `json:"created"`
+	Bytes   int    `json:"bytes"`
+	Lines   int    `json:"lines"`
+	Text    string `json:"text"`
+}
+
+type writeFileBatchResult struct {
+	OK      bool              `json:"ok"`
+	Count   int               `json:"count"`
+	Results []writeFileResult `json:"results"`
+	Text    string            `json:"text"`
+}
+
+func NewWriteFileTool() *WriteFileTool {
+	return &WriteFileTool{}
+}
+
+func (t *WriteFileTool) Name() string {
+	return "write"
+}
+
+// Invoke checks every item before writing any of them, so an invalid path,
+// missing content or create_only conflict anywhere in the batch leaves the
+// disk untouched. A write that still fails midway names the files already
+// written.
+func (t *WriteFileTool) Invoke(command ToolCommand) (ToolResult, error) {
+	items, err := parseInvocationItems(command)
+	if err != nil {
+		return ToolResult{}, err
+	}
+	plans := make([]writeFilePlan, 0, len(items))
+	seen := map[string]struct{}{}
+	for _, item := range items {
+		plan, planErr := prepareWrite(item)
+		if planErr != nil {
+			return ToolResult{}, planErr
+		}
+		if _, dup := seen[plan.absPath]; dup {
+			return ToolResult{}, fmt.Errorf("%w: %s", ErrWriteFileToolDuplicatePath, plan.relPath)
+		}
+		seen[plan.absPath] = struct{}{}
+		plans = append(plans, plan)
+	}
+
+	results := make([]writeFileResult, 0, len(plans))
+	for _, plan := range plans {
+		writeResult, writeErr := plan.write()
+		if writeErr != nil {
+			if len(results) > 0 {
+				written := make([]string, 0, len(results))
+				for _, done := range results {
+					written = append(written, done.Path)
+				}
+				return ToolResult{}, fmt.Errorf("%w (already written: %s)", writeErr, strings.Join(written, ", "))
+			}
+			return ToolResult{}, writeErr
+		}
+		results = append(results, writeResult)
+	}
+	if len(results) == 1 {
+		return NewToolResult(results[0]), nil
+	}
+
+	textBlocks := make([]string, 0, len(results))
+	for _, item := range results {
+		if text := strings.TrimSpace(item.Text); text != "" {
+			textBlocks = append(textBlocks, text)
+		}
+	}
+	return NewToolResult(writeFileBatchResult{
+		OK:      true,
+		Count:   len(results),
+		Results: results,
+		Text:    strings.Join(textBlocks, "\n"),
+	}), nil
+}
+
+// writeFilePlan is one validated item of a write batch.
+type writeFilePlan struct {
+	relPath    string
+	absPath    string
+	content    string
+	perm       os.FileMode
+	created    bool
+	createOnly bool
+}
+
+func prepareWrite(input ToolCommandItem) (writeFilePlan, error) {
+	relPath, absPath, err := resolveFileLinesPath(input)
+	if err != nil {
+		return writeFilePlan{}, err
+	}
+	if input.Content == nil {
+		return writeFilePlan{}, ErrFileLinesToolContentMissing
+	}
+	plan := writeFilePlan{
+		relPath:    relPath,
+		absPath:    absPath,
+		content:    *input.Content,
+		perm:       0o644,
+		created:    true,
+		createOnly: input.CreateOnly,
+	}
+	info, statErr := os.Stat(absPath)
+	switch {
+	case statErr == nil && info.IsDir():
+		return writeFilePlan{}, fmt.Errorf("%w: %s", ErrWriteFileToolPathIsDir, relPath)
+	case statErr == nil && input.CreateOnly:
+		return writeFilePlan{}, fmt.Errorf("%w: %s", ErrWriteFileToolFileExists, relPath)
+	case statErr == nil:
+		plan.perm = info.Mode().Perm()
+		plan.created = false
+	case !os.IsNotExist(statErr):
+		return writeFilePlan{}, fmt.Errorf("%w: %v", ErrFileLinesToolFileRead, statErr)
+	}
+	return plan, nil
+}
+
+func (p writeFilePlan) write() (writeFileResult, error) {
+	if err := os.MkdirAll(filepath.Dir(p.absPath), 0o755); err != nil {
+		return writeFileResult{}, fmt.Errorf("%w: %v", ErrFileLinesToolFileWrite, err)
+	}
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if p.createOnly {
+		// O_EXCL closes the window between the stat in prepareWrite and the write.
+		flags = os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	}
+	file, err := os.OpenFile(p.absPath, flags, p.perm)
+	if err != nil {
+		if os.IsExist(err) {
+			return writeFileResult{}, fmt.Errorf("%w: %s", ErrWriteFileToolFileExists, p.relPath)
+		}
+		return writeFileResult{}, fmt.Errorf("%w: %v", ErrFileLinesToolFileWrite, err)
+	}
+	if _, err := file.WriteString(p.content); err != nil {
+		file.Close()
+		return writeFileResult{}, fmt.Errorf("%w: %v", ErrFileLinesToolFileWrite, err)
+	}
+	if err := file.Close(); err != nil {
+		return writeFileResult{}, fmt.Errorf("%w: %v", ErrFileLinesToolFileWrite, err)
+	}
+
+	lines, _ := splitFileLines(p.content)
+	action := "overwrote"
+	if p.created {
+		action = "created"
+	}
+	return writeFileResult{
+		OK:      true,
+		Path:    p.relPath,
+		Created: p.created,
+		Bytes:   len(p.content),
+		Lines:   len(lines),
+		Text:    fmt.Sprintf("write %s %s (%d line(s), %d bytes).", p.relPath, action, len(lines), len(p.content)),
+	}, nil
+}
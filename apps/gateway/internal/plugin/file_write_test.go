@@ -0,0 +1,103 @@
+package plugin
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileToolCreatesAndOverwritesFiles(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "nested", "main.go")
+	tool := NewWriteFileTool()
+	content := "package main\n\nfunc main() {}\n"
+
+	out, err := tool.Invoke(ToolCommand{Items: []ToolCommandItem{{Path: target, Content: &content, CreateOnly: true}}})
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	result, err := out.ToMap()
+	if err != nil {
+		t.Fatalf("convert result failed: %v", err)
+	}
+	if result["created"] != true || result["lines"] != float64(3) {
+		t.Fatalf("unexpected create result: %#v", result)
+	}
+	if raw, _ := os.ReadFile(target); string(raw) != content {
+		t.Fatalf("unexpected file content: %q", raw)
+	}
+
+	replacement := "package main\n"
+	if _, err := tool.Invoke(ToolCommand{Items: []ToolCommandItem{{Path: target, Content: &replacement, CreateOnly: true}}}); !errors.Is(err, ErrWriteFileToolFileExists) {
+		t.Fatalf("expected create_only to refuse overwrite, got=%v", err)
+	}
+	out, err = tool.Invoke(ToolCommand{Items: []ToolCommandItem{{Path: target, Content: &replacement}}})
+	if err != nil {
+		t.Fatalf("overwrite failed: %v", err)
+	}
+	result, _ = out.ToMap()
+	if result["created"] != false {
+		t.Fatalf("expected overwrite result, got=%#v", result)
+	}
+	if raw, _ := os.ReadFile(target); string(raw) != replacement {
+		t.Fatalf("unexpected file content after overwrite: %q", raw)
+	}
+}
+
+func TestWriteFileToolRejectsInvalidInput(t *testing.T) {
+	tool := NewWriteFileTool()
+	content := "x"
+	if _, err := tool.Invoke(ToolCommand{Items: []ToolCommandItem{{Path: "relative.txt", Content: &content}}}); !errors.Is(err, ErrFileLinesToolPathInvalid) {
+		t.Fatalf("expected relative path to be rejected, got=%v", err)
+	}
+	if _, err := tool.Invoke(ToolCommand{Items: []ToolCommandItem{{Path: filepath.Join(t.TempDir(), "a.txt")}}}); !errors.Is(err, ErrFileLinesToolContentMissing) {
+		t.Fatalf("expected missing content to be rejected, got=%v", err)
+	}
+	if _, err := tool.Invoke(ToolCommand{Items: []ToolCommandItem{{Path: t.TempDir(), Content: &content}}}); !errors.Is(err, ErrWriteFileToolPathIsDir) {
+		t.Fatalf("expected directory path to be rejected, got=%v", err)
+	}
+}
+
+func TestWriteFileToolValidatesWholeBatchBeforeWriting(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "existing.txt")
+	if err := os.WriteFile(existing, []byte("keep"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	first := filepath.Join(dir, "first.txt")
+	content := "new"
+	tool := NewWriteFileTool()
+
+	_, err := tool.Invoke(ToolCommand{Items: []ToolCommandItem{
+		{Path: first, Content: &content},
+		{Path: existing, Content: &content, CreateOnly: true},
+	}})
+	if !errors.Is(err, ErrWriteFileToolFileExists) {
+		t.Fatalf("expected create_only conflict, got=%v", err)
+	}
+	if _, statErr := os.Stat(first); !os.IsNotExist(statErr) {
+		t.Fatalf("expected no file written before the conflict was found, stat err=%v", statErr)
+	}
+
+	_, err = tool.Invoke(ToolCommand{Items: []ToolCommandItem{
+		{Path: first, Content: &content},
+		{Path: filepath.Join(dir, "missing-content.txt")},
+	}})
+	if !errors.Is(err, ErrFileLinesToolContentMissing) {
+		t.Fatalf("expected missing content error, got=%v", err)
+	}
+	if _, statErr := os.Stat(first); !os.IsNotExist(statErr) {
+		t.Fatalf("expected no file written before the invalid item was found, stat err=%v", statErr)
+	}
+
+	_, err = tool.Invoke(ToolCommand{Items: []ToolCommandItem{
+		{Path: first, Content: &content, CreateOnly: true},
+		{Path: first, Content: &content, CreateOnly: true},
+	}})
+	if !errors.Is(err, ErrWriteFileToolDuplicatePath) {
+		t.Fatalf("expected duplicate path error, got=%v", err)
+	}
+	if _, statErr := os.Stat(first); !os.IsNotExist(statErr) {
+		t.Fatalf("expected duplicate batch to write nothing, stat err=%v", statErr)
+	}
+}
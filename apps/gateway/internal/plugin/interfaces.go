@@ -14,6 +14,33 @@ var ErrToolCommandInvalid = errors.New("tool_command_invalid")
 type ChannelPlugin interface {
 	Name() string
 	SendText(ctx context.Context, userID, sessionID, text string, cfg map[string]interface{}) error
+	Capabilities() ChannelCapabilities
+}
+
+// ChannelCapabilities describes what a channel can deliver beyond plain text.
+// Dispatch features check it before using the matching optional interface.
+type ChannelCapabilities struct {
+	Media          bool `json:"media"`
+	Typing         bool `json:"typing"`
+	Reactions      bool `json:"reactions"`
+	Markdown       bool `json:"markdown"`
+	MessageEdit    bool `json:"message_edit"`
+	ReplyThreading bool `json:"reply_threading"`
+}
+
+// ChannelConfigValidator is implemented by channel plugins that need specific
+// config fields. RequiredConfig returns alternative field sets; filling any one
+// of them satisfies the channel.
+type ChannelConfigValidator interface {
+	RequiredConfig() [][]string
+	ValidateConfig(cfg map[string]interface{}) error
+}
+
+// ChannelTypingIndicator is implemented by channel plugins that can show the
+// end user that a reply is being prepared; they also report Typing in
+// Capabilities.
+type ChannelTypingIndicator interface {
+	SendTyping(ctx context.Context, userID, sessionID string, cfg map[string]interface{}) error
 }
 
 type ToolPlugin interface {
@@ -34,6 +61,9 @@ type ToolCommand struct {
 	ProcessID      int               `json:"process_id,omitempty"`
 	Chars          string            `json:"chars,omitempty"`
 	ShellMode      string            `json:"_nextai_shell_mode,omitempty"`
+	SessionMode    string            `json:"session_mode,omitempty"`
+	MaxOutputBytes int               `json:"max_output_bytes,omitempty"`
+	Tail           bool              `json:"tail,omitempty"`
 	legacyCommand  bool              `json:"-"`
 }
 
@@ -66,6 +96,11 @@ type ToolCommandItem struct {
 	Provider       string  `json:"provider,omitempty"`
 	Count          int     `json:"count,omitempty"`
 	Task           string  `json:"task,omitempty"`
+	MaxOutputBytes int     `json:"max_output_bytes,omitempty"`
+	Tail           bool    `json:"tail,omitempty"`
+	CreateOnly     bool    `json:"create_only,omitempty"`
+	Depth          int     `json:"depth,omitempty"`
+	Glob           string  `json:"glob,omitempty"`
 }
 
 type ToolResult struct {
@@ -117,6 +152,9 @@ func CommandFromMap(input map[string]interface{}) (ToolCommand, error) {
 	out.ProcessID = intFromAny(input["process_id"])
 	out.Chars = stringFromAny(input["chars"])
 	out.ShellMode = stringFromAny(input["_nextai_shell_mode"])
+	out.SessionMode = stringFromAny(input["session_mode"])
+	out.MaxOutputBytes = intFromAny(input["max_output_bytes"])
+	out.Tail = boolFromAny(input["tail"])
 
 	rawItems, hasItems := input["items"]
 	if !hasItems || rawItems == nil {
@@ -184,6 +222,11 @@ func commandItemFromMap(entry map[string]interface{}) ToolCommandItem {
 		Provider:       stringFromAny(entry["provider"]),
 		Count:          intFromAny(entry["count"]),
 		Task:           stringFromAny(entry["task"]),
+		MaxOutputBytes: intFromAny(entry["max_output_bytes"]),
+		Tail:           boolFromAny(entry["tail"]),
+		CreateOnly:     boolFromAny(entry["create_only"]),
+		Depth:          intFromAny(entry["depth"]),
+		Glob:           stringFromAny(entry["glob"]),
 	}
 	if rawContent, ok := entry["content"]; ok {
 		if value, ok := rawContent.(string); ok {
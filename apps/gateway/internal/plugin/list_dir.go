@@ -0,0 +1,197 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	listDirToolDefaultDepth = 1
+	listDirToolMaxDepth     = 5
+	listDirToolMaxEntries   = 1000
+)
+
+var (
+	ErrListDirToolItemsInvalid = errors.New("list_dir_tool_items_invalid")
+	ErrListDirToolNotFound     = errors.New("list_dir_tool_not_found")
+	ErrListDirToolNotDir       = errors.New("list_dir_tool_not_dir")
+	ErrListDirToolDepthInvalid = errors.New("list_dir_tool_depth_invalid")
+	ErrListDirToolGlobInvalid  = errors.New("list_dir_tool_glob_invalid")
+	ErrListDirToolRead         = errors.New("list_dir_tool_read_failed")
+)
+
+// ListDirTool lists directory entries so agents can navigate files without
+// the shell tool.
+type ListDirTool struct{}
+
+type listDirEntry struct {
+	Path  string `json:"path"`
+	Name  string `json:"name"`
+	IsDir bool   `json:"is_dir"`
+	Size  int64  `json:"size"`
+}
+
+type listDirResult struct {
+	OK        bool           `json:"ok"`
+	Path      string         `json:"path"`
+	Depth     int            `json:"depth"`
+	Glob      string         `json:"glob,omitempty"`
+	Count     int            `json:"count"`
+	Truncated bool           `json:"truncated"`
+	Entries   []listDirEntry `json:"entries"`
+	Text      string         `json:"text"`
+}
+
+type listDirBatchResult struct {
+	OK      bool            `json:"ok"`
+	Count   int             `json:"count"`
+	Results []listDirResult `json:"results"`
+	Text    string          `json:"text"`
+}
+
+func NewListDirTool() *ListDirTool {
+	return &ListDirTool{}
+}
+
+func (t *ListDirTool) Name() string {
+	return "list_dir"
+}
+
+func (t *ListDirTool) Invoke(command ToolCommand) (ToolResult, error) {
+	if len(command.Items) == 0 {
+		return ToolResult{}, ErrListDirToolItemsInvalid
+	}
+	results := make([]listDirResult, 0, len(command.Items))
+	for _, item := range command.Items {
+		one, err := listDirOne(item)
+		if err != nil {
+			return ToolResult{}, err
+		}
+		results = append(results, one)
+	}
+	if len(results) == 1 {
+		return NewToolResult(results[0]), nil
+	}
+
+	texts := make([]string, 0, len(results))
+	for _, item := range results {
+		if text := strings.TrimSpace(item.Text); text != "" {
+			texts = append(texts, text)
+		}
+	}
+	return NewToolResult(listDirBatchResult{
+		OK:      true,
+		Count:   len(results),
+		Results: results,
+		Text:    strings.Join(texts, "\n\n"),
+	}), nil
+}
+
+func listDirOne(input ToolCommandItem) (listDirResult, error) {
+	root, err := normalizeAbsolutePath(input.Path)
+	if err != nil {
+		return listDirResult{}, err
+	}
+	depth := listDirToolDefaultDepth
+	if input.Depth != 0 {
+		depth = input.Depth
+	}
+	if depth < 1 || depth > listDirToolMaxDepth {
+		return listDirResult{}, fmt.Errorf("%w: depth must be between 1 and %d", ErrListDirToolDepthInvalid, listDirToolMaxDepth)
+	}
+	glob := strings.TrimSpace(input.Glob)
+	if glob != "" {
+		if _, err := path.Match(glob, ""); err != nil {
+			return listDirResult{}, fmt.Errorf("%w: %v", ErrListDirToolGlobInvalid, err)
+		}
+	}
+
+	info, err := os.Stat(root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return listDirResult{}, fmt.Errorf("%w: %s", ErrListDirToolNotFound, root)
+		}
+		return listDirResult{}, fmt.Errorf("%w: %v", ErrListDirToolRead, err)
+	}
+	if !info.IsDir() {
+		return listDirResult{}, fmt.Errorf("%w: %s", ErrListDirToolNotDir, root)
+	}
+
+	entries := []listDirEntry{}
+	truncated := false
+	var walk func(dir, rel string, level int) error
+	walk = func(dir, rel string, level int) error {
+		children, err := os.ReadDir(dir)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrListDirToolRead, err)
+		}
+		for _, child := range children {
+			if len(entries) >= listDirToolMaxEntries {
+				truncated = true
+				return nil
+			}
+			childRel := path.Join(rel, child.Name())
+			// Symlinked directories are listed but not descended into, so a
+			// link cannot lead the walk outside the requested tree.
+			isDir := child.IsDir()
+			if glob == "" || listDirGlobMatches(glob, child.Name(), childRel) {
+				entry := listDirEntry{Path: childRel, Name: child.Name(), IsDir: isDir}
+				if !isDir {
+					if childInfo, infoErr := child.Info(); infoErr == nil {
+						entry.Size = childInfo.Size()
+					}
+				}
+				entries = append(entries, entry)
+			}
+			if isDir && level < depth {
+				if err := walk(filepath.Join(dir, child.Name()), childRel, level+1); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := walk(root, "", 1); err != nil {
+		return listDirResult{}, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+
+	lines := make([]string, 0, len(entries)+2)
+	lines = append(lines, fmt.Sprintf("list_dir %s (depth=%d, %d entries)", root, depth, len(entries)))
+	for _, entry := range entries {
+		if entry.IsDir {
+			lines = append(lines, entry.Path+"/")
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s (%d bytes)", entry.Path, entry.Size))
+	}
+	if truncated {
+		lines = append(lines, fmt.Sprintf("... (truncated at %d entries)", listDirToolMaxEntries))
+	}
+	return listDirResult{
+		OK:        true,
+		Path:      root,
+		Depth:     depth,
+		Glob:      glob,
+		Count:     len(entries),
+		Truncated: truncated,
+		Entries:   entries,
+		Text:      strings.Join(lines, "\n"),
+	}, nil
+}
+
+// listDirGlobMatches matches a glob without a slash against the entry name and
+// one with a slash against the path relative to the listed directory.
+func listDirGlobMatches(glob, name, rel string) bool {
+	target := name
+	if strings.Contains(glob, "/") {
+		target = rel
+	}
+	matched, _ := path.Match(glob, target)
+	return matched
+}
@@ -0,0 +1,82 @@
+package plugin
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListDirToolListsEntriesWithDepthAndGlob(t *testing.T) {
+	root := t.TempDir()
+	mustWrite := func(rel, content string) {
+		t.Helper()
+		target := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			t.Fatalf("mkdir failed: %v", err)
+		}
+		if err := os.WriteFile(target, []byte(content), 0o644); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+	mustWrite("main.go", "package main\n")
+	mustWrite("README.md", "# readme\n")
+	mustWrite("pkg/util.go", "package pkg\n")
+
+	tool := NewListDirTool()
+	out, err := tool.Invoke(ToolCommand{Items: []ToolCommandItem{{Path: root}}})
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	result, _ := out.ToMap()
+	entries, _ := result["entries"].([]interface{})
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 top-level entries, got=%#v", result["entries"])
+	}
+	first, _ := entries[0].(map[string]interface{})
+	if first["name"] != "README.md" || first["is_dir"] != false || first["size"] != float64(9) {
+		t.Fatalf("unexpected first entry: %#v", first)
+	}
+	last, _ := entries[2].(map[string]interface{})
+	if last["name"] != "pkg" || last["is_dir"] != true {
+		t.Fatalf("unexpected directory entry: %#v", last)
+	}
+
+	out, err = tool.Invoke(ToolCommand{Items: []ToolCommandItem{{Path: root, Depth: 2, Glob: "*.go"}}})
+	if err != nil {
+		t.Fatalf("recursive list failed: %v", err)
+	}
+	result, _ = out.ToMap()
+	entries, _ = result["entries"].([]interface{})
+	got := []string{}
+	for _, raw := range entries {
+		entry, _ := raw.(map[string]interface{})
+		got = append(got, stringFromAny(entry["path"]))
+	}
+	if len(got) != 2 || got[0] != "main.go" || got[1] != "pkg/util.go" {
+		t.Fatalf("unexpected recursive glob entries: %#v", got)
+	}
+}
+
+func TestListDirToolRejectsInvalidInput(t *testing.T) {
+	tool := NewListDirTool()
+	file := filepath.Join(t.TempDir(), "a.txt")
+	if err := os.WriteFile(file, []byte("a"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	cases := []struct {
+		item ToolCommandItem
+		want error
+	}{
+		{ToolCommandItem{Path: "relative"}, ErrFileLinesToolPathInvalid},
+		{ToolCommandItem{Path: filepath.Join(t.TempDir(), "missing")}, ErrListDirToolNotFound},
+		{ToolCommandItem{Path: file}, ErrListDirToolNotDir},
+		{ToolCommandItem{Path: t.TempDir(), Depth: listDirToolMaxDepth + 1}, ErrListDirToolDepthInvalid},
+		{ToolCommandItem{Path: t.TempDir(), Glob: "["}, ErrListDirToolGlobInvalid},
+	}
+	for _, tc := range cases {
+		if _, err := tool.Invoke(ToolCommand{Items: []ToolCommandItem{tc.item}}); !errors.Is(err, tc.want) {
+			t.Fatalf("item %+v: expected %v, got=%v", tc.item, tc.want, err)
+		}
+	}
+}
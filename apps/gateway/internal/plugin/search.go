@@ -6,10 +6,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"html"
 	"io"
 	"net/http"
 	"net/url"
 	"os"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
@@ -26,6 +28,9 @@ const (
 	searchProviderSerpAPI = "serpapi"
 	searchProviderTavily  = "tavily"
 	searchProviderBrave   = "brave"
+	// searchProviderDuckDuckGo needs no API key, so it is available even
+	// when no keyed provider is configured.
+	searchProviderDuckDuckGo = "duckduckgo"
 
 	searchDefaultProviderEnv = "NEXTAI_SEARCH_DEFAULT_PROVIDER"
 
@@ -36,9 +41,15 @@ const (
 	searchBraveKeyEnv    = "NEXTAI_SEARCH_BRAVE_KEY"
 	searchBraveBaseEnv   = "NEXTAI_SEARCH_BRAVE_BASE_URL"
 
+	searchDuckDuckGoDisabledEnv = "NEXTAI_SEARCH_DUCKDUCKGO_DISABLED"
+	searchDuckDuckGoBaseEnv     = "NEXTAI_SEARCH_DUCKDUCKGO_BASE_URL"
+
 	searchSerpAPIDefaultURL = "https://serpapi.com/search.json"
 	searchTavilyDefaultURL  = "https://api.tavily.com/search"
 	searchBraveDefaultURL   = "https://api.search.brave.com/res/v1/web/search"
+	// The HTML endpoint serves plain result markup without JavaScript.
+	searchDuckDuckGoDefaultURL = "https://html.duckduckgo.com/html/"
+	searchDuckDuckGoUserAgent  = "Mozilla/5.0 (compatible; NextAI/1.0)"
 )
 
 var (
@@ -53,6 +64,7 @@ type SearchTool struct {
 	defaultProvider string
 	providers       map[string]searchProviderConfig
 	httpClient      *http.Client
+	cache           *searchCache
 }
 
 type searchProviderConfig struct {
@@ -82,6 +94,7 @@ type searchInvocationResult struct {
 	Count      int            `json:"count"`
 	Total      int            `json:"total,omitempty"`
 	Results    []searchResult `json:"results,omitempty"`
+	Cached     bool           `json:"cached,omitempty"`
 	DurationMS int64          `json:"duration_ms"`
 	Error      string         `json:"error,omitempty"`
 	Text       string         `json:"text"`
@@ -105,6 +118,13 @@ func NewSearchToolFromEnv() (*SearchTool, error) {
 	if cfg, ok := searchProviderFromEnv(searchProviderBrave, searchBraveKeyEnv, searchBraveBaseEnv, searchBraveDefaultURL); ok {
 		providers[cfg.Name] = cfg
 	}
+	if disabled, _ := strconv.ParseBool(strings.TrimSpace(os.Getenv(searchDuckDuckGoDisabledEnv))); !disabled {
+		baseURL := strings.TrimSpace(os.Getenv(searchDuckDuckGoBaseEnv))
+		if baseURL == "" {
+			baseURL = searchDuckDuckGoDefaultURL
+		}
+		providers[searchProviderDuckDuckGo] = searchProviderConfig{Name: searchProviderDuckDuckGo, BaseURL: baseURL}
+	}
 	if len(providers) == 0 {
 		return nil, ErrSearchToolProvidersMissing
 	}
@@ -124,6 +144,7 @@ func NewSearchToolFromEnv() (*SearchTool, error) {
 		defaultProvider: defaultProvider,
 		providers:       providers,
 		httpClient:      &http.Client{},
+		cache:           newSearchCacheFromEnv(),
 	}, nil
 }
 
@@ -181,6 +202,20 @@ func (t *SearchTool) invokeOne(item searchItem) (searchInvocationResult, error)
 		return searchInvocationResult{}, fmt.Errorf("%w: %s", ErrSearchToolProviderUnconfigured, providerName)
 	}
 
+	cacheKey := searchCacheKey(providerName, item.Query, item.Count)
+	if cached, ok := t.cache.get(cacheKey); ok {
+		return searchInvocationResult{
+			OK:       true,
+			Provider: providerName,
+			Query:    item.Query,
+			Count:    item.Count,
+			Total:    len(cached),
+			Results:  cached,
+			Cached:   true,
+			Text:     formatSearchSuccessText(providerName, item.Query, cached) + "\n(cached)",
+		}, nil
+	}
+
 	startedAt := time.Now()
 	ctx, cancel := context.WithTimeout(context.Background(), item.Timeout)
 	defer cancel()
@@ -200,6 +235,7 @@ func (t *SearchTool) invokeOne(item searchItem) (searchInvocationResult, error)
 		}, nil
 	}
 
+	t.cache.put(cacheKey, searchResults)
 	return searchInvocationResult{
 		OK:         true,
 		Provider:   providerName,
@@ -220,6 +256,8 @@ func (t *SearchTool) searchWithProvider(ctx context.Context, provider searchProv
 		return t.searchTavily(ctx, provider, query, count)
 	case searchProviderBrave:
 		return t.searchBrave(ctx, provider, query, count)
+	case searchProviderDuckDuckGo:
+		return t.searchDuckDuckGo(ctx, provider, query, count)
 	default:
 		return nil, fmt.Errorf("%w: %s", ErrSearchToolProviderUnsupported, provider.Name)
 	}
@@ -370,6 +408,105 @@ func (t *SearchTool) searchBrave(ctx context.Context, provider searchProviderCon
 	return results, nil
 }
 
+var (
+	duckDuckGoAnchorPattern = regexp.MustCompile(`(?is)<a\b([^>]*)>(.*?)</a>`)
+	duckDuckGoClassPattern  = regexp.MustCompile(`(?i)\bclass="([^"]*)"`)
+	duckDuckGoHrefPattern   = regexp.MustCompile(`(?i)\bhref="([^"]*)"`)
+	duckDuckGoTagPattern    = regexp.MustCompile(`<[^>]+>`)
+)
+
+// searchDuckDuckGo scrapes the keyless HTML endpoint. Each result is a
+// result__a title link followed by a result__snippet link; ads are skipped.
+func (t *SearchTool) searchDuckDuckGo(ctx context.Context, provider searchProviderConfig, query string, count int) ([]searchResult, error) {
+	endpoint, err := url.Parse(provider.BaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("duckduckgo invalid base url: %w", err)
+	}
+	params := endpoint.Query()
+	params.Set("q", query)
+	endpoint.RawQuery = params.Encode()
+
+	headers := map[string]string{
+		"Accept":     "text/html",
+		"User-Agent": searchDuckDuckGoUserAgent,
+	}
+	body, status, reqErr := t.sendRequest(ctx, http.MethodGet, endpoint.String(), headers, nil)
+	if reqErr != nil {
+		return nil, fmt.Errorf("duckduckgo request failed: %w", formatSearchAPIError(status, body, reqErr))
+	}
+
+	results := make([]searchResult, 0, count)
+	pendingSnippet := false
+	for _, match := range duckDuckGoAnchorPattern.FindAllStringSubmatch(string(body), -1) {
+		attrs, inner := match[1], match[2]
+		class := ""
+		if classMatch := duckDuckGoClassPattern.FindStringSubmatch(attrs); classMatch != nil {
+			class = classMatch[1]
+		}
+		switch {
+		case hasHTMLClass(class, "result__a"):
+			if len(results) >= count {
+				return results, nil
+			}
+			href := ""
+			if hrefMatch := duckDuckGoHrefPattern.FindStringSubmatch(attrs); hrefMatch != nil {
+				href = html.UnescapeString(hrefMatch[1])
+			}
+			link, ok := decodeDuckDuckGoLink(href)
+			title := duckDuckGoText(inner)
+			pendingSnippet = ok && (title != "" || link != "")
+			if !pendingSnippet {
+				continue
+			}
+			results = append(results, searchResult{
+				Title:  title,
+				URL:    link,
+				Source: searchProviderDuckDuckGo,
+			})
+		case hasHTMLClass(class, "result__snippet") && pendingSnippet:
+			results[len(results)-1].Snippet = duckDuckGoText(inner)
+			pendingSnippet = false
+		}
+	}
+	return results, nil
+}
+
+// decodeDuckDuckGoLink unwraps the /l/?uddg= redirect DuckDuckGo puts on
+// result links. Ad links (y.js) report false.
+func decodeDuckDuckGoLink(href string) (string, bool) {
+	href = strings.TrimSpace(href)
+	if strings.HasPrefix(href, "//") {
+		href = "https:" + href
+	}
+	parsed, err := url.Parse(href)
+	if err != nil || href == "" {
+		return "", false
+	}
+	if strings.HasSuffix(parsed.Host, "duckduckgo.com") {
+		if strings.HasPrefix(parsed.Path, "/y.js") {
+			return "", false
+		}
+		if target := strings.TrimSpace(parsed.Query().Get("uddg")); target != "" {
+			return target, true
+		}
+	}
+	return href, true
+}
+
+func duckDuckGoText(raw string) string {
+	text := html.UnescapeString(duckDuckGoTagPattern.ReplaceAllString(raw, ""))
+	return strings.Join(strings.Fields(text), " ")
+}
+
+func hasHTMLClass(classAttr, name string) bool {
+	for _, class := range strings.Fields(classAttr) {
+		if class == name {
+			return true
+		}
+	}
+	return false
+}
+
 func (t *SearchTool) sendRequest(ctx context.Context, method, endpoint string, headers map[string]string, body map[string]interface{}) ([]byte, int, error) {
 	var bodyReader io.Reader
 	if body != nil {
@@ -534,7 +671,7 @@ func coalesceSearchText(value, fallback string) string {
 }
 
 func pickDefaultSearchProvider(providers map[string]searchProviderConfig) string {
-	preferred := []string{searchProviderSerpAPI, searchProviderTavily, searchProviderBrave}
+	preferred := []string{searchProviderSerpAPI, searchProviderTavily, searchProviderBrave, searchProviderDuckDuckGo}
 	for _, name := range preferred {
 		if _, ok := providers[name]; ok {
 			return name
@@ -553,7 +690,7 @@ func pickDefaultSearchProvider(providers map[string]searchProviderConfig) string
 
 func isSupportedSearchProvider(name string) bool {
 	switch strings.ToLower(strings.TrimSpace(name)) {
-	case searchProviderSerpAPI, searchProviderTavily, searchProviderBrave:
+	case searchProviderSerpAPI, searchProviderTavily, searchProviderBrave, searchProviderDuckDuckGo:
 		return true
 	default:
 		return false
@@ -0,0 +1,104 @@
+package plugin
+
+import (
+	"container/list"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	searchCacheTTLEnv       = "NEXTAI_SEARCH_CACHE_TTL"
+	searchCacheDefaultTTL   = 5 * time.Minute
+	searchCacheMaxEntries   = 256
+	searchCacheKeySeparator = "\x00"
+)
+
+// searchCache is an LRU of successful search results keyed by provider, query
+// and count. Entries older than ttl are treated as misses.
+type searchCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	max     int
+	order   *list.List
+	entries map[string]*list.Element
+	now     func() time.Time
+}
+
+type searchCacheEntry struct {
+	key      string
+	results  []searchResult
+	storedAt time.Time
+}
+
+// newSearchCacheFromEnv reads NEXTAI_SEARCH_CACHE_TTL as a Go duration
+// ("90s", "5m") or whole seconds. Zero or a negative value disables caching;
+// an unparsable value keeps the default.
+func newSearchCacheFromEnv() *searchCache {
+	ttl := searchCacheDefaultTTL
+	if raw := strings.TrimSpace(os.Getenv(searchCacheTTLEnv)); raw != "" {
+		if seconds, err := strconv.Atoi(raw); err == nil {
+			ttl = time.Duration(seconds) * time.Second
+		} else if parsed, err := time.ParseDuration(raw); err == nil {
+			ttl = parsed
+		}
+	}
+	if ttl <= 0 {
+		return nil
+	}
+	return &searchCache{
+		ttl:     ttl,
+		max:     searchCacheMaxEntries,
+		order:   list.New(),
+		entries: map[string]*list.Element{},
+		now:     time.Now,
+	}
+}
+
+func searchCacheKey(provider, query string, count int) string {
+	return strings.Join([]string{provider, query, strconv.Itoa(count)}, searchCacheKeySeparator)
+}
+
+func (c *searchCache) get(key string) ([]searchResult, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*searchCacheEntry)
+	if c.now().Sub(entry.storedAt) > c.ttl {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return append([]searchResult(nil), entry.results...), true
+}
+
+func (c *searchCache) put(key string, results []searchResult) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stored := append([]searchResult(nil), results...)
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*searchCacheEntry)
+		entry.results = stored
+		entry.storedAt = c.now()
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&searchCacheEntry{key: key, results: stored, storedAt: c.now()})
+	for c.order.Len() > c.max {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*searchCacheEntry).key)
+	}
+}
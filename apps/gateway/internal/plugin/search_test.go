@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func clearSearchEnvVars(t *testing.T) {
@@ -16,10 +17,14 @@ func clearSearchEnvVars(t *testing.T) {
 	t.Setenv(searchBraveKeyEnv, "")
 	t.Setenv(searchBraveBaseEnv, "")
 	t.Setenv(searchDefaultProviderEnv, "")
+	t.Setenv(searchDuckDuckGoDisabledEnv, "")
+	t.Setenv(searchDuckDuckGoBaseEnv, "")
+	t.Setenv(searchCacheTTLEnv, "")
 }
 
 func TestNewSearchToolFromEnvRequiresProvider(t *testing.T) {
 	clearSearchEnvVars(t)
+	t.Setenv(searchDuckDuckGoDisabledEnv, "true")
 	_, err := NewSearchToolFromEnv()
 	if !errors.Is(err, ErrSearchToolProvidersMissing) {
 		t.Fatalf("expected ErrSearchToolProvidersMissing, got=%v", err)
@@ -151,10 +156,132 @@ func TestSearchToolRejectsInvalidInput(t *testing.T) {
 
 	_, invokeErr = tool.Invoke(ToolCommand{
 		Items: []ToolCommandItem{
-			{Query: "nextai", Provider: "duckduckgo"},
+			{Query: "nextai", Provider: "bing"},
 		},
 	})
 	if !errors.Is(invokeErr, ErrSearchToolProviderUnsupported) {
 		t.Fatalf("expected ErrSearchToolProviderUnsupported, got=%v", invokeErr)
 	}
 }
+
+func TestSearchToolInvokeDuckDuckGoWithoutKeys(t *testing.T) {
+	clearSearchEnvVars(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("q"); got != "nextai" {
+			t.Fatalf("unexpected query: %q", got)
+		}
+		if r.Header.Get("User-Agent") == "" {
+			t.Fatalf("expected a user agent")
+		}
+		_, _ = w.Write([]byte(`<div class="result result--ad"><a rel="nofollow" class="result__a" href="https://duckduckgo.com/y.js?ad_domain=ads.example">Ad</a>
+<a class="result__snippet" href="https://duckduckgo.com/y.js">ad snippet</a></div>
+<div class="result"><h2 class="result__title"><a rel="nofollow" class="result__a" href="//duckduckgo.com/l/?uddg=https%3A%2F%2Fexample.com%2Fnextai&amp;rut=abc">Next<b>AI</b> &amp; friends</a></h2>
+<a class="result__snippet" href="//duckduckgo.com/l/?uddg=https%3A%2F%2Fexample.com%2Fnextai">A <b>gateway</b> project</a></div>
+<div class="result"><a rel="nofollow" class="result__a" href="https://example.org/second">Second</a></div>`))
+	}))
+	defer server.Close()
+
+	t.Setenv(searchDuckDuckGoBaseEnv, server.URL+"/html/")
+	tool, err := NewSearchToolFromEnv()
+	if err != nil {
+		t.Fatalf("new search tool failed: %v", err)
+	}
+	if tool.defaultProvider != searchProviderDuckDuckGo {
+		t.Fatalf("expected duckduckgo as default provider, got=%q", tool.defaultProvider)
+	}
+
+	out, invokeErr := tool.Invoke(ToolCommand{Items: []ToolCommandItem{{Query: "nextai", Count: 5}}})
+	if invokeErr != nil {
+		t.Fatalf("invoke failed: %v", invokeErr)
+	}
+	result, err := out.ToMap()
+	if err != nil {
+		t.Fatalf("convert result failed: %v", err)
+	}
+	raw, _ := json.Marshal(result["results"])
+	var got []searchResult
+	if err := json.Unmarshal(raw, &got); err != nil {
+		t.Fatalf("decode results failed: %v", err)
+	}
+	want := []searchResult{
+		{Title: "NextAI & friends", URL: "https://example.com/nextai", Snippet: "A gateway project", Source: searchProviderDuckDuckGo},
+		{Title: "Second", URL: "https://example.org/second", Source: searchProviderDuckDuckGo},
+	}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("unexpected results: %s", raw)
+	}
+}
+
+func TestSearchToolCachesResultsWithinTTL(t *testing.T) {
+	clearSearchEnvVars(t)
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		_, _ = w.Write([]byte(`{"web":{"results":[{"title":"NextAI","url":"https://example.com","description":"desc"}]}}`))
+	}))
+	defer server.Close()
+
+	t.Setenv(searchBraveKeyEnv, "brave-key")
+	t.Setenv(searchBraveBaseEnv, server.URL)
+	t.Setenv(searchCacheTTLEnv, "1m")
+	tool, err := NewSearchToolFromEnv()
+	if err != nil {
+		t.Fatalf("new search tool failed: %v", err)
+	}
+	now := time.Now()
+	tool.cache.now = func() time.Time { return now }
+
+	invoke := func(item ToolCommandItem) map[string]interface{} {
+		t.Helper()
+		out, invokeErr := tool.Invoke(ToolCommand{Items: []ToolCommandItem{item}})
+		if invokeErr != nil {
+			t.Fatalf("invoke failed: %v", invokeErr)
+		}
+		result, err := out.ToMap()
+		if err != nil {
+			t.Fatalf("convert result failed: %v", err)
+		}
+		return result
+	}
+
+	if first := invoke(ToolCommandItem{Query: "nextai", Count: 3}); first["cached"] != nil {
+		t.Fatalf("expected first search to miss the cache, got=%#v", first)
+	}
+	second := invoke(ToolCommandItem{Query: "nextai", Count: 3})
+	if second["cached"] != true || second["total"] != float64(1) || hits != 1 {
+		t.Fatalf("expected cached result without a second request, hits=%d result=%#v", hits, second)
+	}
+	invoke(ToolCommandItem{Query: "nextai", Count: 4})
+	if hits != 2 {
+		t.Fatalf("expected a different count to miss the cache, hits=%d", hits)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if expired := invoke(ToolCommandItem{Query: "nextai", Count: 3}); expired["cached"] != nil || hits != 3 {
+		t.Fatalf("expected expired entry to be refetched, hits=%d result=%#v", hits, expired)
+	}
+}
+
+func TestSearchCacheEvictsLeastRecentlyUsedAndCanBeDisabled(t *testing.T) {
+	t.Setenv(searchCacheTTLEnv, "0")
+	if cache := newSearchCacheFromEnv(); cache != nil {
+		t.Fatalf("expected TTL 0 to disable caching")
+	}
+
+	t.Setenv(searchCacheTTLEnv, "60")
+	cache := newSearchCacheFromEnv()
+	if cache == nil || cache.ttl != time.Minute {
+		t.Fatalf("expected 60 seconds TTL, got=%#v", cache)
+	}
+	cache.max = 2
+	cache.put("a", []searchResult{{Title: "a"}})
+	cache.put("b", []searchResult{{Title: "b"}})
+	cache.get("a")
+	cache.put("c", []searchResult{{Title: "c"}})
+	if _, ok := cache.get("b"); ok {
+		t.Fatalf("expected least recently used entry to be evicted")
+	}
+	if _, ok := cache.get("a"); !ok {
+		t.Fatalf("expected recently used entry to stay cached")
+	}
+}
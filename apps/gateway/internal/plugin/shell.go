@@ -2,14 +2,18 @@ package plugin
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"os/exec"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 )
 
 const (
@@ -23,6 +27,11 @@ const (
 	shellToolMaxOutputBytes = 16 * 1024
 	shellToolMaxSessions    = 32
 	shellToolSessionIdleTTL = 10 * time.Minute
+
+	// shellToolMaxOutputBytesCap bounds a per-item max_output_bytes so a
+	// single call cannot ask for unbounded output.
+	shellToolMaxOutputBytesCap = 1 << 20
+	shellToolMaxOutputBytesEnv = "NEXTAI_SHELL_TOOL_MAX_OUTPUT_BYTES"
 )
 
 var (
@@ -34,6 +43,16 @@ var (
 	ErrShellToolStdinUnsupported    = errors.New("shell_tool_stdin_unsupported")
 	ErrShellToolSessionLimitReached = errors.New("shell_tool_session_limit_reached")
 	ErrShellToolEscalationDenied    = errors.New("shell_tool_escalation_denied")
+	ErrShellToolSessionModeInvalid  = errors.New("shell_tool_session_mode_invalid")
+	ErrShellToolCommandBlocked      = errors.New("shell_tool_command_blocked")
+	ErrShellToolPathOutsideRoot     = errors.New("shell_tool_path_outside_root")
+)
+
+// Session modes for legacy items: fresh runs every item in its own shell,
+// persistent runs all items in one shell so variables and cwd carry over.
+const (
+	shellSessionModeFresh      = "fresh"
+	shellSessionModePersistent = "persistent"
 )
 
 type shellMode string
@@ -45,9 +64,12 @@ const (
 )
 
 type ShellTool struct {
-	mu            sync.Mutex
-	sessions      map[int]*shellSession
-	nextSessionID int
+	mu             sync.Mutex
+	sessions       map[int]*shellSession
+	nextSessionID  int
+	policy         shellCommandPolicy
+	root           shellRoot
+	maxOutputBytes int
 }
 
 type shellSession struct {
@@ -93,23 +115,56 @@ type shellSessionResult struct {
 }
 
 type shellExecRequest struct {
-	Command string
-	Cwd     string
-	Yield   time.Duration
-	TTY     bool
+	Command        string
+	Cwd            string
+	Yield          time.Duration
+	TTY            bool
+	MaxOutputBytes int
+	Tail           bool
 }
 
 type shellWriteRequest struct {
-	SessionID int
-	Input     string
-	Yield     time.Duration
+	SessionID      int
+	Input          string
+	Yield          time.Duration
+	MaxOutputBytes int
+	Tail           bool
+}
+
+// shellOutputLimit bounds the output kept for one command; Tail keeps the
+// last MaxBytes instead of the first.
+type shellOutputLimit struct {
+	MaxBytes int
+	Tail     bool
 }
 
+// NewShellTool reads the command allow/deny lists (NEXTAI_SHELL_ALLOW,
+// NEXTAI_SHELL_DENY) and the default output cap
+// (NEXTAI_SHELL_TOOL_MAX_OUTPUT_BYTES) from the env.
 func NewShellTool() *ShellTool {
+	maxOutputBytes := shellToolMaxOutputBytes
+	if limit, ok := parseEnvPositiveInt(shellToolMaxOutputBytesEnv); ok {
+		maxOutputBytes = min(limit, shellToolMaxOutputBytesCap)
+	}
 	return &ShellTool{
-		sessions:      map[int]*shellSession{},
-		nextSessionID: 1000,
+		sessions:       map[int]*shellSession{},
+		nextSessionID:  1000,
+		policy:         loadShellCommandPolicy(),
+		root:           loadShellRoot(),
+		maxOutputBytes: maxOutputBytes,
+	}
+}
+
+// outputLimit resolves an item's max_output_bytes against the tool default.
+func (t *ShellTool) outputLimit(maxBytes int, tail bool) shellOutputLimit {
+	limit := t.maxOutputBytes
+	if limit <= 0 {
+		limit = shellToolMaxOutputBytes
+	}
+	if maxBytes > 0 {
+		limit = min(maxBytes, shellToolMaxOutputBytesCap)
 	}
+	return shellOutputLimit{MaxBytes: limit, Tail: tail}
 }
 
 func (t *ShellTool) Name() string {
@@ -125,6 +180,15 @@ func (t *ShellTool) Invoke(command ToolCommand) (ToolResult, error) {
 		if err != nil {
 			return ToolResult{}, err
 		}
+		if err := t.policy.check(req.Command); err != nil {
+			return ToolResult{}, err
+		}
+		if req.Cwd, err = t.root.cwd(req.Cwd, true); err != nil {
+			return ToolResult{}, err
+		}
+		if err := t.root.checkCommand(req.Command, req.Cwd); err != nil {
+			return ToolResult{}, err
+		}
 		result, err := t.invokeSessionExec(req)
 		if err != nil {
 			return ToolResult{}, err
@@ -135,6 +199,21 @@ func (t *ShellTool) Invoke(command ToolCommand) (ToolResult, error) {
 		if err != nil {
 			return ToolResult{}, err
 		}
+		// A tty session is a shell in its own right, so each line typed into
+		// it must pass the same policy as a command.
+		if t.policy.active() {
+			for _, line := range strings.Split(req.Input, "\n") {
+				if line = normalizeShellCommandText(line); line == "" {
+					continue
+				}
+				if err := t.policy.check(line); err != nil {
+					return ToolResult{}, err
+				}
+			}
+		}
+		if err := t.root.checkCommand(req.Input, ""); err != nil {
+			return ToolResult{}, err
+		}
 		result, err := t.invokeSessionWrite(req)
 		if err != nil {
 			return ToolResult{}, err
@@ -145,17 +224,48 @@ func (t *ShellTool) Invoke(command ToolCommand) (ToolResult, error) {
 		if err != nil {
 			return ToolResult{}, err
 		}
+		sessionMode, err := parseShellSessionMode(command.SessionMode)
+		if err != nil {
+			return ToolResult{}, err
+		}
+		for index := range items {
+			text := normalizeShellCommandText(items[index].Command)
+			if text != "" {
+				if err := t.policy.check(text); err != nil {
+					return ToolResult{}, err
+				}
+			}
+			// Persistent items after the first keep the previous item's
+			// directory unless they name one, so only the first defaults
+			// to the root.
+			fallback := index == 0 || sessionMode != shellSessionModePersistent
+			if items[index].Cwd, err = t.root.cwd(items[index].Cwd, fallback); err != nil {
+				return ToolResult{}, err
+			}
+			if err := t.root.checkCommand(text, items[index].Cwd); err != nil {
+				return ToolResult{}, err
+			}
+		}
 		results := make([]shellSingleResult, 0, len(items))
-		allOK := true
-		for _, item := range items {
-			one, oneErr := t.invokeOne(item)
-			if oneErr != nil {
-				return ToolResult{}, oneErr
+		if sessionMode == shellSessionModePersistent {
+			results, err = t.invokePersistent(items)
+			if err != nil {
+				return ToolResult{}, err
+			}
+		} else {
+			for _, item := range items {
+				one, oneErr := t.invokeOne(item)
+				if oneErr != nil {
+					return ToolResult{}, oneErr
+				}
+				results = append(results, one)
 			}
+		}
+		allOK := true
+		for _, one := range results {
 			if !one.OK {
 				allOK = false
 			}
-			results = append(results, one)
 		}
 		if len(results) == 1 {
 			return NewToolResult(results[0]), nil
@@ -181,7 +291,7 @@ func (t *ShellTool) invokeSessionExec(req shellExecRequest) (shellSessionResult,
 		return shellSessionResult{}, err
 	}
 
-	output := t.collectOutput(session, req.Yield)
+	output := t.collectOutput(session, req.Yield, t.outputLimit(req.MaxOutputBytes, req.Tail))
 	exited, exitCode := session.state()
 
 	result := shellSessionResult{
@@ -216,7 +326,7 @@ func (t *ShellTool) invokeSessionWrite(req shellWriteRequest) (shellSessionResul
 		}
 	}
 
-	output := t.collectOutput(session, req.Yield)
+	output := t.collectOutput(session, req.Yield, t.outputLimit(req.MaxOutputBytes, req.Tail))
 	exited, exitCode := session.state()
 
 	result := shellSessionResult{
@@ -333,7 +443,7 @@ func (t *ShellTool) captureSessionOutput(session *shellSession, reader io.Reader
 	}
 }
 
-func (t *ShellTool) collectOutput(session *shellSession, waitFor time.Duration) string {
+func (t *ShellTool) collectOutput(session *shellSession, waitFor time.Duration, limit shellOutputLimit) string {
 	if session == nil {
 		return ""
 	}
@@ -341,13 +451,13 @@ func (t *ShellTool) collectOutput(session *shellSession, waitFor time.Duration)
 	for {
 		raw := session.drainOutput()
 		if len(raw) > 0 {
-			return truncateOutput(string(raw), shellToolMaxOutputBytes)
+			return truncateShellOutput(string(raw), limit)
 		}
 		exited, _ := session.state()
 		if exited {
 			raw = session.drainOutput()
 			if len(raw) > 0 {
-				return truncateOutput(string(raw), shellToolMaxOutputBytes)
+				return truncateShellOutput(string(raw), limit)
 			}
 			return ""
 		}
@@ -495,7 +605,7 @@ func (s *shellSession) expired(now time.Time, ttl time.Duration) bool {
 }
 
 func (t *ShellTool) invokeOne(input ToolCommandItem) (shellSingleResult, error) {
-	command := strings.TrimSpace(input.Command)
+	command := normalizeShellCommandText(input.Command)
 	if command == "" {
 		return shellSingleResult{}, ErrShellToolCommandMissing
 	}
@@ -508,14 +618,14 @@ func (t *ShellTool) invokeOne(input ToolCommandItem) (shellSingleResult, error)
 	if resolveErr != nil {
 		return shellSingleResult{}, resolveErr
 	}
-	args := append(append([]string{}, baseArgs...), command)
+	args := append(append([]string{}, baseArgs...), shellScriptText(command))
 	cmd := exec.CommandContext(ctx, program, args...)
 	if cwd := strings.TrimSpace(input.Cwd); cwd != "" {
 		cmd.Dir = cwd
 	}
 
 	outputBytes, err := cmd.CombinedOutput()
-	output := truncateOutput(string(outputBytes), shellToolMaxOutputBytes)
+	output := truncateShellOutput(string(outputBytes), t.outputLimit(input.MaxOutputBytes, input.Tail))
 	ok := err == nil
 	exitCode := 0
 
@@ -541,6 +651,142 @@ func (t *ShellTool) invokeOne(input ToolCommandItem) (shellSingleResult, error)
 	}, nil
 }
 
+// invokePersistent runs all items in a single shell process, one after the
+// other, so state such as variables and the working directory carries over.
+// Each item is followed by a marker line carrying its exit status, which is
+// used to split the combined output back into per-item results.
+func (t *ShellTool) invokePersistent(items []ToolCommandItem) ([]shellSingleResult, error) {
+	program, baseArgs, resolveErr := resolveShellExecutor(runtime.GOOS, exec.LookPath)
+	if resolveErr != nil {
+		return nil, resolveErr
+	}
+	if program != "sh" && program != "bash" {
+		return nil, ErrShellToolSessionModeInvalid
+	}
+	marker, err := newShellItemMarker()
+	if err != nil {
+		return nil, err
+	}
+
+	commands := make([]string, 0, len(items))
+	var script strings.Builder
+	timeout := time.Duration(0)
+	for index, item := range items {
+		command := normalizeShellCommandText(item.Command)
+		if command == "" {
+			return nil, ErrShellToolCommandMissing
+		}
+		commands = append(commands, command)
+		if cwd := strings.TrimSpace(item.Cwd); cwd != "" && index > 0 {
+			script.WriteString("cd " + shellQuote(cwd) + "\n")
+		}
+		script.WriteString(command + "\n")
+		fmt.Fprintf(&script, "printf '\\n%s%d:%%d\\n' \"$?\"\n", marker, index)
+		timeout += parseShellTimeout(item.TimeoutSeconds)
+	}
+	if timeout > shellToolMaxTimeout {
+		timeout = shellToolMaxTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	args := append(append([]string{}, baseArgs...), script.String())
+	cmd := exec.CommandContext(ctx, program, args...)
+	if cwd := strings.TrimSpace(items[0].Cwd); cwd != "" {
+		cmd.Dir = cwd
+	}
+	outputBytes, runErr := cmd.CombinedOutput()
+	shellExitCode := 0
+	if runErr != nil {
+		var exitErr *exec.ExitError
+		switch {
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			shellExitCode = 124
+		case errors.As(runErr, &exitErr):
+			shellExitCode = exitErr.ExitCode()
+		default:
+			shellExitCode = -1
+		}
+	}
+
+	results := make([]shellSingleResult, 0, len(items))
+	rest := string(outputBytes)
+	for index, command := range commands {
+		exitCode := shellExitCode
+		output := ""
+		token := fmt.Sprintf("\n%s%d:", marker, index)
+		if pos := strings.Index(rest, token); pos >= 0 {
+			output = rest[:pos]
+			rest = rest[pos+len(token):]
+			statusLine := rest
+			if newline := strings.IndexByte(rest, '\n'); newline >= 0 {
+				statusLine = rest[:newline]
+				rest = rest[newline+1:]
+			} else {
+				rest = ""
+			}
+			if parsed, parseErr := strconv.Atoi(strings.TrimSpace(statusLine)); parseErr == nil {
+				exitCode = parsed
+			}
+		} else {
+			// The shell exited (or timed out) before reaching this item's marker.
+			output = rest
+			rest = ""
+			if exitCode == 0 {
+				exitCode = -1
+			}
+		}
+		output = truncateShellOutput(output, t.outputLimit(items[index].MaxOutputBytes, items[index].Tail))
+		ok := exitCode == 0
+		results = append(results, shellSingleResult{
+			OK:       ok,
+			Command:  command,
+			ExitCode: exitCode,
+			Output:   output,
+			Text:     formatShellText(command, ok, exitCode, output),
+		})
+	}
+	return results, nil
+}
+
+func newShellItemMarker() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "__NEXTAI_ITEM_" + hex.EncodeToString(buf) + "_", nil
+}
+
+// normalizeShellCommandText keeps the newlines of multi-line commands and
+// heredocs intact; only CRLF line endings and surrounding blanks are dropped.
+func normalizeShellCommandText(raw string) string {
+	return strings.TrimSpace(strings.ReplaceAll(raw, "\r\n", "\n"))
+}
+
+// shellScriptText terminates multi-line commands with a newline so a heredoc
+// delimiter on the last line is recognised by the shell.
+func shellScriptText(command string) string {
+	if strings.Contains(command, "\n") {
+		return command + "\n"
+	}
+	return command
+}
+
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+func parseShellSessionMode(raw string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(raw)) {
+	case "", shellSessionModeFresh:
+		return shellSessionModeFresh, nil
+	case shellSessionModePersistent:
+		return shellSessionModePersistent, nil
+	default:
+		return "", ErrShellToolSessionModeInvalid
+	}
+}
+
 func detectShellMode(command ToolCommand) shellMode {
 	if mode := normalizeShellMode(command.ShellMode); mode != shellModeLegacy {
 		return mode
@@ -615,10 +861,12 @@ func parseShellExecRequest(command ToolCommand) (shellExecRequest, error) {
 		shellToolDefaultYield,
 	)
 	return shellExecRequest{
-		Command: strings.TrimSpace(cmdText),
-		Cwd:     strings.TrimSpace(cwd),
-		Yield:   yield,
-		TTY:     item.TTY || command.TTY,
+		Command:        strings.TrimSpace(cmdText),
+		Cwd:            strings.TrimSpace(cwd),
+		Yield:          yield,
+		TTY:            item.TTY || command.TTY,
+		MaxOutputBytes: firstPositiveInt(item.MaxOutputBytes, command.MaxOutputBytes),
+		Tail:           item.Tail || command.Tail,
 	}, nil
 }
 
@@ -646,9 +894,11 @@ func parseShellWriteRequest(command ToolCommand) (shellWriteRequest, error) {
 		shellToolDefaultWriteYield,
 	)
 	return shellWriteRequest{
-		SessionID: sessionID,
-		Input:     input,
-		Yield:     yield,
+		SessionID:      sessionID,
+		Input:          input,
+		Yield:          yield,
+		MaxOutputBytes: firstPositiveInt(item.MaxOutputBytes, command.MaxOutputBytes),
+		Tail:           item.Tail || command.Tail,
 	}, nil
 }
 
@@ -660,6 +910,8 @@ func parseShellItems(command ToolCommand) ([]ToolCommandItem, error) {
 					Command:        command.Command,
 					Cwd:            command.Cwd,
 					TimeoutSeconds: command.TimeoutSeconds,
+					MaxOutputBytes: command.MaxOutputBytes,
+					Tail:           command.Tail,
 				},
 			}, nil
 		}
@@ -718,6 +970,29 @@ func truncateOutput(raw string, maxBytes int) string {
 	return raw[:maxBytes] + "\n... (output truncated)"
 }
 
+// truncateShellOutput keeps the first (or, in tail mode, the last)
+// limit.MaxBytes of raw, cut on a UTF-8 boundary, and says how much was
+// dropped.
+func truncateShellOutput(raw string, limit shellOutputLimit) string {
+	if limit.MaxBytes <= 0 || len(raw) <= limit.MaxBytes {
+		return raw
+	}
+	if limit.Tail {
+		start := len(raw) - limit.MaxBytes
+		for start < len(raw) && !utf8.RuneStart(raw[start]) {
+			start++
+		}
+		kept := raw[start:]
+		return fmt.Sprintf("... (output truncated: showing last %d of %d bytes)\n", len(kept), len(raw)) + kept
+	}
+	end := limit.MaxBytes
+	for end > 0 && !utf8.RuneStart(raw[end]) {
+		end--
+	}
+	kept := raw[:end]
+	return kept + fmt.Sprintf("\n... (output truncated: showing first %d of %d bytes)", len(kept), len(raw))
+}
+
 func formatShellText(command string, ok bool, exitCode int, output string) string {
 	trimmed := strings.TrimSpace(output)
 	if ok {
@@ -0,0 +1,108 @@
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	shellToolAllowEnv = "NEXTAI_SHELL_ALLOW"
+	shellToolDenyEnv  = "NEXTAI_SHELL_DENY"
+)
+
+// shellAllowListChainTokens chain, background, substitute or redirect
+// commands. With an allow list configured they are refused outright, since a
+// pattern written for one command would otherwise let whatever follows it run
+// too, or let a read-only command write files. "&" also covers "&&", and ">"
+// covers ">>".
+var shellAllowListChainTokens = []string{"$(", "`", ";", "&", "|", "\n", ">", "<("}
+
+// shellCommandPolicy restricts which commands the shell tool runs. Deny
+// patterns are matched against each line and each chained command, and allow
+// patterns against the whole command text, so operators anchor them with ^
+// and $ to pin a command down. The zero value allows everything.
+type shellCommandPolicy struct {
+	allow    []*regexp.Regexp
+	allowSet bool
+	deny     []*regexp.Regexp
+	// invalid names a pattern that failed to compile; the policy then
+	// blocks every command rather than silently enforcing less.
+	invalid string
+}
+
+// loadShellCommandPolicy reads comma-separated regex lists from
+// NEXTAI_SHELL_ALLOW and NEXTAI_SHELL_DENY. Write a literal comma as \x2c.
+func loadShellCommandPolicy() shellCommandPolicy {
+	policy := shellCommandPolicy{}
+	policy.allow, policy.allowSet = policy.compile(os.Getenv(shellToolAllowEnv))
+	policy.deny, _ = policy.compile(os.Getenv(shellToolDenyEnv))
+	return policy
+}
+
+func (p *shellCommandPolicy) compile(raw string) ([]*regexp.Regexp, bool) {
+	var out []*regexp.Regexp
+	set := false
+	for _, entry := range strings.Split(raw, ",") {
+		pattern := strings.TrimSpace(entry)
+		if pattern == "" {
+			continue
+		}
+		set = true
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			if p.invalid == "" {
+				p.invalid = pattern
+			}
+			continue
+		}
+		out = append(out, re)
+	}
+	return out, set
+}
+
+// check returns ErrShellToolCommandBlocked when any line or chained command
+// of command matches a deny pattern or, with an allow list configured, when
+// command chains several commands or matches none of the list.
+func (p shellCommandPolicy) check(command string) error {
+	if p.invalid != "" {
+		return fmt.Errorf("%w: invalid policy pattern %q", ErrShellToolCommandBlocked, p.invalid)
+	}
+	for _, candidate := range shellDenyCandidates(command) {
+		for _, re := range p.deny {
+			if re.MatchString(candidate) {
+				return fmt.Errorf("%w: command matches %s pattern %q", ErrShellToolCommandBlocked, shellToolDenyEnv, re.String())
+			}
+		}
+	}
+	if !p.allowSet {
+		return nil
+	}
+	for _, token := range shellAllowListChainTokens {
+		if strings.Contains(command, token) {
+			return fmt.Errorf("%w: %s does not allow chained commands or redirects (%q)", ErrShellToolCommandBlocked, shellToolAllowEnv, token)
+		}
+	}
+	for _, re := range p.allow {
+		if re.MatchString(command) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: command matches no %s pattern", ErrShellToolCommandBlocked, shellToolAllowEnv)
+}
+
+// shellDenyCandidates lists every line of command plus each command it
+// chains, substitutes or backgrounds, so an anchored deny pattern also
+// catches "echo ok; rm -rf /" and "echo `rm -rf /`".
+func shellDenyCandidates(command string) []string {
+	candidates := strings.Split(command, "\n")
+	for _, segment := range splitShellSegments(strings.ReplaceAll(command, "`", "\n")) {
+		candidates = append(candidates, strings.Join(segment, " "))
+	}
+	return candidates
+}
+
+func (p shellCommandPolicy) active() bool {
+	return p.allowSet || len(p.deny) > 0 || p.invalid != ""
+}
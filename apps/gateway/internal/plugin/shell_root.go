@@ -0,0 +1,214 @@
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const shellToolRootEnv = "NEXTAI_SHELL_ROOT"
+
+// shellRootDeviceFiles are allowed outside the root because redirections to
+// them are routine and reach no project data.
+var shellRootDeviceFiles = map[string]struct{}{
+	"/dev/null":   {},
+	"/dev/stdin":  {},
+	"/dev/stdout": {},
+	"/dev/stderr": {},
+}
+
+// shellRoot confines the shell tool's working directories to one directory
+// tree. The zero value is unrestricted.
+type shellRoot struct {
+	dir string
+}
+
+// loadShellRoot reads NEXTAI_SHELL_ROOT. Relative roots are resolved against
+// the gateway's working directory.
+func loadShellRoot() shellRoot {
+	raw := strings.TrimSpace(os.Getenv(shellToolRootEnv))
+	if raw == "" {
+		return shellRoot{}
+	}
+	return shellRoot{dir: resolveShellPath(raw, "")}
+}
+
+func (r shellRoot) active() bool {
+	return r.dir != ""
+}
+
+// cwd resolves a requested working directory against the root and rejects it
+// when it escapes. An empty cwd defaults to the root when fallback is set.
+func (r shellRoot) cwd(raw string, fallback bool) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if !r.active() {
+		return raw, nil
+	}
+	if raw == "" {
+		if fallback {
+			return r.dir, nil
+		}
+		return "", nil
+	}
+	resolved := resolveShellPath(raw, r.dir)
+	if !r.contains(resolved) {
+		return "", fmt.Errorf("%w: cwd %q is outside %s", ErrShellToolPathOutsideRoot, raw, shellToolRootEnv)
+	}
+	return resolved, nil
+}
+
+// checkCommand rejects a command whose arguments name a path outside the
+// root. Detection is best effort: it sees literal absolute, home-relative and
+// parent-relative paths, not ones built from variables or substitutions. The
+// first word of each command is the program and is not checked, so system
+// binaries such as /usr/bin/env keep working. A cd with no directory, or cd -,
+// is rejected because its target cannot be checked.
+func (r shellRoot) checkCommand(command, cwd string) error {
+	if !r.active() {
+		return nil
+	}
+	base := cwd
+	if base == "" {
+		base = r.dir
+	}
+	for _, segment := range splitShellSegments(command) {
+		// A bare cd goes to $HOME and cd - to the previous directory; neither
+		// names a path to check, and in a persistent session every later item
+		// would run from there.
+		if segment[0] == "cd" && (len(segment) == 1 || segment[1] == "-") {
+			return fmt.Errorf("%w: cd without a directory leaves %s", ErrShellToolPathOutsideRoot, shellToolRootEnv)
+		}
+		for index, word := range segment {
+			if index == 0 {
+				continue
+			}
+			if strings.HasPrefix(word, "-") {
+				_, value, found := strings.Cut(word, "=")
+				if !found {
+					continue
+				}
+				word = value
+			}
+			if !shellWordLooksLikePath(word) {
+				continue
+			}
+			if _, ok := shellRootDeviceFiles[word]; ok {
+				continue
+			}
+			if !r.contains(resolveShellPath(word, base)) {
+				return fmt.Errorf("%w: path %q is outside %s", ErrShellToolPathOutsideRoot, word, shellToolRootEnv)
+			}
+		}
+	}
+	return nil
+}
+
+func (r shellRoot) contains(target string) bool {
+	rel, err := filepath.Rel(r.dir, target)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+func shellWordLooksLikePath(word string) bool {
+	switch {
+	case word == "", strings.Contains(word, "://"):
+		return false
+	case filepath.IsAbs(word), word == "~", strings.HasPrefix(word, "~/"):
+		return true
+	}
+	for _, part := range strings.Split(filepath.ToSlash(word), "/") {
+		if part == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveShellPath makes raw absolute against base, expands a leading ~ and
+// follows symlinks for the part of the path that exists, so a link inside the
+// root cannot point the check somewhere else.
+func resolveShellPath(raw, base string) string {
+	if raw == "~" || strings.HasPrefix(raw, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			raw = filepath.Join(home, strings.TrimPrefix(raw, "~"))
+		}
+	}
+	if !filepath.IsAbs(raw) {
+		if base == "" {
+			if abs, err := filepath.Abs(raw); err == nil {
+				raw = abs
+			}
+		} else {
+			raw = filepath.Join(base, raw)
+		}
+	}
+	clean := filepath.Clean(raw)
+	rest := ""
+	for current := clean; ; {
+		if resolved, err := filepath.EvalSymlinks(current); err == nil {
+			return filepath.Join(resolved, rest)
+		}
+		parent := filepath.Dir(current)
+		if parent == current {
+			return clean
+		}
+		rest = filepath.Join(filepath.Base(current), rest)
+		current = parent
+	}
+}
+
+// splitShellSegments splits command text into simple commands on ; & | and
+// newlines, and each command into words with quotes removed. Redirection
+// operators end a word so `>/etc/x` yields `/etc/x`.
+func splitShellSegments(command string) [][]string {
+	var segments [][]string
+	var words []string
+	var word strings.Builder
+	inWord := false
+	quote := rune(0)
+	flushWord := func() {
+		if inWord {
+			words = append(words, word.String())
+			word.Reset()
+			inWord = false
+		}
+	}
+	flushSegment := func() {
+		flushWord()
+		if len(words) > 0 {
+			segments = append(segments, words)
+			words = nil
+		}
+	}
+	for _, ch := range command {
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			} else {
+				word.WriteRune(ch)
+			}
+		case ch == '\'' || ch == '"':
+			quote = ch
+			inWord = true
+		case ch == ';' || ch == '&' || ch == '|' || ch == '\n' || ch == '(' || ch == ')':
+			flushSegment()
+		case ch == '<' || ch == '>':
+			flushWord()
+			// A redirection target is an argument, never the program.
+			if len(words) == 0 {
+				words = append(words, "")
+			}
+		case ch == ' ' || ch == '\t' || ch == '\r':
+			flushWord()
+		default:
+			word.WriteRune(ch)
+			inWord = true
+		}
+	}
+	flushSegment()
+	return segments
+}
@@ -2,7 +2,9 @@ package plugin
 
 import (
 	"errors"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -181,6 +183,55 @@ func TestShellToolWriteStdinRejectsNonTTYInput(t *testing.T) {
 	}
 }
 
+func TestShellToolPersistentSessionKeepsStateAcrossLines(t *testing.T) {
+	tool := NewShellTool()
+	result, err := tool.Invoke(ToolCommand{
+		SessionMode: "persistent",
+		Items: []ToolCommandItem{
+			{Command: "GREETING=hello\r\necho \"$GREETING world\""},
+			{Command: "echo \"$GREETING again\""},
+		},
+	})
+	if err != nil {
+		t.Fatalf("invoke failed: %v", err)
+	}
+	batch, ok := result.Data.(shellBatchResult)
+	if !ok || batch.Count != 2 || !batch.OK {
+		t.Fatalf("unexpected result: %#v", result.Data)
+	}
+	if got := strings.TrimSpace(batch.Results[0].Output); got != "hello world" {
+		t.Fatalf("first output=%q want=hello world", got)
+	}
+	if got := strings.TrimSpace(batch.Results[1].Output); got != "hello again" {
+		t.Fatalf("second output=%q want=hello again", got)
+	}
+}
+
+func TestShellToolFreshSessionRunsHeredoc(t *testing.T) {
+	tool := NewShellTool()
+	result, err := tool.Invoke(ToolCommand{
+		Items: []ToolCommandItem{{Command: "cat <<'EOF'\nline one\nline two\nEOF"}},
+	})
+	if err != nil {
+		t.Fatalf("invoke failed: %v", err)
+	}
+	one, ok := result.Data.(shellSingleResult)
+	if !ok || !one.OK {
+		t.Fatalf("unexpected result: %#v", result.Data)
+	}
+	if got := strings.TrimSpace(one.Output); got != "line one\nline two" {
+		t.Fatalf("output=%q", got)
+	}
+}
+
+func TestShellToolRejectsUnknownSessionMode(t *testing.T) {
+	tool := NewShellTool()
+	_, err := tool.Invoke(ToolCommand{SessionMode: "sticky", Items: []ToolCommandItem{{Command: "true"}}})
+	if !errors.Is(err, ErrShellToolSessionModeInvalid) {
+		t.Fatalf("expected ErrShellToolSessionModeInvalid, got=%v", err)
+	}
+}
+
 func fakeLookPath(available map[string]bool) func(file string) (string, error) {
 	return func(file string) (string, error) {
 		if available[file] {
@@ -189,3 +240,214 @@ func fakeLookPath(available map[string]bool) func(file string) (string, error) {
 		return "", exec.ErrNotFound
 	}
 }
+
+func TestShellToolEnforcesAllowAndDenyLists(t *testing.T) {
+	t.Setenv(shellToolAllowEnv, `^git (status|log)( .*)?$, ^echo `)
+	t.Setenv(shellToolDenyEnv, `^sudo `)
+	tool := NewShellTool()
+
+	if _, err := tool.Invoke(ToolCommand{Items: []ToolCommandItem{{Command: "echo allowed"}}}); err != nil {
+		t.Fatalf("expected allowed command to run, got=%v", err)
+	}
+	// The allow list alone must refuse chaining; the deny list does not cover it.
+	for _, command := range []string{"rm -rf /tmp/nope", "echo ok; rm -rf /tmp/nope", "git log & rm -rf /tmp/nope"} {
+		_, err := tool.Invoke(ToolCommand{Items: []ToolCommandItem{{Command: "echo first"}, {Command: command}}})
+		if !errors.Is(err, ErrShellToolCommandBlocked) {
+			t.Fatalf("expected %q to be blocked, got=%v", command, err)
+		}
+	}
+	if _, err := tool.Invoke(ToolCommand{Cmd: "cat", TTY: true}); !errors.Is(err, ErrShellToolCommandBlocked) {
+		t.Fatalf("expected exec_command outside allow list to be blocked, got=%v", err)
+	}
+}
+
+func TestShellCommandPolicyChecksEveryLineAndRefusesChaining(t *testing.T) {
+	t.Setenv(shellToolDenyEnv, `^rm `)
+	policy := loadShellCommandPolicy()
+	if err := policy.check("echo hi\nrm -rf /tmp/nope"); !errors.Is(err, ErrShellToolCommandBlocked) {
+		t.Fatalf("expected deny pattern to match a later line, got=%v", err)
+	}
+	for _, command := range []string{
+		"echo ok; rm -rf /tmp/nope",
+		"true && rm -rf /tmp/nope",
+		"true || rm -rf /tmp/nope",
+		"echo ok | rm -rf /tmp/nope",
+		"echo $(rm -rf /tmp/nope)",
+		"echo `rm -rf /tmp/nope`",
+		"(rm -rf /tmp/nope)",
+	} {
+		if err := policy.check(command); !errors.Is(err, ErrShellToolCommandBlocked) {
+			t.Fatalf("expected anchored deny pattern to block chained %q, got=%v", command, err)
+		}
+	}
+	if err := policy.check("echo rm -rf"); err != nil {
+		t.Fatalf("expected rm as an argument to pass the deny list, got=%v", err)
+	}
+
+	t.Setenv(shellToolDenyEnv, "")
+	t.Setenv(shellToolAllowEnv, `^echo `)
+	policy = loadShellCommandPolicy()
+	if err := policy.check("echo hi"); err != nil {
+		t.Fatalf("expected allowed command to pass, got=%v", err)
+	}
+	for _, command := range []string{
+		"echo $(rm -rf /tmp/nope)",
+		"echo `rm -rf /tmp/nope`",
+		"echo hi; rm -rf /tmp/nope",
+		"echo hi && rm -rf /tmp/nope",
+		"echo hi | sh",
+		"echo hi\nrm -rf /tmp/nope",
+		"echo hi & rm -rf /tmp/nope",
+		"echo hi > f",
+		"echo hi >> f",
+		"diff <(echo a) <(echo b)",
+	} {
+		if err := policy.check(command); !errors.Is(err, ErrShellToolCommandBlocked) {
+			t.Fatalf("expected %q to be blocked under an allow list, got=%v", command, err)
+		}
+	}
+}
+
+func TestShellCommandPolicyFailsClosedOnInvalidPattern(t *testing.T) {
+	t.Setenv(shellToolDenyEnv, `(`)
+	policy := loadShellCommandPolicy()
+	if err := policy.check("ls"); !errors.Is(err, ErrShellToolCommandBlocked) {
+		t.Fatalf("expected invalid pattern to block commands, got=%v", err)
+	}
+}
+
+func TestShellToolConfinesCwdAndPathsToRoot(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "sub"), 0o755); err != nil {
+		t.Fatalf("mkdir failed: %v", err)
+	}
+	t.Setenv(shellToolRootEnv, root)
+	tool := NewShellTool()
+
+	out, err := tool.Invoke(ToolCommand{Items: []ToolCommandItem{{Command: "pwd"}, {Command: "pwd", Cwd: "sub"}}})
+	if err != nil {
+		t.Fatalf("expected commands inside root to run, got=%v", err)
+	}
+	result, err := out.ToMap()
+	if err != nil {
+		t.Fatalf("convert result failed: %v", err)
+	}
+	items, _ := result["results"].([]interface{})
+	if len(items) != 2 {
+		t.Fatalf("expected 2 results, got=%#v", result["results"])
+	}
+	first, _ := items[0].(map[string]interface{})
+	second, _ := items[1].(map[string]interface{})
+	if got := strings.TrimSpace(stringFromAny(first["output"])); got != loadShellRoot().dir {
+		t.Fatalf("expected default cwd to be the root, got=%q", got)
+	}
+	if got := strings.TrimSpace(stringFromAny(second["output"])); got != filepath.Join(loadShellRoot().dir, "sub") {
+		t.Fatalf("expected relative cwd under the root, got=%q", got)
+	}
+
+	for _, item := range []ToolCommandItem{
+		{Command: "ls", Cwd: "/"},
+		{Command: "ls", Cwd: "../"},
+		{Command: "cat /etc/hosts"},
+		{Command: "ls sub/../../"},
+		{Command: "echo hi > /tmp/outside-root"},
+	} {
+		_, err := tool.Invoke(ToolCommand{Items: []ToolCommandItem{item}})
+		if !errors.Is(err, ErrShellToolPathOutsideRoot) {
+			t.Fatalf("expected %+v to be rejected, got=%v", item, err)
+		}
+	}
+	if _, err := tool.Invoke(ToolCommand{Items: []ToolCommandItem{{Command: "ls sub 2>/dev/null"}}}); err != nil {
+		t.Fatalf("expected /dev/null redirect to be allowed, got=%v", err)
+	}
+}
+
+func TestShellToolRejectsBareCdUnderRootInPersistentSession(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "sub"), 0o755); err != nil {
+		t.Fatalf("mkdir failed: %v", err)
+	}
+	t.Setenv(shellToolRootEnv, root)
+	tool := NewShellTool()
+
+	for _, command := range []string{"cd", "cd -", "cd sub && cd"} {
+		_, err := tool.Invoke(ToolCommand{
+			SessionMode: shellSessionModePersistent,
+			Items:       []ToolCommandItem{{Command: command}, {Command: "pwd"}},
+		})
+		if !errors.Is(err, ErrShellToolPathOutsideRoot) {
+			t.Fatalf("expected %q to be rejected under a root, got=%v", command, err)
+		}
+	}
+
+	out, err := tool.Invoke(ToolCommand{
+		SessionMode: shellSessionModePersistent,
+		Items:       []ToolCommandItem{{Command: "cd sub"}, {Command: "pwd"}},
+	})
+	if err != nil {
+		t.Fatalf("expected cd into the root to run, got=%v", err)
+	}
+	result, _ := out.ToMap()
+	items, _ := result["results"].([]interface{})
+	last, _ := items[len(items)-1].(map[string]interface{})
+	if got := strings.TrimSpace(stringFromAny(last["output"])); got != filepath.Join(loadShellRoot().dir, "sub") {
+		t.Fatalf("expected persistent cwd to stay under the root, got=%q", got)
+	}
+}
+
+func TestShellToolTruncatesOutputPerItem(t *testing.T) {
+	tool := NewShellTool()
+	out, err := tool.Invoke(ToolCommand{Items: []ToolCommandItem{
+		{Command: "printf 'abcdefghij'", MaxOutputBytes: 4},
+		{Command: "printf 'abcdefghij'", MaxOutputBytes: 4, Tail: true},
+		{Command: "printf 'short'", MaxOutputBytes: 64},
+	}})
+	if err != nil {
+		t.Fatalf("invoke failed: %v", err)
+	}
+	result, err := out.ToMap()
+	if err != nil {
+		t.Fatalf("convert result failed: %v", err)
+	}
+	items, _ := result["results"].([]interface{})
+	if len(items) != 3 {
+		t.Fatalf("expected 3 results, got=%#v", result["results"])
+	}
+	want := []string{
+		"abcd\n... (output truncated: showing first 4 of 10 bytes)",
+		"... (output truncated: showing last 4 of 10 bytes)\nghij",
+		"short",
+	}
+	for i, item := range items {
+		entry, _ := item.(map[string]interface{})
+		if got := stringFromAny(entry["output"]); got != want[i] {
+			t.Fatalf("item %d output=%q want=%q", i, got, want[i])
+		}
+	}
+}
+
+func TestTruncateShellOutputKeepsUTF8Boundaries(t *testing.T) {
+	raw := "你好世界"
+	if got := truncateShellOutput(raw, shellOutputLimit{MaxBytes: 4}); !strings.HasPrefix(got, "你\n") {
+		t.Fatalf("unexpected head truncation: %q", got)
+	}
+	if got := truncateShellOutput(raw, shellOutputLimit{MaxBytes: 4, Tail: true}); !strings.HasSuffix(got, "\n界") {
+		t.Fatalf("unexpected tail truncation: %q", got)
+	}
+}
+
+func TestNewShellToolReadsDefaultOutputCapFromEnv(t *testing.T) {
+	t.Setenv(shellToolMaxOutputBytesEnv, "3")
+	tool := NewShellTool()
+	out, err := tool.Invoke(ToolCommand{Items: []ToolCommandItem{{Command: "printf 'abcdef'"}}})
+	if err != nil {
+		t.Fatalf("invoke failed: %v", err)
+	}
+	result, err := out.ToMap()
+	if err != nil {
+		t.Fatalf("convert result failed: %v", err)
+	}
+	if got := stringFromAny(result["output"]); got != "abc\n... (output truncated: showing first 3 of 6 bytes)" {
+		t.Fatalf("unexpected output: %q", got)
+	}
+}
@@ -11,6 +11,9 @@ const (
 	AdapterDemo             = "demo"
 	AdapterOpenAICompatible = "openai-compatible"
 	AdapterCodexCompatible  = "codex-compatible"
+	AdapterCohere           = "cohere"
+	AdapterAnthropic        = "anthropic"
+	AdapterGemini           = "gemini"
 )
 
 type ModelSpec struct {
@@ -75,6 +78,108 @@ var builtinProviders = map[string]ProviderSpec{
 			},
 		},
 	},
+	"cohere": {
+		ID:                 "cohere",
+		Name:               "COHERE",
+		APIKeyPrefix:       "COHERE_API_KEY",
+		AllowCustomBaseURL: true,
+		DefaultBaseURL:     "https://api.cohere.com",
+		Adapter:            AdapterCohere,
+		Models: []ModelSpec{
+			{
+				ID:     "command-a-03-2025",
+				Name:   "Command A",
+				Status: "active",
+				Capabilities: domain.ModelCapabilities{
+					Temperature: true,
+					ToolCall:    true,
+					Input:       &domain.ModelModalities{Text: true},
+					Output:      &domain.ModelModalities{Text: true},
+				},
+				Limit: domain.ModelLimit{Context: 256000, Output: 8000},
+			},
+			{
+				ID:     "command-r-plus-08-2024",
+				Name:   "Command R+",
+				Status: "active",
+				Capabilities: domain.ModelCapabilities{
+					Temperature: true,
+					ToolCall:    true,
+					Input:       &domain.ModelModalities{Text: true},
+					Output:      &domain.ModelModalities{Text: true},
+				},
+				Limit: domain.ModelLimit{Context: 128000, Output: 4000},
+			},
+		},
+	},
+	"anthropic": {
+		ID:                 "anthropic",
+		Name:               "ANTHROPIC",
+		APIKeyPrefix:       "ANTHROPIC_API_KEY",
+		AllowCustomBaseURL: true,
+		DefaultBaseURL:     "https://api.anthropic.com",
+		Adapter:            AdapterAnthropic,
+		Models: []ModelSpec{
+			{
+				ID:     "claude-3-5-sonnet-latest",
+				Name:   "Claude 3.5 Sonnet",
+				Status: "active",
+				Capabilities: domain.ModelCapabilities{
+					Temperature: true,
+					ToolCall:    true,
+					Input:       &domain.ModelModalities{Text: true},
+					Output:      &domain.ModelModalities{Text: true},
+				},
+				Limit: domain.ModelLimit{Context: 200000, Output: 8192},
+			},
+			{
+				ID:     "claude-3-5-haiku-latest",
+				Name:   "Claude 3.5 Haiku",
+				Status: "active",
+				Capabilities: domain.ModelCapabilities{
+					Temperature: true,
+					ToolCall:    true,
+					Input:       &domain.ModelModalities{Text: true},
+					Output:      &domain.ModelModalities{Text: true},
+				},
+				Limit: domain.ModelLimit{Context: 200000, Output: 8192},
+			},
+		},
+	},
+	"gemini": {
+		ID:                 "gemini",
+		Name:               "GEMINI",
+		APIKeyPrefix:       "GEMINI_API_KEY",
+		AllowCustomBaseURL: true,
+		DefaultBaseURL:     "https://generativelanguage.googleapis.com/v1beta",
+		Adapter:            AdapterGemini,
+		Models: []ModelSpec{
+			{
+				ID:     "gemini-2.0-flash",
+				Name:   "Gemini 2.0 Flash",
+				Status: "active",
+				Capabilities: domain.ModelCapabilities{
+					Temperature: true,
+					ToolCall:    true,
+					Input:       &domain.ModelModalities{Text: true},
+					Output:      &domain.ModelModalities{Text: true},
+				},
+				Limit: domain.ModelLimit{Context: 1048576, Output: 8192},
+			},
+			{
+				ID:     "gemini-1.5-pro",
+				Name:   "Gemini 1.5 Pro",
+				Status: "active",
+				Capabilities: domain.ModelCapabilities{
+					Temperature: true,
+					ToolCall:    true,
+					Input:       &domain.ModelModalities{Text: true},
+					Output:      &domain.ModelModalities{Text: true},
+				},
+				Limit: domain.ModelLimit{Context: 2097152, Output: 8192},
+			},
+		},
+	},
 }
 
 var providerTypes = []ProviderTypeSpec{
@@ -90,6 +195,18 @@ var providerTypes = []ProviderTypeSpec{
 		ID:          AdapterCodexCompatible,
 		DisplayName: "codex Compatible",
 	},
+	{
+		ID:          "cohere",
+		DisplayName: "cohere",
+	},
+	{
+		ID:          "anthropic",
+		DisplayName: "anthropic",
+	},
+	{
+		ID:          "gemini",
+		DisplayName: "gemini",
+	},
 }
 
 func ListBuiltinProviderIDs() []string {
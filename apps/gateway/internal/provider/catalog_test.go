@@ -65,3 +65,92 @@ func TestResolveAdapterUsesCodexForCodexCompatibleProviderIDs(t *testing.T) {
 		t.Fatalf("expected openai-compatible adapter for custom-openai, got=%q", got)
 	}
 }
+
+func TestResolveProviderCohereBuiltin(t *testing.T) {
+	if got := ResolveAdapter("cohere"); got != AdapterCohere {
+		t.Fatalf("expected cohere adapter, got=%q", got)
+	}
+	if got := DefaultModelID("cohere"); got != "command-a-03-2025" {
+		t.Fatalf("unexpected cohere default model: %q", got)
+	}
+	found := false
+	for _, item := range ListProviderTypes() {
+		if item.ID == "cohere" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected cohere in provider types")
+	}
+}
+
+func TestResolveProviderAnthropicBuiltin(t *testing.T) {
+	if got := ResolveAdapter("anthropic"); got != AdapterAnthropic {
+		t.Fatalf("expected anthropic adapter, got=%q", got)
+	}
+	if got := DefaultModelID("anthropic"); got != "claude-3-5-sonnet-latest" {
+		t.Fatalf("unexpected anthropic default model: %q", got)
+	}
+	found := false
+	for _, item := range ListProviderTypes() {
+		if item.ID == "anthropic" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected anthropic in provider types")
+	}
+}
+
+func TestResolveProviderGeminiBuiltin(t *testing.T) {
+	if got := ResolveAdapter("gemini"); got != AdapterGemini {
+		t.Fatalf("expected gemini adapter, got=%q", got)
+	}
+	if got := DefaultModelID("gemini"); got != "gemini-2.0-flash" {
+		t.Fatalf("unexpected gemini default model: %q", got)
+	}
+	found := false
+	for _, item := range ListProviderTypes() {
+		if item.ID == "gemini" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected gemini in provider types")
+	}
+}
+
+func TestResolveContextWindowPrefersOverrideThenCatalogThenKnownFamily(t *testing.T) {
+	if got := ResolveContextWindow("openai", "gpt-4o-mini", map[string]int{"gpt-4o-mini": 4000}); got != 4000 {
+		t.Fatalf("expected override window, got=%d", got)
+	}
+	if got := ResolveContextWindow("cohere", "command-a-03-2025", nil); got != 256000 {
+		t.Fatalf("expected builtin catalog window, got=%d", got)
+	}
+	if got := ResolveContextWindow("custom-openai", "deepseek/deepseek-chat", nil); got != 64000 {
+		t.Fatalf("expected known family window, got=%d", got)
+	}
+	if got := ResolveContextWindow("custom-openai", "gpt-4-turbo-2024-04-09", nil); got != 128000 {
+		t.Fatalf("expected longest prefix to win, got=%d", got)
+	}
+	if got := ResolveContextWindow("custom-openai", "my-local-model", nil); got != DefaultContextWindow {
+		t.Fatalf("expected default window, got=%d", got)
+	}
+}
+
+func TestRenderHeadersExpandsModelTemplates(t *testing.T) {
+	headers := map[string]string{
+		"X-Model-Provider": "{{.ProviderID}}/{{.Model}}",
+		"X-Static":         " fixed ",
+	}
+	got, err := RenderHeaders(headers, HeaderTemplateData{Model: "gpt-4o-mini", ProviderID: "openai"})
+	if err != nil {
+		t.Fatalf("render headers failed: %v", err)
+	}
+	if got["X-Model-Provider"] != "openai/gpt-4o-mini" || got["X-Static"] != "fixed" {
+		t.Fatalf("unexpected headers: %#v", got)
+	}
+	if err := ValidateHeaderTemplates(map[string]string{"X-Bad": "{{.Region}}"}); err == nil {
+		t.Fatal("expected unknown template field to be rejected")
+	}
+}
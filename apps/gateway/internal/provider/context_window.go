@@ -0,0 +1,74 @@
+package provider
+
+import "strings"
+
+// DefaultContextWindow is used when neither the provider setting, the builtin
+// catalog nor the known model families know a model's context window.
+const DefaultContextWindow = 32000
+
+// knownModelContextWindows maps model ID prefixes to context windows so custom
+// openai-compatible providers serving well-known models get a sensible budget.
+// Longer prefixes win.
+var knownModelContextWindows = map[string]int{
+	"gpt-3.5-turbo":    16385,
+	"gpt-4":            8192,
+	"gpt-4-turbo":      128000,
+	"gpt-4o":           128000,
+	"gpt-4.1":          1047576,
+	"gpt-5":            400000,
+	"o1":               200000,
+	"o3":               200000,
+	"o4-mini":          200000,
+	"claude":           200000,
+	"gemini-1.5":       1000000,
+	"gemini-2":         1000000,
+	"deepseek":         64000,
+	"qwen":             32768,
+	"qwen-plus":        131072,
+	"qwen-long":        1000000,
+	"glm-4":            128000,
+	"moonshot-v1-8k":   8192,
+	"moonshot-v1-32k":  32768,
+	"moonshot-v1-128k": 131072,
+	"kimi":             131072,
+	"command-r":        128000,
+	"command-a":        256000,
+	"llama-3.1":        128000,
+	"mistral-large":    128000,
+	"codestral":        256000,
+}
+
+// ResolveContextWindow returns the context window in tokens for a model.
+// Per-provider overrides keyed by model ID take precedence over the
+// builtin catalog limit, which in turn takes precedence over known model families.
+func ResolveContextWindow(providerID, modelID string, overrides map[string]int) int {
+	modelID = strings.TrimSpace(modelID)
+	if window := overrides[modelID]; window > 0 {
+		return window
+	}
+	for _, model := range ResolveProvider(providerID).Models {
+		if model.ID == modelID && model.Limit.Context > 0 {
+			return model.Limit.Context
+		}
+	}
+	return KnownModelContextWindow(modelID)
+}
+
+// KnownModelContextWindow matches modelID against known model families by the
+// longest prefix, falling back to DefaultContextWindow.
+func KnownModelContextWindow(modelID string) int {
+	id := strings.ToLower(strings.TrimSpace(modelID))
+	if slash := strings.LastIndex(id, "/"); slash >= 0 {
+		id = id[slash+1:]
+	}
+	best := ""
+	for prefix := range knownModelContextWindows {
+		if strings.HasPrefix(id, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best == "" {
+		return DefaultContextWindow
+	}
+	return knownModelContextWindows[best]
+}
@@ -0,0 +1,56 @@
+package provider
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// HeaderTemplateData is the data a provider header value can reference, e.g.
+// "X-Model-Provider: {{.ProviderID}}/{{.Model}}" for gateways that route by
+// header instead of the body model.
+type HeaderTemplateData struct {
+	Model      string
+	ProviderID string
+}
+
+// RenderHeaders trims the configured headers and renders templated values for
+// one request. Values without "{{" are passed through unchanged.
+func RenderHeaders(headers map[string]string, data HeaderTemplateData) (map[string]string, error) {
+	out := make(map[string]string, len(headers))
+	for key, value := range headers {
+		name := strings.TrimSpace(key)
+		rendered, err := renderHeaderValue(name, strings.TrimSpace(value), data)
+		if err != nil {
+			return nil, err
+		}
+		rendered = strings.TrimSpace(rendered)
+		if name == "" || rendered == "" {
+			continue
+		}
+		out[name] = rendered
+	}
+	return out, nil
+}
+
+// ValidateHeaderTemplates checks that every templated header value parses and
+// only references HeaderTemplateData fields.
+func ValidateHeaderTemplates(headers map[string]string) error {
+	_, err := RenderHeaders(headers, HeaderTemplateData{})
+	return err
+}
+
+func renderHeaderValue(name, value string, data HeaderTemplateData) (string, error) {
+	if !strings.Contains(value, "{{") {
+		return value, nil
+	}
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(value)
+	if err != nil {
+		return "", fmt.Errorf("header %q has an invalid template: %w", name, err)
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("header %q template failed: %w", name, err)
+	}
+	return out.String(), nil
+}
@@ -14,15 +14,23 @@ import (
 )
 
 type ProviderSetting struct {
-	APIKey          string            `json:"api_key"`
-	BaseURL         string            `json:"base_url"`
-	DisplayName     string            `json:"display_name,omitempty"`
-	ReasoningEffort string            `json:"reasoning_effort,omitempty"`
-	Enabled         *bool             `json:"enabled,omitempty"`
-	Store           *bool             `json:"store,omitempty"`
-	Headers         map[string]string `json:"headers,omitempty"`
-	TimeoutMS       int               `json:"timeout_ms,omitempty"`
-	ModelAliases    map[string]string `json:"model_aliases,omitempty"`
+	APIKey              string            `json:"api_key"`
+	APIKeys             []string          `json:"api_keys,omitempty"`
+	BaseURL             string            `json:"base_url"`
+	DisplayName         string            `json:"display_name,omitempty"`
+	ReasoningEffort     string            `json:"reasoning_effort,omitempty"`
+	Enabled             *bool             `json:"enabled,omitempty"`
+	Store               *bool             `json:"store,omitempty"`
+	Headers             map[string]string `json:"headers,omitempty"`
+	TimeoutMS           int               `json:"timeout_ms,omitempty"`
+	ModelAliases        map[string]string `json:"model_aliases,omitempty"`
+	ForwardUser         string            `json:"forward_user,omitempty"`
+	ModelContextWindows map[string]int    `json:"model_context_windows,omitempty"`
+	CompressRequests    bool              `json:"compress_requests,omitempty"`
+	StreamUsage         bool              `json:"stream_usage,omitempty"`
+	ParallelToolCalls   *bool             `json:"parallel_tool_calls,omitempty"`
+	Temperature         *float64          `json:"temperature,omitempty"`
+	MaxTokens           int               `json:"max_tokens,omitempty"`
 }
 
 const currentStateSchemaVersion = 1
@@ -38,6 +46,8 @@ type State struct {
 	Envs          map[string]string                  `json:"envs"`
 	Skills        map[string]domain.SkillSpec        `json:"skills"`
 	Channels      domain.ChannelConfigMap            `json:"channels"`
+	DeletedChats  map[string]domain.DeletedChat      `json:"deleted_chats"`
+	DisabledTools []string                           `json:"disabled_tools,omitempty"`
 }
 
 type Store struct {
@@ -65,6 +75,7 @@ func defaultState(dataDir string) State {
 		SchemaVersion: currentStateSchemaVersion,
 		Chats:         map[string]domain.ChatSpec{},
 		Histories:     map[string][]domain.RuntimeMessage{},
+		DeletedChats:  map[string]domain.DeletedChat{},
 		CronJobs:      map[string]domain.CronJobSpec{},
 		CronStates:    map[string]domain.CronJobState{},
 		Providers: map[string]ProviderSetting{
@@ -96,6 +107,15 @@ func defaultState(dataDir string) State {
 				"token_url":       "https://bots.qq.com/app/getAppAccessToken",
 				"timeout_seconds": 8,
 			},
+			"slack": {
+				"enabled":         false,
+				"webhook_url":     "",
+				"bot_token":       "",
+				"channel_id":      "",
+				"bot_prefix":      "",
+				"api_base":        "https://slack.com/api",
+				"timeout_seconds": 8,
+			},
 		},
 	}
 	ensureDefaultChat(&state)
@@ -186,6 +206,9 @@ func normalizeState(state *State) {
 	if state.Histories == nil {
 		state.Histories = map[string][]domain.RuntimeMessage{}
 	}
+	if state.DeletedChats == nil {
+		state.DeletedChats = map[string]domain.DeletedChat{}
+	}
 	if state.CronJobs == nil {
 		state.CronJobs = map[string]domain.CronJobSpec{}
 	}
@@ -221,6 +244,7 @@ func normalizeState(state *State) {
 		state.ActiveLLM = domain.ModelSlotConfig{
 			ProviderID: activeProviderID,
 			Model:      activeModelID,
+			Fallback:   state.ActiveLLM.Fallback,
 		}
 	}
 	if state.Envs == nil {
@@ -260,6 +284,17 @@ func normalizeState(state *State) {
 			"timeout_seconds": 8,
 		}
 	}
+	if _, ok := state.Channels["slack"]; !ok {
+		state.Channels["slack"] = map[string]interface{}{
+			"enabled":         false,
+			"webhook_url":     "",
+			"bot_token":       "",
+			"channel_id":      "",
+			"bot_prefix":      "",
+			"api_base":        "https://slack.com/api",
+			"timeout_seconds": 8,
+		}
+	}
 	ensureDefaultChat(state)
 	ensureDefaultCronJob(state)
 }
@@ -481,6 +516,7 @@ func normalizeProviderSetting(setting *ProviderSetting) {
 	setting.APIKey = strings.TrimSpace(setting.APIKey)
 	setting.BaseURL = strings.TrimSpace(setting.BaseURL)
 	setting.ReasoningEffort = strings.ToLower(strings.TrimSpace(setting.ReasoningEffort))
+	setting.ForwardUser = strings.ToLower(strings.TrimSpace(setting.ForwardUser))
 	if setting.Enabled == nil {
 		enabled := true
 		setting.Enabled = &enabled
@@ -503,12 +539,35 @@ func mergeProviderSetting(dst *ProviderSetting, src ProviderSetting) {
 	if src.APIKey != "" {
 		dst.APIKey = src.APIKey
 	}
+	if len(src.APIKeys) > 0 {
+		dst.APIKeys = append([]string(nil), src.APIKeys...)
+	}
 	if src.BaseURL != "" {
 		dst.BaseURL = src.BaseURL
 	}
 	if src.ReasoningEffort != "" {
 		dst.ReasoningEffort = src.ReasoningEffort
 	}
+	if src.ForwardUser != "" {
+		dst.ForwardUser = src.ForwardUser
+	}
+	if src.CompressRequests {
+		dst.CompressRequests = true
+	}
+	if src.StreamUsage {
+		dst.StreamUsage = true
+	}
+	if src.ParallelToolCalls != nil {
+		parallel := *src.ParallelToolCalls
+		dst.ParallelToolCalls = &parallel
+	}
+	if src.Temperature != nil {
+		temperature := *src.Temperature
+		dst.Temperature = &temperature
+	}
+	if src.MaxTokens > 0 {
+		dst.MaxTokens = src.MaxTokens
+	}
 	if src.Enabled != nil {
 		enabled := *src.Enabled
 		dst.Enabled = &enabled
@@ -542,4 +601,14 @@ func mergeProviderSetting(dst *ProviderSetting, src ProviderSetting) {
 			dst.ModelAliases[alias] = modelID
 		}
 	}
+	if len(src.ModelContextWindows) > 0 {
+		dst.ModelContextWindows = map[string]int{}
+		for key, value := range src.ModelContextWindows {
+			modelID := strings.TrimSpace(key)
+			if modelID == "" || value <= 0 {
+				continue
+			}
+			dst.ModelContextWindows[modelID] = value
+		}
+	}
 }
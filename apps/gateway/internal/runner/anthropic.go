@@ -0,0 +1,353 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"nextai/apps/gateway/internal/domain"
+	"nextai/apps/gateway/internal/provider"
+)
+
+const (
+	anthropicAPIVersion       = "2023-06-01"
+	anthropicDefaultMaxTokens = 4096
+	// anthropicMissingToolResult answers a tool_use whose result never made it
+	// into the conversation.
+	anthropicMissingToolResult = "no result was recorded for this tool call"
+)
+
+type anthropicAdapter struct{}
+
+func (a *anthropicAdapter) ID() string {
+	return provider.AdapterAnthropic
+}
+
+func (a *anthropicAdapter) Capabilities() ProviderCapabilities {
+	return ProviderCapabilities{
+		Stream:      false,
+		ToolCall:    true,
+		Attachments: false,
+		Reasoning:   false,
+	}
+}
+
+func (a *anthropicAdapter) GenerateTurn(ctx context.Context, req domain.AgentProcessRequest, cfg GenerateConfig, tools []ToolDefinition, runner *Runner) (TurnResult, error) {
+	return runner.generateAnthropicTurn(ctx, req, cfg, tools)
+}
+
+func (r *Runner) generateAnthropicTurn(ctx context.Context, req domain.AgentProcessRequest, cfg GenerateConfig, tools []ToolDefinition) (TurnResult, error) {
+	apiKey := strings.TrimSpace(cfg.APIKey)
+	if apiKey == "" {
+		return TurnResult{}, &RunnerError{Code: ErrorCodeProviderNotConfigured, Message: "provider api_key is required"}
+	}
+	baseURL := strings.TrimRight(strings.TrimSpace(cfg.BaseURL), "/")
+	if baseURL == "" {
+		baseURL = defaultAnthropicBaseURL
+	}
+
+	system, messages := toAnthropicMessages(req.Input)
+	if len(messages) == 0 {
+		return TurnResult{Text: generateDemoReply(req)}, nil
+	}
+	maxTokens := anthropicDefaultMaxTokens
+	if cfg.MaxTokens > 0 {
+		maxTokens = cfg.MaxTokens
+	}
+	payload := anthropicMessagesRequest{
+		Model:     cfg.Model,
+		MaxTokens: maxTokens,
+		System:    system,
+		Messages:  messages,
+		Tools:     toAnthropicTools(tools),
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return TurnResult{}, &RunnerError{
+			Code:    ErrorCodeProviderRequestFailed,
+			Message: "failed to encode provider request",
+			Err:     err,
+		}
+	}
+
+	requestCtx := ctx
+	cancel := func() {}
+	if cfg.TimeoutMS > 0 {
+		requestCtx, cancel = context.WithTimeout(ctx, time.Duration(cfg.TimeoutMS)*time.Millisecond)
+	}
+	defer cancel()
+
+	httpReq, err := http.NewRequestWithContext(requestCtx, http.MethodPost, baseURL+"/v1/messages", bytes.NewReader(body))
+	if err != nil {
+		return TurnResult{}, &RunnerError{
+			Code:    ErrorCodeProviderRequestFailed,
+			Message: "failed to create provider request",
+			Err:     err,
+		}
+	}
+	httpReq.Header.Set("x-api-key", apiKey)
+	httpReq.Header.Set("anthropic-version", anthropicAPIVersion)
+	httpReq.Header.Set("Content-Type", "application/json")
+	if err := setProviderHeaders(httpReq, cfg); err != nil {
+		return TurnResult{}, err
+	}
+
+	resp, err := r.httpClient.Do(httpReq)
+	if err != nil {
+		return TurnResult{}, &RunnerError{
+			Code:    ErrorCodeProviderRequestFailed,
+			Message: "provider request failed",
+			Err:     err,
+		}
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 2*1024*1024))
+	if err != nil {
+		return TurnResult{}, &RunnerError{
+			Code:    ErrorCodeProviderRequestFailed,
+			Message: "failed to read provider response",
+			Err:     err,
+		}
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return TurnResult{}, &RunnerError{
+			Code:         ErrorCodeProviderRequestFailed,
+			Message:      fmt.Sprintf("provider returned status %d", resp.StatusCode),
+			Status:       resp.StatusCode,
+			ProviderBody: providerErrorBody(respBody),
+		}
+	}
+
+	var completion anthropicMessagesResponse
+	if err := json.Unmarshal(respBody, &completion); err != nil {
+		return TurnResult{}, &RunnerError{
+			Code:    ErrorCodeProviderInvalidReply,
+			Message: "provider response is not valid json",
+			Err:     err,
+		}
+	}
+
+	texts := []string{}
+	rawCalls := []openAIToolCall{}
+	for _, block := range completion.Content {
+		switch block.Type {
+		case "text":
+			if text := strings.TrimSpace(block.Text); text != "" {
+				texts = append(texts, text)
+			}
+		case "tool_use":
+			arguments := "{}"
+			if len(block.Input) > 0 {
+				arguments = string(block.Input)
+			}
+			rawCalls = append(rawCalls, openAIToolCall{
+				ID:       block.ID,
+				Type:     "function",
+				Function: openAIFunctionCall{Name: block.Name, Arguments: arguments},
+			})
+		}
+	}
+	toolCalls, err := parseOpenAIToolCalls(rawCalls)
+	if err != nil {
+		return TurnResult{}, &RunnerError{
+			Code:    ErrorCodeProviderInvalidReply,
+			Message: err.Error(),
+			Err:     err,
+		}
+	}
+	text := strings.Join(texts, "\n")
+	if text == "" && len(toolCalls) == 0 {
+		return TurnResult{}, &RunnerError{
+			Code:    ErrorCodeProviderInvalidReply,
+			Message: "provider response has empty content",
+		}
+	}
+
+	return TurnResult{
+		Text:         text,
+		ToolCalls:    toolCalls,
+		ResponseID:   strings.TrimSpace(completion.ID),
+		Usage:        completion.Usage.toTurnUsage(),
+		Truncated:    completion.StopReason == "max_tokens",
+		FinishReason: completion.StopReason,
+		Model:        completion.Model,
+	}, nil
+}
+
+// toAnthropicMessages splits system messages into the top-level system prompt
+// and converts the rest into alternating user/assistant turns: assistant tool
+// calls become tool_use blocks and tool results become tool_result blocks on
+// a user turn. Consecutive turns of one role are merged, as the API requires.
+//
+// The API rejects a tool_use block that the next user turn does not answer. A
+// tool result without tool_call_id answers the oldest unanswered call of the
+// preceding assistant turn, and calls still unanswered when the conversation
+// moves on get an is_error tool_result so no tool_use is left orphaned.
+func toAnthropicMessages(input []domain.AgentInputMessage) (string, []anthropicMessage) {
+	systemParts := []string{}
+	out := make([]anthropicMessage, 0, len(input))
+	pendingCallIDs := []string{}
+	appendBlocks := func(role string, blocks []anthropicContentBlock) {
+		if len(blocks) == 0 {
+			return
+		}
+		if n := len(out); n > 0 && out[n-1].Role == role {
+			out[n-1].Content = append(out[n-1].Content, blocks...)
+			return
+		}
+		out = append(out, anthropicMessage{Role: role, Content: blocks})
+	}
+	answerCall := func(callID string) {
+		for i, id := range pendingCallIDs {
+			if id == callID {
+				pendingCallIDs = append(pendingCallIDs[:i], pendingCallIDs[i+1:]...)
+				return
+			}
+		}
+	}
+	closePendingCalls := func() {
+		blocks := make([]anthropicContentBlock, 0, len(pendingCallIDs))
+		for _, id := range pendingCallIDs {
+			blocks = append(blocks, anthropicContentBlock{
+				Type:      "tool_result",
+				ToolUseID: id,
+				Content:   anthropicMissingToolResult,
+				IsError:   true,
+			})
+		}
+		pendingCallIDs = pendingCallIDs[:0]
+		appendBlocks("user", blocks)
+	}
+
+	for _, msg := range input {
+		content := strings.TrimSpace(flattenText(msg.Content))
+		role := normalizeRole(msg.Role)
+		if role != "system" && role != "tool" {
+			closePendingCalls()
+		}
+		switch role {
+		case "system":
+			if content != "" {
+				systemParts = append(systemParts, content)
+			}
+		case "assistant":
+			blocks := []anthropicContentBlock{}
+			if content != "" {
+				blocks = append(blocks, anthropicContentBlock{Type: "text", Text: content})
+			}
+			for _, call := range parseToolCallsFromMetadata(msg.Metadata) {
+				input := json.RawMessage(strings.TrimSpace(call.Function.Arguments))
+				if !json.Valid(input) {
+					input = json.RawMessage("{}")
+				}
+				blocks = append(blocks, anthropicContentBlock{
+					Type:  "tool_use",
+					ID:    call.ID,
+					Name:  call.Function.Name,
+					Input: input,
+				})
+				pendingCallIDs = append(pendingCallIDs, call.ID)
+			}
+			appendBlocks("assistant", blocks)
+		case "tool":
+			callID := metadataString(msg.Metadata, "tool_call_id")
+			if callID == "" && len(pendingCallIDs) > 0 {
+				callID = pendingCallIDs[0]
+			}
+			if callID == "" {
+				if content != "" {
+					appendBlocks("user", []anthropicContentBlock{{Type: "text", Text: content}})
+				}
+				continue
+			}
+			answerCall(callID)
+			appendBlocks("user", []anthropicContentBlock{{
+				Type:      "tool_result",
+				ToolUseID: callID,
+				Content:   content,
+			}})
+		default:
+			if content == "" {
+				continue
+			}
+			appendBlocks("user", []anthropicContentBlock{{Type: "text", Text: content}})
+		}
+	}
+	closePendingCalls()
+	return strings.Join(systemParts, "\n\n"), out
+}
+
+func toAnthropicTools(tools []ToolDefinition) []anthropicTool {
+	if len(tools) == 0 {
+		return nil
+	}
+	out := make([]anthropicTool, 0, len(tools))
+	for _, item := range tools {
+		name := strings.TrimSpace(item.Name)
+		if name == "" {
+			continue
+		}
+		out = append(out, anthropicTool{
+			Name:        name,
+			Description: strings.TrimSpace(item.Description),
+			InputSchema: normalizeToolParameters(item.Parameters),
+		})
+	}
+	return out
+}
+
+type anthropicMessagesRequest struct {
+	Model     string             `json:"model"`
+	MaxTokens int                `json:"max_tokens"`
+	System    string             `json:"system,omitempty"`
+	Messages  []anthropicMessage `json:"messages"`
+	Tools     []anthropicTool    `json:"tools,omitempty"`
+}
+
+type anthropicMessage struct {
+	Role    string                  `json:"role"`
+	Content []anthropicContentBlock `json:"content"`
+}
+
+type anthropicContentBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   string          `json:"content,omitempty"`
+	IsError   bool            `json:"is_error,omitempty"`
+}
+
+type anthropicTool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	InputSchema map[string]interface{} `json:"input_schema"`
+}
+
+type anthropicMessagesResponse struct {
+	ID         string                  `json:"id,omitempty"`
+	Model      string                  `json:"model,omitempty"`
+	StopReason string                  `json:"stop_reason,omitempty"`
+	Content    []anthropicContentBlock `json:"content"`
+	Usage      *anthropicUsage         `json:"usage,omitempty"`
+}
+
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+func (u *anthropicUsage) toTurnUsage() *TurnUsage {
+	if u == nil {
+		return nil
+	}
+	return &TurnUsage{PromptTokens: u.InputTokens, CompletionTokens: u.OutputTokens}
+}
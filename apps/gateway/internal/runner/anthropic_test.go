@@ -0,0 +1,241 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"nextai/apps/gateway/internal/domain"
+)
+
+func TestGenerateTurnAnthropicRequestShapeAndToolCalls(t *testing.T) {
+	t.Parallel()
+	mock, requests := newAnthropicMockServer(t, `{"id":"msg_1","model":"claude-3-5-sonnet-latest","stop_reason":"tool_use","content":[{"type":"text","text":"reading it"},{"type":"tool_use","id":"toolu_1","name":"view","input":{"path":"docs/contracts.md"}}],"usage":{"input_tokens":12,"output_tokens":7}}`)
+
+	r := NewWithHTTPClient(mock.Client())
+	turn, err := r.GenerateTurn(context.Background(), domain.AgentProcessRequest{
+		Input: []domain.AgentInputMessage{
+			{Role: "system", Type: "message", Content: []domain.RuntimeContent{{Type: "text", Text: "be brief"}}},
+			{Role: "user", Type: "message", Content: []domain.RuntimeContent{{Type: "text", Text: "view docs"}}},
+			{
+				Role: "assistant",
+				Type: "message",
+				Metadata: map[string]interface{}{
+					"tool_calls": []map[string]interface{}{{
+						"id":       "call_prev",
+						"type":     "function",
+						"function": map[string]interface{}{"name": "view", "arguments": `{"path":"a.md"}`},
+					}},
+				},
+			},
+			{
+				Role:     "tool",
+				Type:     "message",
+				Content:  []domain.RuntimeContent{{Type: "text", Text: "file body"}},
+				Metadata: map[string]interface{}{"tool_call_id": "call_prev", "name": "view"},
+			},
+			{Role: "user", Type: "message", Content: []domain.RuntimeContent{{Type: "text", Text: "now the contracts"}}},
+		},
+	}, GenerateConfig{
+		ProviderID: ProviderAnthropic,
+		Model:      "claude-3-5-sonnet-latest",
+		APIKey:     "sk-ant-test",
+		BaseURL:    mock.URL,
+	}, []ToolDefinition{{Name: "view", Description: "view a file"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	captured := receiveAnthropicRequest(t, requests)
+	requestBody := captured.body
+	if captured.apiKey != "sk-ant-test" || captured.version != anthropicAPIVersion {
+		t.Fatalf("unexpected headers: x-api-key=%q anthropic-version=%q", captured.apiKey, captured.version)
+	}
+	if requestBody["system"] != "be brief" {
+		t.Fatalf("expected system prompt to be separated, got=%#v", requestBody["system"])
+	}
+	if requestBody["max_tokens"] != float64(anthropicDefaultMaxTokens) {
+		t.Fatalf("unexpected max_tokens: %#v", requestBody["max_tokens"])
+	}
+	messages, ok := requestBody["messages"].([]interface{})
+	if !ok || len(messages) != 3 {
+		t.Fatalf("expected 3 messages, got=%#v", requestBody["messages"])
+	}
+	assistant, _ := messages[1].(map[string]interface{})
+	assistantBlocks, _ := assistant["content"].([]interface{})
+	if assistant["role"] != "assistant" || len(assistantBlocks) != 1 {
+		t.Fatalf("unexpected assistant message: %#v", assistant)
+	}
+	toolUse, _ := assistantBlocks[0].(map[string]interface{})
+	input, _ := toolUse["input"].(map[string]interface{})
+	if toolUse["type"] != "tool_use" || toolUse["id"] != "call_prev" || toolUse["name"] != "view" || input["path"] != "a.md" {
+		t.Fatalf("unexpected tool_use block: %#v", toolUse)
+	}
+	// The tool result and the follow-up user text share one user turn.
+	user, _ := messages[2].(map[string]interface{})
+	userBlocks, _ := user["content"].([]interface{})
+	if user["role"] != "user" || len(userBlocks) != 2 {
+		t.Fatalf("unexpected merged user message: %#v", user)
+	}
+	toolResult, _ := userBlocks[0].(map[string]interface{})
+	if toolResult["type"] != "tool_result" || toolResult["tool_use_id"] != "call_prev" || toolResult["content"] != "file body" {
+		t.Fatalf("unexpected tool_result block: %#v", toolResult)
+	}
+	tools, _ := requestBody["tools"].([]interface{})
+	if len(tools) != 1 {
+		t.Fatalf("expected one tool definition, got=%#v", requestBody["tools"])
+	}
+	tool, _ := tools[0].(map[string]interface{})
+	if tool["name"] != "view" || tool["input_schema"] == nil {
+		t.Fatalf("unexpected tool definition: %#v", tool)
+	}
+
+	if turn.Text != "reading it" || turn.ResponseID != "msg_1" || turn.FinishReason != "tool_use" {
+		t.Fatalf("unexpected turn: %#v", turn)
+	}
+	if turn.Usage == nil || turn.Usage.PromptTokens != 12 || turn.Usage.CompletionTokens != 7 {
+		t.Fatalf("unexpected usage: %#v", turn.Usage)
+	}
+	if len(turn.ToolCalls) != 1 || turn.ToolCalls[0].ID != "toolu_1" || turn.ToolCalls[0].Name != "view" {
+		t.Fatalf("unexpected tool calls: %#v", turn.ToolCalls)
+	}
+	if got := turn.ToolCalls[0].Arguments["path"]; got != "docs/contracts.md" {
+		t.Fatalf("unexpected tool argument path: %#v", got)
+	}
+}
+
+func TestGenerateTurnAnthropicUsesConfiguredMaxTokens(t *testing.T) {
+	t.Parallel()
+	mock, requests := newAnthropicMockServer(t, `{"id":"msg_2","stop_reason":"end_turn","content":[{"type":"text","text":"ok"}]}`)
+
+	r := NewWithHTTPClient(mock.Client())
+	_, err := r.GenerateTurn(context.Background(), domain.AgentProcessRequest{
+		Input: []domain.AgentInputMessage{
+			{Role: "user", Type: "message", Content: []domain.RuntimeContent{{Type: "text", Text: "hi"}}},
+		},
+	}, GenerateConfig{
+		ProviderID: ProviderAnthropic,
+		Model:      "claude-3-5-sonnet-latest",
+		APIKey:     "sk-ant-test",
+		BaseURL:    mock.URL,
+		MaxTokens:  1024,
+	}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := receiveAnthropicRequest(t, requests).body["max_tokens"]; got != float64(1024) {
+		t.Fatalf("expected configured max_tokens, got=%#v", got)
+	}
+}
+
+func TestToAnthropicMessagesAnswersEveryToolUse(t *testing.T) {
+	t.Parallel()
+	assistantCalls := func(ids ...string) domain.AgentInputMessage {
+		calls := []map[string]interface{}{}
+		for _, id := range ids {
+			calls = append(calls, map[string]interface{}{
+				"id":       id,
+				"type":     "function",
+				"function": map[string]interface{}{"name": "view", "arguments": `{}`},
+			})
+		}
+		return domain.AgentInputMessage{Role: "assistant", Type: "message", Metadata: map[string]interface{}{"tool_calls": calls}}
+	}
+	toolResult := func(text string, meta map[string]interface{}) domain.AgentInputMessage {
+		return domain.AgentInputMessage{Role: "tool", Type: "message", Content: []domain.RuntimeContent{{Type: "text", Text: text}}, Metadata: meta}
+	}
+
+	_, messages := toAnthropicMessages([]domain.AgentInputMessage{
+		{Role: "user", Type: "message", Content: []domain.RuntimeContent{{Type: "text", Text: "go"}}},
+		assistantCalls("call_a", "call_b", "call_c"),
+		// No tool_call_id: pairs with the oldest unanswered call.
+		toolResult("result a", map[string]interface{}{"name": "view"}),
+		toolResult("result c", map[string]interface{}{"tool_call_id": "call_c"}),
+		// call_b never gets a result before the conversation moves on.
+		{Role: "user", Type: "message", Content: []domain.RuntimeContent{{Type: "text", Text: "next"}}},
+		assistantCalls("call_d"),
+	})
+
+	if len(messages) != 5 {
+		t.Fatalf("expected 5 messages, got=%#v", messages)
+	}
+	first := messages[2]
+	if first.Role != "user" || len(first.Content) != 4 {
+		t.Fatalf("unexpected tool result turn: %#v", first)
+	}
+	want := []struct {
+		id      string
+		content string
+		isError bool
+	}{
+		{"call_a", "result a", false},
+		{"call_c", "result c", false},
+		{"call_b", anthropicMissingToolResult, true},
+	}
+	for i, w := range want {
+		block := first.Content[i]
+		if block.Type != "tool_result" || block.ToolUseID != w.id || block.Content != w.content || block.IsError != w.isError {
+			t.Fatalf("unexpected tool_result %d: %#v", i, block)
+		}
+	}
+	if text := first.Content[3]; text.Type != "text" || text.Text != "next" {
+		t.Fatalf("expected user text after tool results, got=%#v", text)
+	}
+	last := messages[4]
+	if last.Role != "user" || len(last.Content) != 1 || last.Content[0].ToolUseID != "call_d" || !last.Content[0].IsError {
+		t.Fatalf("expected trailing tool_use to be answered, got=%#v", last)
+	}
+}
+
+// anthropicCapturedRequest is what the mock saw; err is set when the request
+// was not the expected one.
+type anthropicCapturedRequest struct {
+	apiKey  string
+	version string
+	body    map[string]interface{}
+	err     error
+}
+
+// newAnthropicMockServer answers /v1/messages with reply and hands each
+// request to the test goroutine, which reports any failure; handlers run on
+// server goroutines where t.Fatalf must not be called.
+func newAnthropicMockServer(t *testing.T, reply string) (*httptest.Server, <-chan anthropicCapturedRequest) {
+	t.Helper()
+	requests := make(chan anthropicCapturedRequest, 4)
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/messages" {
+			requests <- anthropicCapturedRequest{err: fmt.Errorf("unexpected request %s %s", r.Method, r.URL.Path)}
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		captured := anthropicCapturedRequest{
+			apiKey:  r.Header.Get("x-api-key"),
+			version: r.Header.Get("anthropic-version"),
+		}
+		if err := json.NewDecoder(r.Body).Decode(&captured.body); err != nil {
+			requests <- anthropicCapturedRequest{err: fmt.Errorf("decode request: %w", err)}
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		requests <- captured
+		_, _ = w.Write([]byte(reply))
+	}))
+	t.Cleanup(mock.Close)
+	return mock, requests
+}
+
+func receiveAnthropicRequest(t *testing.T, requests <-chan anthropicCapturedRequest) anthropicCapturedRequest {
+	t.Helper()
+	select {
+	case got := <-requests:
+		if got.err != nil {
+			t.Fatalf("mock server: %v", got.err)
+		}
+		return got
+	default:
+		t.Fatalf("mock server received no request")
+		return anthropicCapturedRequest{}
+	}
+}
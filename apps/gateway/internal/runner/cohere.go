@@ -0,0 +1,448 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"nextai/apps/gateway/internal/domain"
+	"nextai/apps/gateway/internal/provider"
+)
+
+type cohereAdapter struct{}
+
+func (a *cohereAdapter) ID() string {
+	return provider.AdapterCohere
+}
+
+func (a *cohereAdapter) Capabilities() ProviderCapabilities {
+	return ProviderCapabilities{
+		Stream:      true,
+		ToolCall:    true,
+		Attachments: false,
+		Reasoning:   false,
+	}
+}
+
+func (a *cohereAdapter) GenerateTurn(ctx context.Context, req domain.AgentProcessRequest, cfg GenerateConfig, tools []ToolDefinition, runner *Runner) (TurnResult, error) {
+	return runner.generateCohereTurn(ctx, req, cfg, tools)
+}
+
+func (a *cohereAdapter) GenerateTurnStream(
+	ctx context.Context,
+	req domain.AgentProcessRequest,
+	cfg GenerateConfig,
+	tools []ToolDefinition,
+	runner *Runner,
+	onDelta func(string),
+) (TurnResult, error) {
+	return runner.generateCohereTurnStream(ctx, req, cfg, tools, onDelta)
+}
+
+func (r *Runner) generateCohereTurn(ctx context.Context, req domain.AgentProcessRequest, cfg GenerateConfig, tools []ToolDefinition) (TurnResult, error) {
+	payload := cohereChatRequest{
+		Model:    cfg.Model,
+		Messages: toCohereMessages(req.Input),
+		Tools:    toOpenAITools(tools),
+	}
+	if len(payload.Messages) == 0 {
+		return TurnResult{Text: generateDemoReply(req)}, nil
+	}
+
+	resp, cancel, err := r.doCohereChatRequest(ctx, cfg, payload)
+	if err != nil {
+		return TurnResult{}, err
+	}
+	defer cancel()
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 2*1024*1024))
+	if err != nil {
+		return TurnResult{}, &RunnerError{
+			Code:    ErrorCodeProviderRequestFailed,
+			Message: "failed to read provider response",
+			Err:     err,
+		}
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return TurnResult{}, &RunnerError{
+			Code:         ErrorCodeProviderRequestFailed,
+			Message:      fmt.Sprintf("provider returned status %d", resp.StatusCode),
+			Status:       resp.StatusCode,
+			ProviderBody: providerErrorBody(respBody),
+		}
+	}
+
+	var completion cohereChatResponse
+	if err := json.Unmarshal(respBody, &completion); err != nil {
+		return TurnResult{}, &RunnerError{
+			Code:    ErrorCodeProviderInvalidReply,
+			Message: "provider response is not valid json",
+			Err:     err,
+		}
+	}
+
+	text := strings.TrimSpace(extractCohereContent(completion.Message.Content))
+	toolCalls, err := parseOpenAIToolCalls(completion.Message.ToolCalls)
+	if err != nil {
+		return TurnResult{}, &RunnerError{
+			Code:    ErrorCodeProviderInvalidReply,
+			Message: err.Error(),
+			Err:     err,
+		}
+	}
+	if text == "" && len(toolCalls) == 0 {
+		return TurnResult{}, &RunnerError{
+			Code:    ErrorCodeProviderInvalidReply,
+			Message: "provider response has empty content",
+		}
+	}
+
+	return TurnResult{
+		Text:         text,
+		ToolCalls:    toolCalls,
+		ResponseID:   strings.TrimSpace(completion.ID),
+		Usage:        completion.Usage.toTurnUsage(),
+		Truncated:    strings.EqualFold(completion.FinishReason, "MAX_TOKENS"),
+		FinishReason: completion.FinishReason,
+	}, nil
+}
+
+func (r *Runner) generateCohereTurnStream(
+	ctx context.Context,
+	req domain.AgentProcessRequest,
+	cfg GenerateConfig,
+	tools []ToolDefinition,
+	onDelta func(string),
+) (TurnResult, error) {
+	payload := cohereChatRequest{
+		Model:    cfg.Model,
+		Messages: toCohereMessages(req.Input),
+		Tools:    toOpenAITools(tools),
+		Stream:   true,
+	}
+	if len(payload.Messages) == 0 {
+		return TurnResult{Text: generateDemoReply(req)}, nil
+	}
+
+	resp, cancel, err := r.doCohereChatRequest(ctx, cfg, payload)
+	if err != nil {
+		return TurnResult{}, err
+	}
+	defer cancel()
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 2*1024*1024))
+		return TurnResult{}, &RunnerError{
+			Code:         ErrorCodeProviderRequestFailed,
+			Message:      fmt.Sprintf("provider returned status %d", resp.StatusCode),
+			Status:       resp.StatusCode,
+			ProviderBody: providerErrorBody(respBody),
+		}
+	}
+
+	var replyBuilder strings.Builder
+	toolCalls := map[int]*openAIToolCall{}
+	responseID := ""
+	var usage *TurnUsage
+	truncated := false
+	finishReason := ""
+	messageEnded := false
+	processData := func(data string) error {
+		if isSSEControlToken(data) {
+			return nil
+		}
+		var event cohereStreamEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return fmt.Errorf("provider stream chunk is not valid json: %w; payload=%q", err, truncateText(data, 512))
+		}
+
+		switch event.Type {
+		case "message-start":
+			if id := strings.TrimSpace(event.ID); id != "" {
+				responseID = id
+			}
+		case "content-delta":
+			var content cohereContentItem
+			if len(event.Delta.Message.Content) == 0 || json.Unmarshal(event.Delta.Message.Content, &content) != nil {
+				return nil
+			}
+			if content.Text == "" {
+				return nil
+			}
+			replyBuilder.WriteString(content.Text)
+			if onDelta != nil {
+				onDelta(content.Text)
+			}
+		case "tool-call-start", "tool-call-delta":
+			var tc openAIToolCall
+			if len(event.Delta.Message.ToolCalls) == 0 || json.Unmarshal(event.Delta.Message.ToolCalls, &tc) != nil {
+				return nil
+			}
+			idx := event.Index
+			if idx < 0 {
+				idx = 0
+			}
+			current, ok := toolCalls[idx]
+			if !ok {
+				current = &openAIToolCall{}
+				toolCalls[idx] = current
+			}
+			if strings.TrimSpace(tc.ID) != "" {
+				current.ID = strings.TrimSpace(tc.ID)
+			}
+			if strings.TrimSpace(tc.Type) != "" {
+				current.Type = strings.TrimSpace(tc.Type)
+			}
+			if strings.TrimSpace(tc.Function.Name) != "" {
+				current.Function.Name = strings.TrimSpace(tc.Function.Name)
+			}
+			if tc.Function.Arguments != "" {
+				current.Function.Arguments += tc.Function.Arguments
+			}
+		case "message-end":
+			messageEnded = true
+			if strings.EqualFold(strings.TrimSpace(event.Delta.FinishReason), "ERROR") {
+				return fmt.Errorf("provider stream finished with error")
+			}
+			usage = event.Delta.Usage.toTurnUsage()
+			finishReason = strings.TrimSpace(event.Delta.FinishReason)
+			truncated = strings.EqualFold(finishReason, "MAX_TOKENS")
+		}
+		return nil
+	}
+
+	if err := consumeSSEData(resp.Body, processData); err != nil {
+		return TurnResult{}, mapStreamConsumeError(err)
+	}
+	if len(toolCalls) > 0 && !messageEnded {
+		return TurnResult{}, incompleteToolCallStreamError()
+	}
+
+	orderedIndexes := make([]int, 0, len(toolCalls))
+	for idx := range toolCalls {
+		orderedIndexes = append(orderedIndexes, idx)
+	}
+	sort.Ints(orderedIndexes)
+	aggregatedToolCalls := make([]openAIToolCall, 0, len(orderedIndexes))
+	for _, idx := range orderedIndexes {
+		if tc := toolCalls[idx]; tc != nil {
+			aggregatedToolCalls = append(aggregatedToolCalls, *tc)
+		}
+	}
+
+	parsedToolCalls, err := parseOpenAIToolCalls(aggregatedToolCalls)
+	if err != nil {
+		return TurnResult{}, &RunnerError{
+			Code:    ErrorCodeProviderInvalidReply,
+			Message: err.Error(),
+			Err:     err,
+		}
+	}
+
+	reply := replyBuilder.String()
+	if strings.TrimSpace(reply) == "" && len(parsedToolCalls) == 0 {
+		return TurnResult{}, &RunnerError{
+			Code:    ErrorCodeProviderInvalidReply,
+			Message: "provider response has empty content",
+		}
+	}
+
+	return TurnResult{
+		Text:         reply,
+		ToolCalls:    parsedToolCalls,
+		ResponseID:   responseID,
+		Usage:        usage,
+		Truncated:    truncated,
+		FinishReason: finishReason,
+	}, nil
+}
+
+// doCohereChatRequest sends payload to the /v2/chat endpoint. The returned cancel
+// func releases the request timeout and must be called after the body is consumed.
+func (r *Runner) doCohereChatRequest(ctx context.Context, cfg GenerateConfig, payload cohereChatRequest) (*http.Response, context.CancelFunc, error) {
+	apiKey := strings.TrimSpace(cfg.APIKey)
+	if apiKey == "" {
+		return nil, nil, &RunnerError{Code: ErrorCodeProviderNotConfigured, Message: "provider api_key is required"}
+	}
+
+	baseURL := strings.TrimRight(strings.TrimSpace(cfg.BaseURL), "/")
+	if baseURL == "" {
+		baseURL = defaultCohereBaseURL
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, nil, &RunnerError{
+			Code:    ErrorCodeProviderRequestFailed,
+			Message: "failed to encode provider request",
+			Err:     err,
+		}
+	}
+
+	requestCtx := ctx
+	cancel := context.CancelFunc(func() {})
+	if cfg.TimeoutMS > 0 {
+		requestCtx, cancel = context.WithTimeout(ctx, time.Duration(cfg.TimeoutMS)*time.Millisecond)
+	}
+
+	httpReq, err := http.NewRequestWithContext(requestCtx, http.MethodPost, baseURL+"/v2/chat", bytes.NewReader(body))
+	if err != nil {
+		cancel()
+		return nil, nil, &RunnerError{
+			Code:    ErrorCodeProviderRequestFailed,
+			Message: "failed to create provider request",
+			Err:     err,
+		}
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+apiKey)
+	httpReq.Header.Set("Content-Type", "application/json")
+	if payload.Stream {
+		httpReq.Header.Set("Accept", "text/event-stream")
+	} else {
+		httpReq.Header.Set("Accept", "application/json")
+	}
+	if err := setProviderHeaders(httpReq, cfg); err != nil {
+		cancel()
+		return nil, nil, err
+	}
+
+	resp, err := r.httpClient.Do(httpReq)
+	if err != nil {
+		cancel()
+		return nil, nil, &RunnerError{
+			Code:    ErrorCodeProviderRequestFailed,
+			Message: "provider request failed",
+			Err:     err,
+		}
+	}
+	return resp, cancel, nil
+}
+
+func toCohereMessages(input []domain.AgentInputMessage) []cohereMessage {
+	out := make([]cohereMessage, 0, len(input))
+	for _, msg := range input {
+		role := normalizeRole(msg.Role)
+		content := strings.TrimSpace(flattenText(msg.Content))
+
+		switch role {
+		case "assistant":
+			item := cohereMessage{Role: role}
+			if content != "" {
+				item.Content = content
+			}
+			if toolCalls := parseToolCallsFromMetadata(msg.Metadata); len(toolCalls) > 0 {
+				item.ToolCalls = toolCalls
+			}
+			if item.Content == nil && len(item.ToolCalls) == 0 {
+				continue
+			}
+			out = append(out, item)
+		case "tool":
+			callID := metadataString(msg.Metadata, "tool_call_id")
+			if callID == "" {
+				continue
+			}
+			out = append(out, cohereMessage{
+				Role:       role,
+				Content:    content,
+				ToolCallID: callID,
+			})
+		default:
+			if content == "" {
+				continue
+			}
+			out = append(out, cohereMessage{Role: role, Content: content})
+		}
+	}
+	return out
+}
+
+func extractCohereContent(content []cohereContentItem) string {
+	parts := make([]string, 0, len(content))
+	for _, item := range content {
+		if item.Type != "text" {
+			continue
+		}
+		text := strings.TrimSpace(item.Text)
+		if text != "" {
+			parts = append(parts, text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+type cohereChatRequest struct {
+	Model    string                 `json:"model"`
+	Messages []cohereMessage        `json:"messages"`
+	Tools    []openAIToolDefinition `json:"tools,omitempty"`
+	Stream   bool                   `json:"stream,omitempty"`
+}
+
+type cohereMessage struct {
+	Role       string           `json:"role"`
+	Content    interface{}      `json:"content,omitempty"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+type cohereContentItem struct {
+	Type string `json:"type,omitempty"`
+	Text string `json:"text,omitempty"`
+}
+
+type cohereChatResponse struct {
+	ID           string `json:"id,omitempty"`
+	FinishReason string `json:"finish_reason,omitempty"`
+	Message      struct {
+		Content   []cohereContentItem `json:"content,omitempty"`
+		ToolCalls []openAIToolCall    `json:"tool_calls,omitempty"`
+	} `json:"message"`
+	Usage *cohereUsage `json:"usage,omitempty"`
+}
+
+type cohereUsage struct {
+	Tokens      *cohereTokenCounts `json:"tokens,omitempty"`
+	BilledUnits *cohereTokenCounts `json:"billed_units,omitempty"`
+}
+
+type cohereTokenCounts struct {
+	InputTokens  float64 `json:"input_tokens"`
+	OutputTokens float64 `json:"output_tokens"`
+}
+
+// toTurnUsage prefers raw token counts and falls back to billed units.
+func (u *cohereUsage) toTurnUsage() *TurnUsage {
+	if u == nil {
+		return nil
+	}
+	counts := u.Tokens
+	if counts == nil {
+		counts = u.BilledUnits
+	}
+	if counts == nil {
+		return nil
+	}
+	return &TurnUsage{PromptTokens: int(counts.InputTokens), CompletionTokens: int(counts.OutputTokens)}
+}
+
+type cohereStreamEvent struct {
+	Type  string `json:"type"`
+	ID    string `json:"id,omitempty"`
+	Index int    `json:"index"`
+	Delta struct {
+		Message struct {
+			Content   json.RawMessage `json:"content,omitempty"`
+			ToolCalls json.RawMessage `json:"tool_calls,omitempty"`
+		} `json:"message"`
+		FinishReason string       `json:"finish_reason,omitempty"`
+		Usage        *cohereUsage `json:"usage,omitempty"`
+	} `json:"delta"`
+}
@@ -0,0 +1,158 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"nextai/apps/gateway/internal/domain"
+)
+
+func TestGenerateTurnCohereRequestShapeAndToolCalls(t *testing.T) {
+	t.Parallel()
+	var auth string
+	var requestBody map[string]interface{}
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v2/chat" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		auth = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+			t.Fatalf("decode request: %v", err)
+		}
+		_, _ = w.Write([]byte(`{"id":"resp-cohere-1","finish_reason":"TOOL_CALL","message":{"role":"assistant","tool_plan":"read the file","tool_calls":[{"id":"view_1","type":"function","function":{"name":"view","arguments":"{\"path\":\"docs/contracts.md\"}"}}]}}`))
+	}))
+	defer mock.Close()
+
+	r := NewWithHTTPClient(mock.Client())
+	turn, err := r.GenerateTurn(context.Background(), domain.AgentProcessRequest{
+		Input: []domain.AgentInputMessage{
+			{Role: "system", Type: "message", Content: []domain.RuntimeContent{{Type: "text", Text: "be brief"}}},
+			{Role: "user", Type: "message", Content: []domain.RuntimeContent{{Type: "text", Text: "view docs"}}},
+			{
+				Role: "assistant",
+				Type: "message",
+				Metadata: map[string]interface{}{
+					"tool_calls": []map[string]interface{}{{
+						"id":       "call_prev",
+						"type":     "function",
+						"function": map[string]interface{}{"name": "view", "arguments": `{"path":"a.md"}`},
+					}},
+				},
+			},
+			{
+				Role:     "tool",
+				Type:     "message",
+				Content:  []domain.RuntimeContent{{Type: "text", Text: "file body"}},
+				Metadata: map[string]interface{}{"tool_call_id": "call_prev", "name": "view"},
+			},
+		},
+	}, GenerateConfig{
+		ProviderID: ProviderCohere,
+		Model:      "command-a-03-2025",
+		APIKey:     "co-test",
+		BaseURL:    mock.URL,
+	}, []ToolDefinition{{Name: "view", Description: "view a file"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if auth != "Bearer co-test" {
+		t.Fatalf("unexpected auth header: %s", auth)
+	}
+	if requestBody["model"] != "command-a-03-2025" {
+		t.Fatalf("unexpected model: %#v", requestBody["model"])
+	}
+	if _, ok := requestBody["stream"]; ok {
+		t.Fatalf("non-stream request should omit stream, got=%#v", requestBody["stream"])
+	}
+	messages, ok := requestBody["messages"].([]interface{})
+	if !ok || len(messages) != 4 {
+		t.Fatalf("expected 4 messages, got=%#v", requestBody["messages"])
+	}
+	assistant, _ := messages[2].(map[string]interface{})
+	if calls, _ := assistant["tool_calls"].([]interface{}); len(calls) != 1 {
+		t.Fatalf("expected assistant tool_calls to be forwarded, got=%#v", assistant)
+	}
+	toolMsg, _ := messages[3].(map[string]interface{})
+	if toolMsg["role"] != "tool" || toolMsg["tool_call_id"] != "call_prev" || toolMsg["content"] != "file body" {
+		t.Fatalf("unexpected tool message: %#v", toolMsg)
+	}
+	tools, _ := requestBody["tools"].([]interface{})
+	if len(tools) != 1 {
+		t.Fatalf("expected one tool definition, got=%#v", requestBody["tools"])
+	}
+	tool, _ := tools[0].(map[string]interface{})
+	function, _ := tool["function"].(map[string]interface{})
+	if tool["type"] != "function" || function["name"] != "view" {
+		t.Fatalf("unexpected tool definition: %#v", tool)
+	}
+
+	if turn.ResponseID != "resp-cohere-1" {
+		t.Fatalf("unexpected response id: %q", turn.ResponseID)
+	}
+	if len(turn.ToolCalls) != 1 || turn.ToolCalls[0].ID != "view_1" || turn.ToolCalls[0].Name != "view" {
+		t.Fatalf("unexpected tool calls: %#v", turn.ToolCalls)
+	}
+	if got := turn.ToolCalls[0].Arguments["path"]; got != "docs/contracts.md" {
+		t.Fatalf("unexpected tool argument path: %#v", got)
+	}
+}
+
+func TestGenerateTurnStreamCohereAggregatesDeltas(t *testing.T) {
+	t.Parallel()
+	var requestBody map[string]interface{}
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v2/chat" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+			t.Fatalf("decode request: %v", err)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = fmt.Fprint(w, "event: message-start\ndata: {\"id\":\"resp-stream\",\"type\":\"message-start\",\"delta\":{\"message\":{\"role\":\"assistant\",\"content\":[]}}}\n\n")
+		_, _ = fmt.Fprint(w, "event: content-delta\ndata: {\"type\":\"content-delta\",\"index\":0,\"delta\":{\"message\":{\"content\":{\"text\":\"hel\"}}}}\n\n")
+		_, _ = fmt.Fprint(w, "event: content-delta\ndata: {\"type\":\"content-delta\",\"index\":0,\"delta\":{\"message\":{\"content\":{\"text\":\"lo\"}}}}\n\n")
+		_, _ = fmt.Fprint(w, "event: tool-call-start\ndata: {\"type\":\"tool-call-start\",\"index\":0,\"delta\":{\"message\":{\"tool_calls\":{\"id\":\"shell_1\",\"type\":\"function\",\"function\":{\"name\":\"shell\",\"arguments\":\"{\\\"command\\\":\\\"ec\"}}}}}\n\n")
+		_, _ = fmt.Fprint(w, "event: tool-call-delta\ndata: {\"type\":\"tool-call-delta\",\"index\":0,\"delta\":{\"message\":{\"tool_calls\":{\"function\":{\"arguments\":\"ho hi\\\"}\"}}}}}\n\n")
+		_, _ = fmt.Fprint(w, "event: message-end\ndata: {\"type\":\"message-end\",\"delta\":{\"finish_reason\":\"TOOL_CALL\"}}\n\n")
+	}))
+	defer mock.Close()
+
+	deltas := ""
+	r := NewWithHTTPClient(mock.Client())
+	turn, err := r.GenerateTurnStream(context.Background(), domain.AgentProcessRequest{
+		Input: []domain.AgentInputMessage{{
+			Role:    "user",
+			Type:    "message",
+			Content: []domain.RuntimeContent{{Type: "text", Text: "say hi"}},
+		}},
+	}, GenerateConfig{
+		ProviderID: ProviderCohere,
+		Model:      "command-a-03-2025",
+		APIKey:     "co-test",
+		BaseURL:    mock.URL,
+	}, []ToolDefinition{{Name: "shell"}}, func(delta string) { deltas += delta })
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if requestBody["stream"] != true {
+		t.Fatalf("expected stream=true in request, got=%#v", requestBody["stream"])
+	}
+	if turn.Text != "hello" || deltas != "hello" {
+		t.Fatalf("unexpected text=%q deltas=%q", turn.Text, deltas)
+	}
+	if turn.ResponseID != "resp-stream" {
+		t.Fatalf("unexpected response id: %q", turn.ResponseID)
+	}
+	if len(turn.ToolCalls) != 1 || turn.ToolCalls[0].Name != "shell" {
+		t.Fatalf("unexpected tool calls: %#v", turn.ToolCalls)
+	}
+	if got := turn.ToolCalls[0].Arguments["command"]; got != "echo hi" {
+		t.Fatalf("unexpected tool argument command: %#v", got)
+	}
+}
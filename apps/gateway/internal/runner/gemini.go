@@ -0,0 +1,510 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"nextai/apps/gateway/internal/domain"
+	"nextai/apps/gateway/internal/provider"
+)
+
+type geminiAdapter struct{}
+
+func (a *geminiAdapter) ID() string {
+	return provider.AdapterGemini
+}
+
+func (a *geminiAdapter) Capabilities() ProviderCapabilities {
+	return ProviderCapabilities{
+		Stream:      true,
+		ToolCall:    true,
+		Attachments: false,
+		Reasoning:   false,
+	}
+}
+
+func (a *geminiAdapter) GenerateTurn(ctx context.Context, req domain.AgentProcessRequest, cfg GenerateConfig, tools []ToolDefinition, runner *Runner) (TurnResult, error) {
+	return runner.generateGeminiTurn(ctx, req, cfg, tools)
+}
+
+func (a *geminiAdapter) GenerateTurnStream(
+	ctx context.Context,
+	req domain.AgentProcessRequest,
+	cfg GenerateConfig,
+	tools []ToolDefinition,
+	runner *Runner,
+	onDelta func(string),
+) (TurnResult, error) {
+	return runner.generateGeminiTurnStream(ctx, req, cfg, tools, onDelta)
+}
+
+func (r *Runner) generateGeminiTurn(ctx context.Context, req domain.AgentProcessRequest, cfg GenerateConfig, tools []ToolDefinition) (TurnResult, error) {
+	system, contents := toGeminiContents(req.Input)
+	if len(contents) == 0 {
+		return TurnResult{Text: generateDemoReply(req)}, nil
+	}
+	payload := geminiGenerateRequest{
+		Contents:          contents,
+		SystemInstruction: system,
+		Tools:             toGeminiTools(tools),
+	}
+
+	resp, cancel, err := r.doGeminiRequest(ctx, cfg, payload, false)
+	if err != nil {
+		return TurnResult{}, err
+	}
+	defer cancel()
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 2*1024*1024))
+	if err != nil {
+		return TurnResult{}, &RunnerError{
+			Code:    ErrorCodeProviderRequestFailed,
+			Message: "failed to read provider response",
+			Err:     err,
+		}
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return TurnResult{}, &RunnerError{
+			Code:         ErrorCodeProviderRequestFailed,
+			Message:      fmt.Sprintf("provider returned status %d", resp.StatusCode),
+			Status:       resp.StatusCode,
+			ProviderBody: providerErrorBody(respBody),
+		}
+	}
+
+	var completion geminiGenerateResponse
+	if err := json.Unmarshal(respBody, &completion); err != nil {
+		return TurnResult{}, &RunnerError{
+			Code:    ErrorCodeProviderInvalidReply,
+			Message: "provider response is not valid json",
+			Err:     err,
+		}
+	}
+
+	var textBuilder strings.Builder
+	rawCalls := []openAIToolCall{}
+	finishReason := ""
+	if candidate := completion.firstCandidate(); candidate != nil {
+		for _, part := range candidate.Content.Parts {
+			textBuilder.WriteString(part.Text)
+			if call, ok := part.toOpenAIToolCall(); ok {
+				rawCalls = append(rawCalls, call)
+			}
+		}
+		finishReason = strings.TrimSpace(candidate.FinishReason)
+	}
+	toolCalls, err := parseOpenAIToolCalls(assignGeminiCallIDs(rawCalls))
+	if err != nil {
+		return TurnResult{}, &RunnerError{
+			Code:    ErrorCodeProviderInvalidReply,
+			Message: err.Error(),
+			Err:     err,
+		}
+	}
+	text := strings.TrimSpace(textBuilder.String())
+	if text == "" && len(toolCalls) == 0 {
+		return TurnResult{}, &RunnerError{
+			Code:    ErrorCodeProviderInvalidReply,
+			Message: "provider response has empty content",
+		}
+	}
+
+	return TurnResult{
+		Text:         text,
+		ToolCalls:    toolCalls,
+		ResponseID:   strings.TrimSpace(completion.ResponseID),
+		Usage:        completion.UsageMetadata.toTurnUsage(),
+		Truncated:    strings.EqualFold(finishReason, "MAX_TOKENS"),
+		FinishReason: finishReason,
+		Model:        completion.ModelVersion,
+	}, nil
+}
+
+// generateGeminiTurnStream consumes streamGenerateContent?alt=sse. Every SSE
+// chunk is a full GenerateContentResponse holding only the new parts: text
+// parts are forwarded as deltas, function calls always arrive whole.
+func (r *Runner) generateGeminiTurnStream(
+	ctx context.Context,
+	req domain.AgentProcessRequest,
+	cfg GenerateConfig,
+	tools []ToolDefinition,
+	onDelta func(string),
+) (TurnResult, error) {
+	system, contents := toGeminiContents(req.Input)
+	if len(contents) == 0 {
+		return TurnResult{Text: generateDemoReply(req)}, nil
+	}
+	payload := geminiGenerateRequest{
+		Contents:          contents,
+		SystemInstruction: system,
+		Tools:             toGeminiTools(tools),
+	}
+
+	resp, cancel, err := r.doGeminiRequest(ctx, cfg, payload, true)
+	if err != nil {
+		return TurnResult{}, err
+	}
+	defer cancel()
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 2*1024*1024))
+		return TurnResult{}, &RunnerError{
+			Code:         ErrorCodeProviderRequestFailed,
+			Message:      fmt.Sprintf("provider returned status %d", resp.StatusCode),
+			Status:       resp.StatusCode,
+			ProviderBody: providerErrorBody(respBody),
+		}
+	}
+
+	var replyBuilder strings.Builder
+	rawCalls := []openAIToolCall{}
+	responseID := ""
+	model := ""
+	var usage *TurnUsage
+	finishReason := ""
+	processData := func(data string) error {
+		if isSSEControlToken(data) {
+			return nil
+		}
+		var chunk geminiGenerateResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("provider stream chunk is not valid json: %w; payload=%q", err, truncateText(data, 512))
+		}
+		if id := strings.TrimSpace(chunk.ResponseID); id != "" {
+			responseID = id
+		}
+		if version := strings.TrimSpace(chunk.ModelVersion); version != "" {
+			model = version
+		}
+		if chunkUsage := chunk.UsageMetadata.toTurnUsage(); chunkUsage != nil {
+			usage = chunkUsage
+		}
+		candidate := chunk.firstCandidate()
+		if candidate == nil {
+			return nil
+		}
+		for _, part := range candidate.Content.Parts {
+			if part.Text != "" {
+				replyBuilder.WriteString(part.Text)
+				if onDelta != nil {
+					onDelta(part.Text)
+				}
+			}
+			if call, ok := part.toOpenAIToolCall(); ok {
+				rawCalls = append(rawCalls, call)
+			}
+		}
+		if reason := strings.TrimSpace(candidate.FinishReason); reason != "" {
+			finishReason = reason
+		}
+		return nil
+	}
+
+	if err := consumeSSEData(resp.Body, processData); err != nil {
+		return TurnResult{}, mapStreamConsumeError(err)
+	}
+	if len(rawCalls) > 0 && finishReason == "" {
+		return TurnResult{}, incompleteToolCallStreamError()
+	}
+
+	parsedToolCalls, err := parseOpenAIToolCalls(assignGeminiCallIDs(rawCalls))
+	if err != nil {
+		return TurnResult{}, &RunnerError{
+			Code:    ErrorCodeProviderInvalidReply,
+			Message: err.Error(),
+			Err:     err,
+		}
+	}
+
+	reply := replyBuilder.String()
+	if strings.TrimSpace(reply) == "" && len(parsedToolCalls) == 0 {
+		return TurnResult{}, &RunnerError{
+			Code:    ErrorCodeProviderInvalidReply,
+			Message: "provider response has empty content",
+		}
+	}
+
+	return TurnResult{
+		Text:         reply,
+		ToolCalls:    parsedToolCalls,
+		ResponseID:   responseID,
+		Usage:        usage,
+		Truncated:    strings.EqualFold(finishReason, "MAX_TOKENS"),
+		FinishReason: finishReason,
+		Model:        model,
+	}, nil
+}
+
+// doGeminiRequest sends payload to the model's generateContent (or
+// streamGenerateContent?alt=sse) endpoint. The returned cancel func releases
+// the request timeout and must be called after the body is consumed.
+func (r *Runner) doGeminiRequest(ctx context.Context, cfg GenerateConfig, payload geminiGenerateRequest, stream bool) (*http.Response, context.CancelFunc, error) {
+	apiKey := strings.TrimSpace(cfg.APIKey)
+	if apiKey == "" {
+		return nil, nil, &RunnerError{Code: ErrorCodeProviderNotConfigured, Message: "provider api_key is required"}
+	}
+	model := strings.TrimPrefix(strings.TrimSpace(cfg.Model), "models/")
+	if model == "" {
+		return nil, nil, &RunnerError{Code: ErrorCodeProviderNotConfigured, Message: "provider model is required"}
+	}
+
+	baseURL := strings.TrimRight(strings.TrimSpace(cfg.BaseURL), "/")
+	if baseURL == "" {
+		baseURL = defaultGeminiBaseURL
+	}
+	endpoint := baseURL + "/models/" + url.PathEscape(model) + ":generateContent"
+	if stream {
+		endpoint = baseURL + "/models/" + url.PathEscape(model) + ":streamGenerateContent?alt=sse"
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, nil, &RunnerError{
+			Code:    ErrorCodeProviderRequestFailed,
+			Message: "failed to encode provider request",
+			Err:     err,
+		}
+	}
+
+	requestCtx := ctx
+	cancel := context.CancelFunc(func() {})
+	if cfg.TimeoutMS > 0 {
+		requestCtx, cancel = context.WithTimeout(ctx, time.Duration(cfg.TimeoutMS)*time.Millisecond)
+	}
+
+	httpReq, err := http.NewRequestWithContext(requestCtx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		cancel()
+		return nil, nil, &RunnerError{
+			Code:    ErrorCodeProviderRequestFailed,
+			Message: "failed to create provider request",
+			Err:     err,
+		}
+	}
+	httpReq.Header.Set("x-goog-api-key", apiKey)
+	httpReq.Header.Set("Content-Type", "application/json")
+	if stream {
+		httpReq.Header.Set("Accept", "text/event-stream")
+	} else {
+		httpReq.Header.Set("Accept", "application/json")
+	}
+	if err := setProviderHeaders(httpReq, cfg); err != nil {
+		cancel()
+		return nil, nil, err
+	}
+
+	resp, err := r.httpClient.Do(httpReq)
+	if err != nil {
+		cancel()
+		return nil, nil, &RunnerError{
+			Code:    ErrorCodeProviderRequestFailed,
+			Message: "provider request failed",
+			Err:     err,
+		}
+	}
+	return resp, cancel, nil
+}
+
+// toGeminiContents moves system messages into systemInstruction and maps the
+// rest onto Gemini's user/model roles: assistant tool calls become
+// functionCall parts and tool results become functionResponse parts on a user
+// turn, keyed by the tool name. Consecutive turns of one role are merged.
+func toGeminiContents(input []domain.AgentInputMessage) (*geminiContent, []geminiContent) {
+	systemParts := []geminiPart{}
+	out := make([]geminiContent, 0, len(input))
+	appendParts := func(role string, parts []geminiPart) {
+		if len(parts) == 0 {
+			return
+		}
+		if n := len(out); n > 0 && out[n-1].Role == role {
+			out[n-1].Parts = append(out[n-1].Parts, parts...)
+			return
+		}
+		out = append(out, geminiContent{Role: role, Parts: parts})
+	}
+
+	for _, msg := range input {
+		content := strings.TrimSpace(flattenText(msg.Content))
+		switch normalizeRole(msg.Role) {
+		case "system":
+			if content != "" {
+				systemParts = append(systemParts, geminiPart{Text: content})
+			}
+		case "assistant":
+			parts := []geminiPart{}
+			if content != "" {
+				parts = append(parts, geminiPart{Text: content})
+			}
+			for _, call := range parseToolCallsFromMetadata(msg.Metadata) {
+				args := json.RawMessage(strings.TrimSpace(call.Function.Arguments))
+				if !json.Valid(args) {
+					args = json.RawMessage("{}")
+				}
+				parts = append(parts, geminiPart{FunctionCall: &geminiFunctionCall{
+					ID:   call.ID,
+					Name: call.Function.Name,
+					Args: args,
+				}})
+			}
+			appendParts("model", parts)
+		case "tool":
+			name := metadataString(msg.Metadata, "name")
+			if name == "" {
+				continue
+			}
+			appendParts("user", []geminiPart{{FunctionResponse: &geminiFunctionResponse{
+				ID:       metadataString(msg.Metadata, "tool_call_id"),
+				Name:     name,
+				Response: map[string]interface{}{"content": content},
+			}}})
+		default:
+			if content == "" {
+				continue
+			}
+			appendParts("user", []geminiPart{{Text: content}})
+		}
+	}
+	if len(systemParts) == 0 {
+		return nil, out
+	}
+	return &geminiContent{Parts: systemParts}, out
+}
+
+func toGeminiTools(tools []ToolDefinition) []geminiTool {
+	declarations := make([]geminiFunctionDeclaration, 0, len(tools))
+	for _, item := range tools {
+		name := strings.TrimSpace(item.Name)
+		if name == "" {
+			continue
+		}
+		declaration := geminiFunctionDeclaration{
+			Name:        name,
+			Description: strings.TrimSpace(item.Description),
+		}
+		// Gemini rejects the permissive additionalProperties schema that
+		// normalizeToolParameters uses for tools without parameters.
+		if len(item.Parameters) > 0 {
+			declaration.Parameters = normalizeToolParameters(item.Parameters)
+		}
+		declarations = append(declarations, declaration)
+	}
+	if len(declarations) == 0 {
+		return nil
+	}
+	return []geminiTool{{FunctionDeclarations: declarations}}
+}
+
+type geminiGenerateRequest struct {
+	Contents          []geminiContent `json:"contents"`
+	SystemInstruction *geminiContent  `json:"systemInstruction,omitempty"`
+	Tools             []geminiTool    `json:"tools,omitempty"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiPart struct {
+	Text             string                  `json:"text,omitempty"`
+	FunctionCall     *geminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *geminiFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+func (p geminiPart) toOpenAIToolCall() (openAIToolCall, bool) {
+	if p.FunctionCall == nil {
+		return openAIToolCall{}, false
+	}
+	arguments := "{}"
+	if len(p.FunctionCall.Args) > 0 {
+		arguments = string(p.FunctionCall.Args)
+	}
+	return openAIToolCall{
+		ID:       strings.TrimSpace(p.FunctionCall.ID),
+		Type:     "function",
+		Function: openAIFunctionCall{Name: strings.TrimSpace(p.FunctionCall.Name), Arguments: arguments},
+	}, true
+}
+
+// assignGeminiCallIDs gives every call Gemini sent without an id a random
+// one. The positional call_N fallback of parseOpenAIToolCalls would repeat on
+// every turn, so calls from different steps of one run would share an id.
+func assignGeminiCallIDs(calls []openAIToolCall) []openAIToolCall {
+	for i := range calls {
+		if strings.TrimSpace(calls[i].ID) == "" {
+			calls[i].ID = newGeminiCallID()
+		}
+	}
+	return calls
+}
+
+func newGeminiCallID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("gemini_call_%d", time.Now().UnixNano())
+	}
+	return fmt.Sprintf("gemini_call_%x", buf)
+}
+
+type geminiFunctionCall struct {
+	ID   string          `json:"id,omitempty"`
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+type geminiFunctionResponse struct {
+	ID       string                 `json:"id,omitempty"`
+	Name     string                 `json:"name"`
+	Response map[string]interface{} `json:"response"`
+}
+
+type geminiTool struct {
+	FunctionDeclarations []geminiFunctionDeclaration `json:"functionDeclarations"`
+}
+
+type geminiFunctionDeclaration struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Parameters  map[string]interface{} `json:"parameters,omitempty"`
+}
+
+type geminiGenerateResponse struct {
+	Candidates    []geminiCandidate `json:"candidates"`
+	UsageMetadata *geminiUsage      `json:"usageMetadata,omitempty"`
+	ModelVersion  string            `json:"modelVersion,omitempty"`
+	ResponseID    string            `json:"responseId,omitempty"`
+}
+
+type geminiCandidate struct {
+	Content      geminiContent `json:"content"`
+	FinishReason string        `json:"finishReason,omitempty"`
+}
+
+func (r *geminiGenerateResponse) firstCandidate() *geminiCandidate {
+	if len(r.Candidates) == 0 {
+		return nil
+	}
+	return &r.Candidates[0]
+}
+
+type geminiUsage struct {
+	PromptTokenCount     int `json:"promptTokenCount"`
+	CandidatesTokenCount int `json:"candidatesTokenCount"`
+}
+
+func (u *geminiUsage) toTurnUsage() *TurnUsage {
+	if u == nil {
+		return nil
+	}
+	return &TurnUsage{PromptTokens: u.PromptTokenCount, CompletionTokens: u.CandidatesTokenCount}
+}
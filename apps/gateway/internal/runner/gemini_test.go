@@ -0,0 +1,208 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"nextai/apps/gateway/internal/domain"
+)
+
+func TestGenerateTurnGeminiRequestShapeAndToolCalls(t *testing.T) {
+	t.Parallel()
+	var apiKey string
+	var requestBody map[string]interface{}
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/models/gemini-2.0-flash:generateContent" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		apiKey = r.Header.Get("x-goog-api-key")
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+			t.Fatalf("decode request: %v", err)
+		}
+		_, _ = w.Write([]byte(`{"responseId":"resp-gemini-1","modelVersion":"gemini-2.0-flash-001","candidates":[{"content":{"role":"model","parts":[{"text":"reading it"},{"functionCall":{"name":"view","args":{"path":"docs/contracts.md"}}}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":20,"candidatesTokenCount":5}}`))
+	}))
+	defer mock.Close()
+
+	r := NewWithHTTPClient(mock.Client())
+	turn, err := r.GenerateTurn(context.Background(), domain.AgentProcessRequest{
+		Input: []domain.AgentInputMessage{
+			{Role: "system", Type: "message", Content: []domain.RuntimeContent{{Type: "text", Text: "be brief"}}},
+			{Role: "user", Type: "message", Content: []domain.RuntimeContent{{Type: "text", Text: "view docs"}}},
+			{
+				Role: "assistant",
+				Type: "message",
+				Metadata: map[string]interface{}{
+					"tool_calls": []map[string]interface{}{{
+						"id":       "call_prev",
+						"type":     "function",
+						"function": map[string]interface{}{"name": "view", "arguments": `{"path":"a.md"}`},
+					}},
+				},
+			},
+			{
+				Role:     "tool",
+				Type:     "message",
+				Content:  []domain.RuntimeContent{{Type: "text", Text: "file body"}},
+				Metadata: map[string]interface{}{"tool_call_id": "call_prev", "name": "view"},
+			},
+		},
+	}, GenerateConfig{
+		ProviderID: ProviderGemini,
+		Model:      "gemini-2.0-flash",
+		APIKey:     "gm-test",
+		BaseURL:    mock.URL,
+	}, []ToolDefinition{{Name: "view", Description: "view a file"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if apiKey != "gm-test" {
+		t.Fatalf("unexpected api key header: %q", apiKey)
+	}
+	system, _ := requestBody["systemInstruction"].(map[string]interface{})
+	systemParts, _ := system["parts"].([]interface{})
+	if len(systemParts) != 1 || systemParts[0].(map[string]interface{})["text"] != "be brief" {
+		t.Fatalf("expected system prompt in systemInstruction, got=%#v", requestBody["systemInstruction"])
+	}
+	contents, ok := requestBody["contents"].([]interface{})
+	if !ok || len(contents) != 3 {
+		t.Fatalf("expected 3 contents, got=%#v", requestBody["contents"])
+	}
+	modelTurn, _ := contents[1].(map[string]interface{})
+	modelParts, _ := modelTurn["parts"].([]interface{})
+	if modelTurn["role"] != "model" || len(modelParts) != 1 {
+		t.Fatalf("unexpected model content: %#v", modelTurn)
+	}
+	functionCall, _ := modelParts[0].(map[string]interface{})["functionCall"].(map[string]interface{})
+	args, _ := functionCall["args"].(map[string]interface{})
+	if functionCall["name"] != "view" || args["path"] != "a.md" {
+		t.Fatalf("unexpected functionCall part: %#v", modelParts[0])
+	}
+	toolTurn, _ := contents[2].(map[string]interface{})
+	toolParts, _ := toolTurn["parts"].([]interface{})
+	if toolTurn["role"] != "user" || len(toolParts) != 1 {
+		t.Fatalf("unexpected tool response content: %#v", toolTurn)
+	}
+	functionResponse, _ := toolParts[0].(map[string]interface{})["functionResponse"].(map[string]interface{})
+	response, _ := functionResponse["response"].(map[string]interface{})
+	if functionResponse["name"] != "view" || response["content"] != "file body" {
+		t.Fatalf("unexpected functionResponse part: %#v", toolParts[0])
+	}
+	tools, _ := requestBody["tools"].([]interface{})
+	if len(tools) != 1 {
+		t.Fatalf("expected one tool entry, got=%#v", requestBody["tools"])
+	}
+	declarations, _ := tools[0].(map[string]interface{})["functionDeclarations"].([]interface{})
+	if len(declarations) != 1 || declarations[0].(map[string]interface{})["name"] != "view" {
+		t.Fatalf("unexpected function declarations: %#v", tools[0])
+	}
+
+	if turn.Text != "reading it" || turn.ResponseID != "resp-gemini-1" || turn.Model != "gemini-2.0-flash-001" {
+		t.Fatalf("unexpected turn: %#v", turn)
+	}
+	if turn.Usage == nil || turn.Usage.PromptTokens != 20 || turn.Usage.CompletionTokens != 5 {
+		t.Fatalf("unexpected usage: %#v", turn.Usage)
+	}
+	if len(turn.ToolCalls) != 1 || turn.ToolCalls[0].Name != "view" {
+		t.Fatalf("unexpected tool calls: %#v", turn.ToolCalls)
+	}
+	if got := turn.ToolCalls[0].Arguments["path"]; got != "docs/contracts.md" {
+		t.Fatalf("unexpected tool argument path: %#v", got)
+	}
+}
+
+func TestGenerateTurnStreamGeminiAggregatesDeltas(t *testing.T) {
+	t.Parallel()
+	var query string
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/models/gemini-2.0-flash:streamGenerateContent" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		query = r.URL.RawQuery
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = fmt.Fprint(w, "data: {\"responseId\":\"resp-stream\",\"candidates\":[{\"content\":{\"role\":\"model\",\"parts\":[{\"text\":\"hel\"}]}}]}\n\n")
+		_, _ = fmt.Fprint(w, "data: {\"candidates\":[{\"content\":{\"role\":\"model\",\"parts\":[{\"text\":\"lo\"}]}}]}\n\n")
+		_, _ = fmt.Fprint(w, "data: {\"candidates\":[{\"content\":{\"role\":\"model\",\"parts\":[{\"functionCall\":{\"name\":\"shell\",\"args\":{\"command\":\"echo hi\"}}}]},\"finishReason\":\"STOP\"}],\"usageMetadata\":{\"promptTokenCount\":3,\"candidatesTokenCount\":4}}\n\n")
+	}))
+	defer mock.Close()
+
+	deltas := ""
+	r := NewWithHTTPClient(mock.Client())
+	turn, err := r.GenerateTurnStream(context.Background(), domain.AgentProcessRequest{
+		Input: []domain.AgentInputMessage{{
+			Role:    "user",
+			Type:    "message",
+			Content: []domain.RuntimeContent{{Type: "text", Text: "say hi"}},
+		}},
+	}, GenerateConfig{
+		ProviderID: ProviderGemini,
+		Model:      "gemini-2.0-flash",
+		APIKey:     "gm-test",
+		BaseURL:    mock.URL,
+	}, []ToolDefinition{{Name: "shell"}}, func(delta string) { deltas += delta })
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if query != "alt=sse" {
+		t.Fatalf("expected alt=sse query, got=%q", query)
+	}
+	if turn.Text != "hello" || deltas != "hello" {
+		t.Fatalf("unexpected text=%q deltas=%q", turn.Text, deltas)
+	}
+	if turn.ResponseID != "resp-stream" || turn.FinishReason != "STOP" {
+		t.Fatalf("unexpected turn metadata: %#v", turn)
+	}
+	if turn.Usage == nil || turn.Usage.CompletionTokens != 4 {
+		t.Fatalf("unexpected usage: %#v", turn.Usage)
+	}
+	if len(turn.ToolCalls) != 1 || turn.ToolCalls[0].Name != "shell" {
+		t.Fatalf("unexpected tool calls: %#v", turn.ToolCalls)
+	}
+	if got := turn.ToolCalls[0].Arguments["command"]; got != "echo hi" {
+		t.Fatalf("unexpected tool argument command: %#v", got)
+	}
+}
+
+func TestGenerateTurnGeminiAssignsUniqueCallIDsAcrossTurns(t *testing.T) {
+	t.Parallel()
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"name":"view","args":{"path":"a.md"}}},{"functionCall":{"name":"view","args":{"path":"b.md"}}}]},"finishReason":"STOP"}]}`))
+	}))
+	defer mock.Close()
+
+	r := NewWithHTTPClient(mock.Client())
+	seen := map[string]struct{}{}
+	for step := 0; step < 2; step++ {
+		turn, err := r.GenerateTurn(context.Background(), domain.AgentProcessRequest{
+			Input: []domain.AgentInputMessage{
+				{Role: "user", Type: "message", Content: []domain.RuntimeContent{{Type: "text", Text: "view both"}}},
+			},
+		}, GenerateConfig{
+			ProviderID: ProviderGemini,
+			Model:      "gemini-2.0-flash",
+			APIKey:     "gm-test",
+			BaseURL:    mock.URL,
+		}, []ToolDefinition{{Name: "view", Description: "view a file"}})
+		if err != nil {
+			t.Fatalf("step %d: unexpected error: %v", step, err)
+		}
+		if len(turn.ToolCalls) != 2 {
+			t.Fatalf("step %d: expected 2 tool calls, got=%#v", step, turn.ToolCalls)
+		}
+		for _, call := range turn.ToolCalls {
+			if !strings.HasPrefix(call.ID, "gemini_call_") {
+				t.Fatalf("step %d: expected synthetic call id, got=%q", step, call.ID)
+			}
+			if _, dup := seen[call.ID]; dup {
+				t.Fatalf("step %d: call id %q repeated", step, call.ID)
+			}
+			seen[call.ID] = struct{}{}
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultProviderFailureCooldown is how long a provider endpoint is skipped
+// after a connection error or 5xx response.
+const DefaultProviderFailureCooldown = 30 * time.Second
+
+// providerHealth remembers recently failing provider endpoints so callers fail
+// fast instead of waiting for another timeout. The first request after the
+// cooldown goes through as a probe.
+type providerHealth struct {
+	mu             sync.Mutex
+	cooldown       time.Duration
+	unhealthyUntil map[string]time.Time
+	now            func() time.Time
+}
+
+func newProviderHealth(cooldown time.Duration) *providerHealth {
+	return &providerHealth{
+		cooldown:       cooldown,
+		unhealthyUntil: map[string]time.Time{},
+		now:            time.Now,
+	}
+}
+
+// SetProviderFailureCooldown changes the fail-fast window; <= 0 disables it.
+func (r *Runner) SetProviderFailureCooldown(cooldown time.Duration) {
+	if r == nil || r.health == nil {
+		return
+	}
+	r.health.mu.Lock()
+	defer r.health.mu.Unlock()
+	r.health.cooldown = cooldown
+	if cooldown <= 0 {
+		r.health.unhealthyUntil = map[string]time.Time{}
+	}
+}
+
+func providerHealthKey(adapterID string, cfg GenerateConfig) string {
+	baseURL := strings.TrimRight(strings.TrimSpace(cfg.BaseURL), "/")
+	if baseURL == "" {
+		baseURL = strings.ToLower(strings.TrimSpace(cfg.ProviderID))
+	}
+	return adapterID + "|" + baseURL
+}
+
+func (h *providerHealth) check(key string) error {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	until, ok := h.unhealthyUntil[key]
+	if !ok {
+		return nil
+	}
+	remaining := until.Sub(h.now())
+	if remaining <= 0 {
+		return nil
+	}
+	return &RunnerError{
+		Code:    ErrorCodeProviderRequestFailed,
+		Message: fmt.Sprintf("provider is temporarily unavailable after a recent failure; retry in %s", remaining.Round(time.Second)),
+	}
+}
+
+func (h *providerHealth) record(ctx context.Context, key string, err error) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err == nil {
+		delete(h.unhealthyUntil, key)
+		return
+	}
+	// A cancelled or expired caller context says nothing about the provider.
+	if h.cooldown <= 0 || ctx.Err() != nil || !isProviderOutageError(err) {
+		return
+	}
+	h.unhealthyUntil[key] = h.now().Add(h.cooldown)
+}
+
+func isProviderOutageError(err error) bool {
+	var runnerErr *RunnerError
+	if !errors.As(err, &runnerErr) || runnerErr == nil || runnerErr.Code != ErrorCodeProviderRequestFailed {
+		return false
+	}
+	if runnerErr.Status >= 500 {
+		return true
+	}
+	var netErr net.Error
+	return runnerErr.Status == 0 && errors.As(runnerErr.Err, &netErr)
+}
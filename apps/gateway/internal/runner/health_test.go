@@ -0,0 +1,110 @@
+package runner
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"nextai/apps/gateway/internal/domain"
+)
+
+func healthTestRequest() domain.AgentProcessRequest {
+	return domain.AgentProcessRequest{
+		Input: []domain.AgentInputMessage{{
+			Role:    "user",
+			Type:    "message",
+			Content: []domain.RuntimeContent{{Type: "text", Text: "hello"}},
+		}},
+	}
+}
+
+func TestGenerateTurnFailsFastForUnreachableProviderWithinCooldown(t *testing.T) {
+	t.Parallel()
+	mock := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	baseURL := mock.URL
+	mock.Close()
+
+	r := New()
+	cfg := GenerateConfig{ProviderID: ProviderOpenAI, Model: "gpt-4o-mini", APIKey: "sk-test", BaseURL: baseURL}
+	if _, err := r.GenerateTurn(context.Background(), healthTestRequest(), cfg, nil); err == nil {
+		t.Fatal("expected unreachable provider to fail")
+	}
+
+	started := time.Now()
+	_, err := r.GenerateTurn(context.Background(), healthTestRequest(), cfg, nil)
+	if err == nil || !strings.Contains(err.Error(), "temporarily unavailable") {
+		t.Fatalf("expected fail-fast error, got=%v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 100*time.Millisecond {
+		t.Fatalf("expected fail-fast within cooldown, took %s", elapsed)
+	}
+	runnerErr, ok := err.(*RunnerError)
+	if !ok || runnerErr.Code != ErrorCodeProviderRequestFailed {
+		t.Fatalf("expected provider_request_failed, got=%#v", err)
+	}
+}
+
+func TestGenerateTurnReprobesProviderAfterCooldown(t *testing.T) {
+	t.Parallel()
+	var hits int32
+	healthy := int32(0)
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"back"}}]}`))
+	}))
+	defer mock.Close()
+
+	r := NewWithHTTPClient(mock.Client())
+	now := time.Now()
+	r.health.now = func() time.Time { return now }
+	cfg := GenerateConfig{ProviderID: ProviderOpenAI, Model: "gpt-4o-mini", APIKey: "sk-test", BaseURL: mock.URL}
+
+	if _, err := r.GenerateTurn(context.Background(), healthTestRequest(), cfg, nil); err == nil {
+		t.Fatal("expected 503 to fail")
+	}
+	if _, err := r.GenerateTurn(context.Background(), healthTestRequest(), cfg, nil); err == nil {
+		t.Fatal("expected fail-fast error within cooldown")
+	}
+	if got := atomic.LoadInt32(&hits); got != 1 {
+		t.Fatalf("expected provider to be skipped during cooldown, hits=%d", got)
+	}
+
+	atomic.StoreInt32(&healthy, 1)
+	now = now.Add(DefaultProviderFailureCooldown + time.Second)
+	turn, err := r.GenerateTurn(context.Background(), healthTestRequest(), cfg, nil)
+	if err != nil || turn.Text != "back" {
+		t.Fatalf("expected probe after cooldown to succeed, turn=%#v err=%v", turn, err)
+	}
+	if got := atomic.LoadInt32(&hits); got != 2 {
+		t.Fatalf("expected one probe request after cooldown, hits=%d", got)
+	}
+}
+
+func TestGenerateTurnClientErrorsDoNotTripHealthCache(t *testing.T) {
+	t.Parallel()
+	var hits int32
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer mock.Close()
+
+	r := NewWithHTTPClient(mock.Client())
+	cfg := GenerateConfig{ProviderID: ProviderOpenAI, Model: "gpt-4o-mini", APIKey: "sk-test", BaseURL: mock.URL}
+	for i := 0; i < 2; i++ {
+		if _, err := r.GenerateTurn(context.Background(), healthTestRequest(), cfg, nil); err == nil {
+			t.Fatal("expected 400 to fail")
+		}
+	}
+	if got := atomic.LoadInt32(&hits); got != 2 {
+		t.Fatalf("expected every 4xx request to reach the provider, hits=%d", got)
+	}
+}
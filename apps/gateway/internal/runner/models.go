@@ -0,0 +1,92 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"nextai/apps/gateway/internal/provider"
+)
+
+type openAIModelList struct {
+	Data []struct {
+		ID string `json:"id"`
+	} `json:"data"`
+}
+
+// ListModels queries the provider's OpenAI-style `GET /models` endpoint and
+// returns the model IDs it reports, sorted. Only openai- and codex-compatible
+// adapters expose that endpoint.
+func (r *Runner) ListModels(ctx context.Context, cfg GenerateConfig) ([]string, error) {
+	if cfg.AdapterID != provider.AdapterOpenAICompatible && cfg.AdapterID != provider.AdapterCodexCompatible {
+		return nil, &RunnerError{Code: ErrorCodeProviderNotSupported, Message: "provider does not support listing models"}
+	}
+	apiKey := strings.TrimSpace(cfg.APIKey)
+	if apiKey == "" {
+		return nil, &RunnerError{Code: ErrorCodeProviderNotConfigured, Message: "provider api_key is required"}
+	}
+	baseURL := strings.TrimRight(strings.TrimSpace(cfg.BaseURL), "/")
+	if baseURL == "" {
+		baseURL = defaultOpenAIBaseURL
+	}
+
+	requestCtx := ctx
+	cancel := func() {}
+	if cfg.TimeoutMS > 0 {
+		requestCtx, cancel = context.WithTimeout(ctx, time.Duration(cfg.TimeoutMS)*time.Millisecond)
+	}
+	defer cancel()
+
+	httpReq, err := http.NewRequestWithContext(requestCtx, http.MethodGet, baseURL+"/models", nil)
+	if err != nil {
+		return nil, &RunnerError{Code: ErrorCodeProviderRequestFailed, Message: "failed to create provider request", Err: err}
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+apiKey)
+	if err := setProviderHeaders(httpReq, cfg); err != nil {
+		return nil, err
+	}
+
+	resp, err := r.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, &RunnerError{Code: ErrorCodeProviderRequestFailed, Message: "provider request failed", Err: err}
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 2*1024*1024))
+	if err != nil {
+		return nil, &RunnerError{Code: ErrorCodeProviderRequestFailed, Message: "failed to read provider response", Err: err}
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return nil, &RunnerError{
+			Code:         ErrorCodeProviderRequestFailed,
+			Message:      fmt.Sprintf("provider returned status %d", resp.StatusCode),
+			Status:       resp.StatusCode,
+			ProviderBody: providerErrorBody(respBody),
+		}
+	}
+
+	var list openAIModelList
+	if err := json.Unmarshal(respBody, &list); err != nil {
+		return nil, &RunnerError{Code: ErrorCodeProviderInvalidReply, Message: "provider response is not valid json", Err: err}
+	}
+	seen := map[string]struct{}{}
+	out := make([]string, 0, len(list.Data))
+	for _, item := range list.Data {
+		id := strings.TrimSpace(item.ID)
+		if id == "" {
+			continue
+		}
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		out = append(out, id)
+	}
+	sort.Strings(out)
+	return out, nil
+}
@@ -20,11 +20,19 @@ import (
 )
 
 const (
-	ProviderDemo   = "demo"
-	ProviderOpenAI = "openai"
-	ProviderCodex  = "codex-compatible"
+	ProviderDemo      = "demo"
+	ProviderOpenAI    = "openai"
+	ProviderCodex     = "codex-compatible"
+	ProviderCohere    = "cohere"
+	ProviderAnthropic = "anthropic"
+	ProviderGemini    = "gemini"
 
-	defaultOpenAIBaseURL = "https://api.openai.com/v1"
+	defaultOpenAIBaseURL    = "https://api.openai.com/v1"
+	defaultCohereBaseURL    = "https://api.cohere.com"
+	defaultAnthropicBaseURL = "https://api.anthropic.com"
+	defaultGeminiBaseURL    = "https://generativelanguage.googleapis.com/v1beta"
+
+	providerErrorBodyMaxChars = 512
 
 	ErrorCodeProviderNotConfigured = "provider_not_configured"
 	ErrorCodeProviderNotSupported  = "provider_not_supported"
@@ -35,7 +43,12 @@ const (
 type RunnerError struct {
 	Code    string
 	Message string
-	Err     error
+	// Status is the upstream HTTP status when the provider answered with an error.
+	Status int
+	Err    error
+	// ProviderBody is the start of the provider's error response body, kept
+	// for debugging; it is only exposed to clients when explicitly enabled.
+	ProviderBody string
 }
 
 type InvalidToolCallError struct {
@@ -105,6 +118,21 @@ type GenerateConfig struct {
 	Store              bool
 	PromptCacheKey     string
 	PreviousResponseID string
+	// CompressRequests gzips request bodies larger than compressRequestThresholdBytes.
+	CompressRequests bool
+	// StreamUsage asks OpenAI-compatible streams for a final usage chunk via
+	// `stream_options.include_usage`. Off by default, since some compatible
+	// servers reject the field.
+	StreamUsage bool
+	// EndUserID is sent as the OpenAI `user` field for upstream abuse monitoring.
+	EndUserID string
+	// ParallelToolCalls is sent as `parallel_tool_calls` when tools are offered; nil
+	// leaves the provider default.
+	ParallelToolCalls *bool
+	// Temperature and MaxTokens are provider-level sampling defaults; nil and
+	// zero leave the provider default.
+	Temperature *float64
+	MaxTokens   int
 }
 
 type ToolDefinition struct {
@@ -123,6 +151,22 @@ type TurnResult struct {
 	Text       string
 	ToolCalls  []ToolCall
 	ResponseID string
+	// Usage is nil when the provider did not report token counts.
+	Usage *TurnUsage
+	// DroppedContentParts counts input parts the provider could not accept.
+	DroppedContentParts int
+	// Truncated reports that the provider stopped at its output token limit.
+	Truncated bool
+	// FinishReason, Model and SystemFingerprint are passed through from the
+	// provider response as reported; empty when the provider omits them.
+	FinishReason      string
+	Model             string
+	SystemFingerprint string
+}
+
+type TurnUsage struct {
+	PromptTokens     int
+	CompletionTokens int
 }
 
 type ProviderCapabilities struct {
@@ -147,6 +191,7 @@ type Runner struct {
 	httpClient          *http.Client
 	adapters            map[string]ProviderAdapter
 	adapterCapabilities map[string]ProviderCapabilities
+	health              *providerHealth
 }
 
 func New() *Runner {
@@ -161,10 +206,14 @@ func NewWithHTTPClient(client *http.Client) *Runner {
 		httpClient:          client,
 		adapters:            map[string]ProviderAdapter{},
 		adapterCapabilities: map[string]ProviderCapabilities{},
+		health:              newProviderHealth(DefaultProviderFailureCooldown),
 	}
 	r.registerAdapter(&demoAdapter{})
 	r.registerAdapter(&openAICompatibleAdapter{})
 	r.registerAdapter(&codexCompatibleAdapter{})
+	r.registerAdapter(&cohereAdapter{})
+	r.registerAdapter(&anthropicAdapter{})
+	r.registerAdapter(&geminiAdapter{})
 	return r
 }
 
@@ -209,11 +258,19 @@ func (r *Runner) GenerateTurn(ctx context.Context, req domain.AgentProcessReques
 		}
 	}
 	capabilities := r.capabilitiesForAdapter(adapterID)
-	preparedReq, preparedCfg, preparedTools, prepErr := prepareTurnInputsByCapabilities(req, cfg, tools, capabilities)
-	if prepErr != nil {
-		return TurnResult{}, prepErr
+	preparedReq, preparedCfg, preparedTools, droppedParts := prepareTurnInputsByCapabilities(req, cfg, tools, capabilities)
+	healthKey := providerHealthKey(adapterID, cfg)
+	if adapterID != provider.AdapterDemo {
+		if err := r.health.check(healthKey); err != nil {
+			return TurnResult{}, err
+		}
+	}
+	turn, err := adapter.GenerateTurn(ctx, preparedReq, preparedCfg, preparedTools, r)
+	if adapterID != provider.AdapterDemo {
+		r.health.record(ctx, healthKey, err)
 	}
-	return adapter.GenerateTurn(ctx, preparedReq, preparedCfg, preparedTools, r)
+	turn.DroppedContentParts = droppedParts
+	return turn, err
 }
 
 func (r *Runner) GenerateReply(ctx context.Context, req domain.AgentProcessRequest, cfg GenerateConfig) (string, error) {
@@ -266,9 +323,12 @@ func (r *Runner) GenerateTurnStream(
 		}
 	}
 	capabilities := r.capabilitiesForAdapter(adapterID)
-	preparedReq, preparedCfg, preparedTools, prepErr := prepareTurnInputsByCapabilities(req, cfg, tools, capabilities)
-	if prepErr != nil {
-		return TurnResult{}, prepErr
+	preparedReq, preparedCfg, preparedTools, droppedParts := prepareTurnInputsByCapabilities(req, cfg, tools, capabilities)
+	healthKey := providerHealthKey(adapterID, cfg)
+	if adapterID != provider.AdapterDemo {
+		if err := r.health.check(healthKey); err != nil {
+			return TurnResult{}, err
+		}
 	}
 
 	if capabilities.Stream {
@@ -279,16 +339,25 @@ func (r *Runner) GenerateTurnStream(
 				Message: fmt.Sprintf("adapter %q declares stream capability but does not implement stream adapter", adapterID),
 			}
 		}
-		return streamAdapter.GenerateTurnStream(ctx, preparedReq, preparedCfg, preparedTools, r, onDelta)
+		turn, err := streamAdapter.GenerateTurnStream(ctx, preparedReq, preparedCfg, preparedTools, r, onDelta)
+		if adapterID != provider.AdapterDemo {
+			r.health.record(ctx, healthKey, err)
+		}
+		turn.DroppedContentParts = droppedParts
+		return turn, err
 	}
 
 	turn, err := adapter.GenerateTurn(ctx, preparedReq, preparedCfg, preparedTools, r)
+	if adapterID != provider.AdapterDemo {
+		r.health.record(ctx, healthKey, err)
+	}
 	if err != nil {
 		return TurnResult{}, err
 	}
 	if onDelta != nil && turn.Text != "" {
 		onDelta(turn.Text)
 	}
+	turn.DroppedContentParts = droppedParts
 	return turn, nil
 }
 
@@ -307,13 +376,8 @@ func prepareTurnInputsByCapabilities(
 	cfg GenerateConfig,
 	tools []ToolDefinition,
 	capabilities ProviderCapabilities,
-) (domain.AgentProcessRequest, GenerateConfig, []ToolDefinition, *RunnerError) {
-	if !capabilities.Attachments && requestContainsAttachment(req) {
-		return domain.AgentProcessRequest{}, GenerateConfig{}, nil, &RunnerError{
-			Code:    ErrorCodeProviderNotSupported,
-			Message: "provider does not support attachments",
-		}
-	}
+) (domain.AgentProcessRequest, GenerateConfig, []ToolDefinition, int) {
+	preparedReq, dropped := filterContentPartsByCapabilities(req, capabilities)
 
 	preparedCfg := cfg
 	if !capabilities.Reasoning {
@@ -325,20 +389,70 @@ func prepareTurnInputsByCapabilities(
 		preparedTools = nil
 	}
 
-	return req, preparedCfg, preparedTools, nil
+	return preparedReq, preparedCfg, preparedTools, dropped
 }
 
-func requestContainsAttachment(req domain.AgentProcessRequest) bool {
+// filterContentPartsByCapabilities removes input parts the adapter cannot
+// send: text is always kept and images only when attachments are supported.
+// The request is copied when anything is dropped.
+func filterContentPartsByCapabilities(req domain.AgentProcessRequest, capabilities ProviderCapabilities) (domain.AgentProcessRequest, int) {
+	keep := func(part domain.RuntimeContent) bool {
+		if isTextContentPart(part) {
+			return true
+		}
+		return capabilities.Attachments && isImageContentPart(part)
+	}
+	dropped := 0
 	for _, msg := range req.Input {
 		for _, part := range msg.Content {
-			partType := strings.ToLower(strings.TrimSpace(part.Type))
-			if partType == "" || partType == "text" {
-				continue
+			if !keep(part) {
+				dropped++
+			}
+		}
+	}
+	if dropped == 0 {
+		return req, 0
+	}
+	out := req
+	out.Input = make([]domain.AgentInputMessage, 0, len(req.Input))
+	for _, msg := range req.Input {
+		filtered := msg
+		filtered.Content = make([]domain.RuntimeContent, 0, len(msg.Content))
+		for _, part := range msg.Content {
+			if keep(part) {
+				filtered.Content = append(filtered.Content, part)
 			}
-			return true
 		}
+		out.Input = append(out.Input, filtered)
 	}
-	return false
+	return out, dropped
+}
+
+func isTextContentPart(part domain.RuntimeContent) bool {
+	partType := strings.ToLower(strings.TrimSpace(part.Type))
+	return partType == "" || partType == "text"
+}
+
+func isImageContentPart(part domain.RuntimeContent) bool {
+	switch strings.ToLower(strings.TrimSpace(part.Type)) {
+	case "image", "image_url", "input_image":
+		return strings.TrimSpace(part.ImageURL) != "" || strings.TrimSpace(part.Data) != ""
+	default:
+		return false
+	}
+}
+
+// contentPartImageURL returns the URL to send for an image part, building a
+// data URL from inline base64 data when needed.
+func contentPartImageURL(part domain.RuntimeContent) string {
+	if url := strings.TrimSpace(part.ImageURL); url != "" {
+		return url
+	}
+	mimeType := strings.TrimSpace(part.MimeType)
+	if mimeType == "" {
+		mimeType = "image/png"
+	}
+	return "data:" + mimeType + ";base64," + strings.TrimSpace(part.Data)
 }
 
 type demoAdapter struct{}
@@ -370,7 +484,7 @@ func (a *openAICompatibleAdapter) Capabilities() ProviderCapabilities {
 	return ProviderCapabilities{
 		Stream:      true,
 		ToolCall:    true,
-		Attachments: false,
+		Attachments: true,
 		Reasoning:   true,
 	}
 }
@@ -428,6 +542,12 @@ func defaultAdapterForProvider(providerID string) string {
 		return provider.AdapterOpenAICompatible
 	case ProviderCodex:
 		return provider.AdapterCodexCompatible
+	case ProviderCohere:
+		return provider.AdapterCohere
+	case ProviderAnthropic:
+		return provider.AdapterAnthropic
+	case ProviderGemini:
+		return provider.AdapterGemini
 	}
 	if provider.IsCodexCompatibleProviderID(providerID) {
 		return provider.AdapterCodexCompatible
@@ -479,6 +599,38 @@ func applyReasoningEffort(payload *openAIChatRequest, cfg GenerateConfig) {
 	payload.ReasoningEffort = normalizeReasoningEffort(cfg.ReasoningEffort)
 }
 
+func applyEndUserID(payload *openAIChatRequest, cfg GenerateConfig) {
+	if payload == nil {
+		return
+	}
+	payload.User = strings.TrimSpace(cfg.EndUserID)
+}
+
+// applyParallelToolCalls forwards the toggle only alongside tools; providers
+// reject parallel_tool_calls on requests without any.
+func applyParallelToolCalls(payload *openAIChatRequest, cfg GenerateConfig) {
+	if payload == nil || cfg.ParallelToolCalls == nil || len(payload.Tools) == 0 {
+		return
+	}
+	parallel := *cfg.ParallelToolCalls
+	payload.ParallelToolCalls = &parallel
+}
+
+// applySamplingDefaults sends the provider temperature and max_tokens defaults
+// only when configured, so unset fields keep the upstream defaults.
+func applySamplingDefaults(payload *openAIChatRequest, cfg GenerateConfig) {
+	if payload == nil {
+		return
+	}
+	if cfg.Temperature != nil {
+		temperature := *cfg.Temperature
+		payload.Temperature = &temperature
+	}
+	if cfg.MaxTokens > 0 {
+		payload.MaxTokens = cfg.MaxTokens
+	}
+}
+
 func (r *Runner) generateOpenAICompatibleTurn(ctx context.Context, req domain.AgentProcessRequest, cfg GenerateConfig, tools []ToolDefinition) (TurnResult, error) {
 	apiKey := strings.TrimSpace(cfg.APIKey)
 	if apiKey == "" {
@@ -496,6 +648,9 @@ func (r *Runner) generateOpenAICompatibleTurn(ctx context.Context, req domain.Ag
 		Tools:    toOpenAITools(tools),
 	}
 	applyReasoningEffort(&payload, cfg)
+	applyEndUserID(&payload, cfg)
+	applyParallelToolCalls(&payload, cfg)
+	applySamplingDefaults(&payload, cfg)
 	applyOpenAICompatibleCacheConfig(&payload, cfg)
 	if len(payload.Messages) == 0 {
 		return TurnResult{Text: generateDemoReply(req)}, nil
@@ -510,6 +665,15 @@ func (r *Runner) generateOpenAICompatibleTurn(ctx context.Context, req domain.Ag
 		}
 	}
 
+	body, contentEncoding, err := providerRequestBody(cfg, body)
+	if err != nil {
+		return TurnResult{}, &RunnerError{
+			Code:    ErrorCodeProviderRequestFailed,
+			Message: "failed to compress provider request",
+			Err:     err,
+		}
+	}
+
 	requestCtx := ctx
 	cancel := func() {}
 	if cfg.TimeoutMS > 0 {
@@ -527,13 +691,11 @@ func (r *Runner) generateOpenAICompatibleTurn(ctx context.Context, req domain.Ag
 	}
 	httpReq.Header.Set("Authorization", "Bearer "+apiKey)
 	httpReq.Header.Set("Content-Type", "application/json")
-	for key, value := range cfg.Headers {
-		k := strings.TrimSpace(key)
-		v := strings.TrimSpace(value)
-		if k == "" || v == "" {
-			continue
-		}
-		httpReq.Header.Set(k, v)
+	if contentEncoding != "" {
+		httpReq.Header.Set("Content-Encoding", contentEncoding)
+	}
+	if err := setProviderHeaders(httpReq, cfg); err != nil {
+		return TurnResult{}, err
 	}
 
 	resp, err := r.httpClient.Do(httpReq)
@@ -557,8 +719,10 @@ func (r *Runner) generateOpenAICompatibleTurn(ctx context.Context, req domain.Ag
 
 	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
 		return TurnResult{}, &RunnerError{
-			Code:    ErrorCodeProviderRequestFailed,
-			Message: fmt.Sprintf("provider returned status %d", resp.StatusCode),
+			Code:         ErrorCodeProviderRequestFailed,
+			Message:      fmt.Sprintf("provider returned status %d", resp.StatusCode),
+			Status:       resp.StatusCode,
+			ProviderBody: providerErrorBody(respBody),
 		}
 	}
 
@@ -595,9 +759,14 @@ func (r *Runner) generateOpenAICompatibleTurn(ctx context.Context, req domain.Ag
 	}
 
 	return TurnResult{
-		Text:       text,
-		ToolCalls:  toolCalls,
-		ResponseID: strings.TrimSpace(completion.ID),
+		Text:              text,
+		ToolCalls:         toolCalls,
+		ResponseID:        strings.TrimSpace(completion.ID),
+		Usage:             completion.Usage.toTurnUsage(),
+		Truncated:         completion.Choices[0].FinishReason == "length",
+		FinishReason:      completion.Choices[0].FinishReason,
+		Model:             strings.TrimSpace(completion.Model),
+		SystemFingerprint: strings.TrimSpace(completion.SystemFingerprint),
 	}, nil
 }
 
@@ -624,7 +793,13 @@ func (r *Runner) generateOpenAICompatibleTurnStream(
 		Tools:    toOpenAITools(tools),
 		Stream:   true,
 	}
+	if cfg.StreamUsage {
+		payload.StreamOptions = &openAIStreamOptions{IncludeUsage: true}
+	}
 	applyReasoningEffort(&payload, cfg)
+	applyEndUserID(&payload, cfg)
+	applyParallelToolCalls(&payload, cfg)
+	applySamplingDefaults(&payload, cfg)
 	applyOpenAICompatibleCacheConfig(&payload, cfg)
 	if len(payload.Messages) == 0 {
 		return TurnResult{Text: generateDemoReply(req)}, nil
@@ -639,6 +814,15 @@ func (r *Runner) generateOpenAICompatibleTurnStream(
 		}
 	}
 
+	body, contentEncoding, err := providerRequestBody(cfg, body)
+	if err != nil {
+		return TurnResult{}, &RunnerError{
+			Code:    ErrorCodeProviderRequestFailed,
+			Message: "failed to compress provider request",
+			Err:     err,
+		}
+	}
+
 	requestCtx := ctx
 	cancel := func() {}
 	if cfg.TimeoutMS > 0 {
@@ -656,14 +840,12 @@ func (r *Runner) generateOpenAICompatibleTurnStream(
 	}
 	httpReq.Header.Set("Authorization", "Bearer "+apiKey)
 	httpReq.Header.Set("Content-Type", "application/json")
+	if contentEncoding != "" {
+		httpReq.Header.Set("Content-Encoding", contentEncoding)
+	}
 	httpReq.Header.Set("Accept", "text/event-stream")
-	for key, value := range cfg.Headers {
-		k := strings.TrimSpace(key)
-		v := strings.TrimSpace(value)
-		if k == "" || v == "" {
-			continue
-		}
-		httpReq.Header.Set(k, v)
+	if err := setProviderHeaders(httpReq, cfg); err != nil {
+		return TurnResult{}, err
 	}
 
 	resp, err := r.httpClient.Do(httpReq)
@@ -679,15 +861,28 @@ func (r *Runner) generateOpenAICompatibleTurnStream(
 	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
 		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 2*1024*1024))
 		return TurnResult{}, &RunnerError{
-			Code:    ErrorCodeProviderRequestFailed,
-			Message: fmt.Sprintf("provider returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody))),
+			Code:         ErrorCodeProviderRequestFailed,
+			Message:      fmt.Sprintf("provider returned status %d", resp.StatusCode),
+			Status:       resp.StatusCode,
+			ProviderBody: providerErrorBody(respBody),
 		}
 	}
 
 	var replyBuilder strings.Builder
 	toolCalls := map[int]*openAIToolCall{}
 	responseID := ""
+	truncated := false
+	// streamFinished is set by a finish_reason or [DONE]; without it buffered
+	// tool-call arguments may be cut off mid-JSON.
+	streamFinished := false
+	finishReason := ""
+	model := ""
+	systemFingerprint := ""
+	var usage *TurnUsage
 	processData := func(data string) error {
+		if isSSEDoneToken(data) {
+			streamFinished = true
+		}
 		if isSSEControlToken(data) {
 			return nil
 		}
@@ -698,10 +893,26 @@ func (r *Runner) generateOpenAICompatibleTurnStream(
 		if id := strings.TrimSpace(chunk.ID); id != "" {
 			responseID = id
 		}
+		if chunkModel := strings.TrimSpace(chunk.Model); chunkModel != "" {
+			model = chunkModel
+		}
+		if fingerprint := strings.TrimSpace(chunk.SystemFingerprint); fingerprint != "" {
+			systemFingerprint = fingerprint
+		}
+		if chunkUsage := chunk.Usage.toTurnUsage(); chunkUsage != nil {
+			usage = chunkUsage
+		}
 		if len(chunk.Choices) == 0 {
 			return nil
 		}
 		for _, choice := range chunk.Choices {
+			if choice.FinishReason != "" {
+				streamFinished = true
+				finishReason = choice.FinishReason
+			}
+			if choice.FinishReason == "length" {
+				truncated = true
+			}
 			delta := extractOpenAIDeltaContent(choice.Delta.Content)
 			if delta != "" {
 				replyBuilder.WriteString(delta)
@@ -739,6 +950,9 @@ func (r *Runner) generateOpenAICompatibleTurnStream(
 	if err := consumeSSEData(resp.Body, processData); err != nil {
 		return TurnResult{}, mapStreamConsumeError(err)
 	}
+	if len(toolCalls) > 0 && !streamFinished {
+		return TurnResult{}, incompleteToolCallStreamError()
+	}
 
 	orderedIndexes := make([]int, 0, len(toolCalls))
 	for idx := range toolCalls {
@@ -772,9 +986,14 @@ func (r *Runner) generateOpenAICompatibleTurnStream(
 	}
 
 	return TurnResult{
-		Text:       reply,
-		ToolCalls:  parsedToolCalls,
-		ResponseID: responseID,
+		Text:              reply,
+		ToolCalls:         parsedToolCalls,
+		ResponseID:        responseID,
+		Usage:             usage,
+		Truncated:         truncated,
+		FinishReason:      finishReason,
+		Model:             model,
+		SystemFingerprint: systemFingerprint,
 	}, nil
 }
 
@@ -829,6 +1048,15 @@ func (r *Runner) generateCodexCompatibleTurnStream(
 		}
 	}
 
+	body, contentEncoding, err := providerRequestBody(cfg, body)
+	if err != nil {
+		return TurnResult{}, &RunnerError{
+			Code:    ErrorCodeProviderRequestFailed,
+			Message: "failed to compress provider request",
+			Err:     err,
+		}
+	}
+
 	requestCtx := ctx
 	cancel := func() {}
 	if cfg.TimeoutMS > 0 {
@@ -846,14 +1074,12 @@ func (r *Runner) generateCodexCompatibleTurnStream(
 	}
 	httpReq.Header.Set("Authorization", "Bearer "+apiKey)
 	httpReq.Header.Set("Content-Type", "application/json")
+	if contentEncoding != "" {
+		httpReq.Header.Set("Content-Encoding", contentEncoding)
+	}
 	httpReq.Header.Set("Accept", "text/event-stream")
-	for key, value := range cfg.Headers {
-		k := strings.TrimSpace(key)
-		v := strings.TrimSpace(value)
-		if k == "" || v == "" {
-			continue
-		}
-		httpReq.Header.Set(k, v)
+	if err := setProviderHeaders(httpReq, cfg); err != nil {
+		return TurnResult{}, err
 	}
 
 	resp, err := r.httpClient.Do(httpReq)
@@ -869,8 +1095,10 @@ func (r *Runner) generateCodexCompatibleTurnStream(
 	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
 		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 2*1024*1024))
 		return TurnResult{}, &RunnerError{
-			Code:    ErrorCodeProviderRequestFailed,
-			Message: fmt.Sprintf("provider returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody))),
+			Code:         ErrorCodeProviderRequestFailed,
+			Message:      fmt.Sprintf("provider returned status %d", resp.StatusCode),
+			Status:       resp.StatusCode,
+			ProviderBody: providerErrorBody(respBody),
 		}
 	}
 
@@ -879,6 +1107,7 @@ func (r *Runner) generateCodexCompatibleTurnStream(
 	sawDelta := false
 	rawToolCalls := make([]codexResponseFunctionCall, 0, 1)
 	responseID := ""
+	var usage *TurnUsage
 
 	processData := func(data string) error {
 		if isSSEControlToken(data) {
@@ -895,6 +1124,9 @@ func (r *Runner) generateCodexCompatibleTurnStream(
 				if id := strings.TrimSpace(event.Response.ID); id != "" {
 					responseID = id
 				}
+				if eventUsage := event.Response.Usage.toTurnUsage(); eventUsage != nil {
+					usage = eventUsage
+				}
 			}
 		case "response.output_text.delta":
 			delta := event.Delta
@@ -964,7 +1196,7 @@ func (r *Runner) generateCodexCompatibleTurnStream(
 		}
 	}
 
-	return TurnResult{Text: reply, ToolCalls: toolCalls, ResponseID: responseID}, nil
+	return TurnResult{Text: reply, ToolCalls: toolCalls, ResponseID: responseID, Usage: usage}, nil
 }
 
 func toCodexResponsesInput(input []domain.AgentInputMessage) (string, []codexResponsesInputItem) {
@@ -1124,6 +1356,19 @@ type codexResponsesStreamEvent struct {
 type codexResponseEventStatus struct {
 	ID    string                   `json:"id,omitempty"`
 	Error *codexResponseEventError `json:"error,omitempty"`
+	Usage *codexResponseUsage      `json:"usage,omitempty"`
+}
+
+type codexResponseUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+func (u *codexResponseUsage) toTurnUsage() *TurnUsage {
+	if u == nil {
+		return nil
+	}
+	return &TurnUsage{PromptTokens: u.InputTokens, CompletionTokens: u.OutputTokens}
 }
 
 type codexResponseEventError struct {
@@ -1157,9 +1402,18 @@ type openAIChatRequest struct {
 	Tools              []openAIToolDefinition `json:"tools,omitempty"`
 	ReasoningEffort    string                 `json:"reasoning_effort,omitempty"`
 	Stream             bool                   `json:"stream,omitempty"`
+	StreamOptions      *openAIStreamOptions   `json:"stream_options,omitempty"`
 	Store              bool                   `json:"store,omitempty"`
 	PromptCacheKey     string                 `json:"prompt_cache_key,omitempty"`
 	PreviousResponseID string                 `json:"previous_response_id,omitempty"`
+	User               string                 `json:"user,omitempty"`
+	ParallelToolCalls  *bool                  `json:"parallel_tool_calls,omitempty"`
+	Temperature        *float64               `json:"temperature,omitempty"`
+	MaxTokens          int                    `json:"max_tokens,omitempty"`
+}
+
+type openAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
 }
 
 type openAIMessage struct {
@@ -1170,6 +1424,16 @@ type openAIMessage struct {
 	Name       string           `json:"name,omitempty"`
 }
 
+type openAIContentPart struct {
+	Type     string          `json:"type"`
+	Text     string          `json:"text,omitempty"`
+	ImageURL *openAIImageURL `json:"image_url,omitempty"`
+}
+
+type openAIImageURL struct {
+	URL string `json:"url"`
+}
+
 type openAIToolDefinition struct {
 	Type     string             `json:"type"`
 	Function openAIToolFunction `json:"function"`
@@ -1193,23 +1457,43 @@ type openAIFunctionCall struct {
 }
 
 type openAIChatResponse struct {
-	ID      string `json:"id,omitempty"`
-	Choices []struct {
+	ID                string `json:"id,omitempty"`
+	Model             string `json:"model,omitempty"`
+	SystemFingerprint string `json:"system_fingerprint,omitempty"`
+	Choices           []struct {
 		Message struct {
 			Content   json.RawMessage  `json:"content"`
 			ToolCalls []openAIToolCall `json:"tool_calls,omitempty"`
 		} `json:"message"`
+		FinishReason string `json:"finish_reason,omitempty"`
 	} `json:"choices"`
+	Usage *openAIUsage `json:"usage,omitempty"`
+}
+
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+func (u *openAIUsage) toTurnUsage() *TurnUsage {
+	if u == nil {
+		return nil
+	}
+	return &TurnUsage{PromptTokens: u.PromptTokens, CompletionTokens: u.CompletionTokens}
 }
 
 type openAIChatStreamResponse struct {
-	ID      string `json:"id,omitempty"`
-	Choices []struct {
+	ID                string `json:"id,omitempty"`
+	Model             string `json:"model,omitempty"`
+	SystemFingerprint string `json:"system_fingerprint,omitempty"`
+	Choices           []struct {
 		Delta struct {
 			Content   json.RawMessage        `json:"content"`
 			ToolCalls []openAIStreamToolCall `json:"tool_calls,omitempty"`
 		} `json:"delta"`
+		FinishReason string `json:"finish_reason,omitempty"`
 	} `json:"choices"`
+	Usage *openAIUsage `json:"usage,omitempty"`
 }
 
 type openAIStreamToolCall struct {
@@ -1254,6 +1538,15 @@ func toOpenAIMessages(input []domain.AgentInputMessage) []openAIMessage {
 				item.Name = name
 			}
 			out = append(out, item)
+		case "user":
+			if parts := toOpenAIContentParts(msg.Content); parts != nil {
+				out = append(out, openAIMessage{Role: role, Content: parts})
+				continue
+			}
+			if content == "" {
+				continue
+			}
+			out = append(out, openAIMessage{Role: role, Content: content})
 		default:
 			if content == "" {
 				continue
@@ -1264,6 +1557,36 @@ func toOpenAIMessages(input []domain.AgentInputMessage) []openAIMessage {
 	return out
 }
 
+// toOpenAIContentParts returns the multi-part content for a user message that
+// carries images, or nil when plain text content is enough.
+func toOpenAIContentParts(content []domain.RuntimeContent) []openAIContentPart {
+	hasImage := false
+	for _, part := range content {
+		if isImageContentPart(part) {
+			hasImage = true
+			break
+		}
+	}
+	if !hasImage {
+		return nil
+	}
+	parts := make([]openAIContentPart, 0, len(content))
+	for _, part := range content {
+		switch {
+		case isImageContentPart(part):
+			parts = append(parts, openAIContentPart{
+				Type:     "image_url",
+				ImageURL: &openAIImageURL{URL: contentPartImageURL(part)},
+			})
+		case isTextContentPart(part):
+			if text := strings.TrimSpace(part.Text); text != "" {
+				parts = append(parts, openAIContentPart{Type: "text", Text: text})
+			}
+		}
+	}
+	return parts
+}
+
 func toOpenAITools(tools []ToolDefinition) []openAIToolDefinition {
 	if len(tools) == 0 {
 		return nil
@@ -1379,6 +1702,11 @@ func normalizeReasoningEffort(raw string) string {
 	return strings.ToLower(strings.TrimSpace(raw))
 }
 
+// providerErrorBody trims an error response body down to a debug snippet.
+func providerErrorBody(body []byte) string {
+	return truncateText(strings.TrimSpace(string(body)), providerErrorBodyMaxChars)
+}
+
 func truncateText(text string, limit int) string {
 	if limit <= 0 {
 		return ""
@@ -1539,6 +1867,10 @@ func consumeSSEData(reader io.Reader, onData func(string) error) error {
 	return nil
 }
 
+func isSSEDoneToken(data string) bool {
+	return strings.EqualFold(strings.TrimSpace(data), "[DONE]")
+}
+
 func isSSEControlToken(data string) bool {
 	token := strings.TrimSpace(data)
 	if token == "" {
@@ -1563,6 +1895,16 @@ func isSSEControlToken(data string) bool {
 	return true
 }
 
+// incompleteToolCallStreamError reports a stream that ended before the provider
+// finished a tool call. The buffered arguments are dropped rather than parsed so
+// a cut-off JSON fragment never reaches the tool-call recovery path.
+func incompleteToolCallStreamError() *RunnerError {
+	return &RunnerError{
+		Code:    ErrorCodeProviderInvalidReply,
+		Message: "provider stream ended before tool call arguments completed",
+	}
+}
+
 func mapStreamConsumeError(err error) *RunnerError {
 	if isStreamReadTimeout(err) {
 		return &RunnerError{
@@ -1592,3 +1934,23 @@ func isStreamReadTimeout(err error) bool {
 	msg := strings.ToLower(strings.TrimSpace(err.Error()))
 	return strings.Contains(msg, "client.timeout")
 }
+
+// setProviderHeaders applies the provider's configured headers, rendering
+// {{.Model}} and {{.ProviderID}} templates for this request.
+func setProviderHeaders(httpReq *http.Request, cfg GenerateConfig) error {
+	headers, err := provider.RenderHeaders(cfg.Headers, provider.HeaderTemplateData{
+		Model:      cfg.Model,
+		ProviderID: cfg.ProviderID,
+	})
+	if err != nil {
+		return &RunnerError{
+			Code:    ErrorCodeProviderRequestFailed,
+			Message: "failed to render provider headers",
+			Err:     err,
+		}
+	}
+	for key, value := range headers {
+		httpReq.Header.Set(key, value)
+	}
+	return nil
+}
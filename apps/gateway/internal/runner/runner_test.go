@@ -1,10 +1,12 @@
 package runner
 
 import (
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -533,6 +535,119 @@ func TestGenerateTurnOpenAIToolCalls(t *testing.T) {
 	}
 }
 
+func TestGenerateTurnOpenAIForwardsParallelToolCalls(t *testing.T) {
+	t.Parallel()
+	var bodies []map[string]interface{}
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		bodies = append(bodies, body)
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"ok"}}]}`))
+	}))
+	defer mock.Close()
+
+	parallel := false
+	cfg := GenerateConfig{
+		ProviderID:        ProviderOpenAI,
+		Model:             "gpt-4o-mini",
+		APIKey:            "sk-test",
+		BaseURL:           mock.URL,
+		ParallelToolCalls: &parallel,
+	}
+	req := domain.AgentProcessRequest{
+		Input: []domain.AgentInputMessage{{
+			Role:    "user",
+			Type:    "message",
+			Content: []domain.RuntimeContent{{Type: "text", Text: "hello"}},
+		}},
+	}
+	tools := []ToolDefinition{{Name: "view", Parameters: map[string]interface{}{"type": "object"}}}
+
+	r := NewWithHTTPClient(mock.Client())
+	if _, err := r.GenerateTurn(context.Background(), req, cfg, tools); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := r.GenerateTurn(context.Background(), req, cfg, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cfg.ParallelToolCalls = nil
+	if _, err := r.GenerateTurn(context.Background(), req, cfg, tools); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(bodies) != 3 {
+		t.Fatalf("expected 3 provider requests, got=%d", len(bodies))
+	}
+	if got, ok := bodies[0]["parallel_tool_calls"]; !ok || got != false {
+		t.Fatalf("expected parallel_tool_calls=false with tools, got=%#v", bodies[0]["parallel_tool_calls"])
+	}
+	if _, ok := bodies[1]["parallel_tool_calls"]; ok {
+		t.Fatalf("expected parallel_tool_calls omitted without tools, got=%#v", bodies[1])
+	}
+	if _, ok := bodies[2]["parallel_tool_calls"]; ok {
+		t.Fatalf("expected parallel_tool_calls omitted when unset, got=%#v", bodies[2])
+	}
+}
+
+func TestGenerateTurnOpenAIForwardsSamplingDefaults(t *testing.T) {
+	t.Parallel()
+	var bodies []map[string]interface{}
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		bodies = append(bodies, body)
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"ok"}}]}`))
+	}))
+	defer mock.Close()
+
+	temperature := 0.0
+	cfg := GenerateConfig{
+		ProviderID:  ProviderOpenAI,
+		Model:       "gpt-4o-mini",
+		APIKey:      "sk-test",
+		BaseURL:     mock.URL,
+		Temperature: &temperature,
+		MaxTokens:   512,
+	}
+	req := domain.AgentProcessRequest{
+		Input: []domain.AgentInputMessage{{
+			Role:    "user",
+			Type:    "message",
+			Content: []domain.RuntimeContent{{Type: "text", Text: "hello"}},
+		}},
+	}
+
+	r := NewWithHTTPClient(mock.Client())
+	if _, err := r.GenerateTurn(context.Background(), req, cfg, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cfg.Temperature = nil
+	cfg.MaxTokens = 0
+	if _, err := r.GenerateTurn(context.Background(), req, cfg, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(bodies) != 2 {
+		t.Fatalf("expected 2 provider requests, got=%d", len(bodies))
+	}
+	if got, ok := bodies[0]["temperature"]; !ok || got != float64(0) {
+		t.Fatalf("expected temperature=0 to be sent, got=%#v", bodies[0]["temperature"])
+	}
+	if got := bodies[0]["max_tokens"]; got != float64(512) {
+		t.Fatalf("expected max_tokens=512, got=%#v", got)
+	}
+	if _, ok := bodies[1]["temperature"]; ok {
+		t.Fatalf("expected temperature omitted when unset, got=%#v", bodies[1])
+	}
+	if _, ok := bodies[1]["max_tokens"]; ok {
+		t.Fatalf("expected max_tokens omitted when unset, got=%#v", bodies[1])
+	}
+}
+
 func TestGenerateTurnCodexCompatibleParsesFunctionCalls(t *testing.T) {
 	t.Parallel()
 	var requestBody map[string]interface{}
@@ -775,6 +890,145 @@ func TestGenerateTurnStreamOpenAISendsNativeDeltas(t *testing.T) {
 	}
 }
 
+func TestGenerateTurnOpenAIParsesUsage(t *testing.T) {
+	t.Parallel()
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"hello"}}],"usage":{"prompt_tokens":12,"completion_tokens":3,"total_tokens":15}}`))
+	}))
+	defer mock.Close()
+
+	r := NewWithHTTPClient(mock.Client())
+	turn, err := r.GenerateTurn(context.Background(), domain.AgentProcessRequest{
+		Input: []domain.AgentInputMessage{{
+			Role:    "user",
+			Type:    "message",
+			Content: []domain.RuntimeContent{{Type: "text", Text: "hello"}},
+		}},
+	}, GenerateConfig{
+		ProviderID: ProviderOpenAI,
+		Model:      "gpt-4o-mini",
+		APIKey:     "sk-test",
+		BaseURL:    mock.URL,
+	}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if turn.Usage == nil || turn.Usage.PromptTokens != 12 || turn.Usage.CompletionTokens != 3 {
+		t.Fatalf("unexpected usage: %#v", turn.Usage)
+	}
+}
+
+func TestGenerateTurnOpenAIReportsLengthFinishAsTruncated(t *testing.T) {
+	t.Parallel()
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if stream, _ := req["stream"].(bool); stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"hel\"}}]}\n\n")
+			_, _ = fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{},\"finish_reason\":\"length\"}]}\n\n")
+			_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"hel"},"finish_reason":"length"}]}`))
+	}))
+	defer mock.Close()
+
+	r := NewWithHTTPClient(mock.Client())
+	req := domain.AgentProcessRequest{
+		Input: []domain.AgentInputMessage{{
+			Role:    "user",
+			Type:    "message",
+			Content: []domain.RuntimeContent{{Type: "text", Text: "hello"}},
+		}},
+	}
+	cfg := GenerateConfig{
+		ProviderID: ProviderOpenAI,
+		Model:      "gpt-4o-mini",
+		APIKey:     "sk-test",
+		BaseURL:    mock.URL,
+	}
+	turn, err := r.GenerateTurn(context.Background(), req, cfg, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !turn.Truncated {
+		t.Fatalf("expected non-stream turn to be truncated")
+	}
+	streamTurn, err := r.GenerateTurnStream(context.Background(), req, cfg, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected stream error: %v", err)
+	}
+	if !streamTurn.Truncated {
+		t.Fatalf("expected stream turn to be truncated")
+	}
+}
+
+func TestGenerateTurnStreamOpenAIRequestsUsageOnlyWhenEnabled(t *testing.T) {
+	t.Parallel()
+	for _, streamUsage := range []bool{false, true} {
+		var requestBody map[string]interface{}
+		mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_ = json.NewDecoder(r.Body).Decode(&requestBody)
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"hello\"}}]}\n\n")
+			_, _ = fmt.Fprint(w, "data: {\"choices\":[],\"usage\":{\"prompt_tokens\":40,\"completion_tokens\":7}}\n\n")
+			_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
+		}))
+
+		r := NewWithHTTPClient(mock.Client())
+		turn, err := r.GenerateTurnStream(context.Background(), domain.AgentProcessRequest{
+			Input: []domain.AgentInputMessage{{
+				Role:    "user",
+				Type:    "message",
+				Content: []domain.RuntimeContent{{Type: "text", Text: "hello"}},
+			}},
+		}, GenerateConfig{
+			ProviderID:  ProviderOpenAI,
+			Model:       "gpt-4o-mini",
+			APIKey:      "sk-test",
+			BaseURL:     mock.URL,
+			StreamUsage: streamUsage,
+		}, nil, nil)
+		mock.Close()
+		if err != nil {
+			t.Fatalf("stream_usage=%v: unexpected error: %v", streamUsage, err)
+		}
+		streamOptions, present := requestBody["stream_options"].(map[string]interface{})
+		if !streamUsage {
+			if present {
+				t.Fatalf("expected no stream_options unless stream_usage is set, got=%#v", requestBody["stream_options"])
+			}
+			continue
+		}
+		if got, _ := streamOptions["include_usage"].(bool); !got {
+			t.Fatalf("expected stream_options.include_usage=true, got=%#v", requestBody["stream_options"])
+		}
+		if turn.Usage == nil || turn.Usage.PromptTokens != 40 || turn.Usage.CompletionTokens != 7 {
+			t.Fatalf("unexpected usage: %#v", turn.Usage)
+		}
+	}
+}
+
+func TestGenerateTurnDemoReportsNoUsage(t *testing.T) {
+	t.Parallel()
+	turn, err := New().GenerateTurn(context.Background(), domain.AgentProcessRequest{
+		Input: []domain.AgentInputMessage{{
+			Role:    "user",
+			Type:    "message",
+			Content: []domain.RuntimeContent{{Type: "text", Text: "hello"}},
+		}},
+	}, GenerateConfig{ProviderID: ProviderDemo, Model: "demo-chat"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if turn.Usage != nil {
+		t.Fatalf("expected no usage for demo provider, got=%#v", turn.Usage)
+	}
+}
+
 func TestGenerateTurnStreamOpenAIIgnoresEmptyDataHeartbeat(t *testing.T) {
 	t.Parallel()
 	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -919,6 +1173,42 @@ func TestGenerateTurnStreamOpenAITimeoutMappedToRequestFailed(t *testing.T) {
 	assertRunnerCode(t, err, ErrorCodeProviderRequestFailed)
 }
 
+func TestGenerateTurnStreamKeepsProviderBodyOutOfMessage(t *testing.T) {
+	t.Parallel()
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":{"message":"echoed sk-secret-key"}}`))
+	}))
+	defer mock.Close()
+
+	r := NewWithHTTPClient(mock.Client())
+	for _, providerID := range []string{ProviderOpenAI, ProviderCodex, ProviderCohere, ProviderGemini} {
+		_, err := r.GenerateTurnStream(context.Background(), domain.AgentProcessRequest{
+			Input: []domain.AgentInputMessage{{
+				Role:    "user",
+				Type:    "message",
+				Content: []domain.RuntimeContent{{Type: "text", Text: "hi"}},
+			}},
+		}, GenerateConfig{
+			ProviderID: providerID,
+			Model:      "test-model",
+			APIKey:     "sk-test",
+			BaseURL:    mock.URL,
+		}, nil, nil)
+		assertRunnerCode(t, err, ErrorCodeProviderRequestFailed)
+		var runnerErr *RunnerError
+		if !errors.As(err, &runnerErr) {
+			t.Fatalf("%s: expected runner error, got=%v", providerID, err)
+		}
+		if runnerErr.Message != "provider returned status 400" {
+			t.Fatalf("%s: message must carry the status only, got=%q", providerID, runnerErr.Message)
+		}
+		if !strings.Contains(runnerErr.ProviderBody, "echoed sk-secret-key") {
+			t.Fatalf("%s: expected provider body kept for debugging, got=%q", providerID, runnerErr.ProviderBody)
+		}
+	}
+}
+
 func TestGenerateTurnStreamCodexCompatibleFallsBackToMessageOutputItem(t *testing.T) {
 	t.Parallel()
 	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -1058,21 +1348,93 @@ func TestGenerateTurnStreamFallsBackWhenStreamCapabilityDisabled(t *testing.T) {
 	}
 }
 
-func TestGenerateTurnRejectsAttachmentsWhenCapabilityDisabled(t *testing.T) {
+func TestGenerateTurnDropsAttachmentsWhenCapabilityDisabled(t *testing.T) {
 	t.Parallel()
 
 	r := New()
-	_, err := r.GenerateTurn(context.Background(), domain.AgentProcessRequest{
+	turn, err := r.GenerateTurn(context.Background(), domain.AgentProcessRequest{
 		Input: []domain.AgentInputMessage{{
-			Role:    "user",
-			Type:    "message",
-			Content: []domain.RuntimeContent{{Type: "image", Text: "inline-image"}},
+			Role: "user",
+			Type: "message",
+			Content: []domain.RuntimeContent{
+				{Type: "text", Text: "describe this"},
+				{Type: "image_url", ImageURL: "https://example.com/cat.png"},
+			},
 		}},
 	}, GenerateConfig{
 		ProviderID: ProviderDemo,
 		Model:      "demo-chat",
 	}, nil)
-	assertRunnerCode(t, err, ErrorCodeProviderNotSupported)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if turn.Text != "Echo: describe this" {
+		t.Fatalf("unexpected reply: %q", turn.Text)
+	}
+	if turn.DroppedContentParts != 1 {
+		t.Fatalf("expected one dropped part, got=%d", turn.DroppedContentParts)
+	}
+}
+
+func TestGenerateTurnOpenAICompatibleForwardsImageParts(t *testing.T) {
+	t.Parallel()
+	var messages []map[string]interface{}
+
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages []map[string]interface{} `json:"messages"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		messages = req.Messages
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"a cat"}}]}`))
+	}))
+	defer mock.Close()
+
+	r := NewWithHTTPClient(mock.Client())
+	turn, err := r.GenerateTurn(context.Background(), domain.AgentProcessRequest{
+		Input: []domain.AgentInputMessage{{
+			Role: "user",
+			Type: "message",
+			Content: []domain.RuntimeContent{
+				{Type: "text", Text: "what is this?"},
+				{Type: "image_url", ImageURL: "https://example.com/cat.png"},
+				{Type: "image", Data: "aGVsbG8=", MimeType: "image/jpeg"},
+				{Type: "file", Data: "ignored"},
+			},
+		}},
+	}, GenerateConfig{
+		ProviderID: "openai",
+		Model:      "gpt-4o-mini",
+		APIKey:     "sk-test",
+		BaseURL:    mock.URL,
+	}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if turn.DroppedContentParts != 1 {
+		t.Fatalf("expected the file part to be dropped, got=%d", turn.DroppedContentParts)
+	}
+	if len(messages) != 1 {
+		t.Fatalf("unexpected messages: %#v", messages)
+	}
+	parts, ok := messages[0]["content"].([]interface{})
+	if !ok || len(parts) != 3 {
+		t.Fatalf("expected multi-part content, got=%#v", messages[0]["content"])
+	}
+	first, _ := parts[0].(map[string]interface{})
+	if first["type"] != "text" || first["text"] != "what is this?" {
+		t.Fatalf("unexpected text part: %#v", first)
+	}
+	second, _ := parts[1].(map[string]interface{})
+	if url, _ := second["image_url"].(map[string]interface{}); second["type"] != "image_url" || url["url"] != "https://example.com/cat.png" {
+		t.Fatalf("unexpected image part: %#v", second)
+	}
+	third, _ := parts[2].(map[string]interface{})
+	if url, _ := third["image_url"].(map[string]interface{}); url["url"] != "data:image/jpeg;base64,aGVsbG8=" {
+		t.Fatalf("unexpected inline image part: %#v", third)
+	}
 }
 
 type capabilityProbeAdapter struct {
@@ -1107,3 +1469,189 @@ func (a *capabilityProbeAdapter) GenerateTurn(
 	}
 	return TurnResult{Text: a.reply}, nil
 }
+
+func TestGenerateTurnCompressesLargeRequestsWhenEnabled(t *testing.T) {
+	t.Parallel()
+	type received struct {
+		encoding string
+		text     string
+	}
+	requests := make(chan received, 4)
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reader io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				t.Errorf("open gzip body failed: %v", err)
+				return
+			}
+			defer gz.Close()
+			reader = gz
+		}
+		var req struct {
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		if err := json.NewDecoder(reader).Decode(&req); err != nil {
+			t.Errorf("decode request body failed: %v", err)
+		}
+		text := ""
+		if len(req.Messages) > 0 {
+			text = req.Messages[len(req.Messages)-1].Content
+		}
+		requests <- received{encoding: r.Header.Get("Content-Encoding"), text: text}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"ok"}}]}`))
+	}))
+	defer mock.Close()
+
+	r := NewWithHTTPClient(mock.Client())
+	largeText := strings.Repeat("x", compressRequestThresholdBytes+1)
+	newRequest := func(text string) domain.AgentProcessRequest {
+		return domain.AgentProcessRequest{
+			Input: []domain.AgentInputMessage{{
+				Role:    "user",
+				Type:    "message",
+				Content: []domain.RuntimeContent{{Type: "text", Text: text}},
+			}},
+		}
+	}
+	cfg := GenerateConfig{
+		ProviderID:       ProviderOpenAI,
+		Model:            "gpt-4o-mini",
+		APIKey:           "sk-test",
+		BaseURL:          mock.URL,
+		CompressRequests: true,
+	}
+
+	cases := []struct {
+		name     string
+		text     string
+		compress bool
+		encoding string
+	}{
+		{name: "large enabled", text: largeText, compress: true, encoding: "gzip"},
+		{name: "small enabled", text: "hello", compress: true, encoding: ""},
+		{name: "large disabled", text: largeText, compress: false, encoding: ""},
+	}
+	for _, tc := range cases {
+		caseCfg := cfg
+		caseCfg.CompressRequests = tc.compress
+		if _, err := r.GenerateTurn(context.Background(), newRequest(tc.text), caseCfg, nil); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		got := <-requests
+		if got.encoding != tc.encoding {
+			t.Fatalf("%s: content-encoding=%q, want %q", tc.name, got.encoding, tc.encoding)
+		}
+		if got.text != tc.text {
+			t.Fatalf("%s: provider received %d chars, want %d", tc.name, len(got.text), len(tc.text))
+		}
+	}
+}
+
+func TestGenerateTurnRendersModelTemplatedHeaders(t *testing.T) {
+	t.Parallel()
+	headers := make(chan http.Header, 1)
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header.Clone()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"ok"}}]}`))
+	}))
+	defer mock.Close()
+
+	r := NewWithHTTPClient(mock.Client())
+	req := domain.AgentProcessRequest{
+		Input: []domain.AgentInputMessage{{
+			Role:    "user",
+			Type:    "message",
+			Content: []domain.RuntimeContent{{Type: "text", Text: "hello"}},
+		}},
+	}
+	cfg := GenerateConfig{
+		ProviderID: ProviderOpenAI,
+		Model:      "gpt-4o-mini",
+		APIKey:     "sk-test",
+		BaseURL:    mock.URL,
+		Headers: map[string]string{
+			"X-Model-Provider": "{{.ProviderID}}:{{.Model}}",
+			"X-Static":         "fixed",
+		},
+	}
+	if _, err := r.GenerateTurn(context.Background(), req, cfg, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := <-headers
+	if value := got.Get("X-Model-Provider"); value != "openai:gpt-4o-mini" {
+		t.Fatalf("unexpected templated header: %q", value)
+	}
+	if value := got.Get("X-Static"); value != "fixed" {
+		t.Fatalf("unexpected static header: %q", value)
+	}
+}
+
+func TestGenerateTurnStreamRejectsTruncatedToolCallArguments(t *testing.T) {
+	t.Parallel()
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"tool_calls\":[{\"index\":0,\"id\":\"call_1\",\"type\":\"function\",\"function\":{\"name\":\"shell\",\"arguments\":\"{\\\"items\\\":[{\\\"comm\"}}]}}]}\n\n")
+	}))
+	defer mock.Close()
+
+	r := NewWithHTTPClient(mock.Client())
+	req := domain.AgentProcessRequest{
+		Input: []domain.AgentInputMessage{{
+			Role:    "user",
+			Type:    "message",
+			Content: []domain.RuntimeContent{{Type: "text", Text: "run pwd"}},
+		}},
+	}
+	cfg := GenerateConfig{
+		ProviderID: ProviderOpenAI,
+		Model:      "gpt-4o-mini",
+		APIKey:     "sk-test",
+		BaseURL:    mock.URL,
+	}
+	_, err := r.GenerateTurnStream(context.Background(), req, cfg, []ToolDefinition{{Name: "shell"}}, nil)
+	var runnerErr *RunnerError
+	if !errors.As(err, &runnerErr) || runnerErr.Code != ErrorCodeProviderInvalidReply {
+		t.Fatalf("expected %s, got=%v", ErrorCodeProviderInvalidReply, err)
+	}
+	if _, ok := InvalidToolCallFromError(err); ok {
+		t.Fatalf("truncated arguments must not surface as a recoverable invalid tool call: %v", err)
+	}
+}
+
+func TestGenerateTurnStreamReportsProviderFinishMetadata(t *testing.T) {
+	t.Parallel()
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = fmt.Fprint(w, "data: {\"model\":\"gpt-4o-mini-2024-07-18\",\"system_fingerprint\":\"fp_abc\",\"choices\":[{\"delta\":{\"content\":\"hi\"}}]}\n\n")
+		_, _ = fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{},\"finish_reason\":\"stop\"}]}\n\n")
+		_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer mock.Close()
+
+	r := NewWithHTTPClient(mock.Client())
+	req := domain.AgentProcessRequest{
+		Input: []domain.AgentInputMessage{{
+			Role:    "user",
+			Type:    "message",
+			Content: []domain.RuntimeContent{{Type: "text", Text: "hello"}},
+		}},
+	}
+	cfg := GenerateConfig{
+		ProviderID: ProviderOpenAI,
+		Model:      "gpt-4o-mini",
+		APIKey:     "sk-test",
+		BaseURL:    mock.URL,
+	}
+	turn, err := r.GenerateTurnStream(context.Background(), req, cfg, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if turn.Model != "gpt-4o-mini-2024-07-18" || turn.FinishReason != "stop" || turn.SystemFingerprint != "fp_abc" {
+		t.Fatalf("unexpected finish metadata: model=%q finish=%q fingerprint=%q", turn.Model, turn.FinishReason, turn.SystemFingerprint)
+	}
+}
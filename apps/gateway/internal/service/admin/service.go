@@ -6,11 +6,15 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
 	"nextai/apps/gateway/internal/domain"
 	"nextai/apps/gateway/internal/service/ports"
 )
 
+// ErrSkillExists is returned when CreateOnly is set and the skill name is taken.
+var ErrSkillExists = errors.New("skill_exists")
+
 type ValidationError struct {
 	Code    string
 	Message string
@@ -23,10 +27,17 @@ func (e *ValidationError) Error() string {
 	return e.Message
 }
 
+// ChannelRequirement lets a channel check its config before it is saved.
+type ChannelRequirement struct {
+	RequiredConfig [][]string
+	Validate       func(cfg map[string]interface{}) error
+}
+
 type Dependencies struct {
-	Store             ports.StateStore
-	DataDir           string
-	SupportedChannels map[string]struct{}
+	Store               ports.StateStore
+	DataDir             string
+	SupportedChannels   map[string]struct{}
+	ChannelRequirements map[string]ChannelRequirement
 }
 
 type Service struct {
@@ -38,6 +49,8 @@ type CreateSkillInput struct {
 	Content    string
 	References map[string]interface{}
 	Scripts    map[string]interface{}
+	// CreateOnly fails with ErrSkillExists instead of overwriting a skill.
+	CreateOnly bool
 }
 
 func NewService(deps Dependencies) *Service {
@@ -50,6 +63,15 @@ func NewService(deps Dependencies) *Service {
 		normalized[name] = struct{}{}
 	}
 	deps.SupportedChannels = normalized
+	requirements := map[string]ChannelRequirement{}
+	for raw, requirement := range deps.ChannelRequirements {
+		name := strings.ToLower(strings.TrimSpace(raw))
+		if name == "" {
+			continue
+		}
+		requirements[name] = requirement
+	}
+	deps.ChannelRequirements = requirements
 	return &Service{deps: deps}
 }
 
@@ -94,6 +116,43 @@ func (s *Service) ReplaceEnvs(in map[string]string) ([]domain.EnvVar, error) {
 	return s.ListEnvs()
 }
 
+// PatchEnvs merges in into the stored envs in one write; a nil value deletes
+// the key. Keys not mentioned are left untouched.
+func (s *Service) PatchEnvs(in map[string]*string) ([]domain.EnvVar, error) {
+	if err := s.validateStore(); err != nil {
+		return nil, err
+	}
+
+	normalized := map[string]*string{}
+	for key, value := range in {
+		name := strings.TrimSpace(key)
+		if name == "" {
+			return nil, &ValidationError{
+				Code:    "invalid_env_key",
+				Message: "env key cannot be empty",
+			}
+		}
+		normalized[name] = value
+	}
+
+	if err := s.deps.Store.WriteSettings(func(st *ports.SettingsAggregate) error {
+		if st.Envs == nil {
+			st.Envs = map[string]string{}
+		}
+		for key, value := range normalized {
+			if value == nil {
+				delete(st.Envs, key)
+				continue
+			}
+			st.Envs[key] = *value
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return s.ListEnvs()
+}
+
 func (s *Service) DeleteEnv(key string) ([]domain.EnvVar, bool, error) {
 	if err := s.validateStore(); err != nil {
 		return nil, false, err
@@ -120,7 +179,15 @@ func (s *Service) DeleteEnv(key string) ([]domain.EnvVar, bool, error) {
 	return out, true, nil
 }
 
-func (s *Service) ListSkills(onlyEnabled bool) ([]domain.SkillSpec, error) {
+// Skill list orders accepted by ListSkills.
+const (
+	SkillSortName    = "name"
+	SkillSortUpdated = "updated"
+)
+
+// ListSkills returns skills by name, or most recently updated first when
+// order is SkillSortUpdated; skills without timestamps sort last.
+func (s *Service) ListSkills(onlyEnabled bool, order string) ([]domain.SkillSpec, error) {
 	if err := s.validateStore(); err != nil {
 		return nil, err
 	}
@@ -134,7 +201,22 @@ func (s *Service) ListSkills(onlyEnabled bool) ([]domain.SkillSpec, error) {
 			out = append(out, spec)
 		}
 	})
-	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	switch order {
+	case "", SkillSortName:
+		sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	case SkillSortUpdated:
+		sort.Slice(out, func(i, j int) bool {
+			if out[i].UpdatedAt != out[j].UpdatedAt {
+				return out[i].UpdatedAt > out[j].UpdatedAt
+			}
+			return out[i].Name < out[j].Name
+		})
+	default:
+		return nil, &ValidationError{
+			Code:    "invalid_request",
+			Message: fmt.Sprintf("sort must be %q or %q", SkillSortName, SkillSortUpdated),
+		}
+	}
 	return out, nil
 }
 
@@ -143,6 +225,7 @@ func (s *Service) BatchSetSkillEnabled(names []string, enabled bool) error {
 		return err
 	}
 
+	now := nowISO()
 	return s.deps.Store.WriteSettings(func(st *ports.SettingsAggregate) error {
 		for _, name := range names {
 			item, ok := st.Skills[name]
@@ -150,6 +233,7 @@ func (s *Service) BatchSetSkillEnabled(names []string, enabled bool) error {
 				continue
 			}
 			item.Enabled = enabled
+			item.UpdatedAt = now
 			st.Skills[name] = item
 		}
 		return nil
@@ -170,7 +254,16 @@ func (s *Service) CreateSkill(input CreateSkillInput) (bool, error) {
 		}
 	}
 
+	now := nowISO()
 	if err := s.deps.Store.WriteSettings(func(st *ports.SettingsAggregate) error {
+		createdAt := now
+		existing, ok := st.Skills[name]
+		if ok && input.CreateOnly {
+			return ErrSkillExists
+		}
+		if ok && existing.CreatedAt != "" {
+			createdAt = existing.CreatedAt
+		}
 		st.Skills[name] = domain.SkillSpec{
 			Name:       name,
 			Content:    input.Content,
@@ -179,6 +272,8 @@ func (s *Service) CreateSkill(input CreateSkillInput) (bool, error) {
 			References: safeMap(input.References),
 			Scripts:    safeMap(input.Scripts),
 			Enabled:    true,
+			CreatedAt:  createdAt,
+			UpdatedAt:  now,
 		}
 		return nil
 	}); err != nil {
@@ -200,6 +295,7 @@ func (s *Service) SetSkillEnabled(name string, enabled bool) (bool, error) {
 		}
 		exists = true
 		item.Enabled = enabled
+		item.UpdatedAt = nowISO()
 		st.Skills[name] = item
 		return nil
 	}); err != nil {
@@ -264,6 +360,19 @@ func (s *Service) ListChannelTypes() []string {
 	return out
 }
 
+// ListChannelTypeInfos is ListChannelTypes with each channel's required config.
+func (s *Service) ListChannelTypeInfos() []domain.ChannelTypeInfo {
+	names := s.ListChannelTypes()
+	out := make([]domain.ChannelTypeInfo, 0, len(names))
+	for _, name := range names {
+		out = append(out, domain.ChannelTypeInfo{
+			Name:           name,
+			RequiredConfig: s.deps.ChannelRequirements[name].RequiredConfig,
+		})
+	}
+	return out
+}
+
 func (s *Service) ReplaceChannels(in domain.ChannelConfigMap) (domain.ChannelConfigMap, error) {
 	if err := s.validateStore(); err != nil {
 		return nil, err
@@ -278,6 +387,9 @@ func (s *Service) ReplaceChannels(in domain.ChannelConfigMap) (domain.ChannelCon
 				Message: fmt.Sprintf("channel %q is not supported", name),
 			}
 		}
+		if err := s.validateChannelConfig(key, cfg); err != nil {
+			return nil, err
+		}
 		normalized[key] = cfg
 	}
 
@@ -316,6 +428,9 @@ func (s *Service) PutChannel(name string, body map[string]interface{}) error {
 			Message: fmt.Sprintf("channel %q is not supported", name),
 		}
 	}
+	if err := s.validateChannelConfig(normalized, body); err != nil {
+		return err
+	}
 
 	return s.deps.Store.WriteSettings(func(st *ports.SettingsAggregate) error {
 		if st.Channels == nil {
@@ -341,6 +456,9 @@ func ReadSkillVirtualFile(skill domain.SkillSpec, filePath string) (string, bool
 		return "", false
 	}
 	for _, part := range parts[1:] {
+		if part == "" || part == "." || part == ".." {
+			return "", false
+		}
 		item, ok := node.(map[string]interface{})
 		if !ok {
 			return "", false
@@ -363,6 +481,25 @@ func (s *Service) channelSupported(name string) bool {
 	return ok
 }
 
+// validateChannelConfig only checks enabled channels so disabled placeholders
+// with empty fields can still be saved.
+func (s *Service) validateChannelConfig(name string, cfg map[string]interface{}) error {
+	requirement, ok := s.deps.ChannelRequirements[name]
+	if !ok || requirement.Validate == nil {
+		return nil
+	}
+	if enabled, _ := cfg["enabled"].(bool); !enabled {
+		return nil
+	}
+	if err := requirement.Validate(cfg); err != nil {
+		return &ValidationError{
+			Code:    "invalid_channel_config",
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
 func (s *Service) validateStore() error {
 	if s == nil || s.deps.Store == nil {
 		return errors.New("state store is unavailable")
@@ -376,3 +513,7 @@ func safeMap(in map[string]interface{}) map[string]interface{} {
 	}
 	return in
 }
+
+func nowISO() string {
+	return time.Now().UTC().Format(time.RFC3339)
+}
@@ -1,12 +1,19 @@
 package admin
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
 	"errors"
+	"io"
+	"strings"
 	"testing"
 
 	"nextai/apps/gateway/internal/domain"
 	"nextai/apps/gateway/internal/repo"
 	"nextai/apps/gateway/internal/service/adapters"
+	"nextai/apps/gateway/internal/service/ports"
 )
 
 func TestReplaceEnvsRejectsEmptyKey(t *testing.T) {
@@ -23,6 +30,34 @@ func TestReplaceEnvsRejectsEmptyKey(t *testing.T) {
 	}
 }
 
+func TestPatchEnvsMergesAndDeletes(t *testing.T) {
+	t.Parallel()
+
+	svc := newTestService(t)
+	if _, err := svc.ReplaceEnvs(map[string]string{"A": "1", "B": "2", "C": "3"}); err != nil {
+		t.Fatalf("replace envs failed: %v", err)
+	}
+	updated := "20"
+	added := "4"
+	out, err := svc.PatchEnvs(map[string]*string{"B": &updated, "C": nil, "D": &added})
+	if err != nil {
+		t.Fatalf("patch envs failed: %v", err)
+	}
+	got := map[string]string{}
+	for _, item := range out {
+		got[item.Key] = item.Value
+	}
+	if len(got) != 3 || got["A"] != "1" || got["B"] != "20" || got["D"] != "4" {
+		t.Fatalf("unexpected envs after patch: %#v", got)
+	}
+
+	_, err = svc.PatchEnvs(map[string]*string{" ": &added})
+	validation := (*ValidationError)(nil)
+	if !errors.As(err, &validation) || validation.Code != "invalid_env_key" {
+		t.Fatalf("expected invalid_env_key, got=%v", err)
+	}
+}
+
 func TestCreateAndLoadSkillFile(t *testing.T) {
 	t.Parallel()
 
@@ -55,6 +90,254 @@ func TestCreateAndLoadSkillFile(t *testing.T) {
 	}
 }
 
+func TestSkillTimestampsAndSortByUpdated(t *testing.T) {
+	t.Parallel()
+
+	svc := newTestService(t)
+	for _, name := range []string{"alpha", "beta", "gamma"} {
+		if _, err := svc.CreateSkill(CreateSkillInput{Name: name, Content: name + " body"}); err != nil {
+			t.Fatalf("create skill %s failed: %v", name, err)
+		}
+	}
+	skills, err := svc.ListSkills(false, "")
+	if err != nil {
+		t.Fatalf("list skills failed: %v", err)
+	}
+	for _, skill := range skills {
+		if skill.CreatedAt == "" || skill.UpdatedAt == "" {
+			t.Fatalf("expected timestamps on created skill: %#v", skill)
+		}
+	}
+
+	if err := svc.deps.Store.WriteSettings(func(st *ports.SettingsAggregate) error {
+		for name, stamp := range map[string]string{"alpha": "2026-01-01T00:00:00Z", "beta": "2026-01-03T00:00:00Z", "gamma": "2026-01-02T00:00:00Z"} {
+			item := st.Skills[name]
+			item.CreatedAt = stamp
+			item.UpdatedAt = stamp
+			st.Skills[name] = item
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("seed timestamps failed: %v", err)
+	}
+	if _, err := svc.SetSkillEnabled("alpha", false); err != nil {
+		t.Fatalf("disable skill failed: %v", err)
+	}
+
+	skills, err = svc.ListSkills(false, SkillSortUpdated)
+	if err != nil {
+		t.Fatalf("list skills by updated failed: %v", err)
+	}
+	got := []string{}
+	for _, skill := range skills {
+		got = append(got, skill.Name)
+	}
+	if strings.Join(got, ",") != "alpha,beta,gamma" {
+		t.Fatalf("expected most recently updated first, got=%v", got)
+	}
+	if skills[0].CreatedAt != "2026-01-01T00:00:00Z" || skills[0].UpdatedAt <= skills[0].CreatedAt {
+		t.Fatalf("expected enable toggle to bump only updated_at: %#v", skills[0])
+	}
+
+	if _, err := svc.CreateSkill(CreateSkillInput{Name: "gamma", Content: "new body"}); err != nil {
+		t.Fatalf("update skill failed: %v", err)
+	}
+	skills, _ = svc.ListSkills(false, SkillSortName)
+	if gamma := skills[2]; gamma.CreatedAt != "2026-01-02T00:00:00Z" || gamma.UpdatedAt == gamma.CreatedAt {
+		t.Fatalf("expected overwrite to keep created_at and bump updated_at: %#v", gamma)
+	}
+
+	_, err = svc.ListSkills(false, "size")
+	validation := (*ValidationError)(nil)
+	if !errors.As(err, &validation) || validation.Code != "invalid_request" {
+		t.Fatalf("expected invalid sort to be rejected, got=%v", err)
+	}
+}
+
+func TestImportSkillBundleFromZip(t *testing.T) {
+	t.Parallel()
+
+	svc := newTestService(t)
+	bundle := buildTestSkillZip(t, map[string]string{
+		"reviewer/skill.md":                 "Review carefully.",
+		"reviewer/references/docs/rules.md": "rule one",
+		"reviewer/references/logo.png":      "\x89PNG\r\n\x1a\n\xff",
+		"reviewer/scripts/lint.sh":          "echo lint",
+	})
+	name, err := svc.ImportSkillBundle(ImportSkillBundleInput{FileName: "reviewer.zip", Data: bundle})
+	if err != nil {
+		t.Fatalf("import skill bundle failed: %v", err)
+	}
+	if name != "reviewer" {
+		t.Fatalf("expected name from bundle root, got=%q", name)
+	}
+	skills, err := svc.ListSkills(false, "")
+	if err != nil || len(skills) != 1 {
+		t.Fatalf("list skills failed: err=%v skills=%#v", err, skills)
+	}
+	if skills[0].Content != "Review carefully." || !skills[0].Enabled {
+		t.Fatalf("unexpected imported skill: %#v", skills[0])
+	}
+	if content, found, _ := svc.LoadSkillFile("reviewer", "references/docs/rules.md"); !found || content != "rule one" {
+		t.Fatalf("unexpected reference: found=%v content=%q", found, content)
+	}
+	if content, found, _ := svc.LoadSkillFile("reviewer", "scripts/lint.sh"); !found || content != "echo lint" {
+		t.Fatalf("unexpected script: found=%v content=%q", found, content)
+	}
+	if content, _, _ := svc.LoadSkillFile("reviewer", "references/logo.png"); !strings.HasPrefix(content, "data:image/png;base64,") {
+		t.Fatalf("expected binary reference stored as data url, got=%q", content)
+	}
+}
+
+func TestImportSkillBundleRefusesExistingNameUnlessOverwrite(t *testing.T) {
+	t.Parallel()
+
+	svc := newTestService(t)
+	if _, err := svc.CreateSkill(CreateSkillInput{Name: "reviewer", Content: "Original."}); err != nil {
+		t.Fatalf("create skill failed: %v", err)
+	}
+	bundle := buildTestSkillZip(t, map[string]string{"reviewer/skill.md": "Replacement."})
+	name, err := svc.ImportSkillBundle(ImportSkillBundleInput{FileName: "reviewer.zip", Data: bundle})
+	if !errors.Is(err, ErrSkillExists) || name != "reviewer" {
+		t.Fatalf("expected ErrSkillExists for reviewer, got name=%q err=%v", name, err)
+	}
+	if skills, _ := svc.ListSkills(false, ""); len(skills) != 1 || skills[0].Content != "Original." {
+		t.Fatalf("refused import must keep the existing skill: %#v", skills)
+	}
+
+	if _, err := svc.ImportSkillBundle(ImportSkillBundleInput{FileName: "reviewer.zip", Data: bundle, Overwrite: true}); err != nil {
+		t.Fatalf("overwrite import failed: %v", err)
+	}
+	if skills, _ := svc.ListSkills(false, ""); len(skills) != 1 || skills[0].Content != "Replacement." {
+		t.Fatalf("expected overwrite to replace the skill: %#v", skills)
+	}
+}
+
+func TestImportSkillBundleRejectsInvalidArchives(t *testing.T) {
+	t.Parallel()
+
+	svc := newTestService(t)
+	cases := map[string][]byte{
+		"traversal":   buildTestSkillZip(t, map[string]string{"skill.md": "x", "references/../../evil.md": "x"}),
+		"absolute":    buildTestSkillZip(t, map[string]string{"skill.md": "x", "/etc/passwd": "x"}),
+		"no manifest": buildTestSkillZip(t, map[string]string{"references/a.md": "x"}),
+		"not archive": []byte("plain text"),
+	}
+	for label, data := range cases {
+		_, err := svc.ImportSkillBundle(ImportSkillBundleInput{Name: "bad", Data: data})
+		validation := (*ValidationError)(nil)
+		if !errors.As(err, &validation) || validation.Code != "invalid_skill_bundle" {
+			t.Fatalf("%s: expected invalid_skill_bundle, got=%v", label, err)
+		}
+	}
+}
+
+func TestImportSkillBundleFromTarGz(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, body := range map[string]string{"skill.md": "Summarize.", "references/a.txt": "alpha"} {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(body)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatalf("write tar header: %v", err)
+		}
+		if _, err := tw.Write([]byte(body)); err != nil {
+			t.Fatalf("write tar body: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("close tar: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("close gzip: %v", err)
+	}
+
+	svc := newTestService(t)
+	name, err := svc.ImportSkillBundle(ImportSkillBundleInput{FileName: "summary.tar.gz", Data: buf.Bytes()})
+	if err != nil {
+		t.Fatalf("import tar bundle failed: %v", err)
+	}
+	if name != "summary" {
+		t.Fatalf("expected name from file name, got=%q", name)
+	}
+	if content, found, _ := svc.LoadSkillFile("summary", "references/a.txt"); !found || content != "alpha" {
+		t.Fatalf("unexpected reference: found=%v content=%q", found, content)
+	}
+}
+
+func TestExportSkillBundleRoundTrips(t *testing.T) {
+	t.Parallel()
+
+	svc := newTestService(t)
+	if _, err := svc.ImportSkillBundle(ImportSkillBundleInput{
+		Name: "shared",
+		Data: buildTestSkillZip(t, map[string]string{
+			"skill.md":                 "Share me.",
+			"references/docs/guide.md": "guide",
+			"references/icon.png":      "\x89PNG\xff",
+			"scripts/run.sh":           "echo run",
+		}),
+	}); err != nil {
+		t.Fatalf("import skill bundle failed: %v", err)
+	}
+
+	if _, found, err := svc.ExportSkillBundle("missing"); err != nil || found {
+		t.Fatalf("expected missing skill not found, found=%v err=%v", found, err)
+	}
+	data, found, err := svc.ExportSkillBundle("shared")
+	if err != nil || !found {
+		t.Fatalf("export skill bundle failed: found=%v err=%v", found, err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("exported bundle is not a zip: %v", err)
+	}
+	got := map[string]string{}
+	for _, entry := range archive.File {
+		rc, err := entry.Open()
+		if err != nil {
+			t.Fatalf("open %s: %v", entry.Name, err)
+		}
+		body, _ := io.ReadAll(rc)
+		rc.Close()
+		got[entry.Name] = string(body)
+	}
+	want := map[string]string{
+		"skill.md":                 "Share me.",
+		"references/docs/guide.md": "guide",
+		"references/icon.png":      "\x89PNG\xff",
+		"scripts/run.sh":           "echo run",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("unexpected bundle entries: %#v", got)
+	}
+	for name, body := range want {
+		if got[name] != body {
+			t.Fatalf("entry %s=%q, want %q", name, got[name], body)
+		}
+	}
+}
+
+func buildTestSkillZip(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, body := range files {
+		fw, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("create zip entry: %v", err)
+		}
+		if _, err := fw.Write([]byte(body)); err != nil {
+			t.Fatalf("write zip entry: %v", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("close zip: %v", err)
+	}
+	return buf.Bytes()
+}
+
 func TestReplaceChannelsRejectsUnsupported(t *testing.T) {
 	t.Parallel()
 
@@ -71,6 +354,48 @@ func TestReplaceChannelsRejectsUnsupported(t *testing.T) {
 	}
 }
 
+func TestPutChannelValidatesEnabledConfig(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	store, err := repo.NewStore(dir)
+	if err != nil {
+		t.Fatalf("new store failed: %v", err)
+	}
+	svc := NewService(Dependencies{
+		Store:             adapters.NewRepoStateStore(store),
+		DataDir:           dir,
+		SupportedChannels: map[string]struct{}{"slack": {}},
+		ChannelRequirements: map[string]ChannelRequirement{
+			"slack": {
+				RequiredConfig: [][]string{{"webhook_url"}},
+				Validate: func(cfg map[string]interface{}) error {
+					if cfg["webhook_url"] == nil {
+						return errors.New("webhook_url is required")
+					}
+					return nil
+				},
+			},
+		},
+	})
+
+	if err := svc.PutChannel("slack", map[string]interface{}{"enabled": false}); err != nil {
+		t.Fatalf("disabled channel should skip validation, got=%v", err)
+	}
+	err = svc.PutChannel("slack", map[string]interface{}{"enabled": true})
+	validation := (*ValidationError)(nil)
+	if !errors.As(err, &validation) {
+		t.Fatalf("expected validation error, got=%v", err)
+	}
+	if validation.Code != "invalid_channel_config" {
+		t.Fatalf("validation code=%s", validation.Code)
+	}
+	infos := svc.ListChannelTypeInfos()
+	if len(infos) != 1 || len(infos[0].RequiredConfig) != 1 {
+		t.Fatalf("unexpected channel type infos: %#v", infos)
+	}
+}
+
 func TestSetSkillEnabledNotFound(t *testing.T) {
 	t.Parallel()
 
@@ -0,0 +1,362 @@
+package admin
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"nextai/apps/gateway/internal/domain"
+	"nextai/apps/gateway/internal/service/ports"
+)
+
+const (
+	// SkillBundleMaxSize bounds the uploaded archive.
+	SkillBundleMaxSize = int64(5 << 20)
+	// skillBundleMaxUnpacked bounds the unpacked size so a small archive
+	// cannot expand without limit.
+	skillBundleMaxUnpacked = int64(20 << 20)
+	skillBundleMaxEntries  = 512
+	skillBundleManifest    = "skill.md"
+)
+
+type ImportSkillBundleInput struct {
+	// Name overrides the skill name; otherwise the archive's single top-level
+	// directory or FileName without its extension is used.
+	Name     string
+	FileName string
+	Data     []byte
+	// Overwrite replaces a skill of the same name; without it the import
+	// fails with ErrSkillExists.
+	Overwrite bool
+}
+
+// ImportSkillBundle unpacks a zip or tar(.gz) archive holding skill.md plus
+// optional references/ and scripts/ directories and stores it as a skill.
+// Files that are not valid UTF-8 are kept as base64 data URLs.
+func (s *Service) ImportSkillBundle(input ImportSkillBundleInput) (string, error) {
+	if err := s.validateStore(); err != nil {
+		return "", err
+	}
+	if int64(len(input.Data)) > SkillBundleMaxSize {
+		return "", &ValidationError{
+			Code:    "invalid_skill_bundle",
+			Message: fmt.Sprintf("skill bundle exceeds %d bytes", SkillBundleMaxSize),
+		}
+	}
+	files, err := readSkillBundleFiles(input.Data)
+	if err != nil {
+		return "", &ValidationError{Code: "invalid_skill_bundle", Message: err.Error()}
+	}
+	root := skillBundleRoot(files)
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		name = root
+	}
+	if name == "" {
+		base := path.Base(strings.ReplaceAll(strings.TrimSpace(input.FileName), "\\", "/"))
+		name = strings.TrimSuffix(strings.TrimSuffix(base, ".gz"), path.Ext(strings.TrimSuffix(base, ".gz")))
+	}
+	if !validSkillName(name) {
+		return "", &ValidationError{Code: "invalid_skill", Message: fmt.Sprintf("invalid skill name %q", name)}
+	}
+
+	content := ""
+	references := map[string]interface{}{}
+	scripts := map[string]interface{}{}
+	for filePath, data := range files {
+		if root != "" {
+			filePath = strings.TrimPrefix(filePath, root+"/")
+		}
+		if filePath == skillBundleManifest {
+			content = string(data)
+			continue
+		}
+		dir, rest, ok := strings.Cut(filePath, "/")
+		if !ok || rest == "" {
+			continue
+		}
+		switch dir {
+		case "references":
+			err = putSkillBundleFile(references, rest, data)
+		case "scripts":
+			err = putSkillBundleFile(scripts, rest, data)
+		default:
+			continue
+		}
+		if err != nil {
+			return "", &ValidationError{Code: "invalid_skill_bundle", Message: err.Error()}
+		}
+	}
+	if strings.TrimSpace(content) == "" {
+		return "", &ValidationError{Code: "invalid_skill_bundle", Message: "skill bundle must contain a non-empty skill.md"}
+	}
+
+	if _, err := s.CreateSkill(CreateSkillInput{
+		Name:       name,
+		Content:    content,
+		References: references,
+		Scripts:    scripts,
+		CreateOnly: !input.Overwrite,
+	}); err != nil {
+		return name, err
+	}
+	return name, nil
+}
+
+// ExportSkillBundle zips a skill in the layout ImportSkillBundle reads:
+// skill.md at the root plus references/ and scripts/ trees. Data URLs written
+// on import are decoded back to their original bytes.
+func (s *Service) ExportSkillBundle(name string) ([]byte, bool, error) {
+	if err := s.validateStore(); err != nil {
+		return nil, false, err
+	}
+	var skill domain.SkillSpec
+	found := false
+	s.deps.Store.ReadSettings(func(st ports.SettingsAggregate) {
+		skill, found = st.Skills[name]
+	})
+	if !found {
+		return nil, false, nil
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	files := map[string][]byte{skillBundleManifest: []byte(skill.Content)}
+	collectSkillBundleFiles(files, "references", skill.References)
+	collectSkillBundleFiles(files, "scripts", skill.Scripts)
+	names := make([]string, 0, len(files))
+	for filePath := range files {
+		names = append(names, filePath)
+	}
+	sort.Strings(names)
+	for _, filePath := range names {
+		entry, err := archive.Create(filePath)
+		if err != nil {
+			return nil, true, err
+		}
+		if _, err := entry.Write(files[filePath]); err != nil {
+			return nil, true, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, true, err
+	}
+	return buf.Bytes(), true, nil
+}
+
+func collectSkillBundleFiles(out map[string][]byte, prefix string, tree map[string]interface{}) {
+	for key, value := range tree {
+		filePath := prefix + "/" + key
+		if _, err := cleanSkillBundlePath(filePath); err != nil || strings.ContainsAny(key, "/\\") {
+			continue
+		}
+		switch item := value.(type) {
+		case map[string]interface{}:
+			collectSkillBundleFiles(out, filePath, item)
+		case string:
+			out[filePath] = skillBundleFileBytes(item)
+		}
+	}
+}
+
+// skillBundleFileBytes reverses skillBundleFileContent for base64 data URLs.
+func skillBundleFileBytes(content string) []byte {
+	rest, ok := strings.CutPrefix(content, "data:")
+	if !ok {
+		return []byte(content)
+	}
+	header, payload, ok := strings.Cut(rest, ",")
+	if !ok || !strings.HasSuffix(header, ";base64") {
+		return []byte(content)
+	}
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return []byte(content)
+	}
+	return data
+}
+
+func readSkillBundleFiles(data []byte) (map[string][]byte, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		return readSkillZip(data)
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip archive: %v", err)
+		}
+		defer gz.Close()
+		return readSkillTar(gz)
+	default:
+		return readSkillTar(bytes.NewReader(data))
+	}
+}
+
+func readSkillZip(data []byte) (map[string][]byte, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid zip archive: %v", err)
+	}
+	if len(archive.File) > skillBundleMaxEntries {
+		return nil, fmt.Errorf("skill bundle has more than %d entries", skillBundleMaxEntries)
+	}
+	files := map[string][]byte{}
+	var total int64
+	for _, entry := range archive.File {
+		name, err := cleanSkillBundlePath(entry.Name)
+		if err != nil {
+			return nil, err
+		}
+		if entry.FileInfo().IsDir() || name == "" {
+			continue
+		}
+		rc, err := entry.Open()
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %v", name, err)
+		}
+		content, err := readSkillBundleEntry(rc, &total)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		files[name] = content
+	}
+	return files, nil
+}
+
+func readSkillTar(r io.Reader) (map[string][]byte, error) {
+	archive := tar.NewReader(r)
+	files := map[string][]byte{}
+	var total int64
+	for entries := 0; ; entries++ {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid tar archive: %v", err)
+		}
+		if entries >= skillBundleMaxEntries {
+			return nil, fmt.Errorf("skill bundle has more than %d entries", skillBundleMaxEntries)
+		}
+		name, err := cleanSkillBundlePath(header.Name)
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg || name == "" {
+			continue
+		}
+		content, err := readSkillBundleEntry(archive, &total)
+		if err != nil {
+			return nil, err
+		}
+		files[name] = content
+	}
+	if len(files) == 0 {
+		return nil, errors.New("skill bundle must be a zip or tar archive with files")
+	}
+	return files, nil
+}
+
+func readSkillBundleEntry(r io.Reader, total *int64) ([]byte, error) {
+	remaining := skillBundleMaxUnpacked - *total
+	content, err := io.ReadAll(io.LimitReader(r, remaining+1))
+	if err != nil {
+		return nil, err
+	}
+	*total += int64(len(content))
+	if *total > skillBundleMaxUnpacked {
+		return nil, fmt.Errorf("skill bundle unpacks to more than %d bytes", skillBundleMaxUnpacked)
+	}
+	return content, nil
+}
+
+// cleanSkillBundlePath rejects absolute paths and any ".." segment instead of
+// cleaning them away, so a crafted entry cannot land outside its directory.
+func cleanSkillBundlePath(raw string) (string, error) {
+	name := strings.ReplaceAll(raw, "\\", "/")
+	if strings.HasPrefix(name, "/") || (len(name) > 1 && name[1] == ':') {
+		return "", fmt.Errorf("skill bundle entry %q must be a relative path", raw)
+	}
+	parts := []string{}
+	for _, part := range strings.Split(name, "/") {
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			return "", fmt.Errorf("skill bundle entry %q escapes the bundle", raw)
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, "/"), nil
+}
+
+// skillBundleRoot returns the single top-level directory every file shares
+// when skill.md is not at the archive root, as produced by zipping a folder.
+func skillBundleRoot(files map[string][]byte) string {
+	if _, ok := files[skillBundleManifest]; ok {
+		return ""
+	}
+	root := ""
+	for name := range files {
+		dir, _, ok := strings.Cut(name, "/")
+		if !ok || (root != "" && dir != root) {
+			return ""
+		}
+		root = dir
+	}
+	return root
+}
+
+func putSkillBundleFile(tree map[string]interface{}, filePath string, data []byte) error {
+	parts := strings.Split(filePath, "/")
+	node := tree
+	for _, part := range parts[:len(parts)-1] {
+		child, ok := node[part]
+		if !ok {
+			next := map[string]interface{}{}
+			node[part] = next
+			node = next
+			continue
+		}
+		next, ok := child.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("skill bundle path %q conflicts with a file", filePath)
+		}
+		node = next
+	}
+	leaf := parts[len(parts)-1]
+	if _, exists := node[leaf]; exists {
+		return fmt.Errorf("skill bundle path %q conflicts with a directory", filePath)
+	}
+	node[leaf] = skillBundleFileContent(leaf, data)
+	return nil
+}
+
+func skillBundleFileContent(fileName string, data []byte) string {
+	if utf8.Valid(data) {
+		return string(data)
+	}
+	mediaType := mime.TypeByExtension(strings.ToLower(path.Ext(fileName)))
+	if mediaType == "" {
+		mediaType = "application/octet-stream"
+	}
+	return "data:" + mediaType + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
+
+func validSkillName(name string) bool {
+	if name == "" || name == "." || name == ".." {
+		return false
+	}
+	return !strings.ContainsAny(name, "/\\")
+}
@@ -7,12 +7,25 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"nextai/apps/gateway/internal/domain"
 	"nextai/apps/gateway/internal/runner"
 	"nextai/apps/gateway/internal/service/ports"
 )
 
+const (
+	DefaultMaxSteps = 16
+
+	ErrorCodeMaxStepsExceeded = "max_steps_exceeded"
+	ErrorCodeAgentTimeout     = "agent_timeout"
+	ErrorCodeCancelled        = "cancelled"
+
+	WarningCodeContentPartsDropped = "content_parts_dropped"
+
+	EventTypeProviderFallback = "provider_fallback"
+)
+
 type ToolCall struct {
 	Name  string
 	Input map[string]interface{}
@@ -29,12 +42,34 @@ type ProcessParams struct {
 	RequestedToolCall ToolCall
 	Streaming         bool
 	ReplyChunkSize    int
+	// MaxSteps bounds the provider turns of one request; <= 0 uses DefaultMaxSteps.
+	MaxSteps int
+	// MaxRecoverySteps bounds consecutive steps that only produced invalid or
+	// failed tool calls; <= 0 leaves them to MaxSteps alone.
+	MaxRecoverySteps int
+	// DryRun stops after the first turn and reports tool calls without executing them.
+	DryRun bool
+	// FallbackConfigs are tried in order when a turn fails with
+	// provider_request_failed; the run stays on the fallback once switched.
+	FallbackConfigs []runner.GenerateConfig
+	// ExposeProviderErrors adds the upstream status and response body snippet
+	// to the details of provider failures.
+	ExposeProviderErrors bool
+	// ToolApproval, when set, pauses before the listed tools run until each
+	// call is approved or rejected. Only provider-issued calls are gated.
+	ToolApproval *ToolApproval
 }
 
 type ProcessResult struct {
 	Reply              string
 	Events             []domain.AgentEvent
 	ProviderResponseID string
+	// Usage sums the token counts reported by every provider turn; nil when none reported any.
+	Usage *domain.AgentUsage
+	// StopReason is one of the domain.StopReason* values.
+	StopReason string
+	// ProviderMeta describes the final provider turn; only set for debug requests.
+	ProviderMeta *domain.ProviderMeta
 }
 
 type ProcessError struct {
@@ -101,6 +136,12 @@ func (s *Service) Process(
 	if len(toolDefinitions) == 0 {
 		toolDefinitions = s.deps.ToolRuntime.ListToolDefinitions(params.PromptMode)
 	}
+	maxSteps := params.MaxSteps
+	if maxSteps <= 0 {
+		maxSteps = DefaultMaxSteps
+	}
+	partialReplies := []string{}
+	warnedDroppedContent := false
 	appendReplyDeltas := func(step int, text string) {
 		for _, chunk := range splitReplyChunks(text, replyChunkSize) {
 			appendEvent(domain.AgentEvent{
@@ -130,15 +171,25 @@ func (s *Service) Process(
 		eventToolInput := normalizeToolCallEventInput(execName, safeMap(params.RequestedToolCall.Input), toolInput)
 
 		appendEvent(domain.AgentEvent{Type: "step_started", Step: step})
-		appendEvent(domain.AgentEvent{
+		toolCallEvent := domain.AgentEvent{
 			Type: "tool_call",
 			Step: step,
 			ToolCall: &domain.AgentToolCallPayload{
 				Name:  eventToolName,
 				Input: eventToolInput,
 			},
-		})
-		toolReply, err := s.deps.ToolRuntime.ExecuteToolCall(ctx, params.PromptMode, execName, toolInput)
+		}
+		if params.DryRun {
+			toolCallEvent.Meta = dryRunEventMeta()
+			appendEvent(toolCallEvent)
+			appendEvent(domain.AgentEvent{Type: "completed", Step: step, StopReason: domain.StopReasonNormal, Meta: dryRunEventMeta()})
+			return ProcessResult{Events: events, StopReason: domain.StopReasonNormal}, nil
+		}
+		appendEvent(toolCallEvent)
+		toolStartedAt := time.Now()
+		toolCtx, screenshot := withToolScreenshotSlot(ctx)
+		toolReply, err := s.deps.ToolRuntime.ExecuteToolCall(toolCtx, params.PromptMode, execName, toolInput)
+		toolDurationMS := time.Since(toolStartedAt).Milliseconds()
 		if err != nil {
 			status, code, message := s.deps.ErrorMapper.MapToolError(err)
 			return ProcessResult{}, &ProcessError{Status: status, Code: code, Message: message}
@@ -148,47 +199,134 @@ func (s *Service) Process(
 			Type: "tool_result",
 			Step: step,
 			ToolResult: &domain.AgentToolResultPayload{
-				Name:    eventToolName,
-				OK:      true,
-				Summary: summarizeAgentEventText(reply),
+				Name:       eventToolName,
+				OK:         true,
+				Summary:    summarizeAgentEventText(reply),
+				DurationMS: toolDurationMS,
+				Screenshot: screenshot.screenshot(),
 			},
 		})
 		appendReplyDeltas(step, reply)
-		appendEvent(domain.AgentEvent{Type: "completed", Step: step, Reply: reply})
-		return ProcessResult{Reply: reply, Events: events}, nil
+		appendEvent(domain.AgentEvent{Type: "completed", Step: step, Reply: reply, StopReason: domain.StopReasonNormal})
+		return ProcessResult{Reply: reply, Events: events, StopReason: domain.StopReasonNormal}, nil
 	}
 
 	workflowInput := cloneAgentInputMessages(params.EffectiveInput)
 	generateConfig := params.GenerateConfig
+	fallbackConfigs := params.FallbackConfigs
 	providerResponseID := strings.TrimSpace(generateConfig.PreviousResponseID)
 	step := 1
+	stopReason := domain.StopReasonNormal
+	var providerMeta *domain.ProviderMeta
+	var totalUsage *domain.AgentUsage
+	appendUsage := func(step int, usage *domain.AgentUsage) {
+		if usage == nil {
+			return
+		}
+		appendEvent(domain.AgentEvent{Type: "usage", Step: step, Usage: usage})
+	}
 
+	// partialResult hands back what was gathered so the caller can persist it before failing.
+	partialResult := func(stopReason string) ProcessResult {
+		return ProcessResult{
+			Reply:              strings.Join(partialReplies, "\n\n"),
+			Events:             events,
+			ProviderResponseID: providerResponseID,
+			Usage:              totalUsage,
+			StopReason:         stopReason,
+		}
+	}
+	// A recovery step is one whose tool calls were all invalid or failed; a
+	// successful tool call resets the count.
+	recoverySteps := 0
+	countRecoveryStep := func() (limitReached bool) {
+		recoverySteps++
+		return params.MaxRecoverySteps > 0 && recoverySteps >= params.MaxRecoverySteps
+	}
+	// stopAtRecoveryLimit ends the run with the latest assistant text instead
+	// of giving a stubborn model another turn.
+	stopAtRecoveryLimit := func(step int) ProcessResult {
+		reply = "(empty reply)"
+		if n := len(partialReplies); n > 0 {
+			reply = partialReplies[n-1]
+		}
+		if !params.Streaming {
+			appendReplyDeltas(step, reply)
+		}
+		appendEvent(domain.AgentEvent{
+			Type:       "completed",
+			Step:       step,
+			Reply:      reply,
+			StopReason: domain.StopReasonRecoveryLimit,
+			Meta:       map[string]interface{}{"max_recovery_steps": params.MaxRecoverySteps},
+		})
+		return ProcessResult{Reply: reply, Events: events, ProviderResponseID: providerResponseID, Usage: totalUsage, StopReason: domain.StopReasonRecoveryLimit}
+	}
 	for {
+		if step > maxSteps {
+			// The step cap is the caller's own configuration, not a server
+			// fault, so it is reported as 422.
+			return partialResult(domain.StopReasonMaxSteps), &ProcessError{
+				Status:  422,
+				Code:    ErrorCodeMaxStepsExceeded,
+				Message: fmt.Sprintf("agent stopped after reaching the maximum of %d steps", maxSteps),
+				Details: map[string]interface{}{"max_steps": maxSteps, "stop_reason": domain.StopReasonMaxSteps},
+			}
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return partialResult(domain.StopReasonTimeout), agentTimeoutError(step)
+		}
+		if errors.Is(ctx.Err(), context.Canceled) {
+			return partialResult(domain.StopReasonCancelled), agentCancelledError(step)
+		}
 		appendEvent(domain.AgentEvent{Type: "step_started", Step: step})
 		turnReq := params.Request
 		turnReq.Input = workflowInput
 
 		stepHadStreamingDelta := false
-		var (
-			turn   runner.TurnResult
-			runErr error
-		)
-		if params.Streaming {
-			turn, runErr = s.deps.Runner.GenerateTurnStream(ctx, turnReq, generateConfig, toolDefinitions, func(delta string) {
-				if delta == "" {
-					return
-				}
-				stepHadStreamingDelta = true
-				appendEvent(domain.AgentEvent{
-					Type:  "assistant_delta",
-					Step:  step,
-					Delta: delta,
+		generateStep := func() (runner.TurnResult, error) {
+			if params.Streaming {
+				return s.deps.Runner.GenerateTurnStream(ctx, turnReq, generateConfig, toolDefinitions, func(delta string) {
+					if delta == "" {
+						return
+					}
+					stepHadStreamingDelta = true
+					appendEvent(domain.AgentEvent{
+						Type:  "assistant_delta",
+						Step:  step,
+						Delta: delta,
+					})
 				})
+			}
+			return s.deps.Runner.GenerateTurn(ctx, turnReq, generateConfig, toolDefinitions)
+		}
+		turn, runErr := generateStep()
+		// A failed provider request moves to the next fallback, unless deltas
+		// were already streamed and a retry would repeat them.
+		for runErr != nil && len(fallbackConfigs) > 0 && !stepHadStreamingDelta && ctx.Err() == nil && isProviderRequestFailure(runErr) {
+			next := fallbackConfigs[0]
+			fallbackConfigs = fallbackConfigs[1:]
+			appendEvent(domain.AgentEvent{
+				Type: EventTypeProviderFallback,
+				Step: step,
+				Meta: map[string]interface{}{
+					"from_provider_id": generateConfig.ProviderID,
+					"from_model":       generateConfig.Model,
+					"to_provider_id":   next.ProviderID,
+					"to_model":         next.Model,
+					"error":            runErr.Error(),
+				},
 			})
-		} else {
-			turn, runErr = s.deps.Runner.GenerateTurn(ctx, turnReq, generateConfig, toolDefinitions)
+			generateConfig = next
+			turn, runErr = generateStep()
 		}
 		if runErr != nil {
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return partialResult(domain.StopReasonTimeout), agentTimeoutError(step)
+			}
+			if errors.Is(ctx.Err(), context.Canceled) {
+				return partialResult(domain.StopReasonCancelled), agentCancelledError(step)
+			}
 			if recoveredCall, recovered := s.deps.ToolRuntime.RecoverInvalidProviderToolCall(runErr, step); recovered {
 				appendEvent(domain.AgentEvent{
 					Type: "tool_call",
@@ -235,6 +373,9 @@ func (s *Service) Process(
 						},
 					},
 				)
+				if countRecoveryStep() {
+					return stopAtRecoveryLimit(step), nil
+				}
 				step++
 				continue
 			}
@@ -243,13 +384,46 @@ func (s *Service) Process(
 				Status:  status,
 				Code:    code,
 				Message: message,
-				Details: buildRunnerErrorDetails(runErr),
+				Details: buildRunnerErrorDetails(runErr, params.ExposeProviderErrors),
 			}
 		}
 		if responseID := strings.TrimSpace(turn.ResponseID); responseID != "" {
 			providerResponseID = responseID
 			generateConfig.PreviousResponseID = responseID
 		}
+		if turn.DroppedContentParts > 0 && !warnedDroppedContent {
+			warnedDroppedContent = true
+			appendEvent(domain.AgentEvent{
+				Type: "warning",
+				Step: step,
+				Meta: map[string]interface{}{
+					"code":          WarningCodeContentPartsDropped,
+					"message":       "input parts the active provider cannot accept were dropped",
+					"dropped_parts": turn.DroppedContentParts,
+				},
+			})
+		}
+		stepUsage := toAgentUsage(turn.Usage)
+		totalUsage = addAgentUsage(totalUsage, stepUsage)
+
+		if params.DryRun {
+			for _, call := range turn.ToolCalls {
+				appendEvent(domain.AgentEvent{
+					Type: "tool_call",
+					Step: step,
+					ToolCall: &domain.AgentToolCallPayload{
+						Name:  strings.TrimSpace(call.Name),
+						Input: safeMap(call.Arguments),
+					},
+					Meta: dryRunEventMeta(),
+				})
+			}
+			reply = strings.TrimSpace(turn.Text)
+			stopReason = turnStopReason(turn)
+			appendEvent(domain.AgentEvent{Type: "completed", Step: step, Reply: reply, StopReason: stopReason, Meta: dryRunEventMeta()})
+			appendUsage(step, stepUsage)
+			return ProcessResult{Reply: reply, Events: events, ProviderResponseID: providerResponseID, Usage: totalUsage, StopReason: stopReason}, nil
+		}
 
 		if len(turn.ToolCalls) == 0 {
 			reply = strings.TrimSpace(turn.Text)
@@ -259,11 +433,20 @@ func (s *Service) Process(
 			if !params.Streaming || !stepHadStreamingDelta {
 				appendReplyDeltas(step, reply)
 			}
-			completed := domain.AgentEvent{Type: "completed", Step: step, Reply: reply}
+			stopReason = turnStopReason(turn)
+			completed := domain.AgentEvent{Type: "completed", Step: step, Reply: reply, StopReason: stopReason}
 			if providerResponseID != "" {
 				completed.Meta = map[string]interface{}{"provider_response_id": providerResponseID}
 			}
+			if params.Request.Debug {
+				providerMeta = turnProviderMeta(turn, generateConfig.Model)
+				if completed.Meta == nil {
+					completed.Meta = map[string]interface{}{}
+				}
+				completed.Meta["provider_meta"] = providerMeta
+			}
 			appendEvent(completed)
+			appendUsage(step, stepUsage)
 			break
 		}
 
@@ -275,76 +458,164 @@ func (s *Service) Process(
 		}
 		if text := strings.TrimSpace(turn.Text); text != "" {
 			assistantMessage.Content = []domain.RuntimeContent{{Type: "text", Text: text}}
+			partialReplies = append(partialReplies, text)
 		}
 		workflowInput = append(workflowInput, assistantMessage)
 
+		stepToolSucceeded := false
+		prepared := make([]preparedToolCall, 0, len(turn.ToolCalls))
 		for _, call := range turn.ToolCalls {
-			rawCallName := strings.TrimSpace(call.Name)
-			execName := normalizeProviderToolName(rawCallName)
-			if execName == "" {
-				execName = strings.ToLower(rawCallName)
-			}
-			execInput := normalizeProviderToolInput(execName, strings.TrimSpace(params.PromptMode), safeMap(call.Arguments))
-			execInput = enrichNativeToolInput(execName, execInput, params.Request, params.PromptMode, params.CollaborationMode, call.ID)
-			eventToolName := rawCallName
-			if eventToolName == "" {
-				eventToolName = execName
-			}
-			eventToolInput := normalizeToolCallEventInput(execName, safeMap(call.Arguments), execInput)
-			appendEvent(domain.AgentEvent{
-				Type: "tool_call",
-				Step: step,
-				ToolCall: &domain.AgentToolCallPayload{
-					Name:  eventToolName,
-					Input: eventToolInput,
-				},
-			})
-			toolReply, toolErr := s.deps.ToolRuntime.ExecuteToolCall(ctx, params.PromptMode, execName, execInput)
-			if toolErr != nil {
-				toolReply = s.deps.ToolRuntime.FormatToolErrorFeedback(toolErr)
-				appendEvent(domain.AgentEvent{
-					Type: "tool_result",
-					Step: step,
-					ToolResult: &domain.AgentToolResultPayload{
-						Name:    eventToolName,
-						OK:      false,
-						Summary: summarizeAgentEventText(toolReply),
-					},
-				})
-				workflowInput = append(workflowInput, domain.AgentInputMessage{
-					Role:    "tool",
-					Type:    "message",
-					Content: []domain.RuntimeContent{{Type: "text", Text: toolReply}},
-					Metadata: map[string]interface{}{
-						"tool_call_id": call.ID,
-						"name":         eventToolName,
-					},
-				})
-				continue
+			prepared = append(prepared, prepareToolCall(call, params))
+		}
+		// recordOutcome reports a finished call and hands its output, or the
+		// error feedback, back to the model.
+		recordOutcome := func(call preparedToolCall, outcome toolCallOutcome) {
+			toolReply := outcome.reply
+			if outcome.err != nil {
+				toolReply = s.deps.ToolRuntime.FormatToolErrorFeedback(outcome.err)
+			} else {
+				stepToolSucceeded = true
 			}
 			appendEvent(domain.AgentEvent{
 				Type: "tool_result",
 				Step: step,
 				ToolResult: &domain.AgentToolResultPayload{
-					Name:    eventToolName,
-					OK:      true,
-					Summary: summarizeAgentEventText(toolReply),
-				},
-			})
-			workflowInput = append(workflowInput, domain.AgentInputMessage{
-				Role:    "tool",
-				Type:    "message",
-				Content: []domain.RuntimeContent{{Type: "text", Text: toolReply}},
-				Metadata: map[string]interface{}{
-					"tool_call_id": call.ID,
-					"name":         eventToolName,
+					Name:       call.eventName,
+					OK:         outcome.err == nil,
+					Summary:    summarizeAgentEventText(toolReply),
+					DurationMS: outcome.durationMS,
+					Screenshot: outcome.screenshot,
 				},
 			})
+			workflowInput = append(workflowInput, call.message(toolReply))
+		}
+		for callIndex := 0; callIndex < len(prepared); {
+			// Consecutive read-only calls run together; results still reach
+			// the model in the order the provider issued the calls.
+			if batch := concurrentToolCallRun(prepared[callIndex:], params.ToolApproval); batch > 1 {
+				calls := prepared[callIndex : callIndex+batch]
+				for _, call := range calls {
+					appendEvent(call.callEvent(step))
+				}
+				for index, outcome := range s.executeToolCallsConcurrently(ctx, params.PromptMode, calls) {
+					recordOutcome(calls[index], outcome)
+				}
+				callIndex += batch
+				continue
+			}
+			call := prepared[callIndex]
+			appendEvent(call.callEvent(step))
+			if params.ToolApproval.requires(call.rawName, call.execName) {
+				proposed := domain.AgentToolCallPayload{Name: call.eventName, Input: call.eventInput}
+				decision, waitErr := params.ToolApproval.await(ctx, step, toolApprovalID(call.id, step, callIndex), proposed, appendEvent)
+				if waitErr != nil {
+					if errors.Is(waitErr, context.DeadlineExceeded) {
+						return partialResult(domain.StopReasonTimeout), agentTimeoutError(step)
+					}
+					return partialResult(domain.StopReasonCancelled), agentCancelledError(step)
+				}
+				if !decision.Approved {
+					// The denial goes back to the model as the tool's output so
+					// it can choose another approach.
+					toolReply := toolRejectionFeedback(decision)
+					appendEvent(domain.AgentEvent{
+						Type: "tool_result",
+						Step: step,
+						ToolResult: &domain.AgentToolResultPayload{
+							Name:    call.eventName,
+							OK:      false,
+							Summary: summarizeAgentEventText(toolReply),
+						},
+					})
+					workflowInput = append(workflowInput, call.message(toolReply))
+					callIndex++
+					continue
+				}
+			}
+			recordOutcome(call, s.executeToolCall(ctx, params.PromptMode, call))
+			callIndex++
+		}
+		appendUsage(step, stepUsage)
+		if stepToolSucceeded {
+			recoverySteps = 0
+		} else if countRecoveryStep() {
+			return stopAtRecoveryLimit(step), nil
 		}
 		step++
 	}
 
-	return ProcessResult{Reply: reply, Events: events, ProviderResponseID: providerResponseID}, nil
+	return ProcessResult{Reply: reply, Events: events, ProviderResponseID: providerResponseID, Usage: totalUsage, StopReason: stopReason, ProviderMeta: providerMeta}, nil
+}
+
+func dryRunEventMeta() map[string]interface{} {
+	return map[string]interface{}{"dry_run": true}
+}
+
+func toAgentUsage(usage *runner.TurnUsage) *domain.AgentUsage {
+	if usage == nil {
+		return nil
+	}
+	return &domain.AgentUsage{
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		TotalTokens:      usage.PromptTokens + usage.CompletionTokens,
+	}
+}
+
+func addAgentUsage(total *domain.AgentUsage, usage *domain.AgentUsage) *domain.AgentUsage {
+	if usage == nil {
+		return total
+	}
+	sum := domain.AgentUsage{}
+	if total != nil {
+		sum = *total
+	}
+	sum.PromptTokens += usage.PromptTokens
+	sum.CompletionTokens += usage.CompletionTokens
+	sum.TotalTokens += usage.TotalTokens
+	return &sum
+}
+
+func agentTimeoutError(step int) *ProcessError {
+	return &ProcessError{
+		Status:  504,
+		Code:    ErrorCodeAgentTimeout,
+		Message: "agent processing exceeded the request deadline",
+		Details: map[string]interface{}{"step": step, "stop_reason": domain.StopReasonTimeout},
+	}
+}
+
+// agentCancelledError reports a run stopped by its caller; 499 follows the
+// common "client closed request" convention.
+func agentCancelledError(step int) *ProcessError {
+	return &ProcessError{
+		Status:  499,
+		Code:    ErrorCodeCancelled,
+		Message: "agent run was cancelled",
+		Details: map[string]interface{}{"step": step, "stop_reason": domain.StopReasonCancelled},
+	}
+}
+
+// turnProviderMeta collects the finish metadata of turn, falling back to the
+// configured model when the provider does not echo one.
+func turnProviderMeta(turn runner.TurnResult, configuredModel string) *domain.ProviderMeta {
+	model := strings.TrimSpace(turn.Model)
+	if model == "" {
+		model = strings.TrimSpace(configuredModel)
+	}
+	return &domain.ProviderMeta{
+		Model:             model,
+		FinishReason:      turn.FinishReason,
+		SystemFingerprint: turn.SystemFingerprint,
+	}
+}
+
+// turnStopReason reports length when the provider cut the final turn short.
+func turnStopReason(turn runner.TurnResult) string {
+	if turn.Truncated {
+		return domain.StopReasonLength
+	}
+	return domain.StopReasonNormal
 }
 
 func (s *Service) validateDependencies() error {
@@ -404,7 +675,7 @@ func cloneAgentInputMessages(input []domain.AgentInputMessage) []domain.AgentInp
 	return out
 }
 
-func buildRunnerErrorDetails(err error) interface{} {
+func buildRunnerErrorDetails(err error, exposeProvider bool) interface{} {
 	if err == nil {
 		return nil
 	}
@@ -419,6 +690,14 @@ func buildRunnerErrorDetails(err error) interface{} {
 				details["cause"] = cause
 			}
 		}
+		if exposeProvider {
+			if runnerErr.Status > 0 {
+				details["provider_status"] = runnerErr.Status
+			}
+			if body := strings.TrimSpace(runnerErr.ProviderBody); body != "" {
+				details["provider_body"] = body
+			}
+		}
 		if len(details) > 0 {
 			return details
 		}
@@ -497,6 +776,10 @@ func normalizeProviderToolName(name string) string {
 		return "view"
 	case "edit_file_lines", "edit_file_lins", "edit_file":
 		return "edit"
+	case "write_file", "create_file":
+		return "write"
+	case "list_directory", "list_files", "ls":
+		return "list_dir"
 	case "exec_command", "functions.exec_command":
 		return "shell"
 	case "write_stdin", "functions.write_stdin":
@@ -770,6 +1053,8 @@ func isLegacySingleItemInput(name string, input map[string]interface{}) bool {
 		return hasAnyToolInputField(input, "path", "start", "end", "start_line", "end_line")
 	case "edit":
 		return hasAnyToolInputField(input, "path", "start", "end", "start_line", "end_line", "content")
+	case "write":
+		return hasAnyToolInputField(input, "path", "content", "create_only")
 	case "shell":
 		return hasAnyToolInputField(input, "command", "cmd")
 	case "browser":
@@ -778,6 +1063,8 @@ func isLegacySingleItemInput(name string, input map[string]interface{}) bool {
 		return hasAnyToolInputField(input, "query", "q")
 	case "find":
 		return hasAnyToolInputField(input, "path", "pattern", "ignore_case")
+	case "list_dir":
+		return hasAnyToolInputField(input, "path", "depth", "glob")
 	default:
 		return false
 	}
@@ -958,3 +1245,8 @@ func stringifyToolInputValue(raw interface{}) string {
 		return ""
 	}
 }
+
+func isProviderRequestFailure(err error) bool {
+	var runnerErr *runner.RunnerError
+	return errors.As(err, &runnerErr) && runnerErr.Code == runner.ErrorCodeProviderRequestFailed
+}
@@ -3,13 +3,17 @@ package agent
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"nextai/apps/gateway/internal/domain"
 	"nextai/apps/gateway/internal/runner"
 	"nextai/apps/gateway/internal/service/adapters"
+	"nextai/apps/gateway/internal/service/ports"
 )
 
 func TestProcessToolCallSuccess(t *testing.T) {
@@ -60,6 +64,44 @@ func TestProcessToolCallSuccess(t *testing.T) {
 	}
 }
 
+func TestProcessToolResultReportsDuration(t *testing.T) {
+	t.Parallel()
+
+	svc := NewService(Dependencies{
+		Runner: adapters.AgentRunner{},
+		ToolRuntime: adapters.AgentToolRuntime{
+			ListToolDefinitionsFunc: func(string) []runner.ToolDefinition { return nil },
+			ExecuteToolCallFunc: func(context.Context, string, string, map[string]interface{}) (string, error) {
+				time.Sleep(30 * time.Millisecond)
+				return "slow", nil
+			},
+		},
+		ErrorMapper: adapters.AgentErrorMapper{
+			MapToolErrorFunc:   func(err error) (int, string, string) { return http.StatusBadRequest, "tool_error", err.Error() },
+			MapRunnerErrorFunc: func(err error) (int, string, string) { return http.StatusBadGateway, "runner_error", err.Error() },
+		},
+	})
+
+	result, processErr := svc.Process(context.Background(), ProcessParams{
+		HasToolCall:       true,
+		RequestedToolCall: ToolCall{Name: "shell", Input: map[string]interface{}{"command": "sleep"}},
+		ReplyChunkSize:    32,
+	}, nil)
+	if processErr != nil {
+		t.Fatalf("unexpected process error: %+v", processErr)
+	}
+	for _, evt := range result.Events {
+		if evt.Type != "tool_result" {
+			continue
+		}
+		if evt.ToolResult == nil || evt.ToolResult.DurationMS < 30 {
+			t.Fatalf("expected tool_result duration_ms >= 30, got=%#v", evt.ToolResult)
+		}
+		return
+	}
+	t.Fatalf("expected tool_result event, got=%#v", result.Events)
+}
+
 func TestProcessRunnerLoopWithToolCallAndStreamDelta(t *testing.T) {
 	t.Parallel()
 
@@ -129,6 +171,419 @@ func TestProcessRunnerLoopWithToolCallAndStreamDelta(t *testing.T) {
 	}
 }
 
+func TestProcessRunsReadOnlyToolCallsConcurrently(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	readsStarted := 0
+	bothReading := make(chan struct{})
+	shellRanAfterReads := false
+	var toolMessages []string
+	svc := NewService(Dependencies{
+		Runner: adapters.AgentRunner{
+			GenerateTurnFunc: func(_ context.Context, req domain.AgentProcessRequest, _ runner.GenerateConfig, _ []runner.ToolDefinition) (runner.TurnResult, error) {
+				if last := req.Input[len(req.Input)-1]; last.Role == "tool" {
+					for _, msg := range req.Input {
+						if msg.Role == "tool" {
+							toolMessages = append(toolMessages, fmt.Sprint(msg.Metadata["tool_call_id"], "=", msg.Content[0].Text))
+						}
+					}
+					return runner.TurnResult{Text: "done"}, nil
+				}
+				return runner.TurnResult{ToolCalls: []runner.ToolCall{
+					{ID: "call_view", Name: "view", Arguments: map[string]interface{}{"path": "a.txt", "start": 1, "end": 1}},
+					{ID: "call_search", Name: "search", Arguments: map[string]interface{}{"query": "b"}},
+					{ID: "call_shell", Name: "shell", Arguments: map[string]interface{}{"command": "echo c"}},
+				}}, nil
+			},
+		},
+		ToolRuntime: adapters.AgentToolRuntime{
+			ListToolDefinitionsFunc: func(string) []runner.ToolDefinition { return nil },
+			ExecuteToolCallFunc: func(_ context.Context, _ string, name string, _ map[string]interface{}) (string, error) {
+				if name == "shell" {
+					mu.Lock()
+					shellRanAfterReads = readsStarted == 2
+					mu.Unlock()
+					return name + " ok", nil
+				}
+				mu.Lock()
+				readsStarted++
+				if readsStarted == 2 {
+					close(bothReading)
+				}
+				mu.Unlock()
+				select {
+				case <-bothReading:
+					return name + " ok", nil
+				case <-time.After(2 * time.Second):
+					return "", errors.New("read-only calls did not overlap")
+				}
+			},
+		},
+		ErrorMapper: adapters.AgentErrorMapper{
+			MapToolErrorFunc:   func(err error) (int, string, string) { return http.StatusBadRequest, "tool_error", err.Error() },
+			MapRunnerErrorFunc: func(err error) (int, string, string) { return http.StatusBadGateway, "runner_error", err.Error() },
+		},
+	})
+
+	result, processErr := svc.Process(context.Background(), ProcessParams{
+		Request:        domain.AgentProcessRequest{Input: []domain.AgentInputMessage{{Role: "user", Type: "message", Content: []domain.RuntimeContent{{Type: "text", Text: "look"}}}}},
+		EffectiveInput: []domain.AgentInputMessage{{Role: "user", Type: "message", Content: []domain.RuntimeContent{{Type: "text", Text: "look"}}}},
+		ReplyChunkSize: 32,
+	}, nil)
+	if processErr != nil {
+		t.Fatalf("unexpected process error: %+v", processErr)
+	}
+	if result.Reply != "done" {
+		t.Fatalf("unexpected reply: %q", result.Reply)
+	}
+	if !shellRanAfterReads {
+		t.Fatal("shell must run after the concurrent read-only calls finish")
+	}
+	want := "call_view=view ok,call_search=search ok,call_shell=shell ok"
+	if got := strings.Join(toolMessages, ","); got != want {
+		t.Fatalf("tool messages out of order:\n got=%s\nwant=%s", got, want)
+	}
+}
+
+func TestProcessTurnsConcurrentToolPanicIntoToolError(t *testing.T) {
+	t.Parallel()
+
+	var toolMessages []string
+	svc := NewService(Dependencies{
+		Runner: adapters.AgentRunner{
+			GenerateTurnFunc: func(_ context.Context, req domain.AgentProcessRequest, _ runner.GenerateConfig, _ []runner.ToolDefinition) (runner.TurnResult, error) {
+				if last := req.Input[len(req.Input)-1]; last.Role == "tool" {
+					for _, msg := range req.Input {
+						if msg.Role == "tool" {
+							toolMessages = append(toolMessages, fmt.Sprint(msg.Metadata["tool_call_id"], "=", msg.Content[0].Text))
+						}
+					}
+					return runner.TurnResult{Text: "done"}, nil
+				}
+				return runner.TurnResult{ToolCalls: []runner.ToolCall{
+					{ID: "call_view", Name: "view", Arguments: map[string]interface{}{"path": "a.txt", "start": 1, "end": 1}},
+					{ID: "call_search", Name: "search", Arguments: map[string]interface{}{"query": "b"}},
+				}}, nil
+			},
+		},
+		ToolRuntime: adapters.AgentToolRuntime{
+			ListToolDefinitionsFunc: func(string) []runner.ToolDefinition { return nil },
+			ExecuteToolCallFunc: func(_ context.Context, _ string, name string, _ map[string]interface{}) (string, error) {
+				if name == "view" {
+					panic("boom")
+				}
+				return name + " ok", nil
+			},
+			FormatToolErrorFeedbackFunc: func(err error) string { return "error: " + err.Error() },
+		},
+		ErrorMapper: adapters.AgentErrorMapper{
+			MapToolErrorFunc:   func(err error) (int, string, string) { return http.StatusBadRequest, "tool_error", err.Error() },
+			MapRunnerErrorFunc: func(err error) (int, string, string) { return http.StatusBadGateway, "runner_error", err.Error() },
+		},
+	})
+
+	result, processErr := svc.Process(context.Background(), ProcessParams{
+		Request:        domain.AgentProcessRequest{Input: []domain.AgentInputMessage{{Role: "user", Type: "message", Content: []domain.RuntimeContent{{Type: "text", Text: "look"}}}}},
+		EffectiveInput: []domain.AgentInputMessage{{Role: "user", Type: "message", Content: []domain.RuntimeContent{{Type: "text", Text: "look"}}}},
+		ReplyChunkSize: 32,
+	}, nil)
+	if processErr != nil {
+		t.Fatalf("unexpected process error: %+v", processErr)
+	}
+	if result.Reply != "done" {
+		t.Fatalf("unexpected reply: %q", result.Reply)
+	}
+	want := "call_view=error: tool view panicked: boom,call_search=search ok"
+	if got := strings.Join(toolMessages, ","); got != want {
+		t.Fatalf("unexpected tool messages:\n got=%s\nwant=%s", got, want)
+	}
+}
+
+func TestProcessStopsAtMaxStepsWithPartialResult(t *testing.T) {
+	t.Parallel()
+
+	calls := 0
+	svc := NewService(Dependencies{
+		Runner: adapters.AgentRunner{
+			GenerateTurnFunc: func(context.Context, domain.AgentProcessRequest, runner.GenerateConfig, []runner.ToolDefinition) (runner.TurnResult, error) {
+				calls++
+				return runner.TurnResult{
+					Text: fmt.Sprintf("looking %d", calls),
+					ToolCalls: []runner.ToolCall{{
+						ID:        fmt.Sprintf("call_%d", calls),
+						Name:      "view",
+						Arguments: map[string]interface{}{"path": "/tmp/a.txt"},
+					}},
+				}, nil
+			},
+		},
+		ToolRuntime: adapters.AgentToolRuntime{
+			ListToolDefinitionsFunc: func(string) []runner.ToolDefinition { return nil },
+			ExecuteToolCallFunc: func(context.Context, string, string, map[string]interface{}) (string, error) {
+				return "tool-ok", nil
+			},
+		},
+		ErrorMapper: adapters.AgentErrorMapper{
+			MapToolErrorFunc:   func(err error) (int, string, string) { return http.StatusBadRequest, "tool_error", err.Error() },
+			MapRunnerErrorFunc: func(err error) (int, string, string) { return http.StatusBadGateway, "runner_error", err.Error() },
+		},
+	})
+
+	result, processErr := svc.Process(context.Background(), ProcessParams{
+		Request:        domain.AgentProcessRequest{Input: []domain.AgentInputMessage{{Role: "user", Type: "message"}}},
+		EffectiveInput: []domain.AgentInputMessage{{Role: "user", Type: "message", Content: []domain.RuntimeContent{{Type: "text", Text: "hi"}}}},
+		MaxSteps:       3,
+	}, nil)
+	if processErr == nil || processErr.Code != ErrorCodeMaxStepsExceeded || processErr.Status != 422 {
+		t.Fatalf("expected max_steps_exceeded, got=%+v", processErr)
+	}
+	if calls != 3 {
+		t.Fatalf("expected 3 provider turns, got=%d", calls)
+	}
+	if result.Reply != "looking 1\n\nlooking 2\n\nlooking 3" {
+		t.Fatalf("unexpected partial reply: %q", result.Reply)
+	}
+	toolResults := 0
+	for _, evt := range result.Events {
+		if evt.Type == "tool_result" {
+			toolResults++
+		}
+	}
+	if toolResults != 3 {
+		t.Fatalf("expected partial events to include 3 tool results, got=%d", toolResults)
+	}
+	if result.StopReason != domain.StopReasonMaxSteps {
+		t.Fatalf("expected max_steps stop reason, got=%q", result.StopReason)
+	}
+	details, _ := processErr.Details.(map[string]interface{})
+	if details["stop_reason"] != domain.StopReasonMaxSteps {
+		t.Fatalf("expected max_steps stop reason in error details, got=%#v", processErr.Details)
+	}
+}
+
+func TestProcessStopsAtRecoveryLimitForMalformedToolCalls(t *testing.T) {
+	t.Parallel()
+
+	calls := 0
+	svc := NewService(Dependencies{
+		Runner: adapters.AgentRunner{
+			GenerateTurnFunc: func(context.Context, domain.AgentProcessRequest, runner.GenerateConfig, []runner.ToolDefinition) (runner.TurnResult, error) {
+				calls++
+				if calls == 1 {
+					return runner.TurnResult{
+						Text:      "let me check",
+						ToolCalls: []runner.ToolCall{{ID: "call_ok", Name: "view", Arguments: map[string]interface{}{"path": "/tmp/a.txt"}}},
+					}, nil
+				}
+				return runner.TurnResult{}, errors.New("malformed tool arguments")
+			},
+		},
+		ToolRuntime: adapters.AgentToolRuntime{
+			ListToolDefinitionsFunc: func(string) []runner.ToolDefinition { return nil },
+			ExecuteToolCallFunc: func(context.Context, string, string, map[string]interface{}) (string, error) {
+				return "tool-ok", nil
+			},
+			RecoverInvalidProviderToolCallFunc: func(_ error, step int) (ports.RecoverableProviderToolCall, bool) {
+				return ports.RecoverableProviderToolCall{
+					ID:           fmt.Sprintf("call_bad_%d", step),
+					Name:         "view",
+					RawArguments: "{not json",
+					Feedback:     "invalid arguments, retry with valid JSON",
+				}, true
+			},
+		},
+		ErrorMapper: adapters.AgentErrorMapper{
+			MapToolErrorFunc:   func(err error) (int, string, string) { return http.StatusBadRequest, "tool_error", err.Error() },
+			MapRunnerErrorFunc: func(err error) (int, string, string) { return http.StatusBadGateway, "runner_error", err.Error() },
+		},
+	})
+
+	result, processErr := svc.Process(context.Background(), ProcessParams{
+		Request:          domain.AgentProcessRequest{Input: []domain.AgentInputMessage{{Role: "user", Type: "message"}}},
+		EffectiveInput:   []domain.AgentInputMessage{{Role: "user", Type: "message", Content: []domain.RuntimeContent{{Type: "text", Text: "hi"}}}},
+		MaxSteps:         10,
+		MaxRecoverySteps: 3,
+	}, nil)
+	if processErr != nil {
+		t.Fatalf("expected the run to stop cleanly, got=%+v", processErr)
+	}
+	// One good step, then three malformed ones before the cap stops the loop.
+	if calls != 4 {
+		t.Fatalf("expected 4 provider turns, got=%d", calls)
+	}
+	if result.StopReason != domain.StopReasonRecoveryLimit {
+		t.Fatalf("expected recovery_limit_reached, got=%q", result.StopReason)
+	}
+	if result.Reply != "let me check" {
+		t.Fatalf("expected the last assistant text, got=%q", result.Reply)
+	}
+	last := result.Events[len(result.Events)-1]
+	if last.Type != "completed" || last.StopReason != domain.StopReasonRecoveryLimit {
+		t.Fatalf("expected completed event with recovery stop reason, got=%+v", last)
+	}
+}
+
+func TestProcessReportsLengthStopReasonWhenProviderTruncates(t *testing.T) {
+	t.Parallel()
+
+	svc := NewService(Dependencies{
+		Runner: adapters.AgentRunner{
+			GenerateTurnFunc: func(context.Context, domain.AgentProcessRequest, runner.GenerateConfig, []runner.ToolDefinition) (runner.TurnResult, error) {
+				return runner.TurnResult{Text: "cut of", Truncated: true}, nil
+			},
+		},
+		ToolRuntime: adapters.AgentToolRuntime{
+			ListToolDefinitionsFunc: func(string) []runner.ToolDefinition { return nil },
+		},
+		ErrorMapper: adapters.AgentErrorMapper{
+			MapToolErrorFunc:   func(err error) (int, string, string) { return http.StatusBadRequest, "tool_error", err.Error() },
+			MapRunnerErrorFunc: func(err error) (int, string, string) { return http.StatusBadGateway, "runner_error", err.Error() },
+		},
+	})
+
+	result, processErr := svc.Process(context.Background(), ProcessParams{
+		Request:        domain.AgentProcessRequest{Input: []domain.AgentInputMessage{{Role: "user", Type: "message"}}},
+		EffectiveInput: []domain.AgentInputMessage{{Role: "user", Type: "message", Content: []domain.RuntimeContent{{Type: "text", Text: "hi"}}}},
+	}, nil)
+	if processErr != nil {
+		t.Fatalf("unexpected error: %+v", processErr)
+	}
+	if result.StopReason != domain.StopReasonLength {
+		t.Fatalf("expected length stop reason, got=%q", result.StopReason)
+	}
+	completed := result.Events[len(result.Events)-1]
+	if completed.Type != "completed" || completed.StopReason != domain.StopReasonLength {
+		t.Fatalf("expected completed event with length stop reason, got=%+v", completed)
+	}
+}
+
+func TestProcessEmitsUsageEventsAndTotals(t *testing.T) {
+	t.Parallel()
+
+	calls := 0
+	svc := NewService(Dependencies{
+		Runner: adapters.AgentRunner{
+			GenerateTurnFunc: func(context.Context, domain.AgentProcessRequest, runner.GenerateConfig, []runner.ToolDefinition) (runner.TurnResult, error) {
+				calls++
+				if calls == 1 {
+					return runner.TurnResult{
+						ToolCalls: []runner.ToolCall{{
+							ID:        "call_1",
+							Name:      "view",
+							Arguments: map[string]interface{}{"path": "/tmp/a.txt"},
+						}},
+						Usage: &runner.TurnUsage{PromptTokens: 100, CompletionTokens: 10},
+					}, nil
+				}
+				return runner.TurnResult{
+					Text:  "done",
+					Usage: &runner.TurnUsage{PromptTokens: 150, CompletionTokens: 20},
+				}, nil
+			},
+		},
+		ToolRuntime: adapters.AgentToolRuntime{
+			ListToolDefinitionsFunc: func(string) []runner.ToolDefinition { return nil },
+			ExecuteToolCallFunc: func(context.Context, string, string, map[string]interface{}) (string, error) {
+				return "tool-ok", nil
+			},
+		},
+		ErrorMapper: adapters.AgentErrorMapper{
+			MapToolErrorFunc:   func(err error) (int, string, string) { return http.StatusBadRequest, "tool_error", err.Error() },
+			MapRunnerErrorFunc: func(err error) (int, string, string) { return http.StatusBadGateway, "runner_error", err.Error() },
+		},
+	})
+
+	result, processErr := svc.Process(context.Background(), ProcessParams{
+		Request:        domain.AgentProcessRequest{Input: []domain.AgentInputMessage{{Role: "user", Type: "message"}}},
+		EffectiveInput: []domain.AgentInputMessage{{Role: "user", Type: "message", Content: []domain.RuntimeContent{{Type: "text", Text: "hi"}}}},
+	}, nil)
+	if processErr != nil {
+		t.Fatalf("unexpected process error: %+v", processErr)
+	}
+	usageEvents := []domain.AgentEvent{}
+	for _, evt := range result.Events {
+		if evt.Type == "usage" {
+			usageEvents = append(usageEvents, evt)
+		}
+	}
+	if len(usageEvents) != 2 {
+		t.Fatalf("expected one usage event per step, got=%d", len(usageEvents))
+	}
+	if usageEvents[0].Step != 1 || usageEvents[0].Usage.TotalTokens != 110 {
+		t.Fatalf("unexpected first usage event: %#v", usageEvents[0])
+	}
+	last := result.Events[len(result.Events)-1]
+	if last.Type != "usage" || result.Events[len(result.Events)-2].Type != "completed" {
+		t.Fatalf("expected usage event right after completed, got=%#v", last)
+	}
+	want := domain.AgentUsage{PromptTokens: 250, CompletionTokens: 30, TotalTokens: 280}
+	if result.Usage == nil || *result.Usage != want {
+		t.Fatalf("unexpected aggregate usage: %#v", result.Usage)
+	}
+}
+
+func TestProcessDryRunReturnsToolCallsWithoutExecuting(t *testing.T) {
+	t.Parallel()
+
+	calls := 0
+	svc := NewService(Dependencies{
+		Runner: adapters.AgentRunner{
+			GenerateTurnFunc: func(context.Context, domain.AgentProcessRequest, runner.GenerateConfig, []runner.ToolDefinition) (runner.TurnResult, error) {
+				calls++
+				return runner.TurnResult{
+					Text: "checking",
+					ToolCalls: []runner.ToolCall{
+						{ID: "call_1", Name: "view", Arguments: map[string]interface{}{"path": "/tmp/a.txt"}},
+						{ID: "call_2", Name: "shell", Arguments: map[string]interface{}{"command": "ls"}},
+					},
+				}, nil
+			},
+		},
+		ToolRuntime: adapters.AgentToolRuntime{
+			ListToolDefinitionsFunc: func(string) []runner.ToolDefinition { return nil },
+			ExecuteToolCallFunc: func(_ context.Context, _ string, name string, _ map[string]interface{}) (string, error) {
+				t.Fatalf("dry run must not execute tool %q", name)
+				return "", nil
+			},
+		},
+		ErrorMapper: adapters.AgentErrorMapper{
+			MapToolErrorFunc:   func(err error) (int, string, string) { return http.StatusBadRequest, "tool_error", err.Error() },
+			MapRunnerErrorFunc: func(err error) (int, string, string) { return http.StatusBadGateway, "runner_error", err.Error() },
+		},
+	})
+
+	result, processErr := svc.Process(context.Background(), ProcessParams{
+		Request:        domain.AgentProcessRequest{Input: []domain.AgentInputMessage{{Role: "user", Type: "message"}}},
+		EffectiveInput: []domain.AgentInputMessage{{Role: "user", Type: "message", Content: []domain.RuntimeContent{{Type: "text", Text: "hi"}}}},
+		DryRun:         true,
+	}, nil)
+	if processErr != nil {
+		t.Fatalf("unexpected process error: %+v", processErr)
+	}
+	if calls != 1 {
+		t.Fatalf("expected a single provider turn, got=%d", calls)
+	}
+	toolCalls := []domain.AgentEvent{}
+	for _, evt := range result.Events {
+		if evt.Type == "tool_result" {
+			t.Fatalf("dry run must not produce tool results: %#v", evt)
+		}
+		if evt.Type == "tool_call" {
+			toolCalls = append(toolCalls, evt)
+		}
+	}
+	if len(toolCalls) != 2 || toolCalls[0].ToolCall.Name != "view" || toolCalls[1].ToolCall.Name != "shell" {
+		t.Fatalf("unexpected tool_call events: %#v", toolCalls)
+	}
+	if toolCalls[1].Meta["dry_run"] != true || toolCalls[1].ToolCall.Input["command"] != "ls" {
+		t.Fatalf("expected dry_run meta and arguments on tool_call: %#v", toolCalls[1])
+	}
+	if result.Reply != "checking" {
+		t.Fatalf("unexpected reply: %q", result.Reply)
+	}
+}
+
 func TestProcessRunnerErrorMapped(t *testing.T) {
 	t.Parallel()
 
@@ -232,6 +687,73 @@ func TestProcessRunnerErrorMappedIncludesDetails(t *testing.T) {
 	}
 }
 
+func TestProcessSwitchesToFallbackProviderOnRequestFailure(t *testing.T) {
+	t.Parallel()
+
+	calls := []string{}
+	svc := NewService(Dependencies{
+		Runner: adapters.AgentRunner{
+			GenerateTurnFunc: func(_ context.Context, _ domain.AgentProcessRequest, cfg runner.GenerateConfig, _ []runner.ToolDefinition) (runner.TurnResult, error) {
+				calls = append(calls, cfg.ProviderID)
+				if cfg.ProviderID == "openai" || cfg.ProviderID == "cohere" {
+					return runner.TurnResult{}, &runner.RunnerError{Code: runner.ErrorCodeProviderRequestFailed, Message: "provider request failed"}
+				}
+				return runner.TurnResult{Text: "from fallback"}, nil
+			},
+			GenerateTurnStreamFunc: func(context.Context, domain.AgentProcessRequest, runner.GenerateConfig, []runner.ToolDefinition, func(string)) (runner.TurnResult, error) {
+				t.Fatalf("GenerateTurnStream should not be called")
+				return runner.TurnResult{}, nil
+			},
+		},
+		ToolRuntime: adapters.AgentToolRuntime{
+			ListToolDefinitionsFunc: func(string) []runner.ToolDefinition { return nil },
+		},
+		ErrorMapper: adapters.AgentErrorMapper{
+			MapRunnerErrorFunc: func(err error) (int, string, string) {
+				return http.StatusBadGateway, runner.ErrorCodeProviderRequestFailed, err.Error()
+			},
+		},
+	})
+
+	result, processErr := svc.Process(context.Background(), ProcessParams{
+		EffectiveInput: []domain.AgentInputMessage{{Role: "user", Type: "message"}},
+		GenerateConfig: runner.GenerateConfig{ProviderID: "openai", Model: "gpt-4o-mini"},
+		FallbackConfigs: []runner.GenerateConfig{
+			{ProviderID: "cohere", Model: "command-a-03-2025"},
+			{ProviderID: "anthropic", Model: "claude-3-5-haiku-latest"},
+		},
+	}, nil)
+	if processErr != nil {
+		t.Fatalf("unexpected process error: %+v", processErr)
+	}
+	if result.Reply != "from fallback" {
+		t.Fatalf("unexpected reply: %q", result.Reply)
+	}
+	if strings.Join(calls, ",") != "openai,cohere,anthropic" {
+		t.Fatalf("unexpected provider call order: %v", calls)
+	}
+	switches := []string{}
+	for _, evt := range result.Events {
+		if evt.Type == EventTypeProviderFallback {
+			switches = append(switches, fmt.Sprintf("%v->%v", evt.Meta["from_provider_id"], evt.Meta["to_provider_id"]))
+		}
+	}
+	if strings.Join(switches, ",") != "openai->cohere,cohere->anthropic" {
+		t.Fatalf("unexpected fallback events: %v", switches)
+	}
+
+	// Without fallbacks the failure surfaces after a single attempt.
+	calls = calls[:0]
+	_, processErr = svc.Process(context.Background(), ProcessParams{
+		EffectiveInput:  []domain.AgentInputMessage{{Role: "user", Type: "message"}},
+		GenerateConfig:  runner.GenerateConfig{ProviderID: "cohere"},
+		FallbackConfigs: nil,
+	}, nil)
+	if processErr == nil || len(calls) != 1 {
+		t.Fatalf("expected error without fallbacks, err=%+v calls=%v", processErr, calls)
+	}
+}
+
 func TestProcessCodexModeNormalizesLegacyProviderViewObject(t *testing.T) {
 	t.Parallel()
 
@@ -0,0 +1,124 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"nextai/apps/gateway/internal/domain"
+)
+
+const (
+	EventTypeToolApprovalRequired = "tool_approval_required"
+	EventTypeToolApprovalResolved = "tool_approval_resolved"
+)
+
+// ToolApprovalDecision answers one paused tool call.
+type ToolApprovalDecision struct {
+	Approved bool
+	Reason   string
+	// TimedOut marks the rejection await makes up when Timeout passes
+	// without an answer.
+	TimedOut bool
+}
+
+// ToolApproval pauses the provider loop before the listed tools run until the
+// caller decides on each call.
+type ToolApproval struct {
+	// Tools holds lowercased tool names; both the provider's name and the
+	// normalized executor name are matched.
+	Tools map[string]struct{}
+	// Meta is merged into every tool_approval_required event, e.g. the run_id
+	// clients answer through.
+	Meta map[string]interface{}
+	// Register is called before the approval event is emitted, so a decision
+	// sent as soon as the event is seen is not lost. release drops the pending
+	// entry once the wait ends.
+	Register func(approvalID string) (decisions <-chan ToolApprovalDecision, release func())
+	// Timeout bounds each wait; zero waits until the run ends.
+	Timeout time.Duration
+	// PauseDeadline, when set, stops the turn's own deadline for the wait.
+	// The returned func starts it again.
+	PauseDeadline func() (resume func())
+}
+
+func (a *ToolApproval) requires(names ...string) bool {
+	if a == nil || a.Register == nil || len(a.Tools) == 0 {
+		return false
+	}
+	for _, name := range names {
+		if _, ok := a.Tools[strings.ToLower(strings.TrimSpace(name))]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// await emits the approval event and blocks until the call is approved or
+// rejected. A wait that outlasts Timeout counts as a rejection, so the model
+// hears about it like any other denial. It returns ctx's error when the run
+// ends first. Every way out emits tool_approval_resolved.
+func (a *ToolApproval) await(ctx context.Context, step int, approvalID string, call domain.AgentToolCallPayload, appendEvent func(domain.AgentEvent)) (ToolApprovalDecision, error) {
+	decisions, release := a.Register(approvalID)
+	defer release()
+	if a.PauseDeadline != nil {
+		defer a.PauseDeadline()()
+	}
+	var expired <-chan time.Time
+	if a.Timeout > 0 {
+		timer := time.NewTimer(a.Timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	meta := map[string]interface{}{}
+	for key, value := range a.Meta {
+		meta[key] = value
+	}
+	meta["approval_id"] = approvalID
+	payload := call
+	appendEvent(domain.AgentEvent{
+		Type:     EventTypeToolApprovalRequired,
+		Step:     step,
+		ToolCall: &payload,
+		Meta:     meta,
+	})
+	resolve := func(decision ToolApprovalDecision) {
+		resolved := map[string]interface{}{"approval_id": approvalID, "approved": decision.Approved}
+		if decision.Reason != "" {
+			resolved["reason"] = decision.Reason
+		}
+		appendEvent(domain.AgentEvent{Type: EventTypeToolApprovalResolved, Step: step, Meta: resolved})
+	}
+	select {
+	case decision := <-decisions:
+		resolve(decision)
+		return decision, nil
+	case <-ctx.Done():
+		resolve(ToolApprovalDecision{Reason: "cancelled"})
+		return ToolApprovalDecision{}, ctx.Err()
+	case <-expired:
+		decision := ToolApprovalDecision{Reason: "timeout", TimedOut: true}
+		resolve(decision)
+		return decision, nil
+	}
+}
+
+// toolApprovalID names the pause after the provider's call ID when it has one.
+func toolApprovalID(callID string, step, index int) string {
+	if callID = strings.TrimSpace(callID); callID != "" {
+		return callID
+	}
+	return fmt.Sprintf("approval_%d_%d", step, index)
+}
+
+// toolRejectionFeedback is the tool message the model sees for a rejected call.
+func toolRejectionFeedback(decision ToolApprovalDecision) string {
+	if decision.TimedOut {
+		return "tool call was not approved before the approval timeout"
+	}
+	if reason := strings.TrimSpace(decision.Reason); reason != "" {
+		return "tool call was rejected by the user: " + reason
+	}
+	return "tool call was rejected by the user"
+}
@@ -0,0 +1,140 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"nextai/apps/gateway/internal/domain"
+	"nextai/apps/gateway/internal/runner"
+)
+
+// maxConcurrentToolCalls bounds how many read-only calls of one step run at once.
+const maxConcurrentToolCalls = 4
+
+// concurrentSafeTools only read files or the web, so calls to them in one step
+// cannot observe each other. Tools that mutate state or drive a shared session
+// (edit, write, shell, browser) always run one at a time, in order.
+var concurrentSafeTools = map[string]struct{}{
+	"view":     {},
+	"find":     {},
+	"list_dir": {},
+	"search":   {},
+}
+
+// preparedToolCall is a provider tool call resolved to the executor's name and
+// input, plus the name and input reported in events.
+type preparedToolCall struct {
+	id         string
+	rawName    string
+	execName   string
+	execInput  map[string]interface{}
+	eventName  string
+	eventInput map[string]interface{}
+}
+
+type toolCallOutcome struct {
+	reply      string
+	err        error
+	durationMS int64
+	screenshot *domain.AgentToolScreenshot
+}
+
+func prepareToolCall(call runner.ToolCall, params ProcessParams) preparedToolCall {
+	rawName := strings.TrimSpace(call.Name)
+	execName := normalizeProviderToolName(rawName)
+	if execName == "" {
+		execName = strings.ToLower(rawName)
+	}
+	execInput := normalizeProviderToolInput(execName, strings.TrimSpace(params.PromptMode), safeMap(call.Arguments))
+	execInput = enrichNativeToolInput(execName, execInput, params.Request, params.PromptMode, params.CollaborationMode, call.ID)
+	eventName := rawName
+	if eventName == "" {
+		eventName = execName
+	}
+	return preparedToolCall{
+		id:         call.ID,
+		rawName:    rawName,
+		execName:   execName,
+		execInput:  execInput,
+		eventName:  eventName,
+		eventInput: normalizeToolCallEventInput(execName, safeMap(call.Arguments), execInput),
+	}
+}
+
+func (c preparedToolCall) callEvent(step int) domain.AgentEvent {
+	return domain.AgentEvent{
+		Type: "tool_call",
+		Step: step,
+		ToolCall: &domain.AgentToolCallPayload{
+			Name:  c.eventName,
+			Input: c.eventInput,
+		},
+	}
+}
+
+// message is the tool message that hands reply back to the model.
+func (c preparedToolCall) message(reply string) domain.AgentInputMessage {
+	return domain.AgentInputMessage{
+		Role:    "tool",
+		Type:    "message",
+		Content: []domain.RuntimeContent{{Type: "text", Text: reply}},
+		Metadata: map[string]interface{}{
+			"tool_call_id": c.id,
+			"name":         c.eventName,
+		},
+	}
+}
+
+// concurrentToolCallRun returns how many leading calls may run together: a
+// run of read-only calls that do not wait for approval. It is at least 1.
+func concurrentToolCallRun(calls []preparedToolCall, approval *ToolApproval) int {
+	n := 0
+	for _, call := range calls {
+		if _, ok := concurrentSafeTools[call.execName]; !ok || approval.requires(call.rawName, call.execName) {
+			break
+		}
+		n++
+	}
+	return max(n, 1)
+}
+
+func (s *Service) executeToolCall(ctx context.Context, promptMode string, call preparedToolCall) toolCallOutcome {
+	startedAt := time.Now()
+	toolCtx, screenshot := withToolScreenshotSlot(ctx)
+	reply, err := s.deps.ToolRuntime.ExecuteToolCall(toolCtx, promptMode, call.execName, call.execInput)
+	return toolCallOutcome{
+		reply:      reply,
+		err:        err,
+		durationMS: time.Since(startedAt).Milliseconds(),
+		screenshot: screenshot.screenshot(),
+	}
+}
+
+// executeToolCallsConcurrently runs calls with at most maxConcurrentToolCalls
+// in flight and returns their outcomes in call order. A call that panics
+// becomes a tool error instead of taking down the gateway, since the panic
+// happens off the request goroutine where no handler would recover it.
+func (s *Service) executeToolCallsConcurrently(ctx context.Context, promptMode string, calls []preparedToolCall) []toolCallOutcome {
+	outcomes := make([]toolCallOutcome, len(calls))
+	slots := make(chan struct{}, maxConcurrentToolCalls)
+	var wg sync.WaitGroup
+	for index, call := range calls {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(index int, call preparedToolCall) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			defer func() {
+				if recovered := recover(); recovered != nil {
+					outcomes[index] = toolCallOutcome{err: fmt.Errorf("tool %s panicked: %v", call.execName, recovered)}
+				}
+			}()
+			outcomes[index] = s.executeToolCall(ctx, promptMode, call)
+		}(index, call)
+	}
+	wg.Wait()
+	return outcomes
+}
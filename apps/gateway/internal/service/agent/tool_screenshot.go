@@ -0,0 +1,47 @@
+package agent
+
+import (
+	"context"
+	"sync"
+
+	"nextai/apps/gateway/internal/domain"
+)
+
+type toolScreenshotContextKey struct{}
+
+// toolScreenshotSlot receives the screenshot a tool runtime reports for the
+// single tool call executing under its context.
+type toolScreenshotSlot struct {
+	mu   sync.Mutex
+	shot *domain.AgentToolScreenshot
+}
+
+func withToolScreenshotSlot(ctx context.Context) (context.Context, *toolScreenshotSlot) {
+	slot := &toolScreenshotSlot{}
+	return context.WithValue(ctx, toolScreenshotContextKey{}, slot), slot
+}
+
+// RecordToolScreenshot attaches a screenshot to the tool_result event of the
+// tool call running under ctx. Later calls replace earlier ones; outside a
+// tool call it does nothing.
+func RecordToolScreenshot(ctx context.Context, shot domain.AgentToolScreenshot) {
+	if ctx == nil || (shot.Path == "" && shot.Base64 == "") {
+		return
+	}
+	slot, ok := ctx.Value(toolScreenshotContextKey{}).(*toolScreenshotSlot)
+	if !ok || slot == nil {
+		return
+	}
+	slot.mu.Lock()
+	defer slot.mu.Unlock()
+	slot.shot = &shot
+}
+
+func (s *toolScreenshotSlot) screenshot() *domain.AgentToolScreenshot {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.shot
+}
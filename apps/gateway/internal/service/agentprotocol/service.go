@@ -198,17 +198,33 @@ func ParseQQInboundEvent(body []byte) (QQInboundEvent, error) {
 	return event, nil
 }
 
+// channelDispatchStep derives dispatch config for one request from the channel
+// config and the biz_params.channel object, returning nil when it has nothing
+// to change.
+type channelDispatchStep func(channelName string, cfg map[string]interface{}, body map[string]interface{}) map[string]interface{}
+
+// channelDispatchPipeline runs in order; each step sees the previous output.
+var channelDispatchPipeline = []channelDispatchStep{
+	mergeQQDispatchTarget,
+	applyDispatchFieldMappings,
+}
+
+// MergeChannelDispatchConfig builds the config handed to the channel plugin by
+// running channelDispatchPipeline. cfg itself is never modified.
 func MergeChannelDispatchConfig(channelName string, cfg map[string]interface{}, bizParams map[string]interface{}) map[string]interface{} {
-	if channelName != "qq" || len(bizParams) == 0 {
-		return cfg
-	}
-	raw, ok := bizParams["channel"]
-	if !ok || raw == nil {
-		return cfg
+	body, _ := bizParams["channel"].(map[string]interface{})
+	out := cfg
+	for _, step := range channelDispatchPipeline {
+		if next := step(channelName, out, body); next != nil {
+			out = next
+		}
 	}
-	body, ok := raw.(map[string]interface{})
-	if !ok {
-		return cfg
+	return out
+}
+
+func mergeQQDispatchTarget(channelName string, cfg map[string]interface{}, body map[string]interface{}) map[string]interface{} {
+	if channelName != "qq" || len(body) == 0 {
+		return nil
 	}
 	merged := cloneChannelConfig(cfg)
 	updated := false
@@ -230,7 +246,38 @@ func MergeChannelDispatchConfig(channelName string, cfg map[string]interface{},
 		updated = true
 	}
 	if !updated {
-		return cfg
+		return nil
+	}
+	return merged
+}
+
+// applyDispatchFieldMappings copies biz_params.channel values into the
+// dispatch config as declared by transform.fields, which maps a config key to
+// the biz_params.channel key it is read from. Empty values are skipped.
+func applyDispatchFieldMappings(_ string, cfg map[string]interface{}, body map[string]interface{}) map[string]interface{} {
+	if len(body) == 0 {
+		return nil
+	}
+	transform, _ := cfg["transform"].(map[string]interface{})
+	fields, _ := transform["fields"].(map[string]interface{})
+	var merged map[string]interface{}
+	for target, rawSource := range fields {
+		target = strings.TrimSpace(target)
+		source := strings.TrimSpace(qqString(rawSource))
+		if target == "" || source == "" {
+			continue
+		}
+		value, ok := body[source]
+		if !ok || value == nil {
+			continue
+		}
+		if text, isText := value.(string); isText && strings.TrimSpace(text) == "" {
+			continue
+		}
+		if merged == nil {
+			merged = cloneChannelConfig(cfg)
+		}
+		merged[target] = value
 	}
 	return merged
 }
@@ -445,6 +492,10 @@ func NormalizeToolName(name string) string {
 		return "view"
 	case "edit_file_lines", "edit_file_lins", "edit_file":
 		return "edit"
+	case "write_file", "create_file":
+		return "write"
+	case "list_directory", "list_files", "ls":
+		return "list_dir"
 	case "exec_command", "functions.exec_command":
 		return "shell"
 	case "write_stdin", "functions.write_stdin":
@@ -584,9 +635,9 @@ func ListToolDefinitionNames(
 		case ToolCapabilityExecute:
 			return name == "shell"
 		case ToolCapabilityRead:
-			return name == "view" || name == "find"
+			return name == "view" || name == "find" || name == "list_dir"
 		case ToolCapabilityWrite:
-			return name == "edit"
+			return name == "edit" || name == "write"
 		case ToolCapabilityNetwork:
 			return name == "search" || name == "browser"
 		case ToolCapabilityOpenLocal:
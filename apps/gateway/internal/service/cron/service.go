@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"log"
 	"os"
 	"path/filepath"
@@ -31,6 +32,7 @@ const (
 
 	taskTypeText     = "text"
 	taskTypeWorkflow = "workflow"
+	taskTypeTool     = "tool"
 
 	workflowVersionV1 = "v1"
 	workflowNodeStart = "start"
@@ -42,10 +44,21 @@ const (
 
 	cronLeaseDirName = "cron-leases"
 	qqChannelName    = "qq"
+
+	catchUpSkip     = "skip"
+	catchUpFireOnce = "fire_once"
+
+	// runHistoryLimit caps CronJobState.Runs so the state file stays bounded.
+	runHistoryLimit = 20
+	// previewRunCount is how many upcoming runs PreviewSchedule returns.
+	previewRunCount = 5
+
+	overviewDueSoonWindow = 5 * time.Minute
 )
 
 var ErrJobNotFound = errors.New("cron_job_not_found")
 var ErrMaxConcurrencyReached = errors.New("cron_max_concurrency_reached")
+var ErrGlobalConcurrencyReached = errors.New("cron_global_concurrency_reached")
 var ErrDefaultProtected = errors.New("cron_default_protected")
 
 var workflowIfConditionPattern = regexp.MustCompile(`^\s*([A-Za-z_][A-Za-z0-9_]*)\s*(==|!=)\s*(?:"([^"]*)"|'([^']*)'|(\S+))\s*$`)
@@ -71,6 +84,18 @@ func (e *ValidationError) Error() string {
 	return e.Message
 }
 
+// DuplicateJobIDError rejects a batch that lists the same job ID twice.
+type DuplicateJobIDError struct {
+	ID string
+}
+
+func (e *DuplicateJobIDError) Error() string {
+	if e == nil {
+		return ""
+	}
+	return fmt.Sprintf("job id %q appears more than once in the batch", e.ID)
+}
+
 type channelError struct {
 	Message string
 	Err     error
@@ -102,8 +127,20 @@ type Dependencies struct {
 	Store                   ports.StateStore
 	DataDir                 string
 	ChannelResolver         ports.ChannelResolver
-	ExecuteConsoleAgentTask func(ctx context.Context, job domain.CronJobSpec, text string) error
-	ExecuteTask             TaskExecutor
+	ExecuteConsoleAgentTask func(ctx context.Context, job domain.CronJobSpec, text string) (string, error)
+	// DispatchText delivers text to a non-console channel through the same
+	// pipeline as agent replies (transform rules, chunking, retries).
+	DispatchText func(ctx context.Context, channelName string, userID string, sessionID string, text string) error
+	// ExecuteToolTask runs job.Tool and records the result in the dispatch
+	// target's console chat; it returns the rendered tool output.
+	ExecuteToolTask func(ctx context.Context, job domain.CronJobSpec) (string, error)
+	// ToolDisabled reports whether a tool is disabled by server config, so
+	// tool jobs can be rejected when saved.
+	ToolDisabled func(name string) bool
+	// LeaseTTL overrides the execution lease lifetime; zero keeps the job
+	// timeout plus 30s. It never drops below the job timeout.
+	LeaseTTL    time.Duration
+	ExecuteTask TaskExecutor
 }
 
 type Service struct {
@@ -139,8 +176,8 @@ func (s *Service) CreateJob(job domain.CronJobSpec) (domain.CronJobSpec, error)
 	if err := s.validateStore(); err != nil {
 		return domain.CronJobSpec{}, err
 	}
-	if code, err := s.validateJobSpec(&job); err != nil {
-		return domain.CronJobSpec{}, &ValidationError{Code: code, Message: err.Error()}
+	if err := s.prepareJob(&job); err != nil {
+		return domain.CronJobSpec{}, err
 	}
 
 	now := time.Now().UTC()
@@ -155,6 +192,95 @@ func (s *Service) CreateJob(job domain.CronJobSpec) (domain.CronJobSpec, error)
 	return job, nil
 }
 
+// CreateJobs validates every spec with the CreateJob rules and persists the
+// valid ones in a single write. Invalid entries are reported per index without
+// failing the batch; an ID listed twice fails the whole batch with
+// *DuplicateJobIDError, since which entry should win is ambiguous.
+func (s *Service) CreateJobs(jobs []domain.CronJobSpec) (domain.CronBatchCreateResult, error) {
+	if err := s.validateStore(); err != nil {
+		return domain.CronBatchCreateResult{}, err
+	}
+	seen := map[string]struct{}{}
+	for _, job := range jobs {
+		id := strings.TrimSpace(job.ID)
+		if id == "" {
+			continue
+		}
+		if _, dup := seen[id]; dup {
+			return domain.CronBatchCreateResult{}, &DuplicateJobIDError{ID: id}
+		}
+		seen[id] = struct{}{}
+	}
+
+	out := domain.CronBatchCreateResult{Results: make([]domain.CronBatchCreateItem, 0, len(jobs))}
+	valid := make([]domain.CronJobSpec, 0, len(jobs))
+	for idx := range jobs {
+		job := jobs[idx]
+		item := domain.CronBatchCreateItem{Index: idx, ID: strings.TrimSpace(job.ID)}
+		if err := s.prepareJob(&job); err != nil {
+			code := "invalid_cron_task_type"
+			if validation := (*ValidationError)(nil); errors.As(err, &validation) {
+				code = validation.Code
+			}
+			item.Error = &domain.APIError{Code: code, Message: err.Error()}
+			out.Failed++
+			out.Results = append(out.Results, item)
+			continue
+		}
+		created := job
+		item.Created = true
+		item.Job = &created
+		out.Created++
+		out.Results = append(out.Results, item)
+		valid = append(valid, job)
+	}
+	if len(valid) == 0 {
+		return out, nil
+	}
+
+	now := time.Now().UTC()
+	if err := s.deps.Store.WriteCron(func(state *ports.CronAggregate) error {
+		for _, job := range valid {
+			state.Jobs[job.ID] = job
+			existing := state.States[job.ID]
+			state.States[job.ID] = alignStateForMutation(job, normalizePausedState(existing), now)
+		}
+		return nil
+	}); err != nil {
+		return domain.CronBatchCreateResult{}, err
+	}
+	return out, nil
+}
+
+// ValidateJob runs the create-time checks without persisting and returns the
+// spec with defaults filled in. Every failing check is reported, not just the first.
+func (s *Service) ValidateJob(job domain.CronJobSpec) domain.CronJobValidation {
+	out := domain.CronJobValidation{Problems: []domain.APIError{}}
+	if code, err := s.validateJobSpec(&job); err != nil {
+		out.Problems = append(out.Problems, domain.APIError{Code: code, Message: err.Error()})
+	}
+	job.Schedule.Type = scheduleType(job)
+	job.Schedule.Cron = strings.TrimSpace(job.Schedule.Cron)
+	job.Schedule.Timezone = strings.TrimSpace(job.Schedule.Timezone)
+	if next, _, err := ResolveNextRunAt(job, nil, time.Now().UTC()); err != nil {
+		out.Problems = append(out.Problems, domain.APIError{Code: "invalid_cron_schedule", Message: err.Error()})
+	} else {
+		nextRunAt := next.Format(time.RFC3339)
+		out.NextRunAt = &nextRunAt
+	}
+	job.Dispatch.Channel = resolveDispatchChannel(job)
+	if code, err := validateJobDispatch(job); err != nil {
+		out.Problems = append(out.Problems, domain.APIError{Code: code, Message: err.Error()})
+	}
+	job.Runtime = runtimeSpec(job)
+	if job.Meta == nil {
+		job.Meta = map[string]interface{}{}
+	}
+	out.Job = job
+	out.Valid = len(out.Problems) == 0
+	return out
+}
+
 func (s *Service) GetJob(jobID string) (domain.CronJobView, error) {
 	if err := s.validateStore(); err != nil {
 		return domain.CronJobView{}, err
@@ -175,12 +301,76 @@ func (s *Service) GetJob(jobID string) (domain.CronJobView, error) {
 	return domain.CronJobView{Spec: spec, State: state}, nil
 }
 
+// SchedulableJob returns the schedule of jobID while the job exists, is
+// enabled and is not paused. The scheduler uses it to drop runs it deferred
+// once the job no longer qualifies.
+func (s *Service) SchedulableJob(jobID string) (domain.CronScheduleSpec, bool) {
+	if err := s.validateStore(); err != nil {
+		return domain.CronScheduleSpec{}, false
+	}
+	var schedule domain.CronScheduleSpec
+	schedulable := false
+	s.deps.Store.ReadCron(func(st ports.CronAggregate) {
+		job, ok := st.Jobs[jobID]
+		if !ok {
+			return
+		}
+		schedule = job.Schedule
+		schedulable = jobSchedulable(job, normalizePausedState(st.States[jobID]))
+	})
+	return schedule, schedulable
+}
+
+// Overview joins every job with its state in one read. Jobs are ordered by
+// next_run_at, soonest first, with unscheduled jobs last by name.
+func (s *Service) Overview(now time.Time) (domain.CronOverview, error) {
+	if err := s.validateStore(); err != nil {
+		return domain.CronOverview{}, err
+	}
+	leases, total, err := s.countActiveLeases(now)
+	if err != nil {
+		return domain.CronOverview{}, err
+	}
+
+	items := make([]domain.CronOverviewItem, 0)
+	nextRuns := map[string]time.Time{}
+	s.deps.Store.ReadCron(func(st ports.CronAggregate) {
+		for id, job := range st.Jobs {
+			state := st.States[id]
+			item := domain.CronOverviewItem{Spec: job, State: state, RunningLeases: leases[id]}
+			if state.NextRunAt != nil {
+				if next, err := time.Parse(time.RFC3339, *state.NextRunAt); err == nil {
+					nextRuns[id] = next
+					item.IsDueSoon = jobSchedulable(job, state) && !next.After(now.Add(overviewDueSoonWindow))
+				}
+			}
+			items = append(items, item)
+		}
+	})
+	sort.Slice(items, func(i, j int) bool {
+		a, aok := nextRuns[items[i].Spec.ID]
+		b, bok := nextRuns[items[j].Spec.ID]
+		if aok != bok {
+			return aok
+		}
+		if aok && !a.Equal(b) {
+			return a.Before(b)
+		}
+		return items[i].Spec.Name < items[j].Spec.Name
+	})
+	return domain.CronOverview{
+		Jobs:          items,
+		RunningLeases: total,
+		GeneratedAt:   now.UTC().Format(time.RFC3339),
+	}, nil
+}
+
 func (s *Service) UpdateJob(jobID string, job domain.CronJobSpec) (domain.CronJobSpec, error) {
 	if err := s.validateStore(); err != nil {
 		return domain.CronJobSpec{}, err
 	}
-	if code, err := s.validateJobSpec(&job); err != nil {
-		return domain.CronJobSpec{}, &ValidationError{Code: code, Message: err.Error()}
+	if err := s.prepareJob(&job); err != nil {
+		return domain.CronJobSpec{}, err
 	}
 
 	now := time.Now().UTC()
@@ -247,6 +437,38 @@ func (s *Service) UpdateStatus(jobID, status string) error {
 	})
 }
 
+// SetEnabled flips the persisted spec.enabled flag without touching the
+// runtime pause, then realigns next_run_at.
+func (s *Service) SetEnabled(jobID string, enabled bool) (domain.CronJobActivation, error) {
+	if err := s.validateStore(); err != nil {
+		return domain.CronJobActivation{}, err
+	}
+
+	now := time.Now().UTC()
+	var out domain.CronJobActivation
+	if err := s.deps.Store.WriteCron(func(st *ports.CronAggregate) error {
+		job, ok := st.Jobs[jobID]
+		if !ok {
+			return ErrJobNotFound
+		}
+		job.Enabled = enabled
+		st.Jobs[jobID] = job
+		state := alignStateForMutation(job, normalizePausedState(st.States[jobID]), now)
+		st.States[jobID] = state
+		out = domain.CronJobActivation{
+			JobID:     jobID,
+			Enabled:   job.Enabled,
+			Paused:    state.Paused,
+			Scheduled: jobSchedulable(job, state),
+			NextRunAt: state.NextRunAt,
+		}
+		return nil
+	}); err != nil {
+		return domain.CronJobActivation{}, err
+	}
+	return out, nil
+}
+
 func (s *Service) GetState(jobID string) (domain.CronJobState, error) {
 	if err := s.validateStore(); err != nil {
 		return domain.CronJobState{}, err
@@ -266,6 +488,53 @@ func (s *Service) GetState(jobID string) (domain.CronJobState, error) {
 	return state, nil
 }
 
+// PreviewSchedule computes the next run times of job's schedule after now
+// without saving anything. An unparseable schedule is an invalid_cron_schedule
+// ValidationError.
+func (s *Service) PreviewSchedule(job domain.CronJobSpec, now time.Time) (domain.CronSchedulePreview, error) {
+	if err := validateJobScheduleParses(job); err != nil {
+		return domain.CronSchedulePreview{}, err
+	}
+	loc := time.UTC
+	if tz := strings.TrimSpace(job.Schedule.Timezone); tz != "" {
+		nextLoc, err := time.LoadLocation(tz)
+		if err != nil {
+			return domain.CronSchedulePreview{}, &ValidationError{Code: "invalid_cron_schedule", Message: fmt.Sprintf("invalid schedule.timezone=%q", tz)}
+		}
+		loc = nextLoc
+	}
+
+	out := domain.CronSchedulePreview{Timezone: loc.String(), Runs: make([]domain.CronRunPreview, 0, previewRunCount)}
+	cursor := now.UTC()
+	var current *string
+	for i := 0; i < previewRunCount; i++ {
+		next, _, err := ResolveNextRunAt(job, current, cursor)
+		if err != nil {
+			return domain.CronSchedulePreview{}, &ValidationError{Code: "invalid_cron_schedule", Message: err.Error()}
+		}
+		out.Runs = append(out.Runs, domain.CronRunPreview{
+			UTC:   next.UTC().Format(time.RFC3339),
+			Local: next.In(loc).Format(time.RFC3339),
+		})
+		// Step from the previous run like the scheduler does, so interval
+		// jitter is applied once rather than per preview entry.
+		previous := next.UTC().Format(time.RFC3339)
+		current = &previous
+		cursor = next
+	}
+	return out, nil
+}
+
+// GetHistory returns the recorded runs of a job, oldest first.
+func (s *Service) GetHistory(jobID string) (domain.CronJobHistory, error) {
+	state, err := s.GetState(jobID)
+	if err != nil {
+		return domain.CronJobHistory{}, err
+	}
+	runs := append([]domain.CronRunRecord{}, state.Runs...)
+	return domain.CronJobHistory{JobID: jobID, Runs: runs}, nil
+}
+
 func (s *Service) SchedulerTick(now time.Time) ([]string, error) {
 	if err := s.validateStore(); err != nil {
 		return nil, err
@@ -285,7 +554,11 @@ func (s *Service) SchedulerTick(now time.Time) ([]string, error) {
 				continue
 			}
 
-			nextRunAt, dueAt, err := ResolveNextRunAt(job, next.NextRunAt, now)
+			pending := next.NextRunAt
+			if pending == nil {
+				pending = alignedIntervalRunAt(job, next, now)
+			}
+			nextRunAt, dueAt, err := ResolveNextRunAt(job, pending, now)
 			if err != nil {
 				msg := err.Error()
 				next.LastError = &msg
@@ -299,7 +572,9 @@ func (s *Service) SchedulerTick(now time.Time) ([]string, error) {
 			nextRun := nextRunAt.Format(time.RFC3339)
 			next.NextRunAt = &nextRun
 			next.LastError = nil
-			if dueAt != nil && MisfireExceeded(dueAt, runtimeSpec(job), now) {
+			// Missed runs collapse into the single dueAt, so fire_once never
+			// replays more than one execution after downtime.
+			if dueAt != nil && MisfireExceeded(dueAt, runtimeSpec(job), now) && job.Schedule.CatchUp != catchUpFireOnce {
 				failed := statusFailed
 				msg := fmt.Sprintf("misfire skipped: scheduled_at=%s", dueAt.Format(time.RFC3339))
 				next.LastStatus = &failed
@@ -345,6 +620,46 @@ func (s *Service) ExecuteJob(jobID string) error {
 	if !found {
 		return ErrJobNotFound
 	}
+	return s.executeJob(context.Background(), jobID, job)
+}
+
+// ExecuteJobWithOutput runs a console job through the same lease and state
+// bookkeeping as ExecuteJob and returns the agent replies it produced, joined
+// by blank lines when a workflow has several text nodes. The output is
+// returned alongside an execution error so callers can show partial results.
+func (s *Service) ExecuteJobWithOutput(jobID string) (string, error) {
+	if err := s.validateStore(); err != nil {
+		return "", err
+	}
+
+	var job domain.CronJobSpec
+	found := false
+	s.deps.Store.ReadCron(func(st ports.CronAggregate) {
+		job, found = st.Jobs[jobID]
+	})
+	if !found {
+		return "", ErrJobNotFound
+	}
+	if channelName := strings.ToLower(resolveDispatchChannel(job)); channelName != "console" {
+		return "", &ValidationError{
+			Code:    "cron_run_sync_unsupported",
+			Message: fmt.Sprintf("run-sync only supports console jobs, got dispatch channel %q", channelName),
+		}
+	}
+
+	output := &replyCollector{}
+	err := s.executeJob(context.WithValue(context.Background(), replyCollectorKey{}, output), jobID, job)
+	return strings.Join(output.replies, "\n\n"), err
+}
+
+type replyCollectorKey struct{}
+
+// replyCollector gathers console agent replies for ExecuteJobWithOutput.
+type replyCollector struct {
+	replies []string
+}
+
+func (s *Service) executeJob(parent context.Context, jobID string, job domain.CronJobSpec) error {
 
 	runtime := runtimeSpec(job)
 	slot, acquired, err := s.tryAcquireSlot(jobID, runtime)
@@ -377,7 +692,7 @@ func (s *Service) ExecuteJob(jobID string) error {
 		return err
 	}
 
-	execCtx, cancel := context.WithTimeout(context.Background(), time.Duration(runtime.TimeoutSeconds)*time.Second)
+	execCtx, cancel := context.WithTimeout(parent, time.Duration(runtime.TimeoutSeconds)*time.Second)
 	defer cancel()
 	lastExecution, execErr := s.executeTask(execCtx, job)
 	if errors.Is(execErr, context.DeadlineExceeded) {
@@ -386,11 +701,14 @@ func (s *Service) ExecuteJob(jobID string) error {
 
 	finalStatus := statusSucceeded
 	var finalErr *string
+	record := domain.CronRunRecord{StartedAt: startedAt, FinishedAt: nowISO()}
 	if execErr != nil {
 		finalStatus = statusFailed
 		msg := execErr.Error()
 		finalErr = &msg
+		record.Error = msg
 	}
+	record.Status = finalStatus
 	if err := s.deps.Store.WriteCron(func(st *ports.CronAggregate) error {
 		if _, ok := st.Jobs[jobID]; !ok {
 			return nil
@@ -399,6 +717,7 @@ func (s *Service) ExecuteJob(jobID string) error {
 		state.LastStatus = &finalStatus
 		state.LastError = finalErr
 		state.LastExecution = lastExecution
+		state.Runs = appendRunRecord(state.Runs, record)
 		st.States[jobID] = state
 		return nil
 	}); err != nil {
@@ -432,11 +751,27 @@ func (s *Service) executeTask(ctx context.Context, job domain.CronJobSpec) (*dom
 	case taskTypeWorkflow:
 		execution, err := s.executeWorkflowTask(ctx, job)
 		return execution, err
+	case taskTypeTool:
+		return nil, s.executeToolTask(ctx, job)
 	default:
 		return nil, fmt.Errorf("unsupported cron task_type=%q", job.TaskType)
 	}
 }
 
+func (s *Service) executeToolTask(ctx context.Context, job domain.CronJobSpec) error {
+	if job.Tool == nil || strings.TrimSpace(job.Tool.Name) == "" {
+		return errors.New("cron tool task requires tool.name")
+	}
+	if s.deps.ExecuteToolTask == nil {
+		return errors.New("cron tool executor is unavailable")
+	}
+	output, err := s.deps.ExecuteToolTask(ctx, job)
+	if collector, ok := ctx.Value(replyCollectorKey{}).(*replyCollector); ok && strings.TrimSpace(output) != "" {
+		collector.replies = append(collector.replies, output)
+	}
+	return err
+}
+
 func (s *Service) executeTextTask(ctx context.Context, job domain.CronJobSpec, text string) error {
 	channelName := strings.ToLower(resolveDispatchChannel(job))
 	if channelName == qqChannelName {
@@ -445,7 +780,7 @@ func (s *Service) executeTextTask(ctx context.Context, job domain.CronJobSpec, t
 	if s.deps.ChannelResolver == nil {
 		return errors.New("cron channel resolver is unavailable")
 	}
-	channelPlugin, channelCfg, resolvedChannelName, err := s.deps.ChannelResolver.ResolveChannel(channelName)
+	_, _, resolvedChannelName, err := s.deps.ChannelResolver.ResolveChannel(channelName)
 	if err != nil {
 		return err
 	}
@@ -453,9 +788,16 @@ func (s *Service) executeTextTask(ctx context.Context, job domain.CronJobSpec, t
 		if s.deps.ExecuteConsoleAgentTask == nil {
 			return errors.New("cron console agent executor is unavailable")
 		}
-		return s.deps.ExecuteConsoleAgentTask(ctx, job, text)
+		reply, err := s.deps.ExecuteConsoleAgentTask(ctx, job, text)
+		if output, ok := ctx.Value(replyCollectorKey{}).(*replyCollector); ok && strings.TrimSpace(reply) != "" {
+			output.replies = append(output.replies, reply)
+		}
+		return err
+	}
+	if s.deps.DispatchText == nil {
+		return errors.New("cron channel dispatcher is unavailable")
 	}
-	if err := channelPlugin.SendText(ctx, job.Dispatch.Target.UserID, job.Dispatch.Target.SessionID, text, channelCfg); err != nil {
+	if err := s.deps.DispatchText(ctx, resolvedChannelName, job.Dispatch.Target.UserID, job.Dispatch.Target.SessionID, text); err != nil {
 		return &channelError{
 			Message: fmt.Sprintf("failed to dispatch cron job to channel %q", resolvedChannelName),
 			Err:     err,
@@ -649,6 +991,18 @@ func (s *Service) validateJobSpec(job *domain.CronJobSpec) (string, error) {
 	if job.ID == "" || job.Name == "" {
 		return "invalid_cron_task_type", errors.New("id and name are required")
 	}
+	job.Schedule.CatchUp = strings.ToLower(strings.TrimSpace(job.Schedule.CatchUp))
+	switch job.Schedule.CatchUp {
+	case "", catchUpSkip, catchUpFireOnce:
+	default:
+		return "invalid_cron_schedule", fmt.Errorf("unsupported schedule.catch_up=%q", job.Schedule.CatchUp)
+	}
+	if job.Schedule.JitterSeconds < 0 {
+		return "invalid_cron_schedule", errors.New("schedule.jitter_seconds must be >= 0")
+	}
+	if job.Schedule.JitterSeconds > 0 && scheduleType(*job) != "interval" {
+		return "invalid_cron_schedule", errors.New("schedule.jitter_seconds is only supported for interval schedules")
+	}
 
 	switch taskType(*job) {
 	case taskTypeText:
@@ -659,6 +1013,7 @@ func (s *Service) validateJobSpec(job *domain.CronJobSpec) (string, error) {
 		job.TaskType = taskTypeText
 		job.Text = text
 		job.Workflow = nil
+		job.Tool = nil
 		return "", nil
 	case taskTypeWorkflow:
 		plan, err := s.buildWorkflowPlan(job.Workflow)
@@ -668,12 +1023,62 @@ func (s *Service) validateJobSpec(job *domain.CronJobSpec) (string, error) {
 		job.TaskType = taskTypeWorkflow
 		job.Workflow = &plan.Workflow
 		job.Text = ""
+		job.Tool = nil
+		return "", nil
+	case taskTypeTool:
+		if job.Tool == nil || strings.TrimSpace(job.Tool.Name) == "" {
+			return "invalid_cron_task_type", errors.New("tool.name is required for task_type=tool")
+		}
+		name := strings.ToLower(strings.TrimSpace(job.Tool.Name))
+		if s.deps.ToolDisabled != nil && s.deps.ToolDisabled(name) {
+			return "tool_disabled", fmt.Errorf("tool %q is disabled by server config", name)
+		}
+		if channel := strings.ToLower(resolveDispatchChannel(*job)); channel != "console" {
+			return "invalid_cron_dispatch", fmt.Errorf("task_type=tool requires dispatch channel \"console\", got %q", channel)
+		}
+		job.TaskType = taskTypeTool
+		job.Tool = &domain.CronToolTask{Name: name, Input: job.Tool.Input}
+		job.Text = ""
+		job.Workflow = nil
 		return "", nil
 	default:
 		return "invalid_cron_task_type", fmt.Errorf("unsupported task_type=%q", strings.TrimSpace(job.TaskType))
 	}
 }
 
+// prepareJob normalizes job and runs every create/update check: the spec, the
+// schedule and the dispatch target. Failures are *ValidationError.
+func (s *Service) prepareJob(job *domain.CronJobSpec) error {
+	if code, err := s.validateJobSpec(job); err != nil {
+		return &ValidationError{Code: code, Message: err.Error()}
+	}
+	if err := validateJobScheduleParses(*job); err != nil {
+		return err
+	}
+	if code, err := validateJobDispatch(*job); err != nil {
+		return &ValidationError{Code: code, Message: err.Error()}
+	}
+	return nil
+}
+
+// validateJobScheduleParses rejects a schedule.cron interval or expression
+// that cannot be parsed, so a broken job fails on create/update instead of
+// surfacing later as state last_error. Every schedule problem, here, in
+// validateJobSpec, ValidateJob and PreviewSchedule, uses invalid_cron_schedule.
+func validateJobScheduleParses(job domain.CronJobSpec) error {
+	if _, _, err := ResolveNextRunAt(job, nil, time.Now().UTC()); err != nil {
+		return &ValidationError{Code: "invalid_cron_schedule", Message: err.Error()}
+	}
+	return nil
+}
+
+func validateJobDispatch(job domain.CronJobSpec) (string, error) {
+	if strings.ToLower(resolveDispatchChannel(job)) == qqChannelName {
+		return "invalid_cron_dispatch", errors.New("cron dispatch channel \"qq\" is inbound-only; use channel \"console\" to persist chat history")
+	}
+	return "", nil
+}
+
 func taskType(job domain.CronJobSpec) string {
 	t := strings.ToLower(strings.TrimSpace(job.TaskType))
 	if t != "" {
@@ -682,6 +1087,9 @@ func taskType(job domain.CronJobSpec) string {
 	if job.Workflow != nil {
 		return taskTypeWorkflow
 	}
+	if job.Tool != nil {
+		return taskTypeTool
+	}
 	if strings.TrimSpace(job.Text) != "" {
 		return taskTypeText
 	}
@@ -891,6 +1299,11 @@ func alignStateForMutation(job domain.CronJobSpec, state domain.CronJobState, no
 		state.NextRunAt = nil
 		return state
 	}
+	if aligned := alignedIntervalRunAt(job, state, now); aligned != nil {
+		state.NextRunAt = aligned
+		state.LastError = nil
+		return state
+	}
 	nextRunAt, _, err := ResolveNextRunAt(job, nil, now)
 	if err != nil {
 		msg := err.Error()
@@ -905,6 +1318,47 @@ func alignStateForMutation(job domain.CronJobSpec, state domain.CronJobState, no
 	return state
 }
 
+// alignedIntervalRunAt returns where an interval job with
+// runtime.align_to_last_run resumes: the latest slot missed since last_run_at,
+// which the scheduler then runs or skips under misfire_grace_seconds, or the
+// next slot when none was missed. Without a last run the pending next_run_at
+// is kept as the anchor. It returns nil when the option does not apply.
+func alignedIntervalRunAt(job domain.CronJobSpec, state domain.CronJobState, now time.Time) *string {
+	if !job.Runtime.AlignToLastRun || scheduleType(job) != "interval" {
+		return nil
+	}
+	if state.LastRunAt == nil {
+		return state.NextRunAt
+	}
+	lastRun, err := time.Parse(time.RFC3339, strings.TrimSpace(*state.LastRunAt))
+	if err != nil {
+		return nil
+	}
+	iv, err := interval(job)
+	if err != nil {
+		return nil
+	}
+	slot := lastRun.Add(iv)
+	if missed := now.Sub(lastRun) / iv; missed >= 1 {
+		slot = lastRun.Add(missed * iv)
+	}
+	out := slot.UTC().Format(time.RFC3339)
+	return &out
+}
+
+// appendRunRecord adds record and drops the oldest entries beyond
+// runHistoryLimit. It copies, so a slice shared with a read snapshot is never
+// written through.
+func appendRunRecord(runs []domain.CronRunRecord, record domain.CronRunRecord) []domain.CronRunRecord {
+	start := 0
+	if len(runs) >= runHistoryLimit {
+		start = len(runs) - runHistoryLimit + 1
+	}
+	out := make([]domain.CronRunRecord, 0, len(runs)-start+1)
+	out = append(out, runs[start:]...)
+	return append(out, record)
+}
+
 func normalizePausedState(state domain.CronJobState) domain.CronJobState {
 	if !state.Paused && state.LastStatus != nil && *state.LastStatus == statusPaused {
 		state.Paused = true
@@ -953,10 +1407,7 @@ func (s *Service) tryAcquireSlot(jobID string, runtime domain.CronRuntimeSpec) (
 	}
 
 	now := time.Now().UTC()
-	ttl := time.Duration(runtime.TimeoutSeconds)*time.Second + 30*time.Second
-	if ttl < 30*time.Second {
-		ttl = 30 * time.Second
-	}
+	ttl := s.leaseTTL(runtime)
 
 	leaseID := newLeaseID()
 	dir := filepath.Join(strings.TrimSpace(s.deps.DataDir), cronLeaseDirName, encodeJobID(jobID))
@@ -966,7 +1417,7 @@ func (s *Service) tryAcquireSlot(jobID string, runtime domain.CronRuntimeSpec) (
 
 	for slot := 0; slot < maxConcurrency; slot++ {
 		path := filepath.Join(dir, fmt.Sprintf("slot-%d.json", slot))
-		if err := cleanupExpiredLease(path, now); err != nil {
+		if _, err := cleanupExpiredLease(path, now); err != nil {
 			return nil, false, err
 		}
 
@@ -1033,28 +1484,112 @@ func (s *Service) releaseSlot(slot *leaseHandle) {
 	}
 }
 
-func cleanupExpiredLease(path string, now time.Time) error {
+func (s *Service) leaseTTL(runtime domain.CronRuntimeSpec) time.Duration {
+	timeout := time.Duration(runtime.TimeoutSeconds) * time.Second
+	if s.deps.LeaseTTL > 0 {
+		if s.deps.LeaseTTL < timeout {
+			return timeout
+		}
+		return s.deps.LeaseTTL
+	}
+	ttl := timeout + 30*time.Second
+	if ttl < 30*time.Second {
+		ttl = 30 * time.Second
+	}
+	return ttl
+}
+
+// ReapExpiredLeases removes every expired or unreadable lease file under the
+// lease directory and returns how many were removed. It recovers slots left
+// behind by a process that died mid-run.
+func (s *Service) ReapExpiredLeases(now time.Time) (int, error) {
+	paths, err := filepath.Glob(filepath.Join(strings.TrimSpace(s.deps.DataDir), cronLeaseDirName, "*", "slot-*.json"))
+	if err != nil {
+		return 0, err
+	}
+	reaped := 0
+	for _, path := range paths {
+		removed, err := cleanupExpiredLease(path, now)
+		if err != nil {
+			return reaped, err
+		}
+		if removed {
+			reaped++
+		}
+	}
+	return reaped, nil
+}
+
+// cleanupExpiredLease removes the lease at path when it has expired or cannot
+// be parsed, and reports whether it did.
+func cleanupExpiredLease(path string, now time.Time) (bool, error) {
 	body, err := os.ReadFile(path)
 	if errors.Is(err, os.ErrNotExist) {
-		return nil
+		return false, nil
 	}
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	var lease leaseSlot
 	if err := json.Unmarshal(body, &lease); err != nil {
-		return removeIfExists(path)
+		return true, removeIfExists(path)
 	}
 
 	expiresAt, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(lease.ExpiresAt))
 	if err != nil {
-		return removeIfExists(path)
+		return true, removeIfExists(path)
 	}
 	if !now.After(expiresAt.UTC()) {
-		return nil
+		return false, nil
 	}
-	return removeIfExists(path)
+	return true, removeIfExists(path)
+}
+
+// countActiveLeases counts unexpired lease files per job without touching
+// them; expired leases are left for the next acquire to clean up.
+func (s *Service) countActiveLeases(now time.Time) (map[string]int, int, error) {
+	root := filepath.Join(strings.TrimSpace(s.deps.DataDir), cronLeaseDirName)
+	dirs, err := os.ReadDir(root)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]int{}, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	counts := map[string]int{}
+	total := 0
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		rawID, err := base64.RawURLEncoding.DecodeString(dir.Name())
+		if err != nil {
+			continue
+		}
+		paths, err := filepath.Glob(filepath.Join(root, dir.Name(), "slot-*.json"))
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, path := range paths {
+			body, err := os.ReadFile(path)
+			if err != nil {
+				continue
+			}
+			var lease leaseSlot
+			if err := json.Unmarshal(body, &lease); err != nil {
+				continue
+			}
+			expiresAt, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(lease.ExpiresAt))
+			if err != nil || now.After(expiresAt.UTC()) {
+				continue
+			}
+			counts[string(rawID)]++
+			total++
+		}
+	}
+	return counts, total, nil
 }
 
 func removeIfExists(path string) error {
@@ -1085,6 +1620,18 @@ func newRunID() string {
 	return fmt.Sprintf("run-%d-%x", os.Getpid(), buf)
 }
 
+// MarkGlobalConcurrencySkipped records a run that was refused because every
+// server-wide cron slot was taken, and returns ErrGlobalConcurrencyReached.
+func (s *Service) MarkGlobalConcurrencySkipped(jobID string, limit int) error {
+	if err := s.validateStore(); err != nil {
+		return err
+	}
+	if err := s.markExecutionSkipped(jobID, fmt.Sprintf("global cron concurrency limit reached (%d)", limit)); err != nil {
+		return err
+	}
+	return ErrGlobalConcurrencyReached
+}
+
 func (s *Service) markExecutionSkipped(jobID, message string) error {
 	failed := statusFailed
 	return s.deps.Store.WriteCron(func(st *ports.CronAggregate) error {
@@ -1151,7 +1698,7 @@ func ResolveNextRunAt(job domain.CronJobSpec, current *string, now time.Time) (t
 		if err != nil {
 			return time.Time{}, nil, err
 		}
-		next, dueAt := resolveIntervalNextRunAt(current, iv, now)
+		next, dueAt := resolveIntervalNextRunAt(current, iv, intervalJitter(job), now)
 		return next, dueAt, nil
 	case "cron":
 		schedule, loc, err := expression(job)
@@ -1188,8 +1735,20 @@ func expression(job domain.CronJobSpec) (cronv3.Schedule, *time.Location, error)
 	return schedule, loc, nil
 }
 
-func resolveIntervalNextRunAt(current *string, interval time.Duration, now time.Time) (time.Time, *time.Time) {
-	next := now.Add(interval)
+// intervalJitter derives a stable offset in [0, jitter_seconds] from the job id.
+// It is added only when a fresh run time is seeded; later runs step from the
+// stored instant by whole intervals, so the offset never accumulates.
+func intervalJitter(job domain.CronJobSpec) time.Duration {
+	if job.Schedule.JitterSeconds <= 0 {
+		return 0
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(job.ID))
+	return time.Duration(h.Sum32()%uint32(job.Schedule.JitterSeconds+1)) * time.Second
+}
+
+func resolveIntervalNextRunAt(current *string, interval, jitter time.Duration, now time.Time) (time.Time, *time.Time) {
+	next := now.Add(interval + jitter)
 	if current == nil {
 		return next, nil
 	}
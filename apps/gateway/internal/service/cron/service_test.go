@@ -2,6 +2,7 @@ package cron
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"os"
 	"strings"
@@ -65,6 +66,49 @@ func TestExecuteJobTimeoutMapped(t *testing.T) {
 	}
 }
 
+func TestExecuteJobKeepsBoundedRunHistory(t *testing.T) {
+	store, dir := newTestStore(t)
+	seedTestJob(t, store, "job-history", domain.CronRuntimeSpec{MaxConcurrency: 1, TimeoutSeconds: 5})
+
+	calls := 0
+	svc := NewService(Dependencies{
+		Store:   adapters.NewRepoStateStore(store),
+		DataDir: dir,
+		ExecuteTask: func(context.Context, domain.CronJobSpec) (bool, error) {
+			calls++
+			if calls%2 == 0 {
+				return true, errors.New("boom")
+			}
+			return true, nil
+		},
+	})
+
+	total := runHistoryLimit + 3
+	for i := 0; i < total; i++ {
+		_ = svc.ExecuteJob("job-history")
+	}
+
+	history, err := svc.GetHistory("job-history")
+	if err != nil {
+		t.Fatalf("get history failed: %v", err)
+	}
+	if len(history.Runs) != runHistoryLimit {
+		t.Fatalf("expected %d runs, got=%d", runHistoryLimit, len(history.Runs))
+	}
+	// The three oldest runs were trimmed, so the first kept run is call 4.
+	first := history.Runs[0]
+	if first.Status != statusFailed || first.Error != "boom" {
+		t.Fatalf("unexpected oldest kept run: %#v", first)
+	}
+	last := history.Runs[len(history.Runs)-1]
+	if last.Status != statusSucceeded || last.Error != "" || last.StartedAt == "" || last.FinishedAt == "" {
+		t.Fatalf("unexpected latest run: %#v", last)
+	}
+	if _, err := svc.GetHistory("missing"); !errors.Is(err, ErrJobNotFound) {
+		t.Fatalf("expected ErrJobNotFound, got=%v", err)
+	}
+}
+
 func TestExecuteJobRespectsMaxConcurrency(t *testing.T) {
 	store, dir := newTestStore(t)
 	seedTestJob(t, store, "job-concurrency", domain.CronRuntimeSpec{MaxConcurrency: 1, TimeoutSeconds: 5})
@@ -242,3 +286,327 @@ func (h stubCronNodeHandler) Execute(
 	}
 	return h.execute(ctx, job, node)
 }
+
+func TestSchedulerTickCatchUpPolicy(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	missed := now.Add(-3 * time.Hour).Format(time.RFC3339)
+
+	for _, tc := range []struct {
+		catchUp string
+		wantDue bool
+	}{
+		{catchUp: "", wantDue: false},
+		{catchUp: catchUpFireOnce, wantDue: true},
+	} {
+		store, dir := newTestStore(t)
+		jobID := "job-catch-up-" + tc.catchUp
+		seedTestJob(t, store, jobID, domain.CronRuntimeSpec{MaxConcurrency: 1, TimeoutSeconds: 5, MisfireGraceSeconds: 30})
+		if err := store.Write(func(st *repo.State) error {
+			job := st.CronJobs[jobID]
+			job.Enabled = true
+			job.Schedule.CatchUp = tc.catchUp
+			st.CronJobs[jobID] = job
+			st.CronStates[jobID] = domain.CronJobState{NextRunAt: &missed}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		svc := NewService(Dependencies{Store: adapters.NewRepoStateStore(store), DataDir: dir})
+
+		due, err := svc.SchedulerTick(now)
+		if err != nil {
+			t.Fatalf("scheduler tick failed: %v", err)
+		}
+		if got := len(due) == 1 && due[0] == jobID; got != tc.wantDue {
+			t.Fatalf("catch_up=%q: expected due=%v, got=%v", tc.catchUp, tc.wantDue, due)
+		}
+		state := readState(t, store, jobID)
+		misfireFailed := state.LastStatus != nil && *state.LastStatus == statusFailed
+		if misfireFailed == tc.wantDue {
+			t.Fatalf("catch_up=%q: unexpected last_status=%v", tc.catchUp, state.LastStatus)
+		}
+
+		due, err = svc.SchedulerTick(now.Add(time.Second))
+		if err != nil {
+			t.Fatalf("second scheduler tick failed: %v", err)
+		}
+		if len(due) != 0 {
+			t.Fatalf("catch_up=%q: missed runs must fire at most once, got=%v", tc.catchUp, due)
+		}
+	}
+}
+
+func TestSchedulerTickAlignToLastRunAfterDowntime(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	lastRun := now.Add(-5*time.Hour - 30*time.Minute)
+	lastRunText := lastRun.Format(time.RFC3339)
+	aligned := lastRun.Add(6 * time.Hour).Format(time.RFC3339)
+
+	for _, tc := range []struct {
+		name     string
+		align    bool
+		grace    int
+		wantDue  bool
+		wantNext string
+		wantSkip bool
+	}{
+		{name: "off", wantNext: now.Add(time.Hour).Format(time.RFC3339)},
+		{name: "aligned", align: true, wantDue: true, wantNext: aligned},
+		{name: "aligned_misfire", align: true, grace: 600, wantNext: aligned, wantSkip: true},
+	} {
+		store, dir := newTestStore(t)
+		jobID := "job-align-" + tc.name
+		seedTestJob(t, store, jobID, domain.CronRuntimeSpec{
+			MaxConcurrency:      1,
+			TimeoutSeconds:      5,
+			MisfireGraceSeconds: tc.grace,
+			AlignToLastRun:      tc.align,
+		})
+		// The job was paused over the downtime, so no run is pending.
+		if err := store.Write(func(st *repo.State) error {
+			job := st.CronJobs[jobID]
+			job.Enabled = true
+			job.Schedule.Cron = "1h"
+			st.CronJobs[jobID] = job
+			st.CronStates[jobID] = domain.CronJobState{LastRunAt: &lastRunText}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		svc := NewService(Dependencies{Store: adapters.NewRepoStateStore(store), DataDir: dir})
+
+		due, err := svc.SchedulerTick(now)
+		if err != nil {
+			t.Fatalf("%s: scheduler tick failed: %v", tc.name, err)
+		}
+		if got := len(due) == 1 && due[0] == jobID; got != tc.wantDue {
+			t.Fatalf("%s: expected due=%v, got=%v", tc.name, tc.wantDue, due)
+		}
+		state := readState(t, store, jobID)
+		if state.NextRunAt == nil || *state.NextRunAt != tc.wantNext {
+			t.Fatalf("%s: next_run_at=%v, want %s", tc.name, state.NextRunAt, tc.wantNext)
+		}
+		skipped := state.LastStatus != nil && *state.LastStatus == statusFailed
+		if skipped != tc.wantSkip {
+			t.Fatalf("%s: unexpected last_status=%v last_error=%v", tc.name, state.LastStatus, state.LastError)
+		}
+	}
+}
+
+func TestValidateJobRejectsUnknownCatchUp(t *testing.T) {
+	store, dir := newTestStore(t)
+	svc := NewService(Dependencies{Store: adapters.NewRepoStateStore(store), DataDir: dir})
+	job := domain.CronJobSpec{
+		ID:       "job-catch-up",
+		Name:     "job-catch-up",
+		TaskType: "text",
+		Text:     "hello",
+		Schedule: domain.CronScheduleSpec{Type: "interval", Cron: "60s", CatchUp: "replay_all"},
+	}
+	out := svc.ValidateJob(job)
+	if out.Valid || len(out.Problems) == 0 || out.Problems[0].Code != "invalid_cron_schedule" {
+		t.Fatalf("expected invalid_cron_schedule, got=%#v", out.Problems)
+	}
+
+	job.Schedule.CatchUp = " Fire_Once "
+	out = svc.ValidateJob(job)
+	if !out.Valid || out.Job.Schedule.CatchUp != catchUpFireOnce {
+		t.Fatalf("expected normalized fire_once, got valid=%v catch_up=%q problems=%#v", out.Valid, out.Job.Schedule.CatchUp, out.Problems)
+	}
+}
+
+func TestPreviewScheduleListsNextRunsInTimezone(t *testing.T) {
+	svc := NewService(Dependencies{})
+	job := domain.CronJobSpec{Schedule: domain.CronScheduleSpec{Type: "cron", Cron: "0 9 * * 1-5", Timezone: "Asia/Shanghai"}}
+	// Friday 2026-01-02 12:00 UTC is already past 09:00 in Shanghai.
+	now := time.Date(2026, 1, 2, 12, 0, 0, 0, time.UTC)
+
+	out, err := svc.PreviewSchedule(job, now)
+	if err != nil {
+		t.Fatalf("preview failed: %v", err)
+	}
+	wantLocal := []string{
+		"2026-01-05T09:00:00+08:00",
+		"2026-01-06T09:00:00+08:00",
+		"2026-01-07T09:00:00+08:00",
+		"2026-01-08T09:00:00+08:00",
+		"2026-01-09T09:00:00+08:00",
+	}
+	if out.Timezone != "Asia/Shanghai" || len(out.Runs) != len(wantLocal) {
+		t.Fatalf("unexpected preview: %#v", out)
+	}
+	for i, run := range out.Runs {
+		if run.Local != wantLocal[i] {
+			t.Fatalf("run %d local=%q, want %q", i, run.Local, wantLocal[i])
+		}
+	}
+	if out.Runs[0].UTC != "2026-01-05T01:00:00Z" {
+		t.Fatalf("unexpected first UTC run: %q", out.Runs[0].UTC)
+	}
+
+	interval := domain.CronJobSpec{Schedule: domain.CronScheduleSpec{Type: "interval", Cron: "90m"}}
+	out, err = svc.PreviewSchedule(interval, now)
+	if err != nil {
+		t.Fatalf("interval preview failed: %v", err)
+	}
+	if out.Timezone != "UTC" || out.Runs[0].UTC != "2026-01-02T13:30:00Z" || out.Runs[4].UTC != "2026-01-02T19:30:00Z" {
+		t.Fatalf("unexpected interval preview: %#v", out)
+	}
+
+	_, err = svc.PreviewSchedule(domain.CronJobSpec{Schedule: domain.CronScheduleSpec{Type: "cron", Cron: "not a cron"}}, now)
+	var validation *ValidationError
+	if !errors.As(err, &validation) || validation.Code != "invalid_cron_schedule" {
+		t.Fatalf("expected invalid_cron_schedule validation error, got=%v", err)
+	}
+}
+
+func TestResolveNextRunAtAppliesStableIntervalJitter(t *testing.T) {
+	now := time.Date(2026, 1, 2, 12, 0, 0, 0, time.UTC)
+	offsets := map[time.Duration]bool{}
+	for _, id := range []string{"job-a", "job-b", "job-c", "job-d"} {
+		job := domain.CronJobSpec{ID: id, Schedule: domain.CronScheduleSpec{Type: "interval", Cron: "60s", JitterSeconds: 30}}
+		seeded, _, err := ResolveNextRunAt(job, nil, now)
+		if err != nil {
+			t.Fatalf("resolve failed: %v", err)
+		}
+		offset := seeded.Sub(now.Add(time.Minute))
+		if offset < 0 || offset > 30*time.Second {
+			t.Fatalf("job %s offset %s outside [0, 30s]", id, offset)
+		}
+		offsets[offset] = true
+
+		// Stepping from the stored run keeps the same offset instead of adding more.
+		current := seeded.Format(time.RFC3339)
+		later := seeded.Add(5*time.Minute + time.Second)
+		next, dueAt, err := ResolveNextRunAt(job, &current, later)
+		if err != nil {
+			t.Fatalf("resolve from current failed: %v", err)
+		}
+		if dueAt == nil || !dueAt.Equal(seeded) || !next.Equal(seeded.Add(6*time.Minute)) {
+			t.Fatalf("job %s drifted: seeded=%s next=%s due=%v", id, seeded, next, dueAt)
+		}
+	}
+	if len(offsets) < 2 {
+		t.Fatalf("expected jobs to spread across offsets, got=%v", offsets)
+	}
+
+	store, dir := newTestStore(t)
+	svc := NewService(Dependencies{Store: adapters.NewRepoStateStore(store), DataDir: dir})
+	out := svc.ValidateJob(domain.CronJobSpec{
+		ID:       "job-jitter",
+		Name:     "job-jitter",
+		TaskType: "text",
+		Text:     "hello",
+		Schedule: domain.CronScheduleSpec{Type: "cron", Cron: "0 9 * * *", JitterSeconds: 10},
+	})
+	if out.Valid || len(out.Problems) == 0 || out.Problems[0].Code != "invalid_cron_schedule" {
+		t.Fatalf("expected jitter on cron schedule to be rejected, got=%#v", out.Problems)
+	}
+}
+
+func TestOverviewOrdersByNextRunAndCountsLeases(t *testing.T) {
+	store, dir := newTestStore(t)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, id := range []string{"job-late", "job-soon", "job-idle"} {
+		seedTestJob(t, store, id, domain.CronRuntimeSpec{MaxConcurrency: 2, TimeoutSeconds: 5})
+	}
+	late := now.Add(time.Hour).Format(time.RFC3339)
+	soon := now.Add(time.Minute).Format(time.RFC3339)
+	if err := store.Write(func(st *repo.State) error {
+		for id, next := range map[string]string{"job-late": late, "job-soon": soon} {
+			job := st.CronJobs[id]
+			job.Enabled = true
+			st.CronJobs[id] = job
+			st.CronStates[id] = domain.CronJobState{NextRunAt: &next}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	svc := NewService(Dependencies{Store: adapters.NewRepoStateStore(store), DataDir: dir})
+	slot, acquired, err := svc.tryAcquireSlot("job-soon", domain.CronRuntimeSpec{MaxConcurrency: 2, TimeoutSeconds: 5})
+	if err != nil || !acquired {
+		t.Fatalf("acquire lease failed: acquired=%v err=%v", acquired, err)
+	}
+	defer svc.releaseSlot(slot)
+
+	overview, err := svc.Overview(now)
+	if err != nil {
+		t.Fatalf("overview failed: %v", err)
+	}
+	items := make([]domain.CronOverviewItem, 0, 3)
+	order := make([]string, 0, 3)
+	for _, item := range overview.Jobs {
+		if strings.HasPrefix(item.Spec.ID, "job-") {
+			items = append(items, item)
+			order = append(order, item.Spec.ID)
+		}
+	}
+	if strings.Join(order, ",") != "job-soon,job-late,job-idle" {
+		t.Fatalf("unexpected overview order: %v", order)
+	}
+	if !items[0].IsDueSoon || items[1].IsDueSoon || items[2].IsDueSoon {
+		t.Fatalf("unexpected is_due_soon flags: %+v", items)
+	}
+	if overview.RunningLeases != 1 || items[0].RunningLeases != 1 || items[1].RunningLeases != 0 {
+		t.Fatalf("unexpected lease counts: total=%d jobs=%+v", overview.RunningLeases, items)
+	}
+}
+
+func TestReapExpiredLeasesFreesStaleSlots(t *testing.T) {
+	store, dir := newTestStore(t)
+	seedTestJob(t, store, "job-stale", domain.CronRuntimeSpec{MaxConcurrency: 1, TimeoutSeconds: 5})
+	seedTestJob(t, store, "job-live", domain.CronRuntimeSpec{MaxConcurrency: 1, TimeoutSeconds: 5})
+
+	svc := NewService(Dependencies{
+		Store:    adapters.NewRepoStateStore(store),
+		DataDir:  dir,
+		LeaseTTL: 10 * time.Minute,
+		ExecuteTask: func(context.Context, domain.CronJobSpec) (bool, error) {
+			return true, nil
+		},
+	})
+	stale, _, err := svc.tryAcquireSlot("job-stale", domain.CronRuntimeSpec{MaxConcurrency: 1, TimeoutSeconds: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	live, _, err := svc.tryAcquireSlot("job-live", domain.CronRuntimeSpec{MaxConcurrency: 1, TimeoutSeconds: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer svc.releaseSlot(live)
+
+	body, err := os.ReadFile(stale.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lease leaseSlot
+	if err := json.Unmarshal(body, &lease); err != nil {
+		t.Fatal(err)
+	}
+	acquiredAt, _ := time.Parse(time.RFC3339Nano, lease.AcquiredAt)
+	expiresAt, _ := time.Parse(time.RFC3339Nano, lease.ExpiresAt)
+	if expiresAt.Sub(acquiredAt) != 10*time.Minute {
+		t.Fatalf("expected lease ttl from LeaseTTL, lease=%s", body)
+	}
+
+	reaped, err := svc.ReapExpiredLeases(time.Now().UTC().Add(time.Minute))
+	if err != nil || reaped != 0 {
+		t.Fatalf("expected no lease reaped before expiry, reaped=%d err=%v", reaped, err)
+	}
+	// Simulate a crash: the stale lease outlives its owner and expires.
+	if err := os.WriteFile(stale.Path, []byte(`{"lease_id":"dead","job_id":"job-stale","expires_at":"2000-01-01T00:00:00Z"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	reaped, err = svc.ReapExpiredLeases(time.Now().UTC())
+	if err != nil || reaped != 1 {
+		t.Fatalf("expected one stale lease reaped, reaped=%d err=%v", reaped, err)
+	}
+	if _, err := os.Stat(live.Path); err != nil {
+		t.Fatalf("live lease should survive reaping: %v", err)
+	}
+	if err := svc.ExecuteJob("job-stale"); err != nil {
+		t.Fatalf("expected job to run after reaping, got=%v", err)
+	}
+}
@@ -39,16 +39,31 @@ type Service struct {
 }
 
 type ConfigureProviderInput struct {
-	ProviderID      string
-	APIKey          *string
-	BaseURL         *string
-	DisplayName     *string
-	ReasoningEffort *string
-	Enabled         *bool
-	Store           *bool
-	Headers         *map[string]string
-	TimeoutMS       *int
-	ModelAliases    *map[string]string
+	ProviderID        string
+	APIKey            *string
+	APIKeys           *[]string
+	BaseURL           *string
+	DisplayName       *string
+	ReasoningEffort   *string
+	Enabled           *bool
+	Store             *bool
+	ForwardUser       *string
+	CompressRequests  *bool
+	StreamUsage       *bool
+	ParallelToolCalls *bool
+	Temperature       *float64
+	// ClearTemperature drops the saved temperature default; it is how a
+	// JSON null reaches the service, since a nil Temperature means unchanged.
+	ClearTemperature bool
+	MaxTokens        *int
+	Headers          *map[string]string
+	TimeoutMS        *int
+	ModelAliases     *map[string]string
+	// AllowUnknownAliasTargets lets a built-in provider's alias point at a
+	// model its catalog does not list yet; the target is then only warned
+	// about. It applies to this request and is not saved.
+	AllowUnknownAliasTargets bool
+	ContextWindows           *map[string]int
 }
 
 func NewService(deps Dependencies) *Service {
@@ -105,6 +120,14 @@ func (s *Service) ConfigureProvider(input ConfigureProviderInput) (domain.Provid
 			Message: "timeout_ms must be >= 0",
 		}
 	}
+	if input.Headers != nil {
+		if err := provider.ValidateHeaderTemplates(*input.Headers); err != nil {
+			return domain.ProviderInfo{}, &ValidationError{
+				Code:    "invalid_provider_config",
+				Message: err.Error(),
+			}
+		}
+	}
 	sanitizedReasoningEffort, reasoningErr := sanitizeReasoningEffort(providerID, input.ReasoningEffort)
 	if reasoningErr != nil {
 		return domain.ProviderInfo{}, &ValidationError{
@@ -113,6 +136,42 @@ func (s *Service) ConfigureProvider(input ConfigureProviderInput) (domain.Provid
 		}
 	}
 
+	sanitizedForwardUser, forwardUserErr := sanitizeForwardUser(providerID, input.ForwardUser)
+	if forwardUserErr != nil {
+		return domain.ProviderInfo{}, &ValidationError{
+			Code:    "invalid_provider_config",
+			Message: forwardUserErr.Error(),
+		}
+	}
+
+	if input.CompressRequests != nil && *input.CompressRequests && provider.ResolveAdapter(providerID) != provider.AdapterOpenAICompatible {
+		return domain.ProviderInfo{}, &ValidationError{
+			Code:    "invalid_provider_config",
+			Message: "compress_requests is only supported for openai-compatible providers",
+		}
+	}
+
+	if input.StreamUsage != nil && *input.StreamUsage && provider.ResolveAdapter(providerID) != provider.AdapterOpenAICompatible {
+		return domain.ProviderInfo{}, &ValidationError{
+			Code:    "invalid_provider_config",
+			Message: "stream_usage is only supported for openai-compatible providers",
+		}
+	}
+
+	if input.ParallelToolCalls != nil && provider.ResolveAdapter(providerID) != provider.AdapterOpenAICompatible {
+		return domain.ProviderInfo{}, &ValidationError{
+			Code:    "invalid_provider_config",
+			Message: "parallel_tool_calls is only supported for openai-compatible providers",
+		}
+	}
+
+	if samplingErr := validateSamplingDefaults(providerID, input.Temperature, input.MaxTokens); samplingErr != nil {
+		return domain.ProviderInfo{}, &ValidationError{
+			Code:    "invalid_provider_config",
+			Message: samplingErr.Error(),
+		}
+	}
+
 	sanitizedAliases, aliasErr := sanitizeModelAliases(input.ModelAliases)
 	if aliasErr != nil {
 		return domain.ProviderInfo{}, &ValidationError{
@@ -120,6 +179,21 @@ func (s *Service) ConfigureProvider(input ConfigureProviderInput) (domain.Provid
 			Message: aliasErr.Error(),
 		}
 	}
+	aliasWarnings, aliasTargetErr := validateModelAliasTargets(providerID, sanitizedAliases, input.AllowUnknownAliasTargets)
+	if aliasTargetErr != nil {
+		return domain.ProviderInfo{}, &ValidationError{
+			Code:    "invalid_provider_config",
+			Message: aliasTargetErr.Error(),
+		}
+	}
+
+	sanitizedContextWindows, contextWindowErr := sanitizeModelContextWindows(input.ContextWindows)
+	if contextWindowErr != nil {
+		return domain.ProviderInfo{}, &ValidationError{
+			Code:    "invalid_provider_config",
+			Message: contextWindowErr.Error(),
+		}
+	}
 
 	var out domain.ProviderInfo
 	if err := s.deps.Store.WriteSettings(func(st *ports.SettingsAggregate) error {
@@ -128,6 +202,9 @@ func (s *Service) ConfigureProvider(input ConfigureProviderInput) (domain.Provid
 		if input.APIKey != nil {
 			setting.APIKey = strings.TrimSpace(*input.APIKey)
 		}
+		if input.APIKeys != nil {
+			setting.APIKeys = sanitizeAPIKeys(*input.APIKeys)
+		}
 		if input.BaseURL != nil {
 			setting.BaseURL = strings.TrimSpace(*input.BaseURL)
 		}
@@ -145,6 +222,28 @@ func (s *Service) ConfigureProvider(input ConfigureProviderInput) (domain.Provid
 			store := *input.Store
 			setting.Store = &store
 		}
+		if input.ForwardUser != nil {
+			setting.ForwardUser = sanitizedForwardUser
+		}
+		if input.CompressRequests != nil {
+			setting.CompressRequests = *input.CompressRequests
+		}
+		if input.StreamUsage != nil {
+			setting.StreamUsage = *input.StreamUsage
+		}
+		if input.ParallelToolCalls != nil {
+			parallel := *input.ParallelToolCalls
+			setting.ParallelToolCalls = &parallel
+		}
+		if input.ClearTemperature {
+			setting.Temperature = nil
+		} else if input.Temperature != nil {
+			temperature := *input.Temperature
+			setting.Temperature = &temperature
+		}
+		if input.MaxTokens != nil {
+			setting.MaxTokens = *input.MaxTokens
+		}
 		if input.Headers != nil {
 			setting.Headers = sanitizeStringMap(*input.Headers)
 		}
@@ -154,8 +253,12 @@ func (s *Service) ConfigureProvider(input ConfigureProviderInput) (domain.Provid
 		if input.ModelAliases != nil {
 			setting.ModelAliases = sanitizedAliases
 		}
+		if input.ContextWindows != nil {
+			setting.ModelContextWindows = sanitizedContextWindows
+		}
 		st.Providers[providerID] = setting
 		out = s.buildProviderInfo(providerID, setting)
+		out.Warnings = aliasWarnings
 		return nil
 	}); err != nil {
 		return domain.ProviderInfo{}, err
@@ -234,9 +337,14 @@ func (s *Service) SetActiveModels(body domain.ModelSlotConfig) (domain.ActiveMod
 		if !ok {
 			return ErrModelNotFound
 		}
+		fallback, err := resolveFallbackSlots(st.Providers, body.Fallback)
+		if err != nil {
+			return err
+		}
 		out = domain.ModelSlotConfig{
 			ProviderID: body.ProviderID,
 			Model:      resolvedModel,
+			Fallback:   fallback,
 		}
 		st.ActiveLLM = out
 		return nil
@@ -246,6 +354,44 @@ func (s *Service) SetActiveModels(body domain.ModelSlotConfig) (domain.ActiveMod
 	return domain.ActiveModelsInfo{ActiveLLM: out}, nil
 }
 
+// resolveFallbackSlots checks that every fallback slot names a configured
+// provider and a model it can resolve. Disabled providers are accepted here and
+// skipped at request time, so a fallback can be switched off without editing
+// the chain.
+func resolveFallbackSlots(providers map[string]repo.ProviderSetting, raw []domain.ModelSlotConfig) ([]domain.ModelSlotConfig, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	out := make([]domain.ModelSlotConfig, 0, len(raw))
+	for i, slot := range raw {
+		providerID := normalizeProviderID(slot.ProviderID)
+		modelID := strings.TrimSpace(slot.Model)
+		if providerID == "" || modelID == "" {
+			return nil, &ValidationError{
+				Code:    "invalid_model_slot",
+				Message: fmt.Sprintf("fallback[%d] requires provider_id and model", i),
+			}
+		}
+		setting, ok := findProviderSettingByID(providers, providerID)
+		if !ok {
+			return nil, &ValidationError{
+				Code:    "invalid_model_slot",
+				Message: fmt.Sprintf("fallback[%d] provider %s not found", i, providerID),
+			}
+		}
+		normalizeProviderSetting(&setting)
+		resolvedModel, ok := provider.ResolveModelID(providerID, modelID, setting.ModelAliases)
+		if !ok {
+			return nil, &ValidationError{
+				Code:    "invalid_model_slot",
+				Message: fmt.Sprintf("fallback[%d] model %s not found for provider %s", i, modelID, providerID),
+			}
+		}
+		out = append(out, domain.ModelSlotConfig{ProviderID: providerID, Model: resolvedModel})
+	}
+	return out, nil
+}
+
 func (s *Service) collectProviderCatalog() ([]domain.ProviderInfo, map[string]string, domain.ModelSlotConfig, error) {
 	if err := s.validateStore(); err != nil {
 		return nil, nil, domain.ModelSlotConfig{}, err
@@ -287,22 +433,30 @@ func (s *Service) buildProviderInfo(providerID string, setting repo.ProviderSett
 	spec := provider.ResolveProvider(providerID)
 	apiKey := s.resolveProviderAPIKey(providerID, setting)
 	return domain.ProviderInfo{
-		ID:                 providerID,
-		Name:               spec.Name,
-		DisplayName:        resolveProviderDisplayName(setting, spec.Name),
-		OpenAICompatible:   provider.ResolveAdapter(providerID) == provider.AdapterOpenAICompatible,
-		APIKeyPrefix:       spec.APIKeyPrefix,
-		Models:             provider.ResolveModels(providerID, setting.ModelAliases),
-		ReasoningEffort:    setting.ReasoningEffort,
-		Store:              providerStoreEnabled(setting),
-		Headers:            sanitizeStringMap(setting.Headers),
-		TimeoutMS:          setting.TimeoutMS,
-		ModelAliases:       sanitizeStringMap(setting.ModelAliases),
-		AllowCustomBaseURL: spec.AllowCustomBaseURL,
-		Enabled:            providerEnabled(setting),
-		HasAPIKey:          strings.TrimSpace(apiKey) != "",
-		CurrentAPIKey:      maskKey(apiKey),
-		CurrentBaseURL:     s.resolveProviderBaseURL(providerID, setting),
+		ID:                  providerID,
+		Name:                spec.Name,
+		DisplayName:         resolveProviderDisplayName(setting, spec.Name),
+		OpenAICompatible:    provider.ResolveAdapter(providerID) == provider.AdapterOpenAICompatible,
+		APIKeyPrefix:        spec.APIKeyPrefix,
+		Models:              provider.ResolveModels(providerID, setting.ModelAliases),
+		ReasoningEffort:     setting.ReasoningEffort,
+		Store:               providerStoreEnabled(setting),
+		ForwardUser:         setting.ForwardUser,
+		CompressRequests:    setting.CompressRequests,
+		StreamUsage:         setting.StreamUsage,
+		ParallelToolCalls:   setting.ParallelToolCalls,
+		Temperature:         setting.Temperature,
+		MaxTokens:           setting.MaxTokens,
+		Headers:             sanitizeStringMap(setting.Headers),
+		TimeoutMS:           setting.TimeoutMS,
+		ModelAliases:        sanitizeStringMap(setting.ModelAliases),
+		ModelContextWindows: cloneContextWindows(setting.ModelContextWindows),
+		AllowCustomBaseURL:  spec.AllowCustomBaseURL,
+		Enabled:             providerEnabled(setting),
+		HasAPIKey:           strings.TrimSpace(apiKey) != "",
+		CurrentAPIKey:       maskKey(apiKey),
+		CurrentAPIKeys:      MaskAPIKeys(setting),
+		CurrentBaseURL:      s.resolveProviderBaseURL(providerID, setting),
 	}
 }
 
@@ -310,6 +464,9 @@ func (s *Service) resolveProviderAPIKey(providerID string, setting repo.Provider
 	if key := strings.TrimSpace(setting.APIKey); key != "" {
 		return key
 	}
+	if keys := sanitizeAPIKeys(setting.APIKeys); len(keys) > 0 {
+		return keys[0]
+	}
 	return strings.TrimSpace(s.deps.EnvLookup(providerEnvPrefix(providerID) + "_API_KEY"))
 }
 
@@ -367,6 +524,7 @@ func normalizeProviderSetting(setting *repo.ProviderSetting) {
 	setting.APIKey = strings.TrimSpace(setting.APIKey)
 	setting.BaseURL = strings.TrimSpace(setting.BaseURL)
 	setting.ReasoningEffort = normalizeReasoningEffort(strings.TrimSpace(setting.ReasoningEffort))
+	setting.ForwardUser = strings.ToLower(strings.TrimSpace(setting.ForwardUser))
 	if setting.Enabled == nil {
 		enabled := true
 		setting.Enabled = &enabled
@@ -408,6 +566,108 @@ func sanitizeModelAliases(raw *map[string]string) (map[string]string, error) {
 	return out, nil
 }
 
+// validateModelAliasTargets rejects aliases whose target is not in a built-in
+// provider's catalog, which catches typos at config time. allowUnknown turns
+// that into a warning for models newer than the catalog. Custom providers
+// have no catalog, so their targets only produce warnings.
+func validateModelAliasTargets(providerID string, aliases map[string]string, allowUnknown bool) ([]string, error) {
+	if len(aliases) == 0 {
+		return nil, nil
+	}
+	known := map[string]struct{}{}
+	for _, model := range provider.ResolveModels(providerID, nil) {
+		known[model.ID] = struct{}{}
+	}
+	keys := make([]string, 0, len(aliases))
+	for alias := range aliases {
+		keys = append(keys, alias)
+	}
+	sort.Strings(keys)
+	builtin := provider.IsBuiltinProviderID(providerID)
+	var warnings []string
+	for _, alias := range keys {
+		target := aliases[alias]
+		if _, ok := known[target]; ok {
+			continue
+		}
+		if builtin {
+			if !allowUnknown {
+				return nil, fmt.Errorf("model_aliases[%s] target %q is not in the model catalog of provider %s", alias, target, providerID)
+			}
+			warnings = append(warnings, fmt.Sprintf("model_aliases[%s] target %q is not in the model catalog of provider %s", alias, target, providerID))
+			continue
+		}
+		warnings = append(warnings, fmt.Sprintf("model_aliases[%s] target %q cannot be verified against a model catalog", alias, target))
+	}
+	return warnings, nil
+}
+
+// sanitizeAPIKeys trims the rotation keys and drops blanks and duplicates.
+func sanitizeAPIKeys(raw []string) []string {
+	seen := map[string]struct{}{}
+	out := make([]string, 0, len(raw))
+	for _, item := range raw {
+		key := strings.TrimSpace(item)
+		if key == "" {
+			continue
+		}
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		out = append(out, key)
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// ProviderAPIKeys lists api_key followed by api_keys, without blanks or
+// duplicates. These are the keys a provider's requests rotate through.
+func ProviderAPIKeys(setting repo.ProviderSetting) []string {
+	return sanitizeAPIKeys(append([]string{setting.APIKey}, setting.APIKeys...))
+}
+
+// MaskAPIKeys masks api_key and every api_keys entry for provider listings.
+func MaskAPIKeys(setting repo.ProviderSetting) []string {
+	keys := ProviderAPIKeys(setting)
+	if len(keys) == 0 {
+		return nil
+	}
+	out := make([]string, 0, len(keys))
+	for _, key := range keys {
+		out = append(out, maskKey(key))
+	}
+	return out
+}
+
+func sanitizeModelContextWindows(raw *map[string]int) (map[string]int, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	out := map[string]int{}
+	for key, value := range *raw {
+		modelID := strings.TrimSpace(key)
+		if modelID == "" || value <= 0 {
+			return nil, errors.New("model_context_windows requires non-empty model id and positive token count")
+		}
+		out[modelID] = value
+	}
+	return out, nil
+}
+
+func cloneContextWindows(in map[string]int) map[string]int {
+	if len(in) == 0 {
+		return nil
+	}
+	out := make(map[string]int, len(in))
+	for key, value := range in {
+		out[key] = value
+	}
+	return out
+}
+
 var allowedReasoningEfforts = map[string]struct{}{
 	"minimal": {},
 	"low":     {},
@@ -437,6 +697,53 @@ func providerSupportsReasoningEffort(providerID string) bool {
 	return adapter == provider.AdapterOpenAICompatible || adapter == provider.AdapterCodexCompatible
 }
 
+const (
+	ForwardUserRaw    = "raw"
+	ForwardUserHashed = "hashed"
+)
+
+// validateSamplingDefaults checks the provider-level temperature (0-2) and
+// max_tokens (0 clears it) defaults. Only openai-compatible providers send a
+// temperature; anthropic providers also take max_tokens.
+func validateSamplingDefaults(providerID string, temperature *float64, maxTokens *int) error {
+	if temperature == nil && maxTokens == nil {
+		return nil
+	}
+	if temperature != nil && (*temperature < 0 || *temperature > 2) {
+		return errors.New("temperature must be between 0 and 2")
+	}
+	if maxTokens != nil && *maxTokens < 0 {
+		return errors.New("max_tokens must be >= 0")
+	}
+	adapter := provider.ResolveAdapter(providerID)
+	if temperature != nil && adapter != provider.AdapterOpenAICompatible {
+		return errors.New("temperature is only supported for openai-compatible providers")
+	}
+	if maxTokens != nil && adapter != provider.AdapterOpenAICompatible && adapter != provider.AdapterAnthropic {
+		return errors.New("max_tokens is only supported for openai-compatible and anthropic providers")
+	}
+	return nil
+}
+
+// sanitizeForwardUser validates forward_user; "off" and "" both disable forwarding.
+func sanitizeForwardUser(providerID string, raw *string) (string, error) {
+	if raw == nil {
+		return "", nil
+	}
+	mode := strings.ToLower(strings.TrimSpace(*raw))
+	switch mode {
+	case "", "off":
+		return "", nil
+	case ForwardUserRaw, ForwardUserHashed:
+	default:
+		return "", errors.New("forward_user must be one of: off, raw, hashed")
+	}
+	if provider.ResolveAdapter(providerID) != provider.AdapterOpenAICompatible {
+		return "", errors.New("forward_user is only supported for openai-compatible providers")
+	}
+	return mode, nil
+}
+
 func normalizeReasoningEffort(raw string) string {
 	return strings.ToLower(strings.TrimSpace(raw))
 }
@@ -3,6 +3,7 @@ package model
 import (
 	"errors"
 	"os"
+	"strings"
 	"testing"
 
 	"nextai/apps/gateway/internal/domain"
@@ -215,3 +216,59 @@ func newTestStore(t *testing.T) *repo.Store {
 	}
 	return store
 }
+
+func TestConfigureProviderValidatesModelAliasTargets(t *testing.T) {
+	t.Parallel()
+
+	store := newTestStore(t)
+	svc := NewService(Dependencies{Store: adapters.NewRepoStateStore(store)})
+
+	typo := map[string]string{"fast": "gpt-4o-minii"}
+	_, err := svc.ConfigureProvider(ConfigureProviderInput{
+		ProviderID:   "openai",
+		ModelAliases: &typo,
+	})
+	validation := (*ValidationError)(nil)
+	if !errors.As(err, &validation) {
+		t.Fatalf("expected validation error, got=%v", err)
+	}
+	if validation.Code != "invalid_provider_config" || !strings.Contains(validation.Message, "model_aliases[fast]") {
+		t.Fatalf("unexpected validation error: %s %s", validation.Code, validation.Message)
+	}
+
+	out, err := svc.ConfigureProvider(ConfigureProviderInput{
+		ProviderID:               "openai",
+		ModelAliases:             &typo,
+		AllowUnknownAliasTargets: true,
+	})
+	if err != nil {
+		t.Fatalf("allow_unknown_alias_targets should save the alias, got=%v", err)
+	}
+	if len(out.Warnings) != 1 || !strings.Contains(out.Warnings[0], "model_aliases[fast]") || !strings.Contains(out.Warnings[0], "model catalog of provider openai") {
+		t.Fatalf("expected one alias warning for the built-in provider, got=%v", out.Warnings)
+	}
+
+	valid := map[string]string{"fast": "gpt-4o-mini"}
+	out, err = svc.ConfigureProvider(ConfigureProviderInput{
+		ProviderID:   "openai",
+		ModelAliases: &valid,
+	})
+	if err != nil {
+		t.Fatalf("configure valid alias failed: %v", err)
+	}
+	if len(out.Warnings) != 0 {
+		t.Fatalf("expected no warnings for a known target, got=%v", out.Warnings)
+	}
+
+	custom := map[string]string{"fast": "my-local-model"}
+	out, err = svc.ConfigureProvider(ConfigureProviderInput{
+		ProviderID:   "custom-llm",
+		ModelAliases: &custom,
+	})
+	if err != nil {
+		t.Fatalf("custom provider alias should only warn, got=%v", err)
+	}
+	if len(out.Warnings) != 1 || !strings.Contains(out.Warnings[0], "model_aliases[fast]") {
+		t.Fatalf("expected one alias warning for custom provider, got=%v", out.Warnings)
+	}
+}
@@ -965,6 +965,11 @@ func decodeProviderSettings(raw interface{}) (map[string]repo.ProviderSetting, e
 		}
 		setting.Headers = sanitizeStringMap(setting.Headers)
 		setting.ModelAliases = sanitizeStringMap(setting.ModelAliases)
+		for modelID, window := range setting.ModelContextWindows {
+			if strings.TrimSpace(modelID) == "" || window <= 0 {
+				return nil, fmt.Errorf("provider %q model_context_windows requires non-empty model id and positive token count", rawID)
+			}
+		}
 		out[id] = setting
 	}
 	return out, nil
@@ -0,0 +1,226 @@
+package workspace
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	diffContextLines = 3
+	// diffMaxCells bounds the LCS table; larger inputs are shown as a full
+	// replacement instead of a minimal diff.
+	diffMaxCells = 4_000_000
+)
+
+type FileDiff struct {
+	Path    string `json:"path"`
+	Changed bool   `json:"changed"`
+	Diff    string `json:"diff"`
+}
+
+// DiffFile compares the body a PUT would send against the stored file. Config
+// and skill JSON are pretty-printed on both sides so only real changes show;
+// text files are diffed line by line. A missing file diffs against empty.
+func (s *Service) DiffFile(filePath string, body []byte) (FileDiff, error) {
+	if err := s.validateStore(); err != nil {
+		return FileDiff{}, err
+	}
+
+	var before, after string
+	if s.isTextFilePath(filePath) {
+		var req struct {
+			Content string `json:"content"`
+		}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return FileDiff{}, &ValidationError{
+				Code:    "invalid_json",
+				Message: "invalid request body",
+			}
+		}
+		after = req.Content
+		current, err := s.GetFile(filePath)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return FileDiff{}, err
+		}
+		if content, ok := current.(map[string]string); ok {
+			before = content["content"]
+		}
+	} else {
+		if _, isSkill := workspaceSkillNameFromPath(filePath); !isSkill && !s.isWorkspaceConfigFile(filePath) {
+			return FileDiff{}, ErrNotFound
+		}
+		var next interface{}
+		if err := json.Unmarshal(body, &next); err != nil {
+			return FileDiff{}, &ValidationError{
+				Code:    "invalid_json",
+				Message: "invalid request body",
+			}
+		}
+		after = prettyWorkspaceJSON(next)
+		current, err := s.GetFile(filePath)
+		switch {
+		case err == nil:
+			before = prettyWorkspaceJSON(current)
+		case !errors.Is(err, ErrNotFound):
+			return FileDiff{}, err
+		}
+	}
+
+	diff := unifiedLineDiff(filePath, before, after)
+	return FileDiff{Path: filePath, Changed: diff != "", Diff: diff}, nil
+}
+
+// prettyWorkspaceJSON round-trips through a generic value so struct field
+// order and map key order render identically on both sides.
+func prettyWorkspaceJSON(value interface{}) string {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+	var generic interface{}
+	if err := json.Unmarshal(raw, &generic); err != nil {
+		return ""
+	}
+	out, err := json.MarshalIndent(generic, "", "  ")
+	if err != nil {
+		return ""
+	}
+	return string(out) + "\n"
+}
+
+type diffLine struct {
+	op   byte
+	text string
+}
+
+func splitDiffLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// unifiedLineDiff renders a unified diff with diffContextLines of context, or
+// "" when the texts are equal.
+func unifiedLineDiff(path, before, after string) string {
+	if before == after {
+		return ""
+	}
+	lines := diffLines(splitDiffLines(before), splitDiffLines(after))
+
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("--- a/%s\n+++ b/%s\n", path, path))
+	for start := 0; start < len(lines); {
+		first := start
+		for first < len(lines) && lines[first].op == ' ' {
+			first++
+		}
+		if first == len(lines) {
+			break
+		}
+		// Extend the hunk while the next change is close enough that the
+		// context windows would touch.
+		last := first
+		for idx := first + 1; idx < len(lines); idx++ {
+			if lines[idx].op == ' ' {
+				continue
+			}
+			if idx-last > 2*diffContextLines {
+				break
+			}
+			last = idx
+		}
+		from := max(first-diffContextLines, start)
+		to := min(last+diffContextLines+1, len(lines))
+		writeDiffHunk(&builder, lines, from, to)
+		start = to
+	}
+	return strings.TrimRight(builder.String(), "\n")
+}
+
+func writeDiffHunk(builder *strings.Builder, lines []diffLine, from, to int) {
+	oldLine, newLine := 1, 1
+	for _, line := range lines[:from] {
+		if line.op != '+' {
+			oldLine++
+		}
+		if line.op != '-' {
+			newLine++
+		}
+	}
+	oldCount, newCount := 0, 0
+	for _, line := range lines[from:to] {
+		if line.op != '+' {
+			oldCount++
+		}
+		if line.op != '-' {
+			newCount++
+		}
+	}
+	if oldCount == 0 {
+		oldLine--
+	}
+	if newCount == 0 {
+		newLine--
+	}
+	builder.WriteString(fmt.Sprintf("@@ -%d,%d +%d,%d @@\n", oldLine, oldCount, newLine, newCount))
+	for _, line := range lines[from:to] {
+		builder.WriteByte(line.op)
+		builder.WriteString(line.text)
+		builder.WriteByte('\n')
+	}
+}
+
+// diffLines builds an edit script from the longest common subsequence.
+func diffLines(a, b []string) []diffLine {
+	out := make([]diffLine, 0, len(a)+len(b))
+	if (len(a)+1)*(len(b)+1) > diffMaxCells {
+		for _, text := range a {
+			out = append(out, diffLine{op: '-', text: text})
+		}
+		for _, text := range b {
+			out = append(out, diffLine{op: '+', text: text})
+		}
+		return out
+	}
+
+	// lcs[i][j] is the LCS length of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			out = append(out, diffLine{op: ' ', text: a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			out = append(out, diffLine{op: '-', text: a[i]})
+			i++
+		default:
+			out = append(out, diffLine{op: '+', text: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		out = append(out, diffLine{op: '-', text: a[i]})
+	}
+	for ; j < len(b); j++ {
+		out = append(out, diffLine{op: '+', text: b[j]})
+	}
+	return out
+}
@@ -6,8 +6,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"sort"
 	"strings"
+	"time"
 
 	"nextai/apps/gateway/internal/domain"
 	"nextai/apps/gateway/internal/repo"
@@ -86,6 +88,22 @@ type ImportRequest struct {
 	Payload ExportPayload `json:"payload"`
 }
 
+// ImportChangeCounts summarizes how one section of the workspace would change.
+type ImportChangeCounts struct {
+	Added   int `json:"added"`
+	Removed int `json:"removed"`
+	Changed int `json:"changed"`
+}
+
+type ImportReport struct {
+	Valid            bool               `json:"valid"`
+	Skills           ImportChangeCounts `json:"skills"`
+	Envs             ImportChangeCounts `json:"envs"`
+	Channels         ImportChangeCounts `json:"channels"`
+	Providers        ImportChangeCounts `json:"providers"`
+	ActiveLLMChanged bool               `json:"active_llm_changed"`
+}
+
 type Dependencies struct {
 	Store             ports.StateStore
 	DataDir           string
@@ -330,8 +348,13 @@ func (s *Service) PutFile(filePath string, body []byte) error {
 		References: safeMap(req.References),
 		Scripts:    safeMap(req.Scripts),
 		Enabled:    req.Enabled,
+		UpdatedAt:  nowISO(),
 	}
 	return s.deps.Store.WriteSettings(func(st *ports.SettingsAggregate) error {
+		spec.CreatedAt = spec.UpdatedAt
+		if existing, ok := st.Skills[name]; ok && existing.CreatedAt != "" {
+			spec.CreatedAt = existing.CreatedAt
+		}
 		st.Skills[name] = spec
 		return nil
 	})
@@ -394,19 +417,60 @@ func (s *Service) Export() (ExportPayload, error) {
 }
 
 func (s *Service) Import(body []byte) error {
-	if err := s.validateStore(); err != nil {
+	next, err := s.prepareImport(body)
+	if err != nil {
 		return err
 	}
+	return s.deps.Store.WriteSettings(func(st *ports.SettingsAggregate) error {
+		st.Skills = next.skills
+		st.Envs = next.envs
+		st.Channels = next.channels
+		st.Providers = next.providers
+		st.ActiveLLM = next.activeLLM
+		return nil
+	})
+}
+
+// ValidateImport runs the same checks as Import and reports what a replace
+// import would change, without writing anything.
+func (s *Service) ValidateImport(body []byte) (ImportReport, error) {
+	next, err := s.prepareImport(body)
+	if err != nil {
+		return ImportReport{}, err
+	}
+	report := ImportReport{Valid: true}
+	s.deps.Store.ReadSettings(func(st ports.SettingsAggregate) {
+		report.Skills = diffWorkspaceMap(st.Skills, next.skills)
+		report.Envs = diffWorkspaceMap(st.Envs, next.envs)
+		report.Channels = diffWorkspaceMap(st.Channels, next.channels)
+		report.Providers = diffWorkspaceMap(st.Providers, next.providers)
+		report.ActiveLLMChanged = !reflect.DeepEqual(st.ActiveLLM, next.activeLLM)
+	})
+	return report, nil
+}
+
+type workspaceImportState struct {
+	skills    map[string]domain.SkillSpec
+	envs      map[string]string
+	channels  domain.ChannelConfigMap
+	providers map[string]repo.ProviderSetting
+	activeLLM domain.ModelSlotConfig
+}
+
+func (s *Service) prepareImport(body []byte) (workspaceImportState, error) {
+	if err := s.validateStore(); err != nil {
+		return workspaceImportState{}, err
+	}
 
 	var req ImportRequest
 	if err := json.Unmarshal(body, &req); err != nil {
-		return &ValidationError{
+		return workspaceImportState{}, &ValidationError{
 			Code:    "invalid_json",
 			Message: "invalid request body",
 		}
 	}
 	if strings.ToLower(strings.TrimSpace(req.Mode)) != "replace" {
-		return &ValidationError{
+		return workspaceImportState{}, &ValidationError{
 			Code:    "invalid_import_mode",
 			Message: "mode must be replace",
 		}
@@ -414,48 +478,67 @@ func (s *Service) Import(body []byte) error {
 
 	skills, err := normalizeWorkspaceSkills(req.Payload.Skills, s.deps.DataDir)
 	if err != nil {
-		return &ValidationError{
+		return workspaceImportState{}, &ValidationError{
 			Code:    "invalid_skill",
 			Message: err.Error(),
 		}
 	}
 	envs, err := normalizeWorkspaceEnvs(req.Payload.Config.Envs)
 	if err != nil {
-		return &ValidationError{
+		return workspaceImportState{}, &ValidationError{
 			Code:    "invalid_env_key",
 			Message: err.Error(),
 		}
 	}
 	channels, err := s.normalizeWorkspaceChannels(req.Payload.Config.Channels)
 	if err != nil {
-		return &ValidationError{
+		return workspaceImportState{}, &ValidationError{
 			Code:    "channel_not_supported",
 			Message: err.Error(),
 		}
 	}
 	providers, err := normalizeWorkspaceProviders(req.Payload.Config.Models.Providers)
 	if err != nil {
-		return &ValidationError{
+		return workspaceImportState{}, &ValidationError{
 			Code:    "invalid_provider_config",
 			Message: err.Error(),
 		}
 	}
 	active, err := normalizeWorkspaceActiveLLM(req.Payload.Config.Models.ActiveLLM, providers)
 	if err != nil {
-		return &ValidationError{
+		return workspaceImportState{}, &ValidationError{
 			Code:    "invalid_model_slot",
 			Message: err.Error(),
 		}
 	}
+	return workspaceImportState{
+		skills:    skills,
+		envs:      envs,
+		channels:  channels,
+		providers: providers,
+		activeLLM: active,
+	}, nil
+}
 
-	return s.deps.Store.WriteSettings(func(st *ports.SettingsAggregate) error {
-		st.Skills = skills
-		st.Envs = envs
-		st.Channels = channels
-		st.Providers = providers
-		st.ActiveLLM = active
-		return nil
-	})
+// diffWorkspaceMap counts keys a replace would add, remove, or overwrite with
+// a different value.
+func diffWorkspaceMap[V any](current, next map[string]V) ImportChangeCounts {
+	out := ImportChangeCounts{}
+	for key, value := range next {
+		existing, ok := current[key]
+		switch {
+		case !ok:
+			out.Added++
+		case !reflect.DeepEqual(existing, value):
+			out.Changed++
+		}
+	}
+	for key := range current {
+		if _, ok := next[key]; !ok {
+			out.Removed++
+		}
+	}
+	return out
 }
 
 func (s *Service) validateStore() error {
@@ -607,8 +690,11 @@ func normalizeWorkspaceProviders(in map[string]repo.ProviderSetting) (map[string
 	return out, nil
 }
 
+// normalizeWorkspaceSkills keeps imported timestamps and stamps skills that
+// have none with the import time.
 func normalizeWorkspaceSkills(in map[string]domain.SkillSpec, dataDir string) (map[string]domain.SkillSpec, error) {
 	out := map[string]domain.SkillSpec{}
+	now := nowISO()
 	for rawName, rawSpec := range in {
 		name := strings.TrimSpace(rawName)
 		if name == "" {
@@ -622,6 +708,14 @@ func normalizeWorkspaceSkills(in map[string]domain.SkillSpec, dataDir string) (m
 		if source == "" {
 			source = "customized"
 		}
+		createdAt := strings.TrimSpace(rawSpec.CreatedAt)
+		if createdAt == "" {
+			createdAt = now
+		}
+		updatedAt := strings.TrimSpace(rawSpec.UpdatedAt)
+		if updatedAt == "" {
+			updatedAt = now
+		}
 		out[name] = domain.SkillSpec{
 			Name:       name,
 			Content:    rawSpec.Content,
@@ -630,6 +724,8 @@ func normalizeWorkspaceSkills(in map[string]domain.SkillSpec, dataDir string) (m
 			References: safeMap(rawSpec.References),
 			Scripts:    safeMap(rawSpec.Scripts),
 			Enabled:    rawSpec.Enabled,
+			CreatedAt:  createdAt,
+			UpdatedAt:  updatedAt,
 		}
 	}
 	return out, nil
@@ -707,6 +803,8 @@ func cloneWorkspaceSkill(in domain.SkillSpec) domain.SkillSpec {
 		References: cloneWorkspaceJSONMap(in.References),
 		Scripts:    cloneWorkspaceJSONMap(in.Scripts),
 		Enabled:    in.Enabled,
+		CreatedAt:  in.CreatedAt,
+		UpdatedAt:  in.UpdatedAt,
 	}
 }
 
@@ -794,3 +892,7 @@ func safeMap(v map[string]interface{}) map[string]interface{} {
 	}
 	return v
 }
+
+func nowISO() string {
+	return time.Now().UTC().Format(time.RFC3339)
+}
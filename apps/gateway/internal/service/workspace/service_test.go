@@ -63,6 +63,41 @@ func TestImportRejectsInvalidMode(t *testing.T) {
 	}
 }
 
+func TestValidateImportReportsChangesWithoutWriting(t *testing.T) {
+	t.Parallel()
+
+	svc := newTestService(t, Dependencies{})
+	if err := svc.PutFile(FileEnvs, []byte(`{"FOO":"1","BAR":"2","KEEP":"x"}`)); err != nil {
+		t.Fatalf("put envs failed: %v", err)
+	}
+
+	report, err := svc.ValidateImport([]byte(`{"mode":"replace","payload":{"version":"v1","config":{"envs":{"FOO":"1","BAR":"changed","BAZ":"3"}}}}`))
+	if err != nil {
+		t.Fatalf("validate import failed: %v", err)
+	}
+	if !report.Valid {
+		t.Fatalf("expected valid report: %+v", report)
+	}
+	if report.Envs != (ImportChangeCounts{Added: 1, Removed: 1, Changed: 1}) {
+		t.Fatalf("unexpected env changes: %+v", report.Envs)
+	}
+
+	data, err := svc.GetFile(FileEnvs)
+	if err != nil {
+		t.Fatalf("get envs failed: %v", err)
+	}
+	envs, ok := data.(map[string]string)
+	if !ok || envs["BAR"] != "2" || envs["KEEP"] != "x" {
+		t.Fatalf("validate import must not write, got envs=%#v", data)
+	}
+
+	_, err = svc.ValidateImport([]byte(`{"mode":"replace","payload":{"version":"v1","config":{"envs":{" ":"1"}}}}`))
+	validation := (*ValidationError)(nil)
+	if !errors.As(err, &validation) || validation.Code != "invalid_env_key" {
+		t.Fatalf("expected invalid_env_key validation error, got=%v", err)
+	}
+}
+
 func TestGetTextFileNotFound(t *testing.T) {
 	t.Parallel()
 
@@ -139,3 +174,77 @@ func newTestStore(t *testing.T) (*repo.Store, string) {
 	}
 	return store, dir
 }
+
+func TestDiffFileTextUsesLineDiff(t *testing.T) {
+	t.Parallel()
+
+	current := "# Guide\none\ntwo\nthree\nfour\nfive\nsix\nseven\n"
+	svc := newTestService(t, Dependencies{
+		IsTextFilePath: func(path string) bool {
+			return path == "docs/AI/AGENTS.md"
+		},
+		ReadTextFile: func(path string) (string, string, error) {
+			return path, current, nil
+		},
+	})
+	body := `{"content":"# Guide\none\ntwo\nthree\nFOUR\nfive\nsix\nseven\neight\n"}`
+	result, err := svc.DiffFile("docs/AI/AGENTS.md", []byte(body))
+	if err != nil {
+		t.Fatalf("diff failed: %v", err)
+	}
+	want := "--- a/docs/AI/AGENTS.md\n" +
+		"+++ b/docs/AI/AGENTS.md\n" +
+		"@@ -2,7 +2,8 @@\n" +
+		" one\n" +
+		" two\n" +
+		" three\n" +
+		"-four\n" +
+		"+FOUR\n" +
+		" five\n" +
+		" six\n" +
+		" seven\n" +
+		"+eight"
+	if !result.Changed || result.Diff != want {
+		t.Fatalf("unexpected diff:\n%s\nwant:\n%s", result.Diff, want)
+	}
+
+	same, err := svc.DiffFile("docs/AI/AGENTS.md", []byte(`{"content":"# Guide\none\ntwo\nthree\nfour\nfive\nsix\nseven\n"}`))
+	if err != nil {
+		t.Fatalf("diff failed: %v", err)
+	}
+	if same.Changed || same.Diff != "" {
+		t.Fatalf("expected no diff, got %+v", same)
+	}
+}
+
+func TestDiffFileConfigPrettyPrintsBothSides(t *testing.T) {
+	t.Parallel()
+
+	svc := newTestService(t, Dependencies{})
+	if err := svc.PutFile(FileEnvs, []byte(`{"A":"1","B":"2"}`)); err != nil {
+		t.Fatalf("put envs failed: %v", err)
+	}
+	result, err := svc.DiffFile(FileEnvs, []byte(`{"B":"2","A":"1","C":"3"}`))
+	if err != nil {
+		t.Fatalf("diff failed: %v", err)
+	}
+	want := "--- a/config/envs.json\n" +
+		"+++ b/config/envs.json\n" +
+		"@@ -1,4 +1,5 @@\n" +
+		" {\n" +
+		"   \"A\": \"1\",\n" +
+		"-  \"B\": \"2\"\n" +
+		"+  \"B\": \"2\",\n" +
+		"+  \"C\": \"3\"\n" +
+		" }"
+	if result.Diff != want {
+		t.Fatalf("unexpected diff:\n%s\nwant:\n%s", result.Diff, want)
+	}
+
+	if _, err := svc.DiffFile(FileEnvs, []byte(`{`)); err == nil {
+		t.Fatal("expected invalid json error")
+	}
+	if _, err := svc.DiffFile("config/unknown.json", []byte(`{}`)); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got=%v", err)
+	}
+}
@@ -123,6 +123,22 @@ export interface ProviderInfo {
   current_base_url?: string;
 }
 
+export interface ProviderRemoteModels {
+  provider_id: string;
+  source: "remote" | "catalog";
+  models: ModelInfo[];
+  error?: string;
+  fetched_at: string;
+}
+
+export interface ProviderTestResult {
+  ok: boolean;
+  provider_id: string;
+  model: string;
+  latency_ms: number;
+  model_sample: string;
+}
+
 export interface ProviderTypeInfo {
   id: string;
   display_name: string;
@@ -137,6 +153,7 @@ export interface ComposerModelOption {
 export interface ModelSlotConfig {
   provider_id: string;
   model: string;
+  fallback?: ModelSlotConfig[];
 }
 
 export interface ModelCatalogInfo {
@@ -169,12 +186,14 @@ export interface QQChannelConfig {
 
 export type CronModalMode = "create" | "edit";
 export type CronWorkflowNodeType = "start" | "text_event" | "delay" | "if_event";
-export type CronTaskType = "text" | "workflow";
+export type CronTaskType = "text" | "workflow" | "tool";
 
 export interface CronScheduleSpec {
   type: string;
   cron: string;
   timezone?: string;
+  catch_up?: "skip" | "fire_once";
+  jitter_seconds?: number;
 }
 
 export interface CronDispatchTarget {
@@ -194,6 +213,7 @@ export interface CronRuntimeSpec {
   max_concurrency?: number;
   timeout_seconds?: number;
   misfire_grace_seconds?: number;
+  align_to_last_run?: boolean;
 }
 
 export interface CronWorkflowViewport {
@@ -220,6 +240,11 @@ export interface CronWorkflowEdge {
   target: string;
 }
 
+export interface CronToolTask {
+  name: string;
+  input?: Record<string, unknown>;
+}
+
 export interface CronWorkflowSpec {
   version: "v1";
   viewport?: CronWorkflowViewport;
@@ -253,6 +278,7 @@ export interface CronJobSpec {
   task_type: CronTaskType;
   text?: string;
   workflow?: CronWorkflowSpec;
+  tool?: CronToolTask;
   dispatch: CronDispatchSpec;
   runtime: CronRuntimeSpec;
   meta?: Record<string, unknown>;
@@ -267,6 +293,40 @@ export interface CronJobState {
   last_result?: string;
   last_workflow?: CronWorkflowExecution;
   last_execution?: CronWorkflowExecution;
+  runs?: CronRunRecord[];
+}
+
+export interface CronSchedulePreview {
+  timezone: string;
+  runs: Array<{ utc: string; local: string }>;
+}
+
+export interface CronOverviewItem {
+  spec: CronJobSpec;
+  state: CronJobState;
+  running_leases: number;
+  is_due_soon: boolean;
+}
+
+export interface CronOverview {
+  jobs: CronOverviewItem[];
+  running_leases: number;
+  generated_at: string;
+}
+
+export interface CronJobActivation {
+  job_id: string;
+  enabled: boolean;
+  paused: boolean;
+  scheduled: boolean;
+  next_run_at?: string;
+}
+
+export interface CronRunRecord {
+  started_at: string;
+  finished_at: string;
+  status: string;
+  error?: string;
 }
 
 export type WorkspaceEditorMode = "json" | "text";
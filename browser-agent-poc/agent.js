@@ -427,6 +427,7 @@ async function main() {
         "screenshot_failed",
         "截图失败"
       );
+      console.log(`screenshot: ${targetPath}`);
       return { screenshot_path: targetPath };
     },
     scroll: async ({ x, y }) => {
@@ -515,6 +516,7 @@ async function main() {
       const screenshotPath = path.join(SHOT_DIR, `${runId}-step${step}-error.png`);
       try {
         await page.screenshot({ path: screenshotPath, fullPage: true });
+        console.log(`screenshot: ${screenshotPath}`);
       } catch (_screenshotErr) {
         // ignore screenshot errors while handling primary failure
       }
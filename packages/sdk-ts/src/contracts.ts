@@ -12,6 +12,9 @@ export interface ChatSpec {
 export interface RuntimeContent {
   type?: string;
   text?: string;
+  image_url?: string;
+  data?: string;
+  mime_type?: string;
 }
 
 export interface RuntimeMessage {
@@ -34,10 +37,17 @@ export interface AgentToolResultPayload {
   name?: string;
   ok?: boolean;
   summary?: string;
+  duration_ms?: number;
   output?: string;
   input?: Record<string, unknown>;
 }
 
+export interface AgentUsage {
+  prompt_tokens: number;
+  completion_tokens: number;
+  total_tokens: number;
+}
+
 export interface AgentStreamEventMeta {
   code?: string;
   message?: string;
@@ -49,9 +59,11 @@ export interface AgentStreamEvent {
   step?: number;
   delta?: string;
   reply?: string;
+  stop_reason?: "normal" | "length" | "max_steps" | "timeout" | "cancelled";
   raw?: string;
   tool_call?: AgentToolCallPayload;
   tool_result?: AgentToolResultPayload;
+  usage?: AgentUsage;
   meta?: AgentStreamEventMeta;
 }
 
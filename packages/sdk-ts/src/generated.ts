@@ -4,10 +4,17 @@
 
 export const OPENAPI_VERSION = "3.0.3" as const;
 
-export type APIPath = "/agent/process" | "/agent/self/config-mutations/apply" | "/agent/self/config-mutations/preview" | "/agent/self/sessions/{session_id}/model" | "/agent/self/sessions/bootstrap" | "/agent/system-layers" | "/agent/tool-input-answer" | "/channels/qq/inbound" | "/channels/qq/state" | "/chats" | "/chats/{chat_id}" | "/chats/batch-delete" | "/config/channels" | "/config/channels/{channel_name}" | "/config/channels/types" | "/cron/jobs" | "/cron/jobs/{job_id}" | "/cron/jobs/{job_id}/pause" | "/cron/jobs/{job_id}/resume" | "/cron/jobs/{job_id}/run" | "/cron/jobs/{job_id}/state" | "/envs" | "/envs/{key}" | "/healthz" | "/models" | "/models/{provider_id}" | "/models/{provider_id}/config" | "/models/active" | "/models/catalog" | "/runtime-config" | "/skills" | "/skills/{skill_name}" | "/skills/{skill_name}/disable" | "/skills/{skill_name}/enable" | "/skills/{skill_name}/files/{source}/{file_path}" | "/skills/available" | "/skills/batch-disable" | "/skills/batch-enable" | "/version" | "/workspace/export" | "/workspace/files" | "/workspace/files/{file_path}" | "/workspace/import" | "/workspace/uploads";
+export type APIPath = "/admin/runs" | "/admin/runs/cancel" | "/admin/stats" | "/agent/process" | "/agent/runs/{run_id}/approve" | "/agent/runs/{run_id}/cancel" | "/agent/runs/{run_id}/events" | "/agent/runs/{run_id}/reject" | "/agent/self/config-mutations/apply" | "/agent/self/config-mutations/preview" | "/agent/self/sessions/{session_id}/model" | "/agent/self/sessions/bootstrap" | "/agent/system-layers" | "/agent/tool-input-answer" | "/channels/qq/inbound" | "/channels/qq/state" | "/chats" | "/chats/{chat_id}" | "/chats/{chat_id}/archive" | "/chats/{chat_id}/meta" | "/chats/{chat_id}/restore" | "/chats/{chat_id}/summarize" | "/chats/{chat_id}/unarchive" | "/chats/batch-delete" | "/config/channels" | "/config/channels/{channel_name}" | "/config/channels/{channel_name}/capabilities" | "/config/channels/types" | "/config/tools/disabled" | "/cron/jobs" | "/cron/jobs/{job_id}" | "/cron/jobs/{job_id}/disable" | "/cron/jobs/{job_id}/enable" | "/cron/jobs/{job_id}/history" | "/cron/jobs/{job_id}/pause" | "/cron/jobs/{job_id}/resume" | "/cron/jobs/{job_id}/run" | "/cron/jobs/{job_id}/run-sync" | "/cron/jobs/{job_id}/state" | "/cron/jobs/batch" | "/cron/jobs/validate" | "/cron/leases/reap" | "/cron/overview" | "/cron/preview" | "/envs" | "/envs/{key}" | "/envs/export" | "/healthz" | "/metrics" | "/models" | "/models/{provider_id}" | "/models/{provider_id}/config" | "/models/{provider_id}/remote-models" | "/models/{provider_id}/test" | "/models/active" | "/models/catalog" | "/runtime-config" | "/skills" | "/skills/{skill_name}" | "/skills/{skill_name}/disable" | "/skills/{skill_name}/enable" | "/skills/{skill_name}/export" | "/skills/{skill_name}/files/{source}/{file_path}" | "/skills/available" | "/skills/batch-disable" | "/skills/batch-enable" | "/skills/import" | "/tools/schemas" | "/version" | "/workspace/export" | "/workspace/files" | "/workspace/files/{file_path}" | "/workspace/files/{file_path}/diff" | "/workspace/import" | "/workspace/uploads";
 
 export type APIMethodByPath = {
+  "/admin/runs": "get";
+  "/admin/runs/cancel": "post";
+  "/admin/stats": "get";
   "/agent/process": "post";
+  "/agent/runs/{run_id}/approve": "post";
+  "/agent/runs/{run_id}/cancel": "post";
+  "/agent/runs/{run_id}/events": "get";
+  "/agent/runs/{run_id}/reject": "post";
   "/agent/self/config-mutations/apply": "post";
   "/agent/self/config-mutations/preview": "post";
   "/agent/self/sessions/{session_id}/model": "put";
@@ -17,23 +24,43 @@ export type APIMethodByPath = {
   "/channels/qq/inbound": "post";
   "/channels/qq/state": "get";
   "/chats": "get" | "post";
-  "/chats/{chat_id}": "delete" | "get" | "put";
+  "/chats/{chat_id}": "delete" | "get" | "patch" | "put";
+  "/chats/{chat_id}/archive": "post";
+  "/chats/{chat_id}/meta": "get";
+  "/chats/{chat_id}/restore": "post";
+  "/chats/{chat_id}/summarize": "post";
+  "/chats/{chat_id}/unarchive": "post";
   "/chats/batch-delete": "post";
   "/config/channels": "get" | "put";
   "/config/channels/{channel_name}": "get" | "put";
+  "/config/channels/{channel_name}/capabilities": "get";
   "/config/channels/types": "get";
+  "/config/tools/disabled": "get" | "put";
   "/cron/jobs": "get" | "post";
   "/cron/jobs/{job_id}": "delete" | "get" | "put";
+  "/cron/jobs/{job_id}/disable": "post";
+  "/cron/jobs/{job_id}/enable": "post";
+  "/cron/jobs/{job_id}/history": "get";
   "/cron/jobs/{job_id}/pause": "post";
   "/cron/jobs/{job_id}/resume": "post";
   "/cron/jobs/{job_id}/run": "post";
+  "/cron/jobs/{job_id}/run-sync": "post";
   "/cron/jobs/{job_id}/state": "get";
-  "/envs": "get" | "put";
+  "/cron/jobs/batch": "post";
+  "/cron/jobs/validate": "post";
+  "/cron/leases/reap": "post";
+  "/cron/overview": "get";
+  "/cron/preview": "post";
+  "/envs": "get" | "patch" | "put";
   "/envs/{key}": "delete";
+  "/envs/export": "get";
   "/healthz": "get";
+  "/metrics": "get";
   "/models": "get";
   "/models/{provider_id}": "delete";
   "/models/{provider_id}/config": "put";
+  "/models/{provider_id}/remote-models": "get";
+  "/models/{provider_id}/test": "post";
   "/models/active": "get" | "put";
   "/models/catalog": "get";
   "/runtime-config": "get";
@@ -41,14 +68,18 @@ export type APIMethodByPath = {
   "/skills/{skill_name}": "delete";
   "/skills/{skill_name}/disable": "post";
   "/skills/{skill_name}/enable": "post";
+  "/skills/{skill_name}/export": "get";
   "/skills/{skill_name}/files/{source}/{file_path}": "get";
   "/skills/available": "get";
   "/skills/batch-disable": "post";
   "/skills/batch-enable": "post";
+  "/skills/import": "post";
+  "/tools/schemas": "get";
   "/version": "get";
   "/workspace/export": "get";
   "/workspace/files": "get";
   "/workspace/files/{file_path}": "delete" | "get" | "put";
+  "/workspace/files/{file_path}/diff": "post";
   "/workspace/import": "post";
   "/workspace/uploads": "post";
 };